@@ -3,10 +3,10 @@ package channels
 import (
 	"context"
 	"fmt"
-	"net/smtp"
 	"strings"
 
 	"github.com/DARC0625/LIMEN/backend/internal/alerting"
+	"github.com/DARC0625/LIMEN/backend/internal/mail"
 	"go.uber.org/zap"
 )
 
@@ -78,27 +78,8 @@ Message:
 		}
 	}
 
-	// SMTP authentication
-	auth := smtp.PlainAuth("", c.smtpUsername, c.smtpPassword, c.smtpHost)
-
-	// Build email headers
-	headers := make(map[string]string)
-	headers["From"] = c.from
-	headers["To"] = strings.Join(c.to, ", ")
-	headers["Subject"] = subject
-	headers["Content-Type"] = "text/plain; charset=UTF-8"
-
-	// Build message
-	message := ""
-	for k, v := range headers {
-		message += fmt.Sprintf("%s: %s\r\n", k, v)
-	}
-	message += "\r\n" + body
-
-	// Send email
-	addr := fmt.Sprintf("%s:%d", c.smtpHost, c.smtpPort)
-	err := smtp.SendMail(addr, auth, c.from, c.to, []byte(message))
-	if err != nil {
+	sender := mail.NewSMTPSender(c.smtpHost, c.smtpPort, c.smtpUsername, c.smtpPassword, c.from)
+	if err := sender.Send(ctx, mail.Message{To: c.to, Subject: subject, Body: body}); err != nil {
 		return fmt.Errorf("failed to send email: %w", err)
 	}
 
@@ -31,6 +31,14 @@ func LogEvent(ctx context.Context, action, resource, resourceID string, result s
 		userAgent = r.UserAgent()
 	}
 
+	// Name the personal access token of requests made with one
+	if tokenID, ok := middleware.GetAPITokenID(ctx); ok {
+		if metadata == nil {
+			metadata = make(map[string]interface{})
+		}
+		metadata["api_token_id"] = tokenID
+	}
+
 	// Serialize metadata to JSON
 	var metadataJSON string
 	if metadata != nil && len(metadata) > 0 {
@@ -85,6 +93,17 @@ func LogLogin(ctx context.Context, userID uint, username, role string, success b
 	})
 }
 
+// LogSSOLogin logs a user logging in through the OIDC identity provider issuer.
+// provisioned is set for the login that created the user.
+func LogSSOLogin(ctx context.Context, userID uint, username, role, issuer string, provisioned bool) {
+	LogEvent(ctx, "auth.sso_login", "user", fmt.Sprintf("%d", userID), "success", "", "", map[string]interface{}{
+		"username":    username,
+		"role":        role,
+		"issuer":      issuer,
+		"provisioned": provisioned,
+	})
+}
+
 // LogTokenRefresh logs a token refresh event.
 func LogTokenRefresh(ctx context.Context, userID uint, success bool) {
 	result := "success"
@@ -165,6 +184,35 @@ func LogVMDelete(ctx context.Context, userID uint, vmUUID string, success bool)
 	LogEvent(ctx, "vm.delete", "vm", vmUUID, result, errorCode, "", nil)
 }
 
+// LogVMNVRAMReset logs a UEFI NVRAM reset.
+func LogVMNVRAMReset(ctx context.Context, userID uint, vmUUID string, success bool, errorMessage string) {
+	result := "success"
+	errorCode := ""
+	if !success {
+		result = "failure"
+		errorCode = "VM_NVRAM_RESET_FAILED"
+	}
+
+	LogEvent(ctx, "vm.nvram_reset", "vm", vmUUID, result, errorCode, errorMessage, nil)
+}
+
+// LogVMMigrate logs the outcome of a VM migration between hosts.
+func LogVMMigrate(ctx context.Context, vmUUID string, sourceHostID, destHostID uint, live, copyStorage, success bool, errorMessage string) {
+	result := "success"
+	errorCode := ""
+	if !success {
+		result = "failure"
+		errorCode = "VM_MIGRATE_FAILED"
+	}
+
+	LogEvent(ctx, "vm.migrate", "vm", vmUUID, result, errorCode, errorMessage, map[string]interface{}{
+		"source_host_id": sourceHostID,
+		"dest_host_id":   destHostID,
+		"live":           live,
+		"copy_storage":   copyStorage,
+	})
+}
+
 // LogConsoleSessionStart logs a console session start event.
 func LogConsoleSessionStart(ctx context.Context, userID uint, sessionID, vmUUID string) {
 	LogEvent(ctx, "console.session_start", "session", sessionID, "success", "", "", map[string]interface{}{
@@ -180,6 +228,97 @@ func LogConsoleSessionEnd(ctx context.Context, userID uint, sessionID, vmUUID, r
 	})
 }
 
+// LogConsoleShareCreate logs a console session owner sharing the session.
+// inviteeID is 0 for a share link.
+func LogConsoleShareCreate(ctx context.Context, userID uint, sessionID, shareID string, inviteeID uint, mode string) {
+	LogEvent(ctx, "console.share_create", "session", sessionID, "success", "", "", map[string]interface{}{
+		"share_id":   shareID,
+		"invitee_id": inviteeID,
+		"mode":       mode,
+	})
+}
+
+// LogConsoleShareRevoke logs a console session share being revoked.
+func LogConsoleShareRevoke(ctx context.Context, userID uint, sessionID, shareID string) {
+	LogEvent(ctx, "console.share_revoke", "session", sessionID, "success", "", "", map[string]interface{}{
+		"share_id": shareID,
+	})
+}
+
+// LogConsoleParticipantJoin logs a user joining a shared console session.
+func LogConsoleParticipantJoin(ctx context.Context, userID uint, sessionID, participantID, mode string) {
+	LogEvent(ctx, "console.participant_join", "session", sessionID, "success", "", "", map[string]interface{}{
+		"participant_id": participantID,
+		"user_id":        userID,
+		"mode":           mode,
+	})
+}
+
+// LogConsoleParticipantLeave logs a participant leaving (or being removed from) a shared console session.
+func LogConsoleParticipantLeave(ctx context.Context, userID uint, sessionID, participantID string) {
+	LogEvent(ctx, "console.participant_leave", "session", sessionID, "success", "", "", map[string]interface{}{
+		"participant_id": participantID,
+		"user_id":        userID,
+	})
+}
+
+// LogConsoleSessionTerminate logs an admin force-ending another user's console session.
+func LogConsoleSessionTerminate(ctx context.Context, sessionID, vmUUID string, ownerID uint) {
+	LogEvent(ctx, "console.session_terminate", "session", sessionID, "success", "", "", map[string]interface{}{
+		"vm_uuid":  vmUUID,
+		"owner_id": ownerID,
+	})
+}
+
+// LogConsoleSessionLimitChange logs an admin setting or removing a console session limit override.
+// action is "set" or "delete"; exactly one of role and userID identifies the override's scope.
+func LogConsoleSessionLimitChange(ctx context.Context, limitID uint, role string, userID uint, action string) {
+	LogEvent(ctx, "console.session_limit_"+action, "console_session_limit", fmt.Sprintf("%d", limitID), "success", "", "", map[string]interface{}{
+		"role":    role,
+		"user_id": userID,
+	})
+}
+
+// LogHostChange logs an admin adding, updating or removing a compute host.
+// action is "create", "update" or "delete".
+func LogHostChange(ctx context.Context, hostID uint, name, uri, action string) {
+	LogEvent(ctx, "host."+action, "host", fmt.Sprintf("%d", hostID), "success", "", "", map[string]interface{}{
+		"name": name,
+		"uri":  uri,
+	})
+}
+
+// LogConsoleRecordingAccess logs an admin viewing or downloading a console recording.
+// access is "playback" or "download".
+func LogConsoleRecordingAccess(ctx context.Context, recordingID uint, sessionID, vmUUID, access string) {
+	LogEvent(ctx, "console.recording_"+access, "console_recording", fmt.Sprintf("%d", recordingID), "success", "", "", map[string]interface{}{
+		"session_id": sessionID,
+		"vm_uuid":    vmUUID,
+	})
+}
+
+// LogImageUpload logs the outcome of an image upload.
+func LogImageUpload(ctx context.Context, imageID uint, name, sha256 string, success bool, errorMessage string) {
+	result := "success"
+	errorCode := ""
+	if !success {
+		result = "failure"
+		errorCode = "IMAGE_INVALID"
+	}
+
+	LogEvent(ctx, "image.upload", "image", fmt.Sprintf("%d", imageID), result, errorCode, errorMessage, map[string]interface{}{
+		"name":   name,
+		"sha256": sha256,
+	})
+}
+
+// LogImageDelete logs an image deletion event.
+func LogImageDelete(ctx context.Context, imageID uint, name string) {
+	LogEvent(ctx, "image.delete", "image", fmt.Sprintf("%d", imageID), "success", "", "", map[string]interface{}{
+		"name": name,
+	})
+}
+
 // LogBetaAccessGrant logs a beta access grant event (admin action).
 func LogBetaAccessGrant(ctx context.Context, adminID uint, targetUserID uint, granted bool) {
 	LogPermissionChange(ctx, adminID, targetUserID, "beta_access", granted)
@@ -211,3 +350,102 @@ func GetAuditLogs(db *gorm.DB, userID *uint, action, resource string, limit, off
 
 	return logs, total, nil
 }
+
+// LogSessionRevoke logs login sessions being revoked: by their user, by an admin, or
+// because the user's role, approval or password changed. sessionID is empty when all
+// of the user's sessions are revoked.
+func LogSessionRevoke(ctx context.Context, userID uint, sessionID, reason string, count int) {
+	LogEvent(ctx, "auth.session_revoke", "user", fmt.Sprintf("%d", userID), "success", "", "", map[string]interface{}{
+		"session_id": sessionID,
+		"reason":     reason,
+		"count":      count,
+	})
+}
+
+// LogRefreshTokenReuse logs a rotated refresh token being used again, which revoked its
+// session.
+func LogRefreshTokenReuse(ctx context.Context, userID uint, sessionID string) {
+	LogEvent(ctx, "auth.refresh_token_reuse", "user", fmt.Sprintf("%d", userID), "failure", "REFRESH_TOKEN_REUSED", "", map[string]interface{}{
+		"session_id": sessionID,
+	})
+}
+
+// LogAccountUnlock logs an admin clearing a user's failed login attempts.
+func LogAccountUnlock(ctx context.Context, userID uint, wasLocked bool, failedAttempts int64) {
+	LogEvent(ctx, "auth.account_unlock", "user", fmt.Sprintf("%d", userID), "success", "", "", map[string]interface{}{
+		"was_locked":      wasLocked,
+		"failed_attempts": failedAttempts,
+	})
+}
+
+// LogMFAChange logs a user's MFA changing. action is "enable", "disable",
+// "recovery_codes_regenerate" (by the user) or "reset" (by an admin).
+func LogMFAChange(ctx context.Context, userID uint, action string) {
+	LogEvent(ctx, "auth.mfa_"+action, "user", fmt.Sprintf("%d", userID), "success", "", "", nil)
+}
+
+// LogMFARecoveryCodeUse logs a user authenticating with an MFA recovery code instead of
+// their authenticator.
+func LogMFARecoveryCodeUse(ctx context.Context, userID uint, codesLeft int) {
+	LogEvent(ctx, "auth.mfa_recovery_code_use", "user", fmt.Sprintf("%d", userID), "success", "", "", map[string]interface{}{
+		"recovery_codes_left": codesLeft,
+	})
+}
+
+// LogWebAuthnCredentialChange logs a user registering ("register") or removing
+// ("delete") a passkey or security key.
+func LogWebAuthnCredentialChange(ctx context.Context, userID, credentialID uint, action, name string) {
+	LogEvent(ctx, "auth.webauthn_"+action, "webauthn_credential", fmt.Sprintf("%d", credentialID), "success", "", "", map[string]interface{}{
+		"user_id": userID,
+		"name":    name,
+	})
+}
+
+// LogMFARolePolicyChange logs an admin setting whether a role requires MFA.
+func LogMFARolePolicyChange(ctx context.Context, role string, required bool) {
+	LogEvent(ctx, "auth.mfa_role_policy", "role", role, "success", "", "", map[string]interface{}{
+		"required": required,
+	})
+}
+
+// LogRoleChange logs a custom role being created ("create"), updated ("update") or
+// deleted ("delete").
+func LogRoleChange(ctx context.Context, name, action string, permissions []models.Permission) {
+	LogEvent(ctx, "auth.role_"+action, "role", name, "success", "", "", map[string]interface{}{
+		"permissions": permissions,
+	})
+}
+
+// LogAPITokenChange logs a personal access token being created ("create") or revoked
+// ("revoke") by its user, or all of a user's tokens being revoked by an admin
+// ("revoke_all", tokenID 0).
+func LogAPITokenChange(ctx context.Context, userID, tokenID uint, action, name string, scopes []string) {
+	LogEvent(ctx, "auth.api_token_"+action, "api_token", fmt.Sprintf("%d", tokenID), "success", "", "", map[string]interface{}{
+		"user_id": userID,
+		"name":    name,
+		"scopes":  scopes,
+	})
+}
+
+// LogPasswordChange logs a user changing their password ("change"), or resetting it
+// with a mailed link ("reset"). sessionsRevoked and apiTokensRevoked count the sessions
+// logged out and the API tokens revoked.
+func LogPasswordChange(ctx context.Context, userID uint, action string, sessionsRevoked int, apiTokensRevoked int64) {
+	LogEvent(ctx, "auth.password_"+action, "user", fmt.Sprintf("%d", userID), "success", "", "", map[string]interface{}{
+		"sessions_revoked":   sessionsRevoked,
+		"api_tokens_revoked": apiTokensRevoked,
+	})
+}
+
+// LogPasswordResetRequest logs a password reset link being mailed to a user.
+func LogPasswordResetRequest(ctx context.Context, userID uint) {
+	LogEvent(ctx, "auth.password_reset_request", "user", fmt.Sprintf("%d", userID), "success", "", "", nil)
+}
+
+// LogEmailChange logs a user changing their email address ("change") or verifying it
+// ("verify").
+func LogEmailChange(ctx context.Context, userID uint, action, email string) {
+	LogEvent(ctx, "auth.email_"+action, "user", fmt.Sprintf("%d", userID), "success", "", "", map[string]interface{}{
+		"email": email,
+	})
+}
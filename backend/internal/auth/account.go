@@ -0,0 +1,218 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidAccountToken = errors.New("invalid or expired link")
+	ErrExternalAccount     = errors.New("the account's password is managed by its identity provider")
+)
+
+const (
+	// PasswordResetTTL is how long a password reset link works.
+	PasswordResetTTL = 30 * time.Minute
+	// EmailVerificationTTL is how long an email verification link works.
+	EmailVerificationTTL = 48 * time.Hour
+	// AccountMailInterval is how often a user can be sent each kind of account mail.
+	AccountMailInterval = 5 * time.Minute
+
+	passwordResetAudience     = "limen-password-reset"
+	emailVerificationAudience = "limen-email-verification"
+)
+
+// AccountTokenClaims are the claims of the tokens mailed to users to reset their
+// password or verify their email address.
+type AccountTokenClaims struct {
+	UserID uint `json:"uid"`
+	// Binding is the state the token changes: a fingerprint of the password hash, or the
+	// email address. Once it changes the token stops working, so tokens work once.
+	Binding string `json:"bnd"`
+	jwt.RegisteredClaims
+}
+
+// AccountManager changes passwords and email addresses, and mints and redeems the
+// tokens of password resets and email verifications.
+//
+// Tokens are signed with a key derived from the JWT secret, like MFA challenges, so they
+// are never accepted as access tokens.
+type AccountManager struct {
+	db  *gorm.DB
+	key []byte
+	now func() time.Time
+
+	mu     sync.Mutex
+	mailed map[string]time.Time // Last account mail of each kind to each user
+}
+
+// NewAccountManager creates an account manager signing tokens with a key derived from
+// secret.
+func NewAccountManager(db *gorm.DB, secret string) *AccountManager {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("limen-account-token"))
+	return &AccountManager{
+		db:     db,
+		key:    mac.Sum(nil),
+		now:    time.Now,
+		mailed: make(map[string]time.Time),
+	}
+}
+
+// IsExternal reports whether a user was created from an external identity, and so has
+// no LIMEN password to change or reset.
+func (m *AccountManager) IsExternal(userID uint) (bool, error) {
+	var count int64
+	err := m.db.Model(&models.ExternalIdentity{}).Where("user_id = ?", userID).Count(&count).Error
+	return count > 0, err
+}
+
+// SetPassword replaces the password of user, who must not be an external one.
+func (m *AccountManager) SetPassword(user *models.User, password string) error {
+	if external, err := m.IsExternal(user.ID); err != nil {
+		return err
+	} else if external {
+		return ErrExternalAccount
+	}
+	hashed, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+	if err := m.db.Model(user).Update("password", hashed).Error; err != nil {
+		return err
+	}
+	user.Password = hashed
+	return nil
+}
+
+// SetEmail changes the email address of user, which then needs to be verified again.
+func (m *AccountManager) SetEmail(user *models.User, email string) error {
+	if err := m.db.Model(user).Updates(map[string]interface{}{"email": email, "email_verified": false}).Error; err != nil {
+		return err
+	}
+	user.Email, user.EmailVerified = email, false
+	return nil
+}
+
+// AllowMail reports whether the account mail kind can be sent to userID now, at most
+// once per AccountMailInterval, and counts it as sent if so. It keeps links from being
+// used to flood mailboxes.
+func (m *AccountManager) AllowMail(kind string, userID uint) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	for key, sent := range m.mailed {
+		if now.Sub(sent) >= AccountMailInterval {
+			delete(m.mailed, key)
+		}
+	}
+	key := fmt.Sprintf("%s:%d", kind, userID)
+	if _, ok := m.mailed[key]; ok {
+		return false
+	}
+	m.mailed[key] = now
+	return true
+}
+
+// IssuePasswordReset mints the token of a link resetting the password of user. It
+// stops working once the password changes.
+func (m *AccountManager) IssuePasswordReset(user *models.User) (string, error) {
+	return m.issue(passwordResetAudience, user.ID, m.passwordFingerprint(user.Password), PasswordResetTTL)
+}
+
+// IssueEmailVerification mints the token of a link verifying the email address of user.
+func (m *AccountManager) IssueEmailVerification(user *models.User) (string, error) {
+	return m.issue(emailVerificationAudience, user.ID, user.Email, EmailVerificationTTL)
+}
+
+// ResetPassword sets the password of the user a reset token was minted for and returns
+// them, or ErrInvalidAccountToken.
+func (m *AccountManager) ResetPassword(token, password string) (*models.User, error) {
+	user, claims, err := m.redeem(passwordResetAudience, token)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal([]byte(claims.Binding), []byte(m.passwordFingerprint(user.Password))) {
+		return nil, ErrInvalidAccountToken
+	}
+	if err := m.SetPassword(user, password); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// VerifyEmail marks the email address a verification token was minted for as verified
+// and returns its user, or ErrInvalidAccountToken.
+func (m *AccountManager) VerifyEmail(token string) (*models.User, error) {
+	user, claims, err := m.redeem(emailVerificationAudience, token)
+	if err != nil {
+		return nil, err
+	}
+	if user.EmailVerified || !strings.EqualFold(user.Email, claims.Binding) {
+		return nil, ErrInvalidAccountToken
+	}
+	if err := m.db.Model(user).Update("email_verified", true).Error; err != nil {
+		return nil, err
+	}
+	user.EmailVerified = true
+	return user, nil
+}
+
+func (m *AccountManager) issue(audience string, userID uint, binding string, ttl time.Duration) (string, error) {
+	tokenID, err := generateTokenID()
+	if err != nil {
+		return "", err
+	}
+	now := m.now()
+	claims := &AccountTokenClaims{
+		UserID:  userID,
+		Binding: binding,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID,
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			Audience:  []string{audience},
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(m.key)
+}
+
+func (m *AccountManager) redeem(audience, token string) (*models.User, *AccountTokenClaims, error) {
+	claims := &AccountTokenClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		return m.key, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithAudience(audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(m.now),
+	)
+	if err != nil || claims.UserID == 0 || claims.Binding == "" {
+		return nil, nil, ErrInvalidAccountToken
+	}
+	var user models.User
+	if err := m.db.First(&user, claims.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidAccountToken
+		}
+		return nil, nil, err
+	}
+	return &user, claims, nil
+}
+
+// passwordFingerprint identifies a password hash without revealing it.
+func (m *AccountManager) passwordFingerprint(hash string) string {
+	mac := hmac.New(sha256.New, m.key)
+	mac.Write([]byte(hash))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
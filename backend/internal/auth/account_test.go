@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupAccountManager(t *testing.T) (*AccountManager, *models.User) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.ExternalIdentity{}); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+	hashed, _ := bcrypt.GenerateFromPassword([]byte("Old-Password-1"), bcrypt.MinCost)
+	user := &models.User{Username: "alice", Password: string(hashed), Role: models.RoleUser, Email: "alice@example.org"}
+	db.Create(user)
+	return NewAccountManager(db, "test-secret"), user
+}
+
+func TestAccountManager_ResetPassword(t *testing.T) {
+	m, user := setupAccountManager(t)
+	token, err := m.IssuePasswordReset(user)
+	if err != nil {
+		t.Fatalf("IssuePasswordReset() error = %v", err)
+	}
+
+	reset, err := m.ResetPassword(token, "New-Password-2")
+	if err != nil || !CheckPassword("New-Password-2", reset.Password) {
+		t.Fatalf("ResetPassword() = %+v, %v", reset, err)
+	}
+	// The password changed, so the link is spent
+	if _, err := m.ResetPassword(token, "Another-Password-3"); !errors.Is(err, ErrInvalidAccountToken) {
+		t.Errorf("second ResetPassword() error = %v, want ErrInvalidAccountToken", err)
+	}
+
+	// Verification tokens don't reset passwords, nor do expired links
+	verification, _ := m.IssueEmailVerification(reset)
+	if _, err := m.ResetPassword(verification, "Another-Password-3"); !errors.Is(err, ErrInvalidAccountToken) {
+		t.Errorf("ResetPassword() with a verification token error = %v", err)
+	}
+	token, _ = m.IssuePasswordReset(reset)
+	m.now = func() time.Time { return time.Now().Add(PasswordResetTTL + time.Minute) }
+	if _, err := m.ResetPassword(token, "Another-Password-3"); !errors.Is(err, ErrInvalidAccountToken) {
+		t.Errorf("ResetPassword() with an expired token error = %v", err)
+	}
+}
+
+func TestAccountManager_VerifyEmail(t *testing.T) {
+	m, user := setupAccountManager(t)
+	token, _ := m.IssueEmailVerification(user)
+
+	// A link for an address the user since replaced doesn't verify the new one
+	stale := *user
+	if err := m.SetEmail(&stale, "alice@work.example"); err != nil {
+		t.Fatalf("SetEmail() error = %v", err)
+	}
+	if _, err := m.VerifyEmail(token); !errors.Is(err, ErrInvalidAccountToken) {
+		t.Errorf("VerifyEmail() for a replaced address error = %v", err)
+	}
+
+	token, _ = m.IssueEmailVerification(&stale)
+	verified, err := m.VerifyEmail(token)
+	if err != nil || !verified.EmailVerified || verified.Email != "alice@work.example" {
+		t.Fatalf("VerifyEmail() = %+v, %v", verified, err)
+	}
+	if _, err := m.VerifyEmail(token); !errors.Is(err, ErrInvalidAccountToken) {
+		t.Errorf("second VerifyEmail() error = %v, want ErrInvalidAccountToken", err)
+	}
+}
+
+func TestAccountManager_ExternalAndMailLimits(t *testing.T) {
+	m, user := setupAccountManager(t)
+	m.db.Create(&models.ExternalIdentity{UserID: user.ID, Issuer: "https://idp.example", Subject: "1"})
+	if err := m.SetPassword(user, "New-Password-2"); !errors.Is(err, ErrExternalAccount) {
+		t.Errorf("SetPassword() of an external user error = %v, want ErrExternalAccount", err)
+	}
+
+	now := time.Now()
+	m.now = func() time.Time { return now }
+	if !m.AllowMail("password_reset", user.ID) || m.AllowMail("password_reset", user.ID) {
+		t.Error("AllowMail() doesn't allow exactly one mail per interval")
+	}
+	if !m.AllowMail("email_verification", user.ID) {
+		t.Error("AllowMail() limits kinds of mail together")
+	}
+	now = now.Add(AccountMailInterval)
+	if !m.AllowMail("password_reset", user.ID) {
+		t.Error("AllowMail() after the interval = false")
+	}
+}
@@ -0,0 +1,233 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+const (
+	// APITokenPrefix starts every personal access token, telling them apart from JWTs
+	// (and letting secret scanners recognize them).
+	APITokenPrefix = "limen_pat_"
+	// MaxAPITokenLifetime bounds the expiry of personal access tokens.
+	MaxAPITokenLifetime = 365 * 24 * time.Hour
+	// MaxAPITokensPerUser bounds the unexpired tokens of each user.
+	MaxAPITokensPerUser = 25
+	// apiTokenUseInterval is how often the last use of a token is recorded.
+	apiTokenUseInterval = time.Minute
+)
+
+var (
+	ErrInvalidAPIToken  = errors.New("invalid or expired API token")
+	ErrInvalidScope     = errors.New("invalid API token scope")
+	ErrTooManyAPITokens = errors.New("too many API tokens")
+)
+
+// apiTokenResources maps the first segment of API paths to the resource their scopes
+// name. Tokens can't reach other endpoints, /api/auth in particular: a token can't
+// manage tokens.
+var apiTokenResources = map[string]string{
+	"vms":         "vm",
+	"snapshots":   "snapshot",
+	"images":      "image",
+	"os-profiles": "image",
+	"console":     "console",
+	"quota":       "quota",
+	"admin":       "admin",
+}
+
+// NormalizeScopes validates scopes of the form resource:read, resource:write or
+// resource:*, and returns them lowercase, sorted and without duplicates.
+func NormalizeScopes(scopes []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var out []string
+	for _, scope := range scopes {
+		scope = strings.ToLower(strings.TrimSpace(scope))
+		resource, action, _ := strings.Cut(scope, ":")
+		known := false
+		for _, r := range apiTokenResources {
+			known = known || r == resource
+		}
+		if !known || (action != "read" && action != "write" && action != "*") {
+			return nil, fmt.Errorf("%w %q", ErrInvalidScope, scope)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			out = append(out, scope)
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("%w: at least one scope is required", ErrInvalidScope)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// RequiredScope returns the scope a token needs for a request, and false for endpoints
+// tokens can't reach. Reading takes resource:read, anything else resource:write.
+func RequiredScope(method, path string) (string, bool) {
+	rest, ok := strings.CutPrefix(path, "/api/")
+	if !ok {
+		return "", false
+	}
+	segments := strings.Split(rest, "/")
+	resource, ok := apiTokenResources[segments[0]]
+	if !ok {
+		return "", false
+	}
+	// The snapshots and console of a VM are scoped apart from it
+	if resource == "vm" && len(segments) >= 3 {
+		switch segments[2] {
+		case "snapshots":
+			resource = "snapshot"
+		case "console":
+			// The ticket it hands out controls the VM, so it's never read access
+			return "console:write", true
+		}
+	}
+	if method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions {
+		return resource + ":read", true
+	}
+	return resource + ":write", true
+}
+
+// ScopeAllows reports whether the scopes granted include required, directly or by a
+// resource:* scope.
+func ScopeAllows(granted []string, required string) bool {
+	resource, _, _ := strings.Cut(required, ":")
+	for _, scope := range granted {
+		if scope == required || scope == resource+":*" {
+			return true
+		}
+	}
+	return false
+}
+
+// APITokenStore keeps personal access tokens.
+type APITokenStore struct {
+	db  *gorm.DB
+	now func() time.Time
+}
+
+// NewAPITokenStore returns a store of the tokens in db.
+func NewAPITokenStore(db *gorm.DB) *APITokenStore {
+	return &APITokenStore{db: db, now: time.Now}
+}
+
+// Create issues a token of userID named name, with scopes, valid for ttl. It returns
+// the token, which isn't stored, with its record.
+func (s *APITokenStore) Create(userID uint, name string, scopes []string, ttl time.Duration) (*models.APIToken, string, error) {
+	scopes, err := NormalizeScopes(scopes)
+	if err != nil {
+		return nil, "", err
+	}
+	if ttl <= 0 || ttl > MaxAPITokenLifetime {
+		return nil, "", fmt.Errorf("API token lifetime %v is out of range", ttl)
+	}
+
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return nil, "", err
+	}
+	secret := base64.RawURLEncoding.EncodeToString(random)
+	token := APITokenPrefix + secret
+	now := s.now()
+	record := &models.APIToken{
+		UserID:    userID,
+		Name:      name,
+		TokenHash: hashAPIToken(token),
+		Prefix:    APITokenPrefix + secret[:6],
+		Scopes:    strings.Join(scopes, ","),
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.APIToken{}).Where("user_id = ? AND expires_at > ?", userID, now).Count(&count).Error; err != nil {
+			return err
+		}
+		if count >= MaxAPITokensPerUser {
+			return ErrTooManyAPITokens
+		}
+		return tx.Create(record).Error
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return record, token, nil
+}
+
+// List returns the tokens of userID, newest first, expired ones included.
+func (s *APITokenStore) List(userID uint) ([]models.APIToken, error) {
+	var tokens []models.APIToken
+	err := s.db.Where("user_id = ?", userID).Order("created_at DESC, id DESC").Find(&tokens).Error
+	return tokens, err
+}
+
+// Revoke deletes token id of userID and returns it, or gorm.ErrRecordNotFound.
+func (s *APITokenStore) Revoke(userID, id uint) (*models.APIToken, error) {
+	var token models.APIToken
+	if err := s.db.Where("id = ? AND user_id = ?", id, userID).First(&token).Error; err != nil {
+		return nil, err
+	}
+	if err := s.db.Delete(&token).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// RevokeAll deletes the tokens of userID and returns how many there were.
+func (s *APITokenStore) RevokeAll(userID uint) (int64, error) {
+	result := s.db.Where("user_id = ?", userID).Delete(&models.APIToken{})
+	return result.RowsAffected, result.Error
+}
+
+// Authenticate returns the record of token and its user, with their current role and
+// approval, or ErrInvalidAPIToken. It records the use from clientIP.
+func (s *APITokenStore) Authenticate(token, clientIP string) (*models.APIToken, *models.User, error) {
+	if !strings.HasPrefix(token, APITokenPrefix) {
+		return nil, nil, ErrInvalidAPIToken
+	}
+	var record models.APIToken
+	if err := s.db.Where("token_hash = ?", hashAPIToken(token)).First(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidAPIToken
+		}
+		return nil, nil, err
+	}
+	now := s.now()
+	if !now.Before(record.ExpiresAt) {
+		return nil, nil, ErrInvalidAPIToken
+	}
+	var user models.User
+	if err := s.db.First(&user, record.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidAPIToken
+		}
+		return nil, nil, err
+	}
+
+	if record.LastUsedAt == nil || now.Sub(*record.LastUsedAt) >= apiTokenUseInterval || record.LastUsedIP != clientIP {
+		record.LastUsedAt, record.LastUsedIP = &now, clientIP
+		if err := s.db.Model(&record).Updates(map[string]interface{}{"last_used_at": now, "last_used_ip": clientIP}).Error; err != nil {
+			return nil, nil, err
+		}
+	}
+	return &record, &user, nil
+}
+
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestNormalizeScopes(t *testing.T) {
+	scopes, err := NormalizeScopes([]string{" VM:read", "snapshot:*", "vm:read"})
+	if err != nil || len(scopes) != 2 || scopes[0] != "snapshot:*" || scopes[1] != "vm:read" {
+		t.Errorf("NormalizeScopes() = %v, %v", scopes, err)
+	}
+	for _, invalid := range [][]string{nil, {"vm"}, {"vm:delete"}, {"users:read"}, {"*"}} {
+		if _, err := NormalizeScopes(invalid); !errors.Is(err, ErrInvalidScope) {
+			t.Errorf("NormalizeScopes(%q) error = %v, want ErrInvalidScope", invalid, err)
+		}
+	}
+}
+
+func TestRequiredScope(t *testing.T) {
+	tests := []struct {
+		method, path string
+		want         string
+	}{
+		{"GET", "/api/vms", "vm:read"},
+		{"POST", "/api/vms/0b1c/action", "vm:write"},
+		{"GET", "/api/vms/0b1c/snapshots", "snapshot:read"},
+		{"DELETE", "/api/snapshots/3", "snapshot:write"},
+		{"GET", "/api/vms/0b1c/console", "console:write"},
+		{"GET", "/api/console/sessions", "console:read"},
+		{"PUT", "/api/images/uploads/1", "image:write"},
+		{"GET", "/api/os-profiles", "image:read"},
+		{"GET", "/api/admin/users", "admin:read"},
+		{"GET", "/api/auth/tokens", ""},
+		{"GET", "/api/hardware/spec", ""},
+	}
+	for _, tt := range tests {
+		scope, ok := RequiredScope(tt.method, tt.path)
+		if scope != tt.want || ok != (tt.want != "") {
+			t.Errorf("RequiredScope(%s %s) = %q, %v; want %q", tt.method, tt.path, scope, ok, tt.want)
+		}
+	}
+
+	if !ScopeAllows([]string{"vm:*"}, "vm:write") || !ScopeAllows([]string{"vm:read"}, "vm:read") ||
+		ScopeAllows([]string{"vm:read"}, "vm:write") || ScopeAllows([]string{"snapshot:*"}, "vm:read") {
+		t.Error("ScopeAllows() doesn't match exact scopes and resource:* only")
+	}
+}
+
+func TestAPITokenStore(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.APIToken{}); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+	alice := models.User{Username: "alice", Password: "x", Role: models.RoleUser, Approved: true}
+	db.Create(&alice)
+	store := NewAPITokenStore(db)
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	record, token, err := store.Create(alice.ID, "ci", []string{"vm:read"}, time.Hour)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	var stored models.APIToken
+	db.First(&stored, record.ID)
+	if stored.TokenHash == token || stored.TokenHash != hashAPIToken(token) || len(token) < len(APITokenPrefix)+40 {
+		t.Errorf("stored token %+v; want only the hash of %q", stored, token)
+	}
+
+	got, user, err := store.Authenticate(token, "10.0.0.1")
+	if err != nil || got.ID != record.ID || user.ID != alice.ID {
+		t.Fatalf("Authenticate() = %+v, %+v, %v", got, user, err)
+	}
+	db.First(&stored, record.ID)
+	if stored.LastUsedAt == nil || stored.LastUsedIP != "10.0.0.1" {
+		t.Errorf("last use = %v from %q, want recorded", stored.LastUsedAt, stored.LastUsedIP)
+	}
+
+	now = now.Add(time.Hour)
+	if _, _, err := store.Authenticate(token, "10.0.0.1"); !errors.Is(err, ErrInvalidAPIToken) {
+		t.Errorf("expired token error = %v, want ErrInvalidAPIToken", err)
+	}
+	if _, _, err := store.Authenticate(APITokenPrefix+"forged", "10.0.0.1"); !errors.Is(err, ErrInvalidAPIToken) {
+		t.Errorf("unknown token error = %v, want ErrInvalidAPIToken", err)
+	}
+
+	// Tokens of other users can't be revoked
+	if _, err := store.Revoke(alice.ID+1, record.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("Revoke() by another user error = %v", err)
+	}
+	if _, err := store.Revoke(alice.ID, record.ID); err != nil {
+		t.Errorf("Revoke() error = %v", err)
+	}
+	if tokens, _ := store.List(alice.ID); len(tokens) != 0 {
+		t.Errorf("List() after revoking = %d tokens", len(tokens))
+	}
+
+	for i := 0; i < MaxAPITokensPerUser; i++ {
+		if _, _, err := store.Create(alice.ID, "bulk", []string{"vm:read"}, time.Hour); err != nil {
+			t.Fatalf("Create() #%d error = %v", i, err)
+		}
+	}
+	if _, _, err := store.Create(alice.ID, "one too many", []string{"vm:read"}, time.Hour); !errors.Is(err, ErrTooManyAPITokens) {
+		t.Errorf("Create() over the limit error = %v, want ErrTooManyAPITokens", err)
+	}
+	if count, err := store.RevokeAll(alice.ID); err != nil || count != MaxAPITokensPerUser {
+		t.Errorf("RevokeAll() = %d, %v", count, err)
+	}
+}
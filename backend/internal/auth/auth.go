@@ -102,13 +102,18 @@ type Claims struct {
 	jwt.RegisteredClaims
 }
 
-// GenerateToken generates a JWT token for a user.
+// GenerateToken generates an HS256 JWT token for a user.
 func GenerateToken(userID uint, username string, role string, secret string, expiryHours int) (string, error) {
 	return GenerateTokenWithApproval(userID, username, role, true, secret, expiryHours)
 }
 
-// GenerateTokenWithApproval generates a JWT token for a user with approval status.
+// GenerateTokenWithApproval generates an HS256 JWT token for a user with approval status.
 func GenerateTokenWithApproval(userID uint, username string, role string, approved bool, secret string, expiryHours int) (string, error) {
+	return NewHMACKeySet(secret).GenerateTokenWithApproval(userID, username, role, approved, expiryHours)
+}
+
+// GenerateTokenWithApproval generates a JWT token for a user with approval status.
+func (k *KeySet) GenerateTokenWithApproval(userID uint, username string, role string, approved bool, expiryHours int) (string, error) {
 	expirationTime := time.Now().Add(time.Duration(expiryHours) * time.Hour)
 	claims := &Claims{
 		UserID:   userID,
@@ -121,21 +126,18 @@ func GenerateTokenWithApproval(userID uint, username string, role string, approv
 			Issuer:    "limen",
 		},
 	}
+	return k.Sign(claims)
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secret))
+// ValidateToken validates an HS256 JWT token and returns the claims.
+func ValidateToken(tokenString string, secret string) (*Claims, error) {
+	return NewHMACKeySet(secret).ValidateToken(tokenString)
 }
 
 // ValidateToken validates a JWT token and returns the claims.
-func ValidateToken(tokenString string, secret string) (*Claims, error) {
+func (k *KeySet) ValidateToken(tokenString string) (*Claims, error) {
 	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("unexpected signing method")
-		}
-		return []byte(secret), nil
-	})
-
+	token, err := k.Parse(tokenString, claims)
 	if err != nil {
 		if errors.Is(err, jwt.ErrTokenExpired) {
 			return nil, ErrTokenExpired
@@ -165,13 +167,23 @@ func ExtractTokenFromHeader(authHeader string) (string, error) {
 	return authHeader[len(bearerPrefix):], nil
 }
 
-// GenerateAccessToken generates a short-lived access token (15 minutes).
+// GenerateAccessToken generates a short-lived HS256 access token (15 minutes).
 func GenerateAccessToken(userID uint, username, role string, approved bool, secret string) (string, error) {
-	return GenerateAccessTokenWithBetaAccess(userID, username, role, approved, false, secret)
+	return NewHMACKeySet(secret).GenerateAccessToken(userID, username, role, approved)
 }
 
-// GenerateAccessTokenWithBetaAccess generates a short-lived access token with beta access flag.
+// GenerateAccessTokenWithBetaAccess generates a short-lived HS256 access token with beta access flag.
 func GenerateAccessTokenWithBetaAccess(userID uint, username, role string, approved, betaAccess bool, secret string) (string, error) {
+	return NewHMACKeySet(secret).GenerateAccessTokenWithBetaAccess(userID, username, role, approved, betaAccess)
+}
+
+// GenerateAccessToken generates a short-lived access token (15 minutes).
+func (k *KeySet) GenerateAccessToken(userID uint, username, role string, approved bool) (string, error) {
+	return k.GenerateAccessTokenWithBetaAccess(userID, username, role, approved, false)
+}
+
+// GenerateAccessTokenWithBetaAccess generates a short-lived access token with beta access flag.
+func (k *KeySet) GenerateAccessTokenWithBetaAccess(userID uint, username, role string, approved, betaAccess bool) (string, error) {
 	expirationTime := time.Now().Add(15 * time.Minute) // 15 minutes
 	claims := &Claims{
 		UserID:     userID,
@@ -185,18 +197,26 @@ func GenerateAccessTokenWithBetaAccess(userID uint, username, role string, appro
 			Issuer:    "limen",
 		},
 	}
+	return k.Sign(claims)
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secret))
+// GenerateRefreshToken generates a long-lived HS256 refresh token (7 days).
+func GenerateRefreshToken(userID uint, username, role string, approved bool, secret string) (string, string, error) {
+	return NewHMACKeySet(secret).GenerateRefreshToken(userID, username, role, approved)
+}
+
+// GenerateRefreshTokenWithBetaAccess generates a long-lived HS256 refresh token with beta access flag.
+func GenerateRefreshTokenWithBetaAccess(userID uint, username, role string, approved, betaAccess bool, secret string) (string, string, error) {
+	return NewHMACKeySet(secret).GenerateRefreshTokenWithBetaAccess(userID, username, role, approved, betaAccess)
 }
 
 // GenerateRefreshToken generates a long-lived refresh token (7 days).
-func GenerateRefreshToken(userID uint, username, role string, approved bool, secret string) (string, string, error) {
-	return GenerateRefreshTokenWithBetaAccess(userID, username, role, approved, false, secret)
+func (k *KeySet) GenerateRefreshToken(userID uint, username, role string, approved bool) (string, string, error) {
+	return k.GenerateRefreshTokenWithBetaAccess(userID, username, role, approved, false)
 }
 
 // GenerateRefreshTokenWithBetaAccess generates a long-lived refresh token with beta access flag.
-func GenerateRefreshTokenWithBetaAccess(userID uint, username, role string, approved, betaAccess bool, secret string) (string, string, error) {
+func (k *KeySet) GenerateRefreshTokenWithBetaAccess(userID uint, username, role string, approved, betaAccess bool) (string, string, error) {
 	// Generate unique token ID for rotation
 	tokenID, err := generateTokenID()
 	if err != nil {
@@ -218,8 +238,7 @@ func GenerateRefreshTokenWithBetaAccess(userID uint, username, role string, appr
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(secret))
+	tokenString, err := k.Sign(claims)
 	if err != nil {
 		return "", "", err
 	}
@@ -227,16 +246,15 @@ func GenerateRefreshTokenWithBetaAccess(userID uint, username, role string, appr
 	return tokenString, tokenID, nil
 }
 
-// ValidateRefreshToken validates a refresh token and returns the claims.
+// ValidateRefreshToken validates an HS256 refresh token and returns the claims.
 func ValidateRefreshToken(tokenString, secret string) (*RefreshTokenClaims, error) {
-	claims := &RefreshTokenClaims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("unexpected signing method")
-		}
-		return []byte(secret), nil
-	})
+	return NewHMACKeySet(secret).ValidateRefreshToken(tokenString)
+}
 
+// ValidateRefreshToken validates a refresh token and returns the claims.
+func (k *KeySet) ValidateRefreshToken(tokenString string) (*RefreshTokenClaims, error) {
+	claims := &RefreshTokenClaims{}
+	token, err := k.Parse(tokenString, claims)
 	if err != nil {
 		if errors.Is(err, jwt.ErrTokenExpired) {
 			return nil, ErrTokenExpired
@@ -276,13 +294,18 @@ func generateTokenID() (string, error) {
 //   - ok: true if authentication succeeded, false otherwise
 //   - err: Error details if authentication failed (for logging)
 func ResolveUserFromRefreshToken(refreshToken, jwtSecret string) (userID uint, claims *RefreshTokenClaims, ok bool, err error) {
+	return NewHMACKeySet(jwtSecret).ResolveUserFromRefreshToken(refreshToken)
+}
+
+// ResolveUserFromRefreshToken is ResolveUserFromRefreshToken for tokens of the key set.
+func (k *KeySet) ResolveUserFromRefreshToken(refreshToken string) (userID uint, claims *RefreshTokenClaims, ok bool, err error) {
 	// 1. Check if refresh token exists
 	if refreshToken == "" {
 		return 0, nil, false, ErrInvalidRefreshToken
 	}
 
 	// 2. Validate refresh token (signature + expiration)
-	refreshClaims, err := ValidateRefreshToken(refreshToken, jwtSecret)
+	refreshClaims, err := k.ValidateRefreshToken(refreshToken)
 	if err != nil {
 		// ErrTokenExpired or ErrInvalidRefreshToken
 		return 0, nil, false, err
@@ -318,13 +341,18 @@ func ResolveUserFromRefreshToken(refreshToken, jwtSecret string) (userID uint, c
 //   - claims: Refresh token claims if token is valid
 //   - err: Error if token validation fails
 func ParseRefreshTokenForRecovery(refreshToken, jwtSecret string) (*RefreshTokenClaims, error) {
+	return NewHMACKeySet(jwtSecret).ParseRefreshTokenForRecovery(refreshToken)
+}
+
+// ParseRefreshTokenForRecovery is ParseRefreshTokenForRecovery for tokens of the key set.
+func (k *KeySet) ParseRefreshTokenForRecovery(refreshToken string) (*RefreshTokenClaims, error) {
 	// 1. Check if refresh token exists
 	if refreshToken == "" {
 		return nil, ErrInvalidRefreshToken
 	}
 
 	// 2. Validate refresh token (signature + expiration)
-	refreshClaims, err := ValidateRefreshToken(refreshToken, jwtSecret)
+	refreshClaims, err := k.ValidateRefreshToken(refreshToken)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,254 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/DARC0625/LIMEN/backend/internal/logger"
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// ErrUnknownUser is returned by authenticators that don't know the user; those that do
+// return ErrInvalidCredentials when the password is wrong.
+var ErrUnknownUser = errors.New("unknown user")
+
+// Authenticator checks usernames and passwords against a user directory.
+type Authenticator interface {
+	// Name identifies the directory in logs and audit records.
+	Name() string
+	// Authenticate returns the user a username and password log in, with their role and
+	// approval up to date. It returns ErrUnknownUser or ErrInvalidCredentials when they
+	// don't, and other errors when the directory can't tell.
+	Authenticate(ctx context.Context, username, password string) (*models.User, error)
+}
+
+// LocalAuthenticator checks passwords against the users table. Users created from an
+// external identity have no LIMEN password: to it, they are unknown.
+type LocalAuthenticator struct {
+	db *gorm.DB
+}
+
+// NewLocalAuthenticator returns an Authenticator of the users in db.
+func NewLocalAuthenticator(db *gorm.DB) *LocalAuthenticator {
+	return &LocalAuthenticator{db: db}
+}
+
+// Name implements Authenticator.
+func (a *LocalAuthenticator) Name() string {
+	return "local"
+}
+
+// Authenticate implements Authenticator.
+func (a *LocalAuthenticator) Authenticate(ctx context.Context, username, password string) (*models.User, error) {
+	var user models.User
+	if err := a.db.WithContext(ctx).Where("username = ?", username).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUnknownUser
+		}
+		return nil, err
+	}
+	var external int64
+	if err := a.db.WithContext(ctx).Model(&models.ExternalIdentity{}).Where("user_id = ?", user.ID).Count(&external).Error; err != nil {
+		return nil, err
+	}
+	if external > 0 {
+		return nil, ErrUnknownUser
+	}
+	if !CheckPassword(password, user.Password) {
+		return nil, ErrInvalidCredentials
+	}
+	return &user, nil
+}
+
+// ChainAuthenticator tries its authenticators in order and logs the user in with the
+// first that accepts the password. A directory that is unavailable is skipped, so that
+// local admins can still log in when it is down; the error is returned only when no
+// directory accepted the password and none rejected it.
+type ChainAuthenticator []Authenticator
+
+// Name implements Authenticator.
+func (c ChainAuthenticator) Name() string {
+	names := make([]string, len(c))
+	for i, a := range c {
+		names[i] = a.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+// Authenticate implements Authenticator.
+func (c ChainAuthenticator) Authenticate(ctx context.Context, username, password string) (*models.User, error) {
+	result := ErrUnknownUser
+	var unavailable error
+	for _, a := range c {
+		user, err := a.Authenticate(ctx, username, password)
+		switch {
+		case err == nil:
+			return user, nil
+		case errors.Is(err, ErrInvalidCredentials):
+			result = ErrInvalidCredentials
+		case errors.Is(err, ErrUnknownUser):
+		default:
+			logger.Log.Warn("Authentication backend unavailable", zap.String("backend", a.Name()), zap.Error(err))
+			unavailable = fmt.Errorf("%s: %w", a.Name(), err)
+		}
+	}
+	if result == ErrUnknownUser && unavailable != nil {
+		return nil, unavailable
+	}
+	return nil, result
+}
+
+// GroupMapping maps a directory's groups to user attributes. Each attribute with groups
+// configured follows the directory at every login: users get it while they are in one of
+// its groups and lose it when they leave. Attributes without groups are left to admins,
+// with the defaults of registered users for new users. Groups match case-insensitively,
+// by name or, for groups named by a DN, by their whole DN: cn=lab-admins,ou=groups,...
+// is not lab-admins, which could be any group of that name anywhere in the directory.
+type GroupMapping struct {
+	AdminGroups    []string // Members get models.RoleAdmin; admins who aren't get models.RoleUser
+	ApprovedGroups []string // Members are approved
+	BetaGroups     []string // Members get beta access
+}
+
+// Apply sets the attributes of user the mapped groups decide, and reports whether any
+// changed.
+func (m GroupMapping) Apply(user *models.User, groups []string) bool {
+	before := *user
+	// Other roles are given by admins: the groups only decide who is an admin
+	if len(m.AdminGroups) > 0 {
+		if memberOf(groups, m.AdminGroups) {
+			user.Role = models.RoleAdmin
+		} else if user.Role == models.RoleAdmin {
+			user.Role = models.RoleUser
+		}
+	}
+	if len(m.ApprovedGroups) > 0 {
+		user.Approved = memberOf(groups, m.ApprovedGroups)
+	}
+	if len(m.BetaGroups) > 0 {
+		user.BetaAccess = memberOf(groups, m.BetaGroups)
+	}
+	return user.Role != before.Role || user.Approved != before.Approved || user.BetaAccess != before.BetaAccess
+}
+
+func memberOf(groups, of []string) bool {
+	for _, g := range groups {
+		g = normalizeGroup(g)
+		for _, o := range of {
+			if g == normalizeGroup(o) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// normalizeGroup lowercases a group name or DN and, for a DN, removes the spaces around
+// its separators, so that "CN=Lab Admins, OU=Groups" is "cn=lab admins,ou=groups".
+func normalizeGroup(group string) string {
+	group = strings.ToLower(strings.TrimSpace(group))
+	if !strings.Contains(group, "=") {
+		return group
+	}
+	var rdns []string
+	start := 0
+	for i := 0; i < len(group); i++ {
+		switch group[i] {
+		case '\\':
+			i++ // Escaped character, e.g. \,
+		case ',':
+			rdns = append(rdns, group[start:i])
+			start = i + 1
+		}
+	}
+	rdns = append(rdns, group[start:])
+	for i, rdn := range rdns {
+		if name, value, ok := strings.Cut(rdn, "="); ok {
+			rdn = strings.TrimSpace(name) + "=" + strings.TrimSpace(value)
+		}
+		rdns[i] = strings.TrimSpace(rdn)
+	}
+	return strings.Join(rdns, ",")
+}
+
+// ErrExternalUserDeleted is returned by ProvisionExternalUser for identities whose
+// LIMEN user was deleted: logins don't bring deleted users back.
+var ErrExternalUserDeleted = errors.New("the user of this identity was deleted")
+
+// ExternalLogin is a login of a user of an external directory or identity provider.
+type ExternalLogin struct {
+	Issuer  string // Identifies the directory or provider in ExternalIdentity records
+	Subject string // The user's stable identifier there
+	Email   string
+	Groups  []string
+	// Username picks the username of a user created at their first login
+	Username func(tx *gorm.DB) (string, error)
+}
+
+// ProvisionExternalUser returns the user of an external login, creating it at its first
+// login, with the attributes mapping grants from its groups, and records the login on
+// its models.ExternalIdentity. It reports whether the user was created.
+func ProvisionExternalUser(db *gorm.DB, mapping GroupMapping, login ExternalLogin, now time.Time) (*models.User, bool, error) {
+	var user models.User
+	created := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var link models.ExternalIdentity
+		if err := tx.Where("issuer = ? AND subject = ?", login.Issuer, login.Subject).Limit(1).Find(&link).Error; err != nil {
+			return err
+		}
+
+		if link.ID != 0 {
+			if err := tx.Unscoped().First(&user, link.UserID).Error; err != nil {
+				return err
+			}
+			if user.DeletedAt.Valid {
+				return ErrExternalUserDeleted
+			}
+			if mapping.Apply(&user, login.Groups) {
+				if err := tx.Save(&user).Error; err != nil {
+					return err
+				}
+			}
+			return tx.Model(&link).Updates(map[string]interface{}{"email": login.Email, "last_login_at": now}).Error
+		}
+
+		username, err := login.Username(tx)
+		if err != nil {
+			return err
+		}
+		// No LIMEN password: the unusable hash of a random one
+		random := make([]byte, 32)
+		if _, err := rand.Read(random); err != nil {
+			return err
+		}
+		password, err := HashPassword(base64.RawURLEncoding.EncodeToString(random))
+		if err != nil {
+			return err
+		}
+		user = models.User{Username: username, Password: password, Role: models.RoleUser}
+		mapping.Apply(&user, login.Groups)
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		created = true
+		return tx.Create(&models.ExternalIdentity{
+			UserID:      user.ID,
+			Issuer:      login.Issuer,
+			Subject:     login.Subject,
+			Email:       login.Email,
+			CreatedAt:   now,
+			LastLoginAt: &now,
+		}).Error
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return &user, created, nil
+}
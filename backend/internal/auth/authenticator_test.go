@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DARC0625/LIMEN/backend/internal/logger"
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// stubAuthenticator answers every login with user and err.
+type stubAuthenticator struct {
+	user *models.User
+	err  error
+}
+
+func (s stubAuthenticator) Name() string { return "stub" }
+
+func (s stubAuthenticator) Authenticate(ctx context.Context, username, password string) (*models.User, error) {
+	return s.user, s.err
+}
+
+func TestLocalAuthenticator(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.ExternalIdentity{}); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+	hashed, _ := bcrypt.GenerateFromPassword([]byte("correct-password"), bcrypt.MinCost)
+	db.Create(&models.User{Username: "alice", Password: string(hashed), Role: models.RoleUser})
+	a := NewLocalAuthenticator(db)
+
+	if user, err := a.Authenticate(context.Background(), "alice", "correct-password"); err != nil || user.Username != "alice" {
+		t.Errorf("Authenticate() = %+v, %v", user, err)
+	}
+	if _, err := a.Authenticate(context.Background(), "alice", "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("wrong password error = %v, want ErrInvalidCredentials", err)
+	}
+	if _, err := a.Authenticate(context.Background(), "bob", "correct-password"); !errors.Is(err, ErrUnknownUser) {
+		t.Errorf("unknown user error = %v, want ErrUnknownUser", err)
+	}
+
+	// Users of external directories are theirs
+	sso := models.User{Username: "sso_user", Password: string(hashed), Role: models.RoleUser}
+	db.Create(&sso)
+	db.Create(&models.ExternalIdentity{UserID: sso.ID, Issuer: "https://idp.example", Subject: "1"})
+	if _, err := a.Authenticate(context.Background(), "sso_user", "correct-password"); !errors.Is(err, ErrUnknownUser) {
+		t.Errorf("external user error = %v, want ErrUnknownUser", err)
+	}
+}
+
+func TestChainAuthenticator(t *testing.T) {
+	logger.Init("debug")
+	alice := &models.User{Username: "alice"}
+	unknown := stubAuthenticator{err: ErrUnknownUser}
+	invalid := stubAuthenticator{err: ErrInvalidCredentials}
+	down := stubAuthenticator{err: errors.New("connection refused")}
+	accepts := stubAuthenticator{user: alice}
+
+	tests := []struct {
+		name  string
+		chain ChainAuthenticator
+		want  error
+	}{
+		{"first directory accepts", ChainAuthenticator{accepts, down}, nil},
+		{"falls back when unknown", ChainAuthenticator{unknown, accepts}, nil},
+		{"falls back when rejected", ChainAuthenticator{invalid, accepts}, nil},
+		{"skips unavailable directories", ChainAuthenticator{down, accepts}, nil},
+		{"rejection beats unavailability", ChainAuthenticator{down, invalid}, ErrInvalidCredentials},
+		{"nobody knows the user", ChainAuthenticator{unknown, unknown}, ErrUnknownUser},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := tt.chain.Authenticate(context.Background(), "alice", "password")
+			if tt.want == nil && (err != nil || user != alice) {
+				t.Errorf("Authenticate() = %+v, %v; want alice", user, err)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("Authenticate() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	_, err := ChainAuthenticator{unknown, down}.Authenticate(context.Background(), "alice", "password")
+	if err == nil || errors.Is(err, ErrUnknownUser) || errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Authenticate() with the user's directory down error = %v, want the directory's", err)
+	}
+}
+
+func TestGroupMapping_Apply(t *testing.T) {
+	m := GroupMapping{AdminGroups: []string{"CN=Lab-Admins, OU=Groups, DC=example, DC=org"}, ApprovedGroups: []string{"Students"}}
+
+	user := &models.User{Role: models.RoleUser, BetaAccess: true}
+	if !m.Apply(user, []string{"cn=lab-admins,ou=groups,dc=example,dc=org", "students"}) ||
+		user.Role != models.RoleAdmin || !user.Approved || !user.BetaAccess {
+		t.Errorf("Apply() = %+v; want an approved admin, beta access left alone", user)
+	}
+	if !m.Apply(user, []string{"cn=lab-admins,ou=guests,dc=example,dc=org", "cn=students,ou=groups,dc=example,dc=org"}) ||
+		user.Role != models.RoleUser || user.Approved {
+		t.Errorf("Apply() with groups of the same names elsewhere = %+v", user)
+	}
+	if m.Apply(user, nil) {
+		t.Error("Apply() without changes reported some")
+	}
+
+	// Roles other than admin are left to admins
+	operator := &models.User{Role: models.RoleOperator}
+	if m.Apply(operator, []string{"students"}); operator.Role != models.RoleOperator {
+		t.Errorf("Apply() to an operator outside the admin groups = %+v, want the role left alone", operator)
+	}
+	if m.Apply(operator, []string{"cn=lab-admins,ou=groups,dc=example,dc=org"}); operator.Role != models.RoleAdmin {
+		t.Errorf("Apply() to an operator in the admin groups = %+v, want admin", operator)
+	}
+}
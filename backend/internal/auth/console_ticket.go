@@ -0,0 +1,178 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/DARC0625/LIMEN/backend/internal/security"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ConsoleTicketClaims are the claims of a console ticket: a short-lived, single-use
+// token that opens one console WebSocket for one VM (Subject) from one client IP.
+type ConsoleTicketClaims struct {
+	Claims
+	ClientIP string `json:"cip,omitempty"`
+	ShareID  string `json:"shr,omitempty"` // Joins the session of this share instead of opening a new one
+}
+
+// ConsoleTicketIssuer mints and redeems console tickets under a ConsoleTokenPolicy.
+// Tickets are signed with a key derived from the JWT secret, so access tokens are
+// never accepted as tickets and tickets are never accepted as access tokens.
+type ConsoleTicketIssuer struct {
+	policy security.ConsoleTokenPolicy
+	key    []byte
+	used   *ReplayCache
+}
+
+// NewConsoleTicketIssuer creates an issuer signing with a key derived from secret.
+func NewConsoleTicketIssuer(secret string, policy security.ConsoleTokenPolicy) *ConsoleTicketIssuer {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("limen-console-ticket"))
+	return &ConsoleTicketIssuer{
+		policy: policy,
+		key:    mac.Sum(nil),
+		used:   NewReplayCache(),
+	}
+}
+
+// Policy returns the policy tickets are issued under.
+func (i *ConsoleTicketIssuer) Policy() security.ConsoleTokenPolicy {
+	return i.policy
+}
+
+// Issue mints a ticket for user to open the console of vmUUID from clientIP.
+func (i *ConsoleTicketIssuer) Issue(user Claims, vmUUID, clientIP string) (string, time.Time, error) {
+	return i.issue(user, vmUUID, clientIP, "")
+}
+
+// IssueShared mints a ticket for user to join a shared console session through shareID.
+func (i *ConsoleTicketIssuer) IssueShared(user Claims, vmUUID, clientIP, shareID string) (string, time.Time, error) {
+	return i.issue(user, vmUUID, clientIP, shareID)
+}
+
+func (i *ConsoleTicketIssuer) issue(user Claims, vmUUID, clientIP, shareID string) (string, time.Time, error) {
+	ticketID, err := generateTokenID()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(i.policy.TTL)
+	claims := &ConsoleTicketClaims{
+		Claims: Claims{
+			UserID:     user.UserID,
+			Username:   user.Username,
+			Role:       user.Role,
+			Approved:   user.Approved,
+			BetaAccess: user.BetaAccess,
+			RegisteredClaims: jwt.RegisteredClaims{
+				ID:        ticketID,
+				ExpiresAt: jwt.NewNumericDate(expiresAt),
+				IssuedAt:  jwt.NewNumericDate(now),
+				Issuer:    i.policy.Issuer,
+				Audience:  []string{i.policy.Audience},
+			},
+		},
+		ShareID: shareID,
+	}
+	if i.policy.RequireUUIDBinding {
+		claims.Subject = vmUUID
+	}
+	if i.policy.RequireIPBinding {
+		claims.ClientIP = clientIP
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(i.key)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiresAt, nil
+}
+
+// Redeem validates a ticket for vmUUID presented from clientIP and marks it used.
+// An empty vmUUID skips the VM check; callers then use the ticket's Subject.
+// Errors are always *security.TokenError. A ticket that fails a binding check is
+// not consumed, so a leaked ticket can't be burned by a third party.
+func (i *ConsoleTicketIssuer) Redeem(token, vmUUID, clientIP string) (*ConsoleTicketClaims, error) {
+	claims, err := i.Verify(token, vmUUID, clientIP)
+	if err != nil {
+		return nil, err
+	}
+	if !i.used.Use(claims.ID, claims.ExpiresAt.Time) {
+		return nil, security.NewTokenError(security.TokenErrorReplayed, "console ticket has already been used")
+	}
+	return claims, nil
+}
+
+// Verify validates a ticket like Redeem but doesn't mark it used. It is for protocols
+// that open several connections per console (SPICE channels): the first connection
+// redeems the ticket, and later ones are accepted only while that connection is open.
+func (i *ConsoleTicketIssuer) Verify(token, vmUUID, clientIP string) (*ConsoleTicketClaims, error) {
+	if token == "" {
+		return nil, security.NewTokenError(security.TokenErrorMissing, "console ticket required")
+	}
+
+	claims := &ConsoleTicketClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		return i.key, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(i.policy.Issuer),
+		jwt.WithAudience(i.policy.Audience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, security.NewTokenError(security.TokenErrorExpired, "console ticket expired")
+		}
+		return nil, security.NewTokenError(security.TokenErrorInvalid, "invalid console ticket")
+	}
+	if claims.ID == "" {
+		return nil, security.NewTokenError(security.TokenErrorInvalid, "console ticket has no ID")
+	}
+
+	if i.policy.RequireUUIDBinding {
+		if claims.Subject == "" || (vmUUID != "" && claims.Subject != vmUUID) {
+			return nil, security.NewTokenError(security.TokenErrorUUIDMismatch, "console ticket was issued for a different VM")
+		}
+	}
+	if i.policy.RequireIPBinding && claims.ClientIP != clientIP {
+		return nil, security.NewTokenError(security.TokenErrorIPMismatch, "console ticket was issued to a different client")
+	}
+	return claims, nil
+}
+
+// ReplayCache remembers single-use token IDs until they expire.
+type ReplayCache struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+// NewReplayCache creates an empty replay cache.
+func NewReplayCache() *ReplayCache {
+	return &ReplayCache{seen: make(map[string]time.Time)}
+}
+
+// Use marks id as used until expiresAt. It returns false if id was already used.
+// Expired entries are dropped on access, since an expired token fails validation anyway.
+func (c *ReplayCache) Use(id string, expiresAt time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for seenID, exp := range c.seen {
+		if now.After(exp) {
+			delete(c.seen, seenID)
+		}
+	}
+
+	if _, ok := c.seen[id]; ok {
+		return false
+	}
+	c.seen[id] = expiresAt
+	return true
+}
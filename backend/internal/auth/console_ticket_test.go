@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DARC0625/LIMEN/backend/internal/security"
+)
+
+const testVMUUID = "12345678-1234-1234-1234-123456789abc"
+
+func redeemCode(t *testing.T, err error) security.TokenErrorCode {
+	t.Helper()
+	var tokErr *security.TokenError
+	if !errors.As(err, &tokErr) {
+		t.Fatalf("expected *security.TokenError, got %T (%v)", err, err)
+	}
+	return tokErr.Code
+}
+
+func TestConsoleTicket_IssueAndRedeem(t *testing.T) {
+	issuer := NewConsoleTicketIssuer("test-secret", security.DefaultConsoleTokenPolicy())
+
+	ticket, expiresAt, err := issuer.Issue(Claims{UserID: 7, Username: "alice", Role: "user", Approved: true}, testVMUUID, "10.0.0.1")
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	if time.Until(expiresAt) > 5*time.Minute {
+		t.Errorf("expires_at %v exceeds policy TTL", expiresAt)
+	}
+
+	claims, err := issuer.Redeem(ticket, testVMUUID, "10.0.0.1")
+	if err != nil {
+		t.Fatalf("Redeem() error = %v", err)
+	}
+	if claims.UserID != 7 || claims.Username != "alice" || !claims.Approved {
+		t.Errorf("unexpected claims %+v", claims.Claims)
+	}
+	if claims.Subject != testVMUUID {
+		t.Errorf("Subject = %q, want %q", claims.Subject, testVMUUID)
+	}
+
+	// Single use
+	if _, err := issuer.Redeem(ticket, testVMUUID, "10.0.0.1"); redeemCode(t, err) != security.TokenErrorReplayed {
+		t.Errorf("second Redeem() = %v, want TOKEN_REPLAYED", err)
+	}
+}
+
+func TestConsoleTicket_EmptyUUIDUsesSubject(t *testing.T) {
+	issuer := NewConsoleTicketIssuer("test-secret", security.DefaultConsoleTokenPolicy())
+	ticket, _, _ := issuer.Issue(Claims{UserID: 1}, testVMUUID, "10.0.0.1")
+
+	claims, err := issuer.Redeem(ticket, "", "10.0.0.1")
+	if err != nil {
+		t.Fatalf("Redeem() error = %v", err)
+	}
+	if claims.Subject != testVMUUID {
+		t.Errorf("Subject = %q, want %q", claims.Subject, testVMUUID)
+	}
+}
+
+func TestConsoleTicket_IssueShared(t *testing.T) {
+	issuer := NewConsoleTicketIssuer("test-secret", security.DefaultConsoleTokenPolicy())
+	ticket, _, _ := issuer.IssueShared(Claims{UserID: 2}, testVMUUID, "10.0.0.1", "share-1")
+
+	claims, err := issuer.Redeem(ticket, testVMUUID, "10.0.0.1")
+	if err != nil {
+		t.Fatalf("Redeem() error = %v", err)
+	}
+	if claims.ShareID != "share-1" {
+		t.Errorf("ShareID = %q, want share-1", claims.ShareID)
+	}
+}
+
+func TestConsoleTicket_VerifyDoesNotConsume(t *testing.T) {
+	issuer := NewConsoleTicketIssuer("test-secret", security.DefaultConsoleTokenPolicy())
+	ticket, _, _ := issuer.Issue(Claims{UserID: 3}, testVMUUID, "10.0.0.1")
+
+	if _, err := issuer.Redeem(ticket, testVMUUID, "10.0.0.1"); err != nil {
+		t.Fatalf("Redeem() error = %v", err)
+	}
+	claims, err := issuer.Verify(ticket, testVMUUID, "10.0.0.1")
+	if err != nil || claims.UserID != 3 {
+		t.Fatalf("Verify() of a redeemed ticket = %v, %v", claims, err)
+	}
+	if _, err := issuer.Verify(ticket, testVMUUID, "10.0.0.2"); redeemCode(t, err) != security.TokenErrorIPMismatch {
+		t.Errorf("Verify() from another client = %v, want IP mismatch", err)
+	}
+}
+
+func TestConsoleTicket_Rejections(t *testing.T) {
+	policy := security.DefaultConsoleTokenPolicy()
+	issuer := NewConsoleTicketIssuer("test-secret", policy)
+
+	accessToken, err := GenerateAccessToken(1, "alice", "user", true, "test-secret")
+	if err != nil {
+		t.Fatalf("GenerateAccessToken() error = %v", err)
+	}
+
+	expiredPolicy := policy
+	expiredPolicy.TTL = -time.Minute
+	expired, _, _ := NewConsoleTicketIssuer("test-secret", expiredPolicy).Issue(Claims{UserID: 1}, testVMUUID, "10.0.0.1")
+
+	otherKey, _, _ := NewConsoleTicketIssuer("other-secret", policy).Issue(Claims{UserID: 1}, testVMUUID, "10.0.0.1")
+
+	tests := []struct {
+		name     string
+		token    func() string
+		vmUUID   string
+		clientIP string
+		want     security.TokenErrorCode
+	}{
+		{"missing", func() string { return "" }, testVMUUID, "10.0.0.1", security.TokenErrorMissing},
+		{"garbage", func() string { return "not-a-jwt" }, testVMUUID, "10.0.0.1", security.TokenErrorInvalid},
+		{"access token", func() string { return accessToken }, testVMUUID, "10.0.0.1", security.TokenErrorInvalid},
+		{"other key", func() string { return otherKey }, testVMUUID, "10.0.0.1", security.TokenErrorInvalid},
+		{"expired", func() string { return expired }, testVMUUID, "10.0.0.1", security.TokenErrorExpired},
+		{"wrong vm", func() string {
+			tok, _, _ := issuer.Issue(Claims{UserID: 1}, testVMUUID, "10.0.0.1")
+			return tok
+		}, "87654321-4321-4321-4321-cba987654321", "10.0.0.1", security.TokenErrorUUIDMismatch},
+		{"wrong ip", func() string {
+			tok, _, _ := issuer.Issue(Claims{UserID: 1}, testVMUUID, "10.0.0.1")
+			return tok
+		}, testVMUUID, "10.0.0.2", security.TokenErrorIPMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := issuer.Redeem(tt.token(), tt.vmUUID, tt.clientIP)
+			if got := redeemCode(t, err); got != tt.want {
+				t.Errorf("Redeem() code = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConsoleTicket_MismatchDoesNotConsume(t *testing.T) {
+	issuer := NewConsoleTicketIssuer("test-secret", security.DefaultConsoleTokenPolicy())
+	ticket, _, _ := issuer.Issue(Claims{UserID: 1}, testVMUUID, "10.0.0.1")
+
+	if _, err := issuer.Redeem(ticket, testVMUUID, "10.0.0.9"); redeemCode(t, err) != security.TokenErrorIPMismatch {
+		t.Fatalf("Redeem() from other IP = %v, want IP_MISMATCH", err)
+	}
+	if _, err := issuer.Redeem(ticket, testVMUUID, "10.0.0.1"); err != nil {
+		t.Errorf("Redeem() from bound IP after mismatch error = %v", err)
+	}
+}
+
+func TestReplayCache_ExpiredEntriesDropped(t *testing.T) {
+	c := NewReplayCache()
+	if !c.Use("a", time.Now().Add(-time.Second)) {
+		t.Fatal("first Use() should succeed")
+	}
+	if !c.Use("b", time.Now().Add(time.Minute)) {
+		t.Fatal("Use() of a new ID should succeed")
+	}
+	if _, ok := c.seen["a"]; ok {
+		t.Error("expired entry was not dropped")
+	}
+	if c.Use("b", time.Now().Add(time.Minute)) {
+		t.Error("reused ID should be rejected")
+	}
+}
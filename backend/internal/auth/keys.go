@@ -0,0 +1,202 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/DARC0625/LIMEN/backend/internal/config"
+	"github.com/DARC0625/LIMEN/backend/internal/crypto"
+	"github.com/DARC0625/LIMEN/backend/internal/logger"
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+)
+
+// ErrNoSigningKey is returned when a key set has no key to sign tokens with.
+var ErrNoSigningKey = errors.New("no JWT signing key configured")
+
+// KeySet signs and verifies LIMEN's JWTs.
+//
+// With an Ed25519 key, tokens are signed with EdDSA and carry the key's ID in their
+// "kid" header. Any key of the set verifies them, so keys rotate without logging users
+// out: publish the new public key (JWT_ED25519_PUBLIC_KEYS), switch the private key,
+// and drop the old public key once the tokens it signed have expired (7 days). Other
+// services verify the tokens with the keys published by JWKS.
+//
+// Without an Ed25519 key, tokens are signed with HS256 and the JWT secret (legacy).
+// HS256 tokens are also accepted alongside Ed25519 while the switch is in progress.
+type KeySet struct {
+	signingKID string
+	signing    ed25519.PrivateKey
+	verify     map[string]ed25519.PublicKey
+	kids       []string // verify's keys in configuration order, signing key first
+	secret     []byte   // HS256 secret; nil = HS256 tokens are rejected
+}
+
+// NewKeySet creates a key set signing with privateKey (nil = HS256 with secret) and
+// verifying with privateKey's public key and publicKeys. An empty secret rejects HS256
+// tokens.
+func NewKeySet(privateKey ed25519.PrivateKey, publicKeys []ed25519.PublicKey, secret string) *KeySet {
+	k := &KeySet{verify: make(map[string]ed25519.PublicKey)}
+	if privateKey != nil {
+		k.signing = privateKey
+		k.signingKID = k.add(privateKey.Public().(ed25519.PublicKey))
+	}
+	for _, publicKey := range publicKeys {
+		k.add(publicKey)
+	}
+	if secret != "" {
+		k.secret = []byte(secret)
+	}
+	return k
+}
+
+// NewHMACKeySet creates a key set signing and verifying HS256 tokens with secret, even
+// an empty one.
+func NewHMACKeySet(secret string) *KeySet {
+	return &KeySet{verify: make(map[string]ed25519.PublicKey), secret: []byte(secret)}
+}
+
+func (k *KeySet) add(publicKey ed25519.PublicKey) string {
+	kid := KeyID(publicKey)
+	if _, ok := k.verify[kid]; !ok {
+		k.verify[kid] = publicKey
+		k.kids = append(k.kids, kid)
+	}
+	return kid
+}
+
+// KeyID returns the ID of publicKey: its RFC 7638 JWK thumbprint.
+func KeyID(publicKey ed25519.PublicKey) string {
+	// Required members in lexicographic order, no whitespace
+	jwk := `{"crv":"Ed25519","kty":"OKP","x":"` + base64.RawURLEncoding.EncodeToString(publicKey) + `"}`
+	sum := sha256.Sum256([]byte(jwk))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// LoadKeySet creates the key set configured by cfg: an Ed25519 private key or a JWT
+// secret is required. HS256 tokens are accepted while cfg.JWTAcceptHMAC is set, or when
+// no Ed25519 key is configured.
+func LoadKeySet(cfg *config.Config) (*KeySet, error) {
+	var privateKey ed25519.PrivateKey
+	if cfg.JWTEd25519PrivateKey != "" {
+		key, err := crypto.DecodePrivateKey(cfg.JWTEd25519PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("JWT_ED25519_PRIVATE_KEY: %w", err)
+		}
+		privateKey = key
+	}
+	publicKeys := make([]ed25519.PublicKey, 0, len(cfg.JWTEd25519PublicKeys))
+	for i, encoded := range cfg.JWTEd25519PublicKeys {
+		key, err := crypto.DecodePublicKey(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("JWT_ED25519_PUBLIC_KEYS[%d]: %w", i, err)
+		}
+		publicKeys = append(publicKeys, key)
+	}
+
+	if privateKey == nil && cfg.JWTSecret == "" {
+		return nil, ErrNoSigningKey
+	}
+	secret := cfg.JWTSecret
+	if privateKey != nil && !cfg.JWTAcceptHMAC {
+		secret = ""
+	}
+	return NewKeySet(privateKey, publicKeys, secret), nil
+}
+
+var keySets sync.Map // key set configuration -> *KeySet
+
+// KeysFor returns the key set configured by cfg, loading it on first use. Missing or
+// invalid keys are logged and yield a key set that rejects every token.
+func KeysFor(cfg *config.Config) *KeySet {
+	id := strings.Join(append([]string{cfg.JWTEd25519PrivateKey, cfg.JWTSecret, fmt.Sprint(cfg.JWTAcceptHMAC)}, cfg.JWTEd25519PublicKeys...), "\x00")
+	if k, ok := keySets.Load(id); ok {
+		return k.(*KeySet)
+	}
+	k, err := LoadKeySet(cfg)
+	if err != nil {
+		logger.Log.Error("Invalid JWT key configuration, all tokens will be rejected", zap.Error(err))
+		k = NewKeySet(nil, nil, "")
+	}
+	actual, _ := keySets.LoadOrStore(id, k)
+	return actual.(*KeySet)
+}
+
+// Asymmetric reports whether tokens are signed with Ed25519.
+func (k *KeySet) Asymmetric() bool {
+	return k.signing != nil
+}
+
+// Sign signs claims with the signing key.
+func (k *KeySet) Sign(claims jwt.Claims) (string, error) {
+	switch {
+	case k.signing != nil:
+		token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+		token.Header["kid"] = k.signingKID
+		return token.SignedString(k.signing)
+	case k.secret != nil:
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(k.secret)
+	default:
+		return "", ErrNoSigningKey
+	}
+}
+
+// Parse verifies tokenString and decodes its claims into claims. Errors are those of
+// jwt.ParseWithClaims.
+func (k *KeySet) Parse(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenString, claims, k.key,
+		jwt.WithValidMethods([]string{jwt.SigningMethodEdDSA.Alg(), jwt.SigningMethodHS256.Alg()}))
+}
+
+// key returns the key verifying token.
+func (k *KeySet) key(token *jwt.Token) (interface{}, error) {
+	if token.Method == jwt.SigningMethodEdDSA {
+		kid, _ := token.Header["kid"].(string)
+		publicKey, ok := k.verify[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key ID %q", kid)
+		}
+		return publicKey, nil
+	}
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok && k.secret != nil {
+		return k.secret, nil
+	}
+	return nil, errors.New("unexpected signing method")
+}
+
+// JWK is a public key in JSON Web Key form (RFC 8037).
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+}
+
+// JWKS is a JSON Web Key Set.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys verifying tokens, signing key first. HS256 secrets are
+// never published.
+func (k *KeySet) JWKS() JWKS {
+	set := JWKS{Keys: make([]JWK, 0, len(k.kids))}
+	for _, kid := range k.kids {
+		set.Keys = append(set.Keys, JWK{
+			KeyType:   "OKP",
+			Curve:     "Ed25519",
+			X:         base64.RawURLEncoding.EncodeToString(k.verify[kid]),
+			KeyID:     kid,
+			Use:       "sig",
+			Algorithm: jwt.SigningMethodEdDSA.Alg(),
+		})
+	}
+	return set
+}
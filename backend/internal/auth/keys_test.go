@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DARC0625/LIMEN/backend/internal/config"
+	"github.com/DARC0625/LIMEN/backend/internal/crypto"
+)
+
+func TestKeySet_RotatesEd25519Keys(t *testing.T) {
+	oldKey, _ := crypto.GenerateEd25519KeyPair()
+	newKey, _ := crypto.GenerateEd25519KeyPair()
+
+	before := NewKeySet(oldKey.PrivateKey, nil, "")
+	token, err := before.GenerateAccessToken(7, "alice", "user", true)
+	if err != nil {
+		t.Fatalf("GenerateAccessToken() error = %v", err)
+	}
+
+	// New signing key, old key still verifying
+	after, err := LoadKeySet(&config.Config{
+		JWTEd25519PrivateKey: newKey.EncodePrivateKey(),
+		JWTEd25519PublicKeys: []string{oldKey.EncodePublicKey()},
+	})
+	if err != nil {
+		t.Fatalf("LoadKeySet() error = %v", err)
+	}
+	if claims, err := after.ValidateToken(token); err != nil || claims.UserID != 7 {
+		t.Errorf("ValidateToken(old key's token) = %+v, %v; want user 7", claims, err)
+	}
+	refresh, _, err := after.GenerateRefreshToken(7, "alice", "user", true)
+	if err != nil {
+		t.Fatalf("GenerateRefreshToken() error = %v", err)
+	}
+	if _, err := before.ValidateRefreshToken(refresh); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("ValidateRefreshToken(unknown key's token) error = %v, want ErrInvalidRefreshToken", err)
+	}
+
+	jwks := after.JWKS()
+	if len(jwks.Keys) != 2 || jwks.Keys[0].KeyID != KeyID(newKey.PublicKey) || jwks.Keys[1].KeyID != KeyID(oldKey.PublicKey) {
+		t.Fatalf("JWKS() = %+v, want the new then the old key", jwks)
+	}
+	if k := jwks.Keys[0]; k.KeyType != "OKP" || k.Curve != "Ed25519" || k.Algorithm != "EdDSA" || k.X == "" {
+		t.Errorf("JWK = %+v", k)
+	}
+}
+
+func TestKeySet_HMAC(t *testing.T) {
+	key, _ := crypto.GenerateEd25519KeyPair()
+	legacy, _ := GenerateAccessToken(1, "admin", "admin", true, "test-secret")
+
+	cfg := &config.Config{JWTSecret: "test-secret", JWTEd25519PrivateKey: key.EncodePrivateKey()}
+	keys, _ := LoadKeySet(cfg)
+	if _, err := keys.ValidateToken(legacy); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("ValidateToken(HMAC token) error = %v, want ErrInvalidToken", err)
+	}
+	cfg.JWTAcceptHMAC = true
+	keys, _ = LoadKeySet(cfg)
+	if _, err := keys.ValidateToken(legacy); err != nil {
+		t.Errorf("ValidateToken(HMAC token) with JWTAcceptHMAC error = %v", err)
+	}
+
+	// The secret never verifies tokens claiming to be signed otherwise
+	signed, _ := keys.GenerateAccessToken(1, "admin", "admin", true)
+	if _, err := ValidateToken(signed, "test-secret"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("ValidateToken(EdDSA token, secret) error = %v, want ErrInvalidToken", err)
+	}
+	if jwks := NewHMACKeySet("test-secret").JWKS(); len(jwks.Keys) != 0 {
+		t.Errorf("JWKS() of an HMAC key set = %+v, want no keys", jwks)
+	}
+}
+
+func TestLoadKeySet_InvalidKey(t *testing.T) {
+	if _, err := LoadKeySet(&config.Config{JWTEd25519PrivateKey: "bm90IGEga2V5"}); err == nil {
+		t.Error("LoadKeySet() with an invalid private key succeeded")
+	}
+	if _, err := LoadKeySet(&config.Config{JWTSecret: "test-secret", JWTEd25519PublicKeys: []string{"!"}}); err == nil {
+		t.Error("LoadKeySet() with an invalid public key succeeded")
+	}
+	if _, err := LoadKeySet(&config.Config{}); !errors.Is(err, ErrNoSigningKey) {
+		t.Errorf("LoadKeySet() without keys error = %v, want ErrNoSigningKey", err)
+	}
+}
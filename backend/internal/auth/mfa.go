@@ -0,0 +1,481 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/DARC0625/LIMEN/backend/internal/crypto"
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrMFANotEnrolled    = errors.New("MFA is not enrolled")
+	ErrMFAAlreadyEnabled = errors.New("MFA is already enabled")
+	ErrInvalidMFACode    = errors.New("invalid MFA code")
+	ErrInvalidMFAToken   = errors.New("invalid or expired MFA token")
+	// ErrMFAEnrollmentDisabled is returned by Enroll when TOTP secrets can't be stored as
+	// configured.
+	ErrMFAEnrollmentDisabled = errors.New("MFA enrollment is disabled")
+)
+
+const (
+	// RecoveryCodeCount is how many recovery codes an enrollment generates.
+	RecoveryCodeCount = 10
+	// MFAChallengeTTL is how long a user has to enter their code after their password.
+	MFAChallengeTTL = 5 * time.Minute
+
+	// Second factors a login can be completed with
+	MFAMethodTOTP     = "totp"
+	MFAMethodWebAuthn = "webauthn"
+
+	recoveryCodeAlphabet  = "abcdefghjkmnpqrstuvwxyz23456789" // No 0/o, 1/l/i
+	encryptedSecretPrefix = "enc:"
+)
+
+// MFAStatus is a user's MFA state.
+type MFAStatus struct {
+	Enabled           bool       `json:"enabled"`
+	Required          bool       `json:"required"` // Required for the user's role
+	EnabledAt         *time.Time `json:"enabled_at,omitempty"`
+	RecoveryCodesLeft int        `json:"recovery_codes_left"`
+	// Passkeys and security keys, which also complete logins as a second factor
+	WebAuthnCredentials int `json:"webauthn_credentials"`
+}
+
+// MFAChallengeClaims are the claims of an MFA challenge: the proof that a user passed
+// the password step of a login, exchanged for tokens with a TOTP or recovery code.
+type MFAChallengeClaims struct {
+	UserID uint `json:"uid"`
+	Enroll bool `json:"enr,omitempty"` // The user must enroll before completing the login
+	jwt.RegisteredClaims
+}
+
+// MFAManager manages TOTP enrollment, verification and recovery codes (models.UserMFA,
+// models.MFARecoveryCode) and which roles must use MFA (models.MFARolePolicy).
+//
+// Challenges are signed with a key derived from the JWT secret, like console tickets,
+// so they are never accepted as access tokens.
+type MFAManager struct {
+	db           *gorm.DB
+	issuer       string
+	challengeKey []byte
+	secretKey    []byte // nil = TOTP secrets are stored unencrypted
+	noEnroll     bool
+	now          func() time.Time
+}
+
+// NewMFAManager creates an MFA manager. issuer names the service in authenticator apps,
+// challenges are signed with a key derived from secret, and TOTP secrets are encrypted
+// at rest with secretKey (32 bytes) unless it is nil.
+func NewMFAManager(db *gorm.DB, issuer, secret string, secretKey []byte) *MFAManager {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("limen-mfa-challenge"))
+	return &MFAManager{
+		db:           db,
+		issuer:       issuer,
+		challengeKey: mac.Sum(nil),
+		secretKey:    secretKey,
+		now:          time.Now,
+	}
+}
+
+// DisableEnrollment makes Enroll refuse new TOTP secrets, e.g. because the key they
+// should be encrypted with is unusable. Existing enrollments keep working.
+func (m *MFAManager) DisableEnrollment() {
+	m.noEnroll = true
+}
+
+// RoleRequired reports whether users of role must use MFA.
+func (m *MFAManager) RoleRequired(role string) bool {
+	var policy models.MFARolePolicy
+	if err := m.db.Where("role = ?", role).Limit(1).Find(&policy).Error; err != nil {
+		return false
+	}
+	return policy.Required
+}
+
+// RolePolicies returns the MFA policy of each of roles, including roles without one.
+func (m *MFAManager) RolePolicies(roles []string) ([]models.MFARolePolicy, error) {
+	var stored []models.MFARolePolicy
+	if err := m.db.Find(&stored).Error; err != nil {
+		return nil, err
+	}
+	byRole := make(map[string]models.MFARolePolicy, len(stored))
+	for _, p := range stored {
+		byRole[p.Role] = p
+	}
+	policies := make([]models.MFARolePolicy, 0, len(roles))
+	for _, role := range roles {
+		policy, ok := byRole[role]
+		if !ok {
+			policy = models.MFARolePolicy{Role: role}
+		}
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
+
+// SetRoleRequired sets whether users of role must use MFA.
+func (m *MFAManager) SetRoleRequired(role string, required bool) (*models.MFARolePolicy, error) {
+	policy := &models.MFARolePolicy{Role: role, Required: required, UpdatedAt: m.now()}
+	err := m.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "role"}},
+		DoUpdates: clause.AssignmentColumns([]string{"required", "updated_at"}),
+	}).Create(policy).Error
+	return policy, err
+}
+
+// Enabled reports whether a user has an enabled authenticator.
+func (m *MFAManager) Enabled(userID uint) bool {
+	var count int64
+	m.db.Model(&models.UserMFA{}).Where("user_id = ? AND enabled = ?", userID, true).Count(&count)
+	return count > 0
+}
+
+// LoginMethods returns the second factors a user of role can complete a login with
+// (MFAMethodTOTP, MFAMethodWebAuthn) and whether their role requires one. Unlike
+// Enabled and RoleRequired it returns database errors, so logins don't skip MFA when
+// the database fails.
+func (m *MFAManager) LoginMethods(userID uint, role string) (methods []string, required bool, err error) {
+	var totp, webauthn int64
+	if err := m.db.Model(&models.UserMFA{}).Where("user_id = ? AND enabled = ?", userID, true).Count(&totp).Error; err != nil {
+		return nil, false, err
+	}
+	if err := m.db.Model(&models.WebAuthnCredential{}).Where("user_id = ?", userID).Count(&webauthn).Error; err != nil {
+		return nil, false, err
+	}
+	var policy models.MFARolePolicy
+	if err := m.db.Where("role = ?", role).Limit(1).Find(&policy).Error; err != nil {
+		return nil, false, err
+	}
+	if totp > 0 {
+		methods = append(methods, MFAMethodTOTP)
+	}
+	if webauthn > 0 {
+		methods = append(methods, MFAMethodWebAuthn)
+	}
+	return methods, policy.Required, nil
+}
+
+// Status returns the MFA state of a user of role.
+func (m *MFAManager) Status(userID uint, role string) (*MFAStatus, error) {
+	status := &MFAStatus{Required: m.RoleRequired(role)}
+	var credentials int64
+	if err := m.db.Model(&models.WebAuthnCredential{}).Where("user_id = ?", userID).Count(&credentials).Error; err != nil {
+		return nil, err
+	}
+	status.WebAuthnCredentials = int(credentials)
+	var mfa models.UserMFA
+	if err := m.db.Where("user_id = ? AND enabled = ?", userID, true).Limit(1).Find(&mfa).Error; err != nil {
+		return nil, err
+	}
+	if mfa.UserID == 0 {
+		return status, nil
+	}
+	var left int64
+	if err := m.db.Model(&models.MFARecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&left).Error; err != nil {
+		return nil, err
+	}
+	status.Enabled = true
+	status.EnabledAt = mfa.EnabledAt
+	status.RecoveryCodesLeft = int(left)
+	return status, nil
+}
+
+// Enroll generates a new TOTP secret for a user, replacing any pending one, and returns
+// it with its provisioning URI labelled with account. The user's codes are checked
+// against it only once Activate confirmed it.
+func (m *MFAManager) Enroll(userID uint, account string) (string, string, error) {
+	if m.noEnroll {
+		return "", "", ErrMFAEnrollmentDisabled
+	}
+	if m.Enabled(userID) {
+		return "", "", ErrMFAAlreadyEnabled
+	}
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		return "", "", err
+	}
+	stored, err := m.sealSecret(secret)
+	if err != nil {
+		return "", "", err
+	}
+	now := m.now()
+	mfa := &models.UserMFA{UserID: userID, Secret: stored, CreatedAt: now, UpdatedAt: now}
+	err = m.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"secret", "last_used_step", "created_at", "updated_at"}),
+	}).Create(mfa).Error
+	if err != nil {
+		return "", "", err
+	}
+	return secret, TOTPProvisioningURI(m.issuer, account, secret), nil
+}
+
+// Activate enables a pending enrollment once code proves the user's authenticator has
+// its secret, and returns the user's recovery codes. They are only ever shown here.
+func (m *MFAManager) Activate(userID uint, code string) ([]string, error) {
+	var mfa models.UserMFA
+	if err := m.db.Where("user_id = ?", userID).Limit(1).Find(&mfa).Error; err != nil {
+		return nil, err
+	}
+	switch {
+	case mfa.UserID == 0:
+		return nil, ErrMFANotEnrolled
+	case mfa.Enabled:
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if err := m.verify(&mfa, code); err != nil {
+		return nil, err
+	}
+
+	now := m.now()
+	var codes []string
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.UserMFA{}).Where("user_id = ? AND enabled = ?", userID, false).
+			Updates(map[string]interface{}{"enabled": true, "enabled_at": now})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrMFAAlreadyEnabled
+		}
+		var err error
+		codes, err = replaceRecoveryCodes(tx, userID, now)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Verify checks a TOTP code of a user with MFA enabled. Each code is accepted once.
+func (m *MFAManager) Verify(userID uint, code string) error {
+	var mfa models.UserMFA
+	if err := m.db.Where("user_id = ? AND enabled = ?", userID, true).Limit(1).Find(&mfa).Error; err != nil {
+		return err
+	}
+	if mfa.UserID == 0 {
+		return ErrMFANotEnrolled
+	}
+	return m.verify(&mfa, code)
+}
+
+// verify checks code against mfa's secret and records its step as used.
+func (m *MFAManager) verify(mfa *models.UserMFA, code string) error {
+	secret, err := m.openSecret(mfa.Secret)
+	if err != nil {
+		return err
+	}
+	step, ok := ValidateTOTP(secret, code, m.now(), mfa.LastUsedStep)
+	if !ok {
+		return ErrInvalidMFACode
+	}
+	// Conditional on the step, so concurrent requests can't both use the code
+	result := m.db.Model(&models.UserMFA{}).
+		Where("user_id = ? AND last_used_step < ?", mfa.UserID, step).
+		Update("last_used_step", step)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidMFACode
+	}
+	mfa.LastUsedStep = step
+	return nil
+}
+
+// VerifyRecoveryCode checks a recovery code of a user with MFA enabled and uses it up.
+func (m *MFAManager) VerifyRecoveryCode(userID uint, code string) error {
+	if !m.Enabled(userID) {
+		return ErrMFANotEnrolled
+	}
+	code = normalizeRecoveryCode(code)
+	if code == "" {
+		return ErrInvalidMFACode
+	}
+	var unused []models.MFARecoveryCode
+	if err := m.db.Where("user_id = ? AND used_at IS NULL", userID).Find(&unused).Error; err != nil {
+		return err
+	}
+	for _, rc := range unused {
+		if !crypto.CheckPassword(code, rc.Hash) {
+			continue
+		}
+		result := m.db.Model(&models.MFARecoveryCode{}).
+			Where("id = ? AND used_at IS NULL", rc.ID).
+			Update("used_at", m.now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			break // Used concurrently
+		}
+		return nil
+	}
+	return ErrInvalidMFACode
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of a user with MFA enabled.
+func (m *MFAManager) RegenerateRecoveryCodes(userID uint) ([]string, error) {
+	if !m.Enabled(userID) {
+		return nil, ErrMFANotEnrolled
+	}
+	var codes []string
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = replaceRecoveryCodes(tx, userID, m.now())
+		return err
+	})
+	return codes, err
+}
+
+// Disable removes a user's authenticator and recovery codes. It reports whether MFA was
+// enabled.
+func (m *MFAManager) Disable(userID uint) (bool, error) {
+	enabled := m.Enabled(userID)
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&models.UserMFA{}).Error
+	})
+	return enabled, err
+}
+
+// IssueChallenge mints the challenge completing the login of a user whose password was
+// checked. enroll means the user must enroll first, as their role requires MFA.
+func (m *MFAManager) IssueChallenge(userID uint, enroll bool) (string, time.Time, error) {
+	challengeID, err := generateTokenID()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	now := m.now()
+	expiresAt := now.Add(MFAChallengeTTL)
+	claims := &MFAChallengeClaims{
+		UserID: userID,
+		Enroll: enroll,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        challengeID,
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+			Audience:  []string{"limen-mfa"},
+		},
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(m.challengeKey)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiresAt, nil
+}
+
+// ParseChallenge validates a challenge minted by IssueChallenge.
+func (m *MFAManager) ParseChallenge(token string) (*MFAChallengeClaims, error) {
+	claims := &MFAChallengeClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		return m.challengeKey, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithAudience("limen-mfa"),
+		jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(m.now),
+	)
+	if err != nil || claims.UserID == 0 {
+		return nil, ErrInvalidMFAToken
+	}
+	return claims, nil
+}
+
+func (m *MFAManager) sealSecret(secret string) (string, error) {
+	if m.secretKey == nil {
+		return secret, nil
+	}
+	sealed, err := crypto.AES256GCMEncrypt([]byte(secret), m.secretKey)
+	if err != nil {
+		return "", err
+	}
+	return encryptedSecretPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (m *MFAManager) openSecret(stored string) (string, error) {
+	if !strings.HasPrefix(stored, encryptedSecretPrefix) {
+		return stored, nil
+	}
+	if m.secretKey == nil {
+		return "", errors.New("TOTP secret is encrypted but no MFA encryption key is configured")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, encryptedSecretPrefix))
+	if err != nil {
+		return "", err
+	}
+	secret, err := crypto.AES256GCMDecrypt(sealed, m.secretKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt TOTP secret: %w", err)
+	}
+	return string(secret), nil
+}
+
+// replaceRecoveryCodes deletes the recovery codes of a user and generates new ones.
+func replaceRecoveryCodes(tx *gorm.DB, userID uint, now time.Time) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	codes := make([]string, RecoveryCodeCount)
+	rows := make([]models.MFARecoveryCode, RecoveryCodeCount)
+	for i := range codes {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		hash, err := crypto.HashPassword(normalizeRecoveryCode(code))
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+		rows[i] = models.MFARecoveryCode{UserID: userID, Hash: hash, CreatedAt: now}
+	}
+	if err := tx.Create(&rows).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// generateRecoveryCode returns a random code like "k7m2p-x9qrt" (about 49 bits).
+func generateRecoveryCode() (string, error) {
+	// Random bytes past the last multiple of the alphabet size are skipped so every
+	// character is equally likely
+	limit := byte(256 / len(recoveryCodeAlphabet) * len(recoveryCodeAlphabet))
+	code := make([]byte, 0, 10)
+	buf := make([]byte, 16)
+	for len(code) < 10 {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		for _, c := range buf {
+			if c < limit && len(code) < 10 {
+				code = append(code, recoveryCodeAlphabet[int(c)%len(recoveryCodeAlphabet)])
+			}
+		}
+	}
+	return string(code[:5]) + "-" + string(code[5:]), nil
+}
+
+// normalizeRecoveryCode makes codes typed with other case or separators match.
+func normalizeRecoveryCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(strings.TrimSpace(code)))
+}
@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// newTestMFAManager returns an MFA manager on a test database whose clock is advanced
+// with the returned function.
+func newTestMFAManager(t *testing.T, secretKey []byte) (*MFAManager, func(time.Duration)) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.UserMFA{}, &models.MFARecoveryCode{}, &models.MFARolePolicy{}, &models.WebAuthnCredential{}); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+	m := NewMFAManager(db, "LIMEN", "test-secret", secretKey)
+	now := time.Unix(1700000000, 0)
+	m.now = func() time.Time { return now }
+	return m, func(d time.Duration) { now = now.Add(d) }
+}
+
+func currentCode(t *testing.T, m *MFAManager, secret string) string {
+	code, err := TOTPCode(secret, TOTPStep(m.now()))
+	if err != nil {
+		t.Fatalf("TOTPCode() error = %v", err)
+	}
+	return code
+}
+
+func TestMFAManager_EnrollVerifyAndRecoveryCodes(t *testing.T) {
+	m, advance := newTestMFAManager(t, make([]byte, 32))
+
+	secret, uri, err := m.Enroll(7, "alice")
+	if err != nil || !strings.Contains(uri, secret) {
+		t.Fatalf("Enroll() = %q, %q, %v", secret, uri, err)
+	}
+	var row models.UserMFA
+	m.db.First(&row, 7)
+	if row.Secret == secret || !strings.HasPrefix(row.Secret, encryptedSecretPrefix) {
+		t.Errorf("stored secret = %q, want it encrypted", row.Secret)
+	}
+	if m.Enabled(7) {
+		t.Fatal("MFA enabled before the enrollment was verified")
+	}
+	if err := m.Verify(7, currentCode(t, m, secret)); !errors.Is(err, ErrMFANotEnrolled) {
+		t.Errorf("Verify() before activation error = %v, want ErrMFANotEnrolled", err)
+	}
+
+	if _, err := m.Activate(7, "000000"); !errors.Is(err, ErrInvalidMFACode) {
+		t.Fatalf("Activate(wrong code) error = %v, want ErrInvalidMFACode", err)
+	}
+	codes, err := m.Activate(7, currentCode(t, m, secret))
+	if err != nil || len(codes) != RecoveryCodeCount {
+		t.Fatalf("Activate() = %d codes, %v; want %d", len(codes), err, RecoveryCodeCount)
+	}
+	if _, _, err := m.Enroll(7, "alice"); !errors.Is(err, ErrMFAAlreadyEnabled) {
+		t.Errorf("Enroll() when enabled error = %v, want ErrMFAAlreadyEnabled", err)
+	}
+
+	// The activation code can't be replayed, the next step's code works
+	if err := m.Verify(7, currentCode(t, m, secret)); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("Verify(replayed code) error = %v, want ErrInvalidMFACode", err)
+	}
+	advance(TOTPPeriod)
+	if err := m.Verify(7, currentCode(t, m, secret)); err != nil {
+		t.Errorf("Verify(next code) error = %v", err)
+	}
+
+	// Recovery codes work once, whatever their case and separators
+	if err := m.VerifyRecoveryCode(7, strings.ToUpper(strings.ReplaceAll(codes[0], "-", " "))); err != nil {
+		t.Errorf("VerifyRecoveryCode() error = %v", err)
+	}
+	if err := m.VerifyRecoveryCode(7, codes[0]); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("VerifyRecoveryCode(used code) error = %v, want ErrInvalidMFACode", err)
+	}
+	status, _ := m.Status(7, "user")
+	if !status.Enabled || status.RecoveryCodesLeft != RecoveryCodeCount-1 {
+		t.Errorf("Status() = %+v, want enabled with %d recovery codes", status, RecoveryCodeCount-1)
+	}
+
+	if enabled, err := m.Disable(7); err != nil || !enabled {
+		t.Errorf("Disable() = %v, %v; want true", enabled, err)
+	}
+	if m.Enabled(7) {
+		t.Error("MFA still enabled after Disable()")
+	}
+
+	m.DisableEnrollment()
+	if _, _, err := m.Enroll(7, "alice"); !errors.Is(err, ErrMFAEnrollmentDisabled) {
+		t.Errorf("Enroll() when disabled error = %v, want ErrMFAEnrollmentDisabled", err)
+	}
+}
+
+func TestMFAManager_RolePoliciesAndChallenges(t *testing.T) {
+	m, advance := newTestMFAManager(t, nil)
+
+	if _, err := m.SetRoleRequired("admin", true); err != nil {
+		t.Fatalf("SetRoleRequired() error = %v", err)
+	}
+	if _, err := m.SetRoleRequired("admin", true); err != nil {
+		t.Fatalf("SetRoleRequired() again error = %v", err)
+	}
+	methods, required, err := m.LoginMethods(7, "admin")
+	if err != nil || len(methods) != 0 || !required {
+		t.Errorf("LoginMethods(admin) = %v, %v, %v; want required", methods, required, err)
+	}
+	m.db.Create(&models.WebAuthnCredential{UserID: 7, CredentialID: "cred", PublicKey: []byte{1}})
+	if methods, _, _ := m.LoginMethods(7, "admin"); len(methods) != 1 || methods[0] != MFAMethodWebAuthn {
+		t.Errorf("LoginMethods() with a passkey = %v, want [webauthn]", methods)
+	}
+	if m.RoleRequired("user") {
+		t.Error("RoleRequired(user) = true")
+	}
+	policies, _ := m.RolePolicies([]string{"admin", "auditor", "operator", "user"})
+	// Every role asked for, in order, with or without a policy
+	if len(policies) != 4 || policies[0].Role != "admin" || !policies[0].Required || policies[3].Role != "user" || policies[3].Required {
+		t.Errorf("RolePolicies() = %+v", policies)
+	}
+
+	token, _, err := m.IssueChallenge(7, true)
+	if err != nil {
+		t.Fatalf("IssueChallenge() error = %v", err)
+	}
+	claims, err := m.ParseChallenge(token)
+	if err != nil || claims.UserID != 7 || !claims.Enroll {
+		t.Errorf("ParseChallenge() = %+v, %v", claims, err)
+	}
+	// Challenges aren't access tokens, and access tokens aren't challenges
+	if _, err := ValidateToken(token, "test-secret"); err == nil {
+		t.Error("ValidateToken accepted an MFA challenge")
+	}
+	access, _ := GenerateToken(7, "alice", "user", "test-secret", 1)
+	if _, err := m.ParseChallenge(access); err == nil {
+		t.Error("ParseChallenge accepted an access token")
+	}
+	advance(MFAChallengeTTL + time.Second)
+	if _, err := m.ParseChallenge(token); !errors.Is(err, ErrInvalidMFAToken) {
+		t.Errorf("ParseChallenge(expired) error = %v, want ErrInvalidMFAToken", err)
+	}
+}
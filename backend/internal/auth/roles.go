@@ -0,0 +1,206 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidRoleName   = errors.New("role names must be 2-20 lowercase letters, digits, '-' or '_', starting with a letter")
+	ErrInvalidPermission = errors.New("unknown permission")
+	ErrRoleExists        = errors.New("role already exists")
+	ErrBuiltInRole       = errors.New("built-in roles can't be changed")
+	ErrRoleInUse         = errors.New("role is assigned to users")
+)
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{1,19}$`)
+
+// NormalizePermissions validates permissions and returns them sorted and without
+// duplicates.
+func NormalizePermissions(perms []string) ([]models.Permission, error) {
+	seen := make(map[models.Permission]bool)
+	var out []models.Permission
+	for _, name := range perms {
+		perm := models.Permission(strings.ToLower(strings.TrimSpace(name)))
+		if !perm.IsValid() {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidPermission, name)
+		}
+		if !seen[perm] {
+			seen[perm] = true
+			out = append(out, perm)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out, nil
+}
+
+// RoleStore keeps custom roles, and resolves the permissions of every role. The
+// built-in roles (models.BuiltInRoles) aren't stored: users keep their admin or user
+// role, and the operator and auditor roles are there without a migration. A nil store
+// knows the built-in roles only.
+type RoleStore struct {
+	db *gorm.DB
+}
+
+// NewRoleStore returns a store of the custom roles in db.
+func NewRoleStore(db *gorm.DB) *RoleStore {
+	return &RoleStore{db: db}
+}
+
+// List returns the built-in roles, then the custom roles, each sorted by name.
+func (s *RoleStore) List() ([]models.Role, error) {
+	var custom []models.Role
+	if err := s.db.Order("name").Find(&custom).Error; err != nil {
+		return nil, err
+	}
+	return append(models.BuiltInRoles(), custom...), nil
+}
+
+// Get returns the role named name, or gorm.ErrRecordNotFound.
+func (s *RoleStore) Get(name string) (*models.Role, error) {
+	if perms, ok := models.BuiltInPermissions(models.UserRole(name)); ok {
+		return &models.Role{Name: name, Permissions: models.JoinPermissions(perms), BuiltIn: true}, nil
+	}
+	var role models.Role
+	if err := s.db.Where("name = ?", name).First(&role).Error; err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+// Create adds a custom role named name with perms.
+func (s *RoleStore) Create(name, description string, perms []string) (*models.Role, error) {
+	if !roleNamePattern.MatchString(name) {
+		return nil, ErrInvalidRoleName
+	}
+	normalized, err := NormalizePermissions(perms)
+	if err != nil {
+		return nil, err
+	}
+	if models.UserRole(name).IsValid() {
+		return nil, ErrRoleExists
+	}
+	var count int64
+	if err := s.db.Model(&models.Role{}).Where("name = ?", name).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrRoleExists
+	}
+	role := &models.Role{Name: name, Description: description, Permissions: models.JoinPermissions(normalized)}
+	if err := s.db.Create(role).Error; err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+// Update replaces the description and permissions of the custom role named name. Its
+// users have the new permissions on their next request.
+func (s *RoleStore) Update(name, description string, perms []string) (*models.Role, error) {
+	if models.UserRole(name).IsValid() {
+		return nil, ErrBuiltInRole
+	}
+	normalized, err := NormalizePermissions(perms)
+	if err != nil {
+		return nil, err
+	}
+	role, err := s.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	role.Description = description
+	role.Permissions = models.JoinPermissions(normalized)
+	if err := s.db.Save(role).Error; err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+// Delete removes the custom role named name, which must not be assigned to any user.
+func (s *RoleStore) Delete(name string) (*models.Role, error) {
+	if models.UserRole(name).IsValid() {
+		return nil, ErrBuiltInRole
+	}
+	role, err := s.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	var users int64
+	if err := s.db.Model(&models.User{}).Where("role = ?", name).Count(&users).Error; err != nil {
+		return nil, err
+	}
+	if users > 0 {
+		return nil, ErrRoleInUse
+	}
+	if err := s.db.Delete(role).Error; err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+// Permissions returns the permissions of the role named name, or
+// gorm.ErrRecordNotFound.
+func (s *RoleStore) Permissions(name string) ([]models.Permission, error) {
+	role, err := s.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return role.PermissionList(), nil
+}
+
+// Exists reports whether role is a built-in role or a custom one.
+func (s *RoleStore) Exists(role string) bool {
+	if models.UserRole(role).IsValid() {
+		return true
+	}
+	if s == nil {
+		return false
+	}
+	_, err := s.Get(role)
+	return err == nil
+}
+
+// HasPermission reports whether role grants perm. Admins have every permission;
+// unknown roles have none.
+func (s *RoleStore) HasPermission(role string, perm models.Permission) bool {
+	if models.UserRole(role).IsAdmin() {
+		return true
+	}
+	perms, ok := models.BuiltInPermissions(models.UserRole(role))
+	if !ok {
+		if s == nil {
+			return false
+		}
+		var err error
+		if perms, err = s.Permissions(role); err != nil {
+			return false
+		}
+	}
+	for _, p := range perms {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// Names returns the names of the built-in roles, then of the custom roles.
+func (s *RoleStore) Names() []string {
+	var names []string
+	for _, role := range models.BuiltInRoles() {
+		names = append(names, role.Name)
+	}
+	if s != nil {
+		var custom []string
+		if err := s.db.Model(&models.Role{}).Order("name").Pluck("name", &custom).Error; err == nil {
+			names = append(names, custom...)
+		}
+	}
+	return names
+}
@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestNormalizePermissions(t *testing.T) {
+	perms, err := NormalizePermissions([]string{" LOGS.read", "audit.read", "logs.read"})
+	if err != nil || len(perms) != 2 || perms[0] != models.PermAuditRead || perms[1] != models.PermLogsRead {
+		t.Errorf("NormalizePermissions() = %v, %v", perms, err)
+	}
+	if perms, err := NormalizePermissions(nil); err != nil || len(perms) != 0 {
+		t.Errorf("NormalizePermissions(nil) = %v, %v; want none", perms, err)
+	}
+	if _, err := NormalizePermissions([]string{"users.manage"}); !errors.Is(err, ErrInvalidPermission) {
+		t.Errorf("NormalizePermissions(users.manage) error = %v, want ErrInvalidPermission", err)
+	}
+}
+
+func TestRoleStore(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.Role{}); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+	store := NewRoleStore(db)
+
+	for _, name := range []string{"Support", "x", "admin", "9lives", "a-very-long-role-name-indeed"} {
+		if _, err := store.Create(name, "", nil); err == nil {
+			t.Errorf("Create(%q) succeeded", name)
+		}
+	}
+	if _, err := store.Create("support", "", []string{"system.manage"}); !errors.Is(err, ErrInvalidPermission) {
+		t.Errorf("Create() with the admins' permission error = %v", err)
+	}
+	role, err := store.Create("support", "Helpdesk", []string{"vms.read_all"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if _, err := store.Create("support", "", nil); !errors.Is(err, ErrRoleExists) {
+		t.Errorf("Create() again error = %v, want ErrRoleExists", err)
+	}
+
+	if !store.Exists("support") || !store.Exists("auditor") || store.Exists("ghost") {
+		t.Error("store.Exists() doesn't know the built-in and custom roles only")
+	}
+	if !store.HasPermission("support", models.PermVMReadAll) || store.HasPermission("support", models.PermVMControlAll) {
+		t.Error("store.HasPermission(support) doesn't match its permissions")
+	}
+	if !store.HasPermission("admin", models.PermLogsRead) || !store.HasPermission("operator", models.PermVMControlAll) ||
+		store.HasPermission("operator", models.PermAuditRead) || store.HasPermission("user", models.PermVMReadAll) ||
+		store.HasPermission("ghost", models.PermVMReadAll) {
+		t.Error("store.HasPermission() doesn't match the built-in roles")
+	}
+
+	if _, err := store.Update("operator", "", nil); !errors.Is(err, ErrBuiltInRole) {
+		t.Errorf("Update(operator) error = %v, want ErrBuiltInRole", err)
+	}
+	if _, err := store.Update("ghost", "", nil); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("Update(ghost) error = %v, want ErrRecordNotFound", err)
+	}
+	if role, err = store.Update("support", "Helpdesk", []string{"vms.control_all", "vms.read_all"}); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if !store.HasPermission("support", models.PermVMControlAll) {
+		t.Error("Update() permissions don't apply")
+	}
+
+	roles, err := store.List()
+	if err != nil || len(roles) != 5 || roles[0].Name != "admin" || !roles[0].BuiltIn || roles[4].Name != "support" || roles[4].BuiltIn {
+		t.Errorf("List() = %+v, %v; want the built-in roles then support", roles, err)
+	}
+	if names := store.Names(); len(names) != 5 || names[4] != "support" {
+		t.Errorf("Names() = %v", names)
+	}
+
+	db.Create(&models.User{Username: "bob", Password: "x", Role: "support"})
+	if _, err := store.Delete("support"); !errors.Is(err, ErrRoleInUse) {
+		t.Errorf("Delete() of an assigned role error = %v, want ErrRoleInUse", err)
+	}
+	db.Model(&models.User{}).Where("username = ?", "bob").Update("role", "user")
+	if _, err := store.Delete("support"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := store.Delete("user"); !errors.Is(err, ErrBuiltInRole) {
+		t.Errorf("Delete(user) error = %v, want ErrBuiltInRole", err)
+	}
+	if store.Exists(role.Name) || store.HasPermission(role.Name, models.PermVMReadAll) {
+		t.Error("a deleted role still exists")
+	}
+
+	var builtIn *RoleStore
+	if !builtIn.Exists("operator") || builtIn.Exists("support") || !builtIn.HasPermission("operator", models.PermVMControlAll) ||
+		len(builtIn.Names()) != 4 {
+		t.Error("a nil store doesn't know the built-in roles only")
+	}
+}
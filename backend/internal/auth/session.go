@@ -4,15 +4,35 @@ package auth
 import (
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
+	"github.com/DARC0625/LIMEN/backend/internal/database"
 	"github.com/DARC0625/LIMEN/backend/internal/logger"
 	"go.uber.org/zap"
 )
 
-// Session represents a user session.
+var (
+	// ErrRefreshTokenReused is returned when a refresh token rotated out of its session
+	// is used again: it was probably stolen, so the session is revoked.
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+	// ErrRefreshTokenRotated is returned when a refresh token was rotated moments ago, e.g.
+	// by another tab refreshing at the same time. The session is kept.
+	ErrRefreshTokenRotated = errors.New("refresh token already rotated")
+	// ErrTokenRevoked is returned when creating a session for a refresh token that was
+	// revoked or rotated.
+	ErrTokenRevoked = errors.New("refresh token revoked")
+)
+
+// RefreshReuseGrace is how long a rotated refresh token is answered with
+// ErrRefreshTokenRotated instead of being treated as reused.
+const RefreshReuseGrace = 10 * time.Second
+
+// Session represents a user session: a login and the family of refresh tokens rotated
+// from it.
 type Session struct {
 	ID           string
 	AccessToken  string // Short-lived access token (15 minutes)
@@ -23,34 +43,88 @@ type Session struct {
 	Username     string
 	Role         string
 	ExpiresAt    time.Time // Refresh token expiry
+	ClientIP     string    // Client that last used the session
+	UserAgent    string
+	CreatedAt    time.Time
+	LastUsedAt   time.Time
+	RevokedAt    *time.Time // Set when logged out or revoked; the session no longer authenticates
+}
+
+// SessionStore stores sessions. MemorySessionStore keeps them in the process (tests);
+// DBSessionStore keeps them in the database, so they survive restarts and are shared by
+// all instances.
+type SessionStore interface {
+	// CreateSession creates a session for a new refresh token family. It fails with
+	// ErrTokenRevoked if tokenID was revoked or rotated.
+	CreateSession(accessToken, refreshToken, tokenID, csrfToken string, userID uint, username, role string, expiresAt time.Time) (*Session, error)
+	// GetSession returns an active session by ID.
+	GetSession(sessionID string) (*Session, bool)
+	// GetSessionByRefreshToken returns the active session whose current refresh token is refreshToken.
+	GetSessionByRefreshToken(refreshToken string) (*Session, bool)
+	// UpdateSessionTokens updates the access token and optionally rotates the refresh token.
+	UpdateSessionTokens(sessionID, newAccessToken, newRefreshToken, newTokenID string) error
+	// RotateRefreshToken replaces the refresh token tokenID with a new one, expiring at
+	// expiresAt. If tokenID was already rotated, it fails with ErrRefreshTokenRotated
+	// within RefreshReuseGrace, and otherwise revokes its session and fails with
+	// ErrRefreshTokenReused, returning the revoked session.
+	RotateRefreshToken(tokenID, newAccessToken, newRefreshToken, newTokenID string, expiresAt time.Time) (*Session, error)
+	// ValidateCSRFToken validates a CSRF token for a session.
+	ValidateCSRFToken(sessionID, csrfToken string) bool
+	// RecordUse records that the session was used by clientIP with userAgent.
+	RecordUse(sessionID, clientIP, userAgent string)
+	// ListUserSessions returns a user's active sessions, most recently used first.
+	ListUserSessions(userID uint) ([]*Session, error)
+	// DeleteSession revokes a session (logout).
+	DeleteSession(sessionID string)
+	// RevokeUserSessions revokes all sessions of a user and returns how many were active.
+	RevokeUserSessions(userID uint) (int, error)
+	// Stop releases the store's resources.
+	Stop()
 }
 
-// SessionStore manages sessions in memory.
-// In production, consider using Redis for distributed systems.
-type SessionStore struct {
+// MemorySessionStore manages sessions in memory. Sessions are lost on restart.
+type MemorySessionStore struct {
 	sessions map[string]*Session
+	rotated  map[string]rotatedToken // Rotated refresh token ID -> its session
 	mu       sync.RWMutex
 	// Cleanup goroutine
 	stopCleanup chan struct{}
 }
 
+type rotatedToken struct {
+	sessionID string
+	at        time.Time
+}
+
 var (
-	globalSessionStore *SessionStore
+	globalSessionStore SessionStore
 	sessionStoreOnce   sync.Once
 )
 
-// GetSessionStore returns the global session store (singleton).
-func GetSessionStore() *SessionStore {
+// GetSessionStore returns the global session store (singleton): in the database once
+// it is connected, in memory otherwise.
+func GetSessionStore() SessionStore {
 	sessionStoreOnce.Do(func() {
-		globalSessionStore = NewSessionStore()
+		if database.DB != nil {
+			globalSessionStore = NewDBSessionStore(database.DB)
+		} else {
+			globalSessionStore = NewSessionStore()
+		}
 	})
 	return globalSessionStore
 }
 
-// NewSessionStore creates a new session store.
-func NewSessionStore() *SessionStore {
-	store := &SessionStore{
+// SetSessionStore replaces the global session store, e.g. with one on a test database.
+func SetSessionStore(store SessionStore) {
+	sessionStoreOnce.Do(func() {})
+	globalSessionStore = store
+}
+
+// NewSessionStore creates a new in-memory session store.
+func NewSessionStore() *MemorySessionStore {
+	store := &MemorySessionStore{
 		sessions:    make(map[string]*Session),
+		rotated:     make(map[string]rotatedToken),
 		stopCleanup: make(chan struct{}),
 	}
 	// No periodic cleanup - cleanup happens on-demand when sessions are accessed
@@ -67,12 +141,13 @@ func GenerateSessionID() (string, error) {
 }
 
 // CreateSession creates a new session with access token, refresh token, and CSRF token.
-func (s *SessionStore) CreateSession(accessToken, refreshToken, tokenID, csrfToken string, userID uint, username, role string, expiresAt time.Time) (*Session, error) {
+func (s *MemorySessionStore) CreateSession(accessToken, refreshToken, tokenID, csrfToken string, userID uint, username, role string, expiresAt time.Time) (*Session, error) {
 	sessionID, err := GenerateSessionID()
 	if err != nil {
 		return nil, err
 	}
 
+	now := time.Now()
 	session := &Session{
 		ID:           sessionID,
 		AccessToken:  accessToken,
@@ -83,11 +158,17 @@ func (s *SessionStore) CreateSession(accessToken, refreshToken, tokenID, csrfTok
 		Username:     username,
 		Role:         role,
 		ExpiresAt:    expiresAt,
+		CreatedAt:    now,
+		LastUsedAt:   now,
 	}
 
 	s.mu.Lock()
 	// Cleanup expired sessions before creating new one (event-driven)
 	s.cleanupExpiredSessionsNow()
+	if s.tokenRevoked(tokenID) {
+		s.mu.Unlock()
+		return nil, ErrTokenRevoked
+	}
 	s.sessions[sessionID] = session
 	s.mu.Unlock()
 
@@ -99,8 +180,30 @@ func (s *SessionStore) CreateSession(accessToken, refreshToken, tokenID, csrfTok
 	return session, nil
 }
 
+// tokenRevoked reports whether refresh token tokenID was rotated or its session revoked.
+func (s *MemorySessionStore) tokenRevoked(tokenID string) bool {
+	if _, ok := s.rotated[tokenID]; ok {
+		return true
+	}
+	for _, session := range s.sessions {
+		if session.TokenID == tokenID && session.RevokedAt != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// active returns the session with sessionID if it is neither expired nor revoked.
+func (s *MemorySessionStore) active(sessionID string) (*Session, bool) {
+	session, exists := s.sessions[sessionID]
+	if !exists || session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		return nil, false
+	}
+	return session, true
+}
+
 // GetSessionByRefreshToken retrieves a session by refresh token.
-func (s *SessionStore) GetSessionByRefreshToken(refreshToken string) (*Session, bool) {
+func (s *MemorySessionStore) GetSessionByRefreshToken(refreshToken string) (*Session, bool) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -109,8 +212,8 @@ func (s *SessionStore) GetSessionByRefreshToken(refreshToken string) (*Session,
 
 	for _, session := range s.sessions {
 		if session.RefreshToken == refreshToken {
-			// Check if session is expired
-			if time.Now().After(session.ExpiresAt) {
+			// Check if session is expired or revoked
+			if _, ok := s.active(session.ID); !ok {
 				return nil, false
 			}
 			return session, true
@@ -121,7 +224,7 @@ func (s *SessionStore) GetSessionByRefreshToken(refreshToken string) (*Session,
 }
 
 // GetSessionByTokenID retrieves a session by token ID (for refresh token rotation).
-func (s *SessionStore) GetSessionByTokenID(tokenID string) (*Session, bool) {
+func (s *MemorySessionStore) GetSessionByTokenID(tokenID string) (*Session, bool) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -130,11 +233,7 @@ func (s *SessionStore) GetSessionByTokenID(tokenID string) (*Session, bool) {
 
 	for _, session := range s.sessions {
 		if session.TokenID == tokenID {
-			// Check if session is expired
-			if time.Now().After(session.ExpiresAt) {
-				return nil, false
-			}
-			return session, true
+			return s.active(session.ID)
 		}
 	}
 
@@ -142,17 +241,18 @@ func (s *SessionStore) GetSessionByTokenID(tokenID string) (*Session, bool) {
 }
 
 // UpdateSessionTokens updates access token and optionally refresh token (rotation).
-func (s *SessionStore) UpdateSessionTokens(sessionID, newAccessToken, newRefreshToken, newTokenID string) error {
+func (s *MemorySessionStore) UpdateSessionTokens(sessionID, newAccessToken, newRefreshToken, newTokenID string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	session, exists := s.sessions[sessionID]
+	session, exists := s.active(sessionID)
 	if !exists {
 		return fmt.Errorf("session not found")
 	}
 
 	session.AccessToken = newAccessToken
 	if newRefreshToken != "" {
+		s.rotated[session.TokenID] = rotatedToken{sessionID: sessionID, at: time.Now()}
 		session.RefreshToken = newRefreshToken
 		session.TokenID = newTokenID
 	}
@@ -160,62 +260,132 @@ func (s *SessionStore) UpdateSessionTokens(sessionID, newAccessToken, newRefresh
 	return nil
 }
 
+// RotateRefreshToken replaces refresh token tokenID with a new one.
+func (s *MemorySessionStore) RotateRefreshToken(tokenID, newAccessToken, newRefreshToken, newTokenID string, expiresAt time.Time) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cleanupExpiredSessionsNow()
+	now := time.Now()
+	for _, session := range s.sessions {
+		if session.TokenID != tokenID {
+			continue
+		}
+		if _, ok := s.active(session.ID); !ok {
+			return nil, ErrSessionNotFound
+		}
+		s.rotated[tokenID] = rotatedToken{sessionID: session.ID, at: now}
+		session.AccessToken = newAccessToken
+		session.RefreshToken = newRefreshToken
+		session.TokenID = newTokenID
+		session.ExpiresAt = expiresAt
+		session.LastUsedAt = now
+		return session, nil
+	}
+
+	rotated, ok := s.rotated[tokenID]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	session, ok := s.active(rotated.sessionID)
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	if now.Sub(rotated.at) < RefreshReuseGrace {
+		return nil, ErrRefreshTokenRotated
+	}
+	session.RevokedAt = &now
+	return session, ErrRefreshTokenReused
+}
+
 // ValidateCSRFToken validates a CSRF token for a session.
-func (s *SessionStore) ValidateCSRFToken(sessionID, csrfToken string) bool {
+func (s *MemorySessionStore) ValidateCSRFToken(sessionID, csrfToken string) bool {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	session, exists := s.sessions[sessionID]
+	session, exists := s.active(sessionID)
 	if !exists {
 		return false
 	}
 
-	return session.CSRFToken == csrfToken
+	return csrfTokensEqual(session.CSRFToken, csrfToken)
 }
 
-// GetSession retrieves a session by ID.
-func (s *SessionStore) GetSession(sessionID string) (*Session, bool) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+// RecordUse records that the session was used by clientIP with userAgent.
+func (s *MemorySessionStore) RecordUse(sessionID, clientIP, userAgent string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	session, exists := s.sessions[sessionID]
-	if !exists {
-		return nil, false
+	if session, exists := s.active(sessionID); exists {
+		session.ClientIP = clientIP
+		session.UserAgent = userAgent
+		session.LastUsedAt = time.Now()
 	}
+}
 
-	// Check if session is expired
-	if time.Now().After(session.ExpiresAt) {
-		// Delete expired session
-		s.mu.RUnlock()
-		s.mu.Lock()
-		delete(s.sessions, sessionID)
-		s.mu.Unlock()
-		s.mu.RLock()
-		return nil, false
-	}
+// GetSession retrieves a session by ID.
+func (s *MemorySessionStore) GetSession(sessionID string) (*Session, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
-	return session, true
+	// Expired sessions are removed by the next cleanup
+	return s.active(sessionID)
 }
 
 // GetSessionByRefreshTokenCookie retrieves a session by refresh token from cookie.
-func (s *SessionStore) GetSessionByRefreshTokenCookie(refreshToken string) (*Session, bool) {
+func (s *MemorySessionStore) GetSessionByRefreshTokenCookie(refreshToken string) (*Session, bool) {
 	return s.GetSessionByRefreshToken(refreshToken)
 }
 
-// DeleteSession deletes a session.
-func (s *SessionStore) DeleteSession(sessionID string) {
+// ListUserSessions returns a user's active sessions, most recently used first.
+func (s *MemorySessionStore) ListUserSessions(userID uint) ([]*Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var sessions []*Session
+	for id, session := range s.sessions {
+		if _, ok := s.active(id); ok && session.UserID == userID {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt)
+	})
+	return sessions, nil
+}
+
+// DeleteSession revokes a session. It is kept until it expires so its refresh token
+// can't start a new session.
+func (s *MemorySessionStore) DeleteSession(sessionID string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if _, exists := s.sessions[sessionID]; exists {
-		delete(s.sessions, sessionID)
+	if session, exists := s.active(sessionID); exists {
+		now := time.Now()
+		session.RevokedAt = &now
 		logger.Log.Debug("Session deleted", zap.String("session_id", sessionID))
 	}
 }
 
+// RevokeUserSessions revokes all sessions of a user.
+func (s *MemorySessionStore) RevokeUserSessions(userID uint) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	count := 0
+	for id, session := range s.sessions {
+		if _, ok := s.active(id); ok && session.UserID == userID {
+			session.RevokedAt = &now
+			count++
+		}
+	}
+	return count, nil
+}
+
 // cleanupExpiredSessionsNow removes expired sessions immediately (event-driven).
 // Called on-demand when sessions are accessed or created.
-func (s *SessionStore) cleanupExpiredSessionsNow() {
+func (s *MemorySessionStore) cleanupExpiredSessionsNow() {
 	now := time.Now()
 	count := 0
 	for id, session := range s.sessions {
@@ -224,12 +394,17 @@ func (s *SessionStore) cleanupExpiredSessionsNow() {
 			count++
 		}
 	}
+	for tokenID, rotated := range s.rotated {
+		if _, ok := s.sessions[rotated.sessionID]; !ok {
+			delete(s.rotated, tokenID)
+		}
+	}
 	if count > 0 {
 		logger.Log.Debug("Cleaned up expired sessions", zap.Int("count", count))
 	}
 }
 
 // Stop stops the session store (no-op for event-driven cleanup).
-func (s *SessionStore) Stop() {
+func (s *MemorySessionStore) Stop() {
 	// No periodic cleanup goroutine to stop
 }
@@ -0,0 +1,274 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/DARC0625/LIMEN/backend/internal/logger"
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// DBSessionStore stores sessions in the database (models.AuthSession). Refresh tokens
+// are stored as SHA-256 hashes and access tokens not at all: sessions returned by the
+// store carry a token only when it was passed in.
+type DBSessionStore struct {
+	db *gorm.DB
+}
+
+// NewDBSessionStore creates a session store backed by db.
+func NewDBSessionStore(db *gorm.DB) *DBSessionStore {
+	return &DBSessionStore{db: db}
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// active scopes a query to sessions neither expired nor revoked.
+func active(db *gorm.DB) *gorm.DB {
+	return db.Where("revoked_at IS NULL AND expires_at > ?", time.Now())
+}
+
+func toSession(row *models.AuthSession) *Session {
+	return &Session{
+		ID:         row.ID,
+		TokenID:    row.TokenID,
+		CSRFToken:  row.CSRFToken,
+		UserID:     row.UserID,
+		Username:   row.Username,
+		Role:       row.Role,
+		ExpiresAt:  row.ExpiresAt,
+		ClientIP:   row.ClientIP,
+		UserAgent:  row.UserAgent,
+		CreatedAt:  row.CreatedAt,
+		LastUsedAt: row.LastUsedAt,
+		RevokedAt:  row.RevokedAt,
+	}
+}
+
+// CreateSession creates a new session with access token, refresh token, and CSRF token.
+func (s *DBSessionStore) CreateSession(accessToken, refreshToken, tokenID, csrfToken string, userID uint, username, role string, expiresAt time.Time) (*Session, error) {
+	sessionID, err := GenerateSessionID()
+	if err != nil {
+		return nil, err
+	}
+	s.cleanupExpiredSessions()
+
+	var count int64
+	s.db.Model(&models.AuthRefreshToken{}).Where("token_id = ?", tokenID).Count(&count)
+	if count == 0 {
+		s.db.Model(&models.AuthSession{}).Where("token_id = ? AND revoked_at IS NOT NULL", tokenID).Count(&count)
+	}
+	if count > 0 {
+		return nil, ErrTokenRevoked
+	}
+
+	now := time.Now()
+	row := &models.AuthSession{
+		ID:               sessionID,
+		UserID:           userID,
+		Username:         username,
+		Role:             role,
+		TokenID:          tokenID,
+		RefreshTokenHash: hashToken(refreshToken),
+		CSRFToken:        csrfToken,
+		ExpiresAt:        expiresAt,
+		LastUsedAt:       now,
+		CreatedAt:        now,
+	}
+	if err := s.db.Create(row).Error; err != nil {
+		return nil, err
+	}
+
+	logger.Log.Debug("Session created",
+		zap.String("session_id", sessionID),
+		zap.Uint("user_id", userID),
+		zap.String("username", username))
+
+	session := toSession(row)
+	session.AccessToken = accessToken
+	session.RefreshToken = refreshToken
+	return session, nil
+}
+
+// GetSession retrieves a session by ID.
+func (s *DBSessionStore) GetSession(sessionID string) (*Session, bool) {
+	var row models.AuthSession
+	if err := active(s.db).Where("id = ?", sessionID).First(&row).Error; err != nil {
+		return nil, false
+	}
+	return toSession(&row), true
+}
+
+// GetSessionByRefreshToken retrieves a session by its current refresh token.
+func (s *DBSessionStore) GetSessionByRefreshToken(refreshToken string) (*Session, bool) {
+	var row models.AuthSession
+	if err := active(s.db).Where("refresh_token_hash = ?", hashToken(refreshToken)).First(&row).Error; err != nil {
+		return nil, false
+	}
+	session := toSession(&row)
+	session.RefreshToken = refreshToken
+	return session, true
+}
+
+// UpdateSessionTokens updates access token and optionally refresh token (rotation).
+func (s *DBSessionStore) UpdateSessionTokens(sessionID, newAccessToken, newRefreshToken, newTokenID string) error {
+	session, ok := s.GetSession(sessionID)
+	if !ok {
+		return ErrSessionNotFound
+	}
+	if newRefreshToken == "" {
+		// Access tokens aren't stored
+		return s.db.Model(&models.AuthSession{}).Where("id = ?", sessionID).Update("last_used_at", time.Now()).Error
+	}
+	_, err := s.rotate(session.ID, session.TokenID, newRefreshToken, newTokenID, session.ExpiresAt)
+	return err
+}
+
+// rotate replaces the refresh token tokenID of session sessionID, reporting false if it
+// was rotated concurrently.
+func (s *DBSessionStore) rotate(sessionID, tokenID, newRefreshToken, newTokenID string, expiresAt time.Time) (bool, error) {
+	rotated := false
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Model(&models.AuthSession{}).
+			Where("id = ? AND token_id = ?", sessionID, tokenID).
+			Updates(map[string]interface{}{
+				"token_id":           newTokenID,
+				"refresh_token_hash": hashToken(newRefreshToken),
+				"expires_at":         expiresAt,
+				"last_used_at":       now,
+			})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		rotated = true
+		return tx.Create(&models.AuthRefreshToken{TokenID: tokenID, SessionID: sessionID, RotatedAt: now}).Error
+	})
+	return rotated, err
+}
+
+// RotateRefreshToken replaces refresh token tokenID with a new one.
+func (s *DBSessionStore) RotateRefreshToken(tokenID, newAccessToken, newRefreshToken, newTokenID string, expiresAt time.Time) (*Session, error) {
+	var row models.AuthSession
+	err := s.db.Where("token_id = ?", tokenID).First(&row).Error
+	if err == nil {
+		if row.RevokedAt != nil || time.Now().After(row.ExpiresAt) {
+			return nil, ErrSessionNotFound
+		}
+		rotated, err := s.rotate(row.ID, tokenID, newRefreshToken, newTokenID, expiresAt)
+		if err != nil {
+			return nil, err
+		}
+		if !rotated {
+			// Another request rotated it first
+			return nil, ErrRefreshTokenRotated
+		}
+		session, ok := s.GetSession(row.ID)
+		if !ok {
+			return nil, ErrSessionNotFound
+		}
+		session.AccessToken = newAccessToken
+		session.RefreshToken = newRefreshToken
+		return session, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	var old models.AuthRefreshToken
+	if err := s.db.Where("token_id = ?", tokenID).First(&old).Error; err != nil {
+		return nil, ErrSessionNotFound
+	}
+	session, ok := s.GetSession(old.SessionID)
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	if time.Since(old.RotatedAt) < RefreshReuseGrace {
+		return nil, ErrRefreshTokenRotated
+	}
+	now := time.Now()
+	if err := s.db.Model(&models.AuthSession{}).Where("id = ?", session.ID).Update("revoked_at", now).Error; err != nil {
+		return nil, err
+	}
+	session.RevokedAt = &now
+	return session, ErrRefreshTokenReused
+}
+
+// ValidateCSRFToken validates a CSRF token for a session.
+func (s *DBSessionStore) ValidateCSRFToken(sessionID, csrfToken string) bool {
+	session, ok := s.GetSession(sessionID)
+	return ok && csrfTokensEqual(session.CSRFToken, csrfToken)
+}
+
+// csrfTokensEqual compares a session's CSRF token with the one a request presented in
+// constant time, so response timing doesn't leak how much of a guess was right.
+func csrfTokensEqual(want, got string) bool {
+	return want != "" && subtle.ConstantTimeCompare([]byte(want), []byte(got)) == 1
+}
+
+// RecordUse records that the session was used by clientIP with userAgent.
+func (s *DBSessionStore) RecordUse(sessionID, clientIP, userAgent string) {
+	err := s.db.Model(&models.AuthSession{}).Where("id = ?", sessionID).Updates(map[string]interface{}{
+		"client_ip":    clientIP,
+		"user_agent":   userAgent,
+		"last_used_at": time.Now(),
+	}).Error
+	if err != nil {
+		logger.Log.Warn("Failed to record session use", zap.String("session_id", sessionID), zap.Error(err))
+	}
+}
+
+// ListUserSessions returns a user's active sessions, most recently used first.
+func (s *DBSessionStore) ListUserSessions(userID uint) ([]*Session, error) {
+	var rows []models.AuthSession
+	if err := active(s.db).Where("user_id = ?", userID).Order("last_used_at DESC").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	sessions := make([]*Session, len(rows))
+	for i := range rows {
+		sessions[i] = toSession(&rows[i])
+	}
+	return sessions, nil
+}
+
+// DeleteSession revokes a session. It is kept until it expires so its refresh token
+// can't start a new session.
+func (s *DBSessionStore) DeleteSession(sessionID string) {
+	err := active(s.db.Model(&models.AuthSession{})).Where("id = ?", sessionID).Update("revoked_at", time.Now()).Error
+	if err != nil {
+		logger.Log.Warn("Failed to revoke session", zap.String("session_id", sessionID), zap.Error(err))
+		return
+	}
+	logger.Log.Debug("Session deleted", zap.String("session_id", sessionID))
+}
+
+// RevokeUserSessions revokes all sessions of a user.
+func (s *DBSessionStore) RevokeUserSessions(userID uint) (int, error) {
+	result := active(s.db.Model(&models.AuthSession{})).Where("user_id = ?", userID).Update("revoked_at", time.Now())
+	return int(result.RowsAffected), result.Error
+}
+
+// cleanupExpiredSessions deletes expired sessions and their rotated refresh tokens.
+func (s *DBSessionStore) cleanupExpiredSessions() {
+	expired := s.db.Model(&models.AuthSession{}).Select("id").Where("expires_at <= ?", time.Now())
+	if err := s.db.Where("session_id IN (?)", expired).Delete(&models.AuthRefreshToken{}).Error; err != nil {
+		logger.Log.Warn("Failed to clean up rotated refresh tokens", zap.Error(err))
+		return
+	}
+	result := s.db.Where("expires_at <= ?", time.Now()).Delete(&models.AuthSession{})
+	if result.Error != nil {
+		logger.Log.Warn("Failed to clean up expired sessions", zap.Error(result.Error))
+	} else if result.RowsAffected > 0 {
+		logger.Log.Debug("Cleaned up expired sessions", zap.Int64("count", result.RowsAffected))
+	}
+}
+
+// Stop stops the session store (no-op: the database is closed by its owner).
+func (s *DBSessionStore) Stop() {}
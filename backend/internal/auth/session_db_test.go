@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newTestDBSessionStore(t *testing.T) *DBSessionStore {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.AuthSession{}, &models.AuthRefreshToken{}); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+	return NewDBSessionStore(db)
+}
+
+// sessionStores returns each store implementation with a function aging the rotation
+// of a refresh token past RefreshReuseGrace.
+func sessionStores(t *testing.T) map[string]struct {
+	store SessionStore
+	age   func(tokenID string)
+} {
+	memory := NewSessionStore()
+	db := newTestDBSessionStore(t)
+	old := time.Now().Add(-2 * RefreshReuseGrace)
+	return map[string]struct {
+		store SessionStore
+		age   func(tokenID string)
+	}{
+		"memory": {memory, func(tokenID string) {
+			rotated := memory.rotated[tokenID]
+			rotated.at = old
+			memory.rotated[tokenID] = rotated
+		}},
+		"db": {db, func(tokenID string) {
+			db.db.Model(&models.AuthRefreshToken{}).Where("token_id = ?", tokenID).Update("rotated_at", old)
+		}},
+	}
+}
+
+func TestSessionStore_RefreshTokenRotation(t *testing.T) {
+	for name, tc := range sessionStores(t) {
+		t.Run(name, func(t *testing.T) {
+			store := tc.store
+			expiresAt := time.Now().Add(time.Hour)
+			session, err := store.CreateSession("access-1", "refresh-1", "tid-1", "csrf", 7, "alice", "user", expiresAt)
+			if err != nil {
+				t.Fatalf("CreateSession() error = %v", err)
+			}
+
+			rotated, err := store.RotateRefreshToken("tid-1", "access-2", "refresh-2", "tid-2", expiresAt)
+			if err != nil || rotated.ID != session.ID || rotated.TokenID != "tid-2" {
+				t.Fatalf("RotateRefreshToken() = %+v, %v; want session %s with tid-2", rotated, err, session.ID)
+			}
+			if _, ok := store.GetSessionByRefreshToken("refresh-1"); ok {
+				t.Error("GetSessionByRefreshToken(rotated token) found a session")
+			}
+			if got, ok := store.GetSessionByRefreshToken("refresh-2"); !ok || got.ID != session.ID {
+				t.Errorf("GetSessionByRefreshToken(new token) = %+v, %v", got, ok)
+			}
+
+			// A concurrent refresh with the old token doesn't revoke the session
+			if _, err := store.RotateRefreshToken("tid-1", "access-3", "refresh-3", "tid-3", expiresAt); !errors.Is(err, ErrRefreshTokenRotated) {
+				t.Fatalf("RotateRefreshToken(just rotated) error = %v, want ErrRefreshTokenRotated", err)
+			}
+			if _, ok := store.GetSession(session.ID); !ok {
+				t.Fatal("session revoked by a refresh within the grace period")
+			}
+
+			// A replay afterwards revokes the family
+			tc.age("tid-1")
+			revoked, err := store.RotateRefreshToken("tid-1", "access-3", "refresh-3", "tid-3", expiresAt)
+			if !errors.Is(err, ErrRefreshTokenReused) || revoked == nil || revoked.ID != session.ID {
+				t.Fatalf("RotateRefreshToken(reused) = %+v, %v; want ErrRefreshTokenReused", revoked, err)
+			}
+			if _, ok := store.GetSession(session.ID); ok {
+				t.Error("session still active after refresh token reuse")
+			}
+			if _, err := store.RotateRefreshToken("tid-2", "access-3", "refresh-3", "tid-3", expiresAt); !errors.Is(err, ErrSessionNotFound) {
+				t.Errorf("RotateRefreshToken(current token of revoked session) error = %v, want ErrSessionNotFound", err)
+			}
+			if _, err := store.CreateSession("access-3", "refresh-1", "tid-1", "csrf", 7, "alice", "user", expiresAt); !errors.Is(err, ErrTokenRevoked) {
+				t.Errorf("CreateSession(rotated token) error = %v, want ErrTokenRevoked", err)
+			}
+			if _, err := store.RotateRefreshToken("unknown", "a", "r", "t", expiresAt); !errors.Is(err, ErrSessionNotFound) {
+				t.Errorf("RotateRefreshToken(unknown) error = %v, want ErrSessionNotFound", err)
+			}
+		})
+	}
+}
+
+func TestSessionStore_ListAndRevoke(t *testing.T) {
+	for name, tc := range sessionStores(t) {
+		t.Run(name, func(t *testing.T) {
+			store := tc.store
+			expiresAt := time.Now().Add(time.Hour)
+			laptop, _ := store.CreateSession("a1", "r1", "t1", "c1", 7, "alice", "user", expiresAt)
+			phone, _ := store.CreateSession("a2", "r2", "t2", "c2", 7, "alice", "user", expiresAt)
+			other, _ := store.CreateSession("a3", "r3", "t3", "c3", 8, "bob", "user", expiresAt)
+			time.Sleep(time.Millisecond)
+			store.RecordUse(laptop.ID, "10.0.0.1", "Firefox")
+
+			sessions, err := store.ListUserSessions(7)
+			if err != nil || len(sessions) != 2 {
+				t.Fatalf("ListUserSessions() = %d sessions, %v; want 2", len(sessions), err)
+			}
+			if sessions[0].ID != laptop.ID || sessions[0].ClientIP != "10.0.0.1" || sessions[0].UserAgent != "Firefox" {
+				t.Errorf("ListUserSessions()[0] = %+v, want the laptop session used last", sessions[0])
+			}
+
+			store.DeleteSession(phone.ID)
+			if _, ok := store.GetSessionByRefreshToken("r2"); ok {
+				t.Error("GetSessionByRefreshToken() found a logged out session")
+			}
+			if _, err := store.CreateSession("a2", "r2", "t2", "c2", 7, "alice", "user", expiresAt); !errors.Is(err, ErrTokenRevoked) {
+				t.Errorf("CreateSession(logged out token) error = %v, want ErrTokenRevoked", err)
+			}
+
+			if n, err := store.RevokeUserSessions(7); err != nil || n != 1 {
+				t.Errorf("RevokeUserSessions() = %d, %v; want 1", n, err)
+			}
+			if sessions, _ := store.ListUserSessions(7); len(sessions) != 0 {
+				t.Errorf("ListUserSessions() after revocation = %d sessions", len(sessions))
+			}
+			if !store.ValidateCSRFToken(other.ID, "c3") {
+				t.Error("other user's session revoked")
+			}
+		})
+	}
+}
+
+func TestDBSessionStore_PersistsHashedTokens(t *testing.T) {
+	store := newTestDBSessionStore(t)
+	session, err := store.CreateSession("access", "refresh-token", "tid", "csrf", 7, "alice", "user", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("CreateSession() error = %v", err)
+	}
+
+	var row models.AuthSession
+	store.db.First(&row, "id = ?", session.ID)
+	if row.RefreshTokenHash == "refresh-token" || row.RefreshTokenHash != hashToken("refresh-token") {
+		t.Errorf("stored refresh token = %q, want its hash", row.RefreshTokenHash)
+	}
+
+	// Another instance (or a restart) sees the session
+	restarted := NewDBSessionStore(store.db)
+	if got, ok := restarted.GetSessionByRefreshToken("refresh-token"); !ok || got.ID != session.ID || got.CSRFToken != "csrf" {
+		t.Errorf("GetSessionByRefreshToken() after restart = %+v, %v", got, ok)
+	}
+
+	// Expired sessions are cleaned up
+	store.db.Model(&row).Update("expires_at", time.Now().Add(-time.Minute))
+	if _, err := restarted.CreateSession("a", "r", "t", "c", 8, "bob", "user", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("CreateSession() error = %v", err)
+	}
+	var count int64
+	store.db.Model(&models.AuthSession{}).Where("id = ?", session.ID).Count(&count)
+	if count != 0 {
+		t.Error("expired session not cleaned up")
+	}
+}
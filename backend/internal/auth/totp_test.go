@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 key of the RFC 6238 test vectors ("12345678901234567890").
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode_RFC6238Vectors(t *testing.T) {
+	// The RFC lists 8-digit codes; 6-digit codes are their last 6 digits
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1111111111: "050471",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, want := range vectors {
+		got, err := TOTPCode(rfc6238Secret, TOTPStep(time.Unix(unix, 0)))
+		if err != nil || got != want {
+			t.Errorf("TOTPCode(T=%d) = %q, %v; want %q", unix, got, err, want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	step := TOTPStep(now)
+	previous, _ := TOTPCode(rfc6238Secret, step-1)
+	tooOld, _ := TOTPCode(rfc6238Secret, step-2)
+
+	if got, ok := ValidateTOTP(rfc6238Secret, "005 924", now, 0); !ok || got != step {
+		t.Errorf("ValidateTOTP(current code) = %d, %v; want step %d", got, ok, step)
+	}
+	if got, ok := ValidateTOTP(rfc6238Secret, previous, now, 0); !ok || got != step-1 {
+		t.Errorf("ValidateTOTP(previous code) = %d, %v; want step %d", got, ok, step-1)
+	}
+	if _, ok := ValidateTOTP(rfc6238Secret, tooOld, now, 0); ok {
+		t.Error("ValidateTOTP accepted a code two steps old")
+	}
+	if _, ok := ValidateTOTP(rfc6238Secret, "005924", now, step); ok {
+		t.Error("ValidateTOTP accepted a code of an already used step")
+	}
+	if _, ok := ValidateTOTP(rfc6238Secret, "12345", now, 0); ok {
+		t.Error("ValidateTOTP accepted a 5-digit code")
+	}
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil || len(secret) != 32 {
+		t.Fatalf("GenerateTOTPSecret() = %q, %v; want 32 base32 characters", secret, err)
+	}
+	uri := TOTPProvisioningURI("LIMEN", "alice", secret)
+	for _, part := range []string{"otpauth://totp/LIMEN:alice?", "secret=" + secret, "issuer=LIMEN", "digits=6", "period=30"} {
+		if !strings.Contains(uri, part) {
+			t.Errorf("TOTPProvisioningURI() = %q, missing %q", uri, part)
+		}
+	}
+}
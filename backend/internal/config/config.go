@@ -37,8 +37,9 @@ type Config struct {
 	AdminPassword        string   // Default admin password (should be changed on first login)
 	AllowedOrigins       []string // CORS allowed origins
 	JWTSecret            string   // JWT signing secret (HMAC, deprecated - use Ed25519)
-	JWTEd25519PrivateKey string   // Ed25519 private key for JWT signing (preferred)
-	JWTEd25519PublicKey  string   // Ed25519 public key for JWT verification (preferred)
+	JWTEd25519PrivateKey string   // Ed25519 private key for JWT signing, base64 (preferred)
+	JWTEd25519PublicKeys []string // More Ed25519 public keys verifying JWTs, base64: previous signing keys during a rotation
+	JWTAcceptHMAC        bool     // Keep accepting HMAC-signed JWTs with an Ed25519 key (while switching to Ed25519)
 
 	// Logging Configuration
 	LogLevel string // Log level: debug, info, warn, error
@@ -51,6 +52,7 @@ type Config struct {
 
 	// IP Whitelist
 	AdminIPWhitelist []string // IP whitelist for admin endpoints (empty = allow all)
+	TrustedProxies   []string // Reverse proxies whose X-Forwarded-For is believed (IPs or CIDR ranges)
 
 	// Environment
 	Env string // Environment: development, production, etc.
@@ -68,9 +70,94 @@ type Config struct {
 	AlertDedupWindow   int      // Deduplication window in minutes
 
 	// VM Minimum Resource Configuration (안전장치: 최소 리소스 강제)
-	VMMinVCPU     int // Minimum CPU cores (default: 2)
-	VMMinMemMB    int // Minimum memory in MB for Linux VMs (default: 2048)
-	VMMinMemMBISO int // Minimum memory in MB for Windows/ISO VMs (default: 4096)
+	// Per-OS minimums come from the OS profile (OSProfilesPath); these are global floors.
+	VMMinVCPU  int // Minimum CPU cores (default: 2)
+	VMMinMemMB int // Minimum memory in MB (default: 2048)
+
+	// OS Profiles
+	OSProfilesPath string // JSON file of OS profiles (missing = built-in defaults)
+
+	// CPU Placement
+	CPUPlacementPolicy string // Who may pin vCPUs / choose NUMA nodes: admin (default), all, none
+
+	// Console Recording
+	ConsoleRecording              string // off, opt-in (per-VM record_console, default) or all (enforced for every VM)
+	ConsoleRecordingDir           string // Directory for recording files
+	ConsoleRecordingRetentionDays int    // Days to keep recordings (0 = forever)
+	ConsoleRecordingKey           string // Secret for encrypting recordings at rest (empty = unencrypted)
+	ConsoleRecordingMaxMB         int    // Size a recording may grow to before it stops (0 = unlimited)
+
+	// Multi-Factor Authentication
+	MFAIssuer        string // Service name shown in authenticator apps
+	MFAEncryptionKey string // Secret for encrypting TOTP secrets at rest (empty = unencrypted)
+
+	// WebAuthn (passkeys and security keys)
+	WebAuthnRPID    string   // Relying party ID, the domain credentials are scoped to (empty = disabled)
+	WebAuthnRPName  string   // Relying party name shown by authenticators
+	WebAuthnOrigins []string // Origins allowed to run ceremonies (default https://<RP ID>)
+
+	// OIDC Single Sign-On
+	OIDCIssuer            string   // Identity provider issuer URL (empty = disabled)
+	OIDCClientID          string   // Client ID registered at the provider (empty = disabled)
+	OIDCClientSecret      string   // Client secret (empty for public clients using PKCE alone)
+	OIDCRedirectURL       string   // Callback URL registered at the provider (…/api/auth/oidc/callback)
+	OIDCScopes            []string // Requested scopes
+	OIDCUsernameClaim     string   // Claim naming new users
+	OIDCGroupsClaim       string   // Claim listing the user's groups
+	OIDCAdminGroups       []string // Groups whose members are admins (empty = roles are left to admins)
+	OIDCApprovedGroups    []string // Groups whose members are approved (empty = approval is left to admins)
+	OIDCBetaGroups        []string // Groups whose members get beta access (empty = left to admins)
+	OIDCMFAValues         []string // ID token amr/acr values proving a second factor at the provider
+	OIDCPostLoginRedirect string   // Web app path users land on after logging in
+
+	// Password authentication
+	AuthBackends          []string // Directories checked by password logins, in order: local, ldap
+	LDAPURL               string   // ldap://host[:389] or ldaps://host[:636]
+	LDAPStartTLS          bool     // Upgrade ldap:// connections with StartTLS
+	LDAPCACert            string   // PEM CA certificates trusted for the directory (empty = system roots)
+	LDAPBindDN            string   // Service account searching for users (empty = anonymous search)
+	LDAPBindPassword      string   // Service account password
+	LDAPBaseDN            string   // Subtree searched for users
+	LDAPUserFilter        string   // Filter finding a user, %s standing for the username
+	LDAPUsernameAttribute string   // Attribute holding the username
+	LDAPEmailAttribute    string   // Attribute holding the email address
+	LDAPGroupAttribute    string   // Attribute listing the user's groups
+	LDAPAdminGroups       []string // Group DNs whose members are admins (empty = roles are left to admins)
+	LDAPApprovedGroups    []string // Group DNs whose members are approved (empty = approval is left to admins)
+	LDAPBetaGroups        []string // Group DNs whose members get beta access (empty = left to admins)
+
+	// Account mail (password resets, email verification), sent through the alert SMTP server
+	MailSink  string // smtp, log or file (default smtp when ALERT_EMAIL_SMTP_HOST is set, log otherwise)
+	MailFile  string // File the file sink appends messages to
+	MailFrom  string // Sender address (default ALERT_EMAIL_FROM)
+	PublicURL string // Web app URL the links in account mail point to
+
+	// Console Session Limits (server defaults; admins can override them per role or user)
+	ConsoleSessionMaxIdleMinutes         int // Idle timeout
+	ConsoleSessionMaxDurationMinutes     int // Maximum session length
+	ConsoleSessionMaxConcurrent          int // Concurrent sessions per user
+	ConsoleSessionReconnectWindowSeconds int // At most 3 new sessions per window
+
+	// VNC TLS (VeNCrypt between the console proxy and QEMU; all empty = plain VNC on loopback)
+	VNCTLSCACert     string // CA certificate that signed QEMU's VNC server certificate
+	VNCTLSClientCert string // Client certificate, for QEMU configured with vnc_tls_x509_verify
+	VNCTLSClientKey  string // Client certificate key
+	VNCTLSServerName string // Name in QEMU's VNC server certificate
+
+	// UEFI Firmware (OVMF)
+	OVMFCodePath           string // OVMF code image for UEFI VMs
+	OVMFVarsPath           string // NVRAM template for UEFI VMs
+	OVMFSecureBootCodePath string // Secure Boot capable OVMF code image
+	OVMFSecureBootVarsPath string // NVRAM template with Microsoft keys enrolled
+
+	// Image Upload Configuration
+	ImageUploadMaxGB    int // Maximum size of a single uploaded image in GB (default: 16)
+	ImageUploadChunkMB  int // Maximum size of a single upload chunk in MB (default: 8)
+	ImageUploadTTLHours int // Hours a pending upload may go without data before it expires (0 = never, default: 24)
+
+	// Image Catalog Configuration
+	ImageCatalogPath    string // JSON catalog of downloadable ISOs
+	ImageCatalogKeyring string // Armored GPG public keyring for catalog signatures (empty = signed entries can't be verified)
 }
 
 // Load reads environment variables and returns a Config instance.
@@ -100,8 +187,14 @@ func Load() *Config {
 		RateLimitBurst:   parseInt(getEnv("RATE_LIMIT_BURST", "20"), 20),
 		Env:              getEnv("ENV", "development"),
 
+		// JWT Keys (Ed25519)
+		JWTEd25519PrivateKey: getEnv("JWT_ED25519_PRIVATE_KEY", ""),
+		JWTEd25519PublicKeys: parseStringSlice(getEnv("JWT_ED25519_PUBLIC_KEYS", "")),
+		JWTAcceptHMAC:        getEnv("JWT_ACCEPT_HMAC", "false") == "true",
+
 		// IP Whitelist
 		AdminIPWhitelist: parseStringSlice(getEnv("ADMIN_IP_WHITELIST", "")),
+		TrustedProxies:   parseStringSlice(getEnv("TRUSTED_PROXIES", "127.0.0.1,::1")),
 
 		// Alerting
 		AlertingEnabled:    getEnv("ALERTING_ENABLED", "false") == "true",
@@ -115,9 +208,93 @@ func Load() *Config {
 		AlertDedupWindow:   parseInt(getEnv("ALERT_DEDUP_WINDOW", "5"), 5),
 
 		// VM Minimum Resource Configuration (안전장치)
-		VMMinVCPU:     parseInt(getEnv("VM_MIN_VCPU", "2"), 2),             // Minimum 2 CPU cores
-		VMMinMemMB:    parseInt(getEnv("VM_MIN_MEM_MB", "2048"), 2048),     // Minimum 2GB for Linux
-		VMMinMemMBISO: parseInt(getEnv("VM_MIN_MEM_MB_ISO", "4096"), 4096), // Minimum 4GB for Windows/ISO
+		VMMinVCPU:  parseInt(getEnv("VM_MIN_VCPU", "2"), 2),         // Minimum 2 CPU cores
+		VMMinMemMB: parseInt(getEnv("VM_MIN_MEM_MB", "2048"), 2048), // Minimum 2GB
+
+		// OS Profiles
+		OSProfilesPath: getEnv("OS_PROFILES_PATH", "./config/os-profiles.json"),
+
+		// CPU Placement
+		CPUPlacementPolicy: getEnv("CPU_PLACEMENT_POLICY", "admin"),
+
+		// Console Recording
+		ConsoleRecording:              getEnv("CONSOLE_RECORDING", "opt-in"),
+		ConsoleRecordingDir:           getEnv("CONSOLE_RECORDING_DIR", "../database/recordings"),
+		ConsoleRecordingRetentionDays: parseInt(getEnv("CONSOLE_RECORDING_RETENTION_DAYS", "90"), 90),
+		ConsoleRecordingKey:           getEnv("CONSOLE_RECORDING_KEY", ""),
+		ConsoleRecordingMaxMB:         parseInt(getEnv("CONSOLE_RECORDING_MAX_MB", "1024"), 1024),
+
+		// Multi-Factor Authentication
+		MFAIssuer:        getEnv("MFA_ISSUER", "LIMEN"),
+		MFAEncryptionKey: getEnv("MFA_ENCRYPTION_KEY", ""),
+
+		// WebAuthn
+		WebAuthnRPID:    getEnv("WEBAUTHN_RP_ID", ""),
+		WebAuthnRPName:  getEnv("WEBAUTHN_RP_NAME", "LIMEN"),
+		WebAuthnOrigins: parseStringSlice(getEnv("WEBAUTHN_ORIGINS", "")),
+
+		// OIDC Single Sign-On
+		OIDCIssuer:            getEnv("OIDC_ISSUER", ""),
+		OIDCClientID:          getEnv("OIDC_CLIENT_ID", ""),
+		OIDCClientSecret:      getEnv("OIDC_CLIENT_SECRET", ""),
+		OIDCRedirectURL:       getEnv("OIDC_REDIRECT_URL", ""),
+		OIDCScopes:            parseStringSlice(getEnv("OIDC_SCOPES", "openid,profile,email,groups")),
+		OIDCUsernameClaim:     getEnv("OIDC_USERNAME_CLAIM", "preferred_username"),
+		OIDCGroupsClaim:       getEnv("OIDC_GROUPS_CLAIM", "groups"),
+		OIDCAdminGroups:       parseStringSlice(getEnv("OIDC_ADMIN_GROUPS", "")),
+		OIDCApprovedGroups:    parseStringSlice(getEnv("OIDC_APPROVED_GROUPS", "")),
+		OIDCBetaGroups:        parseStringSlice(getEnv("OIDC_BETA_GROUPS", "")),
+		OIDCMFAValues:         parseStringSlice(getEnv("OIDC_MFA_VALUES", "mfa")),
+		OIDCPostLoginRedirect: getEnv("OIDC_POST_LOGIN_REDIRECT", "/"),
+
+		// Password authentication
+		AuthBackends:          parseStringSlice(getEnv("AUTH_BACKENDS", "local")),
+		LDAPURL:               getEnv("LDAP_URL", ""),
+		LDAPStartTLS:          getEnv("LDAP_STARTTLS", "false") == "true",
+		LDAPCACert:            getEnv("LDAP_CA_CERT", ""),
+		LDAPBindDN:            getEnv("LDAP_BIND_DN", ""),
+		LDAPBindPassword:      getEnv("LDAP_BIND_PASSWORD", ""),
+		LDAPBaseDN:            getEnv("LDAP_BASE_DN", ""),
+		LDAPUserFilter:        getEnv("LDAP_USER_FILTER", "(uid=%s)"),
+		LDAPUsernameAttribute: getEnv("LDAP_USERNAME_ATTRIBUTE", "uid"),
+		LDAPEmailAttribute:    getEnv("LDAP_EMAIL_ATTRIBUTE", "mail"),
+		LDAPGroupAttribute:    getEnv("LDAP_GROUP_ATTRIBUTE", "memberOf"),
+		LDAPAdminGroups:       parseStringSliceSep(getEnv("LDAP_ADMIN_GROUPS", ""), ";"),
+		LDAPApprovedGroups:    parseStringSliceSep(getEnv("LDAP_APPROVED_GROUPS", ""), ";"),
+		LDAPBetaGroups:        parseStringSliceSep(getEnv("LDAP_BETA_GROUPS", ""), ";"),
+
+		// Account mail
+		MailSink:  getEnv("MAIL_SINK", ""),
+		MailFile:  getEnv("MAIL_FILE", "./mail.log"),
+		MailFrom:  getEnv("MAIL_FROM", ""),
+		PublicURL: strings.TrimRight(getEnv("PUBLIC_URL", "http://localhost:3000"), "/"),
+
+		// Console Session Limits
+		ConsoleSessionMaxIdleMinutes:         parseInt(getEnv("CONSOLE_SESSION_MAX_IDLE_MINUTES", "15"), 15),
+		ConsoleSessionMaxDurationMinutes:     parseInt(getEnv("CONSOLE_SESSION_MAX_DURATION_MINUTES", "240"), 240),
+		ConsoleSessionMaxConcurrent:          parseInt(getEnv("CONSOLE_SESSION_MAX_CONCURRENT", "2"), 2),
+		ConsoleSessionReconnectWindowSeconds: parseInt(getEnv("CONSOLE_SESSION_RECONNECT_WINDOW_SECONDS", "30"), 30),
+
+		// VNC TLS
+		VNCTLSCACert:     getEnv("VNC_TLS_CA_CERT", ""),
+		VNCTLSClientCert: getEnv("VNC_TLS_CLIENT_CERT", ""),
+		VNCTLSClientKey:  getEnv("VNC_TLS_CLIENT_KEY", ""),
+		VNCTLSServerName: getEnv("VNC_TLS_SERVER_NAME", "localhost"),
+
+		// UEFI Firmware (OVMF)
+		OVMFCodePath:           getEnv("OVMF_CODE_PATH", "/usr/share/OVMF/OVMF_CODE_4M.fd"),
+		OVMFVarsPath:           getEnv("OVMF_VARS_PATH", "/usr/share/OVMF/OVMF_VARS_4M.fd"),
+		OVMFSecureBootCodePath: getEnv("OVMF_SECUREBOOT_CODE_PATH", "/usr/share/OVMF/OVMF_CODE_4M.secboot.fd"),
+		OVMFSecureBootVarsPath: getEnv("OVMF_SECUREBOOT_VARS_PATH", "/usr/share/OVMF/OVMF_VARS_4M.ms.fd"),
+
+		// Image Upload Configuration
+		ImageUploadMaxGB:    parseInt(getEnv("IMAGE_UPLOAD_MAX_GB", "16"), 16),
+		ImageUploadChunkMB:  parseInt(getEnv("IMAGE_UPLOAD_CHUNK_MB", "8"), 8),
+		ImageUploadTTLHours: parseInt(getEnv("IMAGE_UPLOAD_TTL_HOURS", "24"), 24),
+
+		// Image Catalog Configuration
+		ImageCatalogPath:    getEnv("IMAGE_CATALOG_PATH", "../database/iso-catalog.json"),
+		ImageCatalogKeyring: getEnv("IMAGE_CATALOG_KEYRING", ""),
 	}
 
 	// Build DatabaseURL from components
@@ -134,6 +311,20 @@ func Load() *Config {
 		}
 	}
 
+	if cfg.MailSink == "" {
+		cfg.MailSink = "log"
+		if cfg.AlertEmailSMTPHost != "" {
+			cfg.MailSink = "smtp"
+		}
+	}
+	if cfg.MailFrom == "" {
+		cfg.MailFrom = cfg.AlertEmailFrom
+	}
+
+	if cfg.WebAuthnRPID != "" && len(cfg.WebAuthnOrigins) == 0 {
+		cfg.WebAuthnOrigins = []string{"https://" + cfg.WebAuthnRPID}
+	}
+
 	// Parse alert email recipients (comma-separated)
 	emailToStr := getEnv("ALERT_EMAIL_TO", "")
 	if emailToStr != "" {
@@ -192,10 +383,16 @@ func parseFloat(s string, fallback float64) float64 {
 
 // parseStringSlice parses a comma-separated string into a slice of strings.
 func parseStringSlice(s string) []string {
+	return parseStringSliceSep(s, ",")
+}
+
+// parseStringSliceSep is parseStringSlice for lists whose items contain commas, such as
+// LDAP DNs.
+func parseStringSliceSep(s, sep string) []string {
 	if s == "" {
 		return []string{}
 	}
-	parts := strings.Split(s, ",")
+	parts := strings.Split(s, sep)
 	result := make([]string, 0, len(parts))
 	for _, part := range parts {
 		trimmed := strings.TrimSpace(part)
@@ -46,9 +46,23 @@ func Connect(cfg *config.Config) error {
 		&models.VMSnapshot{},
 		&models.ResourceQuota{},
 		&models.ConsoleSession{},
+		&models.ConsoleSessionLimit{},
+		&models.ConsoleRecording{},
 		&models.UserQuota{},
 		&models.AuditLog{},
 		&models.Waitlist{},
+		&models.ImageUpload{},
+		&models.Host{},
+		&models.AuthSession{},
+		&models.AuthRefreshToken{},
+		&models.LoginFailure{},
+		&models.UserMFA{},
+		&models.MFARecoveryCode{},
+		&models.MFARolePolicy{},
+		&models.WebAuthnCredential{},
+		&models.ExternalIdentity{},
+		&models.APIToken{},
+		&models.Role{},
 	)
 	if err != nil {
 		return err
@@ -3,6 +3,7 @@ package errors
 
 import (
 	"encoding/json"
+	stderrors "errors"
 	"fmt"
 	"net/http"
 )
@@ -178,7 +179,13 @@ func WriteAppError(w http.ResponseWriter, appErr *AppError, isDevelopment bool)
 
 // WriteInternalError writes a 500 Internal Server Error response.
 // Zero-trust principle: Never expose internal error details to clients.
+// If internalErr wraps an AppError (e.g. a libvirt connection outage), its status and code are used instead.
 func WriteInternalError(w http.ResponseWriter, internalErr error, isDevelopment bool) {
+	var appErr *AppError
+	if stderrors.As(internalErr, &appErr) && appErr.HTTPCode != 0 {
+		WriteAppError(w, appErr, isDevelopment)
+		return
+	}
 	WriteErrorWithCode(w, http.StatusInternalServerError, "Internal server error", ErrCodeInternalError, internalErr, isDevelopment)
 }
 
@@ -2,6 +2,7 @@ package errors
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -134,6 +135,24 @@ func TestWriteInternalError(t *testing.T) {
 	}
 }
 
+func TestWriteInternalError_AppError(t *testing.T) {
+	appErr := NewAppError(ErrCodeLibvirtConnection, "Libvirt connection is down", http.StatusServiceUnavailable).
+		WithCause(fmt.Errorf("connection refused"))
+	w := httptest.NewRecorder()
+	WriteInternalError(w, fmt.Errorf("failed to start VM: %w", appErr), false)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("WriteInternalError() code = %v, want %v", w.Code, http.StatusServiceUnavailable)
+	}
+	var apiErr APIError
+	if err := json.NewDecoder(w.Body).Decode(&apiErr); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if apiErr.ErrorCode != ErrCodeLibvirtConnection || apiErr.Message != "Libvirt connection is down" || apiErr.Error != "" {
+		t.Errorf("APIError = %+v", apiErr)
+	}
+}
+
 func TestWriteBadRequest(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DARC0625/LIMEN/backend/internal/auth"
+	"github.com/DARC0625/LIMEN/backend/internal/mail"
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// mailbox is a mail.Sender delivering to a channel.
+type mailbox chan mail.Message
+
+func (m mailbox) Send(ctx context.Context, msg mail.Message) error {
+	m <- msg
+	return nil
+}
+
+// receive returns the token of the link in the next message to to.
+func (m mailbox) receive(t *testing.T, to string) string {
+	t.Helper()
+	select {
+	case msg := <-m:
+		if len(msg.To) != 1 || msg.To[0] != to {
+			t.Fatalf("mail to %v, want %s", msg.To, to)
+		}
+		_, link, _ := strings.Cut(msg.Body, "?token=")
+		token, err := url.QueryUnescape(strings.Fields(link)[0])
+		if err != nil {
+			t.Fatalf("mail without a token link: %q", msg.Body)
+		}
+		return token
+	case <-time.After(5 * time.Second):
+		t.Fatal("no mail sent")
+		return ""
+	}
+}
+
+func setupTestAccountHandler(t *testing.T) (*Handler, *models.User, mailbox) {
+	t.Helper()
+	h := setupTestImageHandler(t)
+	if err := h.DB.AutoMigrate(&models.LoginFailure{}, &models.AuthSession{}, &models.AuthRefreshToken{}); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+	auth.SetSessionStore(auth.NewDBSessionStore(h.DB))
+	t.Cleanup(func() { auth.SetSessionStore(auth.NewSessionStore()) })
+	box := make(mailbox, 4)
+	h.Mail = box
+
+	hashed, _ := bcrypt.GenerateFromPassword([]byte("Old-Password-1"), bcrypt.MinCost)
+	alice := &models.User{Username: "alice", Password: string(hashed), Role: models.RoleUser, Approved: true}
+	h.DB.Create(alice)
+	return h, alice, box
+}
+
+func TestAccount_EmailVerificationAndPasswordReset(t *testing.T) {
+	h, alice, box := setupTestAccountHandler(t)
+	forgot := func() int {
+		w := httptest.NewRecorder()
+		h.HandleForgotPassword(w, imageRequest("POST", "/api/auth/password/forgot", []byte(`{"email":"Alice@Example.org"}`), 0, "", nil))
+		return w.Code
+	}
+
+	// No verified address, no reset link
+	if code := forgot(); code != http.StatusAccepted || len(box) != 0 {
+		t.Fatalf("forgot without an address = %d, %d mails", code, len(box))
+	}
+
+	body := []byte(`{"email":"alice@example.org","current_password":"wrong"}`)
+	w := httptest.NewRecorder()
+	h.HandleChangeEmail(w, imageRequest("PUT", "/api/auth/email", body, alice.ID, "user", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("change email with a wrong password = %d, want 403", w.Code)
+	}
+	body = []byte(`{"email":"alice@example.org","current_password":"Old-Password-1"}`)
+	w = httptest.NewRecorder()
+	h.HandleChangeEmail(w, imageRequest("PUT", "/api/auth/email", body, alice.ID, "user", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("change email = %d: %s", w.Code, w.Body.String())
+	}
+	verification := box.receive(t, "alice@example.org")
+	w = httptest.NewRecorder()
+	h.HandleVerifyEmail(w, imageRequest("POST", "/api/auth/email/verify", []byte(`{"token":"`+verification+`"}`), 0, "", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("verify email = %d: %s", w.Code, w.Body.String())
+	}
+
+	store := auth.GetSessionStore()
+	store.CreateSession("a1", "refresh-laptop", "t1", "c1", alice.ID, "alice", "user", time.Now().Add(time.Hour))
+	h.APITokens.Create(alice.ID, "ci", []string{"vm:read"}, time.Hour)
+	if code := forgot(); code != http.StatusAccepted {
+		t.Fatalf("forgot = %d", code)
+	}
+	reset := box.receive(t, "alice@example.org")
+
+	resetWith := func(password string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(ResetPasswordRequest{Token: reset, NewPassword: password})
+		w := httptest.NewRecorder()
+		h.HandleResetPassword(w, imageRequest("POST", "/api/auth/password/reset", body, 0, "", nil))
+		return w
+	}
+	if w := resetWith("short"); w.Code != http.StatusBadRequest {
+		t.Errorf("reset to a weak password = %d, want 400", w.Code)
+	}
+	if w := resetWith("New-Password-2!"); w.Code != http.StatusOK {
+		t.Fatalf("reset = %d: %s", w.Code, w.Body.String())
+	}
+	if w := resetWith("Other-Password-3!"); w.Code != http.StatusBadRequest {
+		t.Errorf("reusing the reset link = %d, want 400", w.Code)
+	}
+	var user models.User
+	h.DB.First(&user, alice.ID)
+	if !auth.CheckPassword("New-Password-2!", user.Password) {
+		t.Error("password wasn't reset")
+	}
+	if sessions, _ := store.ListUserSessions(alice.ID); len(sessions) != 0 {
+		t.Errorf("%d sessions left after a reset, want 0", len(sessions))
+	}
+	if tokens, _ := h.APITokens.List(alice.ID); len(tokens) != 0 {
+		t.Errorf("%d API tokens left after a reset, want 0", len(tokens))
+	}
+}
+
+func TestAccount_ChangePassword(t *testing.T) {
+	h, alice, _ := setupTestAccountHandler(t)
+	store := auth.GetSessionStore()
+	expiresAt := time.Now().Add(time.Hour)
+	laptop, _ := store.CreateSession("a1", "refresh-laptop", "t1", "c1", alice.ID, "alice", "user", expiresAt)
+	store.CreateSession("a2", "refresh-phone", "t2", "c2", alice.ID, "alice", "user", expiresAt)
+
+	h.APITokens.Create(alice.ID, "ci", []string{"vm:read"}, time.Hour)
+
+	change := func(current, next string, revokeTokens bool) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(ChangePasswordRequest{CurrentPassword: current, NewPassword: next, RevokeAPITokens: revokeTokens})
+		req := imageRequest("POST", "/api/auth/password", body, alice.ID, "user", nil)
+		req.AddCookie(&http.Cookie{Name: "refresh_token", Value: "refresh-laptop"})
+		w := httptest.NewRecorder()
+		h.HandleChangePassword(w, req)
+		return w
+	}
+
+	if w := change("wrong", "New-Password-2!", false); w.Code != http.StatusForbidden {
+		t.Errorf("wrong current password = %d, want 403", w.Code)
+	}
+	var failures int64
+	h.DB.Model(&models.LoginFailure{}).Count(&failures)
+	if failures != 1 {
+		t.Errorf("failed attempts = %d, want 1", failures)
+	}
+	if w := change("Old-Password-1", "weak", false); w.Code != http.StatusBadRequest {
+		t.Errorf("weak new password = %d, want 400", w.Code)
+	}
+
+	w := change("Old-Password-1", "New-Password-2!", false)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"sessions_revoked":1`) ||
+		!strings.Contains(w.Body.String(), `"api_tokens_revoked":0`) {
+		t.Fatalf("change = %d: %s", w.Code, w.Body.String())
+	}
+	// The session changing the password stays logged in
+	sessions, _ := store.ListUserSessions(alice.ID)
+	if len(sessions) != 1 || sessions[0].ID != laptop.ID {
+		t.Errorf("sessions left = %+v, want the laptop's", sessions)
+	}
+
+	// API tokens are revoked when asked for
+	w = change("New-Password-2!", "Newer-Password-3!", true)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"api_tokens_revoked":1`) {
+		t.Fatalf("change revoking API tokens = %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -2,7 +2,9 @@ package handlers
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	stderrors "errors"
 	"fmt"
 	"net"
 	"net/http"
@@ -18,18 +20,26 @@ import (
 	"github.com/DARC0625/LIMEN/backend/internal/auth"
 	"github.com/DARC0625/LIMEN/backend/internal/cache"
 	"github.com/DARC0625/LIMEN/backend/internal/config"
+	"github.com/DARC0625/LIMEN/backend/internal/crypto"
 	"github.com/DARC0625/LIMEN/backend/internal/errors"
 	"github.com/DARC0625/LIMEN/backend/internal/featureflags"
+	"github.com/DARC0625/LIMEN/backend/internal/images"
+	"github.com/DARC0625/LIMEN/backend/internal/ldap"
 	"github.com/DARC0625/LIMEN/backend/internal/logger"
+	"github.com/DARC0625/LIMEN/backend/internal/mail"
 	"github.com/DARC0625/LIMEN/backend/internal/metrics"
 	"github.com/DARC0625/LIMEN/backend/internal/middleware"
 	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"github.com/DARC0625/LIMEN/backend/internal/oidc"
+	"github.com/DARC0625/LIMEN/backend/internal/osprofile"
+	"github.com/DARC0625/LIMEN/backend/internal/recording"
 	"github.com/DARC0625/LIMEN/backend/internal/security"
 	"github.com/DARC0625/LIMEN/backend/internal/session"
 	"github.com/DARC0625/LIMEN/backend/internal/validator"
 	"github.com/DARC0625/LIMEN/backend/internal/vm"
+	"github.com/DARC0625/LIMEN/backend/internal/webauthn"
+	"github.com/ProtonMail/go-crypto/openpgp"
 	"github.com/go-chi/chi/v5"
-	"github.com/golang-jwt/jwt/v5"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
 	"nhooyr.io/websocket"
@@ -48,7 +58,22 @@ type Handler struct {
 	VMService           *vm.VMService
 	VMStatusBroadcaster *VMStatusBroadcaster
 	Config              *config.Config
-	Cache               *cache.InMemoryCache // Cache for frequently accessed data
+	Cache               *cache.InMemoryCache      // Cache for frequently accessed data
+	Images              *images.Store             // ISO/disk image library (uploads, registration)
+	ImageFetcher        *images.Fetcher           // Background downloads from the image catalog
+	OSProfiles          *osprofile.Registry       // Per-OS creation defaults
+	ConsoleTickets      *auth.ConsoleTicketIssuer // Single-use VNC console tickets
+	Recordings          *recording.Store          // Console session recordings
+	VNCTLS              *tls.Config               // VeNCrypt client configuration for QEMU (nil = no TLS)
+	LoginGuard          *security.LoginGuard      // Brute-force protection of logins
+	MFA                 *auth.MFAManager          // TOTP second factor and which roles require it
+	WebAuthn            *webauthn.Manager         // Passkeys and security keys
+	OIDC                *oidc.Client              // Single sign-on with the team's identity provider
+	Authenticator       auth.Authenticator        // User directories checking password logins
+	Accounts            *auth.AccountManager      // Password changes and resets, email verification
+	Mail                mail.Sender               // Account mail (password reset and verification links)
+	APITokens           *auth.APITokenStore       // Personal access tokens
+	Roles               *auth.RoleStore           // Custom roles and the permissions of every role
 }
 
 func NewHandler(db *gorm.DB, vmService *vm.VMService, cfg *config.Config) *Handler {
@@ -59,22 +84,209 @@ func NewHandler(db *gorm.DB, vmService *vm.VMService, cfg *config.Config) *Handl
 	// 3 minutes for VM lists (balance between freshness and load reduction)
 	vmCache := cache.NewInMemoryCache(3 * time.Minute)
 
+	// The upload expiry loop is started (and stopped) by the server, once
+	imageStore := images.NewStore(db, cfg.ISODir,
+		int64(cfg.ImageUploadMaxGB)<<30,
+		int64(cfg.ImageUploadChunkMB)<<20,
+		time.Duration(cfg.ImageUploadTTLHours)*time.Hour)
+
+	profiles, err := osprofile.Load(cfg.OSProfilesPath)
+	if err != nil {
+		logger.Log.Error("Failed to load OS profiles, using built-in defaults",
+			zap.String("path", cfg.OSProfilesPath), zap.Error(err))
+		profiles = osprofile.Default()
+	}
+	if vmService != nil {
+		vmService.SetOSProfiles(profiles)
+		vmService.SetFirmwarePaths(vm.FirmwarePaths{
+			Code:           cfg.OVMFCodePath,
+			Vars:           cfg.OVMFVarsPath,
+			SecureBootCode: cfg.OVMFSecureBootCodePath,
+			SecureBootVars: cfg.OVMFSecureBootVarsPath,
+		})
+		vmService.StartSupervisor(globalAlerter{})
+	}
+
+	var keyring openpgp.EntityList
+	if cfg.ImageCatalogKeyring != "" {
+		var err error
+		if keyring, err = images.LoadKeyring(cfg.ImageCatalogKeyring); err != nil {
+			logger.Log.Warn("Failed to load image catalog keyring; signed catalog entries will fail verification",
+				zap.String("path", cfg.ImageCatalogKeyring), zap.Error(err))
+		}
+	}
+
+	var recordingKey []byte
+	if cfg.ConsoleRecordingKey != "" {
+		if recordingKey, err = crypto.DeriveKey([]byte(cfg.ConsoleRecordingKey), nil, []byte("limen-console-recording"), 32); err != nil {
+			// Never fall back to recording in the clear when encryption was asked for
+			logger.Log.Error("Failed to derive console recording key; console recording is disabled", zap.Error(err))
+			cfg.ConsoleRecording = "off"
+		}
+	}
+
+	// The retention loop is started (and stopped) by the server, once
+	recordings := recording.NewStore(db, cfg.ConsoleRecordingDir, recordingKey,
+		time.Duration(cfg.ConsoleRecordingRetentionDays)*24*time.Hour,
+		int64(cfg.ConsoleRecordingMaxMB)<<20)
+
+	session.GetSessionManager().SetDefaultLimits(session.Limits{
+		MaxIdle:         time.Duration(cfg.ConsoleSessionMaxIdleMinutes) * time.Minute,
+		MaxDuration:     time.Duration(cfg.ConsoleSessionMaxDurationMinutes) * time.Minute,
+		MaxConcurrent:   cfg.ConsoleSessionMaxConcurrent,
+		ReconnectWindow: time.Duration(cfg.ConsoleSessionReconnectWindowSeconds) * time.Second,
+	})
+
+	// Console tickets are HMAC-signed with a key derived from the JWT signing key: they
+	// are only ever verified by this server
+	ticketSecret := cfg.JWTSecret
+	if auth.KeysFor(cfg).Asymmetric() {
+		ticketSecret = cfg.JWTEd25519PrivateKey
+	}
+
+	var mfaKey []byte
+	mfaKeyOK := true
+	if cfg.MFAEncryptionKey != "" {
+		if mfaKey, err = crypto.DeriveKey([]byte(cfg.MFAEncryptionKey), nil, []byte("limen-mfa-secret"), 32); err != nil {
+			// Never fall back to storing TOTP secrets in the clear when encryption was asked for
+			logger.Log.Error("Failed to derive MFA encryption key; MFA enrollment is disabled", zap.Error(err))
+			mfaKeyOK = false
+		}
+	}
+	mfa := auth.NewMFAManager(db, cfg.MFAIssuer, ticketSecret, mfaKey)
+	if !mfaKeyOK {
+		mfa.DisableEnrollment()
+	}
+
+	vncTLS, err := vncTLSConfig(cfg)
+	if err != nil {
+		logger.Log.Error("Failed to load VNC TLS configuration; consoles of VMs requiring TLS will fail", zap.Error(err))
+	}
+
 	return &Handler{
 		DB:                  db,
 		VMService:           vmService,
 		VMStatusBroadcaster: broadcaster,
 		Config:              cfg,
 		Cache:               vmCache,
+		Images:              imageStore,
+		ImageFetcher:        images.NewFetcher(imageStore, cfg.ImageCatalogPath, keyring, nil),
+		OSProfiles:          profiles,
+		ConsoleTickets:      auth.NewConsoleTicketIssuer(ticketSecret, security.DefaultConsoleTokenPolicy()),
+		Recordings:          recordings,
+		VNCTLS:              vncTLS,
+		LoginGuard:          security.NewLoginGuard(db, security.DefaultUserSecurityPolicy(), globalAlerter{}),
+		MFA:                 mfa,
+		WebAuthn: webauthn.NewManager(db, webauthn.Config{
+			RPID:    cfg.WebAuthnRPID,
+			RPName:  cfg.WebAuthnRPName,
+			Origins: cfg.WebAuthnOrigins,
+		}, ticketSecret),
+		OIDC: oidc.NewClient(db, oidc.Config{
+			Issuer:        cfg.OIDCIssuer,
+			ClientID:      cfg.OIDCClientID,
+			ClientSecret:  cfg.OIDCClientSecret,
+			RedirectURL:   cfg.OIDCRedirectURL,
+			Scopes:        cfg.OIDCScopes,
+			UsernameClaim: cfg.OIDCUsernameClaim,
+			GroupsClaim:   cfg.OIDCGroupsClaim,
+			Mapping: auth.GroupMapping{
+				AdminGroups:    cfg.OIDCAdminGroups,
+				ApprovedGroups: cfg.OIDCApprovedGroups,
+				BetaGroups:     cfg.OIDCBetaGroups,
+			},
+			MFAValues: cfg.OIDCMFAValues,
+		}, ticketSecret),
+		Authenticator: passwordAuthenticator(db, cfg),
+		Accounts:      auth.NewAccountManager(db, ticketSecret),
+		Mail:          accountMailSender(cfg),
+		APITokens:     auth.NewAPITokenStore(db),
+		Roles:         auth.NewRoleStore(db),
+	}
+}
+
+// accountMailSender returns the sender of account mail cfg.MailSink selects.
+func accountMailSender(cfg *config.Config) mail.Sender {
+	switch cfg.MailSink {
+	case "smtp":
+		return mail.NewSMTPSender(cfg.AlertEmailSMTPHost, cfg.AlertEmailSMTPPort, cfg.AlertEmailSMTPUser, cfg.AlertEmailSMTPPass, cfg.MailFrom)
+	case "file":
+		return mail.NewFileSender(cfg.MailFile, cfg.MailFrom)
+	case "", "log":
+	default:
+		logger.Log.Error("Unknown mail sink; writing account mail to the log", zap.String("sink", cfg.MailSink))
+	}
+	return mail.NewLogSender(logger.Log)
+}
+
+// passwordAuthenticator returns the authenticator of the directories cfg.AuthBackends
+// lists, in order (default local). Misconfigured directories are left out; without any,
+// logins are checked against the users table.
+func passwordAuthenticator(db *gorm.DB, cfg *config.Config) auth.Authenticator {
+	backends := cfg.AuthBackends
+	if len(backends) == 0 {
+		backends = []string{"local"}
+	}
+	var chain auth.ChainAuthenticator
+	for _, backend := range backends {
+		switch backend {
+		case "local":
+			chain = append(chain, auth.NewLocalAuthenticator(db))
+		case "ldap":
+			directory, err := ldap.NewAuthenticator(db, ldap.Config{
+				URL:               cfg.LDAPURL,
+				StartTLS:          cfg.LDAPStartTLS,
+				CACertFile:        cfg.LDAPCACert,
+				BindDN:            cfg.LDAPBindDN,
+				BindPassword:      cfg.LDAPBindPassword,
+				BaseDN:            cfg.LDAPBaseDN,
+				UserFilter:        cfg.LDAPUserFilter,
+				UsernameAttribute: cfg.LDAPUsernameAttribute,
+				EmailAttribute:    cfg.LDAPEmailAttribute,
+				GroupAttribute:    cfg.LDAPGroupAttribute,
+				Mapping: auth.GroupMapping{
+					AdminGroups:    cfg.LDAPAdminGroups,
+					ApprovedGroups: cfg.LDAPApprovedGroups,
+					BetaGroups:     cfg.LDAPBetaGroups,
+				},
+			})
+			if err != nil {
+				logger.Log.Error("Invalid LDAP configuration; LDAP logins are disabled", zap.Error(err))
+				continue
+			}
+			chain = append(chain, directory)
+		default:
+			logger.Log.Error("Unknown authentication backend", zap.String("backend", backend))
+		}
+	}
+	if len(chain) == 0 {
+		logger.Log.Error("No usable authentication backend; checking logins against local users")
+		chain = append(chain, auth.NewLocalAuthenticator(db))
 	}
+	return chain
+}
+
+// globalAlerter forwards alerts to the alert manager the server sets up for the
+// middleware, whenever that happens.
+type globalAlerter struct{}
+
+func (globalAlerter) SendAlert(ctx context.Context, title, message, severity, service, component string, metadata map[string]interface{}, tags []string) error {
+	manager := middleware.GetAlertManager()
+	if manager == nil {
+		return nil
+	}
+	return manager.SendAlert(ctx, title, message, severity, service, component, metadata, tags)
 }
 
 // HandleHealth handles health check endpoint
 // @Summary Health check
-// @Description Returns the health status of the backend service including database and libvirt connections
+// @Description Returns the health status of the backend service including database and libvirt connections.
+// @Description libvirt is the default host's connection: connected, reconnecting or disconnected;
+// @Description libvirt_hosts counts the hosts whose connection is up.
 // @Tags system
 // @Accept json
 // @Produce json
-// @Success 200 {object} map[string]string "Service health status" example({"status":"ok","db":"connected","libvirt":"connected","time":"2025-12-29T23:15:32+09:00"})
+// @Success 200 {object} map[string]string "Service health status" example({"status":"ok","db":"connected","libvirt":"connected","libvirt_hosts":"2/2 connected","time":"2025-12-29T23:15:32+09:00"})
 // @Router /health [get]
 func (h *Handler) HandleHealth(w http.ResponseWriter, r *http.Request) {
 	dbStatus := "connected"
@@ -83,26 +295,36 @@ func (h *Handler) HandleHealth(w http.ResponseWriter, r *http.Request) {
 		dbStatus = "disconnected"
 	}
 
+	// Host details (addresses, errors) are only shown to admins, on GET /api/admin/hosts
 	libvirtStatus := "disconnected"
+	var total, connected int
 	if h.VMService != nil {
-		// Try to check if libvirt connection is alive
-		if h.VMService.IsAlive() {
+		defaultConn := h.VMService.Hosts().Connection(0)
+		switch {
+		case defaultConn.Connected:
 			libvirtStatus = "connected"
-		} else {
-			// If connection is dead, try to reconnect
-			// This is a best-effort check, don't fail the health check if reconnect fails
-			logger.Log.Debug("Libvirt connection appears dead, attempting to verify")
-			// Just report as disconnected, don't try to reconnect here (that should be handled elsewhere)
+		case defaultConn.DownSince != nil:
+			// The supervisor is reconnecting; operations fail fast meanwhile
+			libvirtStatus = "reconnecting"
+		}
+		var hostIDs []uint
+		h.DB.Model(&models.Host{}).Pluck("id", &hostIDs)
+		for _, id := range hostIDs {
+			total++
+			if h.VMService.Hosts().Connection(id).Connected {
+				connected++
+			}
 		}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	// Use direct encoding for simple responses (no pooling needed for small responses)
 	if err := json.NewEncoder(w).Encode(map[string]string{
-		"status":  "ok",
-		"time":    time.Now().Format(time.RFC3339),
-		"db":      dbStatus,
-		"libvirt": libvirtStatus,
+		"status":        "ok",
+		"time":          time.Now().Format(time.RFC3339),
+		"db":            dbStatus,
+		"libvirt":       libvirtStatus,
+		"libvirt_hosts": fmt.Sprintf("%d/%d connected", connected, total),
 	}); err != nil {
 		logger.Log.Error("failed to encode response", zap.Error(err))
 		http.Error(w, "internal server error", http.StatusInternalServerError)
@@ -111,12 +333,30 @@ func (h *Handler) HandleHealth(w http.ResponseWriter, r *http.Request) {
 }
 
 type CreateVMRequest struct {
-	Name         string `json:"name" example:"my-vm" binding:"required"`           // VM name (unique)
-	CPU          int    `json:"cpu" example:"4" binding:"required,min=1"`          // Number of CPU cores (minimum 1, no maximum limit)
-	Memory       int    `json:"memory" example:"4096" binding:"required,min=1024"` // Memory in MB (minimum 1024MB/1GB)
-	OSType       string `json:"os_type" example:"ubuntu" binding:"required"`       // OS type (must exist in VMImage table)
-	GraphicsType string `json:"graphics_type,omitempty" example:"vnc"`             // Graphics type (vnc, spice, none). Auto-enabled for GUI OS if not specified.
-	VNCEnabled   *bool  `json:"vnc_enabled,omitempty" example:"true"`              // Enable VNC graphics. Auto-enabled for GUI OS if not specified.
+	Name         string `json:"name" example:"my-vm" binding:"required"`             // VM name (unique)
+	CPU          int    `json:"cpu,omitempty" example:"4"`                           // Number of CPU cores (0 = OS profile default)
+	Memory       int    `json:"memory,omitempty" example:"4096"`                     // Memory in MB (0 = OS profile default)
+	OSType       string `json:"os_type" example:"ubuntu-desktop" binding:"required"` // OS type (must match an OS profile, see GET /api/os-profiles)
+	GraphicsType string `json:"graphics_type,omitempty" example:"vnc"`               // Graphics type (vnc, spice, none). Defaults to the OS profile.
+	VNCEnabled   *bool  `json:"vnc_enabled,omitempty" example:"true"`                // Enable VNC graphics. Defaults to the OS profile; GUI profiles keep their console.
+	Firmware     string `json:"firmware,omitempty" example:"uefi"`                   // Boot firmware (bios, uefi, uefi-secureboot). Defaults to the OS profile.
+	TPM          *bool  `json:"tpm,omitempty" example:"false"`                       // Emulated TPM 2.0. Defaults to the OS profile.
+
+	// CPU model and topology (optional)
+	CPUModel string `json:"cpu_model,omitempty" example:"host-model"` // host-model (default), host-passthrough or a libvirt CPU model name
+	Sockets  int    `json:"sockets,omitempty" example:"1"`            // sockets*cores*threads must equal cpu
+	Cores    int    `json:"cores,omitempty" example:"4"`
+	Threads  int    `json:"threads,omitempty" example:"1"`
+
+	// Host placement (optional, subject to CPU_PLACEMENT_POLICY)
+	CPUPinning []vm.VCPUPin `json:"cpu_pinning,omitempty"`           // Pin vCPUs to host CPUs
+	NUMANode   *int         `json:"numa_node,omitempty" example:"0"` // Host NUMA node for memory and unpinned vCPUs
+
+	RecordConsole bool `json:"record_console,omitempty" example:"false"` // Record console sessions (CONSOLE_RECORDING=opt-in)
+
+	// Compute host placement (optional)
+	HostTags          []string `json:"host_tags,omitempty" example:"ssd"`           // Tags the host must carry
+	AntiAffinityGroup string   `json:"anti_affinity_group,omitempty" example:"web"` // VMs of a group are placed on different hosts
 }
 
 // HandleVMs handles VM list and creation
@@ -130,6 +370,7 @@ type CreateVMRequest struct {
 // @Success 201 {object} models.VM "VM created successfully (for POST)"
 // @Failure 400 {object} map[string]interface{} "Invalid request (invalid parameters, OS type not found, etc.)"
 // @Failure 401 {object} map[string]interface{} "Unauthorized - missing or invalid JWT token"
+// @Failure 409 {object} map[string]interface{} "No compute host can take the VM (capacity, tags or anti-affinity)"
 // @Failure 500 {object} map[string]interface{} "Internal server error"
 // @Security BearerAuth
 // @Router /vms [get]
@@ -251,6 +492,31 @@ func (h *Handler) HandleVMs(w http.ResponseWriter, r *http.Request, cfg *config.
 			return
 		}
 
+		// Resolve the OS profile; it supplies defaults for omitted sizing and the per-OS minimums
+		profile, ok := h.osProfiles().Get(req.OSType)
+		if !ok {
+			errors.WriteBadRequest(w, fmt.Sprintf("Invalid OS type: %s (valid: %s)", req.OSType, strings.Join(h.osProfiles().IDs(), ", ")), nil)
+			return
+		}
+		if req.CPU == 0 {
+			req.CPU = profile.DefaultCPU
+		}
+		if req.Memory == 0 {
+			req.Memory = profile.DefaultMemoryMB
+		}
+		firmware := profile.Firmware
+		if req.Firmware != "" {
+			firmware = osprofile.Firmware(req.Firmware)
+			if !firmware.IsValid() {
+				errors.WriteBadRequest(w, "Invalid firmware (valid: bios, uefi, uefi-secureboot)", nil)
+				return
+			}
+		}
+		tpm := profile.TPM
+		if req.TPM != nil {
+			tpm = *req.TPM
+		}
+
 		// E2E force spec (4C/4G) - only if E2E_MODE is enabled
 		forceE2E := featureflags.CheckE2EHeader(r.Header.Get("X-Limen-E2E"))
 
@@ -293,10 +559,6 @@ func (h *Handler) HandleVMs(w http.ResponseWriter, r *http.Request, cfg *config.
 			errors.WriteBadRequest(w, err.Error(), err)
 			return
 		}
-		if err := validator.ValidateOSType(req.OSType); err != nil {
-			errors.WriteBadRequest(w, err.Error(), err)
-			return
-		}
 
 		// 안전장치: 최소 리소스 강제 (재발 방지)
 		// vcpu < 2 이면 2로 올림
@@ -308,34 +570,40 @@ func (h *Handler) HandleVMs(w http.ResponseWriter, r *http.Request, cfg *config.
 			req.CPU = cfg.VMMinVCPU
 		}
 
-		// ISO/Windows 계열 VM인지 확인 (더 높은 메모리 요구사항)
-		// Windows, ISO 설치용 OS 타입 확인
-		isISOOrWindows := false
-		isoWindowsTypes := []string{"windows", "windows10", "windows11", "iso", "install"}
-		osTypeLower := strings.ToLower(req.OSType)
-		for _, isoType := range isoWindowsTypes {
-			if strings.Contains(osTypeLower, strings.ToLower(isoType)) {
-				isISOOrWindows = true
-				break
-			}
-		}
-
-		// memory_mb < 2048(리눅스) / < 4096(윈도우/ISO) 이면 올림
+		// memory_mb < max(전역 최소, OS 프로필 최소) 이면 올림
 		minMemory := cfg.VMMinMemMB
-		if isISOOrWindows {
-			minMemory = cfg.VMMinMemMBISO
+		if profile.MinMemoryMB > minMemory {
+			minMemory = profile.MinMemoryMB
 		}
 
 		if req.Memory < minMemory {
 			logger.Log.Info("VM memory clamped to minimum",
 				zap.String("vm_name", req.Name),
 				zap.String("os_type", req.OSType),
-				zap.Bool("is_iso_or_windows", isISOOrWindows),
 				zap.Int("requested_memory", req.Memory),
 				zap.Int("min_memory", minMemory))
 			req.Memory = minMemory
 		}
 
+		// CPU model, topology and placement
+		cpuConfig := vm.CPUConfig{
+			Model:    req.CPUModel,
+			Sockets:  req.Sockets,
+			Cores:    req.Cores,
+			Threads:  req.Threads,
+			Pinning:  req.CPUPinning,
+			NUMANode: req.NUMANode,
+		}.Normalize(req.CPU)
+		if cpuConfig.HasPlacement() && !h.canPlaceCPUs(r.Context()) {
+			errors.WriteForbidden(w, "CPU pinning and NUMA placement are not permitted")
+			return
+		}
+		// Placement pins the VM to the default host (see below), so validate against it
+		if err := cpuConfig.Validate(req.CPU, h.hostCPUInfo(0)); err != nil {
+			errors.WriteBadRequest(w, err.Error(), err)
+			return
+		}
+
 		// Get user ID from context (set by auth middleware)
 		userID, ok := middleware.GetUserID(r.Context())
 		if !ok {
@@ -343,12 +611,11 @@ func (h *Handler) HandleVMs(w http.ResponseWriter, r *http.Request, cfg *config.
 		}
 
 		// Check beta access (admin always has access)
-		role, _ := middleware.GetRole(r.Context())
-		if role != string(models.RoleAdmin) {
+		if !middleware.IsAdmin(r.Context()) {
 			// Check beta access from token
 			authHeader := r.Header.Get("Authorization")
 			if tokenString, err := auth.ExtractTokenFromHeader(authHeader); err == nil {
-				if claims, err := auth.ValidateToken(tokenString, h.Config.JWTSecret); err == nil {
+				if claims, err := auth.KeysFor(h.Config).ValidateToken(tokenString); err == nil {
 					if !claims.BetaAccess {
 						logger.Log.Warn("VM creation denied - beta access required",
 							zap.Uint("user_id", userID),
@@ -360,7 +627,7 @@ func (h *Handler) HandleVMs(w http.ResponseWriter, r *http.Request, cfg *config.
 					// Fallback: check database
 					var user models.User
 					if err := h.DB.Select("id", "beta_access", "role").Where("id = ?", userID).First(&user).Error; err == nil {
-						if user.Role != models.RoleAdmin && !user.BetaAccess {
+						if !h.Roles.HasPermission(string(user.Role), models.PermManageSystem) && !user.BetaAccess {
 							logger.Log.Warn("VM creation denied - beta access required",
 								zap.Uint("user_id", userID),
 								zap.String("vm_name", req.Name))
@@ -373,7 +640,7 @@ func (h *Handler) HandleVMs(w http.ResponseWriter, r *http.Request, cfg *config.
 				// Fallback: check database
 				var user models.User
 				if err := h.DB.Select("id", "beta_access", "role").Where("id = ?", userID).First(&user).Error; err == nil {
-					if user.Role != models.RoleAdmin && !user.BetaAccess {
+					if !h.Roles.HasPermission(string(user.Role), models.PermManageSystem) && !user.BetaAccess {
 						logger.Log.Warn("VM creation denied - beta access required",
 							zap.Uint("user_id", userID),
 							zap.String("vm_name", req.Name))
@@ -412,7 +679,7 @@ func (h *Handler) HandleVMs(w http.ResponseWriter, r *http.Request, cfg *config.
 		}
 
 		// Check user quota (total resources)
-		diskSize := 20 // Default disk size in GB
+		diskSize := profile.DefaultDiskGB
 		if err := userQuota.CheckUserQuota(h.DB, req.CPU, req.Memory, diskSize); err != nil {
 			if quotaErr, ok := err.(*models.QuotaError); ok {
 				logger.Log.Warn("User quota exceeded",
@@ -458,7 +725,45 @@ func (h *Handler) HandleVMs(w http.ResponseWriter, r *http.Request, cfg *config.
 			OwnerID:            userID,
 			InstallationStatus: models.InstallationStatusNotInstalled,
 			BootOrder:          models.BootOrderCDROMHD, // Default: CDROM 우선, HDD 다음
-			DiskSize:           20,                      // Default 20GB
+			DiskSize:           diskSize,
+			Firmware:           string(firmware),
+			TPM:                tpm,
+			RecordConsole:      req.RecordConsole,
+		}
+		setVMCPUConfig(&newVM, cpuConfig)
+
+		// Record which installation image the VM is created from so it can't be deleted while in use
+		if h.VMService != nil {
+			if image, err := h.VMService.LookupImage(req.OSType, userID); err == nil {
+				newVM.ImageID = &image.ID
+			}
+		}
+
+		// Choose the compute host
+		if h.VMService != nil {
+			placement := vm.PlacementRequest{
+				VCPU:              req.CPU,
+				MemoryMB:          req.Memory,
+				Tags:              req.HostTags,
+				AntiAffinityGroup: req.AntiAffinityGroup,
+				SharedStorage:     true, // The disk is created on this server
+			}
+			if cpuConfig.HasPlacement() {
+				// Pinning was validated against this server's CPUs
+				placement.HostID = h.VMService.Hosts().DefaultHostID()
+			}
+			host, err := h.VMService.PlaceVM(placement)
+			if err != nil {
+				if stderrors.Is(err, vm.ErrNoHostAvailable) {
+					errors.WriteError(w, http.StatusConflict, err.Error(), err)
+				} else {
+					errors.WriteInternalError(w, err, cfg.Env == "development")
+				}
+				return
+			}
+			newVM.HostID = host.ID
+			newVM.HostTags = strings.Join(req.HostTags, ",")
+			newVM.AntiAffinityGroup = req.AntiAffinityGroup
 		}
 
 		// Use transaction to ensure atomicity
@@ -510,38 +815,35 @@ func (h *Handler) HandleVMs(w http.ResponseWriter, r *http.Request, cfg *config.
 			return
 		}
 
-		// Determine VNC graphics settings
-		// GUI OS types that should have VNC enabled by default
-		guiOSTypes := []string{"ubuntu-desktop", "kali", "windows", "windows10", "windows11"}
-		isGUIOs := false
-		for _, guiType := range guiOSTypes {
-			if strings.Contains(strings.ToLower(req.OSType), strings.ToLower(guiType)) {
-				isGUIOs = true
-				break
-			}
-		}
-
-		// Determine if VNC should be enabled
-		enableVNC := false
-		if req.VNCEnabled != nil {
-			enableVNC = *req.VNCEnabled
-		} else if isGUIOs {
-			// Auto-enable VNC for GUI OS if not explicitly set
-			enableVNC = true
-			logger.Log.Info("Auto-enabling VNC for GUI OS", zap.String("os_type", req.OSType), zap.String("vm_name", req.Name))
-		}
-
-		// Determine graphics type
+		// Determine graphics type: explicit type, then the vnc_enabled toggle, then the profile default.
+		// A desktop OS is unusable without a console, so vnc_enabled=false doesn't turn it off.
 		graphicsType := req.GraphicsType
-		if graphicsType == "" {
-			if enableVNC {
+		if graphicsType == "" && req.VNCEnabled != nil {
+			switch {
+			case *req.VNCEnabled:
 				graphicsType = "vnc"
-			} else {
+			case profile.GUI:
+				logger.Log.Info("Keeping console enabled for GUI OS", zap.String("os_type", req.OSType), zap.String("vm_name", req.Name))
+			default:
 				graphicsType = "none"
 			}
 		}
 
-		if err := h.VMService.CreateVM(req.Name, req.Memory, req.CPU, req.OSType, newVM.UUID, graphicsType, enableVNC); err != nil {
+		spec := vm.CreateVMSpec{
+			Name:     req.Name,
+			UUID:     newVM.UUID,
+			OSType:   req.OSType,
+			VCPU:     req.CPU,
+			MemoryMB: req.Memory,
+			DiskGB:   diskSize,
+			Graphics: graphicsType,
+			HostID:   newVM.HostID,
+			OwnerID:  userID,
+			Firmware: firmware,
+			TPM:      &tpm,
+			CPU:      cpuConfig,
+		}
+		if err := h.VMService.CreateVM(spec); err != nil {
 			tx.Rollback()
 			logger.Log.Error("Failed to create VM in libvirt", zap.Error(err), zap.String("vm_name", req.Name), zap.String("uuid", newVM.UUID))
 			// Audit log: VM creation failure
@@ -662,6 +964,17 @@ type VMActionRequest struct {
 	Action string `json:"action" example:"start"`          // Valid actions: start, stop, delete, update
 	CPU    int    `json:"cpu,omitempty" example:"4"`       // Required for update action
 	Memory int    `json:"memory,omitempty" example:"4096"` // Required for update action (in MB)
+
+	// Optional CPU changes for update. Omitted fields keep the current value;
+	// topology is recomputed when only cpu changes.
+	CPUModel   string       `json:"cpu_model,omitempty" example:"host-passthrough"`
+	Sockets    int          `json:"sockets,omitempty" example:"1"`
+	Cores      int          `json:"cores,omitempty" example:"4"`
+	Threads    int          `json:"threads,omitempty" example:"1"`
+	CPUPinning []vm.VCPUPin `json:"cpu_pinning,omitempty"`           // [] clears pinning
+	NUMANode   *int         `json:"numa_node,omitempty" example:"0"` // -1 clears NUMA placement
+
+	RecordConsole *bool `json:"record_console,omitempty" example:"true"` // Opt in to console recording; omitted keeps the current setting
 }
 
 // HandleVMAction handles VM actions (start, stop, delete, update)
@@ -674,6 +987,7 @@ type VMActionRequest struct {
 // @Param request body VMActionRequest true "Action request"
 // @Success 200 {object} map[string]interface{} "Action completed successfully"
 // @Failure 400 {object} map[string]interface{} "Invalid request"
+// @Failure 403 {object} map[string]interface{} "Not the owner, and the role doesn't allow the action on any VM"
 // @Failure 404 {object} map[string]interface{} "VM not found"
 // @Failure 500 {object} map[string]interface{} "Internal server error"
 // @Security BearerAuth
@@ -715,6 +1029,19 @@ func (h *Handler) HandleVMAction(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Owners act on their VMs. Others need a role controlling every VM (admins,
+	// operators) to start or stop one, and must be admins to update or delete it.
+	if vmRec.OwnerID != userID {
+		allowed := middleware.IsAdmin(r.Context())
+		if action == models.VMActionStart || action == models.VMActionStop {
+			allowed = middleware.HasPermission(r.Context(), models.PermVMControlAll)
+		}
+		if !allowed {
+			errors.WriteForbidden(w, "You don't have permission to control this VM")
+			return
+		}
+	}
+
 	// Check if VMService is available for actions that require it
 	if h.VMService == nil && (action == models.VMActionStart || action == models.VMActionStop) {
 		errors.WriteInternalError(w, fmt.Errorf("VM service is not available"), h.Config.Env == "development")
@@ -758,7 +1085,7 @@ func (h *Handler) HandleVMAction(w http.ResponseWriter, r *http.Request) {
 
 		if err := h.VMService.StartVM(vmRec.Name); err != nil {
 			// Check if error is "VM not found" - this means VM exists in DB but not in libvirt
-			if strings.Contains(err.Error(), "Domain not found") || strings.Contains(err.Error(), "VM not found") {
+			if !vm.IsConnectionError(err) && (strings.Contains(err.Error(), "Domain not found") || strings.Contains(err.Error(), "VM not found")) {
 				logger.Log.Warn("VM not found in libvirt, marking as stopped in DB",
 					zap.String("vm_name", vmRec.Name),
 					zap.Error(err))
@@ -929,9 +1256,50 @@ func (h *Handler) HandleVMAction(w http.ResponseWriter, r *http.Request) {
 			errors.WriteBadRequest(w, err.Error(), err)
 			return
 		}
+		// Resolve CPU configuration: current settings overlaid with the request
+		cpuConfig := cpuConfigFromVM(&vmRec)
+		cpuRequested := req.CPUModel != "" || req.Sockets > 0 || req.Cores > 0 || req.Threads > 0 ||
+			req.CPUPinning != nil || req.NUMANode != nil
+		if req.CPUPinning != nil || req.NUMANode != nil {
+			if !h.canPlaceCPUs(r.Context()) {
+				errors.WriteForbidden(w, "CPU pinning and NUMA placement are not permitted")
+				return
+			}
+		}
+		if req.CPUModel != "" {
+			cpuConfig.Model = req.CPUModel
+		}
+		if req.Sockets > 0 || req.Cores > 0 || req.Threads > 0 {
+			cpuConfig.Sockets, cpuConfig.Cores, cpuConfig.Threads = req.Sockets, req.Cores, req.Threads
+		} else if req.CPU != vmRec.CPU && cpuConfig.HasTopology() {
+			cpuConfig.Cores = 0 // keep sockets/threads, recompute cores
+		}
+		if req.CPUPinning != nil {
+			cpuConfig.Pinning = req.CPUPinning
+		}
+		if req.NUMANode != nil {
+			cpuConfig.NUMANode = req.NUMANode
+			if *req.NUMANode < 0 {
+				cpuConfig.NUMANode = nil
+			}
+		}
+		cpuConfig = cpuConfig.Normalize(req.CPU)
+		cpuChanged := cpuRequested || (req.CPU != vmRec.CPU && (cpuConfig.HasTopology() || cpuConfig.HasPlacement()))
+		if cpuChanged {
+			if err := cpuConfig.Validate(req.CPU, h.hostCPUInfo(vmRec.HostID)); err != nil {
+				errors.WriteBadRequest(w, err.Error(), err)
+				return
+			}
+		}
+
 		// Update CPU and Memory in DB first (always update DB, even if libvirt update fails)
+		oldCPUConfig := cpuConfigFromVM(&vmRec)
 		vmRec.CPU = req.CPU
 		vmRec.Memory = req.Memory
+		setVMCPUConfig(&vmRec, cpuConfig)
+		if req.RecordConsole != nil {
+			vmRec.RecordConsole = *req.RecordConsole
+		}
 
 		// Try to update libvirt configuration
 		if err := h.VMService.UpdateVM(vmRec.Name, req.Memory, req.CPU); err != nil {
@@ -957,6 +1325,16 @@ func (h *Handler) HandleVMAction(w http.ResponseWriter, r *http.Request) {
 		} else {
 			logger.Log.Info("VM updated in libvirt", zap.String("vm_name", vmRec.Name), zap.Int("cpu", req.CPU), zap.Int("memory", req.Memory))
 		}
+		if cpuChanged {
+			if err := h.VMService.UpdateVMCPU(vmRec.Name, req.CPU, cpuConfig); err != nil {
+				// Unlike the vCPU count, the CPU model and placement are only recorded once the
+				// domain has them, so the record never claims a pinning that isn't in effect
+				logger.Log.Warn("Failed to apply CPU configuration in libvirt, keeping the previous one",
+					zap.String("vm_name", vmRec.Name),
+					zap.Error(err))
+				setVMCPUConfig(&vmRec, oldCPUConfig)
+			}
+		}
 
 		actionSuccess = true
 		logger.Log.Info("VM updated (DB)", zap.String("vm_name", vmRec.Name), zap.Int("cpu", req.CPU), zap.Int("memory", req.Memory))
@@ -1003,12 +1381,15 @@ func (h *Handler) HandleVMAction(w http.ResponseWriter, r *http.Request) {
 
 // HandleVMConsole handles GET /api/vms/{uuid}/console - Get WebSocket URL for VM console
 // @Summary Get WebSocket URL for VM console
-// @Description Returns a WebSocket URL with a short-lived JWT token for connecting to the VM's VNC console
+// @Description Returns a WebSocket URL with a single-use console ticket for connecting to the VM's VNC, SPICE or serial console.
+// @Description The ticket is bound to the VM, the user and the client IP and expires after 5 minutes.
+// @Description Without a protocol parameter, the VM's graphics type decides; the response's protocol field tells the client which viewer to use.
 // @Tags vms
 // @Accept json
 // @Produce json
 // @Param uuid path string true "VM UUID" format(uuid)
-// @Success 200 {object} map[string]interface{} "Console URL with token"
+// @Param protocol query string false "Console protocol: vnc, spice or serial (default: the VM's graphics type)"
+// @Success 200 {object} map[string]interface{} "Console URL with ticket"
 // @Failure 400 {object} map[string]interface{} "Invalid request"
 // @Failure 401 {object} map[string]interface{} "Unauthorized"
 // @Failure 403 {object} map[string]interface{} "Forbidden - no access to VM"
@@ -1023,9 +1404,6 @@ func (h *Handler) HandleVMConsole(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get role from context
-	role, _ := middleware.GetRole(r.Context())
-
 	// Get VM UUID from URL path variable
 	uuidStr := chi.URLParam(r, "uuid")
 	if uuidStr == "" {
@@ -1033,6 +1411,16 @@ func (h *Handler) HandleVMConsole(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Console protocol: vnc or spice (graphical) or serial (text console for headless VMs).
+	// Empty picks the protocol of the VM's graphics device.
+	protocol := r.URL.Query().Get("protocol")
+	switch protocol {
+	case "", "vnc", "spice", "serial":
+	default:
+		errors.WriteBadRequest(w, "protocol must be vnc, spice or serial", nil)
+		return
+	}
+
 	// Find VM by UUID
 	var vmRec models.VM
 	if err := h.DB.Where("uuid = ?", uuidStr).First(&vmRec).Error; err != nil {
@@ -1045,62 +1433,23 @@ func (h *Handler) HandleVMConsole(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check ownership (user must own the VM or be admin)
-	if vmRec.OwnerID != userID && role != string(models.RoleAdmin) {
+	// Check ownership (user must own the VM or open every VM's console)
+	if vmRec.OwnerID != userID && !middleware.HasPermission(r.Context(), models.PermVMConsoleAll) {
 		errors.WriteForbidden(w, "You don't have permission to access this VM's console")
 		return
 	}
 
-	// Get username from context for token generation
-	username, _ := middleware.GetUsername(r.Context())
-	if username == "" {
-		// Fallback: query from database
-		var user models.User
-		if err := h.DB.Select("username").Where("id = ?", userID).First(&user).Error; err == nil {
-			username = user.Username
-		} else {
-			username = "unknown"
-		}
+	if protocol == "" {
+		protocol = h.defaultConsoleProtocol(vmRec.Name)
 	}
 
-	// Generate console token using standardized policy
-	policy := security.DefaultConsoleTokenPolicy()
-
-	// Get user info for token generation
-	var user models.User
-	if err := h.DB.Select("beta_access", "role", "approved").Where("id = ?", userID).First(&user).Error; err == nil {
-		// User found, use actual beta access and approval status
-	} else {
-		// Fallback: assume no beta access if user not found
-		user.BetaAccess = false
-		user.Approved = false
-		user.Role = models.RoleUser
-	}
-
-	// Create token with policy-defined TTL and claims
-	expirationTime := time.Now().Add(policy.TTL)
-	claims := &auth.Claims{
-		UserID:     userID,
-		Username:   username,
-		Role:       string(user.Role), // Convert UserRole to string
-		Approved:   user.Approved,
-		BetaAccess: user.BetaAccess,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			Issuer:    policy.Issuer,
-			Audience:  []string{policy.Audience},
-		},
-	}
-	// Add UUID binding if required by policy
-	if policy.RequireUUIDBinding {
-		claims.RegisteredClaims.Subject = uuidStr // Use Subject claim for UUID binding
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	consoleToken, err := token.SignedString([]byte(h.Config.JWTSecret))
+	// Mint a single-use ticket bound to this VM, user and client IP
+	ticketUser := h.consoleTicketUser(r, userID)
+	username := ticketUser.Username
+	clientIP := h.clientIP(r)
+	consoleToken, expirationTime, err := h.ConsoleTickets.Issue(ticketUser, uuidStr, clientIP)
 	if err != nil {
-		logger.Log.Error("Failed to sign console token", zap.Error(err))
+		logger.Log.Error("Failed to issue console ticket", zap.Error(err))
 		errors.WriteInternalError(w, err, h.Config.Env == "development")
 		return
 	}
@@ -1108,13 +1457,19 @@ func (h *Handler) HandleVMConsole(w http.ResponseWriter, r *http.Request) {
 	// Build WebSocket URL using external base (X-Forwarded-* headers)
 	wsScheme, host := externalWSBase(r, "limen.kr")
 	wsURL := fmt.Sprintf("%s://%s/vnc/%s?token=%s", wsScheme, host, uuidStr, consoleToken)
+	switch protocol {
+	case "serial":
+		wsURL = fmt.Sprintf("%s://%s/ws/serial/%s?token=%s", wsScheme, host, uuidStr, consoleToken)
+	case "spice":
+		wsURL = fmt.Sprintf("%s://%s/ws/spice/%s?token=%s", wsScheme, host, uuidStr, consoleToken)
+	}
 
 	// Return response
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	if err := json.NewEncoder(w).Encode(map[string]interface{}{
 		"ws_url":     wsURL,
-		"protocol":   "vnc",
+		"protocol":   protocol,
 		"expires_at": expirationTime.Format(time.RFC3339),
 	}); err != nil {
 		logger.Log.Error("failed to encode response", zap.Error(err))
@@ -1123,9 +1478,10 @@ func (h *Handler) HandleVMConsole(w http.ResponseWriter, r *http.Request) {
 
 	logger.Log.Info("Console URL issued",
 		zap.String("vm_uuid", uuidStr),
+		zap.String("protocol", protocol),
 		zap.Uint("user_id", userID),
 		zap.String("username", username),
-		zap.String("ws_url", wsURL),
+		zap.String("client_ip", clientIP),
 		zap.String("ws_scheme", wsScheme),
 		zap.String("host", host),
 		zap.String("x_forwarded_proto", r.Header.Get("X-Forwarded-Proto")),
@@ -1133,6 +1489,24 @@ func (h *Handler) HandleVMConsole(w http.ResponseWriter, r *http.Request) {
 		zap.Time("expires_at", expirationTime))
 }
 
+// defaultConsoleProtocol returns the console protocol for a VM's graphics device:
+// vnc or spice, serial for VMs without graphics, and vnc if it can't be determined.
+func (h *Handler) defaultConsoleProtocol(vmName string) string {
+	if h.VMService == nil {
+		return "vnc"
+	}
+	protocol, err := h.VMService.GetConsoleProtocol(vmName)
+	if err != nil {
+		logger.Log.Debug("Failed to determine console protocol, defaulting to vnc",
+			zap.String("vm_name", vmName), zap.Error(err))
+		return "vnc"
+	}
+	if protocol == "" {
+		return "serial"
+	}
+	return protocol
+}
+
 // externalWSBase determines the external WebSocket base URL from request headers.
 // It prioritizes X-Forwarded-* headers (for Envoy/proxy scenarios) over direct request info.
 // Returns: (wsScheme, host)
@@ -1198,9 +1572,6 @@ func (h *Handler) HandleVMDelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get role from context
-	role, _ := middleware.GetRole(r.Context())
-
 	// Find VM by UUID
 	var vmRec models.VM
 	if err := h.DB.Where("uuid = ?", uuidStr).First(&vmRec).Error; err != nil {
@@ -1213,8 +1584,8 @@ func (h *Handler) HandleVMDelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check ownership (user must own the VM or be admin)
-	if vmRec.OwnerID != userID && role != string(models.RoleAdmin) {
+	// Check ownership (user must own the VM or delete every VM)
+	if vmRec.OwnerID != userID && !middleware.HasPermission(r.Context(), models.PermVMDeleteAll) {
 		errors.WriteForbidden(w, "You don't have permission to delete this VM")
 		return
 	}
@@ -1473,16 +1844,17 @@ func (h *Handler) isOriginAllowed(origin string) bool {
 
 // HandleVNC handles VNC WebSocket connections
 // @Summary Connect to VM via VNC
-// @Description Establish a WebSocket connection to VM's VNC console. Requires VM UUID and JWT token as query parameters.
+// @Description Establish a WebSocket connection to VM's VNC console. Requires VM UUID and a console ticket as query parameters.
+// @Description Rejected tickets close the WebSocket with status 1008 and the TokenErrorCode (e.g. TOKEN_REPLAYED) as the reason.
 // @Description The connection will proxy VNC protocol data between the WebSocket client and the VM's VNC server.
 // @Tags vms
 // @Accept json
 // @Produce json
 // @Param id query string true "VM UUID" format(uuid) example(12345678-1234-1234-1234-123456789abc)
-// @Param token query string true "JWT authentication token" example(eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9...)
+// @Param token query string true "Single-use console ticket from GET /vms/{uuid}/console" example(eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9...)
 // @Success 101 "Switching Protocols" "WebSocket connection established"
 // @Failure 400 {object} map[string]interface{} "Invalid request (missing parameters, invalid UUID format)"
-// @Failure 401 {object} map[string]interface{} "Unauthorized - invalid or missing token"
+// @Failure 401 {object} map[string]interface{} "Unauthorized - missing, invalid, expired, replayed or mis-bound ticket"
 // @Failure 403 {object} map[string]interface{} "Forbidden - account not approved"
 // @Failure 404 {object} map[string]interface{} "VM not found"
 // @Failure 500 {object} map[string]interface{} "Internal server error (VM not running, VNC port not available)"
@@ -1532,11 +1904,15 @@ func (h *Handler) HandleVNC(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// SECURITY: Token is REQUIRED for VNC WebSocket connections
+	// Get VM UUID from query parameter, path parameter, or URL path
+	uuidStr := consoleVMUUID(r)
+
+	// SECURITY: A console ticket from HandleVMConsole is REQUIRED for VNC WebSocket connections.
+	// Ordinary access tokens are rejected; each ticket opens one connection to one VM from one client IP.
 	// Exception: X-Limen-E2E: 1 header allows token-less connection for testing (only if E2E_MODE enabled)
 	forceE2E := featureflags.CheckE2EHeader(r.Header.Get("X-Limen-E2E"))
 
-	// Get token from query parameter or Authorization header
+	// Get ticket from query parameter or Authorization header
 	token := r.URL.Query().Get("token")
 	if token == "" {
 		authHeader := r.Header.Get("Authorization")
@@ -1545,59 +1921,36 @@ func (h *Handler) HandleVNC(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Validate token (unless E2E test mode)
+	// Redeem ticket (unless E2E test mode)
 	var claims *auth.Claims
-	var tokenErr error
+	var shareID string // Set when the ticket joins a shared session
 	tokenPresent := token != ""
 
-	if tokenPresent {
-		claims, tokenErr = auth.ValidateToken(token, h.Config.JWTSecret)
-		if tokenErr != nil {
-			// Invalid token - log and reject
+	if tokenPresent || !forceE2E {
+		ticket, tokErr := h.redeemConsoleTicket(token, uuidStr, h.clientIP(r))
+		if tokErr != nil {
 			userAgent := r.Header.Get("User-Agent")
 			uaFamily := extractUAFamily(userAgent)
-			metrics.WebSocketUpgradeFailTotal.WithLabelValues("invalid_token", uaFamily).Inc()
+			metrics.WebSocketUpgradeFailTotal.WithLabelValues(strings.ToLower(string(tokErr.Code)), uaFamily).Inc()
 
-			logger.Log.Warn("VNC connection attempt with invalid token",
+			logger.Log.Warn("VNC connection attempt with rejected console ticket",
 				zap.String("remote_addr", r.RemoteAddr),
+				zap.String("client_ip", h.clientIP(r)),
 				zap.String("user_agent", userAgent),
 				zap.String("ua_family", uaFamily),
-				zap.Error(tokenErr))
-
-			// For WebSocket, close with policy violation
-			if isWebSocketRequest {
-				w.Header().Set("Upgrade", "websocket")
-				w.Header().Set("Connection", "Upgrade")
-				w.WriteHeader(http.StatusUnauthorized)
-				w.Write([]byte("Invalid authentication token"))
-				return
-			}
-			http.Error(w, `{"type":"error","error":"Invalid authentication token","code":"INVALID_TOKEN"}`, http.StatusUnauthorized)
-			return
-		}
-	} else if !forceE2E {
-		// Missing token and not E2E test mode - reject
-		userAgent := r.Header.Get("User-Agent")
-		uaFamily := extractUAFamily(userAgent)
-		metrics.WebSocketUpgradeFailTotal.WithLabelValues("missing_token", uaFamily).Inc()
+				zap.String("path", r.URL.Path),
+				zap.String("vm_uuid", uuidStr),
+				zap.String("code", string(tokErr.Code)),
+				zap.Error(tokErr))
 
-		logger.Log.Warn("VNC connection attempt without token",
-			zap.String("remote_addr", r.RemoteAddr),
-			zap.String("user_agent", userAgent),
-			zap.String("ua_family", uaFamily),
-			zap.String("path", r.URL.Path),
-			zap.Bool("e2e_header", forceE2E))
-
-		// For WebSocket, close with policy violation (1008)
-		if isWebSocketRequest {
-			w.Header().Set("Upgrade", "websocket")
-			w.Header().Set("Connection", "Upgrade")
-			w.WriteHeader(http.StatusUnauthorized)
-			w.Write([]byte("Authentication token required"))
+			h.rejectConsole(w, r, http.StatusUnauthorized, tokErr)
 			return
 		}
-		http.Error(w, `{"type":"error","error":"Authentication token required","code":"AUTH_REQUIRED"}`, http.StatusUnauthorized)
-		return
+		claims = &ticket.Claims
+		shareID = ticket.ShareID
+		if uuidStr == "" {
+			uuidStr = ticket.Subject
+		}
 	}
 
 	// If E2E mode without token, create dummy claims for testing
@@ -1626,12 +1979,12 @@ func (h *Handler) HandleVNC(w http.ResponseWriter, r *http.Request) {
 		role = claims.Role
 		betaAccess = claims.BetaAccess
 
-		if role != string(models.RoleAdmin) && !betaAccess {
+		if !h.Roles.HasPermission(role, models.PermManageSystem) && !betaAccess {
 			// Fallback: check database
 			if userID > 0 {
 				var user models.User
 				if err := h.DB.Select("id", "beta_access", "role").Where("id = ?", userID).First(&user).Error; err == nil {
-					if user.Role != models.RoleAdmin && !user.BetaAccess {
+					if !h.Roles.HasPermission(string(user.Role), models.PermManageSystem) && !user.BetaAccess {
 						logger.Log.Warn("VNC console access denied - beta access required",
 							zap.Uint("user_id", userID),
 							zap.String("username", username))
@@ -1665,11 +2018,12 @@ func (h *Handler) HandleVNC(w http.ResponseWriter, r *http.Request) {
 
 	// Check if user is approved (skip for E2E mode)
 	if claims != nil && !forceE2E {
-		if !claims.Approved && claims.Role != "admin" {
+		if !claims.Approved && !h.Roles.HasPermission(claims.Role, models.PermManageSystem) {
 			logger.Log.Warn("VNC connection attempt by unapproved user",
 				zap.Uint("user_id", claims.UserID),
 				zap.String("username", claims.Username))
-			http.Error(w, "Account pending approval", http.StatusForbidden)
+			h.rejectConsole(w, r, http.StatusForbidden,
+				security.NewTokenError(security.TokenErrorNotApproved, "Account pending approval"))
 			return
 		}
 	}
@@ -1800,23 +2154,6 @@ func (h *Handler) HandleVNC(w http.ResponseWriter, r *http.Request) {
 		zap.Uint("user_id", claims.UserID),
 		zap.String("username", claims.Username))
 
-	// Get VM UUID from query parameter, path parameter, or URL path
-	uuidStr := r.URL.Query().Get("id")
-	if uuidStr == "" {
-		uuidStr = r.URL.Query().Get("uuid")
-	}
-	if uuidStr == "" {
-		// Try to extract from path (e.g., /vnc/{uuid})
-		pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
-		if len(pathParts) >= 2 && pathParts[0] == "vnc" {
-			uuidStr = pathParts[1]
-		}
-		// Also try chi URL parameter if available
-		if uuidStr == "" {
-			uuidStr = chi.URLParam(r, "uuid")
-		}
-	}
-
 	if uuidStr == "" {
 		logger.Log.Warn("VNC connection attempt without VM UUID",
 			zap.Uint("user_id", claims.UserID),
@@ -1992,7 +2329,16 @@ func (h *Handler) HandleVNC(w http.ResponseWriter, r *http.Request) {
 	defer connectCancel() // Ensure context is cancelled to prevent resource leak
 	ws.Write(connectCtx, websocket.MessageText, []byte(fmt.Sprintf(`{"type":"status","message":"Connecting to VNC server on port %s..."}`, vncPort)))
 
-	targetAddr := fmt.Sprintf("localhost:%s", vncPort)
+	consoleAddr, remoteConsole, err := h.VMService.ConsoleDialAddress(vmRec.Name)
+	if err != nil {
+		logger.Log.Error("VNC server of the VM's host is not reachable",
+			zap.Error(err),
+			zap.String("vm_name", vmRec.Name),
+			zap.Uint("host_id", vmRec.HostID))
+		ws.Write(connectCtx, websocket.MessageText, []byte(`{"type":"error","error":"The console of this VM's host is not reachable","code":"CONSOLE_UNREACHABLE"}`))
+		return
+	}
+	targetAddr := net.JoinHostPort(consoleAddr, vncPort)
 
 	// Try to connect to VNC server with timeout and retry
 	var conn net.Conn
@@ -2059,47 +2405,128 @@ func (h *Handler) HandleVNC(w http.ResponseWriter, r *http.Request) {
 	// Create console session
 	sessionMgr := session.GetSessionManager()
 
-	// Check reconnect limit
-	if err := sessionMgr.CheckReconnectLimit(claims.UserID); err != nil {
-		logger.Log.Warn("Reconnect limit exceeded",
-			zap.Uint("user_id", claims.UserID),
-			zap.String("username", claims.Username),
-			zap.Error(err))
-		ws.Write(successCtx, websocket.MessageText, []byte(fmt.Sprintf(`{"type":"error","error":"%s","code":"RECONNECT_LIMIT_EXCEEDED"}`, err.Error())))
-		return
+	var sessionID string
+	var sessCtx context.Context
+	var rec *recording.Recorder
+	var clientFilter *rfbClientFilter
+	if shareID != "" {
+		// Joining another user's session through a share: no new session, no recording
+		part, err := sessionMgr.Join(shareID, claims.UserID, claims.Username, h.clientIP(r))
+		if err != nil {
+			logger.Log.Warn("Failed to join shared console session",
+				zap.Uint("user_id", claims.UserID),
+				zap.String("share_id", shareID),
+				zap.Error(err))
+			ws.Write(successCtx, websocket.MessageText, []byte(fmt.Sprintf(`{"type":"error","error":"%s","code":"SHARE_UNAVAILABLE"}`, err.Error())))
+			ws.Close(websocket.StatusPolicyViolation, "SHARE_UNAVAILABLE")
+			return
+		}
+		sessionID, sessCtx = part.SessionID, part.Context()
+		clientFilter = &rfbClientFilter{viewOnly: part.Mode == session.ShareModeView}
+		audit.LogConsoleParticipantJoin(r.Context(), claims.UserID, sessionID, part.ID, string(part.Mode))
+		defer func() {
+			sessionMgr.Leave(sessionID, part.ID)
+			audit.LogConsoleParticipantLeave(r.Context(), claims.UserID, sessionID, part.ID)
+		}()
+		ws.Write(successCtx, websocket.MessageText, []byte(fmt.Sprintf(`{"type":"session","session_id":"%s","participant_id":"%s","mode":"%s"}`, sessionID, part.ID, part.Mode)))
+	} else {
+		// Check reconnect limit
+		if err := sessionMgr.CheckReconnectLimit(claims.UserID); err != nil {
+			logger.Log.Warn("Reconnect limit exceeded",
+				zap.Uint("user_id", claims.UserID),
+				zap.String("username", claims.Username),
+				zap.Error(err))
+			ws.Write(successCtx, websocket.MessageText, []byte(fmt.Sprintf(`{"type":"error","error":"%s","code":"RECONNECT_LIMIT_EXCEEDED"}`, err.Error())))
+			return
+		}
+
+		sessionID, err = sessionMgr.CreateSession(claims.UserID, vmRec.ID, vmRec.UUID, "vnc", h.clientIP(r), r.UserAgent())
+		if err != nil {
+			logger.Log.Warn("Failed to create console session",
+				zap.Uint("user_id", claims.UserID),
+				zap.String("username", claims.Username),
+				zap.Error(err))
+			ws.Write(successCtx, websocket.MessageText, []byte(fmt.Sprintf(`{"type":"error","error":"%s","code":"SESSION_CREATE_FAILED"}`, err.Error())))
+			return
+		}
+
+		// Audit log: console session start
+		audit.LogConsoleSessionStart(r.Context(), claims.UserID, sessionID, vmRec.UUID)
+
+		rec = h.startConsoleRecording(&vmRec, sessionID, claims.UserID, "vnc")
+		defer rec.Close()
+
+		defer func() {
+			endReason := "user_disconnect"
+			if sessCtx != nil && stderrors.Is(context.Cause(sessCtx), session.ErrSessionTerminated) {
+				endReason = "admin_terminated"
+			}
+			// End session when connection closes (this also disconnects participants)
+			sessionMgr.EndSession(sessionID, endReason)
+			// Audit log: console session end
+			audit.LogConsoleSessionEnd(r.Context(), claims.UserID, sessionID, vmRec.UUID, endReason)
+		}()
+
+		// Get session for context
+		sess, ok := sessionMgr.GetSession(sessionID)
+		if !ok {
+			logger.Log.Error("Session not found after creation", zap.String("session_id", sessionID))
+			ws.Write(successCtx, websocket.MessageText, []byte(`{"type":"error","error":"Session not found","code":"SESSION_NOT_FOUND"}`))
+			return
+		}
+		sessCtx = sess.Context()
+		// The session ID lets the owner share the session
+		ws.Write(successCtx, websocket.MessageText, []byte(fmt.Sprintf(`{"type":"session","session_id":"%s","mode":"owner"}`, sessionID)))
 	}
 
-	sessionID, err := sessionMgr.CreateSession(claims.UserID, vmRec.ID, vmRec.UUID, r.RemoteAddr, r.UserAgent())
+	// QEMU requires the VM's VNC password, which only the backend knows: authenticate to
+	// QEMU here, then complete the client's handshake without VNC authentication.
+	vncPassword, err := h.VMService.GetVNCPassword(vmRec.Name)
 	if err != nil {
-		logger.Log.Warn("Failed to create console session",
-			zap.Uint("user_id", claims.UserID),
-			zap.String("username", claims.Username),
-			zap.Error(err))
-		ws.Write(successCtx, websocket.MessageText, []byte(fmt.Sprintf(`{"type":"error","error":"%s","code":"SESSION_CREATE_FAILED"}`, err.Error())))
+		logger.Log.Error("Failed to get VNC password", zap.Error(err), zap.String("vm_name", vmRec.Name))
+		ws.Write(successCtx, websocket.MessageText, []byte(`{"type":"error","error":"Failed to authenticate to VNC server","code":"VNC_AUTH_FAILED"}`))
 		return
 	}
+	authConn, err := rfbAuthenticate(conn, vncPassword, h.VNCTLS, remoteConsole)
+	if err != nil {
+		logger.Log.Error("VNC server authentication failed",
+			zap.Error(err),
+			zap.String("vm_name", vmRec.Name),
+			zap.String("target_address", targetAddr))
+		ws.Write(successCtx, websocket.MessageText, []byte(`{"type":"error","error":"Failed to authenticate to VNC server","code":"VNC_AUTH_FAILED"}`))
+		return
+	}
+	conn = authConn
 
-	// Audit log: console session start
-	audit.LogConsoleSessionStart(r.Context(), claims.UserID, sessionID, vmRec.UUID)
-
-	// Get session for context
-	sess, ok := sessionMgr.GetSession(sessionID)
-	if !ok {
-		logger.Log.Error("Session not found after creation", zap.String("session_id", sessionID))
-		ws.Write(successCtx, websocket.MessageText, []byte(`{"type":"error","error":"Session not found","code":"SESSION_NOT_FOUND"}`))
+	handshakeCtx, handshakeCancel := context.WithTimeout(sessCtx, rfbHandshakeTimeout)
+	pending, err := rfbServeClient(handshakeCtx, ws, rec)
+	handshakeCancel()
+	if err != nil {
+		logger.Log.Warn("VNC client handshake failed",
+			zap.Error(err),
+			zap.String("vm_uuid", vmRec.UUID),
+			zap.Uint("user_id", claims.UserID))
+		ws.Close(websocket.StatusProtocolError, "RFB_HANDSHAKE_FAILED")
 		return
 	}
+	if clientFilter != nil {
+		// The handshake is done; the filter starts at the client's ClientInit
+		clientFilter.state = rfbStateClientInit
+		if pending, err = clientFilter.Filter(pending); err != nil {
+			ws.Close(websocket.StatusProtocolError, "RFB_HANDSHAKE_FAILED")
+			return
+		}
+	}
+	if len(pending) > 0 {
+		if _, err := conn.Write(pending); err != nil {
+			return
+		}
+	}
 
 	// Use session context for VNC connection
 	errc := make(chan error, 2)
-	vncCtx, vncCancel := context.WithCancel(sess.Context())
-	defer func() {
-		vncCancel()
-		// End session when connection closes
-		sessionMgr.EndSession(sessionID, "user_disconnect")
-		// Audit log: console session end
-		audit.LogConsoleSessionEnd(r.Context(), claims.UserID, sessionID, vmRec.UUID, "user_disconnect")
-	}()
+	vncCtx, vncCancel := context.WithCancel(sessCtx)
+	defer vncCancel()
 
 	go func() {
 		defer vncCancel() // Cancel context when goroutine exits
@@ -2146,6 +2573,20 @@ func (h *Handler) HandleVNC(w http.ResponseWriter, r *http.Request) {
 					zap.Int("message_count", messageCount),
 					zap.String("vm_uuid", vmRec.UUID))
 			}
+			rec.Record(recording.Input, message)
+			if clientFilter != nil {
+				if message, err = clientFilter.Filter(message); err != nil {
+					logger.Log.Warn("Dropping shared console connection",
+						zap.Error(err),
+						zap.String("vm_uuid", vmRec.UUID),
+						zap.Uint("user_id", claims.UserID))
+					errc <- err
+					return
+				}
+				if len(message) == 0 {
+					continue
+				}
+			}
 			if _, err := conn.Write(message); err != nil {
 				logger.Log.Error("VNC TCP write error",
 					zap.Error(err),
@@ -2210,6 +2651,7 @@ func (h *Handler) HandleVNC(w http.ResponseWriter, r *http.Request) {
 					zap.Int32("read_count", count),
 					zap.String("vm_uuid", vmRec.UUID))
 			}
+			rec.Record(recording.Output, buf[:n])
 			// Optimized: Longer timeout for VNC WebSocket writes (network can be variable)
 			writeCtx, writeCancel := context.WithTimeout(r.Context(), 60*time.Second)
 			if err := ws.Write(writeCtx, websocket.MessageBinary, buf[:n]); err != nil {
@@ -2242,6 +2684,16 @@ func (h *Handler) HandleVNC(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Participants removed by the owner are told why
+	if stderrors.Is(context.Cause(sessCtx), session.ErrAccessRevoked) {
+		ws.Close(websocket.StatusPolicyViolation, "ACCESS_REVOKED")
+		return
+	}
+	if stderrors.Is(context.Cause(sessCtx), session.ErrSessionTerminated) {
+		ws.Close(websocket.StatusPolicyViolation, "SESSION_TERMINATED")
+		return
+	}
+
 	// Send close message to WebSocket if not already closed
 	closeStatus := websocket.CloseStatus(err)
 	if err != nil && closeStatus != websocket.StatusNormalClosure && closeStatus != websocket.StatusGoingAway {
@@ -2736,3 +3188,79 @@ func (h *Handler) HandleFinalizeInstall(w http.ResponseWriter, r *http.Request)
 		}
 	}
 }
+
+// HandleResetVMNVRAM restores a UEFI VM's firmware variable store from the template
+// @Summary Reset VM NVRAM
+// @Description Replace the VM's UEFI NVRAM with a fresh copy of the firmware template. Use when the firmware state is corrupted. The VM must be stopped.
+// @Tags vms
+// @Produce json
+// @Param uuid path string true "VM UUID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} errors.ErrorResponse
+// @Failure 403 {object} errors.ErrorResponse
+// @Failure 404 {object} errors.ErrorResponse
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /vms/{uuid}/nvram/reset [post]
+func (h *Handler) HandleResetVMNVRAM(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		errors.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+
+	uuidStr := chi.URLParam(r, "uuid")
+	if uuidStr == "" {
+		errors.WriteBadRequest(w, "VM UUID is required", nil)
+		return
+	}
+
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		errors.WriteUnauthorized(w, "User not authenticated")
+		return
+	}
+
+	var vmRec models.VM
+	if err := h.DB.Where("uuid = ?", uuidStr).First(&vmRec).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			errors.WriteNotFound(w, "VM not found")
+			return
+		}
+		logger.Log.Error("Failed to get VM from database", zap.Error(err), zap.String("vm_uuid", uuidStr))
+		errors.WriteInternalError(w, err, h.Config.Env == "development")
+		return
+	}
+
+	if vmRec.OwnerID != userID && !middleware.IsAdmin(r.Context()) {
+		errors.WriteForbidden(w, "You don't have permission to modify this VM")
+		return
+	}
+
+	if vmRec.Firmware != string(osprofile.FirmwareUEFI) && vmRec.Firmware != string(osprofile.FirmwareUEFISecureBoot) {
+		errors.WriteBadRequest(w, "VM does not use UEFI firmware", nil)
+		return
+	}
+	if vmRec.Status == models.VMStatusRunning {
+		errors.WriteBadRequest(w, "VM must be stopped before resetting NVRAM", nil)
+		return
+	}
+
+	if h.VMService == nil {
+		errors.WriteInternalError(w, fmt.Errorf("VM service is not available"), h.Config.Env == "development")
+		return
+	}
+
+	if err := h.VMService.ResetNVRAM(vmRec.Name); err != nil {
+		logger.Log.Error("Failed to reset VM NVRAM", zap.Error(err), zap.String("vm_name", vmRec.Name))
+		audit.LogVMNVRAMReset(r.Context(), userID, uuidStr, false, err.Error())
+		errors.WriteInternalError(w, err, h.Config.Env == "development")
+		return
+	}
+	audit.LogVMNVRAMReset(r.Context(), userID, uuidStr, true, "")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":  "VM NVRAM reset to firmware template",
+		"vm_uuid":  uuidStr,
+		"firmware": vmRec.Firmware,
+	})
+}
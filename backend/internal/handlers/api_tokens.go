@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"encoding/json"
+	stderrors "errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/DARC0625/LIMEN/backend/internal/audit"
+	"github.com/DARC0625/LIMEN/backend/internal/auth"
+	"github.com/DARC0625/LIMEN/backend/internal/errors"
+	"github.com/DARC0625/LIMEN/backend/internal/logger"
+	"github.com/DARC0625/LIMEN/backend/internal/middleware"
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// defaultAPITokenDays is the lifetime of tokens created without expires_in_days.
+const defaultAPITokenDays = 30
+
+// CreateAPITokenRequest creates a personal access token.
+type CreateAPITokenRequest struct {
+	Name          string   `json:"name"`                      // e.g. "CI pipeline"
+	Scopes        []string `json:"scopes"`                    // e.g. ["vm:read", "snapshot:*"]
+	ExpiresInDays int      `json:"expires_in_days,omitempty"` // 1-365 (default 30)
+}
+
+// APITokenInfo describes a personal access token, without the token itself.
+type APITokenInfo struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	Expired    bool       `json:"expired"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP string     `json:"last_used_ip,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// CreateAPITokenResponse returns a new token. The token is only ever shown here.
+type CreateAPITokenResponse struct {
+	APITokenInfo
+	Token string `json:"token"`
+}
+
+func apiTokenInfo(token *models.APIToken, now time.Time) APITokenInfo {
+	return APITokenInfo{
+		ID:         token.ID,
+		Name:       token.Name,
+		Prefix:     token.Prefix,
+		Scopes:     token.ScopeList(),
+		ExpiresAt:  token.ExpiresAt,
+		Expired:    !now.Before(token.ExpiresAt),
+		LastUsedAt: token.LastUsedAt,
+		LastUsedIP: token.LastUsedIP,
+		CreatedAt:  token.CreatedAt,
+	}
+}
+
+// HandleListAPITokens handles GET /api/auth/tokens - List the user's personal access tokens.
+// @Summary     List my API tokens
+// @Description Lists the current user's personal access tokens, newest first, including expired ones.
+// @Description The tokens themselves are never shown again after creation.
+// @Tags        Authentication
+// @Produce     json
+// @Success     200  {object}  map[string]interface{}  "tokens: []APITokenInfo"
+// @Failure     401  {object}  map[string]interface{}  "Authentication required"
+// @Security    BearerAuth
+// @Router      /auth/tokens [get]
+func (h *Handler) HandleListAPITokens(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		errors.WriteUnauthorized(w, "Authentication required")
+		return
+	}
+	tokens, err := h.APITokens.List(userID)
+	if err != nil {
+		logger.Log.Error("Failed to list API tokens", zap.Uint("user_id", userID), zap.Error(err))
+		errors.WriteInternalError(w, err, false)
+		return
+	}
+	now := time.Now()
+	infos := make([]APITokenInfo, 0, len(tokens))
+	for i := range tokens {
+		infos = append(infos, apiTokenInfo(&tokens[i], now))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"tokens": infos,
+	})
+}
+
+// HandleCreateAPIToken handles POST /api/auth/tokens - Create a personal access token.
+// @Summary     Create an API token
+// @Description Creates a personal access token for scripts and CI, sent as "Authorization: Bearer limen_pat_...".
+// @Description Scopes are resource:read, resource:write or resource:*, for the resources vm, snapshot, image,
+// @Description console, quota and admin (admins only). The token is returned once and can't be retrieved again.
+// @Tags        Authentication
+// @Accept      json
+// @Produce     json
+// @Param       request body CreateAPITokenRequest true "Token name, scopes and lifetime"
+// @Success     201  {object}  CreateAPITokenResponse
+// @Failure     400  {object}  map[string]interface{}  "Invalid name, scopes or lifetime"
+// @Failure     401  {object}  map[string]interface{}  "Authentication required"
+// @Failure     403  {object}  map[string]interface{}  "Admin scopes require an admin"
+// @Failure     409  {object}  map[string]interface{}  "Too many tokens"
+// @Security    BearerAuth
+// @Router      /auth/tokens [post]
+func (h *Handler) HandleCreateAPIToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		errors.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		errors.WriteUnauthorized(w, "Authentication required")
+		return
+	}
+	var req CreateAPITokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errors.WriteBadRequest(w, "Invalid request body", err)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || utf8.RuneCountInString(req.Name) > 100 {
+		errors.WriteBadRequest(w, "Token name must be 1-100 characters", nil)
+		return
+	}
+	if req.ExpiresInDays == 0 {
+		req.ExpiresInDays = defaultAPITokenDays
+	}
+	maxDays := int(auth.MaxAPITokenLifetime / (24 * time.Hour))
+	if req.ExpiresInDays < 1 || req.ExpiresInDays > maxDays {
+		errors.WriteBadRequest(w, "expires_in_days must be between 1 and "+strconv.Itoa(maxDays), nil)
+		return
+	}
+	scopes, err := auth.NormalizeScopes(req.Scopes)
+	if err != nil {
+		errors.WriteBadRequest(w, err.Error(), nil)
+		return
+	}
+	for _, scope := range scopes {
+		if strings.HasPrefix(scope, "admin:") && !middleware.IsAdmin(r.Context()) {
+			errors.WriteForbidden(w, "Admin scopes require an admin")
+			return
+		}
+	}
+
+	token, secret, err := h.APITokens.Create(userID, req.Name, scopes, time.Duration(req.ExpiresInDays)*24*time.Hour)
+	if err != nil {
+		if stderrors.Is(err, auth.ErrTooManyAPITokens) {
+			errors.WriteErrorWithCode(w, http.StatusConflict, "Too many API tokens: revoke unused ones first", errors.ErrCodeResourceConflict, nil, false)
+			return
+		}
+		logger.Log.Error("Failed to create API token", zap.Uint("user_id", userID), zap.Error(err))
+		errors.WriteInternalError(w, err, false)
+		return
+	}
+	logger.Log.Info("API token created", zap.Uint("user_id", userID), zap.Uint("api_token_id", token.ID), zap.Strings("scopes", scopes))
+	audit.LogAPITokenChange(r.Context(), userID, token.ID, "create", token.Name, scopes)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(CreateAPITokenResponse{
+		APITokenInfo: apiTokenInfo(token, time.Now()),
+		Token:        secret,
+	})
+}
+
+// HandleRevokeAPIToken handles DELETE /api/auth/tokens/{id} - Revoke a personal access token.
+// @Summary     Revoke an API token
+// @Description Deletes one of the current user's personal access tokens; it stops working immediately.
+// @Tags        Authentication
+// @Produce     json
+// @Param       id path int true "Token ID"
+// @Success     200  {object}  map[string]interface{}  "Token revoked"
+// @Failure     400  {object}  map[string]interface{}  "Invalid token ID"
+// @Failure     401  {object}  map[string]interface{}  "Authentication required"
+// @Failure     404  {object}  map[string]interface{}  "Token not found"
+// @Security    BearerAuth
+// @Router      /auth/tokens/{id} [delete]
+func (h *Handler) HandleRevokeAPIToken(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		errors.WriteUnauthorized(w, "Authentication required")
+		return
+	}
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		errors.WriteBadRequest(w, "Invalid token ID", err)
+		return
+	}
+	token, err := h.APITokens.Revoke(userID, uint(id))
+	if err != nil {
+		if stderrors.Is(err, gorm.ErrRecordNotFound) {
+			errors.WriteNotFound(w, "API token")
+			return
+		}
+		logger.Log.Error("Failed to revoke API token", zap.Uint("user_id", userID), zap.Error(err))
+		errors.WriteInternalError(w, err, false)
+		return
+	}
+	logger.Log.Info("API token revoked by user", zap.Uint("user_id", userID), zap.Uint("api_token_id", token.ID))
+	audit.LogAPITokenChange(r.Context(), userID, token.ID, "revoke", token.Name, token.ScopeList())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "API token revoked",
+	})
+}
+
+// HandleRevokeUserAPITokens handles DELETE /api/admin/users/{id}/tokens - Revoke all API tokens of a user
+// @Summary     Revoke a user's API tokens
+// @Description Deletes all personal access tokens of a user (admin only), e.g. after one leaked.
+// @Tags        Admin
+// @Produce     json
+// @Param       id path int true "User ID"
+// @Success     200  {object}  map[string]interface{}  "Number of tokens revoked"
+// @Failure     400  {object}  map[string]interface{}  "Invalid user ID"
+// @Failure     403  {object}  map[string]interface{}  "Forbidden - admin access required"
+// @Failure     404  {object}  map[string]interface{}  "User not found"
+// @Router      /admin/users/{id}/tokens [delete]
+func (h *Handler) HandleRevokeUserAPITokens(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	userID, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		errors.WriteBadRequest(w, "Invalid user ID", err)
+		return
+	}
+
+	var user models.User
+	if err := h.DB.First(&user, userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			errors.WriteNotFound(w, "User")
+		} else {
+			logger.Log.Error("Failed to fetch user", zap.Error(err))
+			errors.WriteInternalError(w, err, false)
+		}
+		return
+	}
+	count, err := h.APITokens.RevokeAll(user.ID)
+	if err != nil {
+		logger.Log.Error("Failed to revoke user API tokens", zap.Uint("user_id", user.ID), zap.Error(err))
+		errors.WriteInternalError(w, err, false)
+		return
+	}
+	logger.Log.Info("User API tokens revoked by admin", zap.Uint("user_id", user.ID), zap.Int64("count", count))
+	audit.LogAPITokenChange(r.Context(), user.ID, 0, "revoke_all", "", nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"user_id": user.ID,
+		"revoked": count,
+	})
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/DARC0625/LIMEN/backend/internal/auth"
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+)
+
+func TestAPITokens_Flow(t *testing.T) {
+	h := setupTestImageHandler(t)
+	alice := models.User{Username: "alice", Password: "x", Role: models.RoleUser, Approved: true}
+	h.DB.Create(&alice)
+
+	body := []byte(`{"name":"CI","scopes":["vm:read","snapshot:*"],"expires_in_days":7}`)
+	w := httptest.NewRecorder()
+	h.HandleCreateAPIToken(w, imageRequest("POST", "/api/auth/tokens", body, alice.ID, "user", nil))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create = %d: %s", w.Code, w.Body.String())
+	}
+	var created CreateAPITokenResponse
+	json.NewDecoder(w.Body).Decode(&created)
+	if !strings.HasPrefix(created.Token, auth.APITokenPrefix) || !strings.HasPrefix(created.Token, created.Prefix) || len(created.Scopes) != 2 {
+		t.Errorf("created token = %+v", created)
+	}
+	if _, user, err := h.APITokens.Authenticate(created.Token, "10.0.0.1"); err != nil || user.ID != alice.ID {
+		t.Errorf("Authenticate() with the new token = %v, %v", user, err)
+	}
+
+	// The token is never shown again
+	w = httptest.NewRecorder()
+	h.HandleListAPITokens(w, imageRequest("GET", "/api/auth/tokens", nil, alice.ID, "user", nil))
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), created.Token) || !strings.Contains(w.Body.String(), `"last_used_ip":"10.0.0.1"`) {
+		t.Errorf("list = %d: %s", w.Code, w.Body.String())
+	}
+
+	for _, invalid := range []string{
+		`{"name":"","scopes":["vm:read"]}`,
+		`{"name":"CI","scopes":["vm:delete"]}`,
+		`{"name":"CI","scopes":["vm:read"],"expires_in_days":400}`,
+	} {
+		w = httptest.NewRecorder()
+		h.HandleCreateAPIToken(w, imageRequest("POST", "/api/auth/tokens", []byte(invalid), alice.ID, "user", nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("create %s = %d, want 400", invalid, w.Code)
+		}
+	}
+	w = httptest.NewRecorder()
+	h.HandleCreateAPIToken(w, imageRequest("POST", "/api/auth/tokens", []byte(`{"name":"CI","scopes":["admin:*"]}`), alice.ID, "user", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("admin scope for a user = %d, want 403", w.Code)
+	}
+
+	id := strconv.FormatUint(uint64(created.ID), 10)
+	w = httptest.NewRecorder()
+	h.HandleRevokeAPIToken(w, imageRequest("DELETE", "/api/auth/tokens/"+id, nil, alice.ID+1, "user", map[string]string{"id": id}))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("revoke another user's token = %d, want 404", w.Code)
+	}
+	w = httptest.NewRecorder()
+	h.HandleRevokeAPIToken(w, imageRequest("DELETE", "/api/auth/tokens/"+id, nil, alice.ID, "user", map[string]string{"id": id}))
+	if w.Code != http.StatusOK {
+		t.Errorf("revoke = %d: %s", w.Code, w.Body.String())
+	}
+	if _, _, err := h.APITokens.Authenticate(created.Token, "10.0.0.1"); err == nil {
+		t.Error("revoked token still authenticates")
+	}
+
+	var logged int64
+	h.DB.Model(&models.AuditLog{}).Where("action IN ?", []string{"auth.api_token_create", "auth.api_token_revoke"}).Count(&logged)
+	if logged != 2 {
+		t.Errorf("audit log entries = %d, want 2", logged)
+	}
+}
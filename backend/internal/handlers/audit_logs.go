@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/DARC0625/LIMEN/backend/internal/audit"
+	"github.com/DARC0625/LIMEN/backend/internal/errors"
+	"github.com/DARC0625/LIMEN/backend/internal/logger"
+	"go.uber.org/zap"
+)
+
+// HandleListAuditLogs handles GET /api/admin/audit-logs - Read the audit trail.
+// @Summary     List audit logs
+// @Description Returns audit events, newest first. Requires the audit.read permission (admins and auditors).
+// @Tags        Admin
+// @Produce     json
+// @Param       user_id  query int    false "Filter by user ID"
+// @Param       action   query string false "Filter by action, e.g. vm.start"
+// @Param       resource query string false "Filter by resource, e.g. vm"
+// @Param       limit    query int    false "Maximum number of events (default 100, max 1000)"
+// @Param       offset   query int    false "Events to skip (default 0)"
+// @Success     200  {object}  map[string]interface{}  "logs: []models.AuditLog, total, limit, offset"
+// @Failure     400  {object}  map[string]interface{}  "Invalid filter"
+// @Failure     403  {object}  map[string]interface{}  "Forbidden - audit.read permission required"
+// @Security    BearerAuth
+// @Router      /admin/audit-logs [get]
+func (h *Handler) HandleListAuditLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		errors.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+
+	q := r.URL.Query()
+	var userID *uint
+	if v := q.Get("user_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			errors.WriteBadRequest(w, "Invalid user_id", err)
+			return
+		}
+		uid := uint(id)
+		userID = &uid
+	}
+	limit := 100
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			errors.WriteBadRequest(w, "Invalid limit", err)
+			return
+		}
+		limit = n
+		if limit > 1000 {
+			limit = 1000
+		}
+	}
+	offset := 0
+	if v := q.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			errors.WriteBadRequest(w, "Invalid offset", err)
+			return
+		}
+		offset = n
+	}
+
+	logs, total, err := audit.GetAuditLogs(h.DB, userID, q.Get("action"), q.Get("resource"), limit, offset)
+	if err != nil {
+		logger.Log.Error("Failed to list audit logs", zap.Error(err))
+		errors.WriteInternalError(w, err, false)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"logs":   logs,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
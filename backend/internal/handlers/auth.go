@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	stderrors "errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -13,9 +14,11 @@ import (
 	"github.com/DARC0625/LIMEN/backend/internal/errors"
 	"github.com/DARC0625/LIMEN/backend/internal/logger"
 	"github.com/DARC0625/LIMEN/backend/internal/metrics"
+	"github.com/DARC0625/LIMEN/backend/internal/middleware"
 	"github.com/DARC0625/LIMEN/backend/internal/models"
 	"github.com/DARC0625/LIMEN/backend/internal/security"
 	"github.com/DARC0625/LIMEN/backend/internal/validator"
+	"github.com/go-chi/chi/v5"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
 )
@@ -30,24 +33,31 @@ type LoginResponse struct {
 	RefreshToken string `json:"refresh_token,omitempty"` // Omitted from JSON, sent via cookie
 	ExpiresIn    int    `json:"expires_in"`              // Access token expiry in seconds (900 = 15 minutes)
 	TokenType    string `json:"token_type"`              // "Bearer"
+	// MFA recovery codes, returned once by the login that enrolled MFA
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
 }
 
 type RegisterRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+	Email    string `json:"email,omitempty"` // Optional; a verification link is mailed to it
 }
 
 // HandleLogin handles user login and returns a JWT token.
 // @Summary     User login
-// @Description Authenticates a user and returns a JWT token
+// @Description Authenticates a user against the configured directories (AUTH_BACKENDS: local users, LDAP) and
+// @Description returns a JWT token. Users with MFA enabled, or whose role requires it,
+// @Description get an MFAChallengeResponse instead, whose mfa_token completes the login at /auth/login/mfa.
 // @Tags        Authentication
 // @Accept      json
 // @Produce     json
 // @Param       credentials body LoginRequest true "Login credentials"
-// @Success     200  {object}  LoginResponse  "Login successful"
+// @Success     200  {object}  LoginResponse  "Login successful, or MFAChallengeResponse when a second factor is required"
 // @Failure     400  {object}  map[string]interface{}  "Invalid request"
 // @Failure     401  {object}  map[string]interface{}  "Invalid credentials"
 // @Failure     403  {object}  map[string]interface{}  "Account locked or not approved"
+// @Failure     429  {object}  map[string]interface{}  "Too many failed attempts"
+// @Failure     503  {object}  map[string]interface{}  "Directory unavailable"
 // @Router      /auth/login [post]
 func (h *Handler) HandleLogin(w http.ResponseWriter, r *http.Request, cfg *config.Config) {
 	logger.Log.Info("HandleLogin called",
@@ -76,35 +86,49 @@ func (h *Handler) HandleLogin(w http.ResponseWriter, r *http.Request, cfg *confi
 	logger.Log.Info("Login attempt",
 		zap.Bool("password_provided", req.Password != ""))
 
+	// Find user (optimized: only fetch necessary fields for the lockout check). Users of
+	// external directories don't exist before their first login.
+	var user models.User
+	err := h.DB.Select("id", "username", "role").Where("username = ?", req.Username).First(&user).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		logger.Log.Error("Failed to find user", zap.Error(err))
+		errors.WriteInternalError(w, err, false)
+		return
+	}
+
 	// Zero-trust: Always use generic error messages to prevent user enumeration
-	// Check account lockout (user security: prevent brute force)
-	locked, lockUntil := security.CheckAccountLockout(0) // Would use actual userID
-	if locked && lockUntil != nil && time.Now().Before(*lockUntil) {
-		errors.WriteForbidden(w, fmt.Sprintf("Account locked due to too many failed attempts. Try again after %s", lockUntil.Format(time.RFC3339)))
+	// Check account lockout (user security: prevent brute force). Unknown usernames are
+	// throttled and locked like existing ones.
+	clientIP := h.clientIP(r)
+	decision, done := h.LoginGuard.Begin(user.ID, req.Username, clientIP)
+	defer done()
+	if !decision.Allowed() {
+		writeLoginBlocked(w, decision, user.ID, clientIP)
 		return
 	}
 
-	// Find user (optimized: only fetch necessary fields for authentication)
-	var user models.User
-	if err := h.DB.Select("id", "username", "password", "role", "approved").Where("username = ?", req.Username).First(&user).Error; err != nil {
-		// Always return generic error message (zero-trust: don't reveal if user exists)
-		if err == gorm.ErrRecordNotFound {
-			// Use same error message as invalid password to prevent user enumeration
-			// But still record failed attempt for security monitoring
-			security.RecordFailedLogin(r.Context(), 0, r.RemoteAddr)
-			metrics.AuthFailureTotal.WithLabelValues("invalid_credentials").Inc()
-			errors.WriteUnauthorized(w, "Invalid credentials")
-		} else {
-			logger.Log.Error("Failed to find user", zap.Error(err))
-			errors.WriteInternalError(w, err, false)
-		}
+	// Check password against the configured directories, which also bring the role and
+	// approval of their users up to date
+	authenticated, err := h.Authenticator.Authenticate(r.Context(), req.Username, req.Password)
+	if err != nil && !stderrors.Is(err, auth.ErrInvalidCredentials) && !stderrors.Is(err, auth.ErrUnknownUser) {
+		// Not a failed attempt: the directory couldn't tell
+		logger.Log.Error("Authentication backend unavailable", zap.String("backend", h.Authenticator.Name()), zap.Error(err))
+		errors.WriteServiceUnavailable(w, "Authentication service is unavailable", err, false)
 		return
 	}
 
-	// Check password
-	if !auth.CheckPassword(req.Password, user.Password) {
+	if err != nil && user.ID == 0 {
+		// Use same error message as invalid password to prevent user enumeration
+		// But still record failed attempt for security monitoring
+		h.LoginGuard.RecordFailure(r.Context(), 0, req.Username, clientIP)
+		metrics.AuthFailureTotal.WithLabelValues("invalid_credentials").Inc()
+		errors.WriteUnauthorized(w, "Invalid credentials")
+		return
+	}
+
+	if err != nil {
 		// Record failed login attempt (user security: behavior monitoring)
-		security.RecordFailedLogin(r.Context(), user.ID, r.RemoteAddr)
+		h.LoginGuard.RecordFailure(r.Context(), user.ID, user.Username, clientIP)
 
 		// Audit failed login attempt
 		security.AuditUserAction(r.Context(), user.ID, "login_failed", "authentication", false, map[string]interface{}{
@@ -140,6 +164,44 @@ func (h *Handler) HandleLogin(w http.ResponseWriter, r *http.Request, cfg *confi
 		errors.WriteUnauthorized(w, "Invalid credentials")
 		return
 	}
+	user = *authenticated
+
+	// Second factor: with MFA enabled, or required for the user's role, the password only
+	// earns a challenge, completed at /api/auth/login/mfa
+	mfaMethods, mfaRequired, err := h.MFA.LoginMethods(user.ID, string(user.Role))
+	if err != nil {
+		logger.Log.Error("Failed to check MFA", zap.Uint("user_id", user.ID), zap.Error(err))
+		errors.WriteInternalError(w, err, false)
+		return
+	}
+	if len(mfaMethods) > 0 || mfaRequired {
+		h.writeMFAChallenge(w, user.ID, mfaMethods)
+		return
+	}
+
+	h.completeLogin(w, r, cfg, &user, nil)
+}
+
+// completeLogin issues the tokens of a user who passed every login step: it clears
+// their failed attempts, creates their session and sets its cookies. recoveryCodes are
+// returned once when the login enrolled MFA.
+func (h *Handler) completeLogin(w http.ResponseWriter, r *http.Request, cfg *config.Config, user *models.User, recoveryCodes []string) {
+	response, ok := h.startSession(w, r, cfg, user)
+	if !ok {
+		return
+	}
+	response.RecoveryCodes = recoveryCodes
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// startSession logs in a user who passed every login step and sets their session
+// cookies, returning the response body with their access token. It writes the error
+// response and returns false if that fails.
+func (h *Handler) startSession(w http.ResponseWriter, r *http.Request, cfg *config.Config, user *models.User) (*LoginResponse, bool) {
+	h.LoginGuard.RecordSuccess(user.ID)
 
 	// Audit successful login
 	security.AuditUserAction(r.Context(), user.ID, "login_success", "authentication", true, map[string]interface{}{
@@ -165,13 +227,13 @@ func (h *Handler) HandleLogin(w http.ResponseWriter, r *http.Request, cfg *confi
 	}
 	logger.LogUserEvent(logger.EventUserLogin, logCtx, user.ID, user.Username, "User logged in successfully",
 		zap.String("role", string(user.Role)),
-		zap.Bool("approved", user.Approved || user.Role == models.RoleAdmin),
+		zap.Bool("approved", user.Approved || h.Roles.HasPermission(string(user.Role), models.PermManageSystem)),
 	)
 
 	// Check if user is approved (admin users are always approved)
-	if !user.Approved && user.Role != models.RoleAdmin {
+	if !user.Approved && !h.Roles.HasPermission(string(user.Role), models.PermManageSystem) {
 		errors.WriteForbidden(w, "Account pending approval. Please wait for admin approval.")
-		return
+		return nil, false
 	}
 
 	// Generate tokens with role, approval status, and beta access
@@ -180,24 +242,24 @@ func (h *Handler) HandleLogin(w http.ResponseWriter, r *http.Request, cfg *confi
 		role = string(models.RoleUser) // Default to user if role is empty
 	}
 	// Only generate token if user is approved (admin users are always approved)
-	approved := user.Approved || user.Role == models.RoleAdmin
+	approved := user.Approved || h.Roles.HasPermission(string(user.Role), models.PermManageSystem)
 	// Beta access: admin always has access, or if BetaAccess flag is set
-	betaAccess := user.Role == models.RoleAdmin || user.BetaAccess
+	betaAccess := h.Roles.HasPermission(string(user.Role), models.PermManageSystem) || user.BetaAccess
 
 	// Generate Access Token (15 minutes) with beta access
-	accessToken, err := auth.GenerateAccessTokenWithBetaAccess(user.ID, user.Username, role, approved, betaAccess, cfg.JWTSecret)
+	accessToken, err := auth.KeysFor(cfg).GenerateAccessTokenWithBetaAccess(user.ID, user.Username, role, approved, betaAccess)
 	if err != nil {
 		logger.Log.Error("Failed to generate access token", zap.Error(err))
 		errors.WriteInternalError(w, err, false)
-		return
+		return nil, false
 	}
 
 	// Generate Refresh Token (7 days) with beta access
-	refreshToken, tokenID, err := auth.GenerateRefreshTokenWithBetaAccess(user.ID, user.Username, role, approved, betaAccess, cfg.JWTSecret)
+	refreshToken, tokenID, err := auth.KeysFor(cfg).GenerateRefreshTokenWithBetaAccess(user.ID, user.Username, role, approved, betaAccess)
 	if err != nil {
 		logger.Log.Error("Failed to generate refresh token", zap.Error(err))
 		errors.WriteInternalError(w, err, false)
-		return
+		return nil, false
 	}
 
 	// Generate CSRF Token
@@ -205,7 +267,7 @@ func (h *Handler) HandleLogin(w http.ResponseWriter, r *http.Request, cfg *confi
 	if err != nil {
 		logger.Log.Error("Failed to generate CSRF token", zap.Error(err))
 		errors.WriteInternalError(w, err, false)
-		return
+		return nil, false
 	}
 
 	// Create session with tokens
@@ -215,8 +277,9 @@ func (h *Handler) HandleLogin(w http.ResponseWriter, r *http.Request, cfg *confi
 	if err != nil {
 		logger.Log.Error("Failed to create session", zap.Error(err))
 		errors.WriteInternalError(w, err, false)
-		return
+		return nil, false
 	}
+	sessionStore.RecordUse(session.ID, logger.GetClientIP(r), r.UserAgent())
 
 	// Set Refresh Token cookie
 	isHTTPS := r.Header.Get("X-Forwarded-Proto") == "https" || r.TLS != nil
@@ -254,7 +317,7 @@ func (h *Handler) HandleLogin(w http.ResponseWriter, r *http.Request, cfg *confi
 	http.SetCookie(w, csrfCookie)
 
 	// Prepare response (Refresh Token is sent via cookie, not in body)
-	response := LoginResponse{
+	response := &LoginResponse{
 		AccessToken: accessToken,
 		ExpiresIn:   900, // 15 minutes in seconds
 		TokenType:   "Bearer",
@@ -275,15 +338,12 @@ func (h *Handler) HandleLogin(w http.ResponseWriter, r *http.Request, cfg *confi
 
 	// Update metrics
 	metrics.UserLoginTotal.Inc()
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(response)
+	return response, true
 }
 
 // HandleRegister handles user registration.
 // @Summary     User registration
-// @Description Registers a new user account (requires admin approval)
+// @Description Registers a new user account (requires admin approval). A verification link is mailed to the optional email address
 // @Tags        Authentication
 // @Accept      json
 // @Produce     json
@@ -315,10 +375,14 @@ func (h *Handler) HandleRegister(w http.ResponseWriter, r *http.Request, cfg *co
 	}
 
 	// Validate password against security policy (zero-trust: enforce strong passwords)
-	policy := security.DefaultUserSecurityPolicy()
-	valid, issues := security.ValidatePasswordPolicy(req.Password, policy)
-	if !valid {
-		errors.WriteBadRequest(w, fmt.Sprintf("Password does not meet security requirements: %s", strings.Join(issues, "; ")), nil)
+	if msg := passwordPolicyError(req.Password); msg != "" {
+		errors.WriteBadRequest(w, msg, nil)
+		return
+	}
+
+	req.Email = strings.TrimSpace(req.Email)
+	if req.Email != "" && !validator.ValidateEmail(req.Email) {
+		errors.WriteBadRequest(w, "Invalid email address", nil)
 		return
 	}
 
@@ -346,6 +410,7 @@ func (h *Handler) HandleRegister(w http.ResponseWriter, r *http.Request, cfg *co
 		Password: hashedPassword,
 		Role:     models.RoleUser, // Default role for new users
 		Approved: false,           // Requires admin approval
+		Email:    req.Email,
 	}
 
 	if err := h.DB.Create(&user).Error; err != nil {
@@ -353,6 +418,11 @@ func (h *Handler) HandleRegister(w http.ResponseWriter, r *http.Request, cfg *co
 		errors.WriteInternalError(w, err, false)
 		return
 	}
+	if user.Email != "" && h.Accounts.AllowMail("email_verification", user.ID) {
+		if err := h.sendEmailVerification(r.Context(), &user); err != nil {
+			logger.Log.Error("Failed to send verification email", zap.Uint("user_id", user.ID), zap.Error(err))
+		}
+	}
 
 	logger.Log.Info("User registered", zap.String("username", user.Username))
 	w.Header().Set("Content-Type", "application/json")
@@ -465,7 +535,7 @@ func (h *Handler) HandleGetSession(w http.ResponseWriter, r *http.Request, cfg *
 	}
 
 	// Parse refresh token for session recovery (allows recovery if session not found)
-	refreshClaims, err := auth.ParseRefreshTokenForRecovery(refreshToken, cfg.JWTSecret)
+	refreshClaims, err := auth.KeysFor(cfg).ParseRefreshTokenForRecovery(refreshToken)
 	if err != nil {
 		// Token validation failed - log and return 401
 		logger.Log.Warn("Invalid refresh token in session check",
@@ -483,58 +553,21 @@ func (h *Handler) HandleGetSession(w http.ResponseWriter, r *http.Request, cfg *
 		return
 	}
 
-	// Get session from store by refresh token (for session recovery if needed)
+	// The session must still be active: sessions are persistent, so a missing one was
+	// logged out, revoked or rotated and must not be recreated from the token
 	sessionStore := auth.GetSessionStore()
 	session, exists := sessionStore.GetSessionByRefreshToken(refreshToken)
 	if !exists {
-		// Session not found in store, but refresh token is valid
-		// This can happen after server restart (memory session store was cleared)
-		// Auto-recover session from valid refresh token
-
-		// Generate new access token
-		newAccessToken, err := auth.GenerateAccessToken(refreshClaims.UserID, refreshClaims.Username, refreshClaims.Role, refreshClaims.Approved, cfg.JWTSecret)
-		if err != nil {
-			logger.Log.Error("Failed to generate access token during session recovery", zap.Error(err))
-			errors.WriteInternalError(w, err, false)
-			return
-		}
-
-		// Generate new CSRF token
-		csrfToken, err := security.GenerateCSRFToken()
-		if err != nil {
-			logger.Log.Error("Failed to generate CSRF token during session recovery", zap.Error(err))
-			errors.WriteInternalError(w, err, false)
-			return
-		}
-
-		// Create new session with existing refresh token
-		var expiresAt time.Time
-		if refreshClaims.ExpiresAt != nil {
-			expiresAt = refreshClaims.ExpiresAt.Time
-		} else {
-			// Fallback to 7 days from now if ExpiresAt is nil
-			expiresAt = time.Now().Add(7 * 24 * time.Hour)
-		}
-		session, err = sessionStore.CreateSession(
-			newAccessToken,
-			refreshToken, // Keep existing refresh token
-			refreshClaims.TokenID,
-			csrfToken,
-			refreshClaims.UserID,
-			refreshClaims.Username,
-			refreshClaims.Role,
-			expiresAt,
-		)
-		if err != nil {
-			logger.Log.Error("Failed to create session during recovery", zap.Error(err))
-			errors.WriteInternalError(w, err, false)
-			return
-		}
-
-		logger.Log.Info("Session recovered successfully",
-			zap.String("session_id", session.ID),
+		logger.Log.Info("Session not found for refresh token in session check",
 			zap.Uint("user_id", refreshClaims.UserID),
-			zap.String("username", refreshClaims.Username))
+			zap.String("remote_addr", r.RemoteAddr))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(SessionResponse{
+			Valid:  false,
+			Reason: "세션이 만료되었습니다.",
+		})
+		return
 	}
 
 	// Validate CSRF token if provided (optional for GET, but recommended)
@@ -554,7 +587,7 @@ func (h *Handler) HandleGetSession(w http.ResponseWriter, r *http.Request, cfg *
 	}
 
 	// Generate new access token (refresh it)
-	newAccessToken, err := auth.GenerateAccessToken(session.UserID, session.Username, session.Role, refreshClaims.Approved, cfg.JWTSecret)
+	newAccessToken, err := auth.KeysFor(cfg).GenerateAccessToken(session.UserID, session.Username, session.Role, refreshClaims.Approved)
 	if err != nil {
 		logger.Log.Error("Failed to generate access token", zap.Error(err))
 		errors.WriteInternalError(w, err, false)
@@ -653,7 +686,7 @@ func (h *Handler) HandleCreateSession(w http.ResponseWriter, r *http.Request, cf
 	}
 
 	// Validate access token
-	accessClaims, err := auth.ValidateToken(req.AccessToken, cfg.JWTSecret)
+	accessClaims, err := auth.KeysFor(cfg).ValidateToken(req.AccessToken)
 	if err != nil {
 		logger.Log.Warn("Invalid access token for session creation", zap.Error(err))
 		errors.WriteUnauthorized(w, "Invalid access token")
@@ -661,7 +694,7 @@ func (h *Handler) HandleCreateSession(w http.ResponseWriter, r *http.Request, cf
 	}
 
 	// Validate refresh token
-	refreshClaims, err := auth.ValidateRefreshToken(req.RefreshToken, cfg.JWTSecret)
+	refreshClaims, err := auth.KeysFor(cfg).ValidateRefreshToken(req.RefreshToken)
 	if err != nil {
 		logger.Log.Warn("Invalid refresh token for session creation", zap.Error(err))
 		errors.WriteUnauthorized(w, "Invalid refresh token")
@@ -675,7 +708,7 @@ func (h *Handler) HandleCreateSession(w http.ResponseWriter, r *http.Request, cf
 	}
 
 	// Check if user is approved
-	if !refreshClaims.Approved && refreshClaims.Role != "admin" {
+	if !refreshClaims.Approved && !h.Roles.HasPermission(refreshClaims.Role, models.PermManageSystem) {
 		errors.WriteForbidden(w, "Account pending approval")
 		return
 	}
@@ -683,12 +716,24 @@ func (h *Handler) HandleCreateSession(w http.ResponseWriter, r *http.Request, cf
 	// Create session with tokens
 	sessionStore := auth.GetSessionStore()
 	refreshExpiresAt := time.Now().Add(7 * 24 * time.Hour) // 7 days
-	session, err := sessionStore.CreateSession(req.AccessToken, req.RefreshToken, refreshClaims.TokenID, csrfToken, refreshClaims.UserID, refreshClaims.Username, refreshClaims.Role, refreshExpiresAt)
-	if err != nil {
-		logger.Log.Error("Failed to create session", zap.Error(err))
-		errors.WriteInternalError(w, err, false)
-		return
+	session, exists := sessionStore.GetSessionByRefreshToken(req.RefreshToken)
+	if exists {
+		// The refresh token already has a session: keep its CSRF token
+		csrfToken = session.CSRFToken
+	} else {
+		session, err = sessionStore.CreateSession(req.AccessToken, req.RefreshToken, refreshClaims.TokenID, csrfToken, refreshClaims.UserID, refreshClaims.Username, refreshClaims.Role, refreshExpiresAt)
+		if stderrors.Is(err, auth.ErrTokenRevoked) {
+			logger.Log.Warn("Session creation with a revoked refresh token", zap.Uint("user_id", refreshClaims.UserID))
+			errors.WriteUnauthorized(w, "Invalid refresh token")
+			return
+		}
+		if err != nil {
+			logger.Log.Error("Failed to create session", zap.Error(err))
+			errors.WriteInternalError(w, err, false)
+			return
+		}
 	}
+	sessionStore.RecordUse(session.ID, logger.GetClientIP(r), r.UserAgent())
 
 	// Set Refresh Token cookie
 	isHTTPS := r.Header.Get("X-Forwarded-Proto") == "https" || r.TLS != nil
@@ -858,23 +903,15 @@ func (h *Handler) HandleRefreshToken(w http.ResponseWriter, r *http.Request, cfg
 	}
 
 	// Validate refresh token
-	refreshClaims, err := auth.ValidateRefreshToken(refreshToken, cfg.JWTSecret)
+	refreshClaims, err := auth.KeysFor(cfg).ValidateRefreshToken(refreshToken)
 	if err != nil {
 		logger.Log.Warn("Invalid refresh token", zap.Error(err))
 		errors.WriteUnauthorized(w, "Invalid or expired refresh token")
 		return
 	}
 
-	// Get session from store
-	sessionStore := auth.GetSessionStore()
-	session, exists := sessionStore.GetSessionByRefreshToken(refreshToken)
-	if !exists {
-		errors.WriteUnauthorized(w, "Invalid or expired refresh token")
-		return
-	}
-
 	// Generate new access token
-	newAccessToken, err := auth.GenerateAccessToken(refreshClaims.UserID, refreshClaims.Username, refreshClaims.Role, refreshClaims.Approved, cfg.JWTSecret)
+	newAccessToken, err := auth.KeysFor(cfg).GenerateAccessToken(refreshClaims.UserID, refreshClaims.Username, refreshClaims.Role, refreshClaims.Approved)
 	if err != nil {
 		logger.Log.Error("Failed to generate access token", zap.Error(err))
 		errors.WriteInternalError(w, err, false)
@@ -882,19 +919,33 @@ func (h *Handler) HandleRefreshToken(w http.ResponseWriter, r *http.Request, cfg
 	}
 
 	// Token Rotation: Generate new refresh token and invalidate old one
-	newRefreshToken, newTokenID, err := auth.GenerateRefreshToken(refreshClaims.UserID, refreshClaims.Username, refreshClaims.Role, refreshClaims.Approved, cfg.JWTSecret)
+	newRefreshToken, newTokenID, err := auth.KeysFor(cfg).GenerateRefreshToken(refreshClaims.UserID, refreshClaims.Username, refreshClaims.Role, refreshClaims.Approved)
 	if err != nil {
 		logger.Log.Error("Failed to generate refresh token", zap.Error(err))
 		errors.WriteInternalError(w, err, false)
 		return
 	}
 
-	// Update session with new tokens (rotation)
+	// Rotate the session's refresh token. A token already rotated out was probably
+	// stolen: its session is revoked, logging out both the thief and the user.
+	sessionStore := auth.GetSessionStore()
 	refreshExpiresAt := time.Now().Add(7 * 24 * time.Hour) // 7 days
-	sessionStore.UpdateSessionTokens(session.ID, newAccessToken, newRefreshToken, newTokenID)
-	session.RefreshToken = newRefreshToken
-	session.TokenID = newTokenID
-	session.ExpiresAt = refreshExpiresAt
+	session, err := sessionStore.RotateRefreshToken(refreshClaims.TokenID, newAccessToken, newRefreshToken, newTokenID, refreshExpiresAt)
+	if stderrors.Is(err, auth.ErrRefreshTokenReused) {
+		logger.Log.Warn("Refresh token reused, session revoked",
+			zap.Uint("user_id", refreshClaims.UserID),
+			zap.String("session_id", session.ID),
+			zap.String("client_ip", logger.GetClientIP(r)))
+		audit.LogRefreshTokenReuse(r.Context(), refreshClaims.UserID, session.ID)
+		errors.WriteUnauthorized(w, "Invalid or expired refresh token")
+		return
+	}
+	if err != nil {
+		logger.Log.Debug("Refresh token rotation failed", zap.Uint("user_id", refreshClaims.UserID), zap.Error(err))
+		errors.WriteUnauthorized(w, "Invalid or expired refresh token")
+		return
+	}
+	sessionStore.RecordUse(session.ID, logger.GetClientIP(r), r.UserAgent())
 
 	// Set new refresh token cookie
 	isHTTPS := r.Header.Get("X-Forwarded-Proto") == "https" || r.TLS != nil
@@ -927,6 +978,135 @@ func (h *Handler) HandleRefreshToken(w http.ResponseWriter, r *http.Request, cfg
 	json.NewEncoder(w).Encode(response)
 }
 
+// SessionInfo describes one of the user's login sessions.
+type SessionInfo struct {
+	ID         string    `json:"id"`
+	ClientIP   string    `json:"client_ip"`
+	UserAgent  string    `json:"user_agent"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"` // The session making the request
+}
+
+// HandleListSessions handles GET /api/auth/sessions - List the user's active sessions.
+// @Summary     List my sessions
+// @Description Lists the current user's active login sessions (devices), most recently used first
+// @Tags        Authentication
+// @Produce     json
+// @Success     200  {object}  map[string]interface{}  "sessions: []SessionInfo"
+// @Failure     401  {object}  map[string]interface{}  "Authentication required"
+// @Security    BearerAuth
+// @Router      /auth/sessions [get]
+func (h *Handler) HandleListSessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		errors.WriteUnauthorized(w, "Authentication required")
+		return
+	}
+
+	sessionStore := auth.GetSessionStore()
+	sessions, err := sessionStore.ListUserSessions(userID)
+	if err != nil {
+		logger.Log.Error("Failed to list sessions", zap.Uint("user_id", userID), zap.Error(err))
+		errors.WriteInternalError(w, err, false)
+		return
+	}
+
+	currentID := ""
+	if cookie, err := r.Cookie("refresh_token"); err == nil {
+		if current, ok := sessionStore.GetSessionByRefreshToken(cookie.Value); ok {
+			currentID = current.ID
+		}
+	}
+
+	infos := make([]SessionInfo, 0, len(sessions))
+	for _, session := range sessions {
+		infos = append(infos, SessionInfo{
+			ID:         session.ID,
+			ClientIP:   session.ClientIP,
+			UserAgent:  session.UserAgent,
+			CreatedAt:  session.CreatedAt,
+			LastUsedAt: session.LastUsedAt,
+			ExpiresAt:  session.ExpiresAt,
+			Current:    session.ID == currentID,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"sessions": infos,
+	})
+}
+
+// HandleRevokeSession handles DELETE /api/auth/sessions/{id} - Revoke one of the user's sessions.
+// @Summary     Revoke a session
+// @Description Logs out one of the current user's sessions, e.g. a lost device. Its refresh token stops working
+// @Description immediately; access tokens already issued expire within 15 minutes.
+// @Tags        Authentication
+// @Produce     json
+// @Param       id path string true "Session ID"
+// @Success     200  {object}  map[string]interface{}  "Session revoked"
+// @Failure     401  {object}  map[string]interface{}  "Authentication required"
+// @Failure     404  {object}  map[string]interface{}  "Session not found"
+// @Security    BearerAuth
+// @Router      /auth/sessions/{id} [delete]
+func (h *Handler) HandleRevokeSession(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		errors.WriteUnauthorized(w, "Authentication required")
+		return
+	}
+
+	sessionID := chi.URLParam(r, "id")
+	sessionStore := auth.GetSessionStore()
+	session, exists := sessionStore.GetSession(sessionID)
+	if !exists || session.UserID != userID {
+		errors.WriteNotFound(w, "Session")
+		return
+	}
+	sessionStore.DeleteSession(session.ID)
+
+	logger.Log.Info("Session revoked by user", zap.Uint("user_id", userID), zap.String("session_id", session.ID))
+	audit.LogSessionRevoke(r.Context(), userID, session.ID, "user", 1)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Session revoked",
+	})
+}
+
+// HandleJWKS publishes the public keys verifying LIMEN's JWTs.
+// @Summary JSON Web Key Set
+// @Description Ed25519 public keys verifying access and refresh tokens, matched by the tokens'
+// @Description "kid" header. During a key rotation both the current and previous keys are listed.
+// @Description Empty while tokens are signed with the legacy HMAC secret.
+// @Tags auth
+// @Produce json
+// @Success 200 {object} auth.JWKS
+// @Router /.well-known/jwks.json [get]
+func (h *Handler) HandleJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(auth.KeysFor(h.Config).JWKS())
+}
+
+// writeLoginBlocked refuses a login attempt blocked by the login guard.
+func writeLoginBlocked(w http.ResponseWriter, decision security.LoginDecision, userID uint, clientIP string) {
+	metrics.AuthFailureTotal.WithLabelValues(string(decision.Block)).Inc()
+	retryAfter := int(decision.RetryAfter().Seconds()) + 1
+	w.Header().Set("Retry-After", fmt.Sprintf("%d", retryAfter))
+	if decision.Block == security.LoginThrottled {
+		errors.WriteTooManyRequests(w, fmt.Sprintf("Too many failed attempts. Try again in %d seconds", retryAfter))
+		return
+	}
+	logger.Log.Warn("Login refused by lockout",
+		zap.String("reason", string(decision.Block)),
+		zap.Uint("user_id", userID),
+		zap.String("ip", clientIP))
+	errors.WriteForbidden(w, fmt.Sprintf("Account locked due to too many failed attempts. Try again after %s", decision.Until.Format(time.RFC3339)))
+}
+
 // Helper function for min
 func min(a, b int) int {
 	if a < b {
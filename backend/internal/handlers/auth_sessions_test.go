@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DARC0625/LIMEN/backend/internal/auth"
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+)
+
+func TestAuthSessions_ListAndRevoke(t *testing.T) {
+	h := setupTestImageHandler(t)
+	if err := h.DB.AutoMigrate(&models.AuthSession{}, &models.AuthRefreshToken{}); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+	store := auth.NewDBSessionStore(h.DB)
+	auth.SetSessionStore(store)
+	t.Cleanup(func() { auth.SetSessionStore(auth.NewSessionStore()) })
+
+	alice := models.User{Username: "alice", Password: "x", Role: models.RoleUser, Approved: true}
+	h.DB.Create(&alice)
+	expiresAt := time.Now().Add(time.Hour)
+	laptop, _ := store.CreateSession("a1", "refresh-laptop", "t1", "c1", alice.ID, "alice", "user", expiresAt)
+	phone, _ := store.CreateSession("a2", "refresh-phone", "t2", "c2", alice.ID, "alice", "user", expiresAt)
+	bob, _ := store.CreateSession("a3", "refresh-bob", "t3", "c3", alice.ID+1, "bob", "user", expiresAt)
+
+	req := imageRequest("GET", "/api/auth/sessions", nil, alice.ID, "user", nil)
+	req.AddCookie(&http.Cookie{Name: "refresh_token", Value: "refresh-laptop"})
+	w := httptest.NewRecorder()
+	h.HandleListSessions(w, req)
+	var list struct {
+		Sessions []SessionInfo `json:"sessions"`
+	}
+	json.NewDecoder(w.Body).Decode(&list)
+	if w.Code != http.StatusOK || len(list.Sessions) != 2 {
+		t.Fatalf("list = %d %+v, want 2 sessions", w.Code, list)
+	}
+	for _, s := range list.Sessions {
+		if s.Current != (s.ID == laptop.ID) {
+			t.Errorf("session %s current = %v", s.ID, s.Current)
+		}
+	}
+
+	// Other users' sessions can't be revoked
+	w = httptest.NewRecorder()
+	h.HandleRevokeSession(w, imageRequest("DELETE", "/api/auth/sessions/"+bob.ID, nil, alice.ID, "user", map[string]string{"id": bob.ID}))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("revoke other user's session = %d, want 404", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	h.HandleRevokeSession(w, imageRequest("DELETE", "/api/auth/sessions/"+phone.ID, nil, alice.ID, "user", map[string]string{"id": phone.ID}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("revoke = %d: %s", w.Code, w.Body.String())
+	}
+	if _, ok := store.GetSessionByRefreshToken("refresh-phone"); ok {
+		t.Error("revoked session still active")
+	}
+
+	// Changing the role logs the user out everywhere
+	body := []byte(`{"role":"admin"}`)
+	w = httptest.NewRecorder()
+	h.HandleUpdateUserRole(w, imageRequest("PUT", "/api/admin/users/1/role", body, 99, "admin", map[string]string{"id": "1"}), h.Config)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update role = %d: %s", w.Code, w.Body.String())
+	}
+	if _, ok := store.GetSession(laptop.ID); ok {
+		t.Error("session still active after role change")
+	}
+	if _, ok := store.GetSession(bob.ID); !ok {
+		t.Error("other user's session revoked")
+	}
+	var logs int64
+	h.DB.Model(&models.AuditLog{}).Where("action = ?", "auth.session_revoke").Count(&logs)
+	if logs != 2 {
+		t.Errorf("session revocation audit logs = %d, want 2", logs)
+	}
+
+	w = httptest.NewRecorder()
+	h.HandleRevokeUserSessions(w, imageRequest("DELETE", "/api/admin/users/2/sessions", nil, 99, "admin", map[string]string{"id": "2"}))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("revoke sessions of unknown user = %d, want 404", w.Code)
+	}
+}
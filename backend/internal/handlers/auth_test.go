@@ -16,6 +16,7 @@ import (
 	"github.com/DARC0625/LIMEN/backend/internal/config"
 	"github.com/DARC0625/LIMEN/backend/internal/database"
 	"github.com/DARC0625/LIMEN/backend/internal/logger"
+	"github.com/DARC0625/LIMEN/backend/internal/mail"
 	"github.com/DARC0625/LIMEN/backend/internal/models"
 	"github.com/DARC0625/LIMEN/backend/internal/security"
 	"gorm.io/driver/sqlite"
@@ -34,7 +35,9 @@ func setupTestAuthHandler(t *testing.T) (*Handler, *config.Config) {
 		t.Fatalf("Failed to open test database: %v", err)
 	}
 
-	if err := db.AutoMigrate(&models.User{}, &models.VM{}, &models.AuditLog{}); err != nil {
+	if err := db.AutoMigrate(&models.User{}, &models.VM{}, &models.AuditLog{},
+		&models.AuthSession{}, &models.AuthRefreshToken{}, &models.LoginFailure{},
+		&models.UserMFA{}, &models.MFARecoveryCode{}, &models.MFARolePolicy{}, &models.WebAuthnCredential{}, &models.ExternalIdentity{}, &models.APIToken{}, &models.Role{}); err != nil {
 		t.Fatalf("Failed to migrate test database: %v", err)
 	}
 
@@ -49,12 +52,17 @@ func setupTestAuthHandler(t *testing.T) (*Handler, *config.Config) {
 	}
 
 	handler := &Handler{
-		DB:     db,
-		Config: cfg,
+		DB:            db,
+		Config:        cfg,
+		LoginGuard:    security.NewLoginGuard(db, security.DefaultUserSecurityPolicy(), nil),
+		MFA:           auth.NewMFAManager(db, "LIMEN", cfg.JWTSecret, nil),
+		Authenticator: auth.NewLocalAuthenticator(db),
+		Accounts:      auth.NewAccountManager(db, cfg.JWTSecret),
+		Mail:          mail.NewLogSender(logger.Log),
 	}
 
 	// Initialize session store
-	auth.GetSessionStore()
+	auth.SetSessionStore(auth.NewDBSessionStore(db))
 
 	return handler, cfg
 }
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DARC0625/LIMEN/backend/internal/auth"
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// directoryStub is a user directory holding carol, which creates her LIMEN user and
+// its link at her first login, or an unavailable one.
+type directoryStub struct {
+	db   *gorm.DB
+	down bool
+}
+
+func (d *directoryStub) Name() string { return "stub" }
+
+func (d *directoryStub) Authenticate(ctx context.Context, username, password string) (*models.User, error) {
+	switch {
+	case d.down:
+		return nil, errors.New("connection refused")
+	case username != "carol":
+		return nil, auth.ErrUnknownUser
+	case password != "directory-password":
+		return nil, auth.ErrInvalidCredentials
+	}
+	user := models.User{Username: "carol", Password: "unusable", Role: models.RoleUser, Approved: true}
+	if err := d.db.Where("username = ?", "carol").FirstOrCreate(&user).Error; err != nil {
+		return nil, err
+	}
+	link := models.ExternalIdentity{UserID: user.ID, Issuer: "stub", Subject: "carol"}
+	return &user, d.db.Where(&link).FirstOrCreate(&link).Error
+}
+
+func TestHandleLogin_Authenticator(t *testing.T) {
+	h := setupTestImageHandler(t)
+	if err := h.DB.AutoMigrate(&models.LoginFailure{}, &models.AuthSession{}, &models.AuthRefreshToken{}); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+	auth.SetSessionStore(auth.NewDBSessionStore(h.DB))
+	t.Cleanup(func() { auth.SetSessionStore(auth.NewSessionStore()) })
+	h.Config.JWTSecret = "test-secret"
+	directory := &directoryStub{db: h.DB}
+	h.Authenticator = auth.ChainAuthenticator{auth.NewLocalAuthenticator(h.DB), directory}
+
+	login := func(username, password string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(LoginRequest{Username: username, Password: password})
+		w := httptest.NewRecorder()
+		h.HandleLogin(w, httptest.NewRequest("POST", "/api/auth/login", bytes.NewReader(body)), h.Config)
+		return w
+	}
+
+	// Users of the directory log in before they exist in LIMEN
+	if w := login("carol", "directory-password"); w.Code != http.StatusOK || !bytes.Contains(w.Body.Bytes(), []byte(`"access_token"`)) {
+		t.Fatalf("directory login = %d: %s", w.Code, w.Body.String())
+	}
+	if w := login("carol", "wrong"); w.Code != http.StatusUnauthorized {
+		t.Errorf("wrong password = %d, want 401", w.Code)
+	}
+
+	// A directory that can't tell isn't a failed attempt
+	directory.down = true
+	if w := login("carol", "directory-password"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("login with the directory down = %d, want 503", w.Code)
+	}
+	var failures int64
+	h.DB.Model(&models.LoginFailure{}).Count(&failures)
+	if failures != 1 {
+		t.Errorf("failed attempts = %d, want 1", failures)
+	}
+}
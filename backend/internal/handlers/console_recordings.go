@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/DARC0625/LIMEN/backend/internal/audit"
+	"github.com/DARC0625/LIMEN/backend/internal/errors"
+	"github.com/DARC0625/LIMEN/backend/internal/logger"
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"github.com/DARC0625/LIMEN/backend/internal/recording"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// startConsoleRecording starts recording a console session if the recording policy
+// (CONSOLE_RECORDING) covers the VM. It returns nil when the session isn't recorded;
+// a recording failure is logged and never blocks the console.
+func (h *Handler) startConsoleRecording(vmRec *models.VM, sessionID string, userID uint, protocol string) *recording.Recorder {
+	if h.Recordings == nil {
+		return nil
+	}
+	switch h.Config.ConsoleRecording {
+	case "all":
+	case "opt-in", "":
+		if !vmRec.RecordConsole {
+			return nil
+		}
+	default:
+		return nil
+	}
+
+	rec, err := h.Recordings.Start(sessionID, vmRec.UUID, userID, protocol)
+	if err != nil {
+		logger.Log.Error("Failed to start console recording; session continues unrecorded",
+			zap.Error(err),
+			zap.String("session_id", sessionID),
+			zap.String("vm_uuid", vmRec.UUID))
+		return nil
+	}
+	return rec
+}
+
+// HandleListConsoleRecordings lists console session recordings, newest first.
+// @Summary List console recordings
+// @Tags admin
+// @Produce json
+// @Param vm_uuid query string false "Filter by VM UUID"
+// @Param user_id query int false "Filter by user ID"
+// @Param session_id query string false "Filter by console session ID"
+// @Param limit query int false "Maximum number of recordings (default 100)"
+// @Success 200 {array} models.ConsoleRecording
+// @Security BearerAuth
+// @Router /admin/console-recordings [get]
+func (h *Handler) HandleListConsoleRecordings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		errors.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+
+	q := r.URL.Query()
+	filter := recording.ListFilter{
+		VMUUID:    q.Get("vm_uuid"),
+		SessionID: q.Get("session_id"),
+		Limit:     100,
+	}
+	if v := q.Get("user_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			errors.WriteBadRequest(w, "Invalid user_id", err)
+			return
+		}
+		filter.UserID = uint(id)
+	}
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			errors.WriteBadRequest(w, "Invalid limit", err)
+			return
+		}
+		if limit < filter.Limit {
+			filter.Limit = limit
+		}
+	}
+
+	recs, err := h.Recordings.List(filter)
+	if err != nil {
+		logger.Log.Error("Failed to list console recordings", zap.Error(err))
+		errors.WriteInternalError(w, err, h.Config.Env == "development")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(recs)
+}
+
+// HandlePlayConsoleRecording streams a recording's frames for playback in the browser.
+// @Summary Play back a console recording
+// @Description Streams the recording as newline-delimited JSON, one frame per line:
+// @Description {"t": seconds since start, "dir": "o" (VM output) or "i" (client input), "data": base64}.
+// @Description VNC recordings carry the raw RFB stream and can be replayed with an RFB decoder.
+// @Tags admin
+// @Produce application/x-ndjson
+// @Param id path int true "Recording ID"
+// @Success 200 {string} string "Recorded frames"
+// @Failure 404 {object} map[string]interface{} "Recording not found"
+// @Security BearerAuth
+// @Router /admin/console-recordings/{id}/playback [get]
+func (h *Handler) HandlePlayConsoleRecording(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		errors.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+
+	rec, reader, closer, ok := h.openConsoleRecording(w, r)
+	if !ok {
+		return
+	}
+	defer closer.Close()
+	audit.LogConsoleRecordingAccess(r.Context(), rec.ID, rec.SessionID, rec.VMUUID, "playback")
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	if err := recording.WriteNDJSON(w, reader); err != nil {
+		// Headers are already sent; the client sees a short stream
+		logger.Log.Warn("Console recording playback failed", zap.Uint("recording_id", rec.ID), zap.Error(err))
+	}
+}
+
+// HandleDownloadConsoleRecording downloads a decrypted recording. Serial recordings are
+// exported as asciicast v2 (playable with asciinema), VNC recordings as NDJSON frames.
+// @Summary Download a console recording
+// @Tags admin
+// @Produce application/x-asciicast,application/x-ndjson
+// @Param id path int true "Recording ID"
+// @Success 200 {file} file "Recording"
+// @Failure 404 {object} map[string]interface{} "Recording not found"
+// @Security BearerAuth
+// @Router /admin/console-recordings/{id}/download [get]
+func (h *Handler) HandleDownloadConsoleRecording(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		errors.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+
+	rec, reader, closer, ok := h.openConsoleRecording(w, r)
+	if !ok {
+		return
+	}
+	defer closer.Close()
+
+	contentType, ext := "application/x-ndjson", "ndjson"
+	if rec.Protocol == "serial" {
+		contentType, ext = "application/x-asciicast", "cast"
+	}
+	audit.LogConsoleRecordingAccess(r.Context(), rec.ID, rec.SessionID, rec.VMUUID, "download")
+
+	// Streamed, as recordings can be large: a corrupt recording ends the download early
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="console-%s-%s.%s"`,
+		rec.StartedAt.Format("20060102-150405"), rec.SessionID, ext))
+	var err error
+	if rec.Protocol == "serial" {
+		err = recording.WriteAsciicast(w, reader, rec)
+	} else {
+		err = recording.WriteNDJSON(w, reader)
+	}
+	if err != nil {
+		logger.Log.Warn("Console recording download failed", zap.Uint("recording_id", rec.ID), zap.Error(err))
+	}
+}
+
+// openConsoleRecording looks up the recording named by the id URL parameter and opens it.
+// On failure the error response has been written.
+func (h *Handler) openConsoleRecording(w http.ResponseWriter, r *http.Request) (*models.ConsoleRecording, *recording.Reader, io.Closer, bool) {
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		errors.WriteBadRequest(w, "Invalid recording ID", err)
+		return nil, nil, nil, false
+	}
+
+	rec, err := h.Recordings.Get(uint(id))
+	if err == nil {
+		var reader *recording.Reader
+		var closer io.Closer
+		if reader, closer, err = h.Recordings.Open(rec); err == nil {
+			return rec, reader, closer, true
+		}
+	}
+
+	switch {
+	case stderrors.Is(err, recording.ErrRecordingNotFound):
+		errors.WriteNotFound(w, "Recording")
+	case stderrors.Is(err, recording.ErrKeyRequired):
+		errors.WriteError(w, http.StatusServiceUnavailable, "Recording is encrypted and CONSOLE_RECORDING_KEY is not set", err)
+	default:
+		logger.Log.Error("Failed to open console recording", zap.Uint64("recording_id", id), zap.Error(err))
+		errors.WriteInternalError(w, err, h.Config.Env == "development")
+	}
+	return nil, nil, nil, false
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"github.com/DARC0625/LIMEN/backend/internal/recording"
+)
+
+func TestStartConsoleRecording_Policy(t *testing.T) {
+	h := setupTestImageHandler(t)
+	optedIn := &models.VM{UUID: "vm-opted-in", RecordConsole: true}
+	plain := &models.VM{UUID: "vm-plain"}
+
+	tests := []struct {
+		policy string
+		vm     *models.VM
+		want   bool
+	}{
+		{"opt-in", optedIn, true},
+		{"opt-in", plain, false},
+		{"all", plain, true},
+		{"off", optedIn, false},
+	}
+	for _, tt := range tests {
+		h.Config.ConsoleRecording = tt.policy
+		rec := h.startConsoleRecording(tt.vm, "sess-"+tt.policy, 1, "serial")
+		if (rec != nil) != tt.want {
+			t.Errorf("policy %s, record_console=%v: recording = %v, want %v", tt.policy, tt.vm.RecordConsole, rec != nil, tt.want)
+		}
+		rec.Close()
+	}
+}
+
+func TestConsoleRecordingEndpoints(t *testing.T) {
+	h := setupTestImageHandler(t)
+	h.Recordings = recording.NewStore(h.DB, t.TempDir(), bytes.Repeat([]byte{9}, 32), 0, 0)
+
+	serial, _ := h.Recordings.Start("sess-serial", "vm-1", 2, "serial")
+	serial.Record(recording.Output, []byte("login: "))
+	serial.Record(recording.Input, []byte("root\r"))
+	serial.Close()
+	vnc, _ := h.Recordings.Start("sess-vnc", "vm-2", 3, "vnc")
+	vnc.Record(recording.Output, []byte("RFB 003.008\n"))
+	vnc.Close()
+
+	t.Run("list", func(t *testing.T) {
+		req := imageRequest(http.MethodGet, "/api/admin/console-recordings?vm_uuid=vm-1", nil, 1, "admin", nil)
+		w := httptest.NewRecorder()
+		h.HandleListConsoleRecordings(w, req)
+		var recs []models.ConsoleRecording
+		json.Unmarshal(w.Body.Bytes(), &recs)
+		if w.Code != http.StatusOK || len(recs) != 1 || recs[0].SessionID != "sess-serial" {
+			t.Fatalf("list = %d %s", w.Code, w.Body.String())
+		}
+		if strings.Contains(w.Body.String(), h.Config.ConsoleRecordingDir) || !recs[0].Encrypted {
+			t.Errorf("unexpected recording listing %s", w.Body.String())
+		}
+	})
+
+	t.Run("playback", func(t *testing.T) {
+		req := imageRequest(http.MethodGet, "/", nil, 1, "admin", map[string]string{"id": "2"})
+		w := httptest.NewRecorder()
+		h.HandlePlayConsoleRecording(w, req)
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/x-ndjson" {
+			t.Fatalf("playback = %d %s", w.Code, w.Body.String())
+		}
+		var frame struct {
+			Dir  string `json:"dir"`
+			Data []byte `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &frame)
+		if frame.Dir != "o" || string(frame.Data) != "RFB 003.008\n" {
+			t.Errorf("frame = %+v", frame)
+		}
+	})
+
+	t.Run("download serial as asciicast", func(t *testing.T) {
+		req := imageRequest(http.MethodGet, "/", nil, 1, "admin", map[string]string{"id": "1"})
+		w := httptest.NewRecorder()
+		h.HandleDownloadConsoleRecording(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("download = %d %s", w.Code, w.Body.String())
+		}
+		if !strings.Contains(w.Header().Get("Content-Disposition"), ".cast") ||
+			!strings.Contains(w.Body.String(), `"login: "`) {
+			t.Errorf("unexpected download %q: %s", w.Header().Get("Content-Disposition"), w.Body.String())
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		req := imageRequest(http.MethodGet, "/", nil, 1, "admin", map[string]string{"id": "99"})
+		w := httptest.NewRecorder()
+		h.HandlePlayConsoleRecording(w, req)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("status = %d, want 404", w.Code)
+		}
+	})
+
+	t.Run("key not configured", func(t *testing.T) {
+		h.Recordings = recording.NewStore(h.DB, t.TempDir(), nil, 0, 0)
+		req := imageRequest(http.MethodGet, "/", nil, 1, "admin", map[string]string{"id": "1"})
+		w := httptest.NewRecorder()
+		h.HandleDownloadConsoleRecording(w, req)
+		if w.Code != http.StatusServiceUnavailable {
+			t.Errorf("status = %d, want 503", w.Code)
+		}
+	})
+}
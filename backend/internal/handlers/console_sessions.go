@@ -0,0 +1,381 @@
+package handlers
+
+import (
+	"encoding/json"
+	stderrors "errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/DARC0625/LIMEN/backend/internal/audit"
+	"github.com/DARC0625/LIMEN/backend/internal/errors"
+	"github.com/DARC0625/LIMEN/backend/internal/logger"
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"github.com/DARC0625/LIMEN/backend/internal/session"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// adminConsoleSessionView is a console session as seen by administrators: the persisted
+// record, plus live state from the session manager while the session is running.
+type adminConsoleSessionView struct {
+	SessionID      string                 `json:"session_id"`
+	UserID         uint                   `json:"user_id"`
+	VMID           uint                   `json:"vm_id"`
+	VMUUID         string                 `json:"vm_uuid"`
+	Protocol       string                 `json:"protocol,omitempty"`
+	ClientIP       string                 `json:"client_ip"`
+	UserAgent      string                 `json:"user_agent"`
+	StartedAt      time.Time              `json:"started_at"`
+	LastActivityAt time.Time              `json:"last_activity_at"`
+	EndedAt        *time.Time             `json:"ended_at,omitempty"`
+	EndReason      string                 `json:"end_reason,omitempty"`
+	Live           bool                   `json:"live"`                   // Running on this server
+	Limits         *consoleLimitsView     `json:"limits,omitempty"`       // Limits the live session runs under
+	Participants   []*session.Participant `json:"participants,omitempty"` // Users who joined a live session through a share
+}
+
+// consoleLimitsView is the API representation of session.Limits.
+type consoleLimitsView struct {
+	MaxIdleMinutes         int `json:"max_idle_minutes"`
+	MaxDurationMinutes     int `json:"max_duration_minutes"`
+	MaxConcurrent          int `json:"max_concurrent"`
+	ReconnectWindowSeconds int `json:"reconnect_window_seconds"`
+}
+
+func newConsoleLimitsView(l session.Limits) *consoleLimitsView {
+	return &consoleLimitsView{
+		MaxIdleMinutes:         int(l.MaxIdle / time.Minute),
+		MaxDurationMinutes:     int(l.MaxDuration / time.Minute),
+		MaxConcurrent:          l.MaxConcurrent,
+		ReconnectWindowSeconds: int(l.ReconnectWindow / time.Second),
+	}
+}
+
+// ConsoleSessionLimitRequest sets the console session limits for a role or a user.
+type ConsoleSessionLimitRequest struct {
+	Role                   string `json:"role,omitempty" example:"user"` // Role to limit; set either role or user_id
+	UserID                 uint   `json:"user_id,omitempty" example:"5"` // User to limit
+	MaxIdleMinutes         int    `json:"max_idle_minutes" example:"30"` // 0 inherits
+	MaxDurationMinutes     int    `json:"max_duration_minutes" example:"480"`
+	MaxConcurrent          int    `json:"max_concurrent" example:"3"`
+	ReconnectWindowSeconds int    `json:"reconnect_window_seconds" example:"30"`
+}
+
+// adminConsoleSessionFromRecord builds the admin view of a persisted session.
+func adminConsoleSessionFromRecord(rec models.ConsoleSession) adminConsoleSessionView {
+	view := adminConsoleSessionView{
+		SessionID:      rec.SessionID,
+		UserID:         rec.UserID,
+		VMID:           rec.VMID,
+		VMUUID:         rec.VMUUID,
+		Protocol:       rec.Protocol,
+		ClientIP:       rec.ClientIP,
+		UserAgent:      rec.UserAgent,
+		StartedAt:      rec.StartedAt,
+		LastActivityAt: rec.LastActivityAt,
+		EndedAt:        rec.EndedAt,
+		EndReason:      rec.EndReason,
+	}
+
+	sessionMgr := session.GetSessionManager()
+	if sess, ok := sessionMgr.GetSession(rec.SessionID); ok {
+		view.Live = true
+		view.Limits = newConsoleLimitsView(sess.Limits)
+		view.Participants, _ = sessionMgr.Participants(rec.SessionID)
+	}
+	return view
+}
+
+// HandleListConsoleSessions lists live and historical console sessions, newest first.
+// @Summary List console sessions
+// @Description Persisted console sessions with live state. Sessions left open by a server restart
+// @Description have no ended_at but are not live.
+// @Tags admin
+// @Produce json
+// @Param status query string false "live, ended or all (default)"
+// @Param user_id query int false "Filter by user ID"
+// @Param vm_uuid query string false "Filter by VM UUID"
+// @Param client_ip query string false "Filter by client IP"
+// @Param since query string false "Sessions started at or after this time (RFC 3339)"
+// @Param until query string false "Sessions started before this time (RFC 3339)"
+// @Param limit query int false "Maximum number of sessions (default 100, max 1000)"
+// @Success 200 {array} adminConsoleSessionView
+// @Failure 400 {object} map[string]interface{} "Invalid filter"
+// @Security BearerAuth
+// @Router /admin/console-sessions [get]
+func (h *Handler) HandleListConsoleSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		errors.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+
+	q := r.URL.Query()
+	query := h.DB.Model(&models.ConsoleSession{})
+
+	switch q.Get("status") {
+	case "", "all":
+	case "live":
+		var live []string
+		for _, sess := range session.GetSessionManager().ListSessions() {
+			live = append(live, sess.SessionID)
+		}
+		if len(live) == 0 {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode([]adminConsoleSessionView{})
+			return
+		}
+		query = query.Where("session_id IN ?", live)
+	case "ended":
+		query = query.Where("ended_at IS NOT NULL")
+	default:
+		errors.WriteBadRequest(w, "Invalid status: use live, ended or all", nil)
+		return
+	}
+
+	if v := q.Get("user_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			errors.WriteBadRequest(w, "Invalid user_id", err)
+			return
+		}
+		query = query.Where("user_id = ?", uint(id))
+	}
+	if v := q.Get("vm_uuid"); v != "" {
+		query = query.Where("vm_uuid = ?", v)
+	}
+	if v := q.Get("client_ip"); v != "" {
+		query = query.Where("client_ip = ?", v)
+	}
+	if v := q.Get("since"); v != "" {
+		since, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			errors.WriteBadRequest(w, "Invalid since: use RFC 3339", err)
+			return
+		}
+		query = query.Where("started_at >= ?", since)
+	}
+	if v := q.Get("until"); v != "" {
+		until, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			errors.WriteBadRequest(w, "Invalid until: use RFC 3339", err)
+			return
+		}
+		query = query.Where("started_at < ?", until)
+	}
+
+	limit := 100
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			errors.WriteBadRequest(w, "Invalid limit", err)
+			return
+		}
+		limit = n
+		if limit > 1000 {
+			limit = 1000
+		}
+	}
+
+	var records []models.ConsoleSession
+	if err := query.Order("started_at DESC").Limit(limit).Find(&records).Error; err != nil {
+		logger.Log.Error("Failed to list console sessions", zap.Error(err))
+		errors.WriteInternalError(w, err, h.Config.Env == "development")
+		return
+	}
+
+	views := make([]adminConsoleSessionView, 0, len(records))
+	for _, rec := range records {
+		views = append(views, adminConsoleSessionFromRecord(rec))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(views)
+}
+
+// HandleGetConsoleSession returns one console session, with its participants if it is live.
+// @Summary Get a console session
+// @Tags admin
+// @Produce json
+// @Param session_id path string true "Console session ID"
+// @Success 200 {object} adminConsoleSessionView
+// @Failure 404 {object} map[string]interface{} "Session not found"
+// @Security BearerAuth
+// @Router /admin/console-sessions/{session_id} [get]
+func (h *Handler) HandleGetConsoleSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		errors.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+
+	var rec models.ConsoleSession
+	if err := h.DB.Where("session_id = ?", chi.URLParam(r, "session_id")).First(&rec).Error; err != nil {
+		if stderrors.Is(err, gorm.ErrRecordNotFound) {
+			errors.WriteNotFound(w, "Console session")
+			return
+		}
+		errors.WriteInternalError(w, err, h.Config.Env == "development")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(adminConsoleSessionFromRecord(rec))
+}
+
+// HandleTerminateConsoleSession force-ends a live console session.
+// @Summary Terminate a console session
+// @Description Disconnects the owner and every participant. The clients are closed with SESSION_TERMINATED
+// @Description and the session is recorded as ended with reason admin_terminated.
+// @Tags admin
+// @Param session_id path string true "Console session ID"
+// @Success 204 "Session terminated"
+// @Failure 404 {object} map[string]interface{} "No live session with this ID"
+// @Security BearerAuth
+// @Router /admin/console-sessions/{session_id} [delete]
+func (h *Handler) HandleTerminateConsoleSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "DELETE" {
+		errors.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+
+	sessionMgr := session.GetSessionManager()
+	sess, ok := sessionMgr.GetSession(chi.URLParam(r, "session_id"))
+	if !ok {
+		errors.WriteNotFound(w, "Live console session")
+		return
+	}
+	if err := sessionMgr.TerminateSession(sess.SessionID); err != nil {
+		// Ended on its own in the meantime
+		errors.WriteNotFound(w, "Live console session")
+		return
+	}
+	audit.LogConsoleSessionTerminate(r.Context(), sess.SessionID, sess.VMUUID, sess.UserID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleListConsoleSessionLimits returns the server default console session limits and the
+// per-role and per-user overrides.
+// @Summary List console session limits
+// @Tags admin
+// @Produce json
+// @Success 200 {object} map[string]interface{} "defaults and overrides"
+// @Security BearerAuth
+// @Router /admin/console-session-limits [get]
+func (h *Handler) HandleListConsoleSessionLimits(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		errors.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+
+	var overrides []models.ConsoleSessionLimit
+	if err := h.DB.Order("role DESC, user_id").Find(&overrides).Error; err != nil {
+		logger.Log.Error("Failed to list console session limits", zap.Error(err))
+		errors.WriteInternalError(w, err, h.Config.Env == "development")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"defaults":  newConsoleLimitsView(session.GetSessionManager().DefaultLimits()),
+		"overrides": overrides,
+	})
+}
+
+// HandleSetConsoleSessionLimit creates or replaces the console session limits for a role or a user.
+// @Summary Set console session limits
+// @Description Limits resolve user -> role -> server default, field by field; 0 inherits.
+// @Description Changes apply to sessions started afterwards.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param request body ConsoleSessionLimitRequest true "Limits"
+// @Success 200 {object} models.ConsoleSessionLimit
+// @Failure 400 {object} map[string]interface{} "Invalid request"
+// @Failure 404 {object} map[string]interface{} "User not found"
+// @Security BearerAuth
+// @Router /admin/console-session-limits [put]
+func (h *Handler) HandleSetConsoleSessionLimit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "PUT" {
+		errors.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+
+	var req ConsoleSessionLimitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errors.WriteBadRequest(w, "Invalid request body", err)
+		return
+	}
+	if (req.Role == "") == (req.UserID == 0) {
+		errors.WriteBadRequest(w, "Set either role or user_id", nil)
+		return
+	}
+	if req.Role != "" && !h.Roles.Exists(req.Role) {
+		errors.WriteBadRequest(w, "Invalid role", nil)
+		return
+	}
+	if req.MaxIdleMinutes < 0 || req.MaxDurationMinutes < 0 || req.MaxConcurrent < 0 || req.ReconnectWindowSeconds < 0 {
+		errors.WriteBadRequest(w, "Limits must not be negative", nil)
+		return
+	}
+	if req.UserID != 0 {
+		var user models.User
+		if err := h.DB.Select("id").First(&user, req.UserID).Error; err != nil {
+			errors.WriteNotFound(w, "User")
+			return
+		}
+	}
+
+	limit := models.ConsoleSessionLimit{Role: req.Role, UserID: req.UserID}
+	if err := h.DB.Where("role = ? AND user_id = ?", req.Role, req.UserID).FirstOrInit(&limit).Error; err != nil {
+		errors.WriteInternalError(w, err, h.Config.Env == "development")
+		return
+	}
+	limit.MaxIdleMinutes = req.MaxIdleMinutes
+	limit.MaxDurationMinutes = req.MaxDurationMinutes
+	limit.MaxConcurrent = req.MaxConcurrent
+	limit.ReconnectWindowSeconds = req.ReconnectWindowSeconds
+	if err := h.DB.Save(&limit).Error; err != nil {
+		logger.Log.Error("Failed to save console session limit", zap.Error(err))
+		errors.WriteInternalError(w, err, h.Config.Env == "development")
+		return
+	}
+	audit.LogConsoleSessionLimitChange(r.Context(), limit.ID, limit.Role, limit.UserID, "set")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(limit)
+}
+
+// HandleDeleteConsoleSessionLimit removes a console session limit override.
+// @Summary Delete console session limits
+// @Tags admin
+// @Param id path int true "Override ID"
+// @Success 204 "Override removed"
+// @Failure 404 {object} map[string]interface{} "Override not found"
+// @Security BearerAuth
+// @Router /admin/console-session-limits/{id} [delete]
+func (h *Handler) HandleDeleteConsoleSessionLimit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "DELETE" {
+		errors.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		errors.WriteBadRequest(w, "Invalid limit ID", err)
+		return
+	}
+	var limit models.ConsoleSessionLimit
+	if err := h.DB.First(&limit, uint(id)).Error; err != nil {
+		errors.WriteNotFound(w, "Console session limit")
+		return
+	}
+	if err := h.DB.Delete(&limit).Error; err != nil {
+		errors.WriteInternalError(w, err, h.Config.Env == "development")
+		return
+	}
+	audit.LogConsoleSessionLimitChange(r.Context(), limit.ID, limit.Role, limit.UserID, "delete")
+
+	w.WriteHeader(http.StatusNoContent)
+}
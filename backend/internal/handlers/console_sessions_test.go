@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"github.com/DARC0625/LIMEN/backend/internal/session"
+)
+
+func TestAdminConsoleSessions(t *testing.T) {
+	h := setupTestImageHandler(t)
+	h.DB.Create(&models.User{Username: "alice", Password: "x", Role: models.RoleUser, Approved: true})
+	sessionMgr := session.GetSessionManager()
+
+	liveID, err := sessionMgr.CreateSession(1, 1, "vm-live", "vnc", "10.0.0.1", "test")
+	if err != nil {
+		t.Fatalf("CreateSession() error = %v", err)
+	}
+	defer sessionMgr.EndSession(liveID, "user_disconnect")
+	endedID, _ := sessionMgr.CreateSession(1, 2, "vm-ended", "serial", "10.0.0.2", "test")
+	sessionMgr.EndSession(endedID, "user_disconnect")
+
+	list := func(query string) []adminConsoleSessionView {
+		t.Helper()
+		req := imageRequest(http.MethodGet, "/api/admin/console-sessions?"+query, nil, 99, "admin", nil)
+		w := httptest.NewRecorder()
+		h.HandleListConsoleSessions(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("list %q = %d %s", query, w.Code, w.Body.String())
+		}
+		var views []adminConsoleSessionView
+		json.Unmarshal(w.Body.Bytes(), &views)
+		return views
+	}
+
+	if views := list("status=live"); len(views) != 1 || views[0].SessionID != liveID || !views[0].Live || views[0].Limits == nil {
+		t.Errorf("live sessions = %+v", views)
+	}
+	if views := list("status=ended"); len(views) != 1 || views[0].SessionID != endedID || views[0].EndReason != "user_disconnect" {
+		t.Errorf("ended sessions = %+v", views)
+	}
+	if views := list("client_ip=10.0.0.2"); len(views) != 1 || views[0].VMUUID != "vm-ended" {
+		t.Errorf("client_ip filter = %+v", views)
+	}
+	if views := list("since=2999-01-01T00:00:00Z"); len(views) != 0 {
+		t.Errorf("since filter = %+v", views)
+	}
+
+	req := imageRequest(http.MethodGet, "/api/admin/console-sessions?since=yesterday", nil, 99, "admin", nil)
+	w := httptest.NewRecorder()
+	h.HandleListConsoleSessions(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("invalid since = %d, want 400", w.Code)
+	}
+
+	t.Run("terminate", func(t *testing.T) {
+		sess, _ := sessionMgr.GetSession(liveID)
+		params := map[string]string{"session_id": liveID}
+		req := imageRequest(http.MethodDelete, "/", nil, 99, "admin", params)
+		w := httptest.NewRecorder()
+		h.HandleTerminateConsoleSession(w, req)
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("terminate = %d %s", w.Code, w.Body.String())
+		}
+		if !stderrors.Is(context.Cause(sess.Context()), session.ErrSessionTerminated) {
+			t.Errorf("session context cause = %v", context.Cause(sess.Context()))
+		}
+
+		req = imageRequest(http.MethodGet, "/", nil, 99, "admin", params)
+		w = httptest.NewRecorder()
+		h.HandleGetConsoleSession(w, req)
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"end_reason":"admin_terminated"`) {
+			t.Errorf("get terminated session = %d %s", w.Code, w.Body.String())
+		}
+
+		req = imageRequest(http.MethodDelete, "/", nil, 99, "admin", params)
+		w = httptest.NewRecorder()
+		h.HandleTerminateConsoleSession(w, req)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("terminate ended session = %d, want 404", w.Code)
+		}
+	})
+}
+
+func TestAdminConsoleSessionLimits(t *testing.T) {
+	h := setupTestImageHandler(t)
+	h.DB.Create(&models.User{Username: "alice", Password: "x", Role: models.RoleUser, Approved: true})
+
+	put := func(body string) *httptest.ResponseRecorder {
+		req := imageRequest(http.MethodPut, "/", []byte(body), 99, "admin", nil)
+		w := httptest.NewRecorder()
+		h.HandleSetConsoleSessionLimit(w, req)
+		return w
+	}
+
+	for _, body := range []string{
+		`{"max_concurrent":3}`,
+		`{"role":"user","user_id":1,"max_concurrent":3}`,
+		`{"role":"superuser","max_concurrent":3}`,
+		`{"user_id":1,"max_idle_minutes":-1}`,
+	} {
+		if w := put(body); w.Code != http.StatusBadRequest {
+			t.Errorf("PUT %s = %d, want 400", body, w.Code)
+		}
+	}
+	if w := put(`{"user_id":42,"max_concurrent":3}`); w.Code != http.StatusNotFound {
+		t.Errorf("unknown user = %d, want 404", w.Code)
+	}
+
+	if w := put(`{"role":"user","max_idle_minutes":30}`); w.Code != http.StatusOK {
+		t.Fatalf("set role limit = %d %s", w.Code, w.Body.String())
+	}
+	put(`{"user_id":1,"max_concurrent":1}`)
+	w := put(`{"user_id":1,"max_concurrent":4}`) // Replaces the first override
+	var limit models.ConsoleSessionLimit
+	json.Unmarshal(w.Body.Bytes(), &limit)
+
+	got := session.GetSessionManager().LimitsFor(1)
+	if got.MaxConcurrent != 4 || got.MaxIdle.Minutes() != 30 {
+		t.Errorf("LimitsFor(1) = %+v", got)
+	}
+
+	req := imageRequest(http.MethodGet, "/", nil, 99, "admin", nil)
+	w = httptest.NewRecorder()
+	h.HandleListConsoleSessionLimits(w, req)
+	var listed struct {
+		Defaults  consoleLimitsView            `json:"defaults"`
+		Overrides []models.ConsoleSessionLimit `json:"overrides"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &listed)
+	if len(listed.Overrides) != 2 || listed.Defaults.MaxConcurrent == 0 {
+		t.Errorf("limits = %s", w.Body.String())
+	}
+
+	req = imageRequest(http.MethodDelete, "/", nil, 99, "admin", map[string]string{"id": strconv.FormatUint(uint64(limit.ID), 10)})
+	w = httptest.NewRecorder()
+	h.HandleDeleteConsoleSessionLimit(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("delete = %d %s", w.Code, w.Body.String())
+	}
+	if got := session.GetSessionManager().LimitsFor(1); got.MaxConcurrent != session.GetSessionManager().DefaultLimits().MaxConcurrent {
+		t.Errorf("user override survived delete: %+v", got)
+	}
+}
@@ -0,0 +1,327 @@
+package handlers
+
+import (
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/DARC0625/LIMEN/backend/internal/audit"
+	"github.com/DARC0625/LIMEN/backend/internal/errors"
+	"github.com/DARC0625/LIMEN/backend/internal/logger"
+	"github.com/DARC0625/LIMEN/backend/internal/middleware"
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"github.com/DARC0625/LIMEN/backend/internal/session"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// CreateConsoleShareRequest invites a user, or anyone with the link, into a console session.
+type CreateConsoleShareRequest struct {
+	UserID           uint   `json:"user_id,omitempty" example:"5"`             // Invitee; omit for a share link any signed-in user can join
+	Mode             string `json:"mode" example:"view"`                       // view (input dropped) or interactive
+	ExpiresInMinutes int    `json:"expires_in_minutes,omitempty" example:"60"` // Default 60, max 1440
+}
+
+// JoinConsoleRequest joins a shared console session.
+type JoinConsoleRequest struct {
+	Token string `json:"token"` // Share token from the session owner
+}
+
+// consoleSessionView is the API representation of an active console session.
+type consoleSessionView struct {
+	SessionID      string    `json:"session_id"`
+	VMUUID         string    `json:"vm_uuid"`
+	Protocol       string    `json:"protocol"`
+	StartedAt      time.Time `json:"started_at"`
+	LastActivityAt time.Time `json:"last_activity_at"`
+	ClientIP       string    `json:"client_ip"`
+	Participants   int       `json:"participants"`
+}
+
+// ownedConsoleSession returns the session named by the session_id URL parameter if the
+// caller owns it (or is an admin). On failure the error response has been written.
+func (h *Handler) ownedConsoleSession(w http.ResponseWriter, r *http.Request) (*session.ActiveSession, uint, bool) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		errors.WriteUnauthorized(w, "Authentication required")
+		return nil, 0, false
+	}
+
+	sess, ok := session.GetSessionManager().GetSession(chi.URLParam(r, "session_id"))
+	if !ok {
+		errors.WriteNotFound(w, "Console session")
+		return nil, 0, false
+	}
+	if sess.UserID != userID && !middleware.IsAdmin(r.Context()) {
+		errors.WriteForbidden(w, "Only the session owner can manage sharing")
+		return nil, 0, false
+	}
+	return sess, userID, true
+}
+
+// HandleListMyConsoleSessions lists the caller's active console sessions.
+// @Summary List my console sessions
+// @Description Active console sessions opened by the caller, with their participant counts. Use a session ID to share the session.
+// @Tags console
+// @Produce json
+// @Success 200 {array} consoleSessionView
+// @Security BearerAuth
+// @Router /console/sessions [get]
+func (h *Handler) HandleListMyConsoleSessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		errors.WriteUnauthorized(w, "Authentication required")
+		return
+	}
+
+	sessionMgr := session.GetSessionManager()
+	views := []consoleSessionView{}
+	for _, sess := range sessionMgr.GetUserSessions(userID) {
+		participants, _ := sessionMgr.Participants(sess.SessionID)
+		views = append(views, consoleSessionView{
+			SessionID:      sess.SessionID,
+			VMUUID:         sess.VMUUID,
+			Protocol:       sess.Protocol,
+			StartedAt:      sess.StartedAt,
+			LastActivityAt: sess.LastActivityAt,
+			ClientIP:       sess.ClientIP,
+			Participants:   len(participants),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(views)
+}
+
+// HandleCreateConsoleShare shares a console session with another user or as a link.
+// @Summary Share a console session
+// @Description Invites a user (or, without user_id, anyone signed in who has the token) into the caller's
+// @Description console session. View-only participants see the console but their input is dropped.
+// @Description The invitee redeems the token at POST /console/join. Only VNC sessions can be shared.
+// @Tags console
+// @Accept json
+// @Produce json
+// @Param session_id path string true "Console session ID"
+// @Param request body CreateConsoleShareRequest true "Share settings"
+// @Success 201 {object} map[string]interface{} "Share, including its token"
+// @Failure 400 {object} map[string]interface{} "Invalid request"
+// @Failure 403 {object} map[string]interface{} "Not the session owner"
+// @Failure 404 {object} map[string]interface{} "Session or invitee not found"
+// @Security BearerAuth
+// @Router /console/sessions/{session_id}/shares [post]
+func (h *Handler) HandleCreateConsoleShare(w http.ResponseWriter, r *http.Request) {
+	sess, userID, ok := h.ownedConsoleSession(w, r)
+	if !ok {
+		return
+	}
+	if sess.Protocol != "vnc" {
+		errors.WriteBadRequest(w, "Only VNC console sessions can be shared", nil)
+		return
+	}
+
+	var req CreateConsoleShareRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errors.WriteBadRequest(w, "Invalid request body", err)
+		return
+	}
+	if req.ExpiresInMinutes == 0 {
+		req.ExpiresInMinutes = 60
+	}
+	if req.UserID != 0 {
+		if req.UserID == sess.UserID {
+			errors.WriteBadRequest(w, "The session owner can't be invited", nil)
+			return
+		}
+		if err := h.DB.Select("id").First(&models.User{}, req.UserID).Error; err != nil {
+			errors.WriteNotFound(w, "User")
+			return
+		}
+	}
+
+	share, err := session.GetSessionManager().CreateShare(sess.SessionID, req.UserID,
+		session.ShareMode(req.Mode), time.Duration(req.ExpiresInMinutes)*time.Minute)
+	if err != nil {
+		if stderrors.Is(err, session.ErrSessionNotFound) {
+			errors.WriteNotFound(w, "Console session")
+			return
+		}
+		errors.WriteBadRequest(w, err.Error(), err)
+		return
+	}
+	audit.LogConsoleShareCreate(r.Context(), userID, sess.SessionID, share.ID, share.InviteeID, string(share.Mode))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":         share.ID,
+		"session_id": share.SessionID,
+		"vm_uuid":    share.VMUUID,
+		"user_id":    share.InviteeID,
+		"mode":       share.Mode,
+		"token":      share.Token(),
+		"expires_at": share.ExpiresAt.Format(time.RFC3339),
+	})
+}
+
+// HandleListConsoleShares lists the active shares of a console session.
+// @Summary List console session shares
+// @Tags console
+// @Produce json
+// @Param session_id path string true "Console session ID"
+// @Success 200 {array} session.Share
+// @Security BearerAuth
+// @Router /console/sessions/{session_id}/shares [get]
+func (h *Handler) HandleListConsoleShares(w http.ResponseWriter, r *http.Request) {
+	sess, _, ok := h.ownedConsoleSession(w, r)
+	if !ok {
+		return
+	}
+
+	shares := session.GetSessionManager().ListShares(sess.SessionID)
+	if shares == nil {
+		shares = []*session.Share{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(shares)
+}
+
+// HandleRevokeConsoleShare revokes a share and disconnects everyone who joined through it.
+// @Summary Revoke a console session share
+// @Tags console
+// @Param session_id path string true "Console session ID"
+// @Param share_id path string true "Share ID"
+// @Success 204 "Share revoked"
+// @Failure 404 {object} map[string]interface{} "Share not found"
+// @Security BearerAuth
+// @Router /console/sessions/{session_id}/shares/{share_id} [delete]
+func (h *Handler) HandleRevokeConsoleShare(w http.ResponseWriter, r *http.Request) {
+	sess, userID, ok := h.ownedConsoleSession(w, r)
+	if !ok {
+		return
+	}
+
+	shareID := chi.URLParam(r, "share_id")
+	if err := session.GetSessionManager().RevokeShare(sess.SessionID, shareID); err != nil {
+		errors.WriteNotFound(w, "Share")
+		return
+	}
+	audit.LogConsoleShareRevoke(r.Context(), userID, sess.SessionID, shareID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleListConsoleParticipants lists who is connected to a console session.
+// @Summary List console session participants
+// @Description The session owner and every participant currently connected through a share.
+// @Tags console
+// @Produce json
+// @Param session_id path string true "Console session ID"
+// @Success 200 {object} map[string]interface{} "Owner and participants"
+// @Security BearerAuth
+// @Router /console/sessions/{session_id}/participants [get]
+func (h *Handler) HandleListConsoleParticipants(w http.ResponseWriter, r *http.Request) {
+	sess, _, ok := h.ownedConsoleSession(w, r)
+	if !ok {
+		return
+	}
+
+	participants, err := session.GetSessionManager().Participants(sess.SessionID)
+	if err != nil {
+		errors.WriteNotFound(w, "Console session")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"owner": map[string]interface{}{
+			"user_id":    sess.UserID,
+			"client_ip":  sess.ClientIP,
+			"started_at": sess.StartedAt,
+		},
+		"participants": participants,
+	})
+}
+
+// HandleRemoveConsoleParticipant disconnects a participant immediately.
+// @Summary Remove a console session participant
+// @Tags console
+// @Param session_id path string true "Console session ID"
+// @Param participant_id path string true "Participant ID"
+// @Success 204 "Participant removed"
+// @Failure 404 {object} map[string]interface{} "Participant not found"
+// @Security BearerAuth
+// @Router /console/sessions/{session_id}/participants/{participant_id} [delete]
+func (h *Handler) HandleRemoveConsoleParticipant(w http.ResponseWriter, r *http.Request) {
+	sess, _, ok := h.ownedConsoleSession(w, r)
+	if !ok {
+		return
+	}
+
+	if err := session.GetSessionManager().RemoveParticipant(sess.SessionID, chi.URLParam(r, "participant_id")); err != nil {
+		errors.WriteNotFound(w, "Participant")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleJoinConsole redeems a share token for a console ticket into the shared session.
+// @Summary Join a shared console session
+// @Description Exchanges a share token for a single-use console ticket. The returned ws_url connects to the
+// @Description shared session; view-only participants can watch but not type or click.
+// @Tags console
+// @Accept json
+// @Produce json
+// @Param request body JoinConsoleRequest true "Share token"
+// @Success 200 {object} map[string]interface{} "ws_url, mode and ticket expiry"
+// @Failure 403 {object} map[string]interface{} "Share was issued to another user"
+// @Failure 404 {object} map[string]interface{} "Share not found, expired or session ended"
+// @Security BearerAuth
+// @Router /console/join [post]
+func (h *Handler) HandleJoinConsole(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		errors.WriteUnauthorized(w, "Authentication required")
+		return
+	}
+
+	var req JoinConsoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		errors.WriteBadRequest(w, "Share token is required", err)
+		return
+	}
+
+	share, sess, err := session.GetSessionManager().ResolveShare(req.Token, userID)
+	if err != nil {
+		if stderrors.Is(err, session.ErrShareNotForUser) {
+			errors.WriteForbidden(w, "This share was issued to a different user")
+			return
+		}
+		errors.WriteNotFound(w, "Shared console session")
+		return
+	}
+
+	clientIP := h.clientIP(r)
+	ticket, expiresAt, err := h.ConsoleTickets.IssueShared(h.consoleTicketUser(r, userID), share.VMUUID, clientIP, share.ID)
+	if err != nil {
+		logger.Log.Error("Failed to issue shared console ticket", zap.Error(err))
+		errors.WriteInternalError(w, err, h.Config.Env == "development")
+		return
+	}
+
+	wsScheme, host := externalWSBase(r, "limen.kr")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ws_url":     fmt.Sprintf("%s://%s/vnc/%s?token=%s", wsScheme, host, share.VMUUID, ticket),
+		"protocol":   sess.Protocol,
+		"session_id": share.SessionID,
+		"mode":       share.Mode,
+		"expires_at": expiresAt.Format(time.RFC3339),
+	})
+
+	logger.Log.Info("Shared console ticket issued",
+		zap.String("session_id", share.SessionID),
+		zap.String("share_id", share.ID),
+		zap.Uint("user_id", userID),
+		zap.String("client_ip", clientIP))
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/DARC0625/LIMEN/backend/internal/auth"
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"github.com/DARC0625/LIMEN/backend/internal/session"
+)
+
+func TestConsoleShare_Flow(t *testing.T) {
+	h := setupTestImageHandler(t)
+	h.DB.Create(&models.User{Username: "owner", Password: "x", Role: models.RoleUser, Approved: true, BetaAccess: true})
+	h.DB.Create(&models.User{Username: "student", Password: "x", Role: models.RoleUser, Approved: true, BetaAccess: true})
+	vmRec := models.VM{Name: "shared-vm", CPU: 1, Memory: 1024, OwnerID: 1}
+	h.DB.Create(&vmRec)
+
+	sessionMgr := session.GetSessionManager()
+	sessionID, err := sessionMgr.CreateSession(1, vmRec.ID, vmRec.UUID, "vnc", "10.0.0.1", "test")
+	if err != nil {
+		t.Fatalf("CreateSession() error = %v", err)
+	}
+	defer sessionMgr.EndSession(sessionID, "user_disconnect")
+	params := map[string]string{"session_id": sessionID}
+
+	t.Run("non-owner cannot share", func(t *testing.T) {
+		req := imageRequest(http.MethodPost, "/", []byte(`{"mode":"view"}`), 2, "user", params)
+		w := httptest.NewRecorder()
+		h.HandleCreateConsoleShare(w, req)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("status = %d, want 403", w.Code)
+		}
+	})
+
+	req := imageRequest(http.MethodPost, "/", []byte(`{"user_id":2,"mode":"view","expires_in_minutes":30}`), 1, "user", params)
+	w := httptest.NewRecorder()
+	h.HandleCreateConsoleShare(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create share = %d %s", w.Code, w.Body.String())
+	}
+	var share map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &share)
+	token := share["token"].(string)
+	shareID := share["id"].(string)
+
+	t.Run("wrong invitee cannot join", func(t *testing.T) {
+		req := imageRequest(http.MethodPost, "/", []byte(`{"token":"`+token+`"}`), 3, "user", nil)
+		w := httptest.NewRecorder()
+		h.HandleJoinConsole(w, req)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("status = %d, want 403", w.Code)
+		}
+	})
+
+	t.Run("invitee joins", func(t *testing.T) {
+		req := imageRequest(http.MethodPost, "/", []byte(`{"token":"`+token+`"}`), 2, "user", nil)
+		req.RemoteAddr = "10.0.0.2:4000"
+		w := httptest.NewRecorder()
+		h.HandleJoinConsole(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("join = %d %s", w.Code, w.Body.String())
+		}
+		var resp map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		if resp["mode"] != "view" || resp["session_id"] != sessionID {
+			t.Errorf("unexpected join response %v", resp)
+		}
+		wsURL, _ := url.Parse(resp["ws_url"].(string))
+		if !strings.HasSuffix(wsURL.Path, "/vnc/"+vmRec.UUID) {
+			t.Errorf("ws_url = %s", wsURL)
+		}
+		ticket, err := h.ConsoleTickets.Redeem(wsURL.Query().Get("token"), vmRec.UUID, "10.0.0.2")
+		if err != nil {
+			t.Fatalf("Redeem() error = %v", err)
+		}
+		if ticket.ShareID != shareID || ticket.UserID != 2 {
+			t.Errorf("ticket share = %q user = %d", ticket.ShareID, ticket.UserID)
+		}
+	})
+
+	t.Run("participants", func(t *testing.T) {
+		p, err := sessionMgr.Join(shareID, 2, "student", "10.0.0.2")
+		if err != nil {
+			t.Fatalf("Join() error = %v", err)
+		}
+		req := imageRequest(http.MethodGet, "/", nil, 1, "user", params)
+		w := httptest.NewRecorder()
+		h.HandleListConsoleParticipants(w, req)
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"username":"student"`) {
+			t.Fatalf("participants = %d %s", w.Code, w.Body.String())
+		}
+
+		req = imageRequest(http.MethodDelete, "/", nil, 1, "user",
+			map[string]string{"session_id": sessionID, "participant_id": p.ID})
+		w = httptest.NewRecorder()
+		h.HandleRemoveConsoleParticipant(w, req)
+		if w.Code != http.StatusNoContent || p.Context().Err() == nil {
+			t.Errorf("remove participant = %d, connected = %v", w.Code, p.Context().Err() == nil)
+		}
+	})
+
+	t.Run("revoked share cannot be joined", func(t *testing.T) {
+		req := imageRequest(http.MethodDelete, "/", nil, 1, "user",
+			map[string]string{"session_id": sessionID, "share_id": shareID})
+		w := httptest.NewRecorder()
+		h.HandleRevokeConsoleShare(w, req)
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("revoke = %d %s", w.Code, w.Body.String())
+		}
+
+		req = imageRequest(http.MethodPost, "/", []byte(`{"token":"`+token+`"}`), 2, "user", nil)
+		w = httptest.NewRecorder()
+		h.HandleJoinConsole(w, req)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("join after revoke = %d, want 404", w.Code)
+		}
+	})
+}
+
+func TestConsoleShare_SerialRejected(t *testing.T) {
+	h := setupTestImageHandler(t)
+	sessionMgr := session.GetSessionManager()
+	sessionID, _ := sessionMgr.CreateSession(1, 1, "serial-vm", "serial", "10.0.0.1", "test")
+	defer sessionMgr.EndSession(sessionID, "user_disconnect")
+
+	req := imageRequest(http.MethodPost, "/", []byte(`{"mode":"view"}`), 1, "user", map[string]string{"session_id": sessionID})
+	w := httptest.NewRecorder()
+	h.HandleCreateConsoleShare(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", w.Code)
+	}
+}
+
+func TestConsoleShare_TicketRejectedOutsideVNC(t *testing.T) {
+	h := setupTestImageHandler(t)
+	h.DB.Create(&models.User{Username: "student", Password: "x", Role: models.RoleUser, Approved: true, BetaAccess: true})
+	vmUUID := "12345678-1234-1234-1234-123456789abc"
+
+	for name, serve := range map[string]http.HandlerFunc{"serial": h.HandleSerialConsole, "spice": h.HandleSPICE} {
+		t.Run(name, func(t *testing.T) {
+			ticket, _, err := h.ConsoleTickets.IssueShared(auth.Claims{UserID: 2, Approved: true, BetaAccess: true}, vmUUID, "10.0.0.2", "share-1")
+			if err != nil {
+				t.Fatalf("IssueShared() error = %v", err)
+			}
+			req := httptest.NewRequest(http.MethodGet, "/ws/"+name+"/"+vmUUID+"?token="+url.QueryEscape(ticket), nil)
+			req.RemoteAddr = "10.0.0.2:4000"
+			w := httptest.NewRecorder()
+			serve(w, req)
+
+			var resp map[string]string
+			json.Unmarshal(w.Body.Bytes(), &resp)
+			if w.Code != http.StatusForbidden || resp["code"] != string(consoleErrShareTicket) {
+				t.Errorf("status = %d, code = %q; want 403 %s", w.Code, resp["code"], consoleErrShareTicket)
+			}
+		})
+	}
+}
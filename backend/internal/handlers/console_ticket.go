@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/DARC0625/LIMEN/backend/internal/auth"
+	"github.com/DARC0625/LIMEN/backend/internal/logger"
+	"github.com/DARC0625/LIMEN/backend/internal/middleware"
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"github.com/DARC0625/LIMEN/backend/internal/security"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+	"nhooyr.io/websocket"
+)
+
+// consoleVMUUID extracts the VM UUID of a console request from the id/uuid query
+// parameters, the /vnc/{uuid} path or the chi URL parameter.
+func consoleVMUUID(r *http.Request) string {
+	uuidStr := r.URL.Query().Get("id")
+	if uuidStr == "" {
+		uuidStr = r.URL.Query().Get("uuid")
+	}
+	if uuidStr == "" {
+		// Try to extract from path (e.g., /vnc/{uuid})
+		pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(pathParts) >= 2 && pathParts[0] == "vnc" {
+			uuidStr = pathParts[1]
+		}
+		// Also try chi URL parameter if available
+		if uuidStr == "" {
+			uuidStr = chi.URLParam(r, "uuid")
+		}
+	}
+	return uuidStr
+}
+
+// redeemConsoleTicket validates and consumes a console ticket.
+func (h *Handler) redeemConsoleTicket(token, vmUUID, clientIP string) (*auth.ConsoleTicketClaims, *security.TokenError) {
+	if h.ConsoleTickets == nil {
+		return nil, security.NewTokenError(security.TokenErrorInvalid, "console tickets are not enabled")
+	}
+	ticket, err := h.ConsoleTickets.Redeem(token, vmUUID, clientIP)
+	if err != nil {
+		if tokErr, ok := err.(*security.TokenError); ok {
+			return nil, tokErr
+		}
+		return nil, security.NewTokenError(security.TokenErrorInvalid, err.Error())
+	}
+	return ticket, nil
+}
+
+// isWebSocketHandshake reports whether r is a complete WebSocket opening handshake.
+func isWebSocketHandshake(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket") && r.Header.Get("Sec-WebSocket-Key") != ""
+}
+
+// rejectConsole refuses a console connection with a TokenErrorCode.
+// Browsers don't expose the HTTP status of a failed WebSocket handshake, so for
+// WebSocket clients the connection is accepted and immediately closed with
+// StatusPolicyViolation (1008) and the code as the close reason. Other clients, and
+// handshakes that can't be accepted, get a JSON error with status.
+func (h *Handler) rejectConsole(w http.ResponseWriter, r *http.Request, status int, tokErr *security.TokenError) {
+	if isWebSocketHandshake(r) {
+		ws, err := h.acceptWebSocket(w, r)
+		if err == nil {
+			ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+			defer cancel()
+			payload, _ := json.Marshal(map[string]string{"type": "error", "error": tokErr.Message, "code": string(tokErr.Code)})
+			ws.Write(ctx, websocket.MessageText, payload)
+			ws.Close(websocket.StatusPolicyViolation, string(tokErr.Code))
+			return
+		}
+		logger.Log.Debug("Failed to accept WebSocket to report console rejection",
+			zap.String("code", string(tokErr.Code)), zap.Error(err))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"type": "error", "error": tokErr.Message, "code": string(tokErr.Code)})
+}
+
+// consoleTicketUser builds the claims of a console ticket for userID. Approval and
+// beta access come from the database so a ticket never carries stale grants.
+func (h *Handler) consoleTicketUser(r *http.Request, userID uint) auth.Claims {
+	username, _ := middleware.GetUsername(r.Context())
+
+	var user models.User
+	if err := h.DB.Select("username", "beta_access", "role", "approved").Where("id = ?", userID).First(&user).Error; err != nil {
+		// Fallback: no beta access or approval if the user can't be loaded
+		user = models.User{Role: models.RoleUser}
+	}
+	if username == "" {
+		username = user.Username
+	}
+	if username == "" {
+		username = "unknown"
+	}
+
+	return auth.Claims{
+		UserID:     userID,
+		Username:   username,
+		Role:       string(user.Role),
+		Approved:   user.Approved,
+		BetaAccess: user.BetaAccess,
+	}
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DARC0625/LIMEN/backend/internal/auth"
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"github.com/DARC0625/LIMEN/backend/internal/security"
+	"nhooyr.io/websocket"
+)
+
+const consoleTestOrigin = "http://limen.test"
+
+// dialConsole opens /vnc/{uuid}?token=... and returns the close reason the server sent.
+func dialConsole(t *testing.T, srv *httptest.Server, vmUUID, token string) (websocket.StatusCode, string) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/vnc/" + vmUUID + "?token=" + url.QueryEscape(token)
+	conn, _, err := websocket.Dial(ctx, wsURL, &websocket.DialOptions{
+		HTTPHeader: http.Header{"Origin": []string{consoleTestOrigin}},
+	})
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close(websocket.StatusNormalClosure, "")
+
+	for {
+		if _, _, err := conn.Read(ctx); err != nil {
+			var closeErr websocket.CloseError
+			if stderrors.As(err, &closeErr) {
+				return closeErr.Code, closeErr.Reason
+			}
+			return -1, ""
+		}
+	}
+}
+
+func TestHandleVMConsole_IssuesTicket(t *testing.T) {
+	h := setupTestImageHandler(t)
+	h.DB.Create(&models.User{Username: "alice", Password: "x", Role: models.RoleUser, Approved: true})
+	vmRec := models.VM{Name: "console-vm", CPU: 1, Memory: 1024, OwnerID: 1}
+	h.DB.Create(&vmRec)
+
+	req := imageRequest(http.MethodGet, "/api/vms/"+vmRec.UUID+"/console", nil, 1, "user", map[string]string{"uuid": vmRec.UUID})
+	req.RemoteAddr = "10.1.2.3:5555"
+	w := httptest.NewRecorder()
+	h.HandleVMConsole(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("HandleVMConsole() status = %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	wsURL, err := url.Parse(resp["ws_url"].(string))
+	if err != nil {
+		t.Fatalf("invalid ws_url: %v", err)
+	}
+	ticket := wsURL.Query().Get("token")
+
+	// Ordinary JWT validation must not accept the ticket
+	if _, err := auth.ValidateToken(ticket, h.Config.JWTSecret); err == nil {
+		t.Error("console ticket was accepted as an access token")
+	}
+
+	claims, err := h.ConsoleTickets.Redeem(ticket, vmRec.UUID, "10.1.2.3")
+	if err != nil {
+		t.Fatalf("Redeem() error = %v", err)
+	}
+	if claims.UserID != 1 || !claims.Approved {
+		t.Errorf("unexpected ticket claims %+v", claims.Claims)
+	}
+}
+
+func TestHandleVNC_RejectsWithCloseReason(t *testing.T) {
+	h := setupTestImageHandler(t)
+	h.Config.AllowedOrigins = []string{consoleTestOrigin}
+	srv := httptest.NewServer(http.HandlerFunc(h.HandleVNC))
+	defer srv.Close()
+
+	vmUUID := "12345678-1234-1234-1234-123456789abc"
+	admin := auth.Claims{UserID: 1, Username: "admin", Role: "admin", Approved: true}
+
+	t.Run("missing", func(t *testing.T) {
+		if code, reason := dialConsole(t, srv, vmUUID, ""); code != websocket.StatusPolicyViolation || reason != string(security.TokenErrorMissing) {
+			t.Errorf("close = %d %q, want 1008 MISSING_TOKEN", code, reason)
+		}
+	})
+
+	t.Run("access token", func(t *testing.T) {
+		accessToken, _ := auth.GenerateAccessToken(1, "admin", "admin", true, h.Config.JWTSecret)
+		if code, reason := dialConsole(t, srv, vmUUID, accessToken); code != websocket.StatusPolicyViolation || reason != string(security.TokenErrorInvalid) {
+			t.Errorf("close = %d %q, want 1008 INVALID_TOKEN", code, reason)
+		}
+	})
+
+	t.Run("wrong vm", func(t *testing.T) {
+		ticket, _, _ := h.ConsoleTickets.Issue(admin, vmUUID, "127.0.0.1")
+		if code, reason := dialConsole(t, srv, "87654321-4321-4321-4321-cba987654321", ticket); reason != string(security.TokenErrorUUIDMismatch) {
+			t.Errorf("close = %d %q, want UUID_MISMATCH", code, reason)
+		}
+	})
+
+	t.Run("wrong ip", func(t *testing.T) {
+		ticket, _, _ := h.ConsoleTickets.Issue(admin, vmUUID, "10.9.9.9")
+		if code, reason := dialConsole(t, srv, vmUUID, ticket); reason != string(security.TokenErrorIPMismatch) {
+			t.Errorf("close = %d %q, want IP_MISMATCH", code, reason)
+		}
+	})
+
+	t.Run("not approved", func(t *testing.T) {
+		ticket, _, _ := h.ConsoleTickets.Issue(auth.Claims{UserID: 2, Role: "user", BetaAccess: true}, vmUUID, "127.0.0.1")
+		if code, reason := dialConsole(t, srv, vmUUID, ticket); reason != string(security.TokenErrorNotApproved) {
+			t.Errorf("close = %d %q, want NOT_APPROVED", code, reason)
+		}
+	})
+
+	t.Run("replayed", func(t *testing.T) {
+		ticket, _, _ := h.ConsoleTickets.Issue(admin, vmUUID, "127.0.0.1")
+		// First use is accepted (and fails later on the unknown VM)
+		if _, reason := dialConsole(t, srv, vmUUID, ticket); reason == string(security.TokenErrorReplayed) {
+			t.Fatal("first use of ticket was rejected as replayed")
+		}
+		if code, reason := dialConsole(t, srv, vmUUID, ticket); code != websocket.StatusPolicyViolation || reason != string(security.TokenErrorReplayed) {
+			t.Errorf("close = %d %q, want 1008 TOKEN_REPLAYED", code, reason)
+		}
+	})
+}
+
+func TestHandleVNC_NonWebSocketRejection(t *testing.T) {
+	h := setupTestImageHandler(t)
+	req := httptest.NewRequest(http.MethodGet, "/vnc/12345678-1234-1234-1234-123456789abc", nil)
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	w := httptest.NewRecorder()
+
+	h.HandleVNC(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401", w.Code)
+	}
+	var resp map[string]string
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp["code"] != string(security.TokenErrorMissing) {
+		t.Errorf("code = %q, want MISSING_TOKEN", resp["code"])
+	}
+}
@@ -0,0 +1,352 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/DARC0625/LIMEN/backend/internal/audit"
+	"github.com/DARC0625/LIMEN/backend/internal/errors"
+	"github.com/DARC0625/LIMEN/backend/internal/logger"
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"github.com/DARC0625/LIMEN/backend/internal/vm"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// hostView is a compute host with the resources allocated to the VMs placed on it and
+// the state of its libvirt connection.
+type hostView struct {
+	models.Host
+	VMs               int                `json:"vms"`
+	AllocatedVCPUs    int                `json:"allocated_vcpus"`
+	AllocatedMemoryMB int                `json:"allocated_memory_mb"`
+	Connection        *vm.HostConnection `json:"connection,omitempty"`
+}
+
+// HostRequest adds or updates a compute host. On update, omitted fields are unchanged.
+type HostRequest struct {
+	Name           *string   `json:"name,omitempty" example:"node-2"`
+	URI            *string   `json:"uri,omitempty" example:"qemu+ssh://limen@node-2/system"` // qemu:///system, qemu+ssh://... or qemu+tls://...
+	ConsoleAddress *string   `json:"console_address,omitempty" example:"10.0.0.12"`          // Address VM consoles listen on and the console proxy dials (other hosts: reachable IP, VNC TLS required)
+	Tags           *[]string `json:"tags,omitempty" example:"ssd,gpu"`
+	Maintenance    *bool     `json:"maintenance,omitempty" example:"false"`   // Stop placing new VMs on the host
+	SharedStorage  *bool     `json:"shared_storage,omitempty" example:"true"` // The host mounts this server's VM and ISO directories under the same paths
+	CPUOvercommit  *float64  `json:"cpu_overcommit,omitempty" example:"4"`    // vCPUs that may be placed per host CPU
+}
+
+// validHostURI reports whether uri is a libvirt URI for a local or remote QEMU driver
+// over an authenticated transport. Query parameters are refused: they choose the command
+// run over ssh (command, netcat, socket), the key used (keyfile) or turn off certificate
+// checks (no_verify).
+func validHostURI(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil || u.RawQuery != "" || u.ForceQuery || u.Fragment != "" {
+		return false
+	}
+	switch u.Scheme {
+	case "qemu":
+		return u.Host == ""
+	case "qemu+ssh", "qemu+tls":
+		return u.Host != ""
+	}
+	return false
+}
+
+// validConsoleAddress reports whether VM consoles of a host may listen on addr: empty (the
+// default, 127.0.0.1) or a loopback address, or for a host other than this server, the IP
+// address the proxy reaches it on. Over the network the proxy only bridges VNC, and only
+// with TLS (VeNCrypt); SPICE and serial ports must not be reachable from other machines.
+func validConsoleAddress(addr string, remote bool) bool {
+	if isLoopbackAddress(addr) {
+		return true
+	}
+	ip := net.ParseIP(addr)
+	return remote && ip != nil && !ip.IsUnspecified()
+}
+
+// isLoopbackAddress reports whether addr is empty (127.0.0.1) or a loopback IP address.
+func isLoopbackAddress(addr string) bool {
+	ip := net.ParseIP(addr)
+	return addr == "" || ip != nil && ip.IsLoopback()
+}
+
+// apply validates req and copies its fields onto host. consoleTLS tells whether the console
+// proxy has a VNC TLS configuration, which consoles of other hosts require.
+func (req HostRequest) apply(host *models.Host, consoleTLS bool) string {
+	if req.Name != nil {
+		host.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.URI != nil {
+		host.URI = strings.TrimSpace(*req.URI)
+	}
+	if req.ConsoleAddress != nil {
+		host.ConsoleAddress = strings.TrimSpace(*req.ConsoleAddress)
+	}
+	if req.Tags != nil {
+		host.Tags = strings.Join(models.SplitTags(strings.Join(*req.Tags, ",")), ",")
+	}
+	if req.Maintenance != nil {
+		host.Maintenance = *req.Maintenance
+	}
+	if req.SharedStorage != nil {
+		host.SharedStorage = *req.SharedStorage
+	}
+	if req.CPUOvercommit != nil {
+		host.CPUOvercommit = *req.CPUOvercommit
+	}
+
+	switch {
+	case host.Name == "":
+		return "Host name is required"
+	case !validHostURI(host.URI):
+		return "URI must be qemu:///..., qemu+ssh://host/... or qemu+tls://host/..., without query parameters"
+	case !validConsoleAddress(host.ConsoleAddress, host.Name != vm.DefaultHostName):
+		if host.Name == vm.DefaultHostName {
+			return "console_address of the default host must be a loopback address"
+		}
+		return "console_address must be an IP address"
+	case !consoleTLS && !isLoopbackAddress(host.ConsoleAddress):
+		return "console_address outside loopback requires VNC TLS (VNC_TLS_CA_CERT)"
+	case host.CPUOvercommit <= 0:
+		return "cpu_overcommit must be positive"
+	}
+	return ""
+}
+
+// hostID parses the {id} URL parameter.
+func hostID(r *http.Request) (uint, bool) {
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 32)
+	return uint(id), err == nil
+}
+
+// HandleListHosts lists the compute hosts.
+// @Summary List compute hosts
+// @Description Hosts with their capacity (reported by libvirt), the resources allocated to VMs
+// @Description placed on them and the state of their libvirt connection. Stopped VMs keep their allocation.
+// @Tags admin
+// @Produce json
+// @Success 200 {array} hostView
+// @Security BearerAuth
+// @Router /admin/hosts [get]
+func (h *Handler) HandleListHosts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		errors.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+
+	var hosts []models.Host
+	if err := h.DB.Order("id").Find(&hosts).Error; err != nil {
+		logger.Log.Error("Failed to list hosts", zap.Error(err))
+		errors.WriteInternalError(w, err, h.Config.Env == "development")
+		return
+	}
+	var allocations []struct {
+		HostID   uint
+		VMs      int `gorm:"column:vms"`
+		VCPUs    int `gorm:"column:vcpus"`
+		MemoryMB int `gorm:"column:memory_mb"`
+	}
+	if err := h.DB.Model(&models.VM{}).
+		Select("host_id, COUNT(*) AS vms, COALESCE(SUM(cpu), 0) AS vcpus, COALESCE(SUM(memory), 0) AS memory_mb").
+		Group("host_id").Scan(&allocations).Error; err != nil {
+		errors.WriteInternalError(w, err, h.Config.Env == "development")
+		return
+	}
+
+	views := make([]hostView, len(hosts))
+	byID := make(map[uint]*hostView, len(hosts))
+	var defaultView *hostView
+	for i, host := range hosts {
+		views[i] = hostView{Host: host}
+		if h.VMService != nil {
+			conn := h.VMService.Hosts().Connection(host.ID)
+			views[i].Connection = &conn
+		}
+		byID[host.ID] = &views[i]
+		if host.Name == vm.DefaultHostName {
+			defaultView = &views[i]
+		}
+	}
+	for _, a := range allocations {
+		view := byID[a.HostID]
+		if a.HostID == 0 {
+			// VMs created before hosts existed run on the default host
+			view = defaultView
+		}
+		if view == nil {
+			continue
+		}
+		view.VMs += a.VMs
+		view.AllocatedVCPUs += a.VCPUs
+		view.AllocatedMemoryMB += a.MemoryMB
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(views)
+}
+
+// HandleCreateHost adds a compute host.
+// @Summary Add a compute host
+// @Description The backend connects right away to read the host's capacity; an unreachable host
+// @Description is added with status "offline" and retried when used. New VMs are only placed on
+// @Description hosts with shared_storage: their disks and ISOs are on this server, and the host must
+// @Description see them under the same paths.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param request body HostRequest true "Host (name and uri required)"
+// @Success 201 {object} models.Host
+// @Failure 400 {object} map[string]interface{} "Invalid request"
+// @Failure 409 {object} map[string]interface{} "Host name already in use"
+// @Security BearerAuth
+// @Router /admin/hosts [post]
+func (h *Handler) HandleCreateHost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		errors.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+
+	var req HostRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errors.WriteBadRequest(w, "Invalid request body", err)
+		return
+	}
+	host := models.Host{CPUOvercommit: 4, Status: models.HostStatusOffline}
+	if msg := req.apply(&host, h.VNCTLS != nil); msg != "" {
+		errors.WriteBadRequest(w, msg, nil)
+		return
+	}
+	var count int64
+	h.DB.Model(&models.Host{}).Where("name = ?", host.Name).Count(&count)
+	if count > 0 {
+		errors.WriteError(w, http.StatusConflict, "Host name already in use", nil)
+		return
+	}
+	if err := h.DB.Create(&host).Error; err != nil {
+		logger.Log.Error("Failed to create host", zap.Error(err))
+		errors.WriteInternalError(w, err, h.Config.Env == "development")
+		return
+	}
+	audit.LogHostChange(r.Context(), host.ID, host.Name, host.URI, "create")
+
+	if h.VMService != nil {
+		if _, err := h.VMService.Hosts().Driver(host.ID); err != nil {
+			logger.Log.Warn("New host is unreachable", zap.String("host", host.Name), zap.Error(err))
+		}
+		h.DB.First(&host, host.ID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(host)
+}
+
+// HandleUpdateHost updates a compute host.
+// @Summary Update a compute host
+// @Description Changing the URI reconnects. The default host's name and URI come from the server
+// @Description configuration and can't be changed.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "Host ID"
+// @Param request body HostRequest true "Fields to change"
+// @Success 200 {object} models.Host
+// @Failure 400 {object} map[string]interface{} "Invalid request"
+// @Failure 404 {object} map[string]interface{} "Host not found"
+// @Security BearerAuth
+// @Router /admin/hosts/{id} [patch]
+func (h *Handler) HandleUpdateHost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "PATCH" {
+		errors.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+
+	id, ok := hostID(r)
+	if !ok {
+		errors.WriteBadRequest(w, "Invalid host ID", nil)
+		return
+	}
+	var host models.Host
+	if err := h.DB.First(&host, id).Error; err != nil {
+		errors.WriteNotFound(w, "Host")
+		return
+	}
+	var req HostRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errors.WriteBadRequest(w, "Invalid request body", err)
+		return
+	}
+	if host.Name == vm.DefaultHostName && (req.Name != nil || req.URI != nil) {
+		errors.WriteBadRequest(w, "The default host's name and URI are set by LIBVIRT_URI", nil)
+		return
+	}
+	oldURI := host.URI
+	if msg := req.apply(&host, h.VNCTLS != nil); msg != "" {
+		errors.WriteBadRequest(w, msg, nil)
+		return
+	}
+	if err := h.DB.Save(&host).Error; err != nil {
+		logger.Log.Error("Failed to update host", zap.Error(err))
+		errors.WriteInternalError(w, err, h.Config.Env == "development")
+		return
+	}
+	if host.URI != oldURI && h.VMService != nil {
+		h.VMService.Hosts().Disconnect(host.ID)
+	}
+	audit.LogHostChange(r.Context(), host.ID, host.Name, host.URI, "update")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(host)
+}
+
+// HandleDeleteHost removes a compute host that has no VMs.
+// @Summary Remove a compute host
+// @Tags admin
+// @Param id path int true "Host ID"
+// @Success 204 "Host removed"
+// @Failure 400 {object} map[string]interface{} "Default host"
+// @Failure 404 {object} map[string]interface{} "Host not found"
+// @Failure 409 {object} map[string]interface{} "VMs are still placed on the host"
+// @Security BearerAuth
+// @Router /admin/hosts/{id} [delete]
+func (h *Handler) HandleDeleteHost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "DELETE" {
+		errors.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+
+	id, ok := hostID(r)
+	if !ok {
+		errors.WriteBadRequest(w, "Invalid host ID", nil)
+		return
+	}
+	var host models.Host
+	if err := h.DB.First(&host, id).Error; err != nil {
+		errors.WriteNotFound(w, "Host")
+		return
+	}
+	if host.Name == vm.DefaultHostName {
+		errors.WriteBadRequest(w, "The default host can't be removed", nil)
+		return
+	}
+	var vms int64
+	h.DB.Model(&models.VM{}).Where("host_id = ?", host.ID).Count(&vms)
+	if vms > 0 {
+		errors.WriteError(w, http.StatusConflict, "VMs are still placed on the host", nil)
+		return
+	}
+	if err := h.DB.Delete(&host).Error; err != nil {
+		errors.WriteInternalError(w, err, h.Config.Env == "development")
+		return
+	}
+	if h.VMService != nil {
+		h.VMService.Hosts().Disconnect(host.ID)
+	}
+	audit.LogHostChange(r.Context(), host.ID, host.Name, host.URI, "delete")
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"github.com/DARC0625/LIMEN/backend/internal/vm"
+)
+
+func TestAdminHosts(t *testing.T) {
+	h := setupTestImageHandler(t)
+	local := models.Host{Name: vm.DefaultHostName, URI: "qemu:///system", CPUs: 8, MemoryMB: 16384, Status: models.HostStatusOnline}
+	h.DB.Create(&local)
+
+	create := func(body string) *httptest.ResponseRecorder {
+		req := imageRequest(http.MethodPost, "/api/admin/hosts", []byte(body), 99, "admin", nil)
+		w := httptest.NewRecorder()
+		h.HandleCreateHost(w, req)
+		return w
+	}
+	for _, body := range []string{
+		`{"uri":"qemu+ssh://node-2/system"}`,
+		`{"name":"node-2","uri":"qemu+tcp://node-2/system"}`,
+		`{"name":"node-2","uri":"qemu+ssh:///system"}`,
+		`{"name":"node-2","uri":"qemu+ssh://node-2/system","cpu_overcommit":0}`,
+		`{"name":"node-2","uri":"qemu+ssh://node-2/system?command=/tmp/x"}`,
+		`{"name":"node-2","uri":"qemu+ssh://node-2/system?keyfile=/etc/shadow"}`,
+		`{"name":"node-2","uri":"qemu+tls://node-2/system?no_verify=1"}`,
+		`{"name":"node-2","uri":"qemu:///system?socket=/tmp/sock"}`,
+		`{"name":"node-2","uri":"qemu+ssh://node-2/system","console_address":"10.0.0.12"}`,
+		`{"name":"node-2","uri":"qemu+ssh://node-2/system","console_address":"localhost"}`,
+	} {
+		if w := create(body); w.Code != http.StatusBadRequest {
+			t.Errorf("POST %s = %d, want 400", body, w.Code)
+		}
+	}
+
+	w := create(`{"name":"node-2","uri":"qemu+ssh://limen@node-2/system","console_address":"127.0.0.1","shared_storage":true,"tags":["ssd"," gpu",""]}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create host = %d %s", w.Code, w.Body.String())
+	}
+	var node2 models.Host
+	json.Unmarshal(w.Body.Bytes(), &node2)
+	if node2.Tags != "ssd,gpu" || !node2.SharedStorage || node2.Status != models.HostStatusOffline || node2.CPUOvercommit != 4 {
+		t.Errorf("created host = %+v", node2)
+	}
+	if w := create(`{"name":"node-2","uri":"qemu+ssh://node-3/system"}`); w.Code != http.StatusConflict {
+		t.Errorf("duplicate name = %d, want 409", w.Code)
+	}
+
+	// Consoles of other hosts are reached over the network, with VNC TLS only
+	h.VNCTLS = &tls.Config{}
+	if w := create(`{"name":"node-3","uri":"qemu+ssh://node-3/system","console_address":"0.0.0.0"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("unspecified console address = %d, want 400", w.Code)
+	}
+	if w := create(`{"name":"node-3","uri":"qemu+ssh://node-3/system","console_address":"10.0.0.13"}`); w.Code != http.StatusCreated {
+		t.Errorf("console address of another host with VNC TLS = %d %s", w.Code, w.Body.String())
+	}
+	localParam := map[string]string{"id": strconv.FormatUint(uint64(local.ID), 10)}
+	req := imageRequest(http.MethodPatch, "/", []byte(`{"console_address":"10.0.0.1"}`), 99, "admin", localParam)
+	w = httptest.NewRecorder()
+	h.HandleUpdateHost(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("non-loopback console address of the default host = %d, want 400", w.Code)
+	}
+	h.VNCTLS = nil
+	h.DB.Where("name = ?", "node-3").Delete(&models.Host{})
+
+	h.DB.Create(&models.VM{Name: "legacy", CPU: 2, Memory: 2048})
+	h.DB.Create(&models.VM{Name: "placed", CPU: 4, Memory: 4096, HostID: node2.ID})
+
+	req = imageRequest(http.MethodGet, "/api/admin/hosts", nil, 99, "admin", nil)
+	w = httptest.NewRecorder()
+	h.HandleListHosts(w, req)
+	var views []hostView
+	json.Unmarshal(w.Body.Bytes(), &views)
+	if len(views) != 2 || views[0].VMs != 1 || views[0].AllocatedVCPUs != 2 || views[1].AllocatedMemoryMB != 4096 {
+		t.Errorf("hosts = %s", w.Body.String())
+	}
+
+	node2Param := map[string]string{"id": strconv.FormatUint(uint64(node2.ID), 10)}
+	req = imageRequest(http.MethodPatch, "/", []byte(`{"maintenance":true}`), 99, "admin", node2Param)
+	w = httptest.NewRecorder()
+	h.HandleUpdateHost(w, req)
+	if w.Code != http.StatusOK || !json.Valid(w.Body.Bytes()) {
+		t.Fatalf("update host = %d %s", w.Code, w.Body.String())
+	}
+	var updated models.Host
+	h.DB.First(&updated, node2.ID)
+	if !updated.Maintenance || updated.Tags != "ssd,gpu" {
+		t.Errorf("updated host = %+v", updated)
+	}
+
+	req = imageRequest(http.MethodPatch, "/", []byte(`{"uri":"qemu+ssh://elsewhere/system"}`), 99, "admin", localParam)
+	w = httptest.NewRecorder()
+	h.HandleUpdateHost(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("change default host URI = %d, want 400", w.Code)
+	}
+
+	del := func(params map[string]string) int {
+		req := imageRequest(http.MethodDelete, "/", nil, 99, "admin", params)
+		w := httptest.NewRecorder()
+		h.HandleDeleteHost(w, req)
+		return w.Code
+	}
+	if code := del(localParam); code != http.StatusBadRequest {
+		t.Errorf("delete default host = %d, want 400", code)
+	}
+	if code := del(node2Param); code != http.StatusConflict {
+		t.Errorf("delete host with VMs = %d, want 409", code)
+	}
+	h.DB.Where("name = ?", "placed").Delete(&models.VM{})
+	if code := del(node2Param); code != http.StatusNoContent {
+		t.Errorf("delete empty host = %d, want 204", code)
+	}
+}
@@ -0,0 +1,535 @@
+package handlers
+
+import (
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/DARC0625/LIMEN/backend/internal/audit"
+	"github.com/DARC0625/LIMEN/backend/internal/errors"
+	"github.com/DARC0625/LIMEN/backend/internal/images"
+	"github.com/DARC0625/LIMEN/backend/internal/logger"
+	"github.com/DARC0625/LIMEN/backend/internal/middleware"
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// CreateImageUploadRequest starts a resumable image upload.
+type CreateImageUploadRequest struct {
+	Filename    string `json:"filename"`
+	OSType      string `json:"os_type"` // OS profile the image installs (see GET /api/os-profiles), or empty
+	Description string `json:"description"`
+	Size        int64  `json:"size"`   // Total size in bytes
+	SHA256      string `json:"sha256"` // Expected checksum (hex)
+}
+
+// ImageUploadResponse is returned by the upload endpoints.
+// Image is set once the upload has been registered (or deduplicated against an existing image).
+type ImageUploadResponse struct {
+	Upload    *models.ImageUpload `json:"upload,omitempty"`
+	Image     *models.VMImage     `json:"image,omitempty"`
+	ChunkSize int64               `json:"chunk_size,omitempty"`
+}
+
+// HandleCreateImageUpload starts a chunked image upload.
+// @Summary Start image upload
+// @Description Creates a resumable upload session. If an image with the same SHA-256 already exists it is returned instead.
+// @Tags images
+// @Accept json
+// @Produce json
+// @Param request body CreateImageUploadRequest true "Upload metadata"
+// @Success 201 {object} ImageUploadResponse "Upload session created"
+// @Success 200 {object} ImageUploadResponse "Image already exists"
+// @Failure 400 {object} map[string]interface{} "Invalid request"
+// @Failure 403 {object} map[string]interface{} "Quota exceeded"
+// @Security BearerAuth
+// @Router /images/uploads [post]
+func (h *Handler) HandleCreateImageUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		errors.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		errors.WriteUnauthorized(w, "Authentication required")
+		return
+	}
+
+	var req CreateImageUploadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errors.WriteBadRequest(w, "Invalid request body", err)
+		return
+	}
+	if req.Filename == "" || req.SHA256 == "" {
+		errors.WriteBadRequest(w, "filename and sha256 are required", nil)
+		return
+	}
+	// VMs of the OS type install from the image, so it must be one they can be created with
+	if _, ok := h.osProfiles().Get(req.OSType); req.OSType != "" && !ok {
+		errors.WriteBadRequest(w, fmt.Sprintf("Invalid OS type: %s (valid: %s)", req.OSType, strings.Join(h.osProfiles().IDs(), ", ")), nil)
+		return
+	}
+
+	upload, existing, err := h.Images.CreateUpload(images.UploadRequest{
+		Filename:    req.Filename,
+		OSType:      req.OSType,
+		Description: req.Description,
+		Size:        req.Size,
+		SHA256:      req.SHA256,
+		OwnerID:     userID,
+		SkipQuota:   middleware.IsAdmin(r.Context()),
+	})
+	if err != nil {
+		if stderrors.Is(err, images.ErrInvalidImage) {
+			// Nothing has been uploaded yet; this is bad metadata
+			errors.WriteBadRequest(w, err.Error(), nil)
+			return
+		}
+		h.writeImageError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if existing != nil {
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(ImageUploadResponse{Image: existing})
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(ImageUploadResponse{Upload: upload, ChunkSize: h.Images.ChunkSize()})
+}
+
+// HandleGetImageUpload returns upload progress; clients resume from received_bytes.
+// @Summary Get image upload status
+// @Tags images
+// @Produce json
+// @Param id path string true "Upload ID"
+// @Success 200 {object} ImageUploadResponse
+// @Failure 404 {object} map[string]interface{} "Upload not found"
+// @Security BearerAuth
+// @Router /images/uploads/{id} [get]
+func (h *Handler) HandleGetImageUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		errors.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+
+	upload, ok := h.authorizeImageUpload(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ImageUploadResponse{Upload: upload, ChunkSize: h.Images.ChunkSize()})
+}
+
+// HandleImageUploadChunk appends a chunk to an upload.
+// The chunk position is given by a "Content-Range: bytes start-end/total" header.
+// @Summary Upload image chunk
+// @Tags images
+// @Accept application/octet-stream
+// @Produce json
+// @Param id path string true "Upload ID"
+// @Param Content-Range header string true "bytes start-end/total"
+// @Success 200 {object} ImageUploadResponse
+// @Failure 409 {object} map[string]interface{} "Offset does not match received bytes"
+// @Failure 413 {object} map[string]interface{} "Chunk too large"
+// @Security BearerAuth
+// @Router /images/uploads/{id} [put]
+func (h *Handler) HandleImageUploadChunk(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "PUT" {
+		errors.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+
+	upload, ok := h.authorizeImageUpload(w, r)
+	if !ok {
+		return
+	}
+
+	start, end, err := parseContentRange(r.Header.Get("Content-Range"), upload.TotalSize)
+	if err != nil {
+		errors.WriteBadRequest(w, err.Error(), nil)
+		return
+	}
+	if end-start+1 > h.Images.ChunkSize() {
+		errors.WriteError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Chunk exceeds maximum size of %d bytes", h.Images.ChunkSize()), nil)
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, end-start+1)
+	upload, err = h.Images.WriteChunk(upload.ID, start, body)
+	if err != nil {
+		if stderrors.Is(err, images.ErrOffsetMismatch) && upload != nil {
+			// Tell the client where to resume from
+			w.Header().Set("Upload-Offset", strconv.FormatInt(upload.ReceivedBytes, 10))
+		}
+		h.writeImageError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.ReceivedBytes, 10))
+	json.NewEncoder(w).Encode(ImageUploadResponse{Upload: upload})
+}
+
+// HandleCompleteImageUpload verifies the checksum and format and registers the image.
+// @Summary Complete image upload
+// @Tags images
+// @Produce json
+// @Param id path string true "Upload ID"
+// @Success 201 {object} ImageUploadResponse
+// @Failure 409 {object} map[string]interface{} "Upload incomplete"
+// @Failure 422 {object} map[string]interface{} "Checksum mismatch or invalid image"
+// @Security BearerAuth
+// @Router /images/uploads/{id}/complete [post]
+func (h *Handler) HandleCompleteImageUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		errors.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+
+	upload, ok := h.authorizeImageUpload(w, r)
+	if !ok {
+		return
+	}
+
+	image, err := h.Images.CompleteUpload(upload.ID)
+	if err != nil {
+		if stderrors.Is(err, images.ErrChecksumMismatch) || stderrors.Is(err, images.ErrInvalidImage) {
+			audit.LogImageUpload(r.Context(), 0, upload.Filename, upload.ExpectedSHA256, false, err.Error())
+		}
+		h.writeImageError(w, err)
+		return
+	}
+
+	audit.LogImageUpload(r.Context(), image.ID, image.Name, image.SHA256, true, "")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(ImageUploadResponse{Image: image})
+}
+
+// HandleAbortImageUpload cancels an upload and discards its data.
+// @Summary Abort image upload
+// @Tags images
+// @Param id path string true "Upload ID"
+// @Success 204 "Upload aborted"
+// @Security BearerAuth
+// @Router /images/uploads/{id} [delete]
+func (h *Handler) HandleAbortImageUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "DELETE" {
+		errors.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+
+	upload, ok := h.authorizeImageUpload(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.Images.AbortUpload(upload.ID); err != nil {
+		h.writeImageError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleListImages lists the system images and the caller's own uploads; admins see every image.
+// @Summary List images
+// @Tags images
+// @Produce json
+// @Success 200 {array} models.VMImage
+// @Security BearerAuth
+// @Router /images [get]
+func (h *Handler) HandleListImages(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		errors.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		errors.WriteUnauthorized(w, "Authentication required")
+		return
+	}
+
+	list, err := h.Images.ListImages(userID, middleware.IsAdmin(r.Context()))
+	if err != nil {
+		errors.WriteInternalError(w, err, h.Config.Env == "development")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// HandleDeleteImage deletes an image that no VM references.
+// Only the uploader or an admin may delete an image; system images are admin-only.
+// @Summary Delete image
+// @Tags images
+// @Param id path int true "Image ID"
+// @Success 204 "Image deleted"
+// @Failure 409 {object} map[string]interface{} "Image in use"
+// @Security BearerAuth
+// @Router /images/{id} [delete]
+func (h *Handler) HandleDeleteImage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "DELETE" {
+		errors.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		errors.WriteUnauthorized(w, "Authentication required")
+		return
+	}
+
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		errors.WriteBadRequest(w, "Invalid image ID", err)
+		return
+	}
+
+	image, err := h.Images.GetImage(uint(id))
+	if err != nil {
+		h.writeImageError(w, err)
+		return
+	}
+	if !middleware.IsAdmin(r.Context()) && (image.OwnerID == nil || *image.OwnerID != userID) {
+		errors.WriteForbidden(w, "You don't have permission to delete this image")
+		return
+	}
+
+	if err := h.Images.DeleteImage(image.ID, h.imageAttached); err != nil {
+		h.writeImageError(w, err)
+		return
+	}
+
+	audit.LogImageDelete(r.Context(), image.ID, image.Name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// imageAttached reports whether any VM currently has path attached as CD-ROM media.
+func (h *Handler) imageAttached(path string) bool {
+	if h.VMService == nil {
+		return false
+	}
+	var names []string
+	if err := h.DB.Model(&models.VM{}).Pluck("name", &names).Error; err != nil {
+		return true // Fail closed
+	}
+	for _, name := range names {
+		if media, err := h.VMService.GetCurrentMedia(name); err == nil && media == path {
+			return true
+		}
+	}
+	return false
+}
+
+// authorizeImageUpload loads the upload named in the URL and checks that the caller owns it.
+func (h *Handler) authorizeImageUpload(w http.ResponseWriter, r *http.Request) (*models.ImageUpload, bool) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		errors.WriteUnauthorized(w, "Authentication required")
+		return nil, false
+	}
+
+	upload, err := h.Images.GetUpload(chi.URLParam(r, "id"))
+	if err != nil {
+		h.writeImageError(w, err)
+		return nil, false
+	}
+	if upload.OwnerID != userID && !middleware.IsAdmin(r.Context()) {
+		// Don't reveal other users' uploads
+		errors.WriteNotFound(w, "Upload")
+		return nil, false
+	}
+	return upload, true
+}
+
+// writeImageError maps image store errors to HTTP responses.
+func (h *Handler) writeImageError(w http.ResponseWriter, err error) {
+	var quotaErr *models.QuotaError
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case stderrors.As(err, &quotaErr):
+		errors.WriteQuotaExceeded(w, quotaErr.Error())
+	case stderrors.As(err, &maxBytesErr):
+		// The chunk body was longer than its Content-Range
+		errors.WriteError(w, http.StatusRequestEntityTooLarge, "Chunk is larger than its Content-Range", nil)
+	case stderrors.Is(err, images.ErrUploadNotFound):
+		errors.WriteNotFound(w, "Upload")
+	case stderrors.Is(err, images.ErrImageNotFound):
+		errors.WriteNotFound(w, "Image")
+	case stderrors.Is(err, images.ErrOffsetMismatch),
+		stderrors.Is(err, images.ErrUploadClosed),
+		stderrors.Is(err, images.ErrUploadIncomplete):
+		errors.WriteErrorWithCode(w, http.StatusConflict, err.Error(), errors.ErrCodeResourceConflict, nil, false)
+	case stderrors.Is(err, images.ErrImageInUse):
+		errors.WriteErrorWithCode(w, http.StatusConflict, err.Error(), errors.ErrCodeResourceConflict, nil, false)
+	case stderrors.Is(err, images.ErrTooLarge):
+		errors.WriteError(w, http.StatusRequestEntityTooLarge, err.Error(), nil)
+	case stderrors.Is(err, images.ErrChecksumMismatch), stderrors.Is(err, images.ErrInvalidImage):
+		errors.WriteErrorWithCode(w, http.StatusUnprocessableEntity, err.Error(), errors.ErrCodeImageInvalid, nil, false)
+	default:
+		logger.Log.Error("Image operation failed", zap.Error(err))
+		errors.WriteInternalError(w, err, h.Config.Env == "development")
+	}
+}
+
+// parseContentRange parses "bytes start-end/total" and checks it against the declared upload size.
+func parseContentRange(header string, totalSize int64) (start, end int64, err error) {
+	spec, ok := strings.CutPrefix(header, "bytes ")
+	if !ok {
+		return 0, 0, fmt.Errorf("Content-Range header must be of the form 'bytes start-end/total'")
+	}
+	rangePart, totalPart, ok := strings.Cut(spec, "/")
+	if !ok {
+		return 0, 0, fmt.Errorf("Content-Range header must include the total size")
+	}
+	startStr, endStr, ok := strings.Cut(rangePart, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("Content-Range header must include a byte range")
+	}
+	if start, err = strconv.ParseInt(startStr, 10, 64); err != nil {
+		return 0, 0, fmt.Errorf("invalid Content-Range start")
+	}
+	if end, err = strconv.ParseInt(endStr, 10, 64); err != nil {
+		return 0, 0, fmt.Errorf("invalid Content-Range end")
+	}
+	if totalPart != "*" {
+		total, err := strconv.ParseInt(totalPart, 10, 64)
+		if err != nil || total != totalSize {
+			return 0, 0, fmt.Errorf("Content-Range total does not match upload size %d", totalSize)
+		}
+	}
+	if start < 0 || end < start || end >= totalSize {
+		return 0, 0, fmt.Errorf("Content-Range out of bounds")
+	}
+	return start, end, nil
+}
+
+// HandleListImageCatalog lists downloadable catalog entries.
+// @Summary List image catalog
+// @Tags admin
+// @Produce json
+// @Success 200 {array} images.CatalogEntry
+// @Security BearerAuth
+// @Router /admin/images/catalog [get]
+func (h *Handler) HandleListImageCatalog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		errors.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+
+	catalog, err := h.ImageFetcher.Catalog()
+	if err != nil {
+		logger.Log.Error("Failed to load image catalog", zap.Error(err))
+		errors.WriteInternalError(w, err, h.Config.Env == "development")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(catalog.Entries)
+}
+
+// HandleFetchCatalogImage starts a background download of a catalog entry.
+// @Summary Fetch catalog image
+// @Description Downloads the entry into the ISO directory, verifies its checksum (and GPG signature if present) and registers it.
+// @Tags admin
+// @Produce json
+// @Param id path string true "Catalog entry ID"
+// @Success 202 {object} images.FetchJob
+// @Failure 404 {object} map[string]interface{} "Catalog entry not found"
+// @Security BearerAuth
+// @Router /admin/images/catalog/{id}/fetch [post]
+func (h *Handler) HandleFetchCatalogImage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		errors.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+
+	userID, _ := middleware.GetUserID(r.Context())
+	job, err := h.ImageFetcher.Start(chi.URLParam(r, "id"), userID)
+	if err != nil {
+		if stderrors.Is(err, images.ErrCatalogEntryNotFound) {
+			errors.WriteNotFound(w, "Catalog entry")
+			return
+		}
+		logger.Log.Error("Failed to start image fetch", zap.Error(err))
+		errors.WriteInternalError(w, err, h.Config.Env == "development")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// HandleListImageFetches lists catalog downloads and their progress.
+// @Summary List image fetches
+// @Tags admin
+// @Produce json
+// @Success 200 {array} images.FetchJob
+// @Security BearerAuth
+// @Router /admin/images/fetches [get]
+func (h *Handler) HandleListImageFetches(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		errors.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.ImageFetcher.List())
+}
+
+// HandleGetImageFetch reports the progress of a catalog download.
+// @Summary Get image fetch progress
+// @Tags admin
+// @Produce json
+// @Param id path string true "Fetch job ID"
+// @Success 200 {object} images.FetchJob
+// @Failure 404 {object} map[string]interface{} "Fetch job not found"
+// @Security BearerAuth
+// @Router /admin/images/fetches/{id} [get]
+func (h *Handler) HandleGetImageFetch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		errors.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+
+	job, err := h.ImageFetcher.Get(chi.URLParam(r, "id"))
+	if err != nil {
+		errors.WriteNotFound(w, "Fetch job")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// HandleCancelImageFetch cancels a running catalog download.
+// @Summary Cancel image fetch
+// @Tags admin
+// @Param id path string true "Fetch job ID"
+// @Success 204 "Fetch cancelled"
+// @Security BearerAuth
+// @Router /admin/images/fetches/{id} [delete]
+func (h *Handler) HandleCancelImageFetch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "DELETE" {
+		errors.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+
+	if err := h.ImageFetcher.Cancel(chi.URLParam(r, "id")); err != nil {
+		errors.WriteNotFound(w, "Fetch job")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DARC0625/LIMEN/backend/internal/config"
+	"github.com/DARC0625/LIMEN/backend/internal/database"
+	"github.com/DARC0625/LIMEN/backend/internal/images"
+	"github.com/DARC0625/LIMEN/backend/internal/logger"
+	"github.com/DARC0625/LIMEN/backend/internal/middleware"
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"github.com/go-chi/chi/v5"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestImageHandler(t *testing.T) *Handler {
+	logger.Init("debug")
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+
+	if err := db.AutoMigrate(&models.User{}, &models.VM{}, &models.VMImage{}, &models.UserQuota{},
+		&models.ImageUpload{}, &models.AuditLog{}, &models.ConsoleSession{}, &models.ConsoleRecording{}, &models.ConsoleSessionLimit{}, &models.Host{},
+		&models.UserMFA{}, &models.MFARecoveryCode{}, &models.MFARolePolicy{}, &models.WebAuthnCredential{}, &models.ExternalIdentity{}, &models.APIToken{}, &models.Role{}); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+	database.DB = db
+
+	cfg := &config.Config{Env: "test", ISODir: t.TempDir(), ImageUploadMaxGB: 1, ImageUploadChunkMB: 1,
+		ConsoleRecording: "opt-in", ConsoleRecordingDir: t.TempDir()}
+	return NewHandler(db, nil, cfg)
+}
+
+func imageRequest(method, target string, body []byte, userID uint, role string, params map[string]string) *http.Request {
+	req := httptest.NewRequest(method, target, bytes.NewReader(body))
+	rctx := chi.NewRouteContext()
+	for k, v := range params {
+		rctx.URLParams.Add(k, v)
+	}
+	ctx := context.WithValue(req.Context(), chi.RouteCtxKey, rctx)
+	ctx = context.WithValue(ctx, middleware.UserIDKey, userID)
+	ctx = context.WithValue(ctx, middleware.RoleKey, role)
+	return req.WithContext(ctx)
+}
+
+func TestImageUpload_Flow(t *testing.T) {
+	h := setupTestImageHandler(t)
+
+	data := make([]byte, 0x9000)
+	copy(data[0x8001:], "CD001")
+	sum := sha256.Sum256(data)
+	checksum := hex.EncodeToString(sum[:])
+
+	body, _ := json.Marshal(CreateImageUploadRequest{Filename: "alpine.iso", OSType: "ubuntu-server", Size: int64(len(data)), SHA256: checksum})
+	w := httptest.NewRecorder()
+	h.HandleCreateImageUpload(w, imageRequest("POST", "/api/images/uploads", body, 1, "user", nil))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var created ImageUploadResponse
+	json.NewDecoder(w.Body).Decode(&created)
+	id := created.Upload.ID
+	params := map[string]string{"id": id}
+
+	// Another user can't see the upload
+	w = httptest.NewRecorder()
+	h.HandleGetImageUpload(w, imageRequest("GET", "/api/images/uploads/"+id, nil, 2, "user", params))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for other user, got %d", w.Code)
+	}
+
+	// First chunk
+	req := imageRequest("PUT", "/api/images/uploads/"+id, data[:0x4000], 1, "user", params)
+	req.Header.Set("Content-Range", fmt.Sprintf("bytes 0-%d/%d", 0x4000-1, len(data)))
+	w = httptest.NewRecorder()
+	h.HandleImageUploadChunk(w, req)
+	if w.Code != http.StatusOK || w.Header().Get("Upload-Offset") != "16384" {
+		t.Fatalf("Expected status 200 at offset 16384, got %d %q", w.Code, w.Header().Get("Upload-Offset"))
+	}
+
+	// Replaying the first chunk conflicts and reports the resume offset
+	req = imageRequest("PUT", "/api/images/uploads/"+id, data[:0x4000], 1, "user", params)
+	req.Header.Set("Content-Range", fmt.Sprintf("bytes 0-%d/%d", 0x4000-1, len(data)))
+	w = httptest.NewRecorder()
+	h.HandleImageUploadChunk(w, req)
+	if w.Code != http.StatusConflict || w.Header().Get("Upload-Offset") != "16384" {
+		t.Errorf("Expected status 409 with resume offset, got %d %q", w.Code, w.Header().Get("Upload-Offset"))
+	}
+
+	// A body longer than its Content-Range is rejected and discarded
+	req = imageRequest("PUT", "/api/images/uploads/"+id, data[0x4000:0x5001], 1, "user", params)
+	req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", 0x4000, 0x4fff, len(data)))
+	w = httptest.NewRecorder()
+	h.HandleImageUploadChunk(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status 413 for an oversized body, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// Remaining data
+	req = imageRequest("PUT", "/api/images/uploads/"+id, data[0x4000:], 1, "user", params)
+	req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", 0x4000, len(data)-1, len(data)))
+	w = httptest.NewRecorder()
+	h.HandleImageUploadChunk(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	h.HandleCompleteImageUpload(w, imageRequest("POST", "/api/images/uploads/"+id+"/complete", nil, 1, "user", params))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var completed ImageUploadResponse
+	json.NewDecoder(w.Body).Decode(&completed)
+	if completed.Image == nil || completed.Image.SHA256 != checksum {
+		t.Fatalf("Expected registered image, got %+v", completed)
+	}
+
+	// Same checksum again returns the existing image
+	w = httptest.NewRecorder()
+	h.HandleCreateImageUpload(w, imageRequest("POST", "/api/images/uploads", body, 1, "user", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 for duplicate, got %d", w.Code)
+	}
+
+	// Only the owner or an admin may delete
+	imageParams := map[string]string{"id": fmt.Sprintf("%d", completed.Image.ID)}
+	w = httptest.NewRecorder()
+	h.HandleDeleteImage(w, imageRequest("DELETE", "/api/images/1", nil, 2, "user", imageParams))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403, got %d", w.Code)
+	}
+
+	vm := models.VM{Name: "vm1", CPU: 1, Memory: 1024, OwnerID: 1, ImageID: &completed.Image.ID}
+	h.DB.Create(&vm)
+	w = httptest.NewRecorder()
+	h.HandleDeleteImage(w, imageRequest("DELETE", "/api/images/1", nil, 1, "user", imageParams))
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 while in use, got %d", w.Code)
+	}
+
+	h.DB.Delete(&vm)
+	w = httptest.NewRecorder()
+	h.HandleDeleteImage(w, imageRequest("DELETE", "/api/images/1", nil, 3, "admin", imageParams))
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestHandleImageUploadChunk_BadRange(t *testing.T) {
+	h := setupTestImageHandler(t)
+
+	body, _ := json.Marshal(CreateImageUploadRequest{Filename: "a.iso", Size: 100, SHA256: hex.EncodeToString(make([]byte, 32))})
+	w := httptest.NewRecorder()
+	h.HandleCreateImageUpload(w, imageRequest("POST", "/api/images/uploads", body, 1, "user", nil))
+	var created ImageUploadResponse
+	json.NewDecoder(w.Body).Decode(&created)
+	params := map[string]string{"id": created.Upload.ID}
+
+	tests := []struct {
+		name   string
+		header string
+		want   int
+	}{
+		{"missing", "", http.StatusBadRequest},
+		{"wrong total", "bytes 0-9/99", http.StatusBadRequest},
+		{"past end", "bytes 90-100/100", http.StatusBadRequest},
+		{"inverted", "bytes 10-5/100", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := imageRequest("PUT", "/api/images/uploads/x", make([]byte, 10), 1, "user", params)
+			if tt.header != "" {
+				req.Header.Set("Content-Range", tt.header)
+			}
+			w := httptest.NewRecorder()
+			h.HandleImageUploadChunk(w, req)
+			if w.Code != tt.want {
+				t.Errorf("Expected status %d, got %d", tt.want, w.Code)
+			}
+		})
+	}
+}
+
+func TestHandleCreateImageUpload_Invalid(t *testing.T) {
+	h := setupTestImageHandler(t)
+
+	for _, req := range []CreateImageUploadRequest{
+		{Filename: "setup.exe", Size: 100, SHA256: hex.EncodeToString(make([]byte, 32))},
+		{Filename: "setup.iso", OSType: "plan9", Size: 100, SHA256: hex.EncodeToString(make([]byte, 32))},
+	} {
+		body, _ := json.Marshal(req)
+		w := httptest.NewRecorder()
+		h.HandleCreateImageUpload(w, imageRequest("POST", "/api/images/uploads", body, 1, "user", nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: Expected status 400, got %d", req.Filename, w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	h.HandleCreateImageUpload(w, imageRequest("GET", "/api/images/uploads", nil, 1, "user", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405, got %d", w.Code)
+	}
+}
+
+func TestHandleFetchCatalogImage(t *testing.T) {
+	h := setupTestImageHandler(t)
+
+	data := make([]byte, 0x9000)
+	copy(data[0x8001:], "CD001")
+	sum := sha256.Sum256(data)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data)
+	}))
+	defer srv.Close()
+
+	catalogPath := filepath.Join(t.TempDir(), "catalog.json")
+	catalog, _ := json.Marshal(images.Catalog{Entries: []images.CatalogEntry{{
+		ID: "debian-12", Name: "Debian 12", OSType: "debian", URL: srv.URL + "/debian-12.iso", SHA256: hex.EncodeToString(sum[:]),
+	}}})
+	os.WriteFile(catalogPath, catalog, 0644)
+	h.ImageFetcher = images.NewFetcher(h.Images, catalogPath, nil, srv.Client())
+
+	w := httptest.NewRecorder()
+	h.HandleListImageCatalog(w, imageRequest("GET", "/api/admin/images/catalog", nil, 1, "admin", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "debian-12") {
+		t.Fatalf("Expected catalog listing, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	h.HandleFetchCatalogImage(w, imageRequest("POST", "/api/admin/images/catalog/nope/fetch", nil, 1, "admin", map[string]string{"id": "nope"}))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	h.HandleFetchCatalogImage(w, imageRequest("POST", "/api/admin/images/catalog/debian-12/fetch", nil, 1, "admin", map[string]string{"id": "debian-12"}))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d: %s", w.Code, w.Body.String())
+	}
+	var job images.FetchJob
+	json.NewDecoder(w.Body).Decode(&job)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for job.Status != images.FetchStatusCompleted && job.Status != images.FetchStatusFailed && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		w = httptest.NewRecorder()
+		h.HandleGetImageFetch(w, imageRequest("GET", "/api/admin/images/fetches/"+job.ID, nil, 1, "admin", map[string]string{"id": job.ID}))
+		json.NewDecoder(w.Body).Decode(&job)
+	}
+	if job.Status != images.FetchStatusCompleted || job.ImageID == nil {
+		t.Fatalf("Expected completed fetch, got %+v", job)
+	}
+
+	var image models.VMImage
+	if err := h.DB.First(&image, *job.ImageID).Error; err != nil || image.OSType != "debian" {
+		t.Errorf("Expected registered debian image, got %+v (%v)", image, err)
+	}
+}
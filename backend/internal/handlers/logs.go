@@ -20,7 +20,9 @@ import (
 // @Produce     json
 // @Param       hours query int false "Hours to look back (default: 24)" default(24)
 // @Success     200  {object}  logger.LogStats  "Log statistics"
+// @Failure     403  {object}  map[string]interface{}  "Forbidden - logs.read permission required"
 // @Failure     500  {object}  map[string]interface{}  "Internal server error"
+// @Security    BearerAuth
 // @Router      /logs/stats [get]
 func (h *Handler) HandleLogStats(w http.ResponseWriter, r *http.Request, cfg *config.Config) {
 	if r.Method != "GET" {
@@ -64,7 +66,9 @@ func (h *Handler) HandleLogStats(w http.ResponseWriter, r *http.Request, cfg *co
 // @Param       limit query int false "Maximum number of results (default: 100)" default(100)
 // @Success     200  {array}   logger.LogEntry  "Matching log entries"
 // @Failure     400  {object}  map[string]interface{}  "Invalid request"
+// @Failure     403  {object}  map[string]interface{}  "Forbidden - logs.read permission required"
 // @Failure     500  {object}  map[string]interface{}  "Internal server error"
+// @Security    BearerAuth
 // @Router      /logs/search [get]
 func (h *Handler) HandleLogSearch(w http.ResponseWriter, r *http.Request, cfg *config.Config) {
 	if r.Method != "GET" {
@@ -0,0 +1,593 @@
+package handlers
+
+import (
+	"encoding/json"
+	stderrors "errors"
+	"net/http"
+	"strconv"
+
+	"github.com/DARC0625/LIMEN/backend/internal/audit"
+	"github.com/DARC0625/LIMEN/backend/internal/auth"
+	"github.com/DARC0625/LIMEN/backend/internal/config"
+	"github.com/DARC0625/LIMEN/backend/internal/errors"
+	"github.com/DARC0625/LIMEN/backend/internal/logger"
+	"github.com/DARC0625/LIMEN/backend/internal/metrics"
+	"github.com/DARC0625/LIMEN/backend/internal/middleware"
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"github.com/DARC0625/LIMEN/backend/internal/webauthn"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// MFAChallengeResponse is returned by HandleLogin instead of tokens when the user must
+// complete the login with a second factor.
+type MFAChallengeResponse struct {
+	MFARequired           bool     `json:"mfa_required"`
+	MFAEnrollmentRequired bool     `json:"mfa_enrollment_required,omitempty"` // The user's role requires MFA but they haven't enrolled
+	MFAMethods            []string `json:"mfa_methods"`                       // Second factors the user can use: totp, webauthn
+	MFAToken              string   `json:"mfa_token"`
+	ExpiresIn             int      `json:"expires_in"` // Seconds left to complete the login
+}
+
+// MFALoginRequest completes a login with the MFAChallengeResponse token and either a
+// TOTP code, a recovery code, or a WebAuthn assertion for the session returned by
+// /auth/login/mfa/webauthn.
+type MFALoginRequest struct {
+	MFAToken        string                      `json:"mfa_token"`
+	Code            string                      `json:"code,omitempty"`
+	RecoveryCode    string                      `json:"recovery_code,omitempty"`
+	WebAuthnSession string                      `json:"webauthn_session,omitempty"`
+	WebAuthn        *webauthn.AssertionResponse `json:"webauthn,omitempty"`
+}
+
+// MFACodeRequest confirms an MFA change with a TOTP code, or a recovery code.
+type MFACodeRequest struct {
+	Code         string `json:"code,omitempty"`
+	RecoveryCode string `json:"recovery_code,omitempty"`
+}
+
+// MFAEnrollResponse is a new TOTP secret to add to an authenticator app.
+type MFAEnrollResponse struct {
+	Secret          string `json:"secret"`           // Base32, for manual entry
+	ProvisioningURI string `json:"provisioning_uri"` // otpauth:// URI, to render as a QR code
+}
+
+// MFARolePolicyRequest sets whether a role requires MFA.
+type MFARolePolicyRequest struct {
+	Required bool `json:"required"`
+}
+
+// writeMFAChallenge answers a login whose password was right with the challenge to
+// complete it with one of methods, or with enrollment when the user has none.
+func (h *Handler) writeMFAChallenge(w http.ResponseWriter, userID uint, methods []string) {
+	enroll := len(methods) == 0
+	token, _, err := h.MFA.IssueChallenge(userID, enroll)
+	if err != nil {
+		logger.Log.Error("Failed to issue MFA challenge", zap.Uint("user_id", userID), zap.Error(err))
+		errors.WriteInternalError(w, err, false)
+		return
+	}
+	logger.Log.Info("Login awaiting second factor", zap.Uint("user_id", userID), zap.Bool("enrollment", enroll))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(MFAChallengeResponse{
+		MFARequired:           true,
+		MFAEnrollmentRequired: enroll,
+		MFAMethods:            append([]string{}, methods...),
+		MFAToken:              token,
+		ExpiresIn:             int(auth.MFAChallengeTTL.Seconds()),
+	})
+}
+
+// checkMFACode runs check, the verification of a code the user typed, under the login
+// guard: wrong codes count as failed logins, so they can't be brute-forced. It writes
+// the error response and returns false unless the code was accepted.
+func (h *Handler) checkMFACode(w http.ResponseWriter, r *http.Request, user *models.User, check func() error) bool {
+	clientIP := h.clientIP(r)
+	decision, done := h.LoginGuard.Begin(user.ID, user.Username, clientIP)
+	defer done()
+	if !decision.Allowed() {
+		writeLoginBlocked(w, decision, user.ID, clientIP)
+		return false
+	}
+
+	err := check()
+	switch {
+	case err == nil:
+		return true
+	case stderrors.Is(err, auth.ErrInvalidMFACode):
+		h.LoginGuard.RecordFailure(r.Context(), user.ID, user.Username, clientIP)
+		metrics.AuthFailureTotal.WithLabelValues("invalid_mfa_code").Inc()
+		errors.WriteUnauthorized(w, "Invalid MFA code")
+	case stderrors.Is(err, auth.ErrMFANotEnrolled):
+		errors.WriteBadRequest(w, "MFA is not enrolled", nil)
+	case stderrors.Is(err, auth.ErrMFAAlreadyEnabled):
+		errors.WriteError(w, http.StatusConflict, "MFA is already enabled", nil)
+	default:
+		logger.Log.Error("Failed to verify MFA code", zap.Uint("user_id", user.ID), zap.Error(err))
+		errors.WriteInternalError(w, err, false)
+	}
+	return false
+}
+
+// verifyMFACode checks a TOTP code, or else a recovery code, of a user with MFA enabled.
+func (h *Handler) verifyMFACode(r *http.Request, user *models.User, req MFACodeRequest) error {
+	if req.Code != "" || req.RecoveryCode == "" {
+		return h.MFA.Verify(user.ID, req.Code)
+	}
+	if err := h.MFA.VerifyRecoveryCode(user.ID, req.RecoveryCode); err != nil {
+		return err
+	}
+	status, err := h.MFA.Status(user.ID, string(user.Role))
+	left := 0
+	if err == nil {
+		left = status.RecoveryCodesLeft
+	}
+	logger.Log.Warn("MFA recovery code used", zap.Uint("user_id", user.ID), zap.Int("recovery_codes_left", left))
+	audit.LogMFARecoveryCodeUse(r.Context(), user.ID, left)
+	return nil
+}
+
+// mfaUser loads the authenticated user, writing the error response if that fails.
+func (h *Handler) mfaUser(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		errors.WriteUnauthorized(w, "Authentication required")
+		return nil, false
+	}
+	var user models.User
+	if err := h.DB.First(&user, userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			errors.WriteUnauthorized(w, "Authentication required")
+		} else {
+			logger.Log.Error("Failed to fetch user", zap.Error(err))
+			errors.WriteInternalError(w, err, false)
+		}
+		return nil, false
+	}
+	return &user, true
+}
+
+// challengeUser loads the user of an MFA challenge, writing the error response if the
+// challenge is invalid.
+func (h *Handler) challengeUser(w http.ResponseWriter, token string) (*auth.MFAChallengeClaims, *models.User, bool) {
+	claims, err := h.MFA.ParseChallenge(token)
+	if err != nil {
+		errors.WriteUnauthorized(w, "Invalid or expired MFA token")
+		return nil, nil, false
+	}
+	var user models.User
+	if err := h.DB.First(&user, claims.UserID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			errors.WriteUnauthorized(w, "Invalid or expired MFA token")
+		} else {
+			logger.Log.Error("Failed to fetch user", zap.Error(err))
+			errors.WriteInternalError(w, err, false)
+		}
+		return nil, nil, false
+	}
+	return claims, &user, true
+}
+
+// HandleLoginMFA handles POST /api/auth/login/mfa - Complete a login with a second factor.
+// @Summary     Complete an MFA login
+// @Description Exchanges the mfa_token of a login and a TOTP code (or a recovery code) for tokens, like
+// @Description /auth/login. Users with passkeys can instead send the webauthn_session from /auth/login/mfa/webauthn
+// @Description and the webauthn assertion of navigator.credentials.get(). When the login required enrollment, the code must come from the secret returned by
+// @Description /auth/login/mfa/enroll; MFA is then enabled and the response lists the recovery codes, shown only once.
+// @Description Wrong codes count as failed logins.
+// @Tags        Authentication
+// @Accept      json
+// @Produce     json
+// @Param       request body MFALoginRequest true "MFA token and code"
+// @Success     200  {object}  LoginResponse  "Login successful"
+// @Failure     400  {object}  map[string]interface{}  "Invalid request"
+// @Failure     401  {object}  map[string]interface{}  "Invalid MFA token or code"
+// @Failure     403  {object}  map[string]interface{}  "Account locked or not approved"
+// @Failure     429  {object}  map[string]interface{}  "Too many failed attempts"
+// @Router      /auth/login/mfa [post]
+func (h *Handler) HandleLoginMFA(w http.ResponseWriter, r *http.Request, cfg *config.Config) {
+	if r.Method != "POST" {
+		errors.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+
+	var req MFALoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errors.WriteBadRequest(w, "Invalid request body", err)
+		return
+	}
+	claims, user, ok := h.challengeUser(w, req.MFAToken)
+	if !ok {
+		return
+	}
+
+	var recoveryCodes []string
+	ok = h.checkMFACode(w, r, user, func() error {
+		if claims.Enroll {
+			var err error
+			recoveryCodes, err = h.MFA.Activate(user.ID, req.Code)
+			return err
+		}
+		if req.WebAuthn != nil {
+			return h.verifyWebAuthnFactor(user, req.WebAuthnSession, req.WebAuthn)
+		}
+		return h.verifyMFACode(r, user, MFACodeRequest{Code: req.Code, RecoveryCode: req.RecoveryCode})
+	})
+	if !ok {
+		return
+	}
+	if claims.Enroll {
+		logger.Log.Info("MFA enabled during login", zap.Uint("user_id", user.ID))
+		audit.LogMFAChange(r.Context(), user.ID, "enable")
+	}
+
+	h.completeLogin(w, r, cfg, user, recoveryCodes)
+}
+
+// HandleLoginMFAEnroll handles POST /api/auth/login/mfa/enroll - Enroll MFA during a login.
+// @Summary     Enroll MFA during a login
+// @Description Generates the TOTP secret of a user logging in whose role requires MFA (mfa_enrollment_required).
+// @Description Add it to an authenticator app, then complete the login at /auth/login/mfa with a code.
+// @Tags        Authentication
+// @Accept      json
+// @Produce     json
+// @Param       request body MFALoginRequest true "MFA token"
+// @Success     200  {object}  MFAEnrollResponse  "TOTP secret"
+// @Failure     400  {object}  map[string]interface{}  "The login doesn't require enrollment"
+// @Failure     401  {object}  map[string]interface{}  "Invalid or expired MFA token"
+// @Failure     409  {object}  map[string]interface{}  "MFA is already enabled"
+// @Failure     503  {object}  map[string]interface{}  "MFA enrollment is unavailable"
+// @Router      /auth/login/mfa/enroll [post]
+func (h *Handler) HandleLoginMFAEnroll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		errors.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+
+	var req MFALoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errors.WriteBadRequest(w, "Invalid request body", err)
+		return
+	}
+	claims, user, ok := h.challengeUser(w, req.MFAToken)
+	if !ok {
+		return
+	}
+	if !claims.Enroll {
+		errors.WriteBadRequest(w, "This login doesn't require MFA enrollment", nil)
+		return
+	}
+	h.writeMFAEnrollment(w, user)
+}
+
+// writeMFAEnrollment starts the MFA enrollment of user.
+func (h *Handler) writeMFAEnrollment(w http.ResponseWriter, user *models.User) {
+	secret, uri, err := h.MFA.Enroll(user.ID, user.Username)
+	if err != nil {
+		if stderrors.Is(err, auth.ErrMFAAlreadyEnabled) {
+			errors.WriteError(w, http.StatusConflict, "MFA is already enabled", nil)
+			return
+		}
+		if stderrors.Is(err, auth.ErrMFAEnrollmentDisabled) {
+			errors.WriteServiceUnavailable(w, "MFA enrollment is unavailable", err, false)
+			return
+		}
+		logger.Log.Error("Failed to enroll MFA", zap.Uint("user_id", user.ID), zap.Error(err))
+		errors.WriteInternalError(w, err, false)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(MFAEnrollResponse{Secret: secret, ProvisioningURI: uri})
+}
+
+// HandleGetMFA handles GET /api/auth/mfa - Get the user's MFA status.
+// @Summary     Get my MFA status
+// @Description Whether MFA is enabled, whether the user's role requires it, and how many recovery codes are left
+// @Tags        Authentication
+// @Produce     json
+// @Success     200  {object}  auth.MFAStatus
+// @Failure     401  {object}  map[string]interface{}  "Authentication required"
+// @Security    BearerAuth
+// @Router      /auth/mfa [get]
+func (h *Handler) HandleGetMFA(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.mfaUser(w, r)
+	if !ok {
+		return
+	}
+	status, err := h.MFA.Status(user.ID, string(user.Role))
+	if err != nil {
+		logger.Log.Error("Failed to get MFA status", zap.Uint("user_id", user.ID), zap.Error(err))
+		errors.WriteInternalError(w, err, false)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// HandleEnrollMFA handles POST /api/auth/mfa/enroll - Start enrolling MFA.
+// @Summary     Enroll MFA
+// @Description Generates a TOTP secret, replacing a pending one. MFA is enabled once /auth/mfa/verify confirms a code.
+// @Tags        Authentication
+// @Produce     json
+// @Success     200  {object}  MFAEnrollResponse  "TOTP secret"
+// @Failure     401  {object}  map[string]interface{}  "Authentication required"
+// @Failure     409  {object}  map[string]interface{}  "MFA is already enabled"
+// @Failure     503  {object}  map[string]interface{}  "MFA enrollment is unavailable"
+// @Security    BearerAuth
+// @Router      /auth/mfa/enroll [post]
+func (h *Handler) HandleEnrollMFA(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		errors.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+	user, ok := h.mfaUser(w, r)
+	if !ok {
+		return
+	}
+	h.writeMFAEnrollment(w, user)
+}
+
+// HandleVerifyMFA handles POST /api/auth/mfa/verify - Enable MFA.
+// @Summary     Enable MFA
+// @Description Enables the enrolled TOTP secret once a code from it is confirmed, and returns the recovery codes,
+// @Description shown only once.
+// @Tags        Authentication
+// @Accept      json
+// @Produce     json
+// @Param       request body MFACodeRequest true "TOTP code"
+// @Success     200  {object}  map[string]interface{}  "recovery_codes"
+// @Failure     400  {object}  map[string]interface{}  "MFA is not enrolled"
+// @Failure     401  {object}  map[string]interface{}  "Invalid MFA code"
+// @Failure     409  {object}  map[string]interface{}  "MFA is already enabled"
+// @Security    BearerAuth
+// @Router      /auth/mfa/verify [post]
+func (h *Handler) HandleVerifyMFA(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		errors.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+	user, ok := h.mfaUser(w, r)
+	if !ok {
+		return
+	}
+	var req MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errors.WriteBadRequest(w, "Invalid request body", err)
+		return
+	}
+
+	var codes []string
+	if !h.checkMFACode(w, r, user, func() error {
+		var err error
+		codes, err = h.MFA.Activate(user.ID, req.Code)
+		return err
+	}) {
+		return
+	}
+	logger.Log.Info("MFA enabled", zap.Uint("user_id", user.ID))
+	audit.LogMFAChange(r.Context(), user.ID, "enable")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"recovery_codes": codes,
+	})
+}
+
+// HandleDisableMFA handles DELETE /api/auth/mfa - Disable MFA.
+// @Summary     Disable MFA
+// @Description Removes the user's authenticator and recovery codes, confirmed by a current TOTP code or a recovery
+// @Description code. Refused when the user's role requires MFA and they have no passkey left to use instead.
+// @Tags        Authentication
+// @Accept      json
+// @Produce     json
+// @Param       request body MFACodeRequest true "TOTP or recovery code"
+// @Success     200  {object}  map[string]interface{}  "MFA disabled"
+// @Failure     400  {object}  map[string]interface{}  "MFA is not enrolled"
+// @Failure     401  {object}  map[string]interface{}  "Invalid MFA code"
+// @Failure     403  {object}  map[string]interface{}  "MFA is required for the user's role"
+// @Security    BearerAuth
+// @Router      /auth/mfa [delete]
+func (h *Handler) HandleDisableMFA(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.mfaUser(w, r)
+	if !ok {
+		return
+	}
+	var req MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errors.WriteBadRequest(w, "Invalid request body", err)
+		return
+	}
+	if h.MFA.RoleRequired(string(user.Role)) {
+		status, err := h.MFA.Status(user.ID, string(user.Role))
+		if err != nil {
+			logger.Log.Error("Failed to get MFA status", zap.Uint("user_id", user.ID), zap.Error(err))
+			errors.WriteInternalError(w, err, false)
+			return
+		}
+		if status.WebAuthnCredentials == 0 {
+			errors.WriteForbidden(w, "MFA is required for your role")
+			return
+		}
+	}
+	if !h.checkMFACode(w, r, user, func() error { return h.verifyMFACode(r, user, req) }) {
+		return
+	}
+
+	if _, err := h.MFA.Disable(user.ID); err != nil {
+		logger.Log.Error("Failed to disable MFA", zap.Uint("user_id", user.ID), zap.Error(err))
+		errors.WriteInternalError(w, err, false)
+		return
+	}
+	logger.Log.Info("MFA disabled", zap.Uint("user_id", user.ID))
+	audit.LogMFAChange(r.Context(), user.ID, "disable")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "MFA disabled",
+	})
+}
+
+// HandleRegenerateRecoveryCodes handles POST /api/auth/mfa/recovery-codes - Replace the recovery codes.
+// @Summary     Regenerate MFA recovery codes
+// @Description Replaces the user's recovery codes, confirmed by a current TOTP code. The old codes stop working;
+// @Description the new ones are shown only once.
+// @Tags        Authentication
+// @Accept      json
+// @Produce     json
+// @Param       request body MFACodeRequest true "TOTP code"
+// @Success     200  {object}  map[string]interface{}  "recovery_codes"
+// @Failure     400  {object}  map[string]interface{}  "MFA is not enrolled"
+// @Failure     401  {object}  map[string]interface{}  "Invalid MFA code"
+// @Security    BearerAuth
+// @Router      /auth/mfa/recovery-codes [post]
+func (h *Handler) HandleRegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		errors.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+	user, ok := h.mfaUser(w, r)
+	if !ok {
+		return
+	}
+	var req MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errors.WriteBadRequest(w, "Invalid request body", err)
+		return
+	}
+	if !h.checkMFACode(w, r, user, func() error { return h.MFA.Verify(user.ID, req.Code) }) {
+		return
+	}
+
+	codes, err := h.MFA.RegenerateRecoveryCodes(user.ID)
+	if err != nil {
+		logger.Log.Error("Failed to regenerate recovery codes", zap.Uint("user_id", user.ID), zap.Error(err))
+		errors.WriteInternalError(w, err, false)
+		return
+	}
+	audit.LogMFAChange(r.Context(), user.ID, "recovery_codes_regenerate")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"recovery_codes": codes,
+	})
+}
+
+// HandleListMFARolePolicies handles GET /api/admin/mfa/roles - List which roles require MFA.
+// @Summary     List MFA role policies
+// @Description Whether users of each role must use MFA (admin only)
+// @Tags        Admin
+// @Produce     json
+// @Success     200  {array}   models.MFARolePolicy
+// @Failure     403  {object}  map[string]interface{}  "Forbidden - admin access required"
+// @Security    BearerAuth
+// @Router      /admin/mfa/roles [get]
+func (h *Handler) HandleListMFARolePolicies(w http.ResponseWriter, r *http.Request) {
+	policies, err := h.MFA.RolePolicies(h.Roles.Names())
+	if err != nil {
+		logger.Log.Error("Failed to list MFA role policies", zap.Error(err))
+		errors.WriteInternalError(w, err, false)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(policies)
+}
+
+// HandleSetMFARolePolicy handles PUT /api/admin/mfa/roles/{role} - Set whether a role requires MFA.
+// @Summary     Set an MFA role policy
+// @Description Sets whether users of a role must use MFA (admin only). Users of a role requiring it who haven't
+// @Description enrolled enroll during their next login; their current sessions are kept.
+// @Tags        Admin
+// @Accept      json
+// @Produce     json
+// @Param       role path string true "Role (built-in or custom)"
+// @Param       policy body MFARolePolicyRequest true "Policy"
+// @Success     200  {object}  models.MFARolePolicy
+// @Failure     400  {object}  map[string]interface{}  "Invalid role or request"
+// @Failure     403  {object}  map[string]interface{}  "Forbidden - admin access required"
+// @Security    BearerAuth
+// @Router      /admin/mfa/roles/{role} [put]
+func (h *Handler) HandleSetMFARolePolicy(w http.ResponseWriter, r *http.Request) {
+	role := models.UserRole(chi.URLParam(r, "role"))
+	if !h.Roles.Exists(string(role)) {
+		errors.WriteBadRequest(w, "Invalid role", nil)
+		return
+	}
+	var req MFARolePolicyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errors.WriteBadRequest(w, "Invalid request body", err)
+		return
+	}
+
+	policy, err := h.MFA.SetRoleRequired(string(role), req.Required)
+	if err != nil {
+		logger.Log.Error("Failed to set MFA role policy", zap.String("role", string(role)), zap.Error(err))
+		errors.WriteInternalError(w, err, false)
+		return
+	}
+	logger.Log.Info("MFA role policy set", zap.String("role", string(role)), zap.Bool("required", req.Required))
+	audit.LogMFARolePolicyChange(r.Context(), string(role), req.Required)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(policy)
+}
+
+// HandleResetUserMFA handles DELETE /api/admin/users/{id}/mfa - Reset a user's MFA
+// @Summary     Reset a user's MFA
+// @Description Removes a user's authenticator, recovery codes and passkeys, e.g. after they lost their device (admin only).
+// @Description If their role requires MFA, they enroll again during their next login.
+// @Tags        Admin
+// @Produce     json
+// @Param       id path int true "User ID"
+// @Success     200  {object}  map[string]interface{}  "Whether MFA was enabled"
+// @Failure     400  {object}  map[string]interface{}  "Invalid user ID"
+// @Failure     403  {object}  map[string]interface{}  "Forbidden - admin access required"
+// @Failure     404  {object}  map[string]interface{}  "User not found"
+// @Security    BearerAuth
+// @Router      /admin/users/{id}/mfa [delete]
+func (h *Handler) HandleResetUserMFA(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	userID, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		errors.WriteBadRequest(w, "Invalid user ID", err)
+		return
+	}
+
+	var user models.User
+	if err := h.DB.First(&user, userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			errors.WriteNotFound(w, "User not found")
+		} else {
+			logger.Log.Error("Failed to fetch user", zap.Error(err))
+			errors.WriteInternalError(w, err, false)
+		}
+		return
+	}
+
+	wasEnabled, err := h.MFA.Disable(user.ID)
+	if err != nil {
+		logger.Log.Error("Failed to reset MFA", zap.Uint("user_id", user.ID), zap.Error(err))
+		errors.WriteInternalError(w, err, false)
+		return
+	}
+	credentials, err := h.WebAuthn.DeleteUserCredentials(user.ID)
+	if err != nil {
+		logger.Log.Error("Failed to remove WebAuthn credentials", zap.Uint("user_id", user.ID), zap.Error(err))
+		errors.WriteInternalError(w, err, false)
+		return
+	}
+	logger.Log.Info("MFA reset by admin", zap.Uint("user_id", user.ID), zap.Bool("was_enabled", wasEnabled),
+		zap.Int64("webauthn_credentials", credentials))
+	audit.LogMFAChange(r.Context(), user.ID, "reset")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"user_id":                      user.ID,
+		"was_enabled":                  wasEnabled,
+		"webauthn_credentials_removed": credentials,
+	})
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DARC0625/LIMEN/backend/internal/auth"
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHandleLogin_MFAEnforcedForRole(t *testing.T) {
+	h := setupTestImageHandler(t)
+	if err := h.DB.AutoMigrate(&models.LoginFailure{}, &models.AuthSession{}, &models.AuthRefreshToken{}); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+	auth.SetSessionStore(auth.NewDBSessionStore(h.DB))
+	t.Cleanup(func() { auth.SetSessionStore(auth.NewSessionStore()) })
+	h.Config.JWTSecret = "test-secret"
+	// bcrypt: Argon2 hashes depend on the hardware profile other tests change
+	hashed, _ := bcrypt.GenerateFromPassword([]byte("correct-password"), bcrypt.MinCost)
+	user := models.User{Username: "alice", Password: string(hashed), Role: models.RoleUser, Approved: true}
+	h.DB.Create(&user)
+
+	post := func(handler func(http.ResponseWriter, *http.Request), body interface{}) (*httptest.ResponseRecorder, map[string]interface{}) {
+		raw, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("POST", "/api/auth/login", bytes.NewReader(raw)))
+		var resp map[string]interface{}
+		json.NewDecoder(bytes.NewReader(w.Body.Bytes())).Decode(&resp)
+		return w, resp
+	}
+	login := func(w http.ResponseWriter, r *http.Request) { h.HandleLogin(w, r, h.Config) }
+	loginMFA := func(w http.ResponseWriter, r *http.Request) { h.HandleLoginMFA(w, r, h.Config) }
+
+	w := httptest.NewRecorder()
+	h.HandleSetMFARolePolicy(w, imageRequest("PUT", "/api/admin/mfa/roles/user", []byte(`{"required":true}`), 99, "admin", map[string]string{"role": "user"}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("set role policy = %d: %s", w.Code, w.Body.String())
+	}
+
+	// The password alone only earns a challenge, which requires enrolling
+	w, resp := post(login, LoginRequest{Username: "alice", Password: "correct-password"})
+	if w.Code != http.StatusOK || resp["mfa_required"] != true || resp["mfa_enrollment_required"] != true || resp["access_token"] != nil {
+		t.Fatalf("login = %d %v, want an enrollment challenge", w.Code, resp)
+	}
+	challenge := resp["mfa_token"].(string)
+	if _, err := auth.ValidateToken(challenge, h.Config.JWTSecret); err == nil {
+		t.Fatal("MFA challenge accepted as an access token")
+	}
+
+	w, resp = post(h.HandleLoginMFAEnroll, MFALoginRequest{MFAToken: challenge})
+	secret, _ := resp["secret"].(string)
+	if w.Code != http.StatusOK || secret == "" {
+		t.Fatalf("enroll = %d %v", w.Code, resp)
+	}
+	code, _ := auth.TOTPCode(secret, auth.TOTPStep(time.Now()))
+	w, resp = post(loginMFA, MFALoginRequest{MFAToken: challenge, Code: code})
+	codes, _ := resp["recovery_codes"].([]interface{})
+	if w.Code != http.StatusOK || resp["access_token"] == nil || len(codes) != auth.RecoveryCodeCount {
+		t.Fatalf("complete enrollment = %d %v, want tokens and recovery codes", w.Code, resp)
+	}
+
+	// Next login: a wrong code counts as a failed attempt, a recovery code logs in
+	_, resp = post(login, LoginRequest{Username: "alice", Password: "correct-password"})
+	if resp["mfa_required"] != true || resp["mfa_enrollment_required"] == true {
+		t.Fatalf("second login = %v, want a challenge without enrollment", resp)
+	}
+	challenge = resp["mfa_token"].(string)
+	if w, _ := post(loginMFA, MFALoginRequest{MFAToken: challenge, Code: "000000"}); w.Code != http.StatusUnauthorized {
+		t.Errorf("wrong code = %d, want 401", w.Code)
+	}
+	var failures int64
+	h.DB.Model(&models.LoginFailure{}).Where("user_id = ?", user.ID).Count(&failures)
+	if failures != 1 {
+		t.Errorf("failed attempts after a wrong code = %d, want 1", failures)
+	}
+	if w, _ := post(loginMFA, MFALoginRequest{MFAToken: "forged", Code: code}); w.Code != http.StatusUnauthorized {
+		t.Errorf("invalid mfa_token = %d, want 401", w.Code)
+	}
+	w, resp = post(loginMFA, MFALoginRequest{MFAToken: challenge, RecoveryCode: codes[0].(string)})
+	if w.Code != http.StatusOK || resp["access_token"] == nil {
+		t.Fatalf("recovery code login = %d %v", w.Code, resp)
+	}
+
+	// MFA can't be disabled while the role requires it, but an admin can reset it
+	w = httptest.NewRecorder()
+	h.HandleDisableMFA(w, imageRequest("DELETE", "/api/auth/mfa", []byte(`{"recovery_code":"`+codes[1].(string)+`"}`), user.ID, "user", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("disable while required = %d, want 403", w.Code)
+	}
+	w = httptest.NewRecorder()
+	h.HandleResetUserMFA(w, imageRequest("DELETE", "/api/admin/users/1/mfa", nil, 99, "admin", map[string]string{"id": "1"}))
+	if w.Code != http.StatusOK || !bytes.Contains(w.Body.Bytes(), []byte(`"was_enabled":true`)) {
+		t.Fatalf("admin reset = %d: %s", w.Code, w.Body.String())
+	}
+	_, resp = post(login, LoginRequest{Username: "alice", Password: "correct-password"})
+	if resp["mfa_enrollment_required"] != true {
+		t.Errorf("login after reset = %v, want an enrollment challenge", resp)
+	}
+}
+
+func TestHandleMFA_SelfServiceEnrollment(t *testing.T) {
+	h := setupTestImageHandler(t)
+	if err := h.DB.AutoMigrate(&models.LoginFailure{}); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+	user := models.User{Username: "bob", Password: "x", Role: models.RoleUser, Approved: true}
+	h.DB.Create(&user)
+
+	w := httptest.NewRecorder()
+	h.HandleEnrollMFA(w, imageRequest("POST", "/api/auth/mfa/enroll", nil, user.ID, "user", nil))
+	var enrollment MFAEnrollResponse
+	json.NewDecoder(w.Body).Decode(&enrollment)
+	if w.Code != http.StatusOK || enrollment.Secret == "" {
+		t.Fatalf("enroll = %d %+v", w.Code, enrollment)
+	}
+
+	code, _ := auth.TOTPCode(enrollment.Secret, auth.TOTPStep(time.Now()))
+	w = httptest.NewRecorder()
+	h.HandleVerifyMFA(w, imageRequest("POST", "/api/auth/mfa/verify", []byte(`{"code":"`+code+`"}`), user.ID, "user", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("verify = %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	h.HandleGetMFA(w, imageRequest("GET", "/api/auth/mfa", nil, user.ID, "user", nil))
+	var status auth.MFAStatus
+	json.NewDecoder(w.Body).Decode(&status)
+	if !status.Enabled || status.Required || status.RecoveryCodesLeft != auth.RecoveryCodeCount {
+		t.Errorf("status = %+v, want enabled, not required, with all recovery codes", status)
+	}
+
+	// The code that enabled MFA can't be used again to disable it
+	w = httptest.NewRecorder()
+	h.HandleDisableMFA(w, imageRequest("DELETE", "/api/auth/mfa", []byte(`{"code":"`+code+`"}`), user.ID, "user", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("disable with a replayed code = %d, want 401", w.Code)
+	}
+	var logs int64
+	h.DB.Model(&models.AuditLog{}).Where("action = ?", "auth.mfa_enable").Count(&logs)
+	if logs != 1 {
+		t.Errorf("MFA enable audit logs = %d, want 1", logs)
+	}
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/DARC0625/LIMEN/backend/internal/audit"
+	"github.com/DARC0625/LIMEN/backend/internal/errors"
+	"github.com/DARC0625/LIMEN/backend/internal/logger"
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"github.com/DARC0625/LIMEN/backend/internal/vm"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// MigrateVMRequest moves a VM to another host.
+type MigrateVMRequest struct {
+	HostID      uint `json:"host_id,omitempty" example:"2"`          // Destination host; omitted = the host the scheduler picks
+	CopyStorage bool `json:"copy_storage,omitempty" example:"false"` // Copy the VM's disks: the hosts don't share storage
+}
+
+// HandleMigrateVM starts moving a VM to another host.
+// @Summary Migrate VM to another host
+// @Description A running VM is migrated live and keeps running; a stopped VM only has its
+// @Description definition moved. With copy_storage, disks are copied to the destination (running
+// @Description VMs only, into a storage pool covering the VM directory there); VMs with UEFI NVRAM,
+// @Description a TPM or an inserted ISO are refused. Otherwise the hosts must share storage under
+// @Description the same paths. The
+// @Description migration runs in the background and reports "vm_migration" messages on the status
+// @Description WebSocket. The VM's host changes only once it is on the destination.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param uuid path string true "VM UUID" format(uuid)
+// @Param request body MigrateVMRequest false "Destination and options"
+// @Success 202 {object} vm.Migration
+// @Failure 400 {object} map[string]interface{} "Invalid request, or storage can't be copied for the VM"
+// @Failure 404 {object} map[string]interface{} "VM not found"
+// @Failure 409 {object} map[string]interface{} "No host can take the VM, or it is already being migrated"
+// @Security BearerAuth
+// @Router /vms/{uuid}/migrate [post]
+func (h *Handler) HandleMigrateVM(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		errors.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+
+	uuidStr := chi.URLParam(r, "uuid")
+	if uuidStr == "" {
+		errors.WriteBadRequest(w, "VM UUID is required", nil)
+		return
+	}
+	var req MigrateVMRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		errors.WriteBadRequest(w, "Invalid request body", err)
+		return
+	}
+
+	var vmRec models.VM
+	if err := h.DB.Where("uuid = ?", uuidStr).First(&vmRec).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			errors.WriteNotFound(w, "VM")
+		} else {
+			logger.Log.Error("Failed to find VM", zap.Error(err), zap.String("vm_uuid", uuidStr))
+			errors.WriteInternalError(w, err, h.Config.Env == "development")
+		}
+		return
+	}
+	if h.VMService == nil {
+		errors.WriteInternalError(w, fmt.Errorf("VM service is not available"), h.Config.Env == "development")
+		return
+	}
+
+	migration, err := h.VMService.BeginMigration(vmRec.Name, req.HostID, vm.MigrateOptions{CopyStorage: req.CopyStorage})
+	switch {
+	case err == nil:
+	case stderrors.Is(err, vm.ErrNoHostAvailable), stderrors.Is(err, vm.ErrMigrationInProgress):
+		errors.WriteError(w, http.StatusConflict, err.Error(), nil)
+		return
+	case stderrors.Is(err, vm.ErrCopyStorageOffline), stderrors.Is(err, vm.ErrCopyStorageUnsupported):
+		errors.WriteBadRequest(w, err.Error(), nil)
+		return
+	default:
+		logger.Log.Error("Failed to plan VM migration", zap.Error(err), zap.String("vm_name", vmRec.Name))
+		errors.WriteInternalError(w, err, h.Config.Env == "development")
+		return
+	}
+
+	// The migration outlives the request; keep the caller's identity for the audit log
+	ctx := context.WithoutCancel(r.Context())
+	go func() {
+		err := migration.Run(func(progress vm.MigrationProgress) {
+			h.VMStatusBroadcaster.BroadcastMigrationProgress(vmRec, progress)
+		})
+		errMsg := ""
+		if err != nil {
+			errMsg = err.Error()
+		}
+		audit.LogVMMigrate(ctx, vmRec.UUID, migration.Source.ID, migration.Dest.ID, migration.Live, migration.CopyStorage, err == nil, errMsg)
+		if err == nil {
+			h.DB.First(&vmRec, vmRec.ID)
+			h.VMStatusBroadcaster.BroadcastVMUpdate(vmRec)
+		}
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(migration)
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+)
+
+func TestHandleMigrateVM_Validation(t *testing.T) {
+	h := setupTestImageHandler(t)
+	h.DB.Create(&models.VM{Name: "web", UUID: "11111111-1111-1111-1111-111111111111", CPU: 1, Memory: 1024})
+
+	tests := []struct {
+		name string
+		uuid string
+		body string
+		want int
+	}{
+		{"unknown VM", "22222222-2222-2222-2222-222222222222", `{}`, http.StatusNotFound},
+		{"invalid body", "11111111-1111-1111-1111-111111111111", `{"host_id":"two"}`, http.StatusBadRequest},
+		{"no VM service", "11111111-1111-1111-1111-111111111111", ``, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		req := imageRequest(http.MethodPost, "/api/vms/"+tt.uuid+"/migrate", []byte(tt.body), 99, "admin", map[string]string{"uuid": tt.uuid})
+		w := httptest.NewRecorder()
+		h.HandleMigrateVM(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d (%s)", tt.name, w.Code, tt.want, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	stderrors "errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/DARC0625/LIMEN/backend/internal/audit"
+	"github.com/DARC0625/LIMEN/backend/internal/config"
+	"github.com/DARC0625/LIMEN/backend/internal/errors"
+	"github.com/DARC0625/LIMEN/backend/internal/logger"
+	"github.com/DARC0625/LIMEN/backend/internal/metrics"
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"github.com/DARC0625/LIMEN/backend/internal/oidc"
+	"go.uber.org/zap"
+)
+
+// oidcStateCookie keeps a single sign-on login's state between the redirect to the
+// identity provider and the callback.
+const oidcStateCookie = "oidc_state"
+
+// ssoRedirectPath returns redirect if it is a path of the web app, and fallback
+// otherwise: logins must not send users to other sites.
+func ssoRedirectPath(redirect, fallback string) string {
+	if !strings.HasPrefix(redirect, "/") || strings.HasPrefix(redirect, "//") || strings.ContainsAny(redirect, "\\\r\n") {
+		return fallback
+	}
+	return redirect
+}
+
+// redirectSSOError sends a browser whose single sign-on failed back to the web app with
+// the reason as the sso_error query parameter.
+func redirectSSOError(w http.ResponseWriter, r *http.Request, cfg *config.Config, reason string) {
+	target, err := url.Parse(cfg.OIDCPostLoginRedirect)
+	if err != nil {
+		target = &url.URL{Path: "/"}
+	}
+	query := target.Query()
+	query.Set("sso_error", reason)
+	target.RawQuery = query.Encode()
+	metrics.AuthFailureTotal.WithLabelValues("sso_" + reason).Inc()
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+// HandleOIDCLogin handles GET /api/auth/oidc/login - Start a single sign-on login.
+// @Summary     Log in with single sign-on
+// @Description Redirects the browser to the OpenID Connect identity provider (authorization code flow with PKCE).
+// @Description After authenticating there, the user returns through /auth/oidc/callback to redirect, a path of the
+// @Description web app, logged in with the usual session cookies.
+// @Tags        Authentication
+// @Param       redirect query string false "Web app path to land on after logging in"
+// @Success     302  "Redirect to the identity provider"
+// @Failure     503  {object}  map[string]interface{}  "Single sign-on is not configured or the provider is unavailable"
+// @Router      /auth/oidc/login [get]
+func (h *Handler) HandleOIDCLogin(w http.ResponseWriter, r *http.Request, cfg *config.Config) {
+	if h.OIDC == nil || !h.OIDC.Enabled() {
+		errors.WriteServiceUnavailable(w, "Single sign-on is not configured", nil, false)
+		return
+	}
+
+	redirect := ssoRedirectPath(r.URL.Query().Get("redirect"), "")
+	authURL, state, err := h.OIDC.BeginLogin(r.Context(), redirect)
+	if err != nil {
+		logger.Log.Error("Failed to start single sign-on", zap.Error(err))
+		errors.WriteServiceUnavailable(w, "Identity provider is unavailable", err, false)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/api/auth/oidc",
+		MaxAge:   int(oidc.LoginStateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   r.Header.Get("X-Forwarded-Proto") == "https" || r.TLS != nil,
+		SameSite: http.SameSiteLaxMode, // Sent on the provider's top-level redirect back
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// HandleOIDCCallback handles GET /api/auth/oidc/callback - Complete a single sign-on login.
+// @Summary     Single sign-on callback
+// @Description The identity provider redirects here after authenticating the user. The user is created at their first
+// @Description login, their role, approval and beta access follow the provider's groups as configured, and the browser
+// @Description is redirected to the web app with the refresh_token and csrf_token cookies set; the web app gets an
+// @Description access token from /auth/refresh. On failure, the web app gets an sso_error query parameter:
+// @Description provider, invalid, unavailable, disabled, locked, pending_approval or mfa_required (the user's role
+// @Description requires MFA and the ID token's amr/acr doesn't show the provider checked a second factor).
+// @Tags        Authentication
+// @Param       code  query string true "Authorization code"
+// @Param       state query string true "Login state"
+// @Success     302  "Redirect to the web app"
+// @Router      /auth/oidc/callback [get]
+func (h *Handler) HandleOIDCCallback(w http.ResponseWriter, r *http.Request, cfg *config.Config) {
+	if h.OIDC == nil || !h.OIDC.Enabled() {
+		errors.WriteServiceUnavailable(w, "Single sign-on is not configured", nil, false)
+		return
+	}
+	// The state is single-use: clear it whatever happens
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/api/auth/oidc", MaxAge: -1, HttpOnly: true})
+
+	query := r.URL.Query()
+	if providerErr := query.Get("error"); providerErr != "" {
+		logger.Log.Warn("Identity provider refused single sign-on", zap.String("error", providerErr),
+			zap.String("description", query.Get("error_description")))
+		redirectSSOError(w, r, cfg, "provider")
+		return
+	}
+	var storedState string
+	if cookie, err := r.Cookie(oidcStateCookie); err == nil {
+		storedState = cookie.Value
+	}
+
+	identity, redirect, err := h.OIDC.FinishLogin(r.Context(), storedState, query.Get("state"), query.Get("code"))
+	if err != nil {
+		if stderrors.Is(err, oidc.ErrInvalidState) || stderrors.Is(err, oidc.ErrInvalidToken) {
+			logger.Log.Warn("Single sign-on rejected", zap.Error(err))
+			redirectSSOError(w, r, cfg, "invalid")
+		} else {
+			logger.Log.Error("Failed to complete single sign-on", zap.Error(err))
+			redirectSSOError(w, r, cfg, "unavailable")
+		}
+		return
+	}
+
+	user, created, err := h.OIDC.Provision(identity)
+	if err != nil {
+		if stderrors.Is(err, oidc.ErrUserDisabled) {
+			logger.Log.Warn("Single sign-on of a deleted user", zap.String("subject", identity.Subject))
+			redirectSSOError(w, r, cfg, "disabled")
+		} else {
+			logger.Log.Error("Failed to provision single sign-on user", zap.String("subject", identity.Subject), zap.Error(err))
+			redirectSSOError(w, r, cfg, "unavailable")
+		}
+		return
+	}
+	if created {
+		logger.Log.Info("User provisioned by single sign-on", zap.Uint("user_id", user.ID), zap.String("username", user.Username),
+			zap.String("role", string(user.Role)), zap.Bool("approved", user.Approved))
+	}
+	audit.LogSSOLogin(r.Context(), user.ID, user.Username, string(user.Role), identity.Issuer, created)
+
+	// Locked accounts stay locked; the provider authenticated the user, so this isn't
+	// a failed attempt
+	if decision := h.LoginGuard.Check(user.ID, user.Username, h.clientIP(r)); !decision.Allowed() {
+		redirectSSOError(w, r, cfg, "locked")
+		return
+	}
+	if !user.Approved && !h.Roles.HasPermission(string(user.Role), models.PermManageSystem) {
+		redirectSSOError(w, r, cfg, "pending_approval")
+		return
+	}
+	// Single sign-on doesn't go through LIMEN's MFA challenge: roles requiring MFA need
+	// the provider to have checked a second factor
+	if _, required, err := h.MFA.LoginMethods(user.ID, string(user.Role)); err != nil {
+		logger.Log.Error("Failed to check MFA requirement", zap.Uint("user_id", user.ID), zap.Error(err))
+		redirectSSOError(w, r, cfg, "unavailable")
+		return
+	} else if required && !identity.MFA {
+		logger.Log.Warn("Single sign-on without MFA for a role requiring it", zap.Uint("user_id", user.ID),
+			zap.String("role", string(user.Role)))
+		redirectSSOError(w, r, cfg, "mfa_required")
+		return
+	}
+
+	if _, ok := h.startSession(w, r, cfg, user); !ok {
+		return
+	}
+	http.Redirect(w, r, ssoRedirectPath(redirect, cfg.OIDCPostLoginRedirect), http.StatusFound)
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/DARC0625/LIMEN/backend/internal/auth"
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"github.com/DARC0625/LIMEN/backend/internal/oidc"
+	"github.com/DARC0625/LIMEN/backend/internal/oidc/oidctest"
+)
+
+func TestHandleOIDC_Login(t *testing.T) {
+	h := setupTestImageHandler(t)
+	if err := h.DB.AutoMigrate(&models.LoginFailure{}, &models.AuthSession{}, &models.AuthRefreshToken{}); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+	auth.SetSessionStore(auth.NewDBSessionStore(h.DB))
+	t.Cleanup(func() { auth.SetSessionStore(auth.NewSessionStore()) })
+	h.Config.JWTSecret = "test-secret"
+	h.Config.OIDCPostLoginRedirect = "/"
+	idp := oidctest.NewProvider(t, "limen")
+	h.OIDC = oidc.NewClient(h.DB, oidc.Config{
+		Issuer:      idp.Issuer(),
+		ClientID:    "limen",
+		RedirectURL: "https://limen.example/api/auth/oidc/callback",
+		Mapping:     auth.GroupMapping{ApprovedGroups: []string{"staff"}},
+		MFAValues:   []string{"mfa"},
+	}, "test-secret")
+
+	// login runs the browser through a single sign-on and returns the callback's response
+	login := func(redirect string, claims map[string]interface{}) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.HandleOIDCLogin(w, httptest.NewRequest("GET", "/api/auth/oidc/login?redirect="+url.QueryEscape(redirect), nil), h.Config)
+		if w.Code != http.StatusFound {
+			t.Fatalf("login = %d: %s", w.Code, w.Body.String())
+		}
+		state := w.Result().Cookies()[0]
+		callback, err := idp.Authorize(w.Header().Get("Location"), claims)
+		if err != nil {
+			t.Fatalf("Authorize() error = %v", err)
+		}
+		req := httptest.NewRequest("GET", "/api/auth/oidc/callback?"+callback.Encode(), nil)
+		req.AddCookie(state)
+		w = httptest.NewRecorder()
+		h.HandleOIDCCallback(w, req, h.Config)
+		return w
+	}
+	cookie := func(w *httptest.ResponseRecorder, name string) string {
+		for _, c := range w.Result().Cookies() {
+			if c.Name == name {
+				return c.Value
+			}
+		}
+		return ""
+	}
+
+	// Users outside the approved groups are created pending approval
+	w := login("/vms", map[string]interface{}{"sub": "user-2", "preferred_username": "bob"})
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/?sso_error=pending_approval" || cookie(w, "refresh_token") != "" {
+		t.Errorf("unapproved login = %d to %q", w.Code, w.Header().Get("Location"))
+	}
+
+	w = login("/vms", map[string]interface{}{"sub": "user-1", "preferred_username": "alice", "groups": []interface{}{"staff"}})
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/vms" || cookie(w, "refresh_token") == "" || cookie(w, "csrf_token") == "" {
+		t.Fatalf("login = %d to %q, want a session and /vms", w.Code, w.Header().Get("Location"))
+	}
+	var user models.User
+	if err := h.DB.Where("username = ?", "alice").First(&user).Error; err != nil || !user.Approved {
+		t.Errorf("provisioned user = %+v, %v", user, err)
+	}
+
+	// Roles requiring MFA need the provider to have checked a second factor
+	if _, err := h.MFA.SetRoleRequired("user", true); err != nil {
+		t.Fatalf("SetRoleRequired() error = %v", err)
+	}
+	w = login("/vms", map[string]interface{}{"sub": "user-1", "groups": []interface{}{"staff"}, "amr": []interface{}{"pwd"}})
+	if w.Header().Get("Location") != "/?sso_error=mfa_required" || cookie(w, "refresh_token") != "" {
+		t.Errorf("login without MFA went to %q, want sso_error=mfa_required", w.Header().Get("Location"))
+	}
+	w = login("/vms", map[string]interface{}{"sub": "user-1", "groups": []interface{}{"staff"}, "amr": []interface{}{"pwd", "mfa"}})
+	if w.Header().Get("Location") != "/vms" || cookie(w, "refresh_token") == "" {
+		t.Errorf("login with MFA went to %q, want /vms", w.Header().Get("Location"))
+	}
+	h.MFA.SetRoleRequired("user", false)
+
+	// Logins only land on paths of the web app
+	if w := login("https://evil.example", map[string]interface{}{"sub": "user-1", "groups": []interface{}{"staff"}}); w.Header().Get("Location") != "/" {
+		t.Errorf("login with an external redirect went to %q, want /", w.Header().Get("Location"))
+	}
+
+	// A callback without the browser's state is rejected
+	w = httptest.NewRecorder()
+	h.HandleOIDCCallback(w, httptest.NewRequest("GET", "/api/auth/oidc/callback?code=x&state=y", nil), h.Config)
+	if w.Header().Get("Location") != "/?sso_error=invalid" {
+		t.Errorf("callback without state went to %q, want sso_error=invalid", w.Header().Get("Location"))
+	}
+}
+
+func TestHandleOIDC_NotConfigured(t *testing.T) {
+	h := setupTestImageHandler(t)
+	w := httptest.NewRecorder()
+	h.HandleOIDCLogin(w, httptest.NewRequest("GET", "/api/auth/oidc/login", nil), h.Config)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("login without an issuer = %d, want 503", w.Code)
+	}
+}
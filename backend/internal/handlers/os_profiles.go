@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/DARC0625/LIMEN/backend/internal/errors"
+	"github.com/DARC0625/LIMEN/backend/internal/osprofile"
+)
+
+// osProfiles returns the handler's OS profile registry, falling back to the built-in profiles.
+func (h *Handler) osProfiles() *osprofile.Registry {
+	if h.OSProfiles == nil {
+		return osprofile.Default()
+	}
+	return h.OSProfiles
+}
+
+// HandleListOSProfiles lists the OS types a VM can be created with and their defaults.
+// @Summary List OS profiles
+// @Tags vms
+// @Produce json
+// @Success 200 {array} osprofile.Profile
+// @Security BearerAuth
+// @Router /os-profiles [get]
+func (h *Handler) HandleListOSProfiles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		errors.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.osProfiles().List())
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"github.com/DARC0625/LIMEN/backend/internal/osprofile"
+)
+
+func TestHandleListOSProfiles(t *testing.T) {
+	h := setupTestImageHandler(t)
+
+	rr := httptest.NewRecorder()
+	h.HandleListOSProfiles(rr, imageRequest("GET", "/api/os-profiles", nil, 1, "user", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var profiles []osprofile.Profile
+	if err := json.Unmarshal(rr.Body.Bytes(), &profiles); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(profiles) != len(osprofile.DefaultProfiles()) || profiles[0].ID != "kali" {
+		t.Errorf("Unexpected profiles: %+v", profiles)
+	}
+	for _, p := range profiles {
+		if p.ID == "ubuntu-desktop" && (!p.GUI || !p.Unattended) {
+			t.Errorf("Expected ubuntu-desktop to be a GUI OS with unattended install, got %+v", p)
+		}
+	}
+
+	rr = httptest.NewRecorder()
+	h.HandleListOSProfiles(rr, imageRequest("POST", "/api/os-profiles", nil, 1, "user", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405, got %d", rr.Code)
+	}
+}
+
+func TestHandleVMs_UnknownOSType(t *testing.T) {
+	h := setupTestImageHandler(t)
+
+	body := []byte(`{"name":"vm1","cpu":2,"memory":2048,"os_type":"plan9"}`)
+	rr := httptest.NewRecorder()
+	h.HandleVMs(rr, imageRequest("POST", "/api/vms", body, 1, "admin", nil), h.Config)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if !strings.Contains(rr.Body.String(), "ubuntu-server") {
+		t.Errorf("Expected valid OS types in error, got %s", rr.Body.String())
+	}
+}
+
+func TestHandleResetVMNVRAM(t *testing.T) {
+	h := setupTestImageHandler(t)
+
+	bios := models.VM{Name: "bios-vm", CPU: 2, Memory: 2048, OwnerID: 1, Firmware: "bios"}
+	uefi := models.VM{Name: "uefi-vm", CPU: 2, Memory: 2048, OwnerID: 1, Firmware: "uefi"}
+	h.DB.Create(&bios)
+	h.DB.Create(&uefi)
+
+	tests := []struct {
+		name   string
+		vm     models.VM
+		userID uint
+		role   string
+		want   int
+	}{
+		{"other user", uefi, 2, "user", http.StatusForbidden},
+		{"bios firmware", bios, 1, "user", http.StatusBadRequest},
+		{"no vm service", uefi, 2, "admin", http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			req := imageRequest("POST", "/api/vms/"+tt.vm.UUID+"/nvram/reset", nil, tt.userID, tt.role, map[string]string{"uuid": tt.vm.UUID})
+			h.HandleResetVMNVRAM(rr, req)
+			if rr.Code != tt.want {
+				t.Errorf("Expected %d, got %d: %s", tt.want, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandleVMs_CPUPlacementPolicy(t *testing.T) {
+	h := setupTestImageHandler(t)
+
+	pinned := []byte(`{"name":"vm1","cpu":2,"memory":2048,"os_type":"ubuntu-server","cpu_pinning":[{"vcpu":0,"cpuset":"0"}]}`)
+	rr := httptest.NewRecorder()
+	h.HandleVMs(rr, imageRequest("POST", "/api/vms", pinned, 2, "user", nil), h.Config)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for user pinning under admin policy, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	h.Config.CPUPlacementPolicy = "none"
+	rr = httptest.NewRecorder()
+	h.HandleVMs(rr, imageRequest("POST", "/api/vms", pinned, 1, "admin", nil), h.Config)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for admin pinning under none policy, got %d", rr.Code)
+	}
+
+	badTopology := []byte(`{"name":"vm1","cpu":4,"memory":2048,"os_type":"ubuntu-server","sockets":1,"cores":3}`)
+	rr = httptest.NewRecorder()
+	h.HandleVMs(rr, imageRequest("POST", "/api/vms", badTopology, 1, "admin", nil), h.Config)
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "topology") {
+		t.Errorf("Expected 400 topology error, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
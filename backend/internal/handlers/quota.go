@@ -73,7 +73,7 @@ func (h *Handler) HandleGetQuota(w http.ResponseWriter, r *http.Request, cfg *co
 		}
 
 		var authErr error
-		userID, _, ok, authErr = auth.ResolveUserFromRefreshToken(refreshToken, cfg.JWTSecret)
+		userID, _, ok, authErr = auth.KeysFor(cfg).ResolveUserFromRefreshToken(refreshToken)
 		if !ok {
 			// Security: Log authentication failures with reason for monitoring
 			logger.Log.Debug("Quota endpoint authentication failed",
@@ -139,8 +139,7 @@ func (h *Handler) HandleUpdateQuota(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if user is admin using role from context
-	role, ok := middleware.GetRole(r.Context())
-	if !ok || role != string(models.RoleAdmin) {
+	if !middleware.IsAdmin(r.Context()) {
 		// Fallback: check if userID is 1 (for backward compatibility)
 		if userID != 1 {
 			errors.WriteForbidden(w, "Only admin can update system quota")
@@ -0,0 +1,348 @@
+package handlers
+
+import (
+	"context"
+	"crypto/des"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/bits"
+	"net"
+	"os"
+	"time"
+
+	"github.com/DARC0625/LIMEN/backend/internal/config"
+	"github.com/DARC0625/LIMEN/backend/internal/recording"
+	"nhooyr.io/websocket"
+)
+
+// The VNC proxy terminates RFB authentication on both sides:
+//   - towards QEMU it authenticates with the VM's VNC password, which is rotated on every
+//     VM start and never leaves the backend, optionally inside VeNCrypt (TLS);
+//   - towards the browser it offers security type None, since the client was already
+//     authenticated by its console ticket.
+//
+// After both handshakes the client's ClientInit is the first byte forwarded to QEMU.
+
+const (
+	rfbSecurityVeNCrypt = 19
+
+	// VeNCrypt subtypes with certificate-verified TLS
+	vencryptX509None = 260
+	vencryptX509VNC  = 261
+
+	rfbHandshakeTimeout = 15 * time.Second
+	rfbMaxReasonLength  = 4096
+)
+
+// parseRFBVersion returns the minor version of an RFB 3.x ProtocolVersion message.
+// Versions past 3.8 (e.g. Apple's 3.889) speak 3.8.
+func parseRFBVersion(p []byte) (int, error) {
+	var major, minor int
+	if _, err := fmt.Sscanf(string(p), "RFB %03d.%03d\n", &major, &minor); err != nil || major != 3 {
+		return 0, fmt.Errorf("invalid RFB version %q", p)
+	}
+	if minor < 7 {
+		return 0, fmt.Errorf("unsupported RFB version %q", p)
+	}
+	if minor > 8 {
+		minor = 8
+	}
+	return minor, nil
+}
+
+// vncAuthResponse answers a VNC Authentication challenge: the challenge DES-encrypted
+// with the password, truncated or zero-padded to 8 bytes and with each byte bit-reversed.
+func vncAuthResponse(challenge []byte, password string) ([]byte, error) {
+	key := make([]byte, 8)
+	copy(key, password)
+	for i, b := range key {
+		key[i] = bits.Reverse8(b)
+	}
+	block, err := des.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	response := make([]byte, 16)
+	block.Encrypt(response[:8], challenge[:8])
+	block.Encrypt(response[8:], challenge[8:])
+	return response, nil
+}
+
+// rfbReadReason reads a length-prefixed failure reason.
+func rfbReadReason(r io.Reader) string {
+	var length uint32
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil || length > rfbMaxReasonLength {
+		return ""
+	}
+	reason := make([]byte, length)
+	if _, err := io.ReadFull(r, reason); err != nil {
+		return ""
+	}
+	return string(reason)
+}
+
+// rfbReadSecurityResult reads a SecurityResult message; RFB 3.8 servers explain failures.
+func rfbReadSecurityResult(r io.Reader, minor int) error {
+	var result uint32
+	if err := binary.Read(r, binary.BigEndian, &result); err != nil {
+		return fmt.Errorf("failed to read VNC security result: %w", err)
+	}
+	if result == 0 {
+		return nil
+	}
+	if minor >= 8 {
+		if reason := rfbReadReason(r); reason != "" {
+			return fmt.Errorf("VNC authentication failed: %s", reason)
+		}
+	}
+	return fmt.Errorf("VNC authentication failed")
+}
+
+// rfbVNCAuth answers the VNC server's VNC Authentication challenge.
+func rfbVNCAuth(rw io.ReadWriter, password string) error {
+	challenge := make([]byte, 16)
+	if _, err := io.ReadFull(rw, challenge); err != nil {
+		return fmt.Errorf("failed to read VNC challenge: %w", err)
+	}
+	response, err := vncAuthResponse(challenge, password)
+	if err != nil {
+		return err
+	}
+	_, err = rw.Write(response)
+	return err
+}
+
+// rfbAuthenticate performs the client half of the RFB handshake with a VM's VNC server,
+// up to and including the SecurityResult. With tlsConfig, VeNCrypt is used when the
+// server offers it, and the returned connection is the TLS connection to use from then on.
+// With requireTLS, servers that don't offer VeNCrypt are refused.
+func rfbAuthenticate(conn net.Conn, password string, tlsConfig *tls.Config, requireTLS bool) (net.Conn, error) {
+	conn.SetDeadline(time.Now().Add(rfbHandshakeTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	version := make([]byte, 12)
+	if _, err := io.ReadFull(conn, version); err != nil {
+		return nil, fmt.Errorf("failed to read VNC server version: %w", err)
+	}
+	minor, err := parseRFBVersion(version)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fmt.Fprintf(conn, "RFB 003.%03d\n", minor); err != nil {
+		return nil, err
+	}
+
+	var count [1]byte
+	if _, err := io.ReadFull(conn, count[:]); err != nil {
+		return nil, fmt.Errorf("failed to read VNC security types: %w", err)
+	}
+	if count[0] == 0 {
+		return nil, fmt.Errorf("VNC server refused the connection: %s", rfbReadReason(conn))
+	}
+	types := make([]byte, count[0])
+	if _, err := io.ReadFull(conn, types); err != nil {
+		return nil, fmt.Errorf("failed to read VNC security types: %w", err)
+	}
+	offered := make(map[byte]bool, len(types))
+	for _, t := range types {
+		offered[t] = true
+	}
+
+	choose := func(securityType byte) error {
+		_, err := conn.Write([]byte{securityType})
+		return err
+	}
+	switch {
+	case tlsConfig != nil && offered[rfbSecurityVeNCrypt]:
+		if err := choose(rfbSecurityVeNCrypt); err != nil {
+			return nil, err
+		}
+		return rfbVeNCrypt(conn, password, tlsConfig)
+	case requireTLS:
+		return nil, fmt.Errorf("VNC server is reached over the network but doesn't offer TLS: %v", types)
+	case password != "" && offered[rfbSecurityVNCAuth]:
+		if err := choose(rfbSecurityVNCAuth); err != nil {
+			return nil, err
+		}
+		if err := rfbVNCAuth(conn, password); err != nil {
+			return nil, err
+		}
+	case offered[rfbSecurityNone]:
+		if err := choose(rfbSecurityNone); err != nil {
+			return nil, err
+		}
+		if minor < 8 {
+			// RFB 3.7 sends no SecurityResult for None
+			return conn, nil
+		}
+	case offered[rfbSecurityVeNCrypt]:
+		return nil, fmt.Errorf("VNC server requires TLS, but VNC_TLS_CA_CERT is not configured")
+	default:
+		return nil, fmt.Errorf("VNC server offers no supported security type: %v", types)
+	}
+	if err := rfbReadSecurityResult(conn, minor); err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// rfbVeNCrypt negotiates VeNCrypt 0.2 after the security type was chosen: it picks
+// X509VNC when there is a password (X509None otherwise), upgrades conn to TLS and
+// completes authentication over it.
+func rfbVeNCrypt(conn net.Conn, password string, tlsConfig *tls.Config) (net.Conn, error) {
+	var version [2]byte
+	if _, err := io.ReadFull(conn, version[:]); err != nil {
+		return nil, fmt.Errorf("failed to read VeNCrypt version: %w", err)
+	}
+	if version[0] != 0 || version[1] < 2 {
+		return nil, fmt.Errorf("unsupported VeNCrypt version %d.%d", version[0], version[1])
+	}
+	if _, err := conn.Write([]byte{0, 2}); err != nil {
+		return nil, err
+	}
+	var ack [2]byte // version ack, subtype count
+	if _, err := io.ReadFull(conn, ack[:]); err != nil {
+		return nil, fmt.Errorf("failed to read VeNCrypt subtypes: %w", err)
+	}
+	if ack[0] != 0 {
+		return nil, fmt.Errorf("VNC server rejected VeNCrypt version 0.2")
+	}
+	subtypes := make([]uint32, ack[1])
+	if err := binary.Read(conn, binary.BigEndian, subtypes); err != nil {
+		return nil, fmt.Errorf("failed to read VeNCrypt subtypes: %w", err)
+	}
+
+	var subtype uint32
+	for _, t := range subtypes {
+		switch {
+		case t == vencryptX509VNC && password != "":
+			subtype = t
+		case t == vencryptX509None && subtype == 0:
+			subtype = t
+		}
+	}
+	if subtype == 0 {
+		return nil, fmt.Errorf("VNC server offers no supported VeNCrypt subtype: %v", subtypes)
+	}
+	if err := binary.Write(conn, binary.BigEndian, subtype); err != nil {
+		return nil, err
+	}
+	var accepted [1]byte
+	if _, err := io.ReadFull(conn, accepted[:]); err != nil {
+		return nil, fmt.Errorf("failed to read VeNCrypt subtype ack: %w", err)
+	}
+	if accepted[0] != 1 {
+		return nil, fmt.Errorf("VNC server rejected VeNCrypt subtype %d", subtype)
+	}
+
+	tlsConn := tls.Client(conn, tlsConfig)
+	if err := tlsConn.Handshake(); err != nil {
+		return nil, fmt.Errorf("VNC TLS handshake failed: %w", err)
+	}
+	if subtype == vencryptX509VNC {
+		if err := rfbVNCAuth(tlsConn, password); err != nil {
+			return nil, err
+		}
+	}
+	if err := rfbReadSecurityResult(tlsConn, 8); err != nil {
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// wsByteReader reads a byte stream from the binary messages of a WebSocket, recording
+// what it reads as console input.
+type wsByteReader struct {
+	ws  *websocket.Conn
+	rec *recording.Recorder
+	buf []byte
+}
+
+// next returns the next n bytes.
+func (r *wsByteReader) next(ctx context.Context, n int) ([]byte, error) {
+	for len(r.buf) < n {
+		typ, message, err := r.ws.Read(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if typ != websocket.MessageBinary {
+			continue
+		}
+		r.rec.Record(recording.Input, message)
+		r.buf = append(r.buf, message...)
+	}
+	p := r.buf[:n]
+	r.buf = r.buf[n:]
+	return p, nil
+}
+
+// rfbServeClient performs the server half of the RFB handshake with a console client,
+// offering only security type None. It returns client bytes read past the handshake,
+// which the caller must forward to the VNC server.
+func rfbServeClient(ctx context.Context, ws *websocket.Conn, rec *recording.Recorder) ([]byte, error) {
+	send := func(p []byte) error {
+		rec.Record(recording.Output, p)
+		return ws.Write(ctx, websocket.MessageBinary, p)
+	}
+	in := &wsByteReader{ws: ws, rec: rec}
+
+	if err := send([]byte("RFB 003.008\n")); err != nil {
+		return nil, err
+	}
+	version, err := in.next(ctx, 12)
+	if err != nil {
+		return nil, err
+	}
+	minor, err := parseRFBVersion(version)
+	if err != nil {
+		return nil, err
+	}
+	if err := send([]byte{1, rfbSecurityNone}); err != nil {
+		return nil, err
+	}
+	choice, err := in.next(ctx, 1)
+	if err != nil {
+		return nil, err
+	}
+	if choice[0] != rfbSecurityNone {
+		return nil, fmt.Errorf("client chose unoffered security type %d", choice[0])
+	}
+	if minor >= 8 {
+		if err := send([]byte{0, 0, 0, 0}); err != nil {
+			return nil, err
+		}
+	}
+	return in.buf, nil
+}
+
+// vncTLSConfig returns the TLS configuration for VeNCrypt connections to QEMU, or nil
+// when VNC TLS is not configured.
+func vncTLSConfig(cfg *config.Config) (*tls.Config, error) {
+	if cfg.VNCTLSCACert == "" {
+		return nil, nil
+	}
+	caPEM, err := os.ReadFile(cfg.VNCTLSCACert)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read VNC TLS CA certificate: %w", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no certificates found in %s", cfg.VNCTLSCACert)
+	}
+	tlsConfig := &tls.Config{
+		RootCAs:    roots,
+		ServerName: cfg.VNCTLSServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+	if cfg.VNCTLSClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.VNCTLSClientCert, cfg.VNCTLSClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load VNC TLS client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"nhooyr.io/websocket"
+)
+
+// fakeVNCServer plays QEMU's side of the RFB handshake on conn, offering securityTypes
+// and accepting only password. With serverTLS, VeNCrypt X509VNC is used.
+func fakeVNCServer(t *testing.T, conn net.Conn, securityTypes []byte, password string, serverTLS *tls.Config) {
+	t.Helper()
+	defer conn.Close()
+	io.WriteString(conn, "RFB 003.008\n")
+	version := make([]byte, 12)
+	io.ReadFull(conn, version)
+	conn.Write(append([]byte{byte(len(securityTypes))}, securityTypes...))
+	choice := make([]byte, 1)
+	if _, err := io.ReadFull(conn, choice); err != nil {
+		return
+	}
+
+	var rw io.ReadWriter = conn
+	if choice[0] == rfbSecurityVeNCrypt {
+		conn.Write([]byte{0, 2})
+		io.ReadFull(conn, make([]byte, 2))
+		conn.Write([]byte{0, 2})
+		binary.Write(conn, binary.BigEndian, []uint32{vencryptX509None, vencryptX509VNC})
+		var subtype uint32
+		binary.Read(conn, binary.BigEndian, &subtype)
+		if subtype != vencryptX509VNC {
+			t.Errorf("VeNCrypt subtype = %d, want X509VNC", subtype)
+			return
+		}
+		conn.Write([]byte{1})
+		tlsConn := tls.Server(conn, serverTLS)
+		if err := tlsConn.Handshake(); err != nil {
+			t.Errorf("server TLS handshake: %v", err)
+			return
+		}
+		rw = tlsConn
+	}
+
+	challenge := bytes.Repeat([]byte{0x5a}, 16)
+	rw.Write(challenge)
+	response := make([]byte, 16)
+	io.ReadFull(rw, response)
+	want, _ := vncAuthResponse(challenge, password)
+	if bytes.Equal(response, want) {
+		rw.Write([]byte{0, 0, 0, 0})
+		return
+	}
+	reason := "Authentication failed"
+	binary.Write(rw, binary.BigEndian, []uint32{1, uint32(len(reason))})
+	io.WriteString(rw, reason)
+}
+
+func TestRFBAuthenticate_VNCAuth(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		wantErr  string
+	}{
+		{"correct password", "s3cret12", ""},
+		{"wrong password", "wrong", "Authentication failed"},
+	}
+	for _, tt := range tests {
+		client, server := net.Pipe()
+		go fakeVNCServer(t, server, []byte{rfbSecurityVNCAuth}, "s3cret12", nil)
+		_, err := rfbAuthenticate(client, tt.password, nil, false)
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("%s: rfbAuthenticate() error = %v", tt.name, err)
+		}
+		if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("%s: rfbAuthenticate() error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+		client.Close()
+	}
+}
+
+func TestRFBAuthenticate_RequiresTLSConfig(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	go fakeVNCServer(t, server, []byte{rfbSecurityVeNCrypt}, "s3cret12", nil)
+	if _, err := rfbAuthenticate(client, "s3cret12", nil, false); err == nil || !strings.Contains(err.Error(), "requires TLS") {
+		t.Errorf("rfbAuthenticate() error = %v, want TLS required", err)
+	}
+}
+
+func TestRFBAuthenticate_RequireTLS(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	go fakeVNCServer(t, server, []byte{rfbSecurityVNCAuth}, "s3cret12", nil)
+	if _, err := rfbAuthenticate(client, "s3cret12", &tls.Config{}, true); err == nil || !strings.Contains(err.Error(), "doesn't offer TLS") {
+		t.Errorf("rfbAuthenticate() error = %v, want TLS required", err)
+	}
+}
+
+func TestRFBAuthenticate_VeNCrypt(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate() error = %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	serverTLS := &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	clientTLS := &tls.Config{RootCAs: roots, ServerName: "localhost"}
+
+	client, server := net.Pipe()
+	defer client.Close()
+	go fakeVNCServer(t, server, []byte{rfbSecurityVNCAuth, rfbSecurityVeNCrypt}, "s3cret12", serverTLS)
+	conn, err := rfbAuthenticate(client, "s3cret12", clientTLS, true)
+	if err != nil {
+		t.Fatalf("rfbAuthenticate() error = %v", err)
+	}
+	if _, ok := conn.(*tls.Conn); !ok {
+		t.Errorf("rfbAuthenticate() returned %T, want *tls.Conn", conn)
+	}
+}
+
+func TestRFBServeClient(t *testing.T) {
+	pending := make(chan []byte, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close(websocket.StatusNormalClosure, "")
+		rest, err := rfbServeClient(r.Context(), ws, nil)
+		if err != nil {
+			t.Errorf("rfbServeClient() error = %v", err)
+		}
+		pending <- rest
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ws, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer ws.Close(websocket.StatusNormalClosure, "")
+
+	expect := func(want []byte) {
+		t.Helper()
+		_, got, err := ws.Read(ctx)
+		if err != nil || !bytes.Equal(got, want) {
+			t.Fatalf("read %q (%v), want %q", got, err, want)
+		}
+	}
+	expect([]byte("RFB 003.008\n"))
+	ws.Write(ctx, websocket.MessageBinary, []byte("RFB 003.008\n"))
+	expect([]byte{1, rfbSecurityNone})
+	// Security type and ClientInit packed into one message
+	ws.Write(ctx, websocket.MessageBinary, []byte{rfbSecurityNone, 1})
+	expect([]byte{0, 0, 0, 0})
+
+	if rest := <-pending; !bytes.Equal(rest, []byte{1}) {
+		t.Errorf("pending client bytes = %v, want ClientInit [1]", rest)
+	}
+}
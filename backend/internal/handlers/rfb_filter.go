@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// rfbClientFilter rewrites the client-to-server half of an RFB (VNC) stream for
+// participants of a shared console session.
+//
+// Every participant's ClientInit is forced to request a shared desktop, so joining
+// never disconnects the owner. With viewOnly, input is stripped as well: the handshake
+// and display-related messages (pixel format, encodings, update requests, fences) pass
+// through; key, pointer, clipboard, resize and power (XVP) messages are dropped.
+// Messages may arrive split across or packed into WebSocket frames, so incomplete
+// messages are buffered.
+//
+// Only RFB 3.7/3.8 with security type None or VNC Authentication can be followed;
+// anything else is an error, and the caller must drop the connection. The VNC proxy
+// completes the handshake itself (see rfbServeClient) and starts filters at ClientInit.
+type rfbClientFilter struct {
+	viewOnly bool
+	state    rfbFilterState
+	buf      []byte
+}
+
+type rfbFilterState int
+
+const (
+	rfbStateVersion rfbFilterState = iota
+	rfbStateSecurityType
+	rfbStateVNCAuth
+	rfbStateClientInit
+	rfbStateMessages
+)
+
+// RFB client-to-server message types (RFC 6143 section 7.5 and common extensions)
+const (
+	rfbSetPixelFormat           = 0
+	rfbSetEncodings             = 2
+	rfbFramebufferUpdateRequest = 3
+	rfbKeyEvent                 = 4
+	rfbPointerEvent             = 5
+	rfbClientCutText            = 6
+	rfbEnableContinuousUpdates  = 150
+	rfbClientFence              = 248
+	rfbXVP                      = 250
+	rfbSetDesktopSize           = 251
+	rfbQEMUClientMessage        = 255
+
+	rfbSecurityNone    = 1
+	rfbSecurityVNCAuth = 2
+
+	// Dropped clipboard messages are buffered until complete; larger ones end the connection
+	rfbMaxCutText = 1 << 20
+)
+
+// Filter consumes client bytes and returns the bytes to forward to the server.
+func (f *rfbClientFilter) Filter(p []byte) ([]byte, error) {
+	if f.state == rfbStateMessages && !f.viewOnly {
+		return p, nil
+	}
+	f.buf = append(f.buf, p...)
+	var out []byte
+	for {
+		n, forward, err := f.next()
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			break
+		}
+		if forward {
+			out = append(out, f.buf[:n]...)
+		}
+		f.buf = f.buf[n:]
+	}
+	// Don't keep the consumed prefix alive
+	f.buf = append([]byte(nil), f.buf...)
+	return out, nil
+}
+
+// next returns the length of the next complete unit in buf (0 if incomplete) and whether to forward it.
+func (f *rfbClientFilter) next() (int, bool, error) {
+	b := f.buf
+	switch f.state {
+	case rfbStateVersion:
+		if len(b) < 12 {
+			return 0, false, nil
+		}
+		switch string(b[:12]) {
+		case "RFB 003.007\n", "RFB 003.008\n":
+		default:
+			return 0, false, fmt.Errorf("unsupported RFB version %q for shared access", b[:11])
+		}
+		f.state = rfbStateSecurityType
+		return 12, true, nil
+
+	case rfbStateSecurityType:
+		if len(b) < 1 {
+			return 0, false, nil
+		}
+		switch b[0] {
+		case rfbSecurityNone:
+			f.state = rfbStateClientInit
+		case rfbSecurityVNCAuth:
+			f.state = rfbStateVNCAuth
+		default:
+			return 0, false, fmt.Errorf("unsupported RFB security type %d for shared access", b[0])
+		}
+		return 1, true, nil
+
+	case rfbStateVNCAuth:
+		if len(b) < 16 {
+			return 0, false, nil
+		}
+		f.state = rfbStateClientInit
+		return 16, true, nil
+
+	case rfbStateClientInit:
+		if len(b) < 1 {
+			return 0, false, nil
+		}
+		f.state = rfbStateMessages
+		// Always ask for a shared session so the owner isn't disconnected
+		b[0] = 1
+		return 1, true, nil
+	}
+
+	if len(b) < 1 {
+		return 0, false, nil
+	}
+	if !f.viewOnly {
+		return len(b), true, nil
+	}
+	need := func(n int) (int, bool, error) {
+		if len(b) < n {
+			return 0, false, nil
+		}
+		return n, true, nil
+	}
+	drop := func(n int) (int, bool, error) {
+		if len(b) < n {
+			return 0, false, nil
+		}
+		return n, false, nil
+	}
+
+	switch b[0] {
+	case rfbSetPixelFormat:
+		return need(20)
+	case rfbSetEncodings:
+		if len(b) < 4 {
+			return 0, false, nil
+		}
+		return need(4 + 4*int(binary.BigEndian.Uint16(b[2:4])))
+	case rfbFramebufferUpdateRequest:
+		return need(10)
+	case rfbEnableContinuousUpdates:
+		return need(10)
+	case rfbClientFence:
+		if len(b) < 9 {
+			return 0, false, nil
+		}
+		return need(9 + int(b[8]))
+	case rfbKeyEvent:
+		return drop(8)
+	case rfbPointerEvent:
+		return drop(6)
+	case rfbClientCutText:
+		if len(b) < 8 {
+			return 0, false, nil
+		}
+		// Negative lengths are the extended clipboard format
+		length := int32(binary.BigEndian.Uint32(b[4:8]))
+		if length < 0 {
+			length = -length
+		}
+		if length > rfbMaxCutText {
+			return 0, false, fmt.Errorf("clipboard message of %d bytes exceeds limit", length)
+		}
+		return drop(8 + int(length))
+	case rfbSetDesktopSize:
+		if len(b) < 8 {
+			return 0, false, nil
+		}
+		return drop(8 + 16*int(b[6]))
+	case rfbXVP:
+		return drop(4)
+	case rfbQEMUClientMessage:
+		if len(b) < 2 {
+			return 0, false, nil
+		}
+		switch b[1] {
+		case 0: // Extended key event
+			return drop(12)
+		case 1: // Audio
+			if len(b) < 4 {
+				return 0, false, nil
+			}
+			if binary.BigEndian.Uint16(b[2:4]) == 2 { // Set audio format
+				return need(10)
+			}
+			return need(4)
+		}
+		return 0, false, fmt.Errorf("unsupported QEMU client message %d", b[1])
+	}
+	return 0, false, fmt.Errorf("unsupported RFB client message type %d", b[0])
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"bytes"
+	"testing"
+)
+
+// rfbClientStream is a client-to-server RFB 3.8 stream: handshake (security None,
+// exclusive ClientInit) followed by display and input messages.
+func rfbClientStream() (stream, display []byte) {
+	handshake := append([]byte("RFB 003.008\n"), 1, 0)
+	setEncodings := []byte{2, 0, 0, 2, 0, 0, 0, 0, 0, 0, 0, 1}
+	updateRequest := []byte{3, 1, 0, 0, 0, 0, 0, 64, 0, 48}
+	keyEvent := []byte{4, 1, 0, 0, 0, 0, 0, 0x61}
+	pointerEvent := []byte{5, 1, 0, 10, 0, 20}
+	cutText := []byte{6, 0, 0, 0, 0, 0, 0, 3, 'a', 'b', 'c'}
+	qemuKey := []byte{255, 0, 0, 1, 0, 0, 0, 0x61, 0, 0, 0, 0x1e}
+
+	stream = bytes.Join([][]byte{handshake, setEncodings, keyEvent, updateRequest, pointerEvent, cutText, qemuKey}, nil)
+	// The forwarded handshake always asks for a shared desktop
+	display = bytes.Join([][]byte{append([]byte("RFB 003.008\n"), 1, 1), setEncodings, updateRequest}, nil)
+	return stream, display
+}
+
+func TestRFBClientFilter_ViewOnly(t *testing.T) {
+	stream, want := rfbClientStream()
+
+	// Byte-at-a-time delivery exercises buffering of split messages
+	for _, chunk := range []int{len(stream), 1, 5} {
+		f := &rfbClientFilter{viewOnly: true}
+		var got []byte
+		for i := 0; i < len(stream); i += chunk {
+			end := i + chunk
+			if end > len(stream) {
+				end = len(stream)
+			}
+			out, err := f.Filter(append([]byte(nil), stream[i:end]...))
+			if err != nil {
+				t.Fatalf("chunk %d: Filter() error = %v", chunk, err)
+			}
+			got = append(got, out...)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("chunk %d: forwarded %v, want %v", chunk, got, want)
+		}
+	}
+}
+
+func TestRFBClientFilter_Interactive(t *testing.T) {
+	stream, _ := rfbClientStream()
+	f := &rfbClientFilter{}
+	got, err := f.Filter(append([]byte(nil), stream...))
+	if err != nil {
+		t.Fatalf("Filter() error = %v", err)
+	}
+	want := append([]byte(nil), stream...)
+	want[13] = 1 // shared flag
+	if !bytes.Equal(got, want) {
+		t.Errorf("forwarded %v, want %v", got, want)
+	}
+}
+
+func TestRFBClientFilter_Unsupported(t *testing.T) {
+	tests := map[string][]byte{
+		"rfb 3.3":        []byte("RFB 003.003\n"),
+		"security type":  append([]byte("RFB 003.008\n"), 19),
+		"unknown msg":    append([]byte("RFB 003.008\n"), 1, 1, 99),
+		"huge clipboard": append([]byte("RFB 003.008\n"), 1, 1, 6, 0, 0, 0, 0x7f, 0, 0, 0),
+	}
+	for name, stream := range tests {
+		f := &rfbClientFilter{viewOnly: true}
+		if _, err := f.Filter(stream); err == nil {
+			t.Errorf("%s: Filter() accepted unsupported stream", name)
+		}
+	}
+}
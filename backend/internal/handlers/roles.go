@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"encoding/json"
+	stderrors "errors"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/DARC0625/LIMEN/backend/internal/audit"
+	"github.com/DARC0625/LIMEN/backend/internal/auth"
+	"github.com/DARC0625/LIMEN/backend/internal/errors"
+	"github.com/DARC0625/LIMEN/backend/internal/logger"
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// RoleRequest creates or updates a custom role.
+type RoleRequest struct {
+	Name        string   `json:"name,omitempty"`        // Create only, e.g. "support"
+	Description string   `json:"description,omitempty"` // Up to 255 characters
+	Permissions []string `json:"permissions"`           // e.g. ["vms.read_all", "logs.read"]
+}
+
+// RoleInfo describes a built-in or custom role.
+type RoleInfo struct {
+	Name        string              `json:"name"`
+	Description string              `json:"description,omitempty"`
+	Permissions []models.Permission `json:"permissions"`
+	BuiltIn     bool                `json:"built_in"`
+	Users       int64               `json:"users"` // Users with the role
+	CreatedAt   *time.Time          `json:"created_at,omitempty"`
+	UpdatedAt   *time.Time          `json:"updated_at,omitempty"`
+}
+
+func roleInfo(role *models.Role, users int64) RoleInfo {
+	info := RoleInfo{
+		Name:        role.Name,
+		Description: role.Description,
+		Permissions: role.PermissionList(),
+		BuiltIn:     role.BuiltIn,
+		Users:       users,
+	}
+	if info.Permissions == nil {
+		info.Permissions = []models.Permission{}
+	}
+	if !role.BuiltIn {
+		info.CreatedAt, info.UpdatedAt = &role.CreatedAt, &role.UpdatedAt
+	}
+	return info
+}
+
+// writeRoleError writes the response to a failed role change.
+func writeRoleError(w http.ResponseWriter, name string, err error) {
+	switch {
+	case stderrors.Is(err, auth.ErrInvalidRoleName), stderrors.Is(err, auth.ErrInvalidPermission), stderrors.Is(err, auth.ErrBuiltInRole):
+		errors.WriteBadRequest(w, err.Error(), nil)
+	case stderrors.Is(err, auth.ErrRoleExists):
+		errors.WriteErrorWithCode(w, http.StatusConflict, "Role already exists", errors.ErrCodeResourceConflict, nil, false)
+	case stderrors.Is(err, auth.ErrRoleInUse):
+		errors.WriteErrorWithCode(w, http.StatusConflict, "Role is assigned to users: give them another role first", errors.ErrCodeResourceConflict, nil, false)
+	case stderrors.Is(err, gorm.ErrRecordNotFound):
+		errors.WriteNotFound(w, "Role")
+	default:
+		logger.Log.Error("Failed to change role", zap.String("role", name), zap.Error(err))
+		errors.WriteInternalError(w, err, false)
+	}
+}
+
+// decodeRoleRequest decodes and checks the body of a role change.
+func decodeRoleRequest(w http.ResponseWriter, r *http.Request) (*RoleRequest, bool) {
+	var req RoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errors.WriteBadRequest(w, "Invalid request body", err)
+		return nil, false
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	req.Description = strings.TrimSpace(req.Description)
+	if utf8.RuneCountInString(req.Description) > 255 {
+		errors.WriteBadRequest(w, "Description must be at most 255 characters", nil)
+		return nil, false
+	}
+	return &req, true
+}
+
+// HandleListRoles handles GET /api/admin/roles - List roles and permissions.
+// @Summary     List roles
+// @Description Lists the built-in roles (admin, user, operator, auditor) and the custom roles with their
+// @Description permissions and number of users, and every permission roles can grant.
+// @Tags        Admin
+// @Produce     json
+// @Success     200  {object}  map[string]interface{}  "roles: []RoleInfo, permissions: []string"
+// @Failure     403  {object}  map[string]interface{}  "Forbidden - admin access required"
+// @Security    BearerAuth
+// @Router      /admin/roles [get]
+func (h *Handler) HandleListRoles(w http.ResponseWriter, r *http.Request) {
+	roles, err := h.Roles.List()
+	if err != nil {
+		logger.Log.Error("Failed to list roles", zap.Error(err))
+		errors.WriteInternalError(w, err, false)
+		return
+	}
+
+	var counts []struct {
+		Role  string
+		Count int64
+	}
+	if err := h.DB.Model(&models.User{}).Select("role, count(*) AS count").Group("role").Scan(&counts).Error; err != nil {
+		logger.Log.Error("Failed to count users by role", zap.Error(err))
+		errors.WriteInternalError(w, err, false)
+		return
+	}
+	users := make(map[string]int64, len(counts))
+	for _, c := range counts {
+		users[c.Role] = c.Count
+	}
+
+	infos := make([]RoleInfo, 0, len(roles))
+	for i := range roles {
+		infos = append(infos, roleInfo(&roles[i], users[roles[i].Name]))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"roles":       infos,
+		"permissions": models.AllPermissions,
+	})
+}
+
+// HandleCreateRole handles POST /api/admin/roles - Create a custom role.
+// @Summary     Create a role
+// @Description Creates a custom role granting permissions. Users are given it like a built-in role, with
+// @Description PUT /admin/users/{id}/role.
+// @Tags        Admin
+// @Accept      json
+// @Produce     json
+// @Param       request body RoleRequest true "Name, description and permissions"
+// @Success     201  {object}  RoleInfo
+// @Failure     400  {object}  map[string]interface{}  "Invalid name, description or permissions"
+// @Failure     403  {object}  map[string]interface{}  "Forbidden - admin access required"
+// @Failure     409  {object}  map[string]interface{}  "Role already exists"
+// @Security    BearerAuth
+// @Router      /admin/roles [post]
+func (h *Handler) HandleCreateRole(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		errors.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+	req, ok := decodeRoleRequest(w, r)
+	if !ok {
+		return
+	}
+
+	role, err := h.Roles.Create(req.Name, req.Description, req.Permissions)
+	if err != nil {
+		writeRoleError(w, req.Name, err)
+		return
+	}
+	logger.Log.Info("Role created", zap.String("role", role.Name), zap.String("permissions", role.Permissions))
+	audit.LogRoleChange(r.Context(), role.Name, "create", role.PermissionList())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(roleInfo(role, 0))
+}
+
+// HandleUpdateRole handles PUT /api/admin/roles/{name} - Update a custom role.
+// @Summary     Update a role
+// @Description Replaces the description and permissions of a custom role. Its users have the new
+// @Description permissions on their next request. Built-in roles can't be changed.
+// @Tags        Admin
+// @Accept      json
+// @Produce     json
+// @Param       name path string true "Role name"
+// @Param       request body RoleRequest true "Description and permissions"
+// @Success     200  {object}  RoleInfo
+// @Failure     400  {object}  map[string]interface{}  "Invalid permissions, or a built-in role"
+// @Failure     403  {object}  map[string]interface{}  "Forbidden - admin access required"
+// @Failure     404  {object}  map[string]interface{}  "Role not found"
+// @Security    BearerAuth
+// @Router      /admin/roles/{name} [put]
+func (h *Handler) HandleUpdateRole(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	req, ok := decodeRoleRequest(w, r)
+	if !ok {
+		return
+	}
+
+	role, err := h.Roles.Update(name, req.Description, req.Permissions)
+	if err != nil {
+		writeRoleError(w, name, err)
+		return
+	}
+	var users int64
+	h.DB.Model(&models.User{}).Where("role = ?", role.Name).Count(&users)
+	logger.Log.Info("Role updated", zap.String("role", role.Name), zap.String("permissions", role.Permissions))
+	audit.LogRoleChange(r.Context(), role.Name, "update", role.PermissionList())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(roleInfo(role, users))
+}
+
+// HandleDeleteRole handles DELETE /api/admin/roles/{name} - Delete a custom role.
+// @Summary     Delete a role
+// @Description Deletes a custom role. It must not be assigned to any user; built-in roles can't be deleted.
+// @Tags        Admin
+// @Produce     json
+// @Param       name path string true "Role name"
+// @Success     200  {object}  map[string]interface{}  "Role deleted"
+// @Failure     400  {object}  map[string]interface{}  "Built-in role"
+// @Failure     403  {object}  map[string]interface{}  "Forbidden - admin access required"
+// @Failure     404  {object}  map[string]interface{}  "Role not found"
+// @Failure     409  {object}  map[string]interface{}  "Role is assigned to users"
+// @Security    BearerAuth
+// @Router      /admin/roles/{name} [delete]
+func (h *Handler) HandleDeleteRole(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	role, err := h.Roles.Delete(name)
+	if err != nil {
+		writeRoleError(w, name, err)
+		return
+	}
+	logger.Log.Info("Role deleted", zap.String("role", role.Name))
+	audit.LogRoleChange(r.Context(), role.Name, "delete", role.PermissionList())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Role deleted",
+	})
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+)
+
+func TestRoles_Flow(t *testing.T) {
+	h := setupTestImageHandler(t)
+	bob := models.User{Username: "bob", Password: "x", Role: models.RoleUser, Approved: true}
+	h.DB.Create(&bob)
+
+	w := httptest.NewRecorder()
+	h.HandleCreateRole(w, imageRequest("POST", "/api/admin/roles", []byte(`{"name":"support","permissions":["vms.read_all","logs.read"]}`), 1, "admin", nil))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create = %d: %s", w.Code, w.Body.String())
+	}
+	for body, want := range map[string]int{
+		`{"name":"support","permissions":[]}`:            http.StatusConflict,
+		`{"name":"operator","permissions":[]}`:           http.StatusConflict,
+		`{"name":"Bad Name","permissions":[]}`:           http.StatusBadRequest,
+		`{"name":"root","permissions":["users.manage"]}`: http.StatusBadRequest,
+	} {
+		w = httptest.NewRecorder()
+		h.HandleCreateRole(w, imageRequest("POST", "/api/admin/roles", []byte(body), 1, "admin", nil))
+		if w.Code != want {
+			t.Errorf("create %s = %d, want %d", body, w.Code, want)
+		}
+	}
+
+	// The new role can be given like a built-in one
+	w = httptest.NewRecorder()
+	h.HandleUpdateUserRole(w, imageRequest("PUT", "/api/admin/users/1/role", []byte(`{"role":"support"}`), 1, "admin", map[string]string{"id": "1"}), h.Config)
+	if w.Code != http.StatusOK {
+		t.Fatalf("assign = %d: %s", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	h.HandleUpdateUserRole(w, imageRequest("PUT", "/api/admin/users/1/role", []byte(`{"role":"ghost"}`), 1, "admin", map[string]string{"id": "1"}), h.Config)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("assign an unknown role = %d, want 400", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	h.HandleUpdateRole(w, imageRequest("PUT", "/api/admin/roles/support", []byte(`{"description":"Helpdesk","permissions":["audit.read"]}`), 1, "admin", map[string]string{"name": "support"}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("update = %d: %s", w.Code, w.Body.String())
+	}
+	var updated RoleInfo
+	json.Unmarshal(w.Body.Bytes(), &updated)
+	if updated.Description != "Helpdesk" || len(updated.Permissions) != 1 || updated.Permissions[0] != models.PermAuditRead || updated.Users != 1 {
+		t.Errorf("update = %+v", updated)
+	}
+	if !h.Roles.HasPermission("support", models.PermAuditRead) || h.Roles.HasPermission("support", models.PermLogsRead) {
+		t.Error("updated permissions don't apply")
+	}
+	w = httptest.NewRecorder()
+	h.HandleUpdateRole(w, imageRequest("PUT", "/api/admin/roles/admin", []byte(`{"permissions":[]}`), 1, "admin", map[string]string{"name": "admin"}))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("update a built-in role = %d, want 400", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	h.HandleListRoles(w, imageRequest("GET", "/api/admin/roles", nil, 1, "admin", nil))
+	var list struct {
+		Roles       []RoleInfo          `json:"roles"`
+		Permissions []models.Permission `json:"permissions"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if w.Code != http.StatusOK || len(list.Roles) != 5 || list.Roles[4].Name != "support" || list.Roles[4].Users != 1 ||
+		len(list.Permissions) != len(models.AllPermissions) {
+		t.Errorf("list = %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	h.HandleDeleteRole(w, imageRequest("DELETE", "/api/admin/roles/support", nil, 1, "admin", map[string]string{"name": "support"}))
+	if w.Code != http.StatusConflict {
+		t.Errorf("delete an assigned role = %d, want 409", w.Code)
+	}
+	h.DB.Model(&bob).Update("role", "user")
+	w = httptest.NewRecorder()
+	h.HandleDeleteRole(w, imageRequest("DELETE", "/api/admin/roles/support", nil, 1, "admin", map[string]string{"name": "support"}))
+	if w.Code != http.StatusOK {
+		t.Errorf("delete = %d: %s", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	h.HandleDeleteRole(w, imageRequest("DELETE", "/api/admin/roles/support", nil, 1, "admin", map[string]string{"name": "support"}))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("delete again = %d, want 404", w.Code)
+	}
+}
+
+func TestHandleListAuditLogs(t *testing.T) {
+	h := setupTestImageHandler(t)
+	for _, action := range []string{"vm.start", "vm.stop", "vm.start"} {
+		h.DB.Create(&models.AuditLog{Action: action, Resource: "vm", Result: "success"})
+	}
+
+	w := httptest.NewRecorder()
+	h.HandleListAuditLogs(w, imageRequest("GET", "/api/admin/audit-logs?action=vm.start&limit=1", nil, 1, "auditor", nil))
+	var resp struct {
+		Logs  []models.AuditLog `json:"logs"`
+		Total int64             `json:"total"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != http.StatusOK || resp.Total != 2 || len(resp.Logs) != 1 || resp.Logs[0].Action != "vm.start" {
+		t.Errorf("list = %d: %s", w.Code, w.Body.String())
+	}
+
+	for _, query := range []string{"user_id=x", "limit=0", "offset=-1"} {
+		w = httptest.NewRecorder()
+		h.HandleListAuditLogs(w, imageRequest("GET", "/api/admin/audit-logs?"+query, nil, 1, "auditor", nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("list ?%s = %d, want 400", query, w.Code)
+		}
+	}
+}
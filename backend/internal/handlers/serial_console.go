@@ -0,0 +1,324 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/DARC0625/LIMEN/backend/internal/audit"
+	"github.com/DARC0625/LIMEN/backend/internal/auth"
+	"github.com/DARC0625/LIMEN/backend/internal/logger"
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"github.com/DARC0625/LIMEN/backend/internal/recording"
+	"github.com/DARC0625/LIMEN/backend/internal/security"
+	"github.com/DARC0625/LIMEN/backend/internal/session"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"nhooyr.io/websocket"
+)
+
+// Serial console protocol (xterm.js compatible):
+//   - binary frames carry raw terminal bytes in both directions
+//   - client text frames are JSON control messages: {"type":"data","data":"..."},
+//     {"type":"resize","cols":80,"rows":24} or {"type":"break"}
+//   - server text frames are JSON status/error messages, as on the VNC socket
+type serialControl struct {
+	Type string `json:"type"`
+	Data string `json:"data,omitempty"`
+	Cols int    `json:"cols,omitempty"`
+	Rows int    `json:"rows,omitempty"`
+}
+
+// serialBridge copies between a console WebSocket and a serial stream until either side
+// fails or ctx ends, like consoleTCPBridge. sendBreak handles break requests; activity is
+// called periodically while data flows.
+func serialBridge(ctx context.Context, ws *websocket.Conn, stream io.ReadWriteCloser, sendBreak func() error, activity func()) error {
+	errc := make(chan error, 2)
+
+	// WebSocket -> serial; ends when the caller closes the WebSocket
+	go func() {
+		var count int32
+		for {
+			typ, message, err := ws.Read(context.Background())
+			if err != nil {
+				errc <- err
+				return
+			}
+			if atomic.AddInt32(&count, 1)%100 == 0 {
+				activity()
+			}
+
+			if typ == websocket.MessageBinary {
+				if _, err := stream.Write(message); err != nil {
+					errc <- err
+					return
+				}
+				continue
+			}
+
+			var ctl serialControl
+			if err := json.Unmarshal(message, &ctl); err != nil {
+				logger.Log.Debug("Ignoring malformed serial control message", zap.Error(err))
+				continue
+			}
+			switch ctl.Type {
+			case "data":
+				if _, err := stream.Write([]byte(ctl.Data)); err != nil {
+					errc <- err
+					return
+				}
+			case "resize":
+				// A serial line has no window size signalling; the guest has to be told with
+				// stty. Accepted so xterm.js attach addons don't need special-casing.
+				logger.Log.Debug("Serial console resize", zap.Int("cols", ctl.Cols), zap.Int("rows", ctl.Rows))
+			case "break":
+				if err := sendBreak(); err != nil {
+					logger.Log.Warn("Failed to send serial break", zap.Error(err))
+					writeCtx, writeCancel := context.WithTimeout(context.Background(), 5*time.Second)
+					ws.Write(writeCtx, websocket.MessageText, []byte(`{"type":"error","error":"Failed to send break","code":"SERIAL_BREAK_FAILED"}`))
+					writeCancel()
+				}
+			default:
+				logger.Log.Debug("Ignoring unknown serial control message", zap.String("type", ctl.Type))
+			}
+		}
+	}()
+
+	// serial -> WebSocket
+	go func() {
+		buf := make([]byte, 4096)
+		var count int32
+		for {
+			n, err := stream.Read(buf)
+			if err != nil {
+				errc <- err
+				return
+			}
+			if atomic.AddInt32(&count, 1)%100 == 0 {
+				activity()
+			}
+			writeCtx, writeCancel := context.WithTimeout(context.Background(), 60*time.Second)
+			err = ws.Write(writeCtx, websocket.MessageBinary, buf[:n])
+			writeCancel()
+			if err != nil {
+				errc <- err
+				return
+			}
+		}
+	}()
+
+	var err error
+	select {
+	case err = <-errc:
+	case <-ctx.Done():
+		err = context.Cause(ctx)
+	}
+	// Unblock the serial reader, which doesn't watch ctx
+	stream.Close()
+	return err
+}
+
+// authorizeConsoleTicket redeems the console ticket of a WebSocket console request and
+// checks the ticket holder may use consoles. On failure the request has been rejected.
+func (h *Handler) authorizeConsoleTicket(w http.ResponseWriter, r *http.Request, vmUUID string) (*auth.ConsoleTicketClaims, bool) {
+	ticket, tokErr := h.redeemConsoleTicket(consoleTicketToken(r), vmUUID, h.clientIP(r))
+	if tokErr != nil {
+		logger.Log.Warn("Console connection attempt with rejected console ticket",
+			zap.String("path", r.URL.Path),
+			zap.String("client_ip", h.clientIP(r)),
+			zap.String("vm_uuid", vmUUID),
+			zap.String("code", string(tokErr.Code)))
+		h.rejectConsole(w, r, http.StatusUnauthorized, tokErr)
+		return nil, false
+	}
+	// Share tickets join a shared VNC session, possibly view-only: they never open a
+	// console of their own
+	if ticket.ShareID != "" {
+		h.rejectConsole(w, r, http.StatusForbidden,
+			security.NewTokenError(consoleErrShareTicket, "Share tickets only join the shared VNC session"))
+		return nil, false
+	}
+
+	if !h.Roles.HasPermission(ticket.Role, models.PermManageSystem) {
+		if !ticket.Approved {
+			h.rejectConsole(w, r, http.StatusForbidden,
+				security.NewTokenError(security.TokenErrorNotApproved, "Account pending approval"))
+			return nil, false
+		}
+		if !ticket.BetaAccess {
+			var user models.User
+			if err := h.DB.Select("id", "beta_access", "role").Where("id = ?", ticket.UserID).First(&user).Error; err == nil &&
+				!h.Roles.HasPermission(string(user.Role), models.PermManageSystem) && !user.BetaAccess {
+				h.rejectConsole(w, r, http.StatusForbidden,
+					security.NewTokenError(consoleErrBetaAccess, "Beta access required to access console. Please contact administrator."))
+				return nil, false
+			}
+		}
+	}
+	return ticket, true
+}
+
+// consoleTicketToken returns the console ticket of a request: the token query parameter
+// or a Bearer Authorization header.
+func consoleTicketToken(r *http.Request) string {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		if authHeader := r.Header.Get("Authorization"); strings.HasPrefix(authHeader, "Bearer ") {
+			token = strings.TrimPrefix(authHeader, "Bearer ")
+		}
+	}
+	return token
+}
+
+// consoleErrBetaAccess rejects console access for users without beta access.
+const consoleErrBetaAccess security.TokenErrorCode = "BETA_ACCESS_REQUIRED"
+
+// consoleErrShareTicket rejects share tickets at consoles other than the shared session.
+const consoleErrShareTicket security.TokenErrorCode = "SHARE_TICKET"
+
+// HandleSerialConsole handles serial console WebSocket connections
+// @Summary Connect to VM serial console
+// @Description Bridges the VM's serial port (serial0) to a WebSocket. Binary frames carry terminal data;
+// @Description text frames carry JSON control messages (data, resize, break). Requires a console ticket
+// @Description from GET /vms/{uuid}/console?protocol=serial. Useful for headless VMs and boot debugging.
+// @Tags vms
+// @Param uuid path string true "VM UUID" format(uuid)
+// @Param token query string true "Single-use console ticket"
+// @Success 101 "Switching Protocols"
+// @Failure 401 {object} map[string]interface{} "Missing, invalid, expired, replayed or mis-bound ticket"
+// @Failure 403 {object} map[string]interface{} "Account not approved, or a share ticket"
+// @Router /ws/serial/{uuid} [get]
+func (h *Handler) HandleSerialConsole(w http.ResponseWriter, r *http.Request) {
+	uuidStr := consoleVMUUID(r)
+
+	ticket, ok := h.authorizeConsoleTicket(w, r, uuidStr)
+	if !ok {
+		return
+	}
+	if uuidStr == "" {
+		uuidStr = ticket.Subject
+	}
+
+	ws, err := h.acceptWebSocket(w, r)
+	if err != nil {
+		logger.Log.Warn("Serial console WebSocket accept failed",
+			zap.Error(err),
+			zap.String("vm_uuid", uuidStr),
+			zap.Uint("user_id", ticket.UserID))
+		http.Error(w, fmt.Sprintf("WebSocket accept failed: %v", err), http.StatusBadRequest)
+		return
+	}
+	defer ws.Close(websocket.StatusNormalClosure, "")
+
+	fail := func(code, message string) {
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+		payload, _ := json.Marshal(map[string]string{"type": "error", "error": message, "code": code})
+		ws.Write(ctx, websocket.MessageText, payload)
+		ws.Close(websocket.StatusPolicyViolation, code)
+	}
+
+	var vmRec models.VM
+	if err := h.DB.Where("uuid = ?", uuidStr).First(&vmRec).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			fail("VM_NOT_FOUND", "VM not found")
+		} else {
+			logger.Log.Error("Failed to find VM for serial console", zap.Error(err), zap.String("vm_uuid", uuidStr))
+			fail("DB_ERROR", "Database error")
+		}
+		return
+	}
+	if h.VMService == nil {
+		fail("VM_SERVICE_UNAVAILABLE", "VM service is not available")
+		return
+	}
+
+	sessionMgr := session.GetSessionManager()
+	if err := sessionMgr.CheckReconnectLimit(ticket.UserID); err != nil {
+		fail("RECONNECT_LIMIT_EXCEEDED", err.Error())
+		return
+	}
+	sessionID, err := sessionMgr.CreateSession(ticket.UserID, vmRec.ID, vmRec.UUID, "serial", h.clientIP(r), r.UserAgent())
+	if err != nil {
+		fail("SESSION_CREATE_FAILED", err.Error())
+		return
+	}
+	audit.LogConsoleSessionStart(r.Context(), ticket.UserID, sessionID, vmRec.UUID)
+
+	endReason := "user_disconnect"
+	defer func() {
+		sessionMgr.EndSession(sessionID, endReason)
+		audit.LogConsoleSessionEnd(r.Context(), ticket.UserID, sessionID, vmRec.UUID, endReason)
+	}()
+
+	sess, ok := sessionMgr.GetSession(sessionID)
+	if !ok {
+		endReason = "error"
+		fail("SESSION_NOT_FOUND", "Session not found")
+		return
+	}
+
+	// Reconnecting takes the console over from a stale connection of the same user
+	stream, err := h.VMService.OpenSerialConsole(vmRec.Name, true)
+	if err != nil {
+		logger.Log.Warn("Failed to open serial console",
+			zap.Error(err),
+			zap.String("vm_name", vmRec.Name),
+			zap.Uint("user_id", ticket.UserID))
+		endReason = "error"
+		if strings.Contains(err.Error(), "not running") {
+			fail("VM_NOT_RUNNING", "VM is not running")
+		} else {
+			fail("SERIAL_CONSOLE_FAILED", "Failed to open serial console")
+		}
+		return
+	}
+	defer stream.Close()
+
+	rec := h.startConsoleRecording(&vmRec, sessionID, ticket.UserID, "serial")
+	defer rec.Close()
+	stream = recording.Wrap(stream, rec)
+
+	statusCtx, statusCancel := context.WithTimeout(r.Context(), 5*time.Second)
+	ws.Write(statusCtx, websocket.MessageText, []byte(`{"type":"status","message":"Serial console connected"}`))
+	ws.Write(statusCtx, websocket.MessageText, []byte(fmt.Sprintf(`{"type":"session","session_id":"%s","mode":"owner"}`, sessionID)))
+	statusCancel()
+
+	logger.Log.Info("Serial console session started",
+		zap.String("session_id", sessionID),
+		zap.String("vm_uuid", vmRec.UUID),
+		zap.Uint("user_id", ticket.UserID))
+
+	err = serialBridge(sess.Context(), ws, stream,
+		func() error { return h.VMService.SendSerialBreak(vmRec.Name) },
+		func() {
+			if err := sessionMgr.UpdateActivity(sessionID); err != nil {
+				logger.Log.Warn("Failed to update session activity", zap.Error(err))
+			}
+		})
+
+	closeStatus := websocket.CloseStatus(err)
+	if closeStatus != websocket.StatusNormalClosure && closeStatus != websocket.StatusGoingAway {
+		if stderrors.Is(context.Cause(sess.Context()), session.ErrSessionTerminated) {
+			endReason = "admin_terminated"
+			ws.Close(websocket.StatusPolicyViolation, "SESSION_TERMINATED")
+			return
+		}
+		if sess.Context().Err() != nil {
+			// Session manager ended the session (idle timeout or max duration)
+			endReason = "session_expired"
+			ws.Close(websocket.StatusPolicyViolation, "SESSION_EXPIRED")
+			return
+		}
+		if err == io.EOF {
+			endReason = "vm_disconnect"
+		}
+		ws.Close(websocket.StatusNormalClosure, "Serial console closed")
+	}
+}
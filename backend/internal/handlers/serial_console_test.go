@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"github.com/DARC0625/LIMEN/backend/internal/security"
+	"nhooyr.io/websocket"
+)
+
+func TestHandleVMConsole_SerialProtocol(t *testing.T) {
+	h := setupTestImageHandler(t)
+	h.DB.Create(&models.User{Username: "alice", Password: "x", Role: models.RoleUser, Approved: true})
+	vmRec := models.VM{Name: "headless-vm", CPU: 1, Memory: 1024, OwnerID: 1}
+	h.DB.Create(&vmRec)
+	params := map[string]string{"uuid": vmRec.UUID}
+
+	w := httptest.NewRecorder()
+	h.HandleVMConsole(w, imageRequest(http.MethodGet, "/api/vms/"+vmRec.UUID+"/console?protocol=serial", nil, 1, "user", params))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	var resp map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp["protocol"] != "serial" {
+		t.Errorf("protocol = %v, want serial", resp["protocol"])
+	}
+	if !strings.Contains(resp["ws_url"].(string), "/ws/serial/"+vmRec.UUID+"?token=") {
+		t.Errorf("ws_url = %v, want /ws/serial/ URL", resp["ws_url"])
+	}
+
+	w = httptest.NewRecorder()
+	h.HandleVMConsole(w, imageRequest(http.MethodGet, "/api/vms/"+vmRec.UUID+"/console?protocol=rdp", nil, 1, "user", params))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("unknown protocol status = %d, want 400", w.Code)
+	}
+}
+
+func TestHandleSerialConsole_RequiresTicket(t *testing.T) {
+	h := setupTestImageHandler(t)
+	req := httptest.NewRequest(http.MethodGet, "/ws/serial/12345678-1234-1234-1234-123456789abc", nil)
+	w := httptest.NewRecorder()
+
+	h.HandleSerialConsole(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401", w.Code)
+	}
+	var resp map[string]string
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp["code"] != string(security.TokenErrorMissing) {
+		t.Errorf("code = %q, want MISSING_TOKEN", resp["code"])
+	}
+}
+
+func TestSerialBridge(t *testing.T) {
+	guest, stream := net.Pipe()
+	defer guest.Close()
+
+	var breaks int32
+	done := make(chan error, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			done <- err
+			return
+		}
+		defer ws.Close(websocket.StatusNormalClosure, "")
+		done <- serialBridge(r.Context(), ws, stream,
+			func() error { atomic.AddInt32(&breaks, 1); return nil },
+			func() {})
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+
+	readGuest := func(n int) string {
+		buf := make([]byte, n)
+		guest.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if _, err := io.ReadFull(guest, buf); err != nil {
+			t.Fatalf("guest read error = %v", err)
+		}
+		return string(buf)
+	}
+
+	// Raw input
+	client.Write(ctx, websocket.MessageBinary, []byte("ls\r"))
+	if got := readGuest(3); got != "ls\r" {
+		t.Errorf("guest got %q, want %q", got, "ls\r")
+	}
+
+	// Control messages; resize is accepted and ignored
+	client.Write(ctx, websocket.MessageText, []byte(`{"type":"resize","cols":120,"rows":40}`))
+	client.Write(ctx, websocket.MessageText, []byte(`{"type":"break"}`))
+	client.Write(ctx, websocket.MessageText, []byte(`{"type":"data","data":"id\r"}`))
+	if got := readGuest(3); got != "id\r" {
+		t.Errorf("guest got %q, want %q", got, "id\r")
+	}
+	if n := atomic.LoadInt32(&breaks); n != 1 {
+		t.Errorf("breaks = %d, want 1", n)
+	}
+
+	// Guest output
+	go guest.Write([]byte("login: "))
+	typ, data, err := client.Read(ctx)
+	if err != nil {
+		t.Fatalf("client read error = %v", err)
+	}
+	if typ != websocket.MessageBinary || string(data) != "login: " {
+		t.Errorf("client got %v %q, want binary %q", typ, data, "login: ")
+	}
+
+	// Guest hang-up ends the bridge
+	guest.Close()
+	select {
+	case err := <-done:
+		if err != io.EOF && err != io.ErrClosedPipe {
+			t.Errorf("serialBridge() error = %v, want EOF", err)
+		}
+	case <-ctx.Done():
+		t.Fatal("serialBridge did not return after the guest closed")
+	}
+}
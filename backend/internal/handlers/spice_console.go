@@ -0,0 +1,347 @@
+package handlers
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/DARC0625/LIMEN/backend/internal/audit"
+	"github.com/DARC0625/LIMEN/backend/internal/logger"
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"github.com/DARC0625/LIMEN/backend/internal/session"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"nhooyr.io/websocket"
+)
+
+// SPICE console proxy (spice-html5 compatible):
+//   - a SPICE client opens one connection per channel (main, display, inputs, cursor, ...)
+//     and spice-html5 opens them all to the same WebSocket URL. The first connection redeems
+//     the console ticket and starts the console session; later channel connections present
+//     the same ticket, which is verified without being consumed and accepted only while that
+//     session is live, from the same client, and for at most maxSPICEChannels channels.
+//   - frames carry raw SPICE bytes. There are no JSON status messages, since SPICE clients
+//     can't skip them; failures are reported as the close reason (e.g. VM_NOT_RUNNING).
+
+// maxSPICEChannels is how many channels may join a console after the main channel.
+// spice-html5 opens display, inputs, cursor and playback; the limit holds over the
+// console's lifetime, so a leaked ticket can't keep opening connections.
+const maxSPICEChannels = 8
+
+// spiceConsole is a live SPICE console opened by a ticket.
+type spiceConsole struct {
+	sessionID string
+	addr      string       // SPICE server address
+	channels  atomic.Int32 // Channels that joined after the main channel
+}
+
+// joinChannel counts a channel joining the console, or reports false if it has had
+// maxSPICEChannels already.
+func (c *spiceConsole) joinChannel() bool {
+	return c.channels.Add(1) <= maxSPICEChannels
+}
+
+// spiceConsoles maps the ID of the ticket that opened a SPICE console to the console.
+var spiceConsoles sync.Map
+
+// consoleTCPBridge copies between a console WebSocket (binary frames) and a TCP
+// connection until either side fails or ctx ends; it then returns the error or the cause
+// of ctx. activity is called periodically while data flows.
+//
+// The WebSocket is left open so the caller can close it with a reason: reads don't watch
+// ctx, because cancelling a read makes the WebSocket library drop the connection.
+func consoleTCPBridge(ctx context.Context, ws *websocket.Conn, conn net.Conn, activity func()) error {
+	errc := make(chan error, 2)
+
+	// WebSocket -> server; ends when the caller closes the WebSocket
+	go func() {
+		var count int32
+		for {
+			typ, message, err := ws.Read(context.Background())
+			if err != nil {
+				errc <- err
+				return
+			}
+			if atomic.AddInt32(&count, 1)%100 == 0 {
+				activity()
+			}
+			if typ != websocket.MessageBinary {
+				continue
+			}
+			if _, err := conn.Write(message); err != nil {
+				errc <- err
+				return
+			}
+		}
+	}()
+
+	// server -> WebSocket
+	go func() {
+		buf := make([]byte, 32*1024)
+		var count int32
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				errc <- err
+				return
+			}
+			if atomic.AddInt32(&count, 1)%100 == 0 {
+				activity()
+			}
+			writeCtx, writeCancel := context.WithTimeout(context.Background(), 60*time.Second)
+			err = ws.Write(writeCtx, websocket.MessageBinary, buf[:n])
+			writeCancel()
+			if err != nil {
+				errc <- err
+				return
+			}
+		}
+	}()
+
+	var err error
+	select {
+	case err = <-errc:
+	case <-ctx.Done():
+		err = context.Cause(ctx)
+	}
+	// Unblock the TCP reader
+	conn.Close()
+	return err
+}
+
+// dialConsoleServer connects to a VM's graphical console server.
+func dialConsoleServer(addr string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: 3 * time.Second, KeepAlive: 30 * time.Second}
+	conn, err := dialer.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		tcpConn.SetNoDelay(true) // Disable Nagle's algorithm for low latency
+	}
+	return conn, nil
+}
+
+// spiceChannelConsole returns the live SPICE console a follow-up channel connection
+// belongs to: one opened by the same ticket, presented from the same client.
+func (h *Handler) spiceChannelConsole(token, vmUUID, clientIP string) (*spiceConsole, *session.ActiveSession, bool) {
+	if h.ConsoleTickets == nil || token == "" {
+		return nil, nil, false
+	}
+	ticket, err := h.ConsoleTickets.Verify(token, vmUUID, clientIP)
+	if err != nil {
+		return nil, nil, false
+	}
+	value, ok := spiceConsoles.Load(ticket.ID)
+	if !ok {
+		return nil, nil, false
+	}
+	console := value.(*spiceConsole)
+	sess, ok := session.GetSessionManager().GetSession(console.sessionID)
+	if !ok || sess.UserID != ticket.UserID {
+		return nil, nil, false
+	}
+	if !console.joinChannel() {
+		logger.Log.Warn("SPICE channel refused: too many channels for the console",
+			zap.String("session_id", console.sessionID),
+			zap.String("client_ip", clientIP))
+		return nil, nil, false
+	}
+	return console, sess, true
+}
+
+// HandleSPICE handles SPICE console WebSocket connections
+// @Summary Connect to VM via SPICE
+// @Description Bridges a WebSocket to the VM's SPICE server for VMs defined with SPICE graphics
+// @Description (GET /vms/{uuid}/console reports protocol "spice"). Requires a console ticket from
+// @Description GET /vms/{uuid}/console?protocol=spice. The first connection redeems the ticket;
+// @Description further SPICE channels connect to the same URL while it stays open. Failures close
+// @Description the WebSocket with status 1008 and an error code as the reason. The VM must be running.
+// @Tags vms
+// @Param uuid path string true "VM UUID" format(uuid)
+// @Param token query string true "Console ticket"
+// @Success 101 "Switching Protocols"
+// @Failure 401 {object} map[string]interface{} "Missing, invalid, expired, replayed or mis-bound ticket"
+// @Failure 403 {object} map[string]interface{} "Account not approved, or a share ticket"
+// @Router /ws/spice/{uuid} [get]
+func (h *Handler) HandleSPICE(w http.ResponseWriter, r *http.Request) {
+	uuidStr := consoleVMUUID(r)
+
+	// Additional channels of a console that is already open
+	if console, sess, ok := h.spiceChannelConsole(consoleTicketToken(r), uuidStr, h.clientIP(r)); ok {
+		h.serveSPICEChannel(w, r, console, sess)
+		return
+	}
+
+	ticket, ok := h.authorizeConsoleTicket(w, r, uuidStr)
+	if !ok {
+		return
+	}
+	if uuidStr == "" {
+		uuidStr = ticket.Subject
+	}
+
+	ws, err := h.acceptWebSocket(w, r)
+	if err != nil {
+		logger.Log.Warn("SPICE WebSocket accept failed",
+			zap.Error(err),
+			zap.String("vm_uuid", uuidStr),
+			zap.Uint("user_id", ticket.UserID))
+		http.Error(w, fmt.Sprintf("WebSocket accept failed: %v", err), http.StatusBadRequest)
+		return
+	}
+	defer ws.Close(websocket.StatusNormalClosure, "")
+
+	fail := func(code string) {
+		ws.Close(websocket.StatusPolicyViolation, code)
+	}
+
+	var vmRec models.VM
+	if err := h.DB.Where("uuid = ?", uuidStr).First(&vmRec).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			fail("VM_NOT_FOUND")
+		} else {
+			logger.Log.Error("Failed to find VM for SPICE console", zap.Error(err), zap.String("vm_uuid", uuidStr))
+			fail("DB_ERROR")
+		}
+		return
+	}
+	if h.VMService == nil {
+		fail("VM_SERVICE_UNAVAILABLE")
+		return
+	}
+
+	spicePort, err := h.VMService.GetSPICEPort(vmRec.Name)
+	if err != nil {
+		logger.Log.Warn("Failed to get SPICE port",
+			zap.Error(err),
+			zap.String("vm_name", vmRec.Name),
+			zap.Uint("user_id", ticket.UserID))
+		switch {
+		case strings.Contains(err.Error(), "not running"):
+			fail("VM_NOT_RUNNING")
+		case strings.Contains(err.Error(), "not found in VM configuration"):
+			fail("SPICE_NOT_CONFIGURED")
+		default:
+			fail("SPICE_PORT_ERROR")
+		}
+		return
+	}
+	// SPICE is bridged unencrypted, so only to console servers on this server's loopback
+	consoleAddr, remote, err := h.VMService.ConsoleDialAddress(vmRec.Name)
+	if err != nil || remote {
+		logger.Log.Warn("SPICE console of a VM on another host refused",
+			zap.Error(err),
+			zap.String("vm_name", vmRec.Name),
+			zap.Uint("host_id", vmRec.HostID))
+		fail("CONSOLE_UNREACHABLE")
+		return
+	}
+	console := &spiceConsole{addr: net.JoinHostPort(consoleAddr, spicePort)}
+
+	sessionMgr := session.GetSessionManager()
+	if err := sessionMgr.CheckReconnectLimit(ticket.UserID); err != nil {
+		fail("RECONNECT_LIMIT_EXCEEDED")
+		return
+	}
+	sessionID, err := sessionMgr.CreateSession(ticket.UserID, vmRec.ID, vmRec.UUID, "spice", h.clientIP(r), r.UserAgent())
+	if err != nil {
+		fail("SESSION_CREATE_FAILED")
+		return
+	}
+	audit.LogConsoleSessionStart(r.Context(), ticket.UserID, sessionID, vmRec.UUID)
+
+	console.sessionID = sessionID
+	spiceConsoles.Store(ticket.ID, console)
+
+	endReason := "user_disconnect"
+	defer func() {
+		spiceConsoles.Delete(ticket.ID)
+		// Ending the session also closes the other channels
+		sessionMgr.EndSession(sessionID, endReason)
+		audit.LogConsoleSessionEnd(r.Context(), ticket.UserID, sessionID, vmRec.UUID, endReason)
+	}()
+
+	sess, ok := sessionMgr.GetSession(sessionID)
+	if !ok {
+		endReason = "error"
+		fail("SESSION_NOT_FOUND")
+		return
+	}
+
+	conn, err := dialConsoleServer(console.addr)
+	if err != nil {
+		logger.Log.Error("Failed to connect to SPICE server",
+			zap.Error(err),
+			zap.String("address", console.addr),
+			zap.String("vm_name", vmRec.Name))
+		endReason = "error"
+		fail("SPICE_CONNECTION_FAILED")
+		return
+	}
+	defer conn.Close()
+
+	logger.Log.Info("SPICE console session started",
+		zap.String("session_id", sessionID),
+		zap.String("vm_uuid", vmRec.UUID),
+		zap.String("address", console.addr),
+		zap.Uint("user_id", ticket.UserID))
+
+	err = consoleTCPBridge(sess.Context(), ws, conn, func() {
+		if err := sessionMgr.UpdateActivity(sessionID); err != nil {
+			logger.Log.Warn("Failed to update session activity", zap.Error(err))
+		}
+	})
+
+	switch {
+	case stderrors.Is(context.Cause(sess.Context()), session.ErrSessionTerminated):
+		endReason = "admin_terminated"
+		ws.Close(websocket.StatusPolicyViolation, "SESSION_TERMINATED")
+	case sess.Context().Err() != nil:
+		// Session manager ended the session (idle timeout or max duration)
+		endReason = "session_expired"
+		ws.Close(websocket.StatusPolicyViolation, "SESSION_EXPIRED")
+	case err == io.EOF:
+		endReason = "vm_disconnect"
+		ws.Close(websocket.StatusNormalClosure, "SPICE server closed the connection")
+	}
+}
+
+// serveSPICEChannel bridges an additional SPICE channel of a live console. Channels
+// share the console's session: their traffic counts as activity and they close with it.
+func (h *Handler) serveSPICEChannel(w http.ResponseWriter, r *http.Request, console *spiceConsole, sess *session.ActiveSession) {
+	ws, err := h.acceptWebSocket(w, r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("WebSocket accept failed: %v", err), http.StatusBadRequest)
+		return
+	}
+	defer ws.Close(websocket.StatusNormalClosure, "")
+
+	conn, err := dialConsoleServer(console.addr)
+	if err != nil {
+		logger.Log.Warn("Failed to connect SPICE channel",
+			zap.Error(err),
+			zap.String("session_id", sess.SessionID),
+			zap.String("address", console.addr))
+		ws.Close(websocket.StatusPolicyViolation, "SPICE_CONNECTION_FAILED")
+		return
+	}
+	defer conn.Close()
+
+	logger.Log.Debug("SPICE channel connected", zap.String("session_id", sess.SessionID))
+	sessionMgr := session.GetSessionManager()
+	consoleTCPBridge(sess.Context(), ws, conn, func() {
+		sessionMgr.UpdateActivity(sess.SessionID)
+	})
+
+	if stderrors.Is(context.Cause(sess.Context()), session.ErrSessionTerminated) {
+		ws.Close(websocket.StatusPolicyViolation, "SESSION_TERMINATED")
+	}
+}
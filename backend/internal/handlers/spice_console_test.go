@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DARC0625/LIMEN/backend/internal/auth"
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"github.com/DARC0625/LIMEN/backend/internal/session"
+	"nhooyr.io/websocket"
+)
+
+func TestHandleVMConsole_SPICEProtocol(t *testing.T) {
+	h := setupTestImageHandler(t)
+	h.DB.Create(&models.User{Username: "alice", Password: "x", Role: models.RoleUser, Approved: true})
+	vmRec := models.VM{Name: "spice-vm", CPU: 1, Memory: 1024, OwnerID: 1}
+	h.DB.Create(&vmRec)
+
+	w := httptest.NewRecorder()
+	h.HandleVMConsole(w, imageRequest(http.MethodGet, "/api/vms/"+vmRec.UUID+"/console?protocol=spice", nil, 1, "user",
+		map[string]string{"uuid": vmRec.UUID}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	var resp map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp["protocol"] != "spice" || !strings.Contains(resp["ws_url"].(string), "/ws/spice/"+vmRec.UUID+"?token=") {
+		t.Errorf("response = %v, want a /ws/spice/ URL", resp)
+	}
+}
+
+// TestHandleSPICE_Channels checks that further channels reuse the ticket of an open console
+// and are bridged to its SPICE server.
+func TestHandleSPICE_Channels(t *testing.T) {
+	h := setupTestImageHandler(t)
+	h.Config.AllowedOrigins = []string{consoleTestOrigin}
+	h.DB.Create(&models.User{Username: "alice", Password: "x", Role: models.RoleUser, Approved: true})
+	vmUUID := "12345678-1234-1234-1234-123456789abc"
+
+	// Echo server standing in for the VM's SPICE server
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(conn, conn)
+		}
+	}()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.RemoteAddr = "10.0.0.1:4000"
+		h.HandleSPICE(w, r)
+	}))
+	defer srv.Close()
+
+	sessionMgr := session.GetSessionManager()
+	sessionID, err := sessionMgr.CreateSession(1, 1, vmUUID, "spice", "10.0.0.1", "test")
+	if err != nil {
+		t.Fatalf("CreateSession() error = %v", err)
+	}
+	defer sessionMgr.EndSession(sessionID, "user_disconnect")
+
+	// The main channel redeemed this ticket and opened the console
+	ticket, _, _ := h.ConsoleTickets.Issue(auth.Claims{UserID: 1, Approved: true, BetaAccess: true}, vmUUID, "10.0.0.1")
+	claims, err := h.ConsoleTickets.Redeem(ticket, vmUUID, "10.0.0.1")
+	if err != nil {
+		t.Fatalf("Redeem() error = %v", err)
+	}
+	console := &spiceConsole{sessionID: sessionID, addr: ln.Addr().String()}
+	spiceConsoles.Store(claims.ID, console)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws/spice/" + vmUUID + "?token=" + url.QueryEscape(ticket)
+	dial := func() *websocket.Conn {
+		conn, _, err := websocket.Dial(ctx, wsURL, &websocket.DialOptions{
+			HTTPHeader: http.Header{"Origin": []string{consoleTestOrigin}},
+		})
+		if err != nil {
+			t.Fatalf("Dial() error = %v", err)
+		}
+		return conn
+	}
+
+	display := dial()
+	defer display.Close(websocket.StatusNormalClosure, "")
+	display.Write(ctx, websocket.MessageBinary, []byte("REDQ"))
+	if typ, data, err := display.Read(ctx); err != nil || typ != websocket.MessageBinary || string(data) != "REDQ" {
+		t.Fatalf("channel read = %v %q %v, want echoed binary", typ, data, err)
+	}
+
+	// The ticket opens a limited number of channels
+	console.channels.Store(maxSPICEChannels)
+	extra := dial()
+	defer extra.Close(websocket.StatusNormalClosure, "")
+	if err := readUntilClose(ctx, extra); websocket.CloseStatus(err) != websocket.StatusPolicyViolation {
+		t.Errorf("channel past the limit: read error = %v, want policy violation", err)
+	}
+	console.channels.Store(0)
+
+	// Once the console is closed, the ticket is just a replayed ticket
+	spiceConsoles.Delete(claims.ID)
+	conn := dial()
+	defer conn.Close(websocket.StatusNormalClosure, "")
+	if err := readUntilClose(ctx, conn); websocket.CloseStatus(err) != websocket.StatusPolicyViolation {
+		t.Errorf("channel after close: read error = %v, want policy violation", err)
+	}
+
+	// Terminating the session closes open channels with the reason
+	sessionMgr.TerminateSession(sessionID)
+	var closeErr websocket.CloseError
+	if err := readUntilClose(ctx, display); !stderrors.As(err, &closeErr) || closeErr.Reason != "SESSION_TERMINATED" {
+		t.Errorf("channel close after termination = %v, want SESSION_TERMINATED", err)
+	}
+}
+
+// readUntilClose reads and discards messages until the connection fails.
+func readUntilClose(ctx context.Context, conn *websocket.Conn) error {
+	for {
+		if _, _, err := conn.Read(ctx); err != nil {
+			return err
+		}
+	}
+}
@@ -42,7 +42,7 @@ type UserWithStats struct {
 type CreateUserRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
-	Role     string `json:"role"` // "admin" or "user"
+	Role     string `json:"role"` // Built-in (admin, user, operator, auditor) or custom role
 }
 
 // UpdateUserRequest represents a request to update a user
@@ -54,7 +54,7 @@ type UpdateUserRequest struct {
 
 // UpdateUserRoleRequest represents a request to update user role
 type UpdateUserRoleRequest struct {
-	Role string `json:"role"` // "admin" or "user"
+	Role string `json:"role"` // Built-in (admin, user, operator, auditor) or custom role
 }
 
 // HandleListUsers handles GET /api/admin/users - List all users
@@ -137,9 +137,22 @@ func (h *Handler) HandleGetUser(w http.ResponseWriter, r *http.Request, cfg *con
 	var vms []models.VM
 	h.DB.Select("id", "uuid", "name", "status", "cpu", "memory", "owner_id", "created_at", "updated_at").Where("owner_id = ?", user.ID).Find(&vms)
 
+	// Lockout after failed logins
+	lockedUntil, err := h.LoginGuard.AccountLock(user.ID)
+	if err != nil {
+		logger.Log.Warn("Failed to check account lockout", zap.Uint("user_id", user.ID), zap.Error(err))
+	}
+	mfaMethods, _, err := h.MFA.LoginMethods(user.ID, string(user.Role))
+	if err != nil {
+		logger.Log.Warn("Failed to check MFA", zap.Uint("user_id", user.ID), zap.Error(err))
+	}
+
 	response := struct {
 		UserResponse
-		VMs []models.VM `json:"vms"`
+		LockedUntil *time.Time  `json:"locked_until,omitempty"`
+		MFAEnabled  bool        `json:"mfa_enabled"`
+		MFAMethods  []string    `json:"mfa_methods"`
+		VMs         []models.VM `json:"vms"`
 	}{
 		UserResponse: UserResponse{
 			ID:         user.ID,
@@ -151,7 +164,10 @@ func (h *Handler) HandleGetUser(w http.ResponseWriter, r *http.Request, cfg *con
 			CreatedAt:  user.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
 			UpdatedAt:  user.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
 		},
-		VMs: vms,
+		LockedUntil: lockedUntil,
+		MFAEnabled:  len(mfaMethods) > 0,
+		MFAMethods:  append([]string{}, mfaMethods...),
+		VMs:         vms,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -180,8 +196,8 @@ func (h *Handler) HandleCreateUser(w http.ResponseWriter, r *http.Request, cfg *
 	role := models.UserRole(req.Role)
 	if req.Role == "" {
 		role = models.RoleUser // Default to user
-	} else if !role.IsValid() {
-		errors.WriteBadRequest(w, "Invalid role. Must be 'admin' or 'user'", nil)
+	} else if !h.Roles.Exists(req.Role) {
+		errors.WriteBadRequest(w, "Invalid role: not a built-in or custom role", nil)
 		return
 	}
 
@@ -274,6 +290,9 @@ func (h *Handler) HandleUpdateUser(w http.ResponseWriter, r *http.Request, cfg *
 		user.Username = req.Username
 	}
 
+	// Sessions carry the role in their tokens: revoke them when it or the password changes
+	revoke := false
+
 	// Update password if provided
 	if req.Password != "" {
 		if len(req.Password) < 6 {
@@ -287,15 +306,17 @@ func (h *Handler) HandleUpdateUser(w http.ResponseWriter, r *http.Request, cfg *
 			return
 		}
 		user.Password = hashedPassword
+		revoke = true
 	}
 
 	// Update role if provided
 	if req.Role != "" {
 		role := models.UserRole(req.Role)
-		if !role.IsValid() {
-			errors.WriteBadRequest(w, "Invalid role. Must be 'admin' or 'user'", nil)
+		if !h.Roles.Exists(req.Role) {
+			errors.WriteBadRequest(w, "Invalid role: not a built-in or custom role", nil)
 			return
 		}
+		revoke = revoke || user.Role != role
 		user.Role = role
 	}
 
@@ -304,6 +325,9 @@ func (h *Handler) HandleUpdateUser(w http.ResponseWriter, r *http.Request, cfg *
 		errors.WriteInternalError(w, err, false)
 		return
 	}
+	if revoke {
+		revokeUserSessions(r, user.ID, "user_updated")
+	}
 
 	logger.Log.Info("User updated by admin", zap.Uint("user_id", user.ID), zap.String("username", user.Username))
 
@@ -355,6 +379,7 @@ func (h *Handler) HandleDeleteUser(w http.ResponseWriter, r *http.Request, cfg *
 		return
 	}
 
+	revokeUserSessions(r, user.ID, "user_deleted")
 	logger.Log.Info("User deleted by admin", zap.Uint("user_id", user.ID), zap.String("username", user.Username))
 
 	// Return JSON to satisfy frontend parsing
@@ -385,8 +410,8 @@ func (h *Handler) HandleUpdateUserRole(w http.ResponseWriter, r *http.Request, c
 	}
 
 	role := models.UserRole(req.Role)
-	if !role.IsValid() {
-		errors.WriteBadRequest(w, "Invalid role. Must be 'admin' or 'user'", nil)
+	if !h.Roles.Exists(req.Role) {
+		errors.WriteBadRequest(w, "Invalid role: not a built-in or custom role", nil)
 		return
 	}
 
@@ -401,12 +426,16 @@ func (h *Handler) HandleUpdateUserRole(w http.ResponseWriter, r *http.Request, c
 		return
 	}
 
+	oldRole := user.Role
 	user.Role = role
 	if err := h.DB.Save(&user).Error; err != nil {
 		logger.Log.Error("Failed to update user role", zap.Error(err))
 		errors.WriteInternalError(w, err, false)
 		return
 	}
+	if oldRole != role {
+		revokeUserSessions(r, user.ID, "role_changed")
+	}
 
 	logger.Log.Info("User role updated by admin", zap.Uint("user_id", user.ID), zap.String("username", user.Username), zap.String("new_role", string(role)))
 
@@ -444,12 +473,17 @@ func (h *Handler) HandleApproveUser(w http.ResponseWriter, r *http.Request, cfg
 		return
 	}
 
+	wasApproved := user.Approved
 	user.Approved = true
 	if err := h.DB.Save(&user).Error; err != nil {
 		logger.Log.Error("Failed to approve user", zap.Error(err))
 		errors.WriteInternalError(w, err, false)
 		return
 	}
+	if !wasApproved {
+		// Sessions from before the approval carry unapproved tokens
+		revokeUserSessions(r, user.ID, "approval_changed")
+	}
 
 	logger.Log.Info("User approved by admin", zap.Uint("user_id", user.ID), zap.String("username", user.Username))
 
@@ -516,7 +550,7 @@ func (h *Handler) HandleBetaAccess(w http.ResponseWriter, r *http.Request, cfg *
 	}
 
 	// Admin users always have beta access, cannot be changed
-	if user.Role == models.RoleAdmin {
+	if h.Roles.HasPermission(string(user.Role), models.PermManageSystem) {
 		errors.WriteBadRequest(w, "Admin users always have beta access", nil)
 		return
 	}
@@ -544,6 +578,9 @@ func (h *Handler) HandleBetaAccess(w http.ResponseWriter, r *http.Request, cfg *
 
 	// Audit log: beta access change
 	audit.LogBetaAccessGrant(r.Context(), adminID, user.ID, req.BetaAccess)
+	if oldBetaAccess != req.BetaAccess {
+		revokeUserSessions(r, user.ID, "beta_access_changed")
+	}
 
 	response := UserResponse{
 		ID:         user.ID,
@@ -558,3 +595,113 @@ func (h *Handler) HandleBetaAccess(w http.ResponseWriter, r *http.Request, cfg *
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
+
+// HandleRevokeUserSessions handles DELETE /api/admin/users/{id}/sessions - Revoke all sessions of a user
+// @Summary     Revoke a user's sessions
+// @Description Logs a user out everywhere (admin only). Refresh tokens stop working immediately; access tokens
+// @Description already issued expire within 15 minutes.
+// @Tags        Admin
+// @Produce     json
+// @Param       id path int true "User ID"
+// @Success     200  {object}  map[string]interface{}  "Number of sessions revoked"
+// @Failure     400  {object}  map[string]interface{}  "Invalid user ID"
+// @Failure     403  {object}  map[string]interface{}  "Forbidden - admin access required"
+// @Failure     404  {object}  map[string]interface{}  "User not found"
+// @Router      /admin/users/{id}/sessions [delete]
+func (h *Handler) HandleRevokeUserSessions(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	userID, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		errors.WriteBadRequest(w, "Invalid user ID", err)
+		return
+	}
+
+	var user models.User
+	if err := h.DB.First(&user, userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			errors.WriteNotFound(w, "User not found")
+		} else {
+			logger.Log.Error("Failed to fetch user", zap.Error(err))
+			errors.WriteInternalError(w, err, false)
+		}
+		return
+	}
+
+	count, err := auth.GetSessionStore().RevokeUserSessions(user.ID)
+	if err != nil {
+		logger.Log.Error("Failed to revoke user sessions", zap.Uint("user_id", user.ID), zap.Error(err))
+		errors.WriteInternalError(w, err, false)
+		return
+	}
+	logger.Log.Info("User sessions revoked by admin", zap.Uint("user_id", user.ID), zap.Int("count", count))
+	audit.LogSessionRevoke(r.Context(), user.ID, "", "admin", count)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"user_id": user.ID,
+		"revoked": count,
+	})
+}
+
+// HandleUnlockUser handles DELETE /api/admin/users/{id}/lockout - Unlock a user's account
+// @Summary     Unlock an account
+// @Description Clears a user's failed login attempts, lifting a lockout and login delays (admin only).
+// @Description Lockouts of the client IP addresses involved are kept.
+// @Tags        Admin
+// @Produce     json
+// @Param       id path int true "User ID"
+// @Success     200  {object}  map[string]interface{}  "Number of failed attempts cleared"
+// @Failure     400  {object}  map[string]interface{}  "Invalid user ID"
+// @Failure     403  {object}  map[string]interface{}  "Forbidden - admin access required"
+// @Failure     404  {object}  map[string]interface{}  "User not found"
+// @Router      /admin/users/{id}/lockout [delete]
+func (h *Handler) HandleUnlockUser(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	userID, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		errors.WriteBadRequest(w, "Invalid user ID", err)
+		return
+	}
+
+	var user models.User
+	if err := h.DB.First(&user, userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			errors.WriteNotFound(w, "User not found")
+		} else {
+			logger.Log.Error("Failed to fetch user", zap.Error(err))
+			errors.WriteInternalError(w, err, false)
+		}
+		return
+	}
+
+	wasLocked, _ := h.LoginGuard.AccountLock(user.ID)
+	cleared, err := h.LoginGuard.Unlock(user.ID)
+	if err != nil {
+		logger.Log.Error("Failed to unlock user", zap.Uint("user_id", user.ID), zap.Error(err))
+		errors.WriteInternalError(w, err, false)
+		return
+	}
+	logger.Log.Info("User unlocked by admin", zap.Uint("user_id", user.ID), zap.Int64("failed_attempts", cleared))
+	audit.LogAccountUnlock(r.Context(), user.ID, wasLocked != nil, cleared)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"user_id":         user.ID,
+		"was_locked":      wasLocked != nil,
+		"failed_attempts": cleared,
+	})
+}
+
+// revokeUserSessions logs a user out everywhere after an admin changed what their
+// tokens say about them. Failures are logged: the change itself succeeded.
+func revokeUserSessions(r *http.Request, userID uint, reason string) {
+	count, err := auth.GetSessionStore().RevokeUserSessions(userID)
+	if err != nil {
+		logger.Log.Error("Failed to revoke user sessions", zap.Uint("user_id", userID), zap.String("reason", reason), zap.Error(err))
+		return
+	}
+	if count > 0 {
+		logger.Log.Info("User sessions revoked", zap.Uint("user_id", userID), zap.String("reason", reason), zap.Int("count", count))
+		audit.LogSessionRevoke(r.Context(), userID, "", reason, count)
+	}
+}
@@ -292,6 +292,43 @@ func TestHandleVMDelete_Forbidden(t *testing.T) {
 	}
 }
 
+func TestHandleVMAction_OtherUsersVM(t *testing.T) {
+	h, _ := setupTestVMActionHandler(t)
+
+	owner := models.User{Username: "owner", Password: "hashedpassword", Role: models.RoleUser}
+	h.DB.Create(&owner)
+	vm := models.VM{Name: "test-vm", UUID: "test-uuid-123", CPU: 2, Memory: 1024, Status: models.VMStatusRunning, OwnerID: owner.ID}
+	h.DB.Create(&vm)
+
+	tests := []struct {
+		role, action string
+		want         int
+	}{
+		{"user", "stop", http.StatusForbidden},
+		{"auditor", "start", http.StatusForbidden},
+		{"operator", "delete", http.StatusForbidden},
+		{"operator", "update", http.StatusForbidden},
+		// Allowed, then failing without a VM service
+		{"operator", "stop", http.StatusInternalServerError},
+		{"admin", "stop", http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "/api/vms/test-uuid-123/action", bytes.NewBufferString(`{"action":"`+tt.action+`"}`))
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("uuid", vm.UUID)
+		ctx := context.WithValue(req.Context(), chi.RouteCtxKey, rctx)
+		ctx = context.WithValue(ctx, middleware.UserIDKey, owner.ID+1)
+		ctx = context.WithValue(ctx, middleware.RoleKey, tt.role)
+		w := httptest.NewRecorder()
+
+		h.HandleVMAction(w, req.WithContext(ctx))
+
+		if w.Code != tt.want {
+			t.Errorf("%s %s of another user's VM = %d, want %d", tt.role, tt.action, w.Code, tt.want)
+		}
+	}
+}
+
 func TestHandleListISOs_Success(t *testing.T) {
 	h, cfg := setupTestVMActionHandler(t)
 
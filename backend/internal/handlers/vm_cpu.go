@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/DARC0625/LIMEN/backend/internal/hardware"
+	"github.com/DARC0625/LIMEN/backend/internal/logger"
+	"github.com/DARC0625/LIMEN/backend/internal/middleware"
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"github.com/DARC0625/LIMEN/backend/internal/vm"
+	"go.uber.org/zap"
+)
+
+// CPU placement policies (config.CPUPlacementPolicy).
+const (
+	cpuPlacementAdmin = "admin"
+	cpuPlacementAll   = "all"
+	cpuPlacementNone  = "none"
+)
+
+// canPlaceCPUs reports whether the caller may request vCPU pinning or NUMA placement.
+func (h *Handler) canPlaceCPUs(ctx context.Context) bool {
+	switch h.Config.CPUPlacementPolicy {
+	case cpuPlacementAll:
+		return true
+	case cpuPlacementNone:
+		return false
+	default:
+		return middleware.IsAdmin(ctx)
+	}
+}
+
+// hostCPUInfo returns the CPU info of the VM host hostID (0 = the default host), or nil if
+// it is unknown.
+func (h *Handler) hostCPUInfo(hostID uint) *hardware.CPUInfo {
+	if h.VMService != nil {
+		return h.VMService.HostCPUInfo(hostID)
+	}
+	spec := hardware.GetCurrentSpec()
+	if spec == nil {
+		return nil
+	}
+	return &spec.CPU
+}
+
+// cpuConfigFromVM rebuilds the stored CPU configuration of a VM.
+func cpuConfigFromVM(v *models.VM) vm.CPUConfig {
+	cfg := vm.CPUConfig{
+		Model:    v.CPUModel,
+		Sockets:  v.CPUSockets,
+		Cores:    v.CPUCores,
+		Threads:  v.CPUThreads,
+		NUMANode: v.NUMANode,
+	}
+	if v.CPUPinning != "" {
+		if err := json.Unmarshal([]byte(v.CPUPinning), &cfg.Pinning); err != nil {
+			logger.Log.Warn("Ignoring invalid stored cpu pinning", zap.String("vm_uuid", v.UUID), zap.Error(err))
+		}
+	}
+	return cfg
+}
+
+// setVMCPUConfig stores cfg on the VM record.
+func setVMCPUConfig(v *models.VM, cfg vm.CPUConfig) {
+	v.CPUModel = cfg.Model
+	v.CPUSockets = cfg.Sockets
+	v.CPUCores = cfg.Cores
+	v.CPUThreads = cfg.Threads
+	v.NUMANode = cfg.NUMANode
+	v.CPUPinning = ""
+	if len(cfg.Pinning) > 0 {
+		data, _ := json.Marshal(cfg.Pinning)
+		v.CPUPinning = string(data)
+	}
+}
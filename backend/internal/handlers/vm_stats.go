@@ -46,9 +46,8 @@ func (h *Handler) HandleVMStats(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if user owns the VM (or is admin)
-	role, _ := middleware.GetRole(r.Context())
-	if vmRec.OwnerID != userID && role != string(models.RoleAdmin) {
+	// Check if user owns the VM (or may see every VM)
+	if vmRec.OwnerID != userID && !middleware.HasPermission(r.Context(), models.PermVMReadAll) {
 		errors.WriteForbidden(w, "Access denied")
 		return
 	}
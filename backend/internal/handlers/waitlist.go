@@ -10,6 +10,7 @@ import (
 	"github.com/DARC0625/LIMEN/backend/internal/config"
 	"github.com/DARC0625/LIMEN/backend/internal/errors"
 	"github.com/DARC0625/LIMEN/backend/internal/logger"
+	"github.com/DARC0625/LIMEN/backend/internal/middleware"
 	"github.com/DARC0625/LIMEN/backend/internal/models"
 	"github.com/DARC0625/LIMEN/backend/internal/ratelimit"
 	"github.com/DARC0625/LIMEN/backend/internal/validator"
@@ -48,7 +49,7 @@ func (h *Handler) HandleWaitlist(w http.ResponseWriter, r *http.Request, cfg *co
 	}
 
 	// Get client IP for rate limiting
-	clientIP := getClientIPFromRequest(r)
+	clientIP := h.clientIP(r)
 
 	// Rate limiting: 5 requests per 5 minutes per IP
 	rateLimiter := ratelimit.GetIPRateLimiter()
@@ -184,26 +185,12 @@ func maskEmail(email string) string {
 	return fmt.Sprintf("%s***@%s", local[:3], domain)
 }
 
-// getClientIPFromRequest extracts the client IP address from the request.
-func getClientIPFromRequest(r *http.Request) string {
-	// Check X-Forwarded-For header (from reverse proxy)
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		// Take the first IP in X-Forwarded-For chain
-		ips := strings.Split(xff, ",")
-		if len(ips) > 0 {
-			return strings.TrimSpace(ips[0])
-		}
+// clientIP returns the address of the client that sent r, believing forwarding headers
+// only from the configured trusted proxies.
+func (h *Handler) clientIP(r *http.Request) string {
+	var trusted []string
+	if h.Config != nil {
+		trusted = h.Config.TrustedProxies
 	}
-
-	// Check X-Real-IP header (from nginx/Envoy)
-	if xri := r.Header.Get("X-Real-IP"); xri != "" {
-		return strings.TrimSpace(xri)
-	}
-
-	// Fallback to RemoteAddr
-	host, _, found := strings.Cut(r.RemoteAddr, ":")
-	if found {
-		return host
-	}
-	return r.RemoteAddr
+	return middleware.ClientIP(r, trusted)
 }
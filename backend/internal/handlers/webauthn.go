@@ -0,0 +1,431 @@
+package handlers
+
+import (
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/DARC0625/LIMEN/backend/internal/audit"
+	"github.com/DARC0625/LIMEN/backend/internal/auth"
+	"github.com/DARC0625/LIMEN/backend/internal/config"
+	"github.com/DARC0625/LIMEN/backend/internal/errors"
+	"github.com/DARC0625/LIMEN/backend/internal/logger"
+	"github.com/DARC0625/LIMEN/backend/internal/metrics"
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"github.com/DARC0625/LIMEN/backend/internal/security"
+	"github.com/DARC0625/LIMEN/backend/internal/webauthn"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// WebAuthnCeremonyResponse starts a WebAuthn ceremony: pass options to
+// navigator.credentials.create() or get() (after PublicKeyCredential.parseCreationOptionsFromJSON
+// or parseRequestOptionsFromJSON), then send the result back with session.
+type WebAuthnCeremonyResponse struct {
+	Options   interface{} `json:"options"`
+	Session   string      `json:"session"`
+	ExpiresIn int         `json:"expires_in"` // Seconds left to complete the ceremony
+}
+
+// WebAuthnRegistrationRequest completes registering a credential.
+type WebAuthnRegistrationRequest struct {
+	Session    string                        `json:"session"`
+	Name       string                        `json:"name,omitempty"` // e.g. "YubiKey" (default "Passkey")
+	Credential *webauthn.AttestationResponse `json:"credential"`
+}
+
+// WebAuthnLoginRequest completes a passwordless login.
+type WebAuthnLoginRequest struct {
+	Session    string                      `json:"session"`
+	Credential *webauthn.AssertionResponse `json:"credential"`
+}
+
+// webAuthnUserHandle is the user handle stored by authenticators: the user's UUID,
+// which unlike their username never changes and reveals nothing.
+func webAuthnUserHandle(user *models.User) []byte {
+	if user.UUID != "" {
+		return []byte(user.UUID)
+	}
+	return []byte(strconv.FormatUint(uint64(user.ID), 10))
+}
+
+// webAuthnAvailable writes a 503 response unless a relying party is configured.
+func (h *Handler) webAuthnAvailable(w http.ResponseWriter) bool {
+	if h.WebAuthn == nil || !h.WebAuthn.Enabled() {
+		errors.WriteServiceUnavailable(w, "WebAuthn is not configured", nil, false)
+		return false
+	}
+	return true
+}
+
+// writeWebAuthnCeremony writes the options and session of a ceremony.
+func (h *Handler) writeWebAuthnCeremony(w http.ResponseWriter, options interface{}, session string) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(WebAuthnCeremonyResponse{
+		Options:   options,
+		Session:   session,
+		ExpiresIn: int(h.WebAuthn.Timeout().Seconds()),
+	})
+}
+
+// isWebAuthnRejection reports whether err means the client's response was rejected,
+// rather than the server failing.
+func isWebAuthnRejection(err error) bool {
+	return stderrors.Is(err, webauthn.ErrVerification) ||
+		stderrors.Is(err, webauthn.ErrInvalidSession) ||
+		stderrors.Is(err, webauthn.ErrCredentialNotFound)
+}
+
+// verifyWebAuthnFactor verifies an assertion of one of user's credentials as the second
+// factor of their login. Rejected assertions are reported as auth.ErrInvalidMFACode, so
+// checkMFACode counts them as failed logins.
+func (h *Handler) verifyWebAuthnFactor(user *models.User, session string, resp *webauthn.AssertionResponse) error {
+	cred, err := h.WebAuthn.FinishLogin(session, resp, webAuthnUserHandle(user))
+	if err == nil && cred.UserID != user.ID {
+		err = webauthn.ErrCredentialNotFound
+	}
+	if err != nil {
+		if isWebAuthnRejection(err) {
+			return fmt.Errorf("%w: %v", auth.ErrInvalidMFACode, err)
+		}
+		return err
+	}
+	logger.Log.Info("Second factor verified with WebAuthn", zap.Uint("user_id", user.ID), zap.Uint("credential_id", cred.ID))
+	return nil
+}
+
+// HandleBeginWebAuthnRegistration handles POST /api/auth/webauthn/register/begin - Start registering a passkey.
+// @Summary     Start registering a passkey
+// @Description Returns the options of navigator.credentials.create() for a new passkey or security key of the user,
+// @Description and the session to send to /auth/webauthn/register/finish with its result.
+// @Tags        Authentication
+// @Produce     json
+// @Success     200  {object}  WebAuthnCeremonyResponse
+// @Failure     401  {object}  map[string]interface{}  "Authentication required"
+// @Failure     503  {object}  map[string]interface{}  "WebAuthn is not configured"
+// @Security    BearerAuth
+// @Router      /auth/webauthn/register/begin [post]
+func (h *Handler) HandleBeginWebAuthnRegistration(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		errors.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+	if !h.webAuthnAvailable(w) {
+		return
+	}
+	user, ok := h.mfaUser(w, r)
+	if !ok {
+		return
+	}
+
+	options, session, err := h.WebAuthn.BeginRegistration(webauthn.User{
+		ID:     user.ID,
+		Handle: webAuthnUserHandle(user),
+		Name:   user.Username,
+	})
+	if err != nil {
+		logger.Log.Error("Failed to start WebAuthn registration", zap.Uint("user_id", user.ID), zap.Error(err))
+		errors.WriteInternalError(w, err, false)
+		return
+	}
+	h.writeWebAuthnCeremony(w, options, session)
+}
+
+// HandleFinishWebAuthnRegistration handles POST /api/auth/webauthn/register/finish - Register a passkey.
+// @Summary     Register a passkey
+// @Description Verifies the result of navigator.credentials.create() and stores the credential. It then logs the
+// @Description user in without a password, or completes their password logins as a second factor.
+// @Tags        Authentication
+// @Accept      json
+// @Produce     json
+// @Param       request body WebAuthnRegistrationRequest true "Session and credential"
+// @Success     201  {object}  models.WebAuthnCredential
+// @Failure     400  {object}  map[string]interface{}  "Invalid or rejected credential"
+// @Failure     401  {object}  map[string]interface{}  "Authentication required"
+// @Failure     409  {object}  map[string]interface{}  "Credential already registered"
+// @Failure     503  {object}  map[string]interface{}  "WebAuthn is not configured"
+// @Security    BearerAuth
+// @Router      /auth/webauthn/register/finish [post]
+func (h *Handler) HandleFinishWebAuthnRegistration(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		errors.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+	if !h.webAuthnAvailable(w) {
+		return
+	}
+	user, ok := h.mfaUser(w, r)
+	if !ok {
+		return
+	}
+	var req WebAuthnRegistrationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Credential == nil {
+		errors.WriteBadRequest(w, "Invalid request body", err)
+		return
+	}
+
+	cred, err := h.WebAuthn.FinishRegistration(user.ID, req.Session, req.Credential, req.Name)
+	switch {
+	case err == nil:
+	case stderrors.Is(err, webauthn.ErrCredentialExists):
+		errors.WriteError(w, http.StatusConflict, "Credential already registered", nil)
+		return
+	case isWebAuthnRejection(err):
+		logger.Log.Warn("WebAuthn registration rejected", zap.Uint("user_id", user.ID), zap.Error(err))
+		errors.WriteBadRequest(w, "Credential rejected", nil)
+		return
+	default:
+		logger.Log.Error("Failed to register WebAuthn credential", zap.Uint("user_id", user.ID), zap.Error(err))
+		errors.WriteInternalError(w, err, false)
+		return
+	}
+	logger.Log.Info("WebAuthn credential registered", zap.Uint("user_id", user.ID), zap.Uint("credential_id", cred.ID),
+		zap.String("aaguid", cred.AAGUID))
+	audit.LogWebAuthnCredentialChange(r.Context(), user.ID, cred.ID, "register", cred.Name)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(cred)
+}
+
+// HandleListWebAuthnCredentials handles GET /api/auth/webauthn/credentials - List the user's passkeys.
+// @Summary     List my passkeys
+// @Description The passkeys and security keys the user registered
+// @Tags        Authentication
+// @Produce     json
+// @Success     200  {array}   models.WebAuthnCredential
+// @Failure     401  {object}  map[string]interface{}  "Authentication required"
+// @Security    BearerAuth
+// @Router      /auth/webauthn/credentials [get]
+func (h *Handler) HandleListWebAuthnCredentials(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.mfaUser(w, r)
+	if !ok {
+		return
+	}
+	creds, err := h.WebAuthn.Credentials(user.ID)
+	if err != nil {
+		logger.Log.Error("Failed to list WebAuthn credentials", zap.Uint("user_id", user.ID), zap.Error(err))
+		errors.WriteInternalError(w, err, false)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(creds)
+}
+
+// HandleDeleteWebAuthnCredential handles DELETE /api/auth/webauthn/credentials/{id} - Remove a passkey.
+// @Summary     Remove a passkey
+// @Description Removes one of the user's passkeys or security keys. Refused for the last second factor of a user
+// @Description whose role requires MFA.
+// @Tags        Authentication
+// @Produce     json
+// @Param       id path int true "Credential ID"
+// @Success     200  {object}  map[string]interface{}  "Credential removed"
+// @Failure     400  {object}  map[string]interface{}  "Invalid credential ID"
+// @Failure     401  {object}  map[string]interface{}  "Authentication required"
+// @Failure     403  {object}  map[string]interface{}  "MFA is required for the user's role"
+// @Failure     404  {object}  map[string]interface{}  "Credential not found"
+// @Security    BearerAuth
+// @Router      /auth/webauthn/credentials/{id} [delete]
+func (h *Handler) HandleDeleteWebAuthnCredential(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.mfaUser(w, r)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		errors.WriteBadRequest(w, "Invalid credential ID", err)
+		return
+	}
+
+	methods, required, err := h.MFA.LoginMethods(user.ID, string(user.Role))
+	if err != nil {
+		logger.Log.Error("Failed to check MFA", zap.Uint("user_id", user.ID), zap.Error(err))
+		errors.WriteInternalError(w, err, false)
+		return
+	}
+	if required && len(methods) == 1 && methods[0] == auth.MFAMethodWebAuthn {
+		creds, err := h.WebAuthn.Credentials(user.ID)
+		if err != nil {
+			logger.Log.Error("Failed to list WebAuthn credentials", zap.Uint("user_id", user.ID), zap.Error(err))
+			errors.WriteInternalError(w, err, false)
+			return
+		}
+		if len(creds) == 1 && creds[0].ID == uint(id) {
+			errors.WriteForbidden(w, "MFA is required for your role: enable another second factor first")
+			return
+		}
+	}
+
+	if err := h.WebAuthn.DeleteCredential(user.ID, uint(id)); err != nil {
+		if stderrors.Is(err, webauthn.ErrCredentialNotFound) {
+			errors.WriteNotFound(w, "Credential not found")
+			return
+		}
+		logger.Log.Error("Failed to remove WebAuthn credential", zap.Uint("user_id", user.ID), zap.Error(err))
+		errors.WriteInternalError(w, err, false)
+		return
+	}
+	logger.Log.Info("WebAuthn credential removed", zap.Uint("user_id", user.ID), zap.Uint64("credential_id", id))
+	audit.LogWebAuthnCredentialChange(r.Context(), user.ID, uint(id), "delete", "")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Credential removed",
+	})
+}
+
+// HandleBeginWebAuthnLogin handles POST /api/auth/login/webauthn/begin - Start a passwordless login.
+// @Summary     Start a passwordless login
+// @Description Returns the options of navigator.credentials.get() for any passkey registered with LIMEN, and the
+// @Description session to send to /auth/login/webauthn/finish with its result.
+// @Tags        Authentication
+// @Produce     json
+// @Success     200  {object}  WebAuthnCeremonyResponse
+// @Failure     503  {object}  map[string]interface{}  "WebAuthn is not configured"
+// @Router      /auth/login/webauthn/begin [post]
+func (h *Handler) HandleBeginWebAuthnLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		errors.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+	if !h.webAuthnAvailable(w) {
+		return
+	}
+	options, session, err := h.WebAuthn.BeginLogin(0)
+	if err != nil {
+		logger.Log.Error("Failed to start WebAuthn login", zap.Error(err))
+		errors.WriteInternalError(w, err, false)
+		return
+	}
+	h.writeWebAuthnCeremony(w, options, session)
+}
+
+// HandleFinishWebAuthnLogin handles POST /api/auth/login/webauthn/finish - Log in with a passkey.
+// @Summary     Log in with a passkey
+// @Description Verifies the result of navigator.credentials.get() and returns tokens, like /auth/login. The
+// @Description authenticator must verify the user (PIN or biometrics), so no other factor is needed. Rejected
+// @Description assertions count as failed logins.
+// @Tags        Authentication
+// @Accept      json
+// @Produce     json
+// @Param       request body WebAuthnLoginRequest true "Session and assertion"
+// @Success     200  {object}  LoginResponse  "Login successful"
+// @Failure     400  {object}  map[string]interface{}  "Invalid request"
+// @Failure     401  {object}  map[string]interface{}  "Invalid credentials"
+// @Failure     403  {object}  map[string]interface{}  "Account locked or not approved"
+// @Failure     429  {object}  map[string]interface{}  "Too many failed attempts"
+// @Failure     503  {object}  map[string]interface{}  "WebAuthn is not configured"
+// @Router      /auth/login/webauthn/finish [post]
+func (h *Handler) HandleFinishWebAuthnLogin(w http.ResponseWriter, r *http.Request, cfg *config.Config) {
+	if r.Method != "POST" {
+		errors.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+	if !h.webAuthnAvailable(w) {
+		return
+	}
+	var req WebAuthnLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Credential == nil {
+		errors.WriteBadRequest(w, "Invalid request body", err)
+		return
+	}
+
+	clientIP := h.clientIP(r)
+	cred, err := h.WebAuthn.FindCredential(req.Credential)
+	if err != nil {
+		if !stderrors.Is(err, webauthn.ErrCredentialNotFound) {
+			logger.Log.Error("Failed to find WebAuthn credential", zap.Error(err))
+			errors.WriteInternalError(w, err, false)
+			return
+		}
+		h.LoginGuard.RecordFailure(r.Context(), 0, "", clientIP)
+		metrics.AuthFailureTotal.WithLabelValues("invalid_webauthn").Inc()
+		errors.WriteUnauthorized(w, "Invalid credentials")
+		return
+	}
+	var user models.User
+	if err := h.DB.First(&user, cred.UserID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			errors.WriteUnauthorized(w, "Invalid credentials")
+		} else {
+			logger.Log.Error("Failed to fetch user", zap.Error(err))
+			errors.WriteInternalError(w, err, false)
+		}
+		return
+	}
+	decision, done := h.LoginGuard.Begin(user.ID, user.Username, clientIP)
+	defer done()
+	if !decision.Allowed() {
+		writeLoginBlocked(w, decision, user.ID, clientIP)
+		return
+	}
+
+	if _, err := h.WebAuthn.FinishLogin(req.Session, req.Credential, webAuthnUserHandle(&user)); err != nil {
+		if !isWebAuthnRejection(err) {
+			logger.Log.Error("Failed to verify WebAuthn login", zap.Uint("user_id", user.ID), zap.Error(err))
+			errors.WriteInternalError(w, err, false)
+			return
+		}
+		h.LoginGuard.RecordFailure(r.Context(), user.ID, user.Username, clientIP)
+		security.AuditUserAction(r.Context(), user.ID, "login_failed", "authentication", false, map[string]interface{}{
+			"ip":         r.RemoteAddr,
+			"user_agent": r.UserAgent(),
+			"method":     "webauthn",
+		})
+		logger.Log.Warn("WebAuthn login rejected", zap.Uint("user_id", user.ID), zap.Error(err))
+		audit.LogLogin(r.Context(), user.ID, user.Username, string(user.Role), false, "Invalid WebAuthn assertion")
+		metrics.AuthFailureTotal.WithLabelValues("invalid_webauthn").Inc()
+		errors.WriteUnauthorized(w, "Invalid credentials")
+		return
+	}
+
+	h.completeLogin(w, r, cfg, &user, nil)
+}
+
+// HandleBeginMFAWebAuthn handles POST /api/auth/login/mfa/webauthn - Use a passkey as the second factor of a login.
+// @Summary     Start a passkey second factor
+// @Description Returns the options of navigator.credentials.get() for the passkeys of a user logging in whose
+// @Description MFAChallengeResponse lists webauthn, and the session to send to /auth/login/mfa with its result.
+// @Tags        Authentication
+// @Accept      json
+// @Produce     json
+// @Param       request body MFALoginRequest true "MFA token"
+// @Success     200  {object}  WebAuthnCeremonyResponse
+// @Failure     400  {object}  map[string]interface{}  "The user has no passkey"
+// @Failure     401  {object}  map[string]interface{}  "Invalid or expired MFA token"
+// @Failure     503  {object}  map[string]interface{}  "WebAuthn is not configured"
+// @Router      /auth/login/mfa/webauthn [post]
+func (h *Handler) HandleBeginMFAWebAuthn(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		errors.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+	if !h.webAuthnAvailable(w) {
+		return
+	}
+	var req MFALoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errors.WriteBadRequest(w, "Invalid request body", err)
+		return
+	}
+	_, user, ok := h.challengeUser(w, req.MFAToken)
+	if !ok {
+		return
+	}
+
+	options, session, err := h.WebAuthn.BeginLogin(user.ID)
+	if err != nil {
+		if stderrors.Is(err, webauthn.ErrCredentialNotFound) {
+			errors.WriteBadRequest(w, "No passkey is registered", nil)
+			return
+		}
+		logger.Log.Error("Failed to start WebAuthn second factor", zap.Uint("user_id", user.ID), zap.Error(err))
+		errors.WriteInternalError(w, err, false)
+		return
+	}
+	h.writeWebAuthnCeremony(w, options, session)
+}
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DARC0625/LIMEN/backend/internal/auth"
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"github.com/DARC0625/LIMEN/backend/internal/webauthn"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testPasskey is a software ES256 authenticator for limen.example.
+type testPasskey struct {
+	key    *ecdsa.PrivateKey
+	id     []byte
+	handle []byte
+	count  uint32
+}
+
+var b64 = base64.RawURLEncoding
+
+func (p *testPasskey) authData(attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte("limen.example"))
+	flags := byte(0x05) // User present and verified
+	if attested {
+		flags |= 0x40
+	}
+	data := binary.BigEndian.AppendUint32(append(rpIDHash[:], flags), p.count)
+	if !attested {
+		return data
+	}
+	data = append(data, make([]byte, 16)...)
+	data = binary.BigEndian.AppendUint16(data, uint16(len(p.id)))
+	data = append(data, p.id...)
+	// COSE_Key {1: 2, 3: -7, -1: 1, -2: x, -3: y}
+	data = append(data, 0xa5, 0x01, 0x02, 0x03, 0x26, 0x20, 0x01, 0x21, 0x58, 0x20)
+	data = append(data, p.key.PublicKey.X.FillBytes(make([]byte, 32))...)
+	data = append(data, 0x22, 0x58, 0x20)
+	return append(data, p.key.PublicKey.Y.FillBytes(make([]byte, 32))...)
+}
+
+func (p *testPasskey) clientData(typ, challenge string) []byte {
+	raw, _ := json.Marshal(map[string]string{"type": typ, "challenge": challenge, "origin": "https://limen.example"})
+	return raw
+}
+
+func (p *testPasskey) create(challenge string) *webauthn.AttestationResponse {
+	authData := p.authData(true)
+	// {"fmt": "none", "attStmt": {}, "authData": authData}
+	att := append([]byte{0xa3, 0x63}, "fmt"...)
+	att = append(append(att, 0x64), "none"...)
+	att = append(append(att, 0x67), "attStmt"...)
+	att = append(append(att, 0xa0, 0x68), "authData"...)
+	att = append(binary.BigEndian.AppendUint16(append(att, 0x59), uint16(len(authData))), authData...)
+
+	resp := &webauthn.AttestationResponse{ID: b64.EncodeToString(p.id), RawID: b64.EncodeToString(p.id), Type: "public-key"}
+	resp.Response.ClientDataJSON = b64.EncodeToString(p.clientData("webauthn.create", challenge))
+	resp.Response.AttestationObject = b64.EncodeToString(att)
+	return resp
+}
+
+func (p *testPasskey) get(t *testing.T, challenge string) *webauthn.AssertionResponse {
+	p.count++
+	clientData := p.clientData("webauthn.get", challenge)
+	authData := p.authData(false)
+	hash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), hash[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, p.key, digest[:])
+	if err != nil {
+		t.Fatalf("SignASN1() error = %v", err)
+	}
+	resp := &webauthn.AssertionResponse{ID: b64.EncodeToString(p.id), RawID: b64.EncodeToString(p.id), Type: "public-key"}
+	resp.Response.ClientDataJSON = b64.EncodeToString(clientData)
+	resp.Response.AuthenticatorData = b64.EncodeToString(authData)
+	resp.Response.Signature = b64.EncodeToString(sig)
+	resp.Response.UserHandle = b64.EncodeToString(p.handle)
+	return resp
+}
+
+// ceremony decodes a WebAuthnCeremonyResponse and returns its challenge and session.
+func ceremony(t *testing.T, w *httptest.ResponseRecorder) (string, string) {
+	var resp struct {
+		Options struct {
+			Challenge string `json:"challenge"`
+		} `json:"options"`
+		Session string `json:"session"`
+	}
+	if w.Code != http.StatusOK || json.NewDecoder(w.Body).Decode(&resp) != nil || resp.Session == "" {
+		t.Fatalf("ceremony = %d: %s", w.Code, w.Body.String())
+	}
+	return resp.Options.Challenge, resp.Session
+}
+
+func TestHandleWebAuthn_RegisterAndLogin(t *testing.T) {
+	h := setupTestImageHandler(t)
+	if err := h.DB.AutoMigrate(&models.LoginFailure{}, &models.AuthSession{}, &models.AuthRefreshToken{}); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+	auth.SetSessionStore(auth.NewDBSessionStore(h.DB))
+	t.Cleanup(func() { auth.SetSessionStore(auth.NewSessionStore()) })
+	h.Config.JWTSecret = "test-secret"
+	h.WebAuthn = webauthn.NewManager(h.DB, webauthn.Config{RPID: "limen.example", Origins: []string{"https://limen.example"}}, "test-secret")
+	hashed, _ := bcrypt.GenerateFromPassword([]byte("correct-password"), bcrypt.MinCost)
+	user := models.User{Username: "alice", Password: string(hashed), Role: models.RoleAdmin, Approved: true}
+	h.DB.Create(&user)
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	passkey := &testPasskey{key: key, id: []byte("passkey-credential-1"), handle: []byte(user.UUID)}
+
+	w := httptest.NewRecorder()
+	h.HandleBeginWebAuthnRegistration(w, imageRequest("POST", "/api/auth/webauthn/register/begin", nil, user.ID, "admin", nil))
+	challenge, session := ceremony(t, w)
+	body, _ := json.Marshal(WebAuthnRegistrationRequest{Session: session, Name: "Laptop", Credential: passkey.create(challenge)})
+	w = httptest.NewRecorder()
+	h.HandleFinishWebAuthnRegistration(w, imageRequest("POST", "/api/auth/webauthn/register/finish", body, user.ID, "admin", nil))
+	var cred models.WebAuthnCredential
+	json.NewDecoder(w.Body).Decode(&cred)
+	if w.Code != http.StatusCreated || cred.Name != "Laptop" {
+		t.Fatalf("register = %d %+v", w.Code, cred)
+	}
+
+	post := func(handler func(http.ResponseWriter, *http.Request), body interface{}) *httptest.ResponseRecorder {
+		raw, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("POST", "/api/auth/login", bytes.NewReader(raw)))
+		return w
+	}
+
+	// Second factor of a password login
+	w = post(func(w http.ResponseWriter, r *http.Request) { h.HandleLogin(w, r, h.Config) },
+		LoginRequest{Username: "alice", Password: "correct-password"})
+	var challengeResp MFAChallengeResponse
+	json.NewDecoder(w.Body).Decode(&challengeResp)
+	if !challengeResp.MFARequired || len(challengeResp.MFAMethods) != 1 || challengeResp.MFAMethods[0] != auth.MFAMethodWebAuthn {
+		t.Fatalf("password login = %+v, want a webauthn challenge", challengeResp)
+	}
+	challenge, session = ceremony(t, post(h.HandleBeginMFAWebAuthn, MFALoginRequest{MFAToken: challengeResp.MFAToken}))
+	w = post(func(w http.ResponseWriter, r *http.Request) { h.HandleLoginMFA(w, r, h.Config) },
+		MFALoginRequest{MFAToken: challengeResp.MFAToken, WebAuthnSession: session, WebAuthn: passkey.get(t, challenge)})
+	if w.Code != http.StatusOK || !bytes.Contains(w.Body.Bytes(), []byte(`"access_token"`)) {
+		t.Fatalf("second factor login = %d: %s", w.Code, w.Body.String())
+	}
+
+	// Passwordless login; a replayed assertion counts as a failed login
+	finish := func(w http.ResponseWriter, r *http.Request) { h.HandleFinishWebAuthnLogin(w, r, h.Config) }
+	challenge, session = ceremony(t, post(h.HandleBeginWebAuthnLogin, nil))
+	assertion := passkey.get(t, challenge)
+	if w := post(finish, WebAuthnLoginRequest{Session: session, Credential: assertion}); w.Code != http.StatusOK ||
+		!bytes.Contains(w.Body.Bytes(), []byte(`"access_token"`)) {
+		t.Fatalf("passwordless login = %d: %s", w.Code, w.Body.String())
+	}
+	_, session = ceremony(t, post(h.HandleBeginWebAuthnLogin, nil))
+	if w := post(finish, WebAuthnLoginRequest{Session: session, Credential: assertion}); w.Code != http.StatusUnauthorized {
+		t.Errorf("replayed assertion = %d, want 401", w.Code)
+	}
+	var failures int64
+	h.DB.Model(&models.LoginFailure{}).Where("user_id = ?", user.ID).Count(&failures)
+	if failures != 1 {
+		t.Errorf("failed attempts after a replayed assertion = %d, want 1", failures)
+	}
+
+	// The last second factor of a role requiring MFA can't be removed
+	h.MFA.SetRoleRequired("admin", true)
+	params := map[string]string{"id": "1"}
+	w = httptest.NewRecorder()
+	h.HandleDeleteWebAuthnCredential(w, imageRequest("DELETE", "/api/auth/webauthn/credentials/1", nil, user.ID, "admin", params))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("delete last factor = %d, want 403", w.Code)
+	}
+	h.MFA.SetRoleRequired("admin", false)
+	w = httptest.NewRecorder()
+	h.HandleDeleteWebAuthnCredential(w, imageRequest("DELETE", "/api/auth/webauthn/credentials/1", nil, user.ID, "admin", params))
+	if w.Code != http.StatusOK {
+		t.Errorf("delete = %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestHandleWebAuthn_NotConfigured(t *testing.T) {
+	h := setupTestImageHandler(t)
+	w := httptest.NewRecorder()
+	h.HandleBeginWebAuthnLogin(w, httptest.NewRequest("POST", "/api/auth/login/webauthn/begin", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("begin login without an RP ID = %d, want 503", w.Code)
+	}
+}
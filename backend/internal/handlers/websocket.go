@@ -15,6 +15,7 @@ import (
 	"github.com/DARC0625/LIMEN/backend/internal/logger"
 	"github.com/DARC0625/LIMEN/backend/internal/models"
 	"github.com/DARC0625/LIMEN/backend/internal/utils"
+	"github.com/DARC0625/LIMEN/backend/internal/vm"
 	"go.uber.org/zap"
 	"nhooyr.io/websocket"
 )
@@ -166,6 +167,26 @@ func (b *VMStatusBroadcaster) BroadcastVMList(vms []models.VM) {
 	}
 }
 
+// BroadcastMigrationProgress broadcasts the progress of a VM migration to all connected clients
+func (b *VMStatusBroadcaster) BroadcastMigrationProgress(vmRec models.VM, progress vm.MigrationProgress) {
+	message, err := json.Marshal(map[string]interface{}{
+		"type":      "vm_migration",
+		"vm_uuid":   vmRec.UUID,
+		"vm_name":   vmRec.Name,
+		"migration": progress,
+	})
+	if err != nil {
+		logger.Log.Error("Failed to marshal migration progress", zap.Error(err))
+		return
+	}
+
+	select {
+	case b.broadcast <- message:
+	default:
+		logger.Log.Warn("Broadcast channel full, dropping message")
+	}
+}
+
 // HandleVMStatusWebSocket handles WebSocket connections for VM status updates
 func (h *Handler) HandleVMStatusWebSocket(w http.ResponseWriter, r *http.Request, cfg *config.Config) {
 	// Log incoming WebSocket connection attempt with detailed info
@@ -218,7 +239,7 @@ func (h *Handler) HandleVMStatusWebSocket(w http.ResponseWriter, r *http.Request
 	}
 
 	// Verify token
-	claims, err := auth.ValidateToken(token, cfg.JWTSecret)
+	claims, err := auth.KeysFor(cfg).ValidateToken(token)
 	if err != nil {
 		logger.Log.Warn("Invalid token for VM status WebSocket",
 			zap.Error(err),
@@ -7,7 +7,9 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -58,6 +60,15 @@ type CPUInfo struct {
 	HasSMEP     bool `json:"has_smep"`      // Supervisor Mode Execution Prevention
 	HasSMAP     bool `json:"has_smap"`      // Supervisor Mode Access Prevention
 	HasIntelTXT bool `json:"has_intel_txt"` // Intel Trusted Execution Technology
+
+	// NUMA topology (empty if the host exposes no NUMA information)
+	NUMANodes []NUMANode `json:"numa_nodes,omitempty"`
+}
+
+// NUMANode describes a host NUMA node and the logical CPUs attached to it.
+type NUMANode struct {
+	ID   int   `json:"id"`
+	CPUs []int `json:"cpus"`
 }
 
 // MemoryInfo contains memory information.
@@ -181,6 +192,8 @@ func detectCPU() (*CPUInfo, error) {
 		Threads: runtime.NumCPU(),
 	}
 
+	cpu.NUMANodes = detectNUMA("/sys/devices/system/node")
+
 	// Read /proc/cpuinfo
 	data, err := os.ReadFile("/proc/cpuinfo")
 	if err != nil {
@@ -239,6 +252,82 @@ func detectCPU() (*CPUInfo, error) {
 	return cpu, nil
 }
 
+// detectNUMA reads NUMA nodes and their CPU lists from sysfs.
+func detectNUMA(root string) []NUMANode {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil
+	}
+
+	var nodes []NUMANode
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, "node") {
+			continue
+		}
+		id, err := strconv.Atoi(strings.TrimPrefix(name, "node"))
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(root, name, "cpulist"))
+		if err != nil {
+			continue
+		}
+		cpus, err := ParseCPUList(strings.TrimSpace(string(data)))
+		if err != nil {
+			logger.Log.Warn("Failed to parse NUMA cpulist", zap.String("node", name), zap.Error(err))
+			continue
+		}
+		nodes = append(nodes, NUMANode{ID: id, CPUs: cpus})
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+	return nodes
+}
+
+// ParseCPUList parses a Linux/libvirt CPU list such as "0-3,8,10-11" into sorted, unique CPU IDs.
+func ParseCPUList(list string) ([]int, error) {
+	if list == "" {
+		return nil, fmt.Errorf("empty cpu list")
+	}
+
+	seen := make(map[int]bool)
+	for _, part := range strings.Split(list, ",") {
+		part = strings.TrimSpace(part)
+		lo, hi := part, part
+		if i := strings.Index(part, "-"); i >= 0 {
+			lo, hi = part[:i], part[i+1:]
+		}
+		start, err := strconv.Atoi(lo)
+		if err != nil || start < 0 {
+			return nil, fmt.Errorf("invalid cpu list entry %q", part)
+		}
+		end, err := strconv.Atoi(hi)
+		if err != nil || end < start {
+			return nil, fmt.Errorf("invalid cpu list entry %q", part)
+		}
+		for cpu := start; cpu <= end; cpu++ {
+			seen[cpu] = true
+		}
+	}
+
+	cpus := make([]int, 0, len(seen))
+	for cpu := range seen {
+		cpus = append(cpus, cpu)
+	}
+	sort.Ints(cpus)
+	return cpus, nil
+}
+
+// NUMANode returns the host NUMA node with the given ID.
+func (c *CPUInfo) NUMANode(id int) (NUMANode, bool) {
+	for _, node := range c.NUMANodes {
+		if node.ID == id {
+			return node, true
+		}
+	}
+	return NUMANode{}, false
+}
+
 // detectMemory detects memory information.
 func detectMemory() (*MemoryInfo, error) {
 	mem := &MemoryInfo{}
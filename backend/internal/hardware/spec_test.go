@@ -1,6 +1,7 @@
 package hardware
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
@@ -89,3 +90,55 @@ func TestSpecFile_RelativePath(t *testing.T) {
 		_ = absPath // Use absPath to avoid unused variable
 	}
 }
+
+func TestParseCPUList(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    []int
+		wantErr bool
+	}{
+		{"0", []int{0}, false},
+		{"0-3", []int{0, 1, 2, 3}, false},
+		{"0-1,8,10-11", []int{0, 1, 8, 10, 11}, false},
+		{"3,1,1-2", []int{1, 2, 3}, false},
+		{"", nil, true},
+		{"3-1", nil, true},
+		{"a", nil, true},
+		{"-1", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseCPUList(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseCPUList(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("ParseCPUList(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestDetectNUMA(t *testing.T) {
+	root := t.TempDir()
+	for node, cpus := range map[string]string{"node0": "0-1\n", "node1": "2-3\n"} {
+		os.MkdirAll(filepath.Join(root, node), 0755)
+		os.WriteFile(filepath.Join(root, node, "cpulist"), []byte(cpus), 0644)
+	}
+	os.MkdirAll(filepath.Join(root, "power"), 0755)
+
+	nodes := detectNUMA(root)
+	if len(nodes) != 2 || nodes[0].ID != 0 || fmt.Sprint(nodes[1].CPUs) != "[2 3]" {
+		t.Fatalf("Unexpected NUMA nodes: %+v", nodes)
+	}
+
+	info := CPUInfo{NUMANodes: nodes}
+	if _, ok := info.NUMANode(1); !ok {
+		t.Error("Expected node 1")
+	}
+	if _, ok := info.NUMANode(5); ok {
+		t.Error("Expected node 5 to be missing")
+	}
+	if detectNUMA(filepath.Join(root, "missing")) != nil {
+		t.Error("Expected nil for missing sysfs")
+	}
+}
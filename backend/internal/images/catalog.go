@@ -0,0 +1,111 @@
+package images
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+)
+
+// CatalogEntry describes a downloadable ISO.
+type CatalogEntry struct {
+	ID           string   `json:"id"`
+	Name         string   `json:"name"`
+	OSType       string   `json:"os_type"`
+	URL          string   `json:"url"`
+	Mirrors      []string `json:"mirrors,omitempty"` // Tried in order if URL fails
+	SHA256       string   `json:"sha256"`
+	SignatureURL string   `json:"signature_url,omitempty"` // Detached GPG signature over the image
+	Description  string   `json:"description,omitempty"`
+}
+
+// Catalog is the on-disk list of downloadable images.
+type Catalog struct {
+	Entries []CatalogEntry `json:"entries"`
+}
+
+// LoadCatalog reads and validates the catalog at path.
+// A missing file yields an empty catalog.
+func LoadCatalog(path string) (*Catalog, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &Catalog{}, nil
+		}
+		return nil, fmt.Errorf("failed to read image catalog: %w", err)
+	}
+
+	var catalog Catalog
+	if err := json.Unmarshal(data, &catalog); err != nil {
+		return nil, fmt.Errorf("failed to parse image catalog: %w", err)
+	}
+
+	seen := make(map[string]bool, len(catalog.Entries))
+	for i := range catalog.Entries {
+		entry := &catalog.Entries[i]
+		if err := entry.validate(); err != nil {
+			return nil, fmt.Errorf("catalog entry %d (%s): %w", i, entry.ID, err)
+		}
+		if seen[entry.ID] {
+			return nil, fmt.Errorf("catalog entry %d: duplicate id %q", i, entry.ID)
+		}
+		seen[entry.ID] = true
+	}
+	return &catalog, nil
+}
+
+// Find returns the entry with the given ID.
+func (c *Catalog) Find(id string) (*CatalogEntry, bool) {
+	for i := range c.Entries {
+		if c.Entries[i].ID == id {
+			return &c.Entries[i], true
+		}
+	}
+	return nil, false
+}
+
+// Filename returns the file name the entry is stored under.
+func (e *CatalogEntry) Filename() string {
+	u, err := url.Parse(e.URL)
+	if err == nil && IsSupportedExtension(u.Path) {
+		return SanitizeFilename(u.Path)
+	}
+	return SanitizeFilename(e.ID + ".iso")
+}
+
+func (e *CatalogEntry) validate() error {
+	if e.ID == "" || e.Name == "" {
+		return fmt.Errorf("id and name are required")
+	}
+	sum, err := NormalizeSHA256(e.SHA256)
+	if err != nil {
+		return err
+	}
+	e.SHA256 = sum
+
+	for _, raw := range append([]string{e.URL}, e.Mirrors...) {
+		if err := validateFetchURL(raw); err != nil {
+			return err
+		}
+	}
+	if e.SignatureURL != "" {
+		if err := validateFetchURL(e.SignatureURL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateFetchURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid url %q: %w", raw, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("url %q must be http or https", raw)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("url %q has no host", raw)
+	}
+	return nil
+}
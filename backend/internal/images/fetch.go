@@ -0,0 +1,417 @@
+package images
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/DARC0625/LIMEN/backend/internal/logger"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrCatalogEntryNotFound = errors.New("catalog entry not found")
+	ErrFetchNotFound        = errors.New("fetch job not found")
+	ErrSignatureInvalid     = errors.New("gpg signature verification failed")
+)
+
+// fetchJobRetention is how long finished jobs stay listed before they are evicted.
+const fetchJobRetention = 24 * time.Hour
+
+// FetchStatus is the state of a background download.
+type FetchStatus string
+
+const (
+	FetchStatusQueued      FetchStatus = "queued"
+	FetchStatusDownloading FetchStatus = "downloading"
+	FetchStatusVerifying   FetchStatus = "verifying"
+	FetchStatusCompleted   FetchStatus = "completed"
+	FetchStatusFailed      FetchStatus = "failed"
+	FetchStatusCancelled   FetchStatus = "cancelled"
+)
+
+// FetchJob reports the progress of a catalog download.
+type FetchJob struct {
+	ID         string      `json:"id"`
+	EntryID    string      `json:"entry_id"`
+	Status     FetchStatus `json:"status"`
+	URL        string      `json:"url,omitempty"` // Source currently (or last) used
+	BytesDone  int64       `json:"bytes_done"`
+	BytesTotal int64       `json:"bytes_total"` // 0 if the server did not send Content-Length
+	Error      string      `json:"error,omitempty"`
+	ImageID    *uint       `json:"image_id,omitempty"`
+	OwnerID    uint        `json:"owner_id"`
+	StartedAt  time.Time   `json:"started_at"`
+	FinishedAt *time.Time  `json:"finished_at,omitempty"`
+}
+
+// fetchJob is the mutable, internal form of FetchJob.
+type fetchJob struct {
+	mu        sync.Mutex
+	job       FetchJob
+	bytesDone atomic.Int64
+	cancel    context.CancelFunc
+}
+
+func (j *fetchJob) snapshot() FetchJob {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	job := j.job
+	job.BytesDone = j.bytesDone.Load()
+	return job
+}
+
+func (j *fetchJob) update(fn func(*FetchJob)) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	fn(&j.job)
+}
+
+// expired reports whether the job finished before cutoff.
+func (j *fetchJob) expired(cutoff time.Time) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.job.FinishedAt != nil && j.job.FinishedAt.Before(cutoff)
+}
+
+func (j *fetchJob) finished() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	switch j.job.Status {
+	case FetchStatusCompleted, FetchStatusFailed, FetchStatusCancelled:
+		return true
+	}
+	return false
+}
+
+// Fetcher downloads catalog entries into the image store in the background.
+type Fetcher struct {
+	store       *Store
+	client      *http.Client
+	catalogPath string
+	keyring     openpgp.EntityList
+
+	mu   sync.Mutex
+	jobs map[string]*fetchJob
+}
+
+// NewFetcher creates a fetcher for the catalog at catalogPath.
+// keyring may be nil, in which case entries with a signature cannot be fetched.
+// If client is nil, a default client without an overall timeout is used (ISOs are large).
+func NewFetcher(store *Store, catalogPath string, keyring openpgp.EntityList, client *http.Client) *Fetcher {
+	if client == nil {
+		client = &http.Client{}
+	}
+	return &Fetcher{
+		store:       store,
+		client:      client,
+		catalogPath: catalogPath,
+		keyring:     keyring,
+		jobs:        make(map[string]*fetchJob),
+	}
+}
+
+// LoadKeyring reads an armored GPG public keyring.
+func LoadKeyring(path string) (openpgp.EntityList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return openpgp.ReadArmoredKeyRing(f)
+}
+
+// Catalog loads the current catalog. It is re-read on every call so edits take effect without a restart.
+func (f *Fetcher) Catalog() (*Catalog, error) {
+	return LoadCatalog(f.catalogPath)
+}
+
+// Start begins downloading the catalog entry in the background.
+// If the entry is already being fetched, the existing job is returned.
+func (f *Fetcher) Start(entryID string, ownerID uint) (FetchJob, error) {
+	catalog, err := f.Catalog()
+	if err != nil {
+		return FetchJob{}, err
+	}
+	entry, ok := catalog.Find(entryID)
+	if !ok {
+		return FetchJob{}, ErrCatalogEntryNotFound
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pruneLocked()
+
+	for _, j := range f.jobs {
+		if j.snapshot().EntryID == entryID && !j.finished() {
+			return j.snapshot(), nil
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &fetchJob{
+		job: FetchJob{
+			ID:        uuid.New().String(),
+			EntryID:   entryID,
+			Status:    FetchStatusQueued,
+			OwnerID:   ownerID,
+			StartedAt: time.Now(),
+		},
+		cancel: cancel,
+	}
+	f.jobs[j.job.ID] = j
+
+	go f.run(ctx, j, *entry)
+
+	logger.Log.Info("Image fetch started",
+		zap.String("fetch_id", j.job.ID),
+		zap.String("entry_id", entryID),
+		zap.String("url", entry.URL))
+	return j.snapshot(), nil
+}
+
+// Get returns the current state of a fetch job.
+func (f *Fetcher) Get(id string) (FetchJob, error) {
+	f.mu.Lock()
+	j, ok := f.jobs[id]
+	f.mu.Unlock()
+	if !ok {
+		return FetchJob{}, ErrFetchNotFound
+	}
+	return j.snapshot(), nil
+}
+
+// List returns all known fetch jobs, newest first.
+func (f *Fetcher) List() []FetchJob {
+	f.mu.Lock()
+	f.pruneLocked()
+	jobs := make([]FetchJob, 0, len(f.jobs))
+	for _, j := range f.jobs {
+		jobs = append(jobs, j.snapshot())
+	}
+	f.mu.Unlock()
+
+	sort.Slice(jobs, func(a, b int) bool {
+		return jobs[a].StartedAt.After(jobs[b].StartedAt)
+	})
+	return jobs
+}
+
+// pruneLocked evicts jobs that finished more than fetchJobRetention ago. f.mu must be held.
+func (f *Fetcher) pruneLocked() {
+	cutoff := time.Now().Add(-fetchJobRetention)
+	for id, j := range f.jobs {
+		if j.expired(cutoff) {
+			delete(f.jobs, id)
+		}
+	}
+}
+
+// Cancel stops a running fetch.
+func (f *Fetcher) Cancel(id string) error {
+	f.mu.Lock()
+	j, ok := f.jobs[id]
+	f.mu.Unlock()
+	if !ok {
+		return ErrFetchNotFound
+	}
+	j.cancel()
+	return nil
+}
+
+func (f *Fetcher) run(ctx context.Context, j *fetchJob, entry CatalogEntry) {
+	defer j.cancel()
+
+	image, err := f.fetch(ctx, j, entry)
+
+	now := time.Now()
+	j.update(func(job *FetchJob) {
+		job.FinishedAt = &now
+		switch {
+		case err == nil:
+			job.Status = FetchStatusCompleted
+			job.ImageID = &image
+		case ctx.Err() != nil:
+			job.Status = FetchStatusCancelled
+			job.Error = "cancelled"
+		default:
+			job.Status = FetchStatusFailed
+			job.Error = err.Error()
+		}
+	})
+
+	if err != nil {
+		logger.Log.Warn("Image fetch failed", zap.String("fetch_id", j.job.ID), zap.String("entry_id", entry.ID), zap.Error(err))
+		return
+	}
+	logger.Log.Info("Image fetch completed", zap.String("fetch_id", j.job.ID), zap.String("entry_id", entry.ID), zap.Uint("image_id", image))
+}
+
+// fetch downloads, verifies and registers entry, returning the image ID.
+func (f *Fetcher) fetch(ctx context.Context, j *fetchJob, entry CatalogEntry) (uint, error) {
+	// Already in the library - nothing to download
+	if existing, err := f.store.FindBySHA256(entry.SHA256, nil); err != nil {
+		return 0, err
+	} else if existing != nil {
+		return existing.ID, nil
+	}
+
+	if entry.SignatureURL != "" && len(f.keyring) == 0 {
+		return 0, fmt.Errorf("%w: entry is signed but no keyring is configured", ErrSignatureInvalid)
+	}
+
+	if err := os.MkdirAll(f.store.uploadDir, 0750); err != nil {
+		return 0, err
+	}
+	partPath := filepath.Join(f.store.uploadDir, "fetch-"+j.job.ID+".part")
+	defer os.Remove(partPath) // No-op once RegisterFile has moved it
+
+	var sum string
+	var size int64
+	var lastErr error
+	for _, src := range append([]string{entry.URL}, entry.Mirrors...) {
+		sum, size, lastErr = f.download(ctx, j, src, partPath)
+		if lastErr == nil {
+			break
+		}
+		if ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+		logger.Log.Warn("Image download failed, trying next mirror", zap.String("url", src), zap.Error(lastErr))
+	}
+	if lastErr != nil {
+		return 0, lastErr
+	}
+
+	j.update(func(job *FetchJob) { job.Status = FetchStatusVerifying })
+
+	if sum != entry.SHA256 {
+		return 0, fmt.Errorf("%w: expected %s, got %s", ErrChecksumMismatch, entry.SHA256, sum)
+	}
+	if entry.SignatureURL != "" {
+		if err := f.verifySignature(ctx, entry.SignatureURL, partPath); err != nil {
+			return 0, err
+		}
+	}
+	filename := entry.Filename()
+	if err := VerifyImageFormat(partPath, filename); err != nil {
+		return 0, err
+	}
+
+	image, _, err := f.store.RegisterFile(partPath, filename, entry.OSType, entry.Description, sum, size, nil)
+	if err != nil {
+		return 0, err
+	}
+	return image.ID, nil
+}
+
+// download streams src into dst, hashing as it goes.
+func (f *Fetcher) download(ctx context.Context, j *fetchJob, src, dst string) (string, int64, error) {
+	j.bytesDone.Store(0)
+	j.update(func(job *FetchJob) {
+		job.Status = FetchStatusDownloading
+		job.URL = src
+		job.BytesTotal = 0
+	})
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src, nil)
+	if err != nil {
+		return "", 0, err
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("unexpected status %s from %s", resp.Status, src)
+	}
+	if resp.ContentLength > f.store.maxSize {
+		return "", 0, ErrTooLarge
+	}
+	if resp.ContentLength > 0 {
+		j.update(func(job *FetchJob) { job.BytesTotal = resp.ContentLength })
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return "", 0, err
+	}
+	defer out.Close()
+
+	hasher := sha256.New()
+	w := io.MultiWriter(out, hasher, progressWriter{&j.bytesDone})
+	n, err := io.Copy(w, io.LimitReader(resp.Body, f.store.maxSize+1))
+	if err != nil {
+		return "", 0, err
+	}
+	if n > f.store.maxSize {
+		return "", 0, ErrTooLarge
+	}
+	if err := out.Sync(); err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), n, nil
+}
+
+// verifySignature checks a detached (armored or binary) signature over the file at path.
+func (f *Fetcher) verifySignature(ctx context.Context, sigURL, path string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sigURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to download signature: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s fetching signature", resp.Status)
+	}
+	sig, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := openpgp.CheckArmoredDetachedSignature(f.keyring, file, bytes.NewReader(sig), nil); err == nil {
+		return nil
+	}
+	// Not armored (or bad) - retry as a binary signature
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := openpgp.CheckDetachedSignature(f.keyring, file, bytes.NewReader(sig), nil); err != nil {
+		return fmt.Errorf("%w: %v", ErrSignatureInvalid, err)
+	}
+	return nil
+}
+
+// progressWriter counts bytes written for progress reporting.
+type progressWriter struct {
+	n *atomic.Int64
+}
+
+func (p progressWriter) Write(b []byte) (int, error) {
+	p.n.Add(int64(len(b)))
+	return len(b), nil
+}
@@ -0,0 +1,216 @@
+package images
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+)
+
+// writeCatalog writes entries to a catalog file and returns its path.
+func writeCatalog(t *testing.T, entries ...CatalogEntry) string {
+	t.Helper()
+	data, _ := json.Marshal(Catalog{Entries: entries})
+	path := filepath.Join(t.TempDir(), "catalog.json")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("Failed to write catalog: %v", err)
+	}
+	return path
+}
+
+func waitForFetch(t *testing.T, f *Fetcher, id string) FetchJob {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := f.Get(id)
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		switch job.Status {
+		case FetchStatusCompleted, FetchStatusFailed, FetchStatusCancelled:
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("Fetch did not finish in time")
+	return FetchJob{}
+}
+
+func TestFetcher_DownloadWithMirrorFallback(t *testing.T) {
+	store, _ := setupTestStore(t)
+	data := fakeISO(0x9000)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/broken/alpine.iso", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "gone", http.StatusNotFound)
+	})
+	mux.HandleFunc("/mirror/alpine.iso", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Write(data)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	catalog := writeCatalog(t, CatalogEntry{
+		ID:      "alpine",
+		Name:    "Alpine",
+		OSType:  "alpine",
+		URL:     srv.URL + "/broken/alpine.iso",
+		Mirrors: []string{srv.URL + "/mirror/alpine.iso"},
+		SHA256:  strings.ToUpper(sha256Hex(data)),
+	})
+	f := NewFetcher(store, catalog, nil, srv.Client())
+
+	job, err := f.Start("alpine", 1)
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	job = waitForFetch(t, f, job.ID)
+	if job.Status != FetchStatusCompleted || job.ImageID == nil {
+		t.Fatalf("Expected completed job, got %+v", job)
+	}
+	if job.BytesDone != int64(len(data)) || job.BytesTotal != int64(len(data)) {
+		t.Errorf("Expected %d bytes reported, got %d/%d", len(data), job.BytesDone, job.BytesTotal)
+	}
+
+	image, err := store.GetImage(*job.ImageID)
+	if err != nil {
+		t.Fatalf("GetImage failed: %v", err)
+	}
+	if image.Path != "alpine.iso" || image.OwnerID != nil {
+		t.Errorf("Unexpected image record: %+v", image)
+	}
+
+	// Fetching again resolves to the same image without downloading
+	job, _ = f.Start("alpine", 1)
+	job = waitForFetch(t, f, job.ID)
+	if job.ImageID == nil || *job.ImageID != image.ID {
+		t.Errorf("Expected dedupe to image %d, got %+v", image.ID, job)
+	}
+}
+
+func TestFetcher_ChecksumMismatch(t *testing.T) {
+	store, _ := setupTestStore(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(fakeISO(0x9000))
+	}))
+	defer srv.Close()
+
+	catalog := writeCatalog(t, CatalogEntry{ID: "x", Name: "X", URL: srv.URL + "/x.iso", SHA256: sha256Hex([]byte("other"))})
+	f := NewFetcher(store, catalog, nil, srv.Client())
+
+	job, _ := f.Start("x", 1)
+	job = waitForFetch(t, f, job.ID)
+	if job.Status != FetchStatusFailed || !strings.Contains(job.Error, ErrChecksumMismatch.Error()) {
+		t.Errorf("Expected checksum failure, got %+v", job)
+	}
+	if images, _ := store.ListImages(0, true); len(images) != 0 {
+		t.Errorf("Expected no images registered, got %d", len(images))
+	}
+
+	if _, err := f.Start("missing", 1); !errors.Is(err, ErrCatalogEntryNotFound) {
+		t.Errorf("Expected ErrCatalogEntryNotFound, got %v", err)
+	}
+
+	// Finished jobs are evicted once they are past the retention
+	if jobs := f.List(); len(jobs) != 1 {
+		t.Fatalf("Expected the failed job to be listed, got %d", len(jobs))
+	}
+	f.jobs[job.ID].update(func(j *FetchJob) {
+		old := time.Now().Add(-fetchJobRetention - time.Minute)
+		j.FinishedAt = &old
+	})
+	if jobs := f.List(); len(jobs) != 0 {
+		t.Errorf("Expected the old job to be evicted, got %+v", jobs)
+	}
+	if _, err := f.Get(job.ID); !errors.Is(err, ErrFetchNotFound) {
+		t.Errorf("Expected ErrFetchNotFound, got %v", err)
+	}
+}
+
+func TestFetcher_Signature(t *testing.T) {
+	store, _ := setupTestStore(t)
+	data := fakeISO(0x9000)
+
+	signer, err := openpgp.NewEntity("LIMEN Test", "", "test@example.com", nil)
+	if err != nil {
+		t.Fatalf("Failed to create key: %v", err)
+	}
+	var goodSig bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&goodSig, signer, bytes.NewReader(data), nil); err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	var badSig bytes.Buffer
+	openpgp.ArmoredDetachSign(&badSig, signer, bytes.NewReader([]byte("tampered")), nil)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/img.iso", func(w http.ResponseWriter, r *http.Request) { w.Write(data) })
+	mux.HandleFunc("/img.iso.asc", func(w http.ResponseWriter, r *http.Request) { w.Write(goodSig.Bytes()) })
+	mux.HandleFunc("/bad.asc", func(w http.ResponseWriter, r *http.Request) { w.Write(badSig.Bytes()) })
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	catalog := writeCatalog(t,
+		CatalogEntry{ID: "bad", Name: "Bad", URL: srv.URL + "/img.iso", SHA256: sha256Hex(data), SignatureURL: srv.URL + "/bad.asc"},
+		CatalogEntry{ID: "good", Name: "Good", URL: srv.URL + "/img.iso", SHA256: sha256Hex(data), SignatureURL: srv.URL + "/img.iso.asc"},
+	)
+
+	// No keyring configured
+	f := NewFetcher(store, catalog, nil, srv.Client())
+	job, _ := f.Start("good", 1)
+	if job = waitForFetch(t, f, job.ID); job.Status != FetchStatusFailed {
+		t.Errorf("Expected failure without keyring, got %+v", job)
+	}
+
+	f = NewFetcher(store, catalog, openpgp.EntityList{signer}, srv.Client())
+	job, _ = f.Start("bad", 1)
+	if job = waitForFetch(t, f, job.ID); job.Status != FetchStatusFailed || !strings.Contains(job.Error, ErrSignatureInvalid.Error()) {
+		t.Errorf("Expected signature failure, got %+v", job)
+	}
+
+	job, _ = f.Start("good", 1)
+	if job = waitForFetch(t, f, job.ID); job.Status != FetchStatusCompleted {
+		t.Errorf("Expected completed job, got %+v", job)
+	}
+}
+
+func TestLoadCatalog_Validation(t *testing.T) {
+	sum := sha256Hex([]byte("x"))
+
+	missing, err := LoadCatalog(filepath.Join(t.TempDir(), "none.json"))
+	if err != nil || len(missing.Entries) != 0 {
+		t.Errorf("Missing catalog should be empty, got %v %v", missing, err)
+	}
+
+	tests := []struct {
+		name  string
+		entry CatalogEntry
+	}{
+		{"no id", CatalogEntry{Name: "a", URL: "https://example.com/a.iso", SHA256: sum}},
+		{"bad scheme", CatalogEntry{ID: "a", Name: "a", URL: "file:///etc/passwd", SHA256: sum}},
+		{"bad mirror", CatalogEntry{ID: "a", Name: "a", URL: "https://example.com/a.iso", Mirrors: []string{"ftp://x/a.iso"}, SHA256: sum}},
+		{"bad checksum", CatalogEntry{ID: "a", Name: "a", URL: "https://example.com/a.iso", SHA256: "nope"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := LoadCatalog(writeCatalog(t, tt.entry)); err == nil {
+				t.Error("Expected validation error")
+			}
+		})
+	}
+
+	entry := CatalogEntry{ID: "a", Name: "a", URL: "https://example.com/a.iso", SHA256: sum}
+	if _, err := LoadCatalog(writeCatalog(t, entry, entry)); err == nil {
+		t.Error("Expected duplicate id error")
+	}
+}
@@ -0,0 +1,244 @@
+// Package images manages the ISO and disk image library: resumable uploads,
+// checksum and format verification, deduplication and registration as VMImage rows.
+package images
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DARC0625/LIMEN/backend/internal/logger"
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUploadNotFound   = errors.New("upload not found")
+	ErrUploadClosed     = errors.New("upload is no longer accepting data")
+	ErrUploadIncomplete = errors.New("upload is incomplete")
+	ErrOffsetMismatch   = errors.New("chunk offset does not match received bytes")
+	ErrChecksumMismatch = errors.New("sha256 checksum mismatch")
+	ErrInvalidImage     = errors.New("invalid image file")
+	ErrTooLarge         = errors.New("image exceeds maximum size")
+	ErrImageNotFound    = errors.New("image not found")
+	ErrImageInUse       = errors.New("image is referenced by one or more VMs")
+)
+
+// uploadDirName is the staging directory for in-progress uploads, relative to the ISO directory.
+const uploadDirName = ".uploads"
+
+var unsafeFilenameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// Store owns the image library under isoDir.
+type Store struct {
+	db        *gorm.DB
+	isoDir    string
+	uploadDir string
+	maxSize   int64         // Maximum image size in bytes
+	chunkSize int64         // Maximum chunk size in bytes
+	uploadTTL time.Duration // Pending uploads idle this long expire (0 = never)
+
+	locks      sync.Map   // uploadID -> *sync.Mutex
+	registerMu sync.Mutex // Serialises dedupe lookups with registration
+	quotaMu    sync.Mutex // Serialises quota checks with the uploads reserving quota
+
+	stopOnce sync.Once
+	stop     chan struct{}
+}
+
+// NewStore creates an image store rooted at isoDir.
+// maxSize and chunkSize are in bytes. Pending uploads that receive no data for uploadTTL
+// expire (0 = never).
+func NewStore(db *gorm.DB, isoDir string, maxSize, chunkSize int64, uploadTTL time.Duration) *Store {
+	return &Store{
+		db:        db,
+		isoDir:    isoDir,
+		uploadDir: filepath.Join(isoDir, uploadDirName),
+		maxSize:   maxSize,
+		chunkSize: chunkSize,
+		uploadTTL: uploadTTL,
+		stop:      make(chan struct{}),
+	}
+}
+
+// MaxSize returns the maximum accepted image size in bytes.
+func (s *Store) MaxSize() int64 {
+	return s.maxSize
+}
+
+// ChunkSize returns the maximum accepted chunk size in bytes.
+func (s *Store) ChunkSize() int64 {
+	return s.chunkSize
+}
+
+// ISODir returns the directory images are stored in.
+func (s *Store) ISODir() string {
+	return s.isoDir
+}
+
+// ListImages returns the registered images ownerID may see, newest first: system images
+// and the user's own uploads, or every image if all is set.
+func (s *Store) ListImages(ownerID uint, all bool) ([]models.VMImage, error) {
+	query := s.db.Order("created_at DESC")
+	if !all {
+		query = query.Where("owner_id IS NULL OR owner_id = ?", ownerID)
+	}
+	var images []models.VMImage
+	if err := query.Find(&images).Error; err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+// GetImage returns a registered image by ID.
+func (s *Store) GetImage(id uint) (*models.VMImage, error) {
+	var image models.VMImage
+	if err := s.db.First(&image, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrImageNotFound
+		}
+		return nil, err
+	}
+	return &image, nil
+}
+
+// FindBySHA256 returns the registered image with the given content hash that ownerID may
+// see, if any: a system image, or one of the user's own uploads. A nil ownerID matches
+// system images only. Other users' uploads are never returned, so that a checksum can't
+// be used to probe what they have uploaded.
+func (s *Store) FindBySHA256(sum string, ownerID *uint) (*models.VMImage, error) {
+	query := s.db.Where("sha256 = ?", sum)
+	if ownerID == nil {
+		query = query.Where("owner_id IS NULL")
+	} else {
+		query = query.Where("owner_id IS NULL OR owner_id = ?", *ownerID)
+	}
+	var image models.VMImage
+	err := query.Order("owner_id IS NULL DESC").First(&image).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &image, nil
+}
+
+// ResolvePath returns the absolute filesystem path of an image.
+// Relative paths are resolved against the ISO directory.
+func (s *Store) ResolvePath(image *models.VMImage) string {
+	if filepath.IsAbs(image.Path) {
+		return image.Path
+	}
+	return filepath.Join(s.isoDir, image.Path)
+}
+
+// DeleteImage removes an image that no VM references.
+// mediaInUse, if non-nil, is consulted for VMs that have the image attached as media
+// without having been created from it.
+func (s *Store) DeleteImage(id uint, mediaInUse func(path string) bool) error {
+	image, err := s.GetImage(id)
+	if err != nil {
+		return err
+	}
+
+	var refs int64
+	if err := s.db.Model(&models.VM{}).Where("image_id = ?", id).Count(&refs).Error; err != nil {
+		return err
+	}
+	path := s.ResolvePath(image)
+	if refs > 0 || (mediaInUse != nil && mediaInUse(path)) {
+		return ErrImageInUse
+	}
+
+	if err := s.db.Delete(image).Error; err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		logger.Log.Warn("Failed to remove image file", zap.String("path", path), zap.Error(err))
+	}
+	logger.Log.Info("Image deleted", zap.Uint("image_id", id), zap.String("name", image.Name))
+	return nil
+}
+
+// RegisterFile moves a verified file at srcPath into the ISO directory and creates its VMImage row.
+// If an image with the same content hash that ownerID may see already exists, srcPath is
+// removed and the existing image is returned with created=false.
+func (s *Store) RegisterFile(srcPath, filename, osType, description, sum string, size int64, ownerID *uint) (image *models.VMImage, created bool, err error) {
+	s.registerMu.Lock()
+	defer s.registerMu.Unlock()
+
+	existing, err := s.FindBySHA256(sum, ownerID)
+	if err != nil {
+		return nil, false, err
+	}
+	if existing != nil {
+		if err := os.Remove(srcPath); err != nil && !os.IsNotExist(err) {
+			logger.Log.Warn("Failed to remove duplicate image", zap.String("path", srcPath), zap.Error(err))
+		}
+		return existing, false, nil
+	}
+
+	name := s.availableFilename(filename, sum)
+	dstPath := filepath.Join(s.isoDir, name)
+	if err := os.Rename(srcPath, dstPath); err != nil {
+		return nil, false, fmt.Errorf("failed to move image into place: %w", err)
+	}
+
+	image = &models.VMImage{
+		Name:        strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename)),
+		OSType:      osType,
+		Path:        name, // Relative to ISO directory (see VMService.EnsureISO)
+		IsISO:       IsISOFilename(filename),
+		Description: description,
+		SHA256:      sum,
+		Size:        size,
+		OwnerID:     ownerID,
+	}
+	if err := s.db.Create(image).Error; err != nil {
+		os.Remove(dstPath)
+		return nil, false, err
+	}
+
+	logger.Log.Info("Image registered",
+		zap.Uint("image_id", image.ID),
+		zap.String("path", name),
+		zap.String("os_type", osType),
+		zap.String("sha256", sum))
+	return image, true, nil
+}
+
+// availableFilename sanitises filename and, if it is already taken, appends a hash prefix
+// and, for further copies of the same content, a counter.
+func (s *Store) availableFilename(filename, sum string) string {
+	name := SanitizeFilename(filename)
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 1; ; i++ {
+		if _, err := os.Stat(filepath.Join(s.isoDir, name)); os.IsNotExist(err) {
+			return name
+		}
+		name = fmt.Sprintf("%s-%s", base, sum[:12])
+		if i > 1 {
+			name += fmt.Sprintf("-%d", i)
+		}
+		name += ext
+	}
+}
+
+// SanitizeFilename strips directory components and replaces characters unsafe for the filesystem.
+func SanitizeFilename(filename string) string {
+	name := filepath.Base(filepath.Clean("/" + filename))
+	name = unsafeFilenameChars.ReplaceAllString(name, "_")
+	name = strings.TrimLeft(name, "._")
+	if name == "" {
+		name = "image"
+	}
+	return name
+}
@@ -0,0 +1,395 @@
+package images
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DARC0625/LIMEN/backend/internal/logger"
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestStore(t *testing.T) (*Store, *gorm.DB) {
+	t.Helper()
+	logger.Init("debug")
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.VM{}, &models.VMImage{}, &models.UserQuota{}, &models.ImageUpload{}); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+
+	return NewStore(db, t.TempDir(), 1<<20, 64<<10, time.Hour), db
+}
+
+// fakeISO returns a minimal buffer carrying the ISO9660 identifier.
+func fakeISO(size int) []byte {
+	data := make([]byte, size)
+	copy(data[iso9660MagicOffset:], iso9660Magic)
+	return data
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestUpload_ChunkedComplete(t *testing.T) {
+	store, db := setupTestStore(t)
+	data := fakeISO(0x9000)
+
+	upload, existing, err := store.CreateUpload(UploadRequest{
+		Filename: "../ubuntu 24.04.iso",
+		OSType:   "ubuntu-desktop",
+		Size:     int64(len(data)),
+		SHA256:   sha256Hex(data),
+		OwnerID:  1,
+	})
+	if err != nil {
+		t.Fatalf("CreateUpload failed: %v", err)
+	}
+	if existing != nil {
+		t.Fatal("Expected no existing image")
+	}
+
+	// Write in two chunks, with a stale offset in between
+	if _, err := store.WriteChunk(upload.ID, 0, bytes.NewReader(data[:0x5000])); err != nil {
+		t.Fatalf("WriteChunk failed: %v", err)
+	}
+	if _, err := store.WriteChunk(upload.ID, 0, bytes.NewReader(data[:10])); !errors.Is(err, ErrOffsetMismatch) {
+		t.Errorf("Expected ErrOffsetMismatch, got %v", err)
+	}
+	if _, err := store.CompleteUpload(upload.ID); !errors.Is(err, ErrUploadIncomplete) {
+		t.Errorf("Expected ErrUploadIncomplete, got %v", err)
+	}
+	got, err := store.WriteChunk(upload.ID, 0x5000, bytes.NewReader(data[0x5000:]))
+	if err != nil {
+		t.Fatalf("WriteChunk failed: %v", err)
+	}
+	if got.ReceivedBytes != int64(len(data)) {
+		t.Errorf("Expected %d received bytes, got %d", len(data), got.ReceivedBytes)
+	}
+
+	image, err := store.CompleteUpload(upload.ID)
+	if err != nil {
+		t.Fatalf("CompleteUpload failed: %v", err)
+	}
+	if image.Path != "ubuntu_24.04.iso" {
+		t.Errorf("Expected sanitised path, got %q", image.Path)
+	}
+	if !image.IsISO || image.SHA256 != sha256Hex(data) || image.OwnerID == nil || *image.OwnerID != 1 {
+		t.Errorf("Unexpected image record: %+v", image)
+	}
+	if _, err := os.Stat(filepath.Join(store.ISODir(), image.Path)); err != nil {
+		t.Errorf("Image file not in ISO directory: %v", err)
+	}
+
+	var stored models.ImageUpload
+	db.First(&stored, "id = ?", upload.ID)
+	if stored.Status != models.ImageUploadStatusCompleted || stored.ImageID == nil || *stored.ImageID != image.ID {
+		t.Errorf("Upload not marked completed: %+v", stored)
+	}
+
+	// A second upload of the same content by its owner is deduplicated up front
+	again, dup, err := store.CreateUpload(UploadRequest{
+		Filename: "copy.iso",
+		Size:     int64(len(data)),
+		SHA256:   sha256Hex(data),
+		OwnerID:  1,
+	})
+	if err != nil {
+		t.Fatalf("CreateUpload failed: %v", err)
+	}
+	if again != nil || dup == nil || dup.ID != image.ID {
+		t.Errorf("Expected dedupe to existing image %d, got upload=%v image=%v", image.ID, again, dup)
+	}
+}
+
+func TestUpload_DedupeOwnImagesOnly(t *testing.T) {
+	store, _ := setupTestStore(t)
+	data := fakeISO(0x9000)
+
+	upload := func(ownerID uint) (*models.ImageUpload, *models.VMImage) {
+		t.Helper()
+		upload, existing, err := store.CreateUpload(UploadRequest{
+			Filename: "setup.iso",
+			Size:     int64(len(data)),
+			SHA256:   sha256Hex(data),
+			OwnerID:  ownerID,
+		})
+		if err != nil {
+			t.Fatalf("CreateUpload failed: %v", err)
+		}
+		return upload, existing
+	}
+	complete := func(upload *models.ImageUpload) *models.VMImage {
+		t.Helper()
+		if _, err := store.WriteChunk(upload.ID, 0, bytes.NewReader(data)); err != nil {
+			t.Fatalf("WriteChunk failed: %v", err)
+		}
+		image, err := store.CompleteUpload(upload.ID)
+		if err != nil {
+			t.Fatalf("CompleteUpload failed: %v", err)
+		}
+		return image
+	}
+
+	first, _ := upload(1)
+	alice := complete(first)
+
+	// Another user uploading the same content must not learn of, or be handed, alice's image
+	second, existing := upload(2)
+	if existing != nil || second == nil {
+		t.Fatalf("Expected a new upload for another user, got upload=%v image=%v", second, existing)
+	}
+	bob := complete(second)
+	if bob.ID == alice.ID || bob.Path == alice.Path || *bob.OwnerID != 2 {
+		t.Errorf("Expected a separate copy owned by user 2, got %+v (alice's: %+v)", bob, alice)
+	}
+	if _, err := os.Stat(filepath.Join(store.ISODir(), alice.Path)); err != nil {
+		t.Errorf("Alice's image file was replaced: %v", err)
+	}
+
+	list, err := store.ListImages(2, false)
+	if err != nil {
+		t.Fatalf("ListImages failed: %v", err)
+	}
+	if len(list) != 1 || list[0].ID != bob.ID {
+		t.Errorf("Expected user 2 to see only their image, got %+v", list)
+	}
+	if list, _ := store.ListImages(0, true); len(list) != 2 {
+		t.Errorf("Expected 2 images for admins, got %d", len(list))
+	}
+
+	// A third copy gets a filename of its own too
+	third, _ := upload(3)
+	if carol := complete(third); carol.Path == alice.Path || carol.Path == bob.Path {
+		t.Errorf("Expected a separate file for the third copy, got %q", carol.Path)
+	}
+
+	// Users' uploads are not system images, so catalog fetches don't dedupe against them
+	if found, err := store.FindBySHA256(sha256Hex(data), nil); err != nil || found != nil {
+		t.Errorf("Expected no system image, got %v, %v", found, err)
+	}
+}
+
+func TestUpload_ChecksumMismatch(t *testing.T) {
+	store, _ := setupTestStore(t)
+	data := fakeISO(0x9000)
+
+	upload, _, err := store.CreateUpload(UploadRequest{
+		Filename: "bad.iso",
+		Size:     int64(len(data)),
+		SHA256:   sha256Hex([]byte("something else")),
+		OwnerID:  1,
+	})
+	if err != nil {
+		t.Fatalf("CreateUpload failed: %v", err)
+	}
+	if _, err := store.WriteChunk(upload.ID, 0, bytes.NewReader(data)); err != nil {
+		t.Fatalf("WriteChunk failed: %v", err)
+	}
+	if _, err := store.CompleteUpload(upload.ID); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("Expected ErrChecksumMismatch, got %v", err)
+	}
+	if _, err := os.Stat(store.partPath(upload.ID)); !os.IsNotExist(err) {
+		t.Error("Staged data should be removed after checksum failure")
+	}
+	if _, err := store.WriteChunk(upload.ID, int64(len(data)), bytes.NewReader(nil)); !errors.Is(err, ErrUploadClosed) {
+		t.Errorf("Expected ErrUploadClosed, got %v", err)
+	}
+}
+
+func TestUpload_InvalidMagic(t *testing.T) {
+	store, _ := setupTestStore(t)
+	data := make([]byte, 0x9000) // No ISO9660 identifier
+
+	upload, _, err := store.CreateUpload(UploadRequest{
+		Filename: "notreally.iso",
+		Size:     int64(len(data)),
+		SHA256:   sha256Hex(data),
+		OwnerID:  1,
+	})
+	if err != nil {
+		t.Fatalf("CreateUpload failed: %v", err)
+	}
+	store.WriteChunk(upload.ID, 0, bytes.NewReader(data))
+	if _, err := store.CompleteUpload(upload.ID); !errors.Is(err, ErrInvalidImage) {
+		t.Errorf("Expected ErrInvalidImage, got %v", err)
+	}
+}
+
+func TestVerifyImageFormat_RawDisk(t *testing.T) {
+	dir := t.TempDir()
+	raw := filepath.Join(dir, "disk.img")
+	os.WriteFile(raw, make([]byte, 1024), 0644) // Raw disks have no magic
+	if err := VerifyImageFormat(raw, "disk.img"); err != nil {
+		t.Errorf("raw .img rejected: %v", err)
+	}
+	disguised := filepath.Join(dir, "qcow.img")
+	os.WriteFile(disguised, append([]byte{'Q', 'F', 'I', 0xfb}, make([]byte, 1020)...), 0644)
+	if err := VerifyImageFormat(disguised, "qcow.img"); !errors.Is(err, ErrInvalidImage) {
+		t.Errorf("qcow2 named .img: expected ErrInvalidImage, got %v", err)
+	}
+	if err := VerifyImageFormat(raw, "disk.iso"); !errors.Is(err, ErrInvalidImage) {
+		t.Errorf("raw disk named .iso: expected ErrInvalidImage, got %v", err)
+	}
+}
+
+func TestUpload_Validation(t *testing.T) {
+	store, db := setupTestStore(t)
+	sum := sha256Hex([]byte("x"))
+
+	tests := []struct {
+		name string
+		req  UploadRequest
+		want error
+	}{
+		{"bad extension", UploadRequest{Filename: "setup.exe", Size: 10, SHA256: sum, OwnerID: 1}, ErrInvalidImage},
+		{"zero size", UploadRequest{Filename: "a.iso", Size: 0, SHA256: sum, OwnerID: 1}, ErrInvalidImage},
+		{"too large", UploadRequest{Filename: "a.iso", Size: 2 << 20, SHA256: sum, OwnerID: 1}, ErrTooLarge},
+		{"bad checksum", UploadRequest{Filename: "a.iso", Size: 10, SHA256: "abc", OwnerID: 1}, ErrInvalidImage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := store.CreateUpload(tt.req); !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+
+	// Quota: 1MB image storage, 1MB already used
+	quota, _ := models.GetOrCreateUserQuota(db, 7)
+	quota.MaxImageStorage = 1
+	db.Save(quota)
+	owner := uint(7)
+	db.Create(&models.VMImage{Name: "old", Path: "old.iso", SHA256: sha256Hex([]byte("old")), Size: 1 << 20, OwnerID: &owner})
+
+	req := UploadRequest{Filename: "a.iso", Size: 1024, SHA256: sum, OwnerID: 7}
+	_, _, err := store.CreateUpload(req)
+	var quotaErr *models.QuotaError
+	if !errors.As(err, &quotaErr) || quotaErr.Resource != "ImageStorage" {
+		t.Errorf("Expected ImageStorage quota error, got %v", err)
+	}
+	req.SkipQuota = true
+	if _, _, err := store.CreateUpload(req); err != nil {
+		t.Errorf("Admin upload should bypass quota: %v", err)
+	}
+
+	// Pending uploads reserve quota: with the admin upload pending, 3MB fits one more
+	// 1MB upload but not two
+	quota.MaxImageStorage = 3
+	db.Save(quota)
+	req = UploadRequest{Filename: "b.iso", Size: 1 << 20, SHA256: sha256Hex([]byte("b")), OwnerID: 7}
+	if _, _, err := store.CreateUpload(req); err != nil {
+		t.Fatalf("first upload within quota failed: %v", err)
+	}
+	req.SHA256 = sha256Hex([]byte("c"))
+	if _, _, err := store.CreateUpload(req); !errors.As(err, &quotaErr) {
+		t.Errorf("Expected a quota error with a pending upload, got %v", err)
+	}
+}
+
+func TestExpireUploads(t *testing.T) {
+	store, db := setupTestStore(t)
+	quota, _ := models.GetOrCreateUserQuota(db, 7)
+	quota.MaxImageStorage = 1
+	db.Save(quota)
+
+	req := UploadRequest{Filename: "a.iso", Size: 1 << 20, SHA256: sha256Hex([]byte("a")), OwnerID: 7}
+	stale, _, err := store.CreateUpload(req)
+	if err != nil {
+		t.Fatalf("CreateUpload failed: %v", err)
+	}
+	if _, err := store.WriteChunk(stale.ID, 0, bytes.NewReader([]byte("partial"))); err != nil {
+		t.Fatalf("WriteChunk failed: %v", err)
+	}
+	req.SHA256 = sha256Hex([]byte("b"))
+	var quotaErr *models.QuotaError
+	if _, _, err := store.CreateUpload(req); !errors.As(err, &quotaErr) {
+		t.Fatalf("Expected the pending upload to reserve quota, got %v", err)
+	}
+
+	// Once it has gone a TTL without data, the upload stops reserving quota: a new
+	// upload expires it before the quota check
+	db.Model(&models.ImageUpload{}).Where("id = ?", stale.ID).UpdateColumn("updated_at", time.Now().Add(-2*time.Hour))
+	fresh, _, err := store.CreateUpload(req)
+	if err != nil {
+		t.Fatalf("Expected the expired upload to release its quota, got %v", err)
+	}
+	if got, _ := store.GetUpload(stale.ID); got.Status != models.ImageUploadStatusAborted {
+		t.Errorf("Expected stale upload to be aborted, got %s", got.Status)
+	}
+	if _, err := os.Stat(store.partPath(stale.ID)); !os.IsNotExist(err) {
+		t.Errorf("Expected staged data to be removed, got %v", err)
+	}
+	if _, err := store.WriteChunk(stale.ID, 7, bytes.NewReader([]byte("more"))); !errors.Is(err, ErrUploadClosed) {
+		t.Errorf("Expected ErrUploadClosed writing to an expired upload, got %v", err)
+	}
+
+	// The sweep expires only idle uploads
+	if n, err := store.ExpireUploads(); err != nil || n != 0 {
+		t.Errorf("Expected nothing to expire, got %d, %v", n, err)
+	}
+	db.Model(&models.ImageUpload{}).Where("id = ?", fresh.ID).UpdateColumn("updated_at", time.Now().Add(-2*time.Hour))
+	if n, err := store.ExpireUploads(); err != nil || n != 1 {
+		t.Errorf("Expected 1 expired upload, got %d, %v", n, err)
+	}
+	if _, err := os.Stat(store.partPath(fresh.ID)); !os.IsNotExist(err) {
+		t.Errorf("Expected staged data to be removed, got %v", err)
+	}
+}
+
+func TestDeleteImage(t *testing.T) {
+	store, db := setupTestStore(t)
+
+	path := filepath.Join(store.ISODir(), "debian.iso")
+	os.WriteFile(path, []byte("iso"), 0644)
+	image := models.VMImage{Name: "debian", OSType: "debian", Path: "debian.iso"}
+	db.Create(&image)
+
+	vm := models.VM{Name: "vm1", CPU: 1, Memory: 1024, OwnerID: 1, ImageID: &image.ID}
+	db.Create(&vm)
+
+	if err := store.DeleteImage(image.ID, nil); !errors.Is(err, ErrImageInUse) {
+		t.Fatalf("Expected ErrImageInUse, got %v", err)
+	}
+
+	db.Delete(&vm)
+	if err := store.DeleteImage(image.ID, func(p string) bool { return p == path }); !errors.Is(err, ErrImageInUse) {
+		t.Errorf("Expected ErrImageInUse for attached media, got %v", err)
+	}
+	if err := store.DeleteImage(image.ID, nil); err != nil {
+		t.Fatalf("DeleteImage failed: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Image file should be removed")
+	}
+	if err := store.DeleteImage(image.ID, nil); !errors.Is(err, ErrImageNotFound) {
+		t.Errorf("Expected ErrImageNotFound, got %v", err)
+	}
+}
+
+func TestSanitizeFilename(t *testing.T) {
+	tests := map[string]string{
+		"ubuntu.iso":        "ubuntu.iso",
+		"../../etc/passwd":  "passwd",
+		"My Windows 11.iso": "My_Windows_11.iso",
+		".hidden.iso":       "hidden.iso",
+		"":                  "image",
+	}
+	for in, want := range tests {
+		if got := SanitizeFilename(in); got != want {
+			t.Errorf("SanitizeFilename(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,329 @@
+package images
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/DARC0625/LIMEN/backend/internal/logger"
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// UploadRequest describes a new upload session.
+type UploadRequest struct {
+	Filename    string
+	OSType      string
+	Description string
+	Size        int64
+	SHA256      string
+	OwnerID     uint
+	SkipQuota   bool // Admin uploads are not bound by the user image quota
+}
+
+// CreateUpload starts a resumable upload session.
+// If an image with the same checksum that the owner may see is already registered, no
+// session is created and the existing image is returned instead.
+func (s *Store) CreateUpload(req UploadRequest) (*models.ImageUpload, *models.VMImage, error) {
+	if !IsSupportedExtension(req.Filename) {
+		return nil, nil, fmt.Errorf("%w: filename must end in .iso, .img or .qcow2", ErrInvalidImage)
+	}
+	if req.Size <= 0 {
+		return nil, nil, fmt.Errorf("%w: size must be positive", ErrInvalidImage)
+	}
+	if req.Size > s.maxSize {
+		return nil, nil, ErrTooLarge
+	}
+	sum, err := NormalizeSHA256(req.SHA256)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+
+	existing, err := s.FindBySHA256(sum, &req.OwnerID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if existing != nil {
+		return nil, existing, nil
+	}
+
+	// Pending uploads reserve their size, so concurrent uploads can't together exceed
+	// the quota
+	s.quotaMu.Lock()
+	defer s.quotaMu.Unlock()
+	if !req.SkipQuota {
+		// Abandoned uploads stop reserving quota once they expire, whether or not the
+		// expiry loop has got to them yet
+		if _, err := s.expireUploads(s.db.Where("owner_id = ?", req.OwnerID)); err != nil {
+			return nil, nil, err
+		}
+		quota, err := models.GetOrCreateUserQuota(s.db, req.OwnerID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := quota.CheckImageStorage(s.db, req.Size); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := os.MkdirAll(s.uploadDir, 0750); err != nil {
+		return nil, nil, fmt.Errorf("failed to create upload directory: %w", err)
+	}
+
+	upload := &models.ImageUpload{
+		Filename:       SanitizeFilename(req.Filename),
+		OSType:         req.OSType,
+		Description:    req.Description,
+		TotalSize:      req.Size,
+		ExpectedSHA256: sum,
+		Status:         models.ImageUploadStatusPending,
+		OwnerID:        req.OwnerID,
+	}
+	if err := s.db.Create(upload).Error; err != nil {
+		return nil, nil, err
+	}
+
+	f, err := os.OpenFile(s.partPath(upload.ID), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0640)
+	if err != nil {
+		s.db.Delete(upload)
+		return nil, nil, fmt.Errorf("failed to create upload file: %w", err)
+	}
+	f.Close()
+
+	logger.Log.Info("Image upload started",
+		zap.String("upload_id", upload.ID),
+		zap.String("filename", upload.Filename),
+		zap.Int64("size", upload.TotalSize),
+		zap.Uint("owner_id", upload.OwnerID))
+	return upload, nil, nil
+}
+
+// GetUpload returns an upload session by ID.
+func (s *Store) GetUpload(id string) (*models.ImageUpload, error) {
+	var upload models.ImageUpload
+	if err := s.db.Where("id = ?", id).First(&upload).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUploadNotFound
+		}
+		return nil, err
+	}
+	return &upload, nil
+}
+
+// WriteChunk appends data to an upload at offset. The offset must equal the number of
+// bytes already received, so clients resume by querying the session and continuing from there.
+func (s *Store) WriteChunk(id string, offset int64, data io.Reader) (*models.ImageUpload, error) {
+	unlock := s.lockUpload(id)
+	defer unlock()
+
+	upload, err := s.GetUpload(id)
+	if err != nil {
+		return nil, err
+	}
+	if upload.Status != models.ImageUploadStatusPending {
+		return nil, ErrUploadClosed
+	}
+	if offset != upload.ReceivedBytes {
+		return upload, ErrOffsetMismatch
+	}
+
+	f, err := os.OpenFile(s.partPath(id), os.O_WRONLY, 0640)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open upload file: %w", err)
+	}
+	defer f.Close()
+
+	// Drop anything past the last acknowledged byte (e.g. a chunk interrupted mid-write)
+	if err := f.Truncate(offset); err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	remaining := upload.TotalSize - offset
+	n, err := io.Copy(f, io.LimitReader(data, remaining+1))
+	if err != nil {
+		f.Truncate(offset)
+		return nil, fmt.Errorf("failed to write chunk: %w", err)
+	}
+	if n > remaining {
+		f.Truncate(offset)
+		return upload, ErrTooLarge
+	}
+
+	upload.ReceivedBytes = offset + n
+	if err := s.db.Model(upload).Update("received_bytes", upload.ReceivedBytes).Error; err != nil {
+		return nil, err
+	}
+	return upload, nil
+}
+
+// CompleteUpload verifies a fully received upload and registers it as a VMImage.
+// On checksum or format failure the upload is aborted and its data discarded.
+func (s *Store) CompleteUpload(id string) (*models.VMImage, error) {
+	unlock := s.lockUpload(id)
+	defer unlock()
+
+	upload, err := s.GetUpload(id)
+	if err != nil {
+		return nil, err
+	}
+	if upload.Status != models.ImageUploadStatusPending {
+		return nil, ErrUploadClosed
+	}
+	if upload.ReceivedBytes != upload.TotalSize {
+		return nil, ErrUploadIncomplete
+	}
+
+	partPath := s.partPath(id)
+	sum, err := FileSHA256(partPath)
+	if err != nil {
+		return nil, err
+	}
+	if sum != upload.ExpectedSHA256 {
+		s.abort(upload)
+		logger.Log.Warn("Image upload checksum mismatch",
+			zap.String("upload_id", id),
+			zap.String("expected", upload.ExpectedSHA256),
+			zap.String("actual", sum))
+		return nil, ErrChecksumMismatch
+	}
+	if err := VerifyImageFormat(partPath, upload.Filename); err != nil {
+		s.abort(upload)
+		return nil, err
+	}
+
+	ownerID := upload.OwnerID
+	image, _, err := s.RegisterFile(partPath, upload.Filename, upload.OSType, upload.Description, sum, upload.TotalSize, &ownerID)
+	if err != nil {
+		return nil, err
+	}
+
+	upload.Status = models.ImageUploadStatusCompleted
+	upload.ImageID = &image.ID
+	if err := s.db.Save(upload).Error; err != nil {
+		logger.Log.Warn("Failed to mark upload completed", zap.String("upload_id", id), zap.Error(err))
+	}
+	s.locks.Delete(id)
+	return image, nil
+}
+
+// AbortUpload cancels a pending upload and removes its staged data.
+func (s *Store) AbortUpload(id string) error {
+	unlock := s.lockUpload(id)
+	defer unlock()
+
+	upload, err := s.GetUpload(id)
+	if err != nil {
+		return err
+	}
+	if upload.Status != models.ImageUploadStatusPending {
+		return ErrUploadClosed
+	}
+	s.abort(upload)
+	return nil
+}
+
+// ExpireUploads aborts pending uploads that have received no data for the upload TTL,
+// releasing the quota they reserve and removing their staged data. It returns how many
+// were aborted.
+func (s *Store) ExpireUploads() (int, error) {
+	return s.expireUploads(s.db)
+}
+
+// expireUploads expires the pending uploads matching scope.
+func (s *Store) expireUploads(scope *gorm.DB) (int, error) {
+	if s.uploadTTL <= 0 {
+		return 0, nil
+	}
+	cutoff := time.Now().Add(-s.uploadTTL)
+
+	var ids []string
+	if err := scope.Model(&models.ImageUpload{}).
+		Where("status = ? AND updated_at < ?", models.ImageUploadStatusPending, cutoff).
+		Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+	expired := 0
+	for _, id := range ids {
+		if s.expireUpload(id, cutoff) {
+			expired++
+		}
+	}
+	return expired, nil
+}
+
+// expireUpload aborts upload id if it is still pending and idle since cutoff; a chunk may
+// have arrived since it was selected.
+func (s *Store) expireUpload(id string, cutoff time.Time) bool {
+	unlock := s.lockUpload(id)
+	defer unlock()
+
+	upload, err := s.GetUpload(id)
+	if err != nil || upload.Status != models.ImageUploadStatusPending || !upload.UpdatedAt.Before(cutoff) {
+		return false
+	}
+	s.abort(upload)
+	logger.Log.Info("Image upload expired",
+		zap.String("upload_id", id),
+		zap.Int64("received_bytes", upload.ReceivedBytes),
+		zap.Uint("owner_id", upload.OwnerID))
+	return true
+}
+
+// StartUploadExpiry expires idle uploads every interval until Stop.
+// It does nothing if uploads never expire.
+func (s *Store) StartUploadExpiry(interval time.Duration) {
+	if s.uploadTTL <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if n, err := s.ExpireUploads(); err != nil {
+				logger.Log.Warn("Image upload expiry failed", zap.Error(err))
+			} else if n > 0 {
+				logger.Log.Info("Expired idle image uploads", zap.Int("count", n))
+			}
+			select {
+			case <-ticker.C:
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the upload expiry loop.
+func (s *Store) Stop() {
+	s.stopOnce.Do(func() { close(s.stop) })
+}
+
+func (s *Store) abort(upload *models.ImageUpload) {
+	if err := os.Remove(s.partPath(upload.ID)); err != nil && !os.IsNotExist(err) {
+		logger.Log.Warn("Failed to remove upload file", zap.String("upload_id", upload.ID), zap.Error(err))
+	}
+	upload.Status = models.ImageUploadStatusAborted
+	if err := s.db.Save(upload).Error; err != nil {
+		logger.Log.Warn("Failed to mark upload aborted", zap.String("upload_id", upload.ID), zap.Error(err))
+	}
+	s.locks.Delete(upload.ID)
+}
+
+func (s *Store) partPath(id string) string {
+	return filepath.Join(s.uploadDir, id+".part")
+}
+
+func (s *Store) lockUpload(id string) func() {
+	v, _ := s.locks.LoadOrStore(id, &sync.Mutex{})
+	mu := v.(*sync.Mutex)
+	mu.Lock()
+	return mu.Unlock
+}
@@ -0,0 +1,115 @@
+package images
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ISO9660 volume descriptors start at sector 16 (0x8000); the standard
+// identifier "CD001" follows the one-byte descriptor type.
+const (
+	iso9660MagicOffset = 0x8001
+	qcow2MagicOffset   = 0
+)
+
+var (
+	iso9660Magic = []byte("CD001")
+	qcow2Magic   = []byte{'Q', 'F', 'I', 0xfb}
+)
+
+// Supported image file extensions.
+var supportedExtensions = map[string]bool{
+	".iso":   true,
+	".img":   true,
+	".qcow2": true,
+}
+
+// IsSupportedExtension reports whether filename has an image extension we accept.
+func IsSupportedExtension(filename string) bool {
+	return supportedExtensions[strings.ToLower(filepath.Ext(filename))]
+}
+
+// IsISOFilename reports whether filename refers to installation media rather than a disk image.
+func IsISOFilename(filename string) bool {
+	ext := strings.ToLower(filepath.Ext(filename))
+	return ext == ".iso" || ext == ".img"
+}
+
+// VerifyImageFormat checks the file's magic bytes against its extension.
+// .iso files must be ISO9660 media and .qcow2 files must carry the qcow2 header. .img
+// files are ISO9660 media or raw disk images, which have no magic: they only must not
+// be qcow2 images, which a raw disk would expose to the guest (and their backing files
+// to the host).
+func VerifyImageFormat(path, filename string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	ext := strings.ToLower(filepath.Ext(filename))
+	switch ext {
+	case ".iso":
+		return checkMagic(f, iso9660MagicOffset, iso9660Magic, ext)
+	case ".qcow2":
+		return checkMagic(f, qcow2MagicOffset, qcow2Magic, ext)
+	case ".img":
+		if err := checkMagic(f, qcow2MagicOffset, qcow2Magic, ext); err == nil {
+			return fmt.Errorf("%w: .img file is a qcow2 image", ErrInvalidImage)
+		} else if !errors.Is(err, ErrInvalidImage) {
+			return err
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: unsupported extension %q", ErrInvalidImage, filepath.Ext(filename))
+	}
+}
+
+// checkMagic checks that f holds magic at offset.
+func checkMagic(f *os.File, offset int64, magic []byte, ext string) error {
+	buf := make([]byte, len(magic))
+	if _, err := f.ReadAt(buf, offset); err != nil {
+		if err == io.EOF {
+			return fmt.Errorf("%w: file too small", ErrInvalidImage)
+		}
+		return err
+	}
+	if !bytes.Equal(buf, magic) {
+		return fmt.Errorf("%w: bad magic for %s", ErrInvalidImage, ext)
+	}
+	return nil
+}
+
+// FileSHA256 returns the hex-encoded SHA-256 of the file at path.
+func FileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// NormalizeSHA256 lower-cases a hex digest and validates its length and alphabet.
+func NormalizeSHA256(sum string) (string, error) {
+	sum = strings.ToLower(strings.TrimSpace(sum))
+	if len(sum) != sha256.Size*2 {
+		return "", fmt.Errorf("sha256 must be %d hex characters", sha256.Size*2)
+	}
+	if _, err := hex.DecodeString(sum); err != nil {
+		return "", fmt.Errorf("sha256 must be hex encoded")
+	}
+	return sum, nil
+}
@@ -0,0 +1,200 @@
+package ldap
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// BER identifier classes and the universal tags LDAP uses (X.690).
+const (
+	classUniversal   = 0x00
+	classApplication = 0x40
+	classContext     = 0x80
+
+	tagBoolean     = 0x01
+	tagInteger     = 0x02
+	tagOctetString = 0x04
+	tagEnumerated  = 0x0a
+	tagSequence    = 0x10
+	tagSet         = 0x11
+)
+
+// maxPacketSize bounds the messages LIMEN reads from a directory.
+const maxPacketSize = 1 << 20
+
+var errMalformed = errors.New("malformed LDAP message")
+
+// packet is a BER element: a primitive value or a constructed list of children.
+type packet struct {
+	class       byte
+	constructed bool
+	tag         byte
+	value       []byte
+	children    []*packet
+}
+
+func newSequence(children ...*packet) *packet {
+	return &packet{class: classUniversal, constructed: true, tag: tagSequence, children: children}
+}
+
+func newConstructed(class, tag byte, children ...*packet) *packet {
+	return &packet{class: class, constructed: true, tag: tag, children: children}
+}
+
+func newPrimitive(class, tag byte, value []byte) *packet {
+	return &packet{class: class, tag: tag, value: value}
+}
+
+func newString(s string) *packet {
+	return newPrimitive(classUniversal, tagOctetString, []byte(s))
+}
+
+func newBool(b bool) *packet {
+	if b {
+		return newPrimitive(classUniversal, tagBoolean, []byte{0xff})
+	}
+	return newPrimitive(classUniversal, tagBoolean, []byte{0})
+}
+
+func newInt(tag byte, n int64) *packet {
+	// Minimal two's complement encoding
+	b := []byte{byte(n)}
+	for n > 0x7f || n < -0x80 {
+		n >>= 8
+		b = append([]byte{byte(n)}, b...)
+	}
+	return newPrimitive(classUniversal, tag, b)
+}
+
+// is reports whether p has the given class and tag.
+func (p *packet) is(class, tag byte) bool {
+	return p != nil && p.class == class && p.tag == tag
+}
+
+// child returns the i-th child of p, or nil.
+func (p *packet) child(i int) *packet {
+	if p == nil || i >= len(p.children) {
+		return nil
+	}
+	return p.children[i]
+}
+
+func (p *packet) str() string {
+	if p == nil {
+		return ""
+	}
+	return string(p.value)
+}
+
+func (p *packet) int() (int64, error) {
+	if p == nil || p.constructed || len(p.value) == 0 || len(p.value) > 8 {
+		return 0, errMalformed
+	}
+	n := int64(int8(p.value[0]))
+	for _, b := range p.value[1:] {
+		n = n<<8 | int64(b)
+	}
+	return n, nil
+}
+
+// bytes returns the BER encoding of p.
+func (p *packet) bytes() []byte {
+	content := p.value
+	if p.constructed {
+		content = nil
+		for _, c := range p.children {
+			content = append(content, c.bytes()...)
+		}
+	}
+	id := p.class | p.tag
+	if p.constructed {
+		id |= 0x20
+	}
+	out := []byte{id}
+	if n := len(content); n < 0x80 {
+		out = append(out, byte(n))
+	} else {
+		var length []byte
+		for ; n > 0; n >>= 8 {
+			length = append([]byte{byte(n)}, length...)
+		}
+		out = append(append(out, 0x80|byte(len(length))), length...)
+	}
+	return append(out, content...)
+}
+
+// readPacket reads one BER element from r.
+func readPacket(r *bufio.Reader) (*packet, error) {
+	id, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if id&0x1f == 0x1f {
+		return nil, fmt.Errorf("%w: multi-byte tag", errMalformed)
+	}
+	first, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	length := int(first)
+	if first&0x80 != 0 {
+		n := int(first & 0x7f)
+		if n == 0 || n > 4 {
+			return nil, fmt.Errorf("%w: length of %d bytes", errMalformed, n)
+		}
+		length = 0
+		for i := 0; i < n; i++ {
+			b, err := r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			length = length<<8 | int(b)
+		}
+	}
+	if length > maxPacketSize {
+		return nil, fmt.Errorf("%w: %d bytes", errMalformed, length)
+	}
+	content := make([]byte, length)
+	if _, err := io.ReadFull(r, content); err != nil {
+		return nil, err
+	}
+	return parsePacket(id, content)
+}
+
+// parsePacket decodes the element with identifier id and contents content.
+func parsePacket(id byte, content []byte) (*packet, error) {
+	p := &packet{class: id & 0xc0, constructed: id&0x20 != 0, tag: id & 0x1f}
+	if !p.constructed {
+		p.value = content
+		return p, nil
+	}
+	for len(content) > 0 {
+		if len(content) < 2 || content[0]&0x1f == 0x1f {
+			return nil, errMalformed
+		}
+		childID, length, rest := content[0], int(content[1]), content[2:]
+		if length&0x80 != 0 {
+			n := length & 0x7f
+			if n == 0 || n > 4 || len(rest) < n {
+				return nil, errMalformed
+			}
+			length = 0
+			for _, b := range rest[:n] {
+				length = length<<8 | int(b)
+			}
+			rest = rest[n:]
+		}
+		if length < 0 || length > len(rest) {
+			return nil, errMalformed
+		}
+		child, err := parsePacket(childID, rest[:length])
+		if err != nil {
+			return nil, err
+		}
+		p.children = append(p.children, child)
+		content = rest[length:]
+	}
+	return p, nil
+}
@@ -0,0 +1,238 @@
+// Package ldap authenticates LIMEN users against an LDAP directory: it finds the user
+// with a search, checks their password with a bind, and keeps their LIMEN user in sync
+// with the directory's groups.
+package ldap
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/DARC0625/LIMEN/backend/internal/auth"
+	"github.com/DARC0625/LIMEN/backend/internal/logger"
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"github.com/DARC0625/LIMEN/backend/internal/validator"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// DefaultTimeout bounds each login's exchange with the directory.
+const DefaultTimeout = 10 * time.Second
+
+// Config identifies the directory and how users are found in it.
+type Config struct {
+	URL               string // ldap://host[:389] or ldaps://host[:636]
+	StartTLS          bool   // Upgrade ldap:// connections with StartTLS
+	CACertFile        string // PEM certificates of the CAs trusted for the directory (empty = system roots)
+	BindDN            string // Service account searching for users (empty = anonymous search)
+	BindPassword      string
+	BaseDN            string // Subtree searched for users
+	UserFilter        string // Filter finding a user, %s standing for the username (default (uid=%s))
+	UsernameAttribute string // Attribute holding the username (default uid)
+	EmailAttribute    string // Attribute holding the email address (default mail)
+	GroupAttribute    string // Attribute listing the user's groups (default memberOf)
+	Mapping           auth.GroupMapping
+	Timeout           time.Duration // Default DefaultTimeout
+}
+
+// Authenticator is an auth.Authenticator of the users of an LDAP directory. Their LIMEN
+// user is created at their first login, and their role and flags follow the directory's
+// groups at every login as the mapping configures.
+type Authenticator struct {
+	db        *gorm.DB
+	cfg       Config
+	addr      string
+	tlsConfig *tls.Config // The connection's, or StartTLS's
+	startTLS  bool
+	issuer    string // Identifies the directory in ExternalIdentity records
+	now       func() time.Time
+}
+
+// NewAuthenticator returns an Authenticator of the directory cfg describes, or an error
+// if the configuration is invalid.
+func NewAuthenticator(db *gorm.DB, cfg Config) (*Authenticator, error) {
+	if cfg.UserFilter == "" {
+		cfg.UserFilter = "(uid=%s)"
+	}
+	if cfg.UsernameAttribute == "" {
+		cfg.UsernameAttribute = "uid"
+	}
+	if cfg.EmailAttribute == "" {
+		cfg.EmailAttribute = "mail"
+	}
+	if cfg.GroupAttribute == "" {
+		cfg.GroupAttribute = "memberOf"
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if cfg.BaseDN == "" {
+		return nil, errors.New("LDAP base DN is required")
+	}
+	if !strings.Contains(cfg.UserFilter, "%s") {
+		return nil, fmt.Errorf("LDAP user filter %q doesn't contain %%s", cfg.UserFilter)
+	}
+	if _, err := compileFilter(strings.ReplaceAll(cfg.UserFilter, "%s", "x")); err != nil {
+		return nil, err
+	}
+
+	u, err := url.Parse(cfg.URL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid LDAP URL %q", cfg.URL)
+	}
+	a := &Authenticator{db: db, cfg: cfg, issuer: "ldap:" + strings.ToLower(cfg.BaseDN), now: time.Now}
+	port := "389"
+	switch u.Scheme {
+	case "ldap":
+		a.startTLS = cfg.StartTLS
+	case "ldaps":
+		port = "636"
+		if cfg.StartTLS {
+			return nil, errors.New("StartTLS is for ldap:// URLs; ldaps:// connections use TLS already")
+		}
+	default:
+		return nil, fmt.Errorf("invalid LDAP URL scheme %q", u.Scheme)
+	}
+	a.addr = u.Host
+	if u.Port() == "" {
+		a.addr = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	if u.Scheme == "ldaps" || cfg.StartTLS {
+		a.tlsConfig = &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12}
+		if cfg.CACertFile != "" {
+			caPEM, err := os.ReadFile(cfg.CACertFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read LDAP CA certificate: %w", err)
+			}
+			a.tlsConfig.RootCAs = x509.NewCertPool()
+			if !a.tlsConfig.RootCAs.AppendCertsFromPEM(caPEM) {
+				return nil, fmt.Errorf("no certificates found in %s", cfg.CACertFile)
+			}
+		}
+	}
+	return a, nil
+}
+
+// Name implements auth.Authenticator.
+func (a *Authenticator) Name() string {
+	return "ldap"
+}
+
+// Authenticate implements auth.Authenticator.
+func (a *Authenticator) Authenticate(ctx context.Context, username, password string) (*models.User, error) {
+	// Binds without a password are anonymous, and succeed
+	if password == "" {
+		return nil, auth.ErrInvalidCredentials
+	}
+	if validator.ValidateUsername(username) != nil {
+		return nil, auth.ErrUnknownUser
+	}
+
+	found, err := a.verify(ctx, username, password)
+	if err != nil {
+		return nil, err
+	}
+	name := username
+	if values := found.get(a.cfg.UsernameAttribute); len(values) > 0 && validator.ValidateUsername(values[0]) == nil {
+		name = values[0]
+	}
+	var email string
+	if values := found.get(a.cfg.EmailAttribute); len(values) > 0 {
+		email = values[0]
+	}
+	return a.provision(name, email, found.get(a.cfg.GroupAttribute))
+}
+
+// verify finds the entry of username and binds as it with password.
+func (a *Authenticator) verify(ctx context.Context, username, password string) (*entry, error) {
+	var tlsConfig *tls.Config
+	if !a.startTLS {
+		tlsConfig = a.tlsConfig
+	}
+	c, err := dial(ctx, a.addr, tlsConfig, a.now().Add(a.cfg.Timeout))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to LDAP server: %w", err)
+	}
+	defer c.close()
+	if a.startTLS {
+		if err := c.startTLS(a.tlsConfig); err != nil {
+			return nil, err
+		}
+	}
+	if a.cfg.BindDN != "" {
+		if err := c.bind(a.cfg.BindDN, a.cfg.BindPassword); err != nil {
+			return nil, fmt.Errorf("LDAP service account bind failed: %w", err)
+		}
+	}
+
+	filter, err := compileFilter(strings.ReplaceAll(a.cfg.UserFilter, "%s", EscapeFilter(username)))
+	if err != nil {
+		return nil, err
+	}
+	entries, err := c.search(a.cfg.BaseDN, filter,
+		[]string{a.cfg.UsernameAttribute, a.cfg.EmailAttribute, a.cfg.GroupAttribute}, 2)
+	if err != nil {
+		return nil, fmt.Errorf("LDAP user search failed: %w", err)
+	}
+	switch len(entries) {
+	case 0:
+		return nil, auth.ErrUnknownUser
+	case 1:
+	default:
+		return nil, fmt.Errorf("LDAP user filter matches several entries for %q", username)
+	}
+
+	if err := c.bind(entries[0].DN, password); err != nil {
+		var resultErr *ResultError
+		if errors.As(err, &resultErr) && resultErr.Code == resultInvalidCredentials {
+			return nil, auth.ErrInvalidCredentials
+		}
+		return nil, err
+	}
+	return entries[0], nil
+}
+
+// provision returns the LIMEN user of the directory user username, creating it at their
+// first login, with the attributes their groups grant.
+func (a *Authenticator) provision(username, email string, groups []string) (*models.User, error) {
+	subject := strings.ToLower(username)
+	user, created, err := auth.ProvisionExternalUser(a.db, a.cfg.Mapping, auth.ExternalLogin{
+		Issuer:  a.issuer,
+		Subject: subject,
+		Email:   email,
+		Groups:  groups,
+		Username: func(tx *gorm.DB) (string, error) {
+			// A local user of the same name isn't proof they are the same person: they
+			// keep logging in with their LIMEN password until an admin removes them
+			var count int64
+			if err := tx.Unscoped().Model(&models.User{}).Where("LOWER(username) = ?", subject).Count(&count).Error; err != nil {
+				return "", err
+			}
+			if count > 0 {
+				logger.Log.Warn("LDAP user conflicts with an existing LIMEN user; not linked", zap.String("username", username))
+				return "", auth.ErrUnknownUser
+			}
+			return username, nil
+		},
+	}, a.now())
+	if errors.Is(err, auth.ErrExternalUserDeleted) {
+		logger.Log.Warn("LDAP login of a deleted user", zap.String("username", username))
+		return nil, auth.ErrUnknownUser
+	}
+	if err != nil {
+		return nil, err
+	}
+	if created {
+		logger.Log.Info("User provisioned from LDAP", zap.Uint("user_id", user.ID), zap.String("username", user.Username),
+			zap.String("role", string(user.Role)), zap.Bool("approved", user.Approved))
+	}
+	return user, nil
+}
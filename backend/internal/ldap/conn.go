@@ -0,0 +1,209 @@
+package ldap
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// Protocol operations (RFC 4511 4.2).
+const (
+	opBindRequest           = 0
+	opBindResponse          = 1
+	opUnbindRequest         = 2
+	opSearchRequest         = 3
+	opSearchResultEntry     = 4
+	opSearchResultDone      = 5
+	opSearchResultReference = 19
+	opExtendedRequest       = 23
+	opExtendedResponse      = 24
+)
+
+// Result codes LIMEN tells apart (RFC 4511 A.1).
+const (
+	resultSuccess            = 0
+	resultInvalidCredentials = 49
+)
+
+// oidStartTLS names the StartTLS extended operation (RFC 4511 4.14).
+const oidStartTLS = "1.3.6.1.4.1.1466.20037"
+
+// ResultError is an operation the directory didn't complete.
+type ResultError struct {
+	Code    int64
+	Message string
+}
+
+func (e *ResultError) Error() string {
+	return fmt.Sprintf("LDAP result code %d: %s", e.Code, e.Message)
+}
+
+// entry is a search result.
+type entry struct {
+	DN    string
+	attrs map[string][]string // By lowercase attribute name
+}
+
+// get returns the values of attribute attr.
+func (e *entry) get(attr string) []string {
+	return e.attrs[strings.ToLower(attr)]
+}
+
+// conn is a connection to a directory server. Its operations are synchronous.
+type conn struct {
+	nc    net.Conn
+	r     *bufio.Reader
+	msgID int64
+}
+
+// dial connects to addr, over TLS when tlsConfig is set, and bounds the whole exchange
+// by deadline.
+func dial(ctx context.Context, addr string, tlsConfig *tls.Config, deadline time.Time) (*conn, error) {
+	var d net.Dialer
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+	nc, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	nc.SetDeadline(deadline)
+	if tlsConfig != nil {
+		tc := tls.Client(nc, tlsConfig)
+		if err := tc.HandshakeContext(ctx); err != nil {
+			nc.Close()
+			return nil, err
+		}
+		nc = tc
+	}
+	return &conn{nc: nc, r: bufio.NewReader(nc)}, nil
+}
+
+// roundTrip sends the protocol operation op and returns the first response to it.
+func (c *conn) roundTrip(op *packet) (*packet, error) {
+	c.msgID++
+	if _, err := c.nc.Write(newSequence(newInt(tagInteger, c.msgID), op).bytes()); err != nil {
+		return nil, err
+	}
+	return c.receive()
+}
+
+// receive returns the protocol operation of the next response to the last request.
+func (c *conn) receive() (*packet, error) {
+	for {
+		msg, err := readPacket(c.r)
+		if err != nil {
+			return nil, err
+		}
+		id, err := msg.child(0).int()
+		if err != nil || len(msg.children) < 2 {
+			return nil, errMalformed
+		}
+		switch id {
+		case c.msgID:
+			return msg.child(1), nil
+		case 0:
+			// Notice of disconnection
+			return nil, fmt.Errorf("directory closed the connection: %w", result(msg.child(1)))
+		}
+	}
+}
+
+// result returns the error of a response's LDAPResult, or nil when it succeeded.
+func result(op *packet) error {
+	code, err := op.child(0).int()
+	if err != nil {
+		return errMalformed
+	}
+	if code != resultSuccess {
+		return &ResultError{Code: code, Message: op.child(2).str()}
+	}
+	return nil
+}
+
+// startTLS upgrades the connection to TLS.
+func (c *conn) startTLS(tlsConfig *tls.Config) error {
+	resp, err := c.roundTrip(newConstructed(classApplication, opExtendedRequest,
+		newPrimitive(classContext, 0, []byte(oidStartTLS))))
+	if err != nil {
+		return err
+	}
+	if !resp.is(classApplication, opExtendedResponse) {
+		return errMalformed
+	}
+	if err := result(resp); err != nil {
+		return fmt.Errorf("StartTLS refused: %w", err)
+	}
+	tc := tls.Client(c.nc, tlsConfig)
+	if err := tc.Handshake(); err != nil {
+		return err
+	}
+	c.nc, c.r = tc, bufio.NewReader(tc)
+	return nil
+}
+
+// bind authenticates the connection as dn with a simple bind.
+func (c *conn) bind(dn, password string) error {
+	resp, err := c.roundTrip(newConstructed(classApplication, opBindRequest,
+		newInt(tagInteger, 3), newString(dn), newPrimitive(classContext, 0, []byte(password))))
+	if err != nil {
+		return err
+	}
+	if !resp.is(classApplication, opBindResponse) {
+		return errMalformed
+	}
+	return result(resp)
+}
+
+// search returns the entries under baseDN matching filter, with attributes attrs, and
+// at most sizeLimit of them.
+func (c *conn) search(baseDN string, filter *packet, attrs []string, sizeLimit int64) ([]*entry, error) {
+	attributes := newSequence()
+	for _, a := range attrs {
+		attributes.children = append(attributes.children, newString(a))
+	}
+	resp, err := c.roundTrip(newConstructed(classApplication, opSearchRequest,
+		newString(baseDN),
+		newInt(tagEnumerated, 2), // wholeSubtree
+		newInt(tagEnumerated, 0), // neverDerefAliases
+		newInt(tagInteger, sizeLimit),
+		newInt(tagInteger, 0), // No time limit but the connection's
+		newBool(false),
+		filter,
+		attributes))
+
+	var entries []*entry
+	for ; err == nil; resp, err = c.receive() {
+		switch {
+		case resp.is(classApplication, opSearchResultEntry):
+			e := &entry{DN: resp.child(0).str(), attrs: make(map[string][]string)}
+			for _, attr := range resp.child(1).children {
+				name := strings.ToLower(attr.child(0).str())
+				for _, v := range attr.child(1).children {
+					e.attrs[name] = append(e.attrs[name], v.str())
+				}
+			}
+			entries = append(entries, e)
+		case resp.is(classApplication, opSearchResultReference):
+			// Referrals to other servers aren't followed
+		case resp.is(classApplication, opSearchResultDone):
+			if err := result(resp); err != nil {
+				return nil, err
+			}
+			return entries, nil
+		default:
+			return nil, errMalformed
+		}
+	}
+	return nil, err
+}
+
+// close unbinds and closes the connection.
+func (c *conn) close() {
+	c.msgID++
+	c.nc.Write(newSequence(newInt(tagInteger, c.msgID), newPrimitive(classApplication, opUnbindRequest, nil)).bytes())
+	c.nc.Close()
+}
@@ -0,0 +1,319 @@
+package ldap
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DARC0625/LIMEN/backend/internal/auth"
+	"github.com/DARC0625/LIMEN/backend/internal/logger"
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// testDirectory is an LDAP server on localhost holding a few entries. It only serves
+// bound connections upgraded with StartTLS.
+type testDirectory struct {
+	t         *testing.T
+	addr      string
+	tlsConfig *tls.Config
+	caFile    string
+
+	mu        sync.Mutex
+	passwords map[string]string // By DN, including the service account's
+	entries   map[string]map[string][]string
+}
+
+func newTestDirectory(t *testing.T) *testDirectory {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate() error = %v", err)
+	}
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	d := &testDirectory{
+		t:         t,
+		addr:      ln.Addr().String(),
+		tlsConfig: &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}},
+		caFile:    caFile,
+		passwords: map[string]string{"cn=limen,ou=services,dc=example,dc=org": "service-password"},
+		entries:   make(map[string]map[string][]string),
+	}
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go d.serve(nc)
+		}
+	}()
+	return d
+}
+
+func (d *testDirectory) add(uid, password string, groups ...string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	dn := "uid=" + uid + ",ou=people,dc=example,dc=org"
+	d.passwords[dn] = password
+	d.entries[dn] = map[string][]string{"objectClass": {"person"}, "uid": {uid}, "mail": {uid + "@example.org"}, "memberOf": groups}
+}
+
+func (d *testDirectory) serve(nc net.Conn) {
+	defer nc.Close()
+	r := bufio.NewReader(nc)
+	var secure bool
+	var bound string
+	reply := func(id int64, op byte, code int64, extra ...*packet) {
+		resp := newConstructed(classApplication, op, append([]*packet{newInt(tagEnumerated, code), newString(""), newString("")}, extra...)...)
+		nc.Write(newSequence(newInt(tagInteger, id), resp).bytes())
+	}
+	for {
+		msg, err := readPacket(r)
+		if err != nil {
+			return
+		}
+		id, _ := msg.child(0).int()
+		op := msg.child(1)
+		switch {
+		case op.is(classApplication, opExtendedRequest):
+			reply(id, opExtendedResponse, resultSuccess)
+			tc := tls.Server(nc, d.tlsConfig)
+			if tc.Handshake() != nil {
+				return
+			}
+			nc, r, secure = tc, bufio.NewReader(tc), true
+		case op.is(classApplication, opBindRequest):
+			d.mu.Lock()
+			want, ok := d.passwords[op.child(1).str()]
+			d.mu.Unlock()
+			if !secure || !ok || op.child(2).str() != want {
+				reply(id, opBindResponse, resultInvalidCredentials)
+				continue
+			}
+			bound = op.child(1).str()
+			reply(id, opBindResponse, resultSuccess)
+		case op.is(classApplication, opSearchRequest):
+			if !strings.HasPrefix(bound, "cn=limen") {
+				reply(id, opSearchResultDone, 50) // insufficientAccessRights
+				continue
+			}
+			d.mu.Lock()
+			for dn, attrs := range d.entries {
+				if !d.match(op.child(6), attrs) {
+					continue
+				}
+				list := newSequence()
+				for name, values := range attrs {
+					set := newConstructed(classUniversal, tagSet)
+					for _, v := range values {
+						set.children = append(set.children, newString(v))
+					}
+					list.children = append(list.children, newSequence(newString(name), set))
+				}
+				entry := newConstructed(classApplication, opSearchResultEntry, newString(dn), list)
+				nc.Write(newSequence(newInt(tagInteger, id), entry).bytes())
+			}
+			d.mu.Unlock()
+			reply(id, opSearchResultDone, resultSuccess)
+		case op.is(classApplication, opUnbindRequest):
+			return
+		}
+	}
+}
+
+// match evaluates the and, equality and present filters the tests use.
+func (d *testDirectory) match(filter *packet, attrs map[string][]string) bool {
+	switch {
+	case filter.is(classContext, filterAnd):
+		for _, f := range filter.children {
+			if !d.match(f, attrs) {
+				return false
+			}
+		}
+		return true
+	case filter.is(classContext, filterPresent):
+		_, ok := attrs[filter.str()]
+		return ok
+	case filter.is(classContext, filterEqualityMatch):
+		for name, values := range attrs {
+			if strings.EqualFold(name, filter.child(0).str()) {
+				for _, v := range values {
+					if strings.EqualFold(v, filter.child(1).str()) {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+func newTestAuthenticator(t *testing.T, d *testDirectory) (*Authenticator, *gorm.DB) {
+	logger.Init("debug")
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.ExternalIdentity{}); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+	a, err := NewAuthenticator(db, Config{
+		URL:          "ldap://" + d.addr,
+		StartTLS:     true,
+		CACertFile:   d.caFile,
+		BindDN:       "cn=limen,ou=services,dc=example,dc=org",
+		BindPassword: "service-password",
+		BaseDN:       "ou=people,dc=example,dc=org",
+		UserFilter:   "(&(objectClass=person)(uid=%s))",
+		Mapping: auth.GroupMapping{
+			AdminGroups:    []string{"cn=lab-admins,ou=groups,dc=example,dc=org"},
+			ApprovedGroups: []string{"cn=lab-members,ou=groups,dc=example,dc=org", "cn=lab-admins,ou=groups,dc=example,dc=org"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewAuthenticator() error = %v", err)
+	}
+	return a, db
+}
+
+func TestAuthenticator_LoginAndSync(t *testing.T) {
+	d := newTestDirectory(t)
+	d.add("alice", "alice-password", "cn=lab-admins,ou=groups,dc=example,dc=org")
+	a, db := newTestAuthenticator(t, d)
+	ctx := context.Background()
+
+	user, err := a.Authenticate(ctx, "alice", "alice-password")
+	if err != nil || user.Username != "alice" || user.Role != models.RoleAdmin || !user.Approved {
+		t.Fatalf("Authenticate() = %+v, %v; want an approved admin", user, err)
+	}
+	var link models.ExternalIdentity
+	if db.Where("user_id = ?", user.ID).First(&link); link.Subject != "alice" || link.Email != "alice@example.org" {
+		t.Errorf("identity = %+v", link)
+	}
+
+	// Role and approval follow the directory at every login
+	d.add("alice", "alice-password", "cn=lab-members,ou=groups,dc=example,dc=org")
+	again, err := a.Authenticate(ctx, "alice", "alice-password")
+	if err != nil || again.ID != user.ID || again.Role != models.RoleUser || !again.Approved {
+		t.Errorf("second Authenticate() = %+v, %v; want the same user, demoted", again, err)
+	}
+
+	if _, err := a.Authenticate(ctx, "alice", "wrong"); !errors.Is(err, auth.ErrInvalidCredentials) {
+		t.Errorf("wrong password error = %v, want ErrInvalidCredentials", err)
+	}
+	if _, err := a.Authenticate(ctx, "alice", ""); !errors.Is(err, auth.ErrInvalidCredentials) {
+		t.Errorf("empty password error = %v, want ErrInvalidCredentials", err)
+	}
+	for _, username := range []string{"nobody", "*", "alice)(uid=*"} {
+		if _, err := a.Authenticate(ctx, username, "alice-password"); !errors.Is(err, auth.ErrUnknownUser) {
+			t.Errorf("Authenticate(%q) error = %v, want ErrUnknownUser", username, err)
+		}
+	}
+}
+
+func TestAuthenticator_DoesNotTakeOverLocalUsers(t *testing.T) {
+	d := newTestDirectory(t)
+	d.add("bob", "directory-password")
+	a, db := newTestAuthenticator(t, d)
+	db.Create(&models.User{Username: "bob", Password: "local-hash", Role: models.RoleUser})
+
+	if _, err := a.Authenticate(context.Background(), "bob", "directory-password"); !errors.Is(err, auth.ErrUnknownUser) {
+		t.Errorf("Authenticate() of a local user's name error = %v, want ErrUnknownUser", err)
+	}
+}
+
+func TestAuthenticator_Unavailable(t *testing.T) {
+	d := newTestDirectory(t)
+	a, _ := newTestAuthenticator(t, d)
+	a.cfg.BindPassword = "rotated"
+	if _, err := a.Authenticate(context.Background(), "alice", "alice-password"); err == nil ||
+		errors.Is(err, auth.ErrInvalidCredentials) || errors.Is(err, auth.ErrUnknownUser) {
+		t.Errorf("Authenticate() with a wrong service password error = %v, want the directory's", err)
+	}
+
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	ln.Close()
+	a.addr = ln.Addr().String()
+	if _, err := a.Authenticate(context.Background(), "alice", "alice-password"); err == nil || errors.Is(err, auth.ErrUnknownUser) {
+		t.Errorf("Authenticate() with the server down error = %v", err)
+	}
+}
+
+func TestNewAuthenticator_InvalidConfig(t *testing.T) {
+	for _, cfg := range []Config{
+		{URL: "ldap://ldap.example.org"},
+		{URL: "http://ldap.example.org", BaseDN: "dc=example,dc=org"},
+		{URL: "ldaps://ldap.example.org", StartTLS: true, BaseDN: "dc=example,dc=org"},
+		{URL: "ldap://ldap.example.org", BaseDN: "dc=example,dc=org", UserFilter: "(uid=alice)"},
+		{URL: "ldap://ldap.example.org", BaseDN: "dc=example,dc=org", UserFilter: "(uid=%s"},
+	} {
+		if _, err := NewAuthenticator(nil, cfg); err == nil {
+			t.Errorf("NewAuthenticator(%+v) succeeded", cfg)
+		}
+	}
+}
+
+func TestCompileFilter(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   []byte
+	}{
+		{"(uid=a)", []byte{0xa3, 0x08, 0x04, 0x03, 'u', 'i', 'd', 0x04, 0x01, 'a'}},
+		{"(cn=*)", []byte{0x87, 0x02, 'c', 'n'}},
+		{"(cn=a*b)", []byte{0xa4, 0x0c, 0x04, 0x02, 'c', 'n', 0x30, 0x06, 0x80, 0x01, 'a', 0x82, 0x01, 'b'}},
+		{"(!(cn=\\2a))", []byte{0xa2, 0x09, 0xa3, 0x07, 0x04, 0x02, 'c', 'n', 0x04, 0x01, '*'}},
+		{"(&(a=1)(|(b=2)))", []byte{0xa0, 0x12, 0xa3, 0x06, 0x04, 0x01, 'a', 0x04, 0x01, '1', 0xa1, 0x08, 0xa3, 0x06, 0x04, 0x01, 'b', 0x04, 0x01, '2'}},
+	}
+	for _, tt := range tests {
+		p, err := compileFilter(tt.filter)
+		if err != nil {
+			t.Errorf("compileFilter(%q) error = %v", tt.filter, err)
+			continue
+		}
+		if got := p.bytes(); !bytes.Equal(got, tt.want) {
+			t.Errorf("compileFilter(%q) = % x, want % x", tt.filter, got, tt.want)
+		}
+	}
+	for _, filter := range []string{"uid=a", "(uid=a", "(uid=a))", "(=a)", "(cn:dn:=a)", "(cn=\\zz)"} {
+		if _, err := compileFilter(filter); err == nil {
+			t.Errorf("compileFilter(%q) succeeded", filter)
+		}
+	}
+
+	if got := EscapeFilter("a*(b)\\"); got != "a\\2a\\28b\\29\\5c" {
+		t.Errorf("EscapeFilter() = %q", got)
+	}
+}
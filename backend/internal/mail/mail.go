@@ -0,0 +1,123 @@
+// Package mail delivers email: alerts to operators and account mail (password resets,
+// email verification) to users.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Message is a plain text email.
+type Message struct {
+	To      []string
+	Subject string
+	Body    string
+}
+
+// Sender delivers messages.
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// headerValue strips line breaks, which would let values inject headers.
+var headerValue = strings.NewReplacer("\r", "", "\n", "")
+
+// Format returns msg as an RFC 5322 message from from.
+func Format(from string, msg Message, date time.Time) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", headerValue.Replace(from))
+	fmt.Fprintf(&buf, "To: %s\r\n", headerValue.Replace(strings.Join(msg.To, ", ")))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("UTF-8", headerValue.Replace(msg.Subject)))
+	fmt.Fprintf(&buf, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(strings.ReplaceAll(strings.ReplaceAll(msg.Body, "\r\n", "\n"), "\n", "\r\n"))
+	return buf.Bytes()
+}
+
+// SMTPSender sends messages through an SMTP server, authenticating with PLAIN when a
+// username is set.
+type SMTPSender struct {
+	host     string
+	port     int
+	username string
+	password string
+	from     string
+}
+
+// NewSMTPSender creates a sender through host:port, sending as from.
+func NewSMTPSender(host string, port int, username, password, from string) *SMTPSender {
+	return &SMTPSender{host: host, port: port, username: username, password: password, from: from}
+}
+
+// Send implements Sender.
+func (s *SMTPSender) Send(ctx context.Context, msg Message) error {
+	if s.host == "" {
+		return fmt.Errorf("no SMTP server configured")
+	}
+	var auth smtp.Auth
+	if s.username != "" {
+		auth = smtp.PlainAuth("", s.username, s.password, s.host)
+	}
+	addr := fmt.Sprintf("%s:%d", s.host, s.port)
+	return smtp.SendMail(addr, auth, s.from, msg.To, Format(s.from, msg, time.Now()))
+}
+
+// LogSender writes messages to the log instead of sending them, for development.
+// Account mail carries links that log their users in: don't use it in production.
+type LogSender struct {
+	logger *zap.Logger
+}
+
+// NewLogSender creates a sender logging to logger.
+func NewLogSender(logger *zap.Logger) *LogSender {
+	return &LogSender{logger: logger}
+}
+
+// Send implements Sender.
+func (s *LogSender) Send(ctx context.Context, msg Message) error {
+	s.logger.Info("Mail not sent (log sink)",
+		zap.Strings("to", msg.To),
+		zap.String("subject", msg.Subject),
+		zap.String("body", msg.Body))
+	return nil
+}
+
+// FileSender appends messages to a file instead of sending them, for development and
+// tests.
+type FileSender struct {
+	path string
+	from string
+	mu   sync.Mutex
+}
+
+// NewFileSender creates a sender appending messages from from to path.
+func NewFileSender(path, from string) *FileSender {
+	return &FileSender{path: path, from: from}
+}
+
+// Send implements Sender.
+func (s *FileSender) Send(ctx context.Context, msg Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Readable by the server only: messages carry password reset links
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(Format(s.from, msg, time.Now()), "\r\n\r\n"...)); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,56 @@
+package mail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormat(t *testing.T) {
+	msg := Message{
+		To:      []string{"alice@example.org"},
+		Subject: "Hello\r\nBcc: mallory@example.org",
+		Body:    "line one\nline two",
+	}
+	got := string(Format("limen@example.org", msg, time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)))
+
+	header, body, ok := strings.Cut(got, "\r\n\r\n")
+	if !ok {
+		t.Fatalf("Format() has no header/body separator: %q", got)
+	}
+	if strings.Contains(header, "\r\nBcc:") {
+		t.Errorf("Format() let the subject inject a header: %q", header)
+	}
+	for _, want := range []string{"From: limen@example.org\r\n", "To: alice@example.org\r\n", "Date: Mon, 19 Oct 2026 09:00:00 +0000\r\n"} {
+		if !strings.Contains(header, want) {
+			t.Errorf("Format() header lacks %q: %q", want, header)
+		}
+	}
+	if body != "line one\r\nline two" {
+		t.Errorf("Format() body = %q", body)
+	}
+}
+
+func TestFileSender(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mail.log")
+	sender := NewFileSender(path, "limen@example.org")
+	for _, subject := range []string{"first", "second"} {
+		if err := sender.Send(context.Background(), Message{To: []string{"alice@example.org"}, Subject: subject, Body: "link"}); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if !strings.Contains(string(data), "Subject: first") || !strings.Contains(string(data), "Subject: second") {
+		t.Errorf("file = %q, want both messages", data)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("file mode = %v, want 0600", info.Mode().Perm())
+	}
+}
@@ -31,7 +31,7 @@ func Admin(cfg *config.Config) func(http.Handler) http.Handler {
 					return
 				}
 
-				claims, err := auth.ValidateToken(tokenString, cfg.JWTSecret)
+				claims, err := auth.KeysFor(cfg).ValidateToken(tokenString)
 				if err != nil {
 					errors.WriteUnauthorized(w, "Invalid token")
 					return
@@ -40,7 +40,7 @@ func Admin(cfg *config.Config) func(http.Handler) http.Handler {
 			}
 
 			// Check if user is admin
-			if role != string(models.RoleAdmin) {
+			if !GetRoleStore(r.Context()).HasPermission(role, models.PermManageSystem) {
 				logger.Log.Warn("Admin access denied",
 					zap.String("role", role))
 				errors.WriteForbidden(w, "Admin access required")
@@ -59,11 +59,14 @@ func GetRole(ctx context.Context) (string, bool) {
 	return role, ok
 }
 
-// IsAdmin checks if the user in context is an admin.
+// GetRoleStore retrieves the role store from context, or nil (the built-in roles only)
+// outside the Auth middleware.
+func GetRoleStore(ctx context.Context) *auth.RoleStore {
+	roles, _ := ctx.Value(RoleStoreKey).(*auth.RoleStore)
+	return roles
+}
+
+// IsAdmin checks if the user in context is an admin: their role manages the system.
 func IsAdmin(ctx context.Context) bool {
-	role, ok := GetRole(ctx)
-	if !ok {
-		return false
-	}
-	return role == string(models.RoleAdmin)
+	return HasPermission(ctx, models.PermManageSystem)
 }
@@ -3,6 +3,7 @@ package middleware
 
 import (
 	"context"
+	stderrors "errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -11,15 +12,19 @@ import (
 	"github.com/DARC0625/LIMEN/backend/internal/config"
 	"github.com/DARC0625/LIMEN/backend/internal/errors"
 	"github.com/DARC0625/LIMEN/backend/internal/logger"
+	"github.com/DARC0625/LIMEN/backend/internal/models"
 	"go.uber.org/zap"
 )
 
 const UserIDKey contextKey = "user_id"
 const UsernameKey contextKey = "username"
 const BetaAccessKey contextKey = "beta_access"
+const APITokenIDKey contextKey = "api_token_id"
+const RoleStoreKey contextKey = "role_store"
 
-// Auth creates an authentication middleware that validates JWT tokens.
-func Auth(cfg *config.Config) func(http.Handler) http.Handler {
+// Auth creates an authentication middleware that validates JWT tokens and the personal
+// access tokens in tokens. The permissions of custom roles are resolved with roles.
+func Auth(cfg *config.Config, tokens *auth.APITokenStore, roles *auth.RoleStore) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Fix path if Envoy rewrites incorrectly (missing slashes)
@@ -71,13 +76,42 @@ func Auth(cfg *config.Config) func(http.Handler) http.Handler {
 			// Try to get access token from Authorization header first, then refresh token from cookie
 			var tokenString string
 			var claims *auth.Claims
+			var apiToken *models.APIToken
 			var err error
 
-			// 1. Try Authorization header (Access Token)
+			// 1. Try Authorization header (Access Token or personal access token)
 			authHeader := r.Header.Get("Authorization")
 			tokenString, err = auth.ExtractTokenFromHeader(authHeader)
-			if err == nil {
-				claims, err = auth.ValidateToken(tokenString, cfg.JWTSecret)
+			if err == nil && strings.HasPrefix(tokenString, auth.APITokenPrefix) {
+				// Personal access tokens never fall back to the cookie: scripts get their
+				// token's access, not that of a browser session
+				if tokens == nil {
+					errors.WriteUnauthorized(w, "Authentication required")
+					return
+				}
+				var user *models.User
+				apiToken, user, err = tokens.Authenticate(tokenString, ClientIP(r, cfg.TrustedProxies))
+				if err != nil {
+					if !stderrors.Is(err, auth.ErrInvalidAPIToken) {
+						logger.Log.Error("API token authentication failed", zap.Error(err))
+						errors.WriteInternalError(w, fmt.Errorf("authenticate API token: %w", err), false)
+						return
+					}
+					logger.Log.Warn("Invalid API token",
+						zap.String("path", r.URL.Path),
+						zap.String("method", r.Method))
+					errors.WriteUnauthorized(w, "Invalid or expired API token")
+					return
+				}
+				claims = &auth.Claims{
+					UserID:     user.ID,
+					Username:   user.Username,
+					Role:       string(user.Role),
+					Approved:   user.Approved,
+					BetaAccess: user.BetaAccess,
+				}
+			} else if err == nil {
+				claims, err = auth.KeysFor(cfg).ValidateToken(tokenString)
 				if err == nil {
 					logger.Log.Debug("Authenticated via Authorization header",
 						zap.String("path", r.URL.Path),
@@ -92,7 +126,7 @@ func Auth(cfg *config.Config) func(http.Handler) http.Handler {
 					logger.Log.Debug("Attempting authentication via refresh token cookie",
 						zap.String("path", r.URL.Path))
 
-					refreshClaims, refreshErr := auth.ValidateRefreshToken(refreshToken, cfg.JWTSecret)
+					refreshClaims, refreshErr := auth.KeysFor(cfg).ValidateRefreshToken(refreshToken)
 					if refreshErr != nil {
 						logger.Log.Debug("Refresh token validation failed",
 							zap.String("path", r.URL.Path),
@@ -107,7 +141,7 @@ func Auth(cfg *config.Config) func(http.Handler) http.Handler {
 								zap.Uint("user_id", refreshClaims.UserID))
 						} else {
 							// Generate new access token from refresh token
-							tokenString, err = auth.GenerateAccessToken(refreshClaims.UserID, refreshClaims.Username, refreshClaims.Role, refreshClaims.Approved, cfg.JWTSecret)
+							tokenString, err = auth.KeysFor(cfg).GenerateAccessToken(refreshClaims.UserID, refreshClaims.Username, refreshClaims.Role, refreshClaims.Approved)
 							if err == nil {
 								// Create claims from refresh token
 								claims = &auth.Claims{
@@ -150,7 +184,7 @@ func Auth(cfg *config.Config) func(http.Handler) http.Handler {
 
 			// Check if user is approved (admin users are always approved)
 			// This is a critical security check - unapproved users should not access the system
-			if !claims.Approved && claims.Role != "admin" {
+			if !claims.Approved && !roles.HasPermission(claims.Role, models.PermManageSystem) {
 				logger.Log.Warn("Unapproved user attempted access",
 					zap.Uint("user_id", claims.UserID),
 					zap.String("username", claims.Username),
@@ -159,11 +193,33 @@ func Auth(cfg *config.Config) func(http.Handler) http.Handler {
 				return
 			}
 
+			// Personal access tokens only reach the endpoints their scopes cover
+			if apiToken != nil {
+				scope, ok := auth.RequiredScope(r.Method, r.URL.Path)
+				if !ok || !auth.ScopeAllows(apiToken.ScopeList(), scope) {
+					logger.Log.Warn("API token scope denied",
+						zap.Uint("user_id", claims.UserID),
+						zap.Uint("api_token_id", apiToken.ID),
+						zap.String("path", r.URL.Path),
+						zap.String("required_scope", scope))
+					if !ok {
+						errors.WriteForbidden(w, "API tokens cannot access this endpoint")
+					} else {
+						errors.WriteForbidden(w, fmt.Sprintf("API token lacks the %s scope", scope))
+					}
+					return
+				}
+			}
+
 			// Add user info to context
 			ctx := context.WithValue(r.Context(), UserIDKey, claims.UserID)
 			ctx = context.WithValue(ctx, UsernameKey, claims.Username)
 			ctx = context.WithValue(ctx, RoleKey, claims.Role)
 			ctx = context.WithValue(ctx, BetaAccessKey, claims.BetaAccess)
+			ctx = context.WithValue(ctx, RoleStoreKey, roles)
+			if apiToken != nil {
+				ctx = context.WithValue(ctx, APITokenIDKey, apiToken.ID)
+			}
 
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
@@ -185,16 +241,21 @@ func IsPublicEndpoint(path string) bool {
 		"/api/metrics",      // Prometheus metrics endpoint (public)
 		"/api/auth/login",
 		"/api/auth/register",
-		"/api/auth/session",    // Session management endpoints (GET, POST, DELETE)
-		"/api/auth/refresh",    // Token refresh endpoint
-		"/api/public/waitlist", // Public waitlist registration (no auth required)
-		"/api/quota",           // Quota endpoint (session-based auth via refresh_token cookie)
-		"/agent",               // Agent reverse-proxy path (public metrics)
-		"/apiauth/login",       // Handle Envoy rewrite issue
-		"/apiauth/register",   // Handle Envoy rewrite issue
-		"/ws/vnc",              // WebSocket endpoints need special handling
-		"/vnc",                 // VNC WebSocket endpoint (with or without UUID)
-		"/vnc/",                // VNC WebSocket endpoint with UUID in path
+		"/api/auth/session",         // Session management endpoints (GET, POST, DELETE)
+		"/api/auth/refresh",         // Token refresh endpoint
+		"/api/auth/oidc",            // Single sign-on redirects (authenticated by the identity provider)
+		"/api/auth/password/forgot", // Password reset requests
+		"/api/auth/password/reset",  // Password resets (authenticated by the mailed token)
+		"/api/auth/email/verify",    // Email verification (authenticated by the mailed token)
+		"/api/public/waitlist",      // Public waitlist registration (no auth required)
+		"/api/quota",                // Quota endpoint (session-based auth via refresh_token cookie)
+		"/agent",                    // Agent reverse-proxy path (public metrics)
+		"/.well-known/jwks.json",    // JWT verification keys
+		"/apiauth/login",            // Handle Envoy rewrite issue
+		"/apiauth/register",         // Handle Envoy rewrite issue
+		"/ws/vnc",                   // WebSocket endpoints need special handling
+		"/vnc",                      // VNC WebSocket endpoint (with or without UUID)
+		"/vnc/",                     // VNC WebSocket endpoint with UUID in path
 	}
 
 	for _, publicPath := range publicPaths {
@@ -233,6 +294,13 @@ func GetBetaAccess(ctx context.Context) (bool, bool) {
 	return betaAccess, ok
 }
 
+// GetAPITokenID retrieves the ID of the personal access token authenticating the
+// request from context, if there is one.
+func GetAPITokenID(ctx context.Context) (uint, bool) {
+	tokenID, ok := ctx.Value(APITokenIDKey).(uint)
+	return tokenID, ok
+}
+
 // min returns the minimum of two integers
 func min(a, b int) int {
 	if a < b {
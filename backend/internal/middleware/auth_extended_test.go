@@ -5,8 +5,14 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/DARC0625/LIMEN/backend/internal/auth"
 	"github.com/DARC0625/LIMEN/backend/internal/config"
+	"github.com/DARC0625/LIMEN/backend/internal/crypto"
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
 )
 
 func TestIsPublicEndpoint(t *testing.T) {
@@ -85,7 +91,7 @@ func TestAuth_Middleware(t *testing.T) {
 		JWTSecret: "test-secret-key-for-testing-only-very-long-key",
 	}
 
-	middleware := Auth(cfg)
+	middleware := Auth(cfg, nil, nil)
 	if middleware == nil {
 		t.Fatal("Auth() returned nil middleware")
 	}
@@ -106,7 +112,7 @@ func TestAuth_PublicEndpoint(t *testing.T) {
 		JWTSecret: "test-secret-key-for-testing-only-very-long-key",
 	}
 
-	middleware := Auth(cfg)
+	middleware := Auth(cfg, nil, nil)
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	})
@@ -133,3 +139,124 @@ func TestAuth_PublicEndpoint(t *testing.T) {
 		})
 	}
 }
+
+func TestAuth_Ed25519Token(t *testing.T) {
+	key, _ := crypto.GenerateEd25519KeyPair()
+	cfg := &config.Config{JWTEd25519PrivateKey: key.EncodePrivateKey()}
+	var userID uint
+	wrapped := Auth(cfg, nil, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, _ = GetUserID(r.Context())
+	}))
+
+	token, err := auth.KeysFor(cfg).GenerateAccessToken(5, "alice", "user", true)
+	if err != nil {
+		t.Fatalf("GenerateAccessToken() error = %v", err)
+	}
+	req := httptest.NewRequest("GET", "/api/vms", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	wrapped.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || userID != 5 {
+		t.Errorf("status = %d, user = %d; want 200, user 5", w.Code, userID)
+	}
+
+	// HMAC tokens are not accepted once tokens are signed with Ed25519
+	legacy, _ := auth.GenerateAccessToken(5, "alice", "user", true, "test-secret")
+	req = httptest.NewRequest("GET", "/api/vms", nil)
+	req.Header.Set("Authorization", "Bearer "+legacy)
+	w = httptest.NewRecorder()
+	wrapped.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("HMAC token status = %d, want 401", w.Code)
+	}
+}
+
+func TestAuth_APIToken(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.APIToken{}); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+	tokens := auth.NewAPITokenStore(db)
+	alice := models.User{Username: "alice", Password: "x", Role: models.RoleUser, Approved: true}
+	db.Create(&alice)
+	_, token, err := tokens.Create(alice.ID, "ci", []string{"vm:read", "snapshot:*"}, time.Hour)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	var userID, tokenID uint
+	wrapped := Auth(&config.Config{JWTSecret: "test-secret"}, tokens, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, _ = GetUserID(r.Context())
+		tokenID, _ = GetAPITokenID(r.Context())
+	}))
+	request := func(method, path, bearer string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+bearer)
+		w := httptest.NewRecorder()
+		wrapped.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := request("GET", "/api/vms", token); code != http.StatusOK || userID != alice.ID || tokenID == 0 {
+		t.Errorf("GET /api/vms = %d, user %d, token %d; want 200 as alice with the token", code, userID, tokenID)
+	}
+	if code := request("POST", "/api/vms/0b1c/snapshots", token); code != http.StatusOK {
+		t.Errorf("POST snapshots = %d, want 200 with snapshot:*", code)
+	}
+	tests := []struct {
+		method, path string
+	}{
+		{"POST", "/api/vms"},             // vm:write missing
+		{"GET", "/api/vms/0b1c/console"}, // Console tickets need console:write
+		{"GET", "/api/auth/tokens"},      // Tokens can't manage tokens
+		{"GET", "/api/admin/users"},
+	}
+	for _, tt := range tests {
+		if code := request(tt.method, tt.path, token); code != http.StatusForbidden {
+			t.Errorf("%s %s = %d, want 403", tt.method, tt.path, code)
+		}
+	}
+
+	if code := request("GET", "/api/vms", token+"x"); code != http.StatusUnauthorized {
+		t.Errorf("unknown token = %d, want 401", code)
+	}
+	// Tokens act with the user's current approval
+	db.Model(&alice).Update("approved", false)
+	if code := request("GET", "/api/vms", token); code != http.StatusForbidden {
+		t.Errorf("token of an unapproved user = %d, want 403", code)
+	}
+}
+
+func TestAuth_CustomRolePermissions(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.Role{}); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+	roles := auth.NewRoleStore(db)
+	if _, err := roles.Create("support", "", []string{"audit.read"}); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	cfg := &config.Config{JWTSecret: "test-secret"}
+	request := func(roles *auth.RoleStore) int {
+		wrapped := Auth(cfg, nil, roles)(RequirePermission(models.PermAuditRead)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+		token, _ := auth.GenerateAccessToken(5, "bob", "support", true, cfg.JWTSecret)
+		req := httptest.NewRequest("GET", "/api/admin/audit", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		wrapped.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := request(roles); code != http.StatusOK {
+		t.Errorf("custom role with the permission: status = %d, want 200", code)
+	}
+	if code := request(nil); code != http.StatusForbidden {
+		t.Errorf("custom role without a role store: status = %d, want 403", code)
+	}
+}
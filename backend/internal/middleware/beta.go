@@ -37,7 +37,7 @@ func BetaAccess(cfg *config.Config) func(http.Handler) http.Handler {
 					return
 				}
 
-				claims, err := auth.ValidateToken(tokenString, cfg.JWTSecret)
+				claims, err := auth.KeysFor(cfg).ValidateToken(tokenString)
 				if err != nil {
 					errors.WriteUnauthorized(w, "Invalid token")
 					return
@@ -46,7 +46,7 @@ func BetaAccess(cfg *config.Config) func(http.Handler) http.Handler {
 			}
 
 			// Admin users always have beta access
-			if role == string(models.RoleAdmin) {
+			if GetRoleStore(r.Context()).HasPermission(role, models.PermManageSystem) {
 				next.ServeHTTP(w, r)
 				return
 			}
@@ -54,7 +54,7 @@ func BetaAccess(cfg *config.Config) func(http.Handler) http.Handler {
 			// Check beta access from token claims (faster, no DB query)
 			authHeader := r.Header.Get("Authorization")
 			if tokenString, err := auth.ExtractTokenFromHeader(authHeader); err == nil {
-				if claims, err := auth.ValidateToken(tokenString, cfg.JWTSecret); err == nil {
+				if claims, err := auth.KeysFor(cfg).ValidateToken(tokenString); err == nil {
 					if claims.BetaAccess {
 						next.ServeHTTP(w, r)
 						return
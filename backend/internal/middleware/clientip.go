@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ClientIP returns the address of the client that sent r. The connection's address is
+// used unless it comes from one of trustedProxies (IP addresses or CIDR ranges), whose
+// X-Forwarded-For and X-Real-IP headers are then believed: X-Forwarded-For is walked from
+// the right, skipping the trusted proxies, as entries further left are whatever the
+// client sent and would let it pick its own address.
+func ClientIP(r *http.Request, trustedProxies []string) string {
+	remote := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+	if !ipInList(remote, trustedProxies) {
+		return remote
+	}
+
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		hops := strings.Split(xff, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if net.ParseIP(hop) == nil {
+				return remote
+			}
+			if i == 0 || !ipInList(hop, trustedProxies) {
+				return hop
+			}
+		}
+	}
+	if xri := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(xri) != nil {
+		return xri
+	}
+	return remote
+}
+
+// ipInList reports whether ip matches one of list's addresses or CIDR ranges.
+func ipInList(ip string, list []string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, entry := range list {
+		if strings.Contains(entry, "/") {
+			if _, cidr, err := net.ParseCIDR(entry); err == nil && cidr.Contains(parsed) {
+				return true
+			}
+		} else if other := net.ParseIP(entry); other != nil && other.Equal(parsed) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted := []string{"127.0.0.1", "10.0.0.0/8"}
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        string
+		xRealIP    string
+		want       string
+	}{
+		{"direct client", "203.0.113.7:4000", "", "", "203.0.113.7"},
+		{"untrusted peer can't forge", "203.0.113.7:4000", "198.51.100.1", "198.51.100.2", "203.0.113.7"},
+		{"trusted proxy", "127.0.0.1:4000", "198.51.100.1", "", "198.51.100.1"},
+		{"spoofed entries left of the proxy", "127.0.0.1:4000", "1.2.3.4, 198.51.100.1", "", "198.51.100.1"},
+		{"chain of trusted proxies", "127.0.0.1:4000", "1.2.3.4, 198.51.100.1, 10.1.2.3", "", "198.51.100.1"},
+		{"only trusted hops", "127.0.0.1:4000", "10.1.2.3", "", "10.1.2.3"},
+		{"garbage hop", "127.0.0.1:4000", "1.2.3.4, not-an-ip", "", "127.0.0.1"},
+		{"x-real-ip from a trusted proxy", "10.0.0.5:4000", "", "198.51.100.1", "198.51.100.1"},
+		{"trusted proxy without headers", "127.0.0.1:4000", "", "", "127.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			if tt.xRealIP != "" {
+				req.Header.Set("X-Real-IP", tt.xRealIP)
+			}
+			if got := ClientIP(req, trusted); got != tt.want {
+				t.Errorf("ClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
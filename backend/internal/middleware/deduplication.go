@@ -78,6 +78,12 @@ func Deduplication() func(http.Handler) http.Handler {
 				return
 			}
 
+			if strings.HasPrefix(r.URL.Path, "/api/images/uploads") {
+				// Image upload chunks - bodies are large and must be streamed, not hashed
+				next.ServeHTTP(w, r)
+				return
+			}
+
 			// Generate request hash
 			requestHash, err := generateRequestHash(r)
 			if err != nil {
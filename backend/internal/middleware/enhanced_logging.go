@@ -61,14 +61,7 @@ func EnhancedLogging(cfg *config.Config) func(http.Handler) http.Handler {
 			userID := uint(0)
 			username := ""
 			if token := extractTokenFromRequest(r); token != "" {
-				var claims *auth.Claims
-				var err error
-				if cfg.JWTEd25519PrivateKey != "" {
-					claims, err = auth.ValidateToken(token, cfg.JWTEd25519PrivateKey)
-				} else {
-					claims, err = auth.ValidateToken(token, cfg.JWTSecret)
-				}
-				if err == nil && claims != nil {
+				if claims, err := auth.KeysFor(cfg).ValidateToken(token); err == nil && claims != nil {
 					userID = claims.UserID
 					username = claims.Username
 				}
@@ -188,6 +188,11 @@ func SetAlertManager(manager AlertManager) {
 	globalAlertManager = manager
 }
 
+// GetAlertManager returns the global alert manager, or nil if alerting is not set up.
+func GetAlertManager() AlertManager {
+	return globalAlertManager
+}
+
 // Recovery recovers from panics and returns a 500 error.
 func Recovery(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
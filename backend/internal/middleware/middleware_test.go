@@ -8,6 +8,7 @@ import (
 
 	"github.com/DARC0625/LIMEN/backend/internal/config"
 	"github.com/DARC0625/LIMEN/backend/internal/logger"
+	"github.com/DARC0625/LIMEN/backend/internal/models"
 )
 
 func init() {
@@ -508,6 +509,42 @@ func TestAdmin(t *testing.T) {
 	}
 }
 
+func TestRequirePermission(t *testing.T) {
+	tests := []struct {
+		name     string
+		role     string
+		wantCode int
+	}{
+		{"Admin user", "admin", http.StatusOK},
+		{"Auditor", "auditor", http.StatusOK},
+		{"Operator", "operator", http.StatusForbidden},
+		{"Regular user", "user", http.StatusForbidden},
+		{"Unknown role", "ghost", http.StatusForbidden},
+		{"No role in context", "", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			wrapped := RequirePermission(models.PermAuditRead)(handler)
+
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.role != "" {
+				req = req.WithContext(context.WithValue(req.Context(), RoleKey, tt.role))
+			}
+			w := httptest.NewRecorder()
+
+			wrapped.ServeHTTP(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("RequirePermission middleware code = %v, want %v", w.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
 func TestGetRole(t *testing.T) {
 	tests := []struct {
 		name   string
@@ -558,6 +595,11 @@ func TestIsAdmin(t *testing.T) {
 			ctx:  context.WithValue(context.Background(), RoleKey, "user"),
 			want: false,
 		},
+		{
+			name: "Operator",
+			ctx:  context.WithValue(context.Background(), RoleKey, "operator"),
+			want: false,
+		},
 		{
 			name: "No role",
 			ctx:  context.Background(),
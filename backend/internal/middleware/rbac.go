@@ -11,12 +11,20 @@ import (
 	"gorm.io/gorm"
 )
 
-// RequireRole creates a middleware that requires a specific role.
-func RequireRole(requiredRole string) func(http.Handler) http.Handler {
+// RequireAdmin creates a middleware that requires a role managing the system: admin.
+func RequireAdmin() func(http.Handler) http.Handler {
+	return RequirePermission(models.PermManageSystem)
+}
+
+// RequirePermission creates a middleware that requires a role granting perm.
+func RequirePermission(perm models.Permission) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			role, ok := GetRole(r.Context())
-			if !ok || role != requiredRole {
+			if _, ok := GetRole(r.Context()); !ok {
+				errors.WriteUnauthorized(w, "Authentication required")
+				return
+			}
+			if !HasPermission(r.Context(), perm) {
 				errors.WriteForbidden(w, "Insufficient permissions")
 				return
 			}
@@ -25,9 +33,13 @@ func RequireRole(requiredRole string) func(http.Handler) http.Handler {
 	}
 }
 
-// RequireAdmin creates a middleware that requires admin role.
-func RequireAdmin() func(http.Handler) http.Handler {
-	return RequireRole(string(models.RoleAdmin))
+// HasPermission checks if the role of the user in context grants perm.
+func HasPermission(ctx context.Context, perm models.Permission) bool {
+	role, ok := GetRole(ctx)
+	if !ok {
+		return false
+	}
+	return GetRoleStore(ctx).HasPermission(role, perm)
 }
 
 // RequireBetaAccess creates a middleware that requires beta access.
@@ -48,7 +60,7 @@ func RequireBetaAccess() func(http.Handler) http.Handler {
 				if ok && db != nil {
 					var user models.User
 					if err := db.Select("beta_access", "role").Where("id = ?", userID).First(&user).Error; err == nil {
-						if user.Role != models.RoleAdmin && !user.BetaAccess {
+						if !GetRoleStore(r.Context()).HasPermission(string(user.Role), models.PermManageSystem) && !user.BetaAccess {
 							errors.WriteForbidden(w, "Beta access required")
 							return
 						}
@@ -64,7 +76,8 @@ func RequireBetaAccess() func(http.Handler) http.Handler {
 	}
 }
 
-// RequireVMOwnership creates a middleware that requires VM ownership or admin role.
+// RequireVMOwnership creates a middleware that requires VM ownership or a role
+// controlling every VM.
 // VM UUID must be in the URL path parameter "uuid".
 func RequireVMOwnership(db *gorm.DB) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
@@ -75,8 +88,6 @@ func RequireVMOwnership(db *gorm.DB) func(http.Handler) http.Handler {
 				return
 			}
 
-			role, _ := GetRole(r.Context())
-
 			// Get VM UUID from URL path (chi router format: {uuid})
 			// Try multiple methods to get UUID
 			uuid := ""
@@ -109,8 +120,8 @@ func RequireVMOwnership(db *gorm.DB) func(http.Handler) http.Handler {
 				return
 			}
 
-			// Allow if user owns the VM or is admin
-			if vm.OwnerID != userID && role != string(models.RoleAdmin) {
+			// Allow if user owns the VM or controls every VM
+			if vm.OwnerID != userID && !HasPermission(r.Context(), models.PermVMControlAll) {
 				errors.WriteForbidden(w, "You don't have permission to access this resource")
 				return
 			}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// APIToken is a personal access token: a credential of its user for scripts and CI,
+// limited to its scopes. Only the SHA-256 hash of the token is stored; the token itself
+// is shown once, when it is created.
+type APIToken struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"not null;index" json:"user_id"`
+	Name       string     `gorm:"type:varchar(100);not null" json:"name"`
+	TokenHash  string     `gorm:"type:varchar(64);not null;uniqueIndex" json:"-"`
+	Prefix     string     `gorm:"type:varchar(20);not null" json:"prefix"` // Start of the token, to recognize it
+	Scopes     string     `gorm:"type:varchar(255);not null" json:"-"`     // Comma-separated, e.g. vm:read,snapshot:*
+	ExpiresAt  time.Time  `gorm:"not null;index" json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP string     `gorm:"type:varchar(45)" json:"last_used_ip,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// ScopeList returns the token's scopes.
+func (t *APIToken) ScopeList() []string {
+	return SplitTags(t.Scopes)
+}
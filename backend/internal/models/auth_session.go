@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// AuthSession is a login session: the family of refresh tokens issued since the login.
+// Each refresh rotates the token; rotated tokens are kept as AuthRefreshTokens so a
+// replayed one is detected and revokes the whole family. Tokens are stored hashed.
+type AuthSession struct {
+	ID               string     `gorm:"type:varchar(64);primaryKey" json:"id"`
+	UserID           uint       `gorm:"not null;index" json:"user_id"`
+	Username         string     `gorm:"type:varchar(255)" json:"username"`
+	Role             string     `gorm:"type:varchar(20)" json:"role"`
+	TokenID          string     `gorm:"type:varchar(64);uniqueIndex;not null" json:"-"` // ID of the current refresh token
+	RefreshTokenHash string     `gorm:"type:varchar(64);uniqueIndex;not null" json:"-"` // SHA-256 of the current refresh token
+	CSRFToken        string     `gorm:"type:varchar(128)" json:"-"`
+	ClientIP         string     `gorm:"type:varchar(45)" json:"client_ip"`
+	UserAgent        string     `gorm:"type:text" json:"user_agent"`
+	ExpiresAt        time.Time  `gorm:"not null;index" json:"expires_at"` // Expiry of the current refresh token
+	LastUsedAt       time.Time  `json:"last_used_at"`
+	CreatedAt        time.Time  `json:"created_at"`
+	RevokedAt        *time.Time `gorm:"index" json:"revoked_at,omitempty"` // Set on logout or revocation
+}
+
+// AuthRefreshToken is a refresh token rotated out of an AuthSession.
+type AuthRefreshToken struct {
+	TokenID   string    `gorm:"type:varchar(64);primaryKey"`
+	SessionID string    `gorm:"type:varchar(64);not null;index"`
+	RotatedAt time.Time `gorm:"not null"`
+}
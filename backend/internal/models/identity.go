@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// ExternalIdentity links a user to their account at an OpenID Connect identity provider
+// or in an LDAP directory (issuer "ldap:<base DN>"). Users created from an external
+// identity have no usable LIMEN password.
+type ExternalIdentity struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	UserID      uint       `gorm:"not null;index" json:"user_id"`
+	Issuer      string     `gorm:"type:varchar(255);not null;uniqueIndex:idx_external_identity" json:"issuer"`
+	Subject     string     `gorm:"type:varchar(255);not null;uniqueIndex:idx_external_identity" json:"subject"` // "sub" claim, stable per issuer; lowercase username for LDAP
+	Email       string     `gorm:"type:varchar(255)" json:"email,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ImageUploadStatus represents the state of a resumable image upload.
+type ImageUploadStatus string
+
+const (
+	ImageUploadStatusPending   ImageUploadStatus = "Pending"   // Accepting chunks
+	ImageUploadStatusCompleted ImageUploadStatus = "Completed" // Verified and registered as a VMImage
+	ImageUploadStatusAborted   ImageUploadStatus = "Aborted"   // Cancelled by the user, failed verification or expired
+)
+
+// String returns the string representation of ImageUploadStatus.
+func (s ImageUploadStatus) String() string {
+	return string(s)
+}
+
+// IsValid checks if the status is a valid ImageUploadStatus.
+func (s ImageUploadStatus) IsValid() bool {
+	switch s {
+	case ImageUploadStatusPending, ImageUploadStatusCompleted, ImageUploadStatusAborted:
+		return true
+	default:
+		return false
+	}
+}
+
+// ImageUpload tracks a chunked, resumable upload of an ISO or disk image.
+// Chunks are appended to a temporary file until ReceivedBytes reaches TotalSize,
+// after which the upload is verified against ExpectedSHA256 and registered.
+type ImageUpload struct {
+	ID             string            `gorm:"type:varchar(36);primaryKey" json:"id"`
+	Filename       string            `gorm:"not null" json:"filename"`
+	OSType         string            `json:"os_type"`
+	Description    string            `json:"description"`
+	TotalSize      int64             `gorm:"not null" json:"total_size"`                       // Declared size in bytes
+	ReceivedBytes  int64             `gorm:"default:0" json:"received_bytes"`                  // Bytes written so far (next expected offset)
+	ExpectedSHA256 string            `gorm:"type:varchar(64);not null" json:"expected_sha256"` // Checksum supplied by the client
+	Status         ImageUploadStatus `gorm:"type:varchar(20);default:'Pending';index" json:"status"`
+	OwnerID        uint              `gorm:"not null;index" json:"owner_id"`
+	ImageID        *uint             `json:"image_id,omitempty"` // Set once the upload is registered
+	CreatedAt      time.Time         `json:"created_at"`
+	UpdatedAt      time.Time         `json:"updated_at"`
+}
+
+// BeforeCreate hook to generate the upload ID.
+func (u *ImageUpload) BeforeCreate(tx *gorm.DB) error {
+	if u.ID == "" {
+		u.ID = uuid.New().String()
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// LoginFailure is a failed login attempt. Lockouts and delays are derived from the
+// recent failures of an account or IP address; a successful login or an admin unlock
+// clears the account's failures.
+type LoginFailure struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"index" json:"user_id"`                    // 0 = unknown username
+	Username  string    `gorm:"type:varchar(255);index" json:"username"` // As entered, lowercased
+	ClientIP  string    `gorm:"type:varchar(45);index" json:"client_ip"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+}
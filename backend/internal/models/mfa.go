@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// UserMFA is a user's TOTP authenticator. It is created pending by an enrollment and
+// enabled once the user proves their app generates codes from Secret.
+type UserMFA struct {
+	UserID       uint       `gorm:"primaryKey" json:"user_id"`
+	Secret       string     `gorm:"type:text;not null" json:"-"` // Base32 TOTP secret, encrypted when a key is configured
+	Enabled      bool       `gorm:"not null;default:false" json:"enabled"`
+	EnabledAt    *time.Time `json:"enabled_at,omitempty"`
+	LastUsedStep int64      `json:"-"` // Time step of the last accepted code: codes can't be replayed
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// MFARecoveryCode is a single-use code logging a user in without their authenticator.
+// Codes are stored hashed like passwords.
+type MFARecoveryCode struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	Hash      string     `gorm:"type:varchar(255);not null" json:"-"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// MFARolePolicy records whether users of a role must use MFA. Users of a role requiring
+// it enroll during their next login and can't disable it.
+type MFARolePolicy struct {
+	Role      string    `gorm:"type:varchar(20);primaryKey" json:"role"`
+	Required  bool      `gorm:"not null;default:false" json:"required"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -2,6 +2,7 @@
 package models
 
 import (
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -10,16 +11,18 @@ import (
 
 // User represents a system user.
 type User struct {
-	ID         uint           `gorm:"primaryKey" json:"id"`
-	UUID       string         `gorm:"type:varchar(36);uniqueIndex" json:"uuid"`          // Unique identifier (nullable initially for migration)
-	Username   string         `gorm:"unique;not null;index" json:"username"`             // Indexed for faster lookups
-	Password   string         `gorm:"not null" json:"-"`                                 // Password hash, never exposed in JSON
-	Role       UserRole       `gorm:"type:varchar(20);default:'user';index" json:"role"` // User role: admin or user - indexed for filtering
-	Approved   bool           `gorm:"default:false;index" json:"approved"`               // Admin approval required - indexed for filtering
-	BetaAccess bool           `gorm:"default:false;index" json:"beta_access"`            // Beta access permission - indexed for filtering
-	CreatedAt  time.Time      `json:"created_at"`
-	UpdatedAt  time.Time      `json:"updated_at"`
-	DeletedAt  gorm.DeletedAt `gorm:"index" json:"-"` // Soft delete
+	ID            uint           `gorm:"primaryKey" json:"id"`
+	UUID          string         `gorm:"type:varchar(36);uniqueIndex" json:"uuid"`          // Unique identifier (nullable initially for migration)
+	Username      string         `gorm:"unique;not null;index" json:"username"`             // Indexed for faster lookups
+	Password      string         `gorm:"not null" json:"-"`                                 // Password hash, never exposed in JSON
+	Role          UserRole       `gorm:"type:varchar(20);default:'user';index" json:"role"` // User role: admin or user - indexed for filtering
+	Approved      bool           `gorm:"default:false;index" json:"approved"`               // Admin approval required - indexed for filtering
+	BetaAccess    bool           `gorm:"default:false;index" json:"beta_access"`            // Beta access permission - indexed for filtering
+	Email         string         `gorm:"type:varchar(255);index" json:"email,omitempty"`    // Password resets are mailed here once verified
+	EmailVerified bool           `gorm:"default:false" json:"email_verified"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"` // Soft delete
 }
 
 // BeforeCreate hook to generate UUID before creating a user
@@ -48,6 +51,19 @@ type VM struct {
 	BootOrder          BootOrder          `gorm:"type:varchar(20);default:'cdrom_hd'" json:"boot_order"`                            // Boot order configuration
 	DiskPath           string             `gorm:"type:varchar(512)" json:"disk_path"`                                               // Virtual disk path
 	DiskSize           int                `gorm:"default:20" json:"disk_size"`                                                      // Disk size in GB
+	Firmware           string             `gorm:"type:varchar(20);default:'bios'" json:"firmware"`                                  // bios, uefi, uefi-secureboot
+	TPM                bool               `gorm:"default:false" json:"tpm"`                                                         // Emulated TPM 2.0 (swtpm)
+	CPUModel           string             `gorm:"type:varchar(64);default:'host-model'" json:"cpu_model"`                           // host-model, host-passthrough or a named libvirt CPU model
+	CPUSockets         int                `gorm:"default:0" json:"cpu_sockets,omitempty"`                                           // Guest topology (0 = libvirt default)
+	CPUCores           int                `gorm:"default:0" json:"cpu_cores,omitempty"`                                             // Cores per socket
+	CPUThreads         int                `gorm:"default:0" json:"cpu_threads,omitempty"`                                           // Threads per core
+	CPUPinning         string             `gorm:"type:text" json:"cpu_pinning,omitempty"`                                           // vCPU pinning (JSON)
+	NUMANode           *int               `json:"numa_node,omitempty"`                                                              // Host NUMA node for memory and unpinned vCPUs
+	RecordConsole      bool               `gorm:"default:false" json:"record_console"`                                              // Record console sessions (opt-in; CONSOLE_RECORDING=all records every VM)
+	HostID             uint               `gorm:"index" json:"host_id"`                                                             // Compute host the VM is placed on (0 = the default host)
+	HostTags           string             `gorm:"type:varchar(255)" json:"host_tags,omitempty"`                                     // Comma-separated tags its host must carry
+	AntiAffinityGroup  string             `gorm:"type:varchar(64);index" json:"anti_affinity_group,omitempty"`                      // VMs of a group are placed on different hosts
+	ImageID            *uint              `gorm:"index" json:"image_id,omitempty"`                                                  // Installation image the VM was created from
 	OwnerID            uint               `gorm:"not null;index;index:idx_vm_owner_status" json:"owner_id"`                         // Foreign key to User - indexed for joins and composite index
 	Owner              User               `gorm:"foreignKey:OwnerID" json:"owner,omitempty"`
 	CreatedAt          time.Time          `json:"created_at"`
@@ -66,11 +82,14 @@ func (v *VM) BeforeCreate(tx *gorm.DB) error {
 // VMImage represents an OS image (ISO or disk image) that can be used to create VMs.
 type VMImage struct {
 	ID          uint           `gorm:"primaryKey" json:"id"`
-	Name        string         `gorm:"not null" json:"name"`       // Display name
-	OSType      string         `gorm:"index" json:"os_type"`       // OS type for UI grouping - indexed for lookups
-	Path        string         `gorm:"not null" json:"-"`          // Local filesystem path (not exposed)
-	IsISO       bool           `gorm:"default:true" json:"is_iso"` // true for ISO, false for disk image
-	Description string         `json:"description"`                // Optional description
+	Name        string         `gorm:"not null" json:"name"`                 // Display name
+	OSType      string         `gorm:"index" json:"os_type"`                 // OS type for UI grouping - indexed for lookups
+	Path        string         `gorm:"not null" json:"-"`                    // Local filesystem path (not exposed)
+	IsISO       bool           `gorm:"default:true" json:"is_iso"`           // true for ISO, false for disk image
+	Description string         `json:"description"`                          // Optional description
+	SHA256      string         `gorm:"type:varchar(64);index" json:"sha256"` // Content hash - used for upload verification and deduplication
+	Size        int64          `json:"size"`                                 // File size in bytes
+	OwnerID     *uint          `gorm:"index" json:"owner_id,omitempty"`      // Uploading user (nil for system images)
 	CreatedAt   time.Time      `json:"created_at"`
 	UpdatedAt   time.Time      `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"` // Soft delete
@@ -98,6 +117,7 @@ type ConsoleSession struct {
 	VMID           uint           `gorm:"not null;index" json:"vm_id"` // Foreign key to VM
 	VM             VM             `gorm:"foreignKey:VMID" json:"vm,omitempty"`
 	VMUUID         string         `gorm:"type:varchar(36);index" json:"vm_uuid"`        // VM UUID for quick lookup
+	Protocol       string         `gorm:"type:varchar(10)" json:"protocol,omitempty"`   // Console protocol: vnc, serial
 	StartedAt      time.Time      `gorm:"not null;index" json:"started_at"`             // Session start time
 	LastActivityAt time.Time      `gorm:"not null;index" json:"last_activity_at"`       // Last activity time (for idle timeout)
 	EndedAt        *time.Time     `gorm:"index" json:"ended_at,omitempty"`              // Session end time (null if active)
@@ -109,18 +129,91 @@ type ConsoleSession struct {
 	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"` // Soft delete
 }
 
+// ConsoleSessionLimit overrides the server's console session limits for a role (UserID 0)
+// or a single user (Role empty). Zero values inherit: user -> role -> server default.
+type ConsoleSessionLimit struct {
+	ID                     uint      `gorm:"primaryKey" json:"id"`
+	Role                   string    `gorm:"type:varchar(20);uniqueIndex:idx_console_limit_scope" json:"role,omitempty"` // Role the limits apply to
+	UserID                 uint      `gorm:"uniqueIndex:idx_console_limit_scope" json:"user_id,omitempty"`               // User the limits apply to
+	MaxIdleMinutes         int       `json:"max_idle_minutes"`                                                           // Idle timeout
+	MaxDurationMinutes     int       `json:"max_duration_minutes"`                                                       // Maximum session length
+	MaxConcurrent          int       `json:"max_concurrent"`                                                             // Concurrent sessions per user
+	ReconnectWindowSeconds int       `json:"reconnect_window_seconds"`                                                   // Window for the reconnect rate limit
+	CreatedAt              time.Time `json:"created_at"`
+	UpdatedAt              time.Time `json:"updated_at"`
+}
+
+// HostStatus is the reachability of a compute host.
+type HostStatus string
+
+const (
+	HostStatusOnline  HostStatus = "online"
+	HostStatusOffline HostStatus = "offline"
+)
+
+// Host is a libvirt compute host. The host named "local" is the server's own LIBVIRT_URI;
+// others are reached over qemu+ssh or qemu+tls. CPUs and MemoryMB are reported by libvirt
+// whenever the backend connects. This server creates VM disks and NVRAM and keeps the ISOs,
+// so other hosts only take new VMs when they declare SharedStorage: they see those files
+// under the same paths.
+type Host struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	Name           string     `gorm:"type:varchar(64);uniqueIndex;not null" json:"name"`
+	URI            string     `gorm:"type:varchar(255);not null" json:"uri"`                  // libvirt connection URI
+	ConsoleAddress string     `gorm:"type:varchar(255)" json:"console_address,omitempty"`     // Address VM consoles listen on and the proxy dials (empty = 127.0.0.1); loopback on the default host
+	Tags           string     `gorm:"type:varchar(255)" json:"tags"`                          // Comma-separated placement tags
+	Maintenance    bool       `gorm:"default:false" json:"maintenance"`                       // No new VMs are placed on the host
+	SharedStorage  bool       `gorm:"default:false" json:"shared_storage"`                    // Mounts this server's VM and ISO directories under the same paths
+	CPUOvercommit  float64    `gorm:"default:4" json:"cpu_overcommit"`                        // vCPUs that may be placed per host CPU
+	Status         HostStatus `gorm:"type:varchar(20);default:'offline';index" json:"status"` // Reachability at the last connection attempt
+	CPUs           int        `json:"cpus"`
+	MemoryMB       int        `json:"memory_mb"`
+	LastSeenAt     *time.Time `json:"last_seen_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// SplitTags splits a comma-separated tag list, dropping empty entries.
+func SplitTags(tags string) []string {
+	var out []string
+	for _, tag := range strings.Split(tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			out = append(out, tag)
+		}
+	}
+	return out
+}
+
+// ConsoleRecording indexes a recorded console session. The recording itself is a file
+// (see internal/recording); Path is never exposed.
+type ConsoleRecording struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	SessionID string     `gorm:"type:varchar(64);index" json:"session_id"` // ConsoleSession.SessionID
+	VMUUID    string     `gorm:"type:varchar(36);index" json:"vm_uuid"`
+	UserID    uint       `gorm:"index" json:"user_id"`                // User who opened the console
+	Protocol  string     `gorm:"type:varchar(10)" json:"protocol"`    // vnc, serial
+	Path      string     `gorm:"type:varchar(512);not null" json:"-"` // Recording file
+	Encrypted bool       `gorm:"default:false" json:"encrypted"`      // Encrypted at rest (ChaCha20-Poly1305)
+	Size      int64      `json:"size"`                                // File size in bytes
+	StartedAt time.Time  `gorm:"not null;index" json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"` // Null while recording (or if the server stopped mid-session)
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
 // UserQuota represents per-user resource limits.
 type UserQuota struct {
-	ID        uint           `gorm:"primaryKey" json:"id"`
-	UserID    uint           `gorm:"uniqueIndex;not null" json:"user_id"` // Foreign key to User (one quota per user)
-	User      User           `gorm:"foreignKey:UserID" json:"user,omitempty"`
-	MaxVMs    int            `gorm:"default:32" json:"max_vms"`        // Maximum number of VMs
-	MaxCPU    int            `gorm:"default:128" json:"max_cpu"`       // Maximum total vCPU (increased from 4)
-	MaxMemory int            `gorm:"default:524288" json:"max_memory"` // Maximum total memory (MB) - 512GB (increased from 4GB)
-	MaxDisk   int            `gorm:"default:10000" json:"max_disk"`    // Maximum total disk (GB) - 10TB (increased from 100GB)
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"` // Soft delete
+	ID              uint           `gorm:"primaryKey" json:"id"`
+	UserID          uint           `gorm:"uniqueIndex;not null" json:"user_id"` // Foreign key to User (one quota per user)
+	User            User           `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	MaxVMs          int            `gorm:"default:32" json:"max_vms"`              // Maximum number of VMs
+	MaxCPU          int            `gorm:"default:128" json:"max_cpu"`             // Maximum total vCPU (increased from 4)
+	MaxMemory       int            `gorm:"default:524288" json:"max_memory"`       // Maximum total memory (MB) - 512GB (increased from 4GB)
+	MaxDisk         int            `gorm:"default:10000" json:"max_disk"`          // Maximum total disk (GB) - 10TB (increased from 100GB)
+	MaxImageStorage int            `gorm:"default:51200" json:"max_image_storage"` // Maximum total uploaded image size (MB) - 50GB
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `gorm:"index" json:"-"` // Soft delete
 }
 
 // AuditLog represents an audit log entry for security and compliance.
@@ -1,16 +1,26 @@
 package models
 
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
 // UserRole represents the role of a user in the system
 type UserRole string
 
 const (
-	RoleAdmin UserRole = "admin"
-	RoleUser  UserRole = "user"
+	RoleAdmin    UserRole = "admin"
+	RoleUser     UserRole = "user"
+	RoleOperator UserRole = "operator" // Controls every VM, but doesn't manage users
+	RoleAuditor  UserRole = "auditor"  // Reads the audit trail and logs
 )
 
-// IsValid checks if the role is valid
+// IsValid checks if the role is one of the built-in roles. Custom roles are stored in
+// the database (see Role) and checked with auth.RoleStore.Exists.
 func (r UserRole) IsValid() bool {
-	return r == RoleAdmin || r == RoleUser
+	_, ok := builtInRoles[r]
+	return ok
 }
 
 // String returns the string representation of the role
@@ -22,3 +32,97 @@ func (r UserRole) String() string {
 func (r UserRole) IsAdmin() bool {
 	return r == RoleAdmin
 }
+
+// Permission is something a role allows beyond what every user can do with their own
+// resources. Managing users, roles and the rest of the system stays with admins: a
+// permission to manage users would let its holders give themselves any other.
+type Permission string
+
+const (
+	PermVMReadAll    Permission = "vms.read_all"    // See the stats of any user's VMs
+	PermVMControlAll Permission = "vms.control_all" // Start and stop any user's VMs
+	PermVMConsoleAll Permission = "vms.console_all" // Open the console of any user's VM
+	PermVMDeleteAll  Permission = "vms.delete_all"  // Delete any user's VMs
+	PermAuditRead    Permission = "audit.read"      // Read the audit trail
+	PermLogsRead     Permission = "logs.read"       // Read and search the server logs
+
+	// PermManageSystem is managing users, roles, quotas and the rest of the system, and
+	// skipping the approval and beta access checks. Only admins have it: it isn't in
+	// AllPermissions, so custom roles can't be given it.
+	PermManageSystem Permission = "system.manage"
+)
+
+// AllPermissions lists every permission custom roles can be given.
+var AllPermissions = []Permission{
+	PermVMReadAll,
+	PermVMControlAll,
+	PermVMConsoleAll,
+	PermVMDeleteAll,
+	PermAuditRead,
+	PermLogsRead,
+}
+
+// IsValid checks if the permission can be given to custom roles.
+func (p Permission) IsValid() bool {
+	for _, perm := range AllPermissions {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// builtInRoles are the permissions of the built-in roles. Admins also have
+// PermManageSystem.
+var builtInRoles = map[UserRole][]Permission{
+	RoleAdmin:    AllPermissions,
+	RoleUser:     nil,
+	RoleOperator: {PermVMReadAll, PermVMControlAll, PermVMConsoleAll},
+	RoleAuditor:  {PermAuditRead, PermLogsRead},
+}
+
+// BuiltInRoles returns the built-in roles, sorted by name.
+func BuiltInRoles() []Role {
+	roles := make([]Role, 0, len(builtInRoles))
+	for name, perms := range builtInRoles {
+		roles = append(roles, Role{Name: string(name), Permissions: JoinPermissions(perms), BuiltIn: true})
+	}
+	sort.Slice(roles, func(i, j int) bool { return roles[i].Name < roles[j].Name })
+	return roles
+}
+
+// BuiltInPermissions returns the permissions of a built-in role, and whether role is one.
+func BuiltInPermissions(role UserRole) ([]Permission, bool) {
+	perms, ok := builtInRoles[role]
+	return perms, ok
+}
+
+// Role is a custom role: a named set of permissions users can be given in addition to
+// the built-in roles. Users refer to it by name, like to the built-in roles.
+type Role struct {
+	ID          uint      `gorm:"primaryKey" json:"id,omitempty"`
+	Name        string    `gorm:"type:varchar(20);not null;uniqueIndex" json:"name"` // Same size as User.Role
+	Description string    `gorm:"type:varchar(255)" json:"description,omitempty"`
+	Permissions string    `gorm:"type:varchar(255);not null" json:"-"` // Comma-separated, e.g. audit.read,logs.read
+	BuiltIn     bool      `gorm:"-" json:"built_in"`
+	CreatedAt   time.Time `json:"created_at,omitempty"`
+	UpdatedAt   time.Time `json:"updated_at,omitempty"`
+}
+
+// PermissionList returns the role's permissions.
+func (r *Role) PermissionList() []Permission {
+	var perms []Permission
+	for _, perm := range SplitTags(r.Permissions) {
+		perms = append(perms, Permission(perm))
+	}
+	return perms
+}
+
+// JoinPermissions returns perms in the form stored in Role.Permissions.
+func JoinPermissions(perms []Permission) string {
+	names := make([]string, len(perms))
+	for i, perm := range perms {
+		names[i] = string(perm)
+	}
+	return strings.Join(names, ",")
+}
@@ -16,6 +16,8 @@ func GetOrCreateUserQuota(db *gorm.DB, userID uint) (*UserQuota, error) {
 			MaxCPU:    128,    // Default: 128 vCPU total (increased from 4)
 			MaxMemory: 524288, // Default: 512GB total (increased from 4GB)
 			MaxDisk:   10000,  // Default: 10TB total (increased from 100GB)
+
+			MaxImageStorage: 51200, // Default: 50GB of uploaded images
 		}
 		if err := db.Create(&quota).Error; err != nil {
 			return nil, err
@@ -45,6 +47,11 @@ func GetOrCreateUserQuota(db *gorm.DB, userID uint) (*UserQuota, error) {
 		updated = true
 	}
 
+	if quota.MaxImageStorage <= 0 {
+		quota.MaxImageStorage = 51200
+		updated = true
+	}
+
 	if updated {
 		if err := db.Save(&quota).Error; err != nil {
 			return nil, err
@@ -120,6 +127,36 @@ func (q *UserQuota) CheckUserQuota(db *gorm.DB, cpu, memory, disk int) error {
 	return nil
 }
 
+// CheckImageStorage checks if the user can store an additional image of sizeBytes.
+// Usage is the sum of images owned by the user and of the sizes their pending uploads
+// reserve, rounded up to whole MB.
+func (q *UserQuota) CheckImageStorage(db *gorm.DB, sizeBytes int64) error {
+	var usedBytes, reservedBytes int64
+	if err := db.Model(&VMImage{}).Where("owner_id = ?", q.UserID).
+		Select("COALESCE(SUM(size), 0)").Scan(&usedBytes).Error; err != nil {
+		return err
+	}
+	if err := db.Model(&ImageUpload{}).Where("owner_id = ? AND status = ?", q.UserID, ImageUploadStatusPending).
+		Select("COALESCE(SUM(total_size), 0)").Scan(&reservedBytes).Error; err != nil {
+		return err
+	}
+	usedBytes += reservedBytes
+
+	const mb = 1024 * 1024
+	current := int((usedBytes + mb - 1) / mb)
+	requested := int((sizeBytes + mb - 1) / mb)
+	if current+requested > q.MaxImageStorage {
+		return &QuotaError{
+			Resource:  "ImageStorage",
+			Current:   current,
+			Limit:     q.MaxImageStorage,
+			Requested: requested,
+		}
+	}
+
+	return nil
+}
+
 // CheckVMResourceLimits checks if the requested VM specs exceed user's limits.
 func (q *UserQuota) CheckVMResourceLimits(cpu, memory int) error {
 	// Individual VM resource limits removed - only user quota limits apply
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// WebAuthnCredential is a passkey or security key a user registered. It logs the user
+// in without a password, or completes a password login as their second factor.
+type WebAuthnCredential struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	UserID         uint       `gorm:"not null;index" json:"user_id"`
+	Name           string     `gorm:"type:varchar(100)" json:"name"`                                // Chosen by the user, e.g. "YubiKey"
+	CredentialID   string     `gorm:"type:varchar(1366);uniqueIndex;not null" json:"credential_id"` // Base64url, as the authenticator reports it
+	PublicKey      []byte     `gorm:"not null" json:"-"`                                            // COSE_Key
+	Algorithm      int        `json:"algorithm"`                                                    // COSE algorithm of PublicKey
+	SignCount      uint32     `json:"sign_count"`                                                   // Signature counter, to detect cloned authenticators
+	AAGUID         string     `gorm:"type:varchar(36)" json:"aaguid"`                               // Authenticator model
+	Transports     string     `gorm:"type:varchar(100)" json:"transports"`                          // Comma-separated hints: usb, nfc, ble, internal, hybrid
+	BackupEligible bool       `json:"backup_eligible"`                                              // Synced passkey rather than a device-bound key
+	CreatedAt      time.Time  `json:"created_at"`
+	LastUsedAt     *time.Time `json:"last_used_at,omitempty"`
+}
@@ -0,0 +1,291 @@
+// Package oidc implements single sign-on with an OpenID Connect identity provider: the
+// authorization code flow with PKCE, ID token verification against the provider's
+// published keys, and just-in-time provisioning of the users it authenticates.
+package oidc
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DARC0625/LIMEN/backend/internal/auth"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrNotConfigured = errors.New("single sign-on is not configured")
+	ErrInvalidState  = errors.New("invalid or expired single sign-on state")
+	ErrInvalidToken  = errors.New("invalid ID token")
+)
+
+// LoginStateTTL is how long a user has to authenticate at the identity provider.
+const LoginStateTTL = 10 * time.Minute
+
+// Config identifies the identity provider and LIMEN's client registration there.
+type Config struct {
+	Issuer        string            // Issuer URL; its discovery document is at /.well-known/openid-configuration
+	ClientID      string            // Empty = single sign-on disabled
+	ClientSecret  string            // Empty for public clients, which rely on PKCE alone
+	RedirectURL   string            // Callback URL registered at the provider
+	Scopes        []string          // Requested scopes; "openid" is always included
+	UsernameClaim string            // Claim naming new users (default preferred_username)
+	GroupsClaim   string            // Claim listing the user's groups (default groups)
+	Mapping       auth.GroupMapping // How groups map to roles and flags
+	// amr (RFC 8176) or acr values of an ID token showing the user passed a second factor
+	// at the provider. Users whose role requires MFA can only sign on with one of them.
+	MFAValues []string
+}
+
+// providerMetadata is the part of the discovery document LIMEN uses.
+type providerMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// stateClaims carry a login between its redirect to the provider and the callback, in
+// a cookie of the user's browser.
+type stateClaims struct {
+	State    string `json:"st"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"cv"`
+	Redirect string `json:"rd,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Client is LIMEN's relying party at one identity provider.
+type Client struct {
+	db   *gorm.DB
+	cfg  Config
+	http *http.Client
+	key  []byte
+	used *auth.ReplayCache
+	now  func() time.Time
+
+	mu       sync.Mutex
+	metadata *providerMetadata
+	keys     *keySet
+}
+
+// NewClient creates a client for cfg, signing login states with a key derived from
+// secret.
+func NewClient(db *gorm.DB, cfg Config, secret string) *Client {
+	if cfg.UsernameClaim == "" {
+		cfg.UsernameClaim = "preferred_username"
+	}
+	if cfg.GroupsClaim == "" {
+		cfg.GroupsClaim = "groups"
+	}
+	cfg.Issuer = strings.TrimSuffix(cfg.Issuer, "/")
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("limen-oidc-state"))
+	return &Client{
+		db:   db,
+		cfg:  cfg,
+		http: &http.Client{Timeout: 10 * time.Second},
+		key:  mac.Sum(nil),
+		used: auth.NewReplayCache(),
+		now:  time.Now,
+	}
+}
+
+// Enabled reports whether an identity provider is configured.
+func (c *Client) Enabled() bool {
+	return c.cfg.Issuer != "" && c.cfg.ClientID != ""
+}
+
+// BeginLogin starts a login that returns to redirect, a path of the web app. It returns
+// the provider's authorization URL to send the browser to, and the state to keep in a
+// cookie until the callback.
+func (c *Client) BeginLogin(ctx context.Context, redirect string) (string, string, error) {
+	if !c.Enabled() {
+		return "", "", ErrNotConfigured
+	}
+	meta, err := c.providerMetadata(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	claims := &stateClaims{
+		State:    randomString(),
+		Nonce:    randomString(),
+		Verifier: randomString() + randomString(), // 86 characters, within RFC 7636's 43-128
+		Redirect: redirect,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        randomString(),
+			ExpiresAt: jwt.NewNumericDate(c.now().Add(LoginStateTTL)),
+			Audience:  []string{"limen-oidc"},
+		},
+	}
+	state, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(c.key)
+	if err != nil {
+		return "", "", err
+	}
+
+	challenge := sha256.Sum256([]byte(claims.Verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {c.cfg.ClientID},
+		"redirect_uri":          {c.cfg.RedirectURL},
+		"scope":                 {strings.Join(c.scopes(), " ")},
+		"state":                 {claims.State},
+		"nonce":                 {claims.Nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	authURL := meta.AuthorizationEndpoint
+	if strings.Contains(authURL, "?") {
+		authURL += "&" + query.Encode()
+	} else {
+		authURL += "?" + query.Encode()
+	}
+	return authURL, state, nil
+}
+
+// FinishLogin completes a login at its callback: it checks the state returned by the
+// provider against the one BeginLogin kept, exchanges code for tokens and verifies the
+// ID token. It returns the authenticated identity and the redirect of the login.
+func (c *Client) FinishLogin(ctx context.Context, storedState, returnedState, code string) (*Identity, string, error) {
+	if !c.Enabled() {
+		return nil, "", ErrNotConfigured
+	}
+	claims := &stateClaims{}
+	_, err := jwt.ParseWithClaims(storedState, claims, func(token *jwt.Token) (interface{}, error) {
+		return c.key, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithAudience("limen-oidc"),
+		jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(c.now),
+	)
+	if err != nil || claims.State == "" || !hmac.Equal([]byte(claims.State), []byte(returnedState)) {
+		return nil, "", ErrInvalidState
+	}
+	if !c.used.Use(claims.ID, claims.ExpiresAt.Time) {
+		return nil, "", fmt.Errorf("%w: already used", ErrInvalidState)
+	}
+
+	rawIDToken, err := c.exchange(ctx, code, claims.Verifier)
+	if err != nil {
+		return nil, "", err
+	}
+	identity, err := c.verifyIDToken(ctx, rawIDToken, claims.Nonce)
+	if err != nil {
+		return nil, "", err
+	}
+	return identity, claims.Redirect, nil
+}
+
+// exchange redeems an authorization code for the ID token.
+func (c *Client) exchange(ctx context.Context, code, verifier string) (string, error) {
+	meta, err := c.providerMetadata(ctx)
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {c.cfg.RedirectURL},
+		"client_id":     {c.cfg.ClientID},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if c.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(c.cfg.ClientID), url.QueryEscape(c.cfg.ClientSecret))
+	}
+
+	var tokens struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	status, err := c.getJSON(req, &tokens)
+	if err != nil {
+		return "", fmt.Errorf("token request failed: %w", err)
+	}
+	if status != http.StatusOK || tokens.IDToken == "" {
+		return "", fmt.Errorf("%w: token endpoint returned %d %s %s", ErrInvalidToken, status, tokens.Error, tokens.ErrorDescription)
+	}
+	return tokens.IDToken, nil
+}
+
+// providerMetadata returns the provider's discovery document, fetched once.
+func (c *Client) providerMetadata(ctx context.Context) (*providerMetadata, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.metadata != nil {
+		return c.metadata, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.cfg.Issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	var meta providerMetadata
+	status, err := c.getJSON(req, &meta)
+	if err != nil || status != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch OIDC discovery document (status %d): %v", status, err)
+	}
+	// OpenID Connect Discovery §4.3: the document must name the issuer it was fetched
+	// from. Tokens are then checked against its exact value.
+	if strings.TrimSuffix(meta.Issuer, "/") != c.cfg.Issuer {
+		return nil, fmt.Errorf("OIDC discovery document issuer %q doesn't match %q", meta.Issuer, c.cfg.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, errors.New("OIDC discovery document is missing endpoints")
+	}
+	c.metadata = &meta
+	return c.metadata, nil
+}
+
+// getJSON sends req and decodes its JSON response into v, returning the status.
+func (c *Client) getJSON(req *http.Request, v interface{}) (int, error) {
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return resp.StatusCode, err
+	}
+	return resp.StatusCode, nil
+}
+
+func (c *Client) scopes() []string {
+	scopes := []string{"openid"}
+	for _, s := range c.cfg.Scopes {
+		if s != "openid" {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
+// randomString returns 32 random bytes, base64url encoded.
+func randomString() string {
+	b := make([]byte, 32)
+	rand.Read(b) // Never fails since Go 1.24
+	return base64.RawURLEncoding.EncodeToString(b)
+}
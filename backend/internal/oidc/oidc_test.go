@@ -0,0 +1,164 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DARC0625/LIMEN/backend/internal/auth"
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"github.com/DARC0625/LIMEN/backend/internal/oidc/oidctest"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newTestClient(t *testing.T) (*Client, *oidctest.Provider, *gorm.DB) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.ExternalIdentity{}); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+	idp := oidctest.NewProvider(t, "limen")
+	idp.ClientSecret = "client-secret"
+	client := NewClient(db, Config{
+		Issuer:       idp.Issuer(),
+		ClientID:     "limen",
+		ClientSecret: "client-secret",
+		RedirectURL:  "https://limen.example/api/auth/oidc/callback",
+		Scopes:       []string{"openid", "profile", "groups"},
+		Mapping:      auth.GroupMapping{AdminGroups: []string{"limen-admins"}, ApprovedGroups: []string{"staff"}},
+	}, "test-secret")
+	return client, idp, db
+}
+
+// login runs a login of the user with claims and returns its identity.
+func login(t *testing.T, client *Client, idp *oidctest.Provider, claims map[string]interface{}) (*Identity, error) {
+	authURL, state, err := client.BeginLogin(context.Background(), "/vms")
+	if err != nil {
+		t.Fatalf("BeginLogin() error = %v", err)
+	}
+	callback, err := idp.Authorize(authURL, claims)
+	if err != nil {
+		t.Fatalf("Authorize() error = %v", err)
+	}
+	identity, redirect, err := client.FinishLogin(context.Background(), state, callback.Get("state"), callback.Get("code"))
+	if err == nil && redirect != "/vms" {
+		t.Errorf("FinishLogin() redirect = %q, want /vms", redirect)
+	}
+	return identity, err
+}
+
+func TestClient_LoginAndProvision(t *testing.T) {
+	client, idp, db := newTestClient(t)
+
+	claims := map[string]interface{}{
+		"sub": "user-1", "preferred_username": "alice.kim", "email": "alice@example.com",
+		"groups": []interface{}{"staff", "limen-admins"},
+	}
+	identity, err := login(t, client, idp, claims)
+	if err != nil || identity.Subject != "user-1" || identity.Username != "alice.kim" || len(identity.Groups) != 2 {
+		t.Fatalf("login = %+v, %v", identity, err)
+	}
+	user, created, err := client.Provision(identity)
+	if err != nil || !created || user.Username != "alice_kim" || user.Role != models.RoleAdmin || !user.Approved {
+		t.Fatalf("Provision() = %+v, %v, %v; want a new approved admin", user, created, err)
+	}
+
+	// Leaving the admin group demotes the user at their next login
+	claims["groups"] = []interface{}{"staff"}
+	identity, _ = login(t, client, idp, claims)
+	again, created, err := client.Provision(identity)
+	if err != nil || created || again.ID != user.ID || again.Role != models.RoleUser || !again.Approved {
+		t.Errorf("second Provision() = %+v, %v, %v; want the same user, demoted", again, created, err)
+	}
+
+	// Another person named alice.kim gets another user, and a deleted user stays deleted
+	identity, _ = login(t, client, idp, map[string]interface{}{"sub": "user-2", "preferred_username": "alice.kim"})
+	other, _, err := client.Provision(identity)
+	if err != nil || other.Username != "alice_kim_2" || other.Approved {
+		t.Errorf("Provision() of a namesake = %+v, %v; want alice_kim_2, pending approval", other, err)
+	}
+	db.Delete(&models.User{}, user.ID)
+	identity, _ = login(t, client, idp, claims)
+	if _, _, err := client.Provision(identity); !errors.Is(err, ErrUserDisabled) {
+		t.Errorf("Provision() of a deleted user error = %v, want ErrUserDisabled", err)
+	}
+}
+
+func TestClient_RejectsInvalidLogins(t *testing.T) {
+	client, idp, _ := newTestClient(t)
+	claims := map[string]interface{}{"sub": "user-1"}
+
+	tests := []struct {
+		name string
+		hook func(jwt.MapClaims)
+	}{
+		{"wrong audience", func(c jwt.MapClaims) { c["aud"] = "other-client" }},
+		{"wrong issuer", func(c jwt.MapClaims) { c["iss"] = "https://evil.example" }},
+		{"wrong nonce", func(c jwt.MapClaims) { c["nonce"] = "replayed" }},
+		{"expired", func(c jwt.MapClaims) { c["exp"] = 1 }},
+		{"no subject", func(c jwt.MapClaims) { delete(c, "sub") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp.IDTokenHook = tt.hook
+			defer func() { idp.IDTokenHook = nil }()
+			if _, err := login(t, client, idp, claims); !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("login error = %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+
+	// The state returned by the provider must match the browser's, once
+	authURL, state, _ := client.BeginLogin(context.Background(), "")
+	callback, _ := idp.Authorize(authURL, claims)
+	if _, _, err := client.FinishLogin(context.Background(), state, "forged", callback.Get("code")); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("FinishLogin() with another state error = %v, want ErrInvalidState", err)
+	}
+	if _, _, err := client.FinishLogin(context.Background(), state, callback.Get("state"), callback.Get("code")); err != nil {
+		t.Fatalf("FinishLogin() error = %v", err)
+	}
+	if _, _, err := client.FinishLogin(context.Background(), state, callback.Get("state"), callback.Get("code")); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("replayed FinishLogin() error = %v, want ErrInvalidState", err)
+	}
+
+	// A provider naming itself with a trailing slash issues tokens under that exact name
+	idp.TrailingSlash = true
+	slashed := NewClient(client.db, client.cfg, "test-secret")
+	if identity, err := login(t, slashed, idp, claims); err != nil || identity.Issuer != idp.Issuer() {
+		t.Errorf("login at a provider with a trailing slash = %+v, %v", identity, err)
+	}
+	idp.IDTokenHook = func(c jwt.MapClaims) { c["iss"] = idp.Issuer() }
+	if _, err := login(t, slashed, idp, claims); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("login with the issuer without its trailing slash error = %v, want ErrInvalidToken", err)
+	}
+	idp.IDTokenHook = nil
+	idp.TrailingSlash = false
+
+	// A client secret mismatch or a wrong PKCE verifier fails the code exchange
+	idp.ClientSecret = "rotated"
+	if _, err := login(t, client, idp, claims); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("login with a wrong client secret error = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestClient_FollowsKeyRotation(t *testing.T) {
+	client, idp, _ := newTestClient(t)
+	claims := map[string]interface{}{"sub": "user-1"}
+	if _, err := login(t, client, idp, claims); err != nil {
+		t.Fatalf("login error = %v", err)
+	}
+	// Signing keys are refetched at most once per keyRefreshInterval
+	idp.RotateKey(t)
+	if _, err := login(t, client, idp, claims); err == nil {
+		t.Error("login with a key rotated too soon succeeded")
+	}
+	client.now = func() time.Time { return time.Now().Add(keyRefreshInterval) }
+	if _, err := login(t, client, idp, claims); err != nil {
+		t.Errorf("login after a key rotation error = %v", err)
+	}
+}
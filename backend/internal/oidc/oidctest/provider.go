@@ -0,0 +1,202 @@
+// Package oidctest provides a mock OpenID Connect identity provider for tests.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// grant is an authorization code waiting to be redeemed.
+type grant struct {
+	clientID    string
+	redirectURI string
+	nonce       string
+	challenge   string
+	claims      jwt.MapClaims
+}
+
+// Provider is an identity provider on a local test server. It implements discovery,
+// the JWKS, and the token endpoint with PKCE; Authorize stands in for the user
+// authenticating at the authorization endpoint.
+type Provider struct {
+	Server       *httptest.Server
+	ClientID     string
+	ClientSecret string // Required from clients when set
+	// IDTokenHook, when set, may modify the claims of ID tokens before they are signed
+	IDTokenHook func(claims jwt.MapClaims)
+	// TrailingSlash makes the provider name itself Issuer()+"/" in discovery and ID tokens
+	TrailingSlash bool
+
+	mu     sync.Mutex
+	key    *rsa.PrivateKey
+	kid    string
+	codes  map[string]*grant
+	serial int
+}
+
+// NewProvider starts a provider for the client clientID, stopped when the test ends.
+func NewProvider(t testing.TB, clientID string) *Provider {
+	p := &Provider{ClientID: clientID, codes: make(map[string]*grant)}
+	p.RotateKey(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{
+			"issuer":                 p.name(),
+			"authorization_endpoint": p.Issuer() + "/authorize",
+			"token_endpoint":         p.Issuer() + "/token",
+			"jwks_uri":               p.Issuer() + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", p.handleJWKS)
+	mux.HandleFunc("/token", p.handleToken)
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Server.Close)
+	return p
+}
+
+// Issuer is the provider's issuer URL.
+func (p *Provider) Issuer() string {
+	return p.Server.URL
+}
+
+// name is the issuer the provider names itself.
+func (p *Provider) name() string {
+	if p.TrailingSlash {
+		return p.Issuer() + "/"
+	}
+	return p.Issuer()
+}
+
+// RotateKey replaces the provider's signing key.
+func (p *Provider) RotateKey(t testing.TB) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey() error = %v", err)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.serial++
+	p.key = key
+	p.kid = fmt.Sprintf("key-%d", p.serial)
+}
+
+// Authorize authenticates a user with claims (at least "sub") at the authorization URL
+// a client sent them to, and returns the query of the callback the provider redirects
+// them to.
+func (p *Provider) Authorize(authURL string, claims map[string]interface{}) (url.Values, error) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	if q.Get("response_type") != "code" || q.Get("client_id") != p.ClientID || q.Get("code_challenge_method") != "S256" {
+		return nil, fmt.Errorf("invalid authorization request %s", u.RawQuery)
+	}
+	code := randomString()
+	p.mu.Lock()
+	p.codes[code] = &grant{
+		clientID:    q.Get("client_id"),
+		redirectURI: q.Get("redirect_uri"),
+		nonce:       q.Get("nonce"),
+		challenge:   q.Get("code_challenge"),
+		claims:      jwt.MapClaims(claims),
+	}
+	p.mu.Unlock()
+	return url.Values{"code": {code}, "state": {q.Get("state")}}, nil
+}
+
+func (p *Provider) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pub := p.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": p.kid,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+func (p *Provider) handleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ParseForm() != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	if p.ClientSecret != "" {
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != p.ClientID || secret != p.ClientSecret {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+			return
+		}
+	}
+
+	p.mu.Lock()
+	g := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code")) // Codes are single-use
+	key, kid := p.key, p.kid
+	p.mu.Unlock()
+	verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if g == nil || g.clientID != r.PostForm.Get("client_id") || g.redirectURI != r.PostForm.Get("redirect_uri") ||
+		base64.RawURLEncoding.EncodeToString(verifier[:]) != g.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":   p.name(),
+		"aud":   p.ClientID,
+		"iat":   now.Unix(),
+		"exp":   now.Add(5 * time.Minute).Unix(),
+		"nonce": g.nonce,
+	}
+	for k, v := range g.claims {
+		claims[k] = v
+	}
+	if p.IDTokenHook != nil {
+		p.IDTokenHook(claims)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	idToken, err := token.SignedString(key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func randomString() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
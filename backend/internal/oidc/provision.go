@@ -0,0 +1,81 @@
+package oidc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/DARC0625/LIMEN/backend/internal/auth"
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"github.com/DARC0625/LIMEN/backend/internal/validator"
+	"gorm.io/gorm"
+)
+
+// ErrUserDisabled is returned for identities whose LIMEN user was deleted: single
+// sign-on doesn't bring deleted users back.
+var ErrUserDisabled = auth.ErrExternalUserDeleted
+
+// Provision returns the user of an identity, creating it at its first login, with the
+// attributes the provider's groups grant. It reports whether the user was created.
+func (c *Client) Provision(identity *Identity) (*models.User, bool, error) {
+	return auth.ProvisionExternalUser(c.db, c.cfg.Mapping, auth.ExternalLogin{
+		Issuer:   identity.Issuer,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+		Groups:   identity.Groups,
+		Username: func(tx *gorm.DB) (string, error) { return c.availableUsername(tx, identity) },
+	}, c.now())
+}
+
+// availableUsername derives a free, valid username for a new user from the username
+// claim, or else the email address, of identity. Existing users are never reused: a
+// local account named like the identity isn't proof they are the same person.
+func (c *Client) availableUsername(tx *gorm.DB, identity *Identity) (string, error) {
+	base := identity.Username
+	if base == "" {
+		base, _, _ = strings.Cut(identity.Email, "@")
+	}
+	base = sanitizeUsername(base)
+	if validator.ValidateUsername(base) != nil {
+		sum := sha256.Sum256([]byte(identity.Issuer + "\x00" + identity.Subject))
+		base = "sso_" + hex.EncodeToString(sum[:6])
+	}
+
+	for i := 1; i <= 100; i++ {
+		candidate := base
+		if i > 1 {
+			suffix := fmt.Sprintf("_%d", i)
+			if len(candidate)+len(suffix) > 32 {
+				candidate = candidate[:32-len(suffix)]
+			}
+			candidate += suffix
+		}
+		var count int64
+		// Unscoped: deleted users keep their username
+		if err := tx.Unscoped().Model(&models.User{}).Where("LOWER(username) = ?", strings.ToLower(candidate)).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("no free username for %q", base)
+}
+
+// sanitizeUsername replaces the characters usernames can't contain with underscores.
+func sanitizeUsername(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	name := b.String()
+	if len(name) > 32 {
+		name = name[:32]
+	}
+	return name
+}
@@ -0,0 +1,230 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// keyRefreshInterval bounds how often an unknown key ID refetches the provider's keys,
+// so tokens with made-up key IDs can't make LIMEN hammer the provider.
+const keyRefreshInterval = time.Minute
+
+// jwk is a public key of the provider's JWKS (RFC 7517).
+type jwk struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	Curve   string `json:"crv"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+}
+
+// keySet is the provider's signing keys by key ID.
+type keySet struct {
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+// Identity is a user authenticated by the provider.
+type Identity struct {
+	Issuer   string
+	Subject  string
+	Email    string
+	Username string // Claim configured as Config.UsernameClaim
+	Name     string
+	Groups   []string
+	MFA      bool // The token's amr or acr is one of Config.MFAValues
+}
+
+// verifyIDToken verifies the signature and claims of an ID token (OpenID Connect Core
+// §3.1.3.7) issued for the login with nonce.
+func (c *Client) verifyIDToken(ctx context.Context, raw, nonce string) (*Identity, error) {
+	meta, err := c.providerMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return c.signingKey(ctx, meta.JWKSURI, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "PS256", "EdDSA"}),
+		jwt.WithIssuer(meta.Issuer),
+		jwt.WithAudience(c.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithTimeFunc(c.now),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if got, _ := claims["nonce"].(string); got == "" || got != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidToken)
+	}
+	// A token for several audiences must be issued to LIMEN
+	if aud, _ := claims.GetAudience(); len(aud) > 1 {
+		if azp, _ := claims["azp"].(string); azp != c.cfg.ClientID {
+			return nil, fmt.Errorf("%w: authorized party %q", ErrInvalidToken, azp)
+		}
+	}
+
+	// Identities are linked by the configured issuer, whether or not the provider
+	// names itself with a trailing slash
+	identity := &Identity{Issuer: c.cfg.Issuer}
+	identity.Subject, _ = claims["sub"].(string)
+	if identity.Subject == "" {
+		return nil, fmt.Errorf("%w: no subject", ErrInvalidToken)
+	}
+	// Unverified addresses could belong to anyone
+	if verified, ok := claims["email_verified"].(bool); !ok || verified {
+		identity.Email, _ = claims["email"].(string)
+	}
+	identity.Username, _ = claims[c.cfg.UsernameClaim].(string)
+	identity.Name, _ = claims["name"].(string)
+	switch groups := claims[c.cfg.GroupsClaim].(type) {
+	case []interface{}:
+		for _, g := range groups {
+			if s, ok := g.(string); ok {
+				identity.Groups = append(identity.Groups, s)
+			}
+		}
+	case string: // Some providers send a single group as a string
+		identity.Groups = strings.Fields(strings.ReplaceAll(groups, ",", " "))
+	}
+	identity.MFA = c.passedMFA(claims)
+	return identity, nil
+}
+
+// passedMFA reports whether the amr or acr claim of an ID token is one of the
+// configured MFA values.
+func (c *Client) passedMFA(claims jwt.MapClaims) bool {
+	values := []string{}
+	if acr, ok := claims["acr"].(string); ok {
+		values = append(values, acr)
+	}
+	if amr, ok := claims["amr"].([]interface{}); ok {
+		for _, v := range amr {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+	for _, v := range values {
+		for _, want := range c.cfg.MFAValues {
+			if v == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// signingKey returns the provider key kid, refetching the provider's keys when it is
+// unknown, e.g. after a key rotation.
+func (c *Client) signingKey(ctx context.Context, jwksURI, kid string) (crypto.PublicKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.keys != nil {
+		if key, ok := c.keys.lookup(kid); ok {
+			return key, nil
+		}
+		if c.now().Sub(c.keys.fetchedAt) < keyRefreshInterval {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, jwksURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	status, err := c.getJSON(req, &set)
+	if err != nil || status != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch OIDC signing keys (status %d): %v", status, err)
+	}
+	keys := &keySet{keys: make(map[string]crypto.PublicKey, len(set.Keys)), fetchedAt: c.now()}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if key, err := k.publicKey(); err == nil {
+			keys.keys[k.KeyID] = key
+		}
+	}
+	c.keys = keys
+
+	if key, ok := keys.lookup(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// lookup returns key kid, or the only key when the token names none.
+func (s *keySet) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key, true
+		}
+	}
+	key, ok := s.keys[kid]
+	return key, ok
+}
+
+// publicKey decodes an RSA, EC or Ed25519 key.
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	decode := base64.RawURLEncoding.DecodeString
+	switch k.KeyType {
+	case "RSA":
+		n, err1 := decode(k.N)
+		e, err2 := decode(k.E)
+		if err1 != nil || err2 != nil || len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("invalid RSA key %q", k.KeyID)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Curve)
+		}
+		x, err1 := decode(k.X)
+		y, err2 := decode(k.Y)
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("invalid EC key %q", k.KeyID)
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, fmt.Errorf("invalid EC key %q", k.KeyID)
+		}
+		return key, nil
+	case "OKP":
+		x, err := decode(k.X)
+		if err != nil || k.Curve != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid OKP key %q", k.KeyID)
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.KeyType)
+	}
+}
@@ -0,0 +1,66 @@
+package osprofile
+
+// DefaultProfiles returns the built-in profiles, used when no profile file is configured.
+// They match the OS types accepted before profiles were introduced.
+func DefaultProfiles() []Profile {
+	return []Profile{
+		{
+			ID:              "ubuntu-desktop",
+			Name:            "Ubuntu Desktop",
+			Family:          "linux",
+			DefaultCPU:      2,
+			DefaultMemoryMB: 4096,
+			MinMemoryMB:     2048,
+			DefaultDiskGB:   20,
+			Firmware:        FirmwareBIOS,
+			DiskBus:         "virtio",
+			NICModel:        "virtio",
+			Graphics:        "vnc",
+			GUI:             true,
+			Unattended:      true,
+		},
+		{
+			ID:              "ubuntu-server",
+			Name:            "Ubuntu Server",
+			Family:          "linux",
+			DefaultCPU:      2,
+			DefaultMemoryMB: 2048,
+			MinMemoryMB:     2048,
+			DefaultDiskGB:   20,
+			Firmware:        FirmwareBIOS,
+			DiskBus:         "virtio",
+			NICModel:        "virtio",
+			Graphics:        "none",
+			Unattended:      true,
+		},
+		{
+			ID:              "kali",
+			Name:            "Kali Linux",
+			Family:          "linux",
+			DefaultCPU:      2,
+			DefaultMemoryMB: 4096,
+			MinMemoryMB:     2048,
+			DefaultDiskGB:   20,
+			Firmware:        FirmwareBIOS,
+			DiskBus:         "virtio",
+			NICModel:        "virtio",
+			Graphics:        "vnc",
+			GUI:             true,
+		},
+		{
+			ID:              "windows",
+			Name:            "Windows 10",
+			Family:          "windows",
+			DefaultCPU:      2,
+			DefaultMemoryMB: 4096,
+			MinMemoryMB:     4096,
+			DefaultDiskGB:   20,
+			Firmware:        FirmwareBIOS,
+			DiskBus:         "virtio",
+			NICModel:        "virtio",
+			Graphics:        "vnc",
+			GUI:             true,
+			ImageHint:       "windows10",
+		},
+	}
+}
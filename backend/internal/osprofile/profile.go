@@ -0,0 +1,176 @@
+// Package osprofile provides the declarative OS profile registry.
+// A profile captures everything VM creation needs to know about a guest OS
+// (default sizing, firmware, device models, console type) so that callers
+// don't have to pattern-match on os_type strings.
+package osprofile
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// Firmware selects the boot firmware for a VM.
+type Firmware string
+
+const (
+	FirmwareBIOS           Firmware = "bios"            // SeaBIOS
+	FirmwareUEFI           Firmware = "uefi"            // OVMF without Secure Boot
+	FirmwareUEFISecureBoot Firmware = "uefi-secureboot" // OVMF with Secure Boot enforced
+)
+
+// String returns the string representation of Firmware.
+func (f Firmware) String() string {
+	return string(f)
+}
+
+// IsValid checks if the firmware is a valid Firmware value.
+func (f Firmware) IsValid() bool {
+	switch f {
+	case FirmwareBIOS, FirmwareUEFI, FirmwareUEFISecureBoot:
+		return true
+	default:
+		return false
+	}
+}
+
+// Valid device models and console types.
+var (
+	validDiskBuses = map[string]bool{"virtio": true, "sata": true, "scsi": true}
+	validNICModels = map[string]bool{"virtio": true, "e1000e": true, "e1000": true, "rtl8139": true}
+	validGraphics  = map[string]bool{"vnc": true, "spice": true, "none": true}
+)
+
+// Profile describes how VMs of a given OS type are created.
+type Profile struct {
+	ID              string   `json:"id"`     // Matches VM.OSType and VMImage.OSType
+	Name            string   `json:"name"`   // Display name
+	Family          string   `json:"family"` // linux, windows, other
+	DefaultCPU      int      `json:"default_cpu"`
+	DefaultMemoryMB int      `json:"default_memory_mb"`
+	MinMemoryMB     int      `json:"min_memory_mb"` // Requests below this are raised to it
+	DefaultDiskGB   int      `json:"default_disk_gb"`
+	Firmware        Firmware `json:"firmware"`
+	TPM             bool     `json:"tpm"` // Emulated TPM 2.0
+	SecureBoot      bool     `json:"secure_boot"`
+	DiskBus         string   `json:"disk_bus"`
+	NICModel        string   `json:"nic_model"`
+	Graphics        string   `json:"graphics"`             // Default console: vnc, spice, none
+	GUI             bool     `json:"gui"`                  // Desktop OS - always gets a console unless graphics none is asked for explicitly
+	Unattended      bool     `json:"unattended"`           // Supports unattended installation
+	ImageHint       string   `json:"image_hint,omitempty"` // Preferred substring of the ISO path when several images share this OS type
+}
+
+// Validate checks the profile for missing or unsupported values.
+func (p *Profile) Validate() error {
+	if p.ID == "" {
+		return fmt.Errorf("id is required")
+	}
+	if p.DefaultCPU < 1 {
+		return fmt.Errorf("default_cpu must be at least 1")
+	}
+	if p.DefaultMemoryMB < p.MinMemoryMB || p.MinMemoryMB < 0 {
+		return fmt.Errorf("default_memory_mb must be at least min_memory_mb")
+	}
+	if p.DefaultDiskGB < 1 {
+		return fmt.Errorf("default_disk_gb must be at least 1")
+	}
+	if !p.Firmware.IsValid() {
+		return fmt.Errorf("invalid firmware %q", p.Firmware)
+	}
+	if p.SecureBoot && p.Firmware != FirmwareUEFISecureBoot {
+		return fmt.Errorf("secure_boot requires firmware %q", FirmwareUEFISecureBoot)
+	}
+	if !validDiskBuses[p.DiskBus] {
+		return fmt.Errorf("invalid disk_bus %q", p.DiskBus)
+	}
+	if !validNICModels[p.NICModel] {
+		return fmt.Errorf("invalid nic_model %q", p.NICModel)
+	}
+	if !validGraphics[p.Graphics] {
+		return fmt.Errorf("invalid graphics %q", p.Graphics)
+	}
+	if p.GUI && p.Graphics == "none" {
+		return fmt.Errorf("gui requires a graphical console")
+	}
+	return nil
+}
+
+// Registry holds the known OS profiles keyed by ID. It is immutable once built.
+type Registry struct {
+	profiles map[string]Profile
+}
+
+// NewRegistry creates a registry from profiles, validating each.
+func NewRegistry(profiles []Profile) (*Registry, error) {
+	r := &Registry{profiles: make(map[string]Profile, len(profiles))}
+	for i, p := range profiles {
+		if err := p.Validate(); err != nil {
+			return nil, fmt.Errorf("os profile %d (%s): %w", i, p.ID, err)
+		}
+		if _, dup := r.profiles[p.ID]; dup {
+			return nil, fmt.Errorf("os profile %d: duplicate id %q", i, p.ID)
+		}
+		r.profiles[p.ID] = p
+	}
+	return r, nil
+}
+
+// Load reads profiles from a JSON file ({"profiles": [...]}).
+// If the file does not exist, the built-in defaults are used.
+func Load(path string) (*Registry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return Default(), nil
+		}
+		return nil, fmt.Errorf("failed to read os profiles: %w", err)
+	}
+
+	var file struct {
+		Profiles []Profile `json:"profiles"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse os profiles: %w", err)
+	}
+	if len(file.Profiles) == 0 {
+		return nil, fmt.Errorf("os profile file %s defines no profiles", path)
+	}
+	return NewRegistry(file.Profiles)
+}
+
+// Default returns a registry with the built-in profiles.
+func Default() *Registry {
+	r, err := NewRegistry(DefaultProfiles())
+	if err != nil {
+		panic("invalid built-in os profiles: " + err.Error())
+	}
+	return r
+}
+
+// Get returns the profile for an OS type.
+func (r *Registry) Get(id string) (Profile, bool) {
+	p, ok := r.profiles[id]
+	return p, ok
+}
+
+// List returns all profiles sorted by ID.
+func (r *Registry) List() []Profile {
+	list := make([]Profile, 0, len(r.profiles))
+	for _, p := range r.profiles {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// IDs returns the known OS types, sorted.
+func (r *Registry) IDs() []string {
+	list := r.List()
+	ids := make([]string, len(list))
+	for i, p := range list {
+		ids[i] = p.ID
+	}
+	return ids
+}
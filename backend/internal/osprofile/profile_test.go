@@ -0,0 +1,109 @@
+package osprofile
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeProfiles(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "os-profiles.json")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write profiles: %v", err)
+	}
+	return path
+}
+
+func TestDefault(t *testing.T) {
+	reg := Default()
+
+	want := []string{"kali", "ubuntu-desktop", "ubuntu-server", "windows"}
+	if got := reg.IDs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("IDs() = %v, want %v", got, want)
+	}
+
+	p, ok := reg.Get("windows")
+	if !ok {
+		t.Fatal("Expected windows profile")
+	}
+	if p.MinMemoryMB != 4096 || p.ImageHint != "windows10" || !p.GUI {
+		t.Errorf("Unexpected windows profile: %+v", p)
+	}
+	if _, ok := reg.Get("plan9"); ok {
+		t.Error("Expected unknown profile to be missing")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	missing, err := Load(filepath.Join(t.TempDir(), "none.json"))
+	if err != nil {
+		t.Fatalf("Load(missing) failed: %v", err)
+	}
+	if len(missing.List()) != len(DefaultProfiles()) {
+		t.Errorf("Missing file should load the built-in profiles")
+	}
+
+	reg, err := Load(writeProfiles(t, `{"profiles":[{"id":"alpine","name":"Alpine","family":"linux",
+		"default_cpu":1,"default_memory_mb":512,"min_memory_mb":256,"default_disk_gb":4,
+		"firmware":"uefi","disk_bus":"virtio","nic_model":"virtio","graphics":"none"}]}`))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	p, ok := reg.Get("alpine")
+	if !ok || p.Firmware != FirmwareUEFI || p.DefaultMemoryMB != 512 {
+		t.Errorf("Unexpected profile: %+v", p)
+	}
+	if _, ok := reg.Get("ubuntu-server"); ok {
+		t.Error("File profiles should replace the built-in ones")
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	valid := func() Profile { return DefaultProfiles()[0] }
+
+	tests := []struct {
+		name   string
+		mutate func(*Profile)
+	}{
+		{"no id", func(p *Profile) { p.ID = "" }},
+		{"no cpu", func(p *Profile) { p.DefaultCPU = 0 }},
+		{"memory below minimum", func(p *Profile) { p.DefaultMemoryMB = p.MinMemoryMB - 1 }},
+		{"bad firmware", func(p *Profile) { p.Firmware = "coreboot" }},
+		{"secure boot without uefi", func(p *Profile) { p.SecureBoot = true }},
+		{"bad disk bus", func(p *Profile) { p.DiskBus = "ide" }},
+		{"bad nic", func(p *Profile) { p.NICModel = "ne2k" }},
+		{"bad graphics", func(p *Profile) { p.Graphics = "rdp" }},
+		{"gui without console", func(p *Profile) { p.GUI = true; p.Graphics = "none" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := valid()
+			tt.mutate(&p)
+			if _, err := NewRegistry([]Profile{p}); err == nil {
+				t.Error("Expected validation error")
+			}
+		})
+	}
+
+	if _, err := NewRegistry([]Profile{valid(), valid()}); err == nil {
+		t.Error("Expected duplicate id error")
+	}
+	if _, err := Load(writeProfiles(t, `{"profiles":[]}`)); err == nil {
+		t.Error("Expected error for empty profile file")
+	}
+	if _, err := Load(writeProfiles(t, `not json`)); err == nil {
+		t.Error("Expected parse error")
+	}
+}
+
+func TestLoad_ExampleFile(t *testing.T) {
+	reg, err := Load("../../config/os-profiles.json")
+	if err != nil {
+		t.Fatalf("Example profile file is invalid: %v", err)
+	}
+	if !reflect.DeepEqual(reg.List(), Default().List()) {
+		t.Error("Example profile file should match the built-in profiles")
+	}
+}
@@ -0,0 +1,101 @@
+package recording
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+)
+
+// ndjsonFrame is one line of the NDJSON playback format.
+type ndjsonFrame struct {
+	Time float64 `json:"t"`    // Seconds since the start of the recording
+	Dir  string  `json:"dir"`  // "o" (VM to client) or "i" (client to VM)
+	Data []byte  `json:"data"` // Raw bytes (base64 in JSON)
+}
+
+// WriteNDJSON writes every frame of r as a JSON line. Players replay the
+// output frames into a VNC or terminal client at the recorded offsets.
+// A truncated recording is written up to the truncation point.
+func WriteNDJSON(w io.Writer, r *Reader) error {
+	enc := json.NewEncoder(w)
+	for {
+		f, err := r.Next()
+		if err != nil {
+			return endOfRecording(err)
+		}
+		if err := enc.Encode(ndjsonFrame{Time: f.Offset.Seconds(), Dir: string(f.Dir), Data: f.Data}); err != nil {
+			return err
+		}
+	}
+}
+
+// WriteAsciicast writes a serial recording as an asciicast v2 file
+// (https://docs.asciinema.org/manual/asciicast/v2/), playable with asciinema.
+// Input frames are written as "i" events.
+func WriteAsciicast(w io.Writer, r *Reader, rec *models.ConsoleRecording) error {
+	enc := json.NewEncoder(w)
+	header := map[string]interface{}{
+		"version":   2,
+		"width":     80,
+		"height":    24,
+		"timestamp": rec.StartedAt.Unix(),
+		"title":     "LIMEN serial console " + rec.VMUUID,
+	}
+	if err := enc.Encode(header); err != nil {
+		return err
+	}
+
+	// Output is a byte stream; carry incomplete UTF-8 sequences over to the next frame
+	var carry []byte
+	for {
+		f, err := r.Next()
+		if err != nil {
+			return endOfRecording(err)
+		}
+		data := f.Data
+		if f.Dir == Output {
+			data = append(carry, data...)
+			carry = nil
+			if cut := incompleteUTF8Suffix(data); cut > 0 {
+				carry = append([]byte(nil), data[len(data)-cut:]...)
+				data = data[:len(data)-cut]
+			}
+		}
+		if len(data) == 0 {
+			continue
+		}
+		event := []interface{}{f.Offset.Seconds(), string(f.Dir), strings.ToValidUTF8(string(data), "�")}
+		if err := enc.Encode(event); err != nil {
+			return err
+		}
+	}
+}
+
+// incompleteUTF8Suffix returns the length of a truncated multi-byte sequence at the end of b.
+func incompleteUTF8Suffix(b []byte) int {
+	for i := 1; i <= 3 && i <= len(b); i++ {
+		c := b[len(b)-i]
+		if c < 0x80 {
+			return 0
+		}
+		if utf8.RuneStart(c) {
+			if !utf8.FullRune(b[len(b)-i:]) {
+				return i
+			}
+			return 0
+		}
+	}
+	return 0
+}
+
+// endOfRecording maps the end of a recording to nil; truncation after a crash is expected.
+func endOfRecording(err error) error {
+	if err == io.EOF || errors.Is(err, ErrTruncated) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,181 @@
+// Package recording records console sessions (VNC/RFB and serial streams) to
+// timestamped, optionally encrypted files and reads them back for playback.
+package recording
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/DARC0625/LIMEN/backend/internal/crypto"
+)
+
+// File layout:
+//
+//	header: "LIMENREC" | version (1 byte) | flags (1 byte)
+//	blocks: length (uint32 BE) | payload
+//
+// A payload is sequence (uint64 BE) followed by frames, sealed with
+// crypto.ChaCha20Poly1305Encrypt when the file is encrypted. The sequence number
+// makes dropped or reordered blocks detectable. A frame is
+//
+//	direction (1 byte) | offset since start in ms (uint32 BE) | length (uint32 BE) | data
+const (
+	fileMagic     = "LIMENREC"
+	fileVersion   = 1
+	flagEncrypted = 1 << 0
+
+	headerSize      = len(fileMagic) + 2
+	frameHeaderSize = 9
+	maxBlockSize    = 16 << 20
+)
+
+var (
+	ErrNotRecording = errors.New("not a console recording")
+	ErrKeyRequired  = errors.New("recording is encrypted and no key is configured")
+	ErrCorrupt      = errors.New("recording is corrupt")
+	// ErrTruncated is returned for a partially written final block, e.g. after a crash.
+	// Frames before it are intact.
+	ErrTruncated = errors.New("recording is truncated")
+)
+
+// Direction is the direction of a recorded frame.
+type Direction byte
+
+const (
+	Output Direction = 'o' // VM to client (screen updates, terminal output)
+	Input  Direction = 'i' // Client to VM (keyboard and pointer events, typed input)
+)
+
+// Frame is one recorded chunk of console traffic.
+type Frame struct {
+	Offset time.Duration // Time since the start of the recording
+	Dir    Direction
+	Data   []byte
+}
+
+// writeHeader writes the file header.
+func writeHeader(w io.Writer, encrypted bool) error {
+	var flags byte
+	if encrypted {
+		flags |= flagEncrypted
+	}
+	_, err := w.Write(append([]byte(fileMagic), fileVersion, flags))
+	return err
+}
+
+// appendFrame encodes a frame onto buf.
+func appendFrame(buf *bytes.Buffer, f Frame) {
+	var hdr [frameHeaderSize]byte
+	hdr[0] = byte(f.Dir)
+	binary.BigEndian.PutUint32(hdr[1:5], uint32(f.Offset/time.Millisecond))
+	binary.BigEndian.PutUint32(hdr[5:9], uint32(len(f.Data)))
+	buf.Write(hdr[:])
+	buf.Write(f.Data)
+}
+
+// sealBlock builds the on-disk block for frames with sequence number seq.
+func sealBlock(seq uint64, frames []byte, key []byte) ([]byte, error) {
+	payload := make([]byte, 8, 8+len(frames))
+	binary.BigEndian.PutUint64(payload, seq)
+	payload = append(payload, frames...)
+	if key != nil {
+		sealed, err := crypto.ChaCha20Poly1305Encrypt(payload, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt recording block: %w", err)
+		}
+		payload = sealed
+	}
+	block := make([]byte, 4, 4+len(payload))
+	binary.BigEndian.PutUint32(block, uint32(len(payload)))
+	return append(block, payload...), nil
+}
+
+// Reader decodes frames from a recording.
+type Reader struct {
+	r         *bufio.Reader
+	key       []byte
+	encrypted bool
+	seq       uint64
+	pending   []byte // Undecoded frames of the current block
+}
+
+// NewReader reads the header of a recording. key is required for encrypted recordings.
+func NewReader(r io.Reader, key []byte) (*Reader, error) {
+	br := bufio.NewReader(r)
+	hdr := make([]byte, headerSize)
+	if _, err := io.ReadFull(br, hdr); err != nil || string(hdr[:len(fileMagic)]) != fileMagic {
+		return nil, ErrNotRecording
+	}
+	if hdr[len(fileMagic)] != fileVersion {
+		return nil, fmt.Errorf("unsupported recording version %d", hdr[len(fileMagic)])
+	}
+	encrypted := hdr[len(fileMagic)+1]&flagEncrypted != 0
+	if encrypted && key == nil {
+		return nil, ErrKeyRequired
+	}
+	return &Reader{r: br, key: key, encrypted: encrypted}, nil
+}
+
+// Encrypted reports whether the recording is encrypted at rest.
+func (r *Reader) Encrypted() bool {
+	return r.encrypted
+}
+
+// Next returns the next frame, or io.EOF at the end of the recording.
+func (r *Reader) Next() (Frame, error) {
+	for len(r.pending) == 0 {
+		if err := r.readBlock(); err != nil {
+			return Frame{}, err
+		}
+	}
+	if len(r.pending) < frameHeaderSize {
+		return Frame{}, ErrCorrupt
+	}
+	n := int(binary.BigEndian.Uint32(r.pending[5:9]))
+	if len(r.pending) < frameHeaderSize+n {
+		return Frame{}, ErrCorrupt
+	}
+	f := Frame{
+		Dir:    Direction(r.pending[0]),
+		Offset: time.Duration(binary.BigEndian.Uint32(r.pending[1:5])) * time.Millisecond,
+		Data:   r.pending[frameHeaderSize : frameHeaderSize+n],
+	}
+	r.pending = r.pending[frameHeaderSize+n:]
+	return f, nil
+}
+
+func (r *Reader) readBlock() error {
+	var lenBuf [4]byte
+	if _, err := io.ReadFull(r.r, lenBuf[:]); err != nil {
+		if err == io.EOF {
+			return io.EOF
+		}
+		return ErrTruncated
+	}
+	n := binary.BigEndian.Uint32(lenBuf[:])
+	if n > maxBlockSize {
+		return ErrCorrupt
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r.r, payload); err != nil {
+		return ErrTruncated
+	}
+	if r.encrypted {
+		plain, err := crypto.ChaCha20Poly1305Decrypt(payload, r.key)
+		if err != nil {
+			return ErrCorrupt
+		}
+		payload = plain
+	}
+	if len(payload) < 8 || binary.BigEndian.Uint64(payload[:8]) != r.seq {
+		return ErrCorrupt
+	}
+	r.seq++
+	r.pending = payload[8:]
+	return nil
+}
@@ -0,0 +1,289 @@
+package recording
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DARC0625/LIMEN/backend/internal/logger"
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestStore(t *testing.T, key []byte) *Store {
+	t.Helper()
+	logger.Init("debug")
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.ConsoleRecording{}); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+	return NewStore(db, t.TempDir(), key, 0, 0)
+}
+
+func readAll(t *testing.T, s *Store, id uint) []Frame {
+	t.Helper()
+	rec, err := s.Get(id)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	r, closer, err := s.Open(rec)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer closer.Close()
+
+	var frames []Frame
+	for {
+		f, err := r.Next()
+		if err == io.EOF {
+			return frames
+		}
+		if err != nil {
+			t.Fatalf("Next() error = %v", err)
+		}
+		frames = append(frames, f)
+	}
+}
+
+func TestRecorder_RoundTrip(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		key  []byte
+	}{
+		{"plain", nil},
+		{"encrypted", bytes.Repeat([]byte{7}, 32)},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s := setupTestStore(t, tt.key)
+			rec, err := s.Start("sess-1", "vm-1", 3, "serial")
+			if err != nil {
+				t.Fatalf("Start() error = %v", err)
+			}
+			rec.Record(Output, []byte("login: "))
+			rec.Record(Input, []byte("root\r"))
+			// Larger than a block, so the recording spans several blocks
+			big := bytes.Repeat([]byte("x"), flushSize+10)
+			rec.Record(Output, big)
+			rec.Record(Output, []byte("# "))
+			if err := rec.Close(); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+
+			frames := readAll(t, s, rec.ID())
+			want := []struct {
+				dir  Direction
+				data string
+			}{{Output, "login: "}, {Input, "root\r"}, {Output, string(big)}, {Output, "# "}}
+			if len(frames) != len(want) {
+				t.Fatalf("got %d frames, want %d", len(frames), len(want))
+			}
+			for i, w := range want {
+				if frames[i].Dir != w.dir || string(frames[i].Data) != w.data {
+					t.Errorf("frame %d = %c %q, want %c %q", i, frames[i].Dir, frames[i].Data, w.dir, w.data)
+				}
+			}
+
+			stored, _ := s.Get(rec.ID())
+			if stored.EndedAt == nil || stored.Encrypted != (tt.key != nil) {
+				t.Errorf("recording not finalised: %+v", stored)
+			}
+			info, _ := os.Stat(stored.Path)
+			if info.Size() != stored.Size {
+				t.Errorf("stored size = %d, file size = %d", stored.Size, info.Size())
+			}
+			if info.Mode().Perm() != 0600 {
+				t.Errorf("file mode = %v, want 0600", info.Mode().Perm())
+			}
+
+			raw, _ := os.ReadFile(stored.Path)
+			if tt.key != nil && bytes.Contains(raw, []byte("login: ")) {
+				t.Error("encrypted recording contains plaintext")
+			}
+		})
+	}
+}
+
+func TestRecorder_MaxSize(t *testing.T) {
+	s := setupTestStore(t, nil)
+	s.maxSize = int64(headerSize) + 2*flushSize
+	rec, err := s.Start("sess-1", "vm-1", 3, "serial")
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	big := bytes.Repeat([]byte("x"), flushSize+10)
+	rec.Record(Output, big)
+	rec.Record(Output, big) // Past the limit: the recording stops here
+	rec.Record(Output, []byte("# "))
+	if err := rec.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	if frames := readAll(t, s, rec.ID()); len(frames) != 1 {
+		t.Errorf("got %d frames, want the 1 within the limit", len(frames))
+	}
+	stored, _ := s.Get(rec.ID())
+	if stored.EndedAt == nil || stored.Size > s.maxSize {
+		t.Errorf("recording = %+v, want it finalised within %d bytes", stored, s.maxSize)
+	}
+}
+
+func TestReader_Errors(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	s := setupTestStore(t, key)
+	rec, _ := s.Start("sess-err", "vm-1", 1, "vnc")
+	rec.Record(Output, []byte("RFB 003.008\n"))
+	rec.Close()
+	stored, _ := s.Get(rec.ID())
+	raw, _ := os.ReadFile(stored.Path)
+
+	t.Run("not a recording", func(t *testing.T) {
+		if _, err := NewReader(strings.NewReader("hello"), nil); err != ErrNotRecording {
+			t.Errorf("NewReader() error = %v, want ErrNotRecording", err)
+		}
+	})
+
+	t.Run("no key", func(t *testing.T) {
+		if _, err := NewReader(bytes.NewReader(raw), nil); err != ErrKeyRequired {
+			t.Errorf("NewReader() error = %v, want ErrKeyRequired", err)
+		}
+	})
+
+	t.Run("wrong key", func(t *testing.T) {
+		r, err := NewReader(bytes.NewReader(raw), bytes.Repeat([]byte{2}, 32))
+		if err != nil {
+			t.Fatalf("NewReader() error = %v", err)
+		}
+		if _, err := r.Next(); err != ErrCorrupt {
+			t.Errorf("Next() error = %v, want ErrCorrupt", err)
+		}
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		r, _ := NewReader(bytes.NewReader(raw[:len(raw)-3]), key)
+		if _, err := r.Next(); err != ErrTruncated {
+			t.Errorf("Next() error = %v, want ErrTruncated", err)
+		}
+	})
+
+	t.Run("reordered blocks", func(t *testing.T) {
+		// A block replayed in place of a later one fails the sequence check
+		block := raw[headerSize:]
+		doubled := append(append([]byte{}, raw...), block...)
+		r, _ := NewReader(bytes.NewReader(doubled), key)
+		if _, err := r.Next(); err != nil {
+			t.Fatalf("first Next() error = %v", err)
+		}
+		if _, err := r.Next(); err != ErrCorrupt {
+			t.Errorf("second Next() error = %v, want ErrCorrupt", err)
+		}
+	})
+}
+
+func TestStore_Prune(t *testing.T) {
+	s := setupTestStore(t, nil)
+	old, _ := s.Start("sess-old", "vm-1", 1, "serial")
+	old.Close()
+	live, _ := s.Start("sess-live", "vm-1", 1, "serial")
+	defer live.Close()
+	s.db.Model(&models.ConsoleRecording{}).Where("id = ?", old.ID()).Update("started_at", time.Now().Add(-36*time.Hour))
+	s.db.Model(&models.ConsoleRecording{}).Where("id = ?", live.ID()).Update("started_at", time.Now().Add(-36*time.Hour))
+
+	oldRec, _ := s.Get(old.ID())
+	n, err := s.Prune(time.Now().Add(-24 * time.Hour))
+	if err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+	if n != 1 {
+		t.Errorf("Prune() deleted %d, want 1", n)
+	}
+	if _, err := s.Get(old.ID()); err != ErrRecordingNotFound {
+		t.Errorf("expired recording still indexed: %v", err)
+	}
+	if _, err := os.Stat(oldRec.Path); !os.IsNotExist(err) {
+		t.Errorf("expired recording file still exists")
+	}
+	// Unfinished recordings get a day's grace
+	if _, err := s.Get(live.ID()); err != nil {
+		t.Errorf("unfinished recording was pruned: %v", err)
+	}
+}
+
+type fakeStream struct {
+	bytes.Buffer
+	out []byte
+}
+
+func (f *fakeStream) Read(p []byte) (int, error) {
+	if len(f.out) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, f.out)
+	f.out = f.out[n:]
+	return n, nil
+}
+
+func (f *fakeStream) Close() error { return nil }
+
+func TestWrap(t *testing.T) {
+	s := setupTestStore(t, nil)
+	rec, _ := s.Start("sess-wrap", "vm-1", 1, "serial")
+
+	fake := &fakeStream{out: []byte("hello\r\n")}
+	stream := Wrap(fake, rec)
+	io.WriteString(stream, "ls\r")
+	io.ReadAll(stream)
+	rec.Close()
+
+	frames := readAll(t, s, rec.ID())
+	if len(frames) != 2 || frames[0].Dir != Input || string(frames[0].Data) != "ls\r" ||
+		frames[1].Dir != Output || string(frames[1].Data) != "hello\r\n" {
+		t.Errorf("unexpected frames %+v", frames)
+	}
+	if Wrap(fake, nil) != io.ReadWriteCloser(fake) {
+		t.Error("Wrap() with nil recorder should return the stream unchanged")
+	}
+}
+
+func TestWriteAsciicast(t *testing.T) {
+	s := setupTestStore(t, nil)
+	rec, _ := s.Start("sess-cast", "vm-1", 1, "serial")
+	// A multi-byte character split across frames
+	rec.Record(Output, []byte("caf\xc3"))
+	rec.Record(Output, []byte("\xa9\r\n"))
+	rec.Close()
+
+	stored, _ := s.Get(rec.ID())
+	r, closer, _ := s.Open(stored)
+	defer closer.Close()
+	var buf bytes.Buffer
+	if err := WriteAsciicast(&buf, r, stored); err != nil {
+		t.Fatalf("WriteAsciicast() error = %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want header and 2 events:\n%s", len(lines), buf.String())
+	}
+	var header map[string]interface{}
+	json.Unmarshal([]byte(lines[0]), &header)
+	if header["version"] != float64(2) {
+		t.Errorf("header = %v", header)
+	}
+	var output string
+	for _, line := range lines[1:] {
+		var ev []interface{}
+		json.Unmarshal([]byte(line), &ev)
+		output += ev[2].(string)
+	}
+	if output != "café\r\n" {
+		t.Errorf("output = %q, want %q", output, "café\r\n")
+	}
+}
@@ -0,0 +1,347 @@
+package recording
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/DARC0625/LIMEN/backend/internal/logger"
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+var ErrRecordingNotFound = errors.New("recording not found")
+
+const (
+	// Buffered frames are written out once a block reaches this size or age
+	flushSize     = 32 << 10
+	flushInterval = 2 * time.Second
+
+	fileExt = ".lrec"
+)
+
+// Store keeps console recordings under dir and their index in the database.
+type Store struct {
+	db        *gorm.DB
+	dir       string
+	key       []byte        // nil = recordings are stored unencrypted
+	retention time.Duration // 0 = keep forever
+	maxSize   int64         // Bytes a recording may grow to (0 = unlimited)
+
+	stopOnce sync.Once
+	stop     chan struct{}
+}
+
+// NewStore creates a recording store rooted at dir. With a 32-byte key, new
+// recordings are encrypted at rest. retention is how long recordings are kept (0 = forever).
+// Recordings stop once they reach maxSize bytes (0 = unlimited); the session goes on.
+func NewStore(db *gorm.DB, dir string, key []byte, retention time.Duration, maxSize int64) *Store {
+	return &Store{
+		db:        db,
+		dir:       dir,
+		key:       key,
+		retention: retention,
+		maxSize:   maxSize,
+		stop:      make(chan struct{}),
+	}
+}
+
+// Encrypted reports whether new recordings are encrypted at rest.
+func (s *Store) Encrypted() bool {
+	return s.key != nil
+}
+
+// Start begins recording a console session. protocol is vnc or serial.
+func (s *Store) Start(sessionID, vmUUID string, userID uint, protocol string) (*Recorder, error) {
+	now := time.Now()
+	dayDir := filepath.Join(s.dir, now.Format("20060102"))
+	if err := os.MkdirAll(dayDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create recording directory: %w", err)
+	}
+	path := filepath.Join(dayDir, fmt.Sprintf("%s-%s%s", now.Format("150405"), sessionID, fileExt))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create recording file: %w", err)
+	}
+	if err := writeHeader(f, s.key != nil); err != nil {
+		f.Close()
+		os.Remove(path)
+		return nil, fmt.Errorf("failed to write recording header: %w", err)
+	}
+
+	rec := models.ConsoleRecording{
+		SessionID: sessionID,
+		VMUUID:    vmUUID,
+		UserID:    userID,
+		Protocol:  protocol,
+		Path:      path,
+		Encrypted: s.key != nil,
+		Size:      int64(headerSize),
+		StartedAt: now,
+	}
+	if err := s.db.Create(&rec).Error; err != nil {
+		f.Close()
+		os.Remove(path)
+		return nil, fmt.Errorf("failed to save recording: %w", err)
+	}
+
+	logger.Log.Info("Console recording started",
+		zap.Uint("recording_id", rec.ID),
+		zap.String("session_id", sessionID),
+		zap.String("vm_uuid", vmUUID),
+		zap.String("protocol", protocol),
+		zap.Bool("encrypted", rec.Encrypted))
+
+	return &Recorder{
+		store:     s,
+		rec:       rec,
+		f:         f,
+		start:     now,
+		lastFlush: now,
+		size:      int64(headerSize),
+	}, nil
+}
+
+// Get returns a recording by ID.
+func (s *Store) Get(id uint) (*models.ConsoleRecording, error) {
+	var rec models.ConsoleRecording
+	if err := s.db.First(&rec, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRecordingNotFound
+		}
+		return nil, err
+	}
+	return &rec, nil
+}
+
+// ListFilter narrows List. Zero values match everything.
+type ListFilter struct {
+	VMUUID    string
+	UserID    uint
+	SessionID string
+	Limit     int
+}
+
+// List returns recordings matching filter, newest first.
+func (s *Store) List(filter ListFilter) ([]models.ConsoleRecording, error) {
+	q := s.db.Order("started_at DESC")
+	if filter.VMUUID != "" {
+		q = q.Where("vm_uuid = ?", filter.VMUUID)
+	}
+	if filter.UserID != 0 {
+		q = q.Where("user_id = ?", filter.UserID)
+	}
+	if filter.SessionID != "" {
+		q = q.Where("session_id = ?", filter.SessionID)
+	}
+	if filter.Limit > 0 {
+		q = q.Limit(filter.Limit)
+	}
+	var recs []models.ConsoleRecording
+	if err := q.Find(&recs).Error; err != nil {
+		return nil, err
+	}
+	return recs, nil
+}
+
+// Open opens a recording for playback. The caller must close the returned file.
+func (s *Store) Open(rec *models.ConsoleRecording) (*Reader, io.Closer, error) {
+	f, err := os.Open(rec.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil, ErrRecordingNotFound
+		}
+		return nil, nil, err
+	}
+	r, err := NewReader(f, s.key)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return r, f, nil
+}
+
+// Prune deletes recordings that started before cutoff. It returns how many were deleted.
+// Recordings that were never finalised (the server stopped mid-session) are kept a
+// day longer so a live session is never pruned.
+func (s *Store) Prune(cutoff time.Time) (int, error) {
+	var expired []models.ConsoleRecording
+	if err := s.db.Where("started_at < ? AND (ended_at IS NOT NULL OR started_at < ?)", cutoff, cutoff.Add(-24*time.Hour)).
+		Find(&expired).Error; err != nil {
+		return 0, err
+	}
+	deleted := 0
+	for _, rec := range expired {
+		if err := os.Remove(rec.Path); err != nil && !os.IsNotExist(err) {
+			logger.Log.Warn("Failed to delete expired console recording",
+				zap.Uint("recording_id", rec.ID), zap.String("path", rec.Path), zap.Error(err))
+			continue
+		}
+		if err := s.db.Delete(&models.ConsoleRecording{}, rec.ID).Error; err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// StartRetention prunes recordings older than the retention period every interval until Stop.
+// It does nothing if retention is disabled.
+func (s *Store) StartRetention(interval time.Duration) {
+	if s.retention <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if n, err := s.Prune(time.Now().Add(-s.retention)); err != nil {
+				logger.Log.Warn("Console recording retention failed", zap.Error(err))
+			} else if n > 0 {
+				logger.Log.Info("Deleted expired console recordings", zap.Int("count", n))
+			}
+			select {
+			case <-ticker.C:
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the retention loop.
+func (s *Store) Stop() {
+	s.stopOnce.Do(func() { close(s.stop) })
+}
+
+// Recorder writes one session's recording. All methods are safe on a nil Recorder,
+// so callers don't need to check whether recording is enabled.
+type Recorder struct {
+	store *Store
+	rec   models.ConsoleRecording
+
+	mu        sync.Mutex
+	f         *os.File
+	buf       bytes.Buffer
+	seq       uint64
+	start     time.Time
+	lastFlush time.Time
+	size      int64
+	failed    bool
+}
+
+// ID returns the recording's database ID.
+func (r *Recorder) ID() uint {
+	if r == nil {
+		return 0
+	}
+	return r.rec.ID
+}
+
+// Record appends a frame. Errors are logged and stop the recording but never
+// interrupt the console session. data is copied.
+func (r *Recorder) Record(dir Direction, data []byte) {
+	if r == nil || len(data) == 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.failed || r.f == nil {
+		return
+	}
+
+	now := time.Now()
+	appendFrame(&r.buf, Frame{Offset: now.Sub(r.start), Dir: dir, Data: data})
+	if r.buf.Len() >= flushSize || now.Sub(r.lastFlush) >= flushInterval {
+		r.flushLocked(now)
+	}
+}
+
+func (r *Recorder) flushLocked(now time.Time) {
+	r.lastFlush = now
+	if r.buf.Len() == 0 {
+		return
+	}
+	block, err := sealBlock(r.seq, r.buf.Bytes(), r.store.key)
+	r.buf.Reset()
+	if err == nil && r.store.maxSize > 0 && r.size+int64(len(block)) > r.store.maxSize {
+		r.failed = true
+		logger.Log.Warn("Console recording reached its size limit; session continues unrecorded",
+			zap.Uint("recording_id", r.rec.ID), zap.Int64("max_size", r.store.maxSize))
+		return
+	}
+	if err == nil {
+		_, err = r.f.Write(block)
+	}
+	if err != nil {
+		r.failed = true
+		logger.Log.Error("Console recording failed; session continues unrecorded",
+			zap.Uint("recording_id", r.rec.ID), zap.Error(err))
+		return
+	}
+	r.seq++
+	r.size += int64(len(block))
+}
+
+// Close flushes buffered frames and finalises the recording.
+func (r *Recorder) Close() error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return nil
+	}
+
+	if !r.failed {
+		r.flushLocked(time.Now())
+	}
+	err := r.f.Close()
+	r.f = nil
+
+	endedAt := time.Now()
+	if dbErr := r.store.db.Model(&models.ConsoleRecording{}).Where("id = ?", r.rec.ID).
+		Updates(map[string]interface{}{"ended_at": endedAt, "size": r.size}).Error; dbErr != nil {
+		logger.Log.Warn("Failed to finalise console recording", zap.Uint("recording_id", r.rec.ID), zap.Error(dbErr))
+	}
+
+	logger.Log.Info("Console recording finished",
+		zap.Uint("recording_id", r.rec.ID),
+		zap.String("session_id", r.rec.SessionID),
+		zap.Int64("size", r.size),
+		zap.Duration("duration", endedAt.Sub(r.start)))
+	return err
+}
+
+// Wrap returns rw with reads recorded as Output and writes as Input.
+// It returns rw unchanged if rec is nil.
+func Wrap(rw io.ReadWriteCloser, rec *Recorder) io.ReadWriteCloser {
+	if rec == nil {
+		return rw
+	}
+	return &recordedStream{ReadWriteCloser: rw, rec: rec}
+}
+
+type recordedStream struct {
+	io.ReadWriteCloser
+	rec *Recorder
+}
+
+func (s *recordedStream) Read(p []byte) (int, error) {
+	n, err := s.ReadWriteCloser.Read(p)
+	s.rec.Record(Output, p[:n])
+	return n, err
+}
+
+func (s *recordedStream) Write(p []byte) (int, error) {
+	n, err := s.ReadWriteCloser.Write(p)
+	s.rec.Record(Input, p[:n])
+	return n, err
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/DARC0625/LIMEN/backend/internal/config"
 	"github.com/DARC0625/LIMEN/backend/internal/handlers"
 	limenMiddleware "github.com/DARC0625/LIMEN/backend/internal/middleware"
+	"github.com/DARC0625/LIMEN/backend/internal/models"
 	"github.com/go-chi/chi/v5"
 	httpSwagger "github.com/swaggo/http-swagger"
 )
@@ -30,6 +31,9 @@ func SetupRoutes(h *handlers.Handler, cfg *config.Config) *chi.Mux {
 		h.HandleWaitlist(w, r, cfg)
 	}) // Public waitlist registration (no auth required)
 
+	// Keys verifying LIMEN's JWTs, for other services (agent, Envoy)
+	r.Get("/.well-known/jwks.json", h.HandleJWKS)
+
 	// Swagger documentation endpoints
 	// http-swagger handles /swagger/doc.json automatically
 	r.Mount("/swagger/", httpSwagger.WrapHandler)
@@ -55,11 +59,12 @@ func SetupRoutes(h *handlers.Handler, cfg *config.Config) *chi.Mux {
 		h.HandleWeakestLink(w, r, cfg)
 	})
 
-	// Log analysis endpoints (public for monitoring)
-	api.Get("/logs/stats", func(w http.ResponseWriter, r *http.Request) {
+	// Log analysis endpoints (admins and auditors)
+	logsPermission := limenMiddleware.RequirePermission(models.PermLogsRead)
+	api.With(logsPermission).Get("/logs/stats", func(w http.ResponseWriter, r *http.Request) {
 		h.HandleLogStats(w, r, cfg)
 	})
-	api.Get("/logs/search", func(w http.ResponseWriter, r *http.Request) {
+	api.With(logsPermission).Get("/logs/search", func(w http.ResponseWriter, r *http.Request) {
 		h.HandleLogSearch(w, r, cfg)
 	})
 
@@ -91,6 +96,58 @@ func SetupRoutes(h *handlers.Handler, cfg *config.Config) *chi.Mux {
 		h.HandleRefreshToken(w, r, cfg)
 	})
 
+	// Second login step for users with MFA (public: authenticated by the mfa_token)
+	api.Post("/auth/login/mfa", func(w http.ResponseWriter, r *http.Request) {
+		h.HandleLoginMFA(w, r, cfg)
+	})
+	api.Post("/auth/login/mfa/enroll", h.HandleLoginMFAEnroll)
+	api.Post("/auth/login/mfa/webauthn", h.HandleBeginMFAWebAuthn)
+
+	// Single sign-on with the OIDC identity provider (public: browser redirects)
+	api.Get("/auth/oidc/login", func(w http.ResponseWriter, r *http.Request) {
+		h.HandleOIDCLogin(w, r, cfg)
+	})
+	api.Get("/auth/oidc/callback", func(w http.ResponseWriter, r *http.Request) {
+		h.HandleOIDCCallback(w, r, cfg)
+	})
+
+	// Passwordless login with a passkey (public)
+	api.Post("/auth/login/webauthn/begin", h.HandleBeginWebAuthnLogin)
+	api.Post("/auth/login/webauthn/finish", func(w http.ResponseWriter, r *http.Request) {
+		h.HandleFinishWebAuthnLogin(w, r, cfg)
+	})
+
+	// The user's MFA (authenticated)
+	api.Get("/auth/mfa", h.HandleGetMFA)
+	api.Delete("/auth/mfa", h.HandleDisableMFA)
+	api.Post("/auth/mfa/enroll", h.HandleEnrollMFA)
+	api.Post("/auth/mfa/verify", h.HandleVerifyMFA)
+	api.Post("/auth/mfa/recovery-codes", h.HandleRegenerateRecoveryCodes)
+
+	// The user's passkeys and security keys (authenticated)
+	api.Post("/auth/webauthn/register/begin", h.HandleBeginWebAuthnRegistration)
+	api.Post("/auth/webauthn/register/finish", h.HandleFinishWebAuthnRegistration)
+	api.Get("/auth/webauthn/credentials", h.HandleListWebAuthnCredentials)
+	api.Delete("/auth/webauthn/credentials/{id}", h.HandleDeleteWebAuthnCredential)
+
+	// The user's login sessions (authenticated)
+	api.Get("/auth/sessions", h.HandleListSessions)
+	api.Delete("/auth/sessions/{id}", h.HandleRevokeSession)
+
+	// Password resets and email verification (public: authenticated by the mailed token)
+	api.Post("/auth/password/forgot", h.HandleForgotPassword)
+	api.Post("/auth/password/reset", h.HandleResetPassword)
+	api.Post("/auth/email/verify", h.HandleVerifyEmail)
+
+	// The user's password and email address (authenticated)
+	api.Post("/auth/password", h.HandleChangePassword)
+	api.Put("/auth/email", h.HandleChangeEmail)
+
+	// The user's personal access tokens (authenticated, not by the tokens themselves)
+	api.Get("/auth/tokens", h.HandleListAPITokens)
+	api.Post("/auth/tokens", h.HandleCreateAPIToken)
+	api.Delete("/auth/tokens/{id}", h.HandleRevokeAPIToken)
+
 	// Admin-only endpoints for user management
 	// IMPORTANT: Register these BEFORE other protected endpoints to ensure proper matching
 	// These routes require authentication (via main.go Auth middleware) and admin role
@@ -134,6 +191,44 @@ func SetupRoutes(h *handlers.Handler, cfg *config.Config) *chi.Mux {
 		h.HandleBetaAccess(w, r, cfg)
 	})
 
+	r.With(adminIPWhitelist, adminMiddleware).Delete("/api/admin/users/{id}/sessions", h.HandleRevokeUserSessions)
+	r.With(adminIPWhitelist, adminMiddleware).Delete("/api/admin/users/{id}/tokens", h.HandleRevokeUserAPITokens)
+	r.With(adminIPWhitelist, adminMiddleware).Delete("/api/admin/users/{id}/lockout", h.HandleUnlockUser)
+	r.With(adminIPWhitelist, adminMiddleware).Delete("/api/admin/users/{id}/mfa", h.HandleResetUserMFA)
+	r.With(adminIPWhitelist, adminMiddleware).Get("/api/admin/mfa/roles", h.HandleListMFARolePolicies)
+	r.With(adminIPWhitelist, adminMiddleware).Put("/api/admin/mfa/roles/{role}", h.HandleSetMFARolePolicy)
+
+	// Custom roles (admin only) and the audit trail (admins and auditors)
+	r.With(adminIPWhitelist, adminMiddleware).Get("/api/admin/roles", h.HandleListRoles)
+	r.With(adminIPWhitelist, adminMiddleware).Post("/api/admin/roles", h.HandleCreateRole)
+	r.With(adminIPWhitelist, adminMiddleware).Put("/api/admin/roles/{name}", h.HandleUpdateRole)
+	r.With(adminIPWhitelist, adminMiddleware).Delete("/api/admin/roles/{name}", h.HandleDeleteRole)
+	r.With(adminIPWhitelist, limenMiddleware.RequirePermission(models.PermAuditRead)).Get("/api/admin/audit-logs", h.HandleListAuditLogs)
+
+	// Image catalog downloads (admin only)
+	r.With(adminIPWhitelist, adminMiddleware).Get("/api/admin/images/catalog", h.HandleListImageCatalog)
+	r.With(adminIPWhitelist, adminMiddleware).Post("/api/admin/images/catalog/{id}/fetch", h.HandleFetchCatalogImage)
+	r.With(adminIPWhitelist, adminMiddleware).Get("/api/admin/images/fetches", h.HandleListImageFetches)
+	r.With(adminIPWhitelist, adminMiddleware).Get("/api/admin/images/fetches/{id}", h.HandleGetImageFetch)
+	r.With(adminIPWhitelist, adminMiddleware).Delete("/api/admin/images/fetches/{id}", h.HandleCancelImageFetch)
+
+	// Console sessions and their limits (admin only)
+	r.With(adminIPWhitelist, adminMiddleware).Get("/api/admin/console-sessions", h.HandleListConsoleSessions)
+	r.With(adminIPWhitelist, adminMiddleware).Get("/api/admin/console-sessions/{session_id}", h.HandleGetConsoleSession)
+	r.With(adminIPWhitelist, adminMiddleware).Delete("/api/admin/console-sessions/{session_id}", h.HandleTerminateConsoleSession)
+	r.With(adminIPWhitelist, adminMiddleware).Get("/api/admin/console-session-limits", h.HandleListConsoleSessionLimits)
+	r.With(adminIPWhitelist, adminMiddleware).Put("/api/admin/console-session-limits", h.HandleSetConsoleSessionLimit)
+	r.With(adminIPWhitelist, adminMiddleware).Delete("/api/admin/console-session-limits/{id}", h.HandleDeleteConsoleSessionLimit)
+	r.With(adminIPWhitelist, adminMiddleware).Get("/api/admin/hosts", h.HandleListHosts)
+	r.With(adminIPWhitelist, adminMiddleware).Post("/api/admin/hosts", h.HandleCreateHost)
+	r.With(adminIPWhitelist, adminMiddleware).Patch("/api/admin/hosts/{id}", h.HandleUpdateHost)
+	r.With(adminIPWhitelist, adminMiddleware).Delete("/api/admin/hosts/{id}", h.HandleDeleteHost)
+
+	// Console session recordings (admin only)
+	r.With(adminIPWhitelist, adminMiddleware).Get("/api/admin/console-recordings", h.HandleListConsoleRecordings)
+	r.With(adminIPWhitelist, adminMiddleware).Get("/api/admin/console-recordings/{id}/playback", h.HandlePlayConsoleRecording)
+	r.With(adminIPWhitelist, adminMiddleware).Get("/api/admin/console-recordings/{id}/download", h.HandleDownloadConsoleRecording)
+
 	// Protected endpoints (authentication required)
 	// Use UUID pattern: 8-4-4-4-12 hexadecimal characters
 	api.Get("/vms", func(w http.ResponseWriter, r *http.Request) {
@@ -151,16 +246,37 @@ func SetupRoutes(h *handlers.Handler, cfg *config.Config) *chi.Mux {
 	api.Get("/vms/{uuid}/boot-order", h.HandleGetVMBootOrder)
 	api.Post("/vms/{uuid}/boot-order", h.HandleVMBootOrder)
 	api.Post("/vms/{uuid}/finalize-install", h.HandleFinalizeInstall)
+	api.Post("/vms/{uuid}/nvram/reset", h.HandleResetVMNVRAM)
+	api.With(adminIPWhitelist, adminMiddleware).Post("/vms/{uuid}/migrate", h.HandleMigrateVM)
 	api.Get("/vms/isos", func(w http.ResponseWriter, r *http.Request) {
 		h.HandleListISOs(w, r, cfg)
 	})
 
+	// Console session sharing
+	api.Get("/console/sessions", h.HandleListMyConsoleSessions)
+	api.Post("/console/sessions/{session_id}/shares", h.HandleCreateConsoleShare)
+	api.Get("/console/sessions/{session_id}/shares", h.HandleListConsoleShares)
+	api.Delete("/console/sessions/{session_id}/shares/{share_id}", h.HandleRevokeConsoleShare)
+	api.Get("/console/sessions/{session_id}/participants", h.HandleListConsoleParticipants)
+	api.Delete("/console/sessions/{session_id}/participants/{participant_id}", h.HandleRemoveConsoleParticipant)
+	api.Post("/console/join", h.HandleJoinConsole)
+
 	// Snapshot endpoints
 	api.Get("/vms/{uuid}/snapshots", h.HandleListSnapshots)
 	api.Post("/vms/{uuid}/snapshots", h.HandleCreateSnapshot)
 	api.Post("/snapshots/{snapshot_id}/restore", h.HandleRestoreSnapshot)
 	api.Delete("/snapshots/{snapshot_id}", h.HandleDeleteSnapshot)
 
+	// Image library endpoints (chunked, resumable uploads)
+	api.Get("/os-profiles", h.HandleListOSProfiles)
+	api.Get("/images", h.HandleListImages)
+	api.Delete("/images/{id}", h.HandleDeleteImage)
+	api.Post("/images/uploads", h.HandleCreateImageUpload)
+	api.Get("/images/uploads/{id}", h.HandleGetImageUpload)
+	api.Put("/images/uploads/{id}", h.HandleImageUploadChunk)
+	api.Delete("/images/uploads/{id}", h.HandleAbortImageUpload)
+	api.Post("/images/uploads/{id}/complete", h.HandleCompleteImageUpload)
+
 	// Quota endpoints (system-wide, shared by all users)
 	// Uses session-based authentication (refresh_token cookie)
 	api.Get("/quota", h.HandleGetQuotaHTTP)
@@ -173,6 +289,8 @@ func SetupRoutes(h *handlers.Handler, cfg *config.Config) *chi.Mux {
 	r.Get("/vnc/{uuid}", h.HandleVNC) // VNC WebSocket with UUID in path (most specific - register first)
 	r.Get("/ws/vnc", h.HandleVNC)
 	r.Get("/vnc", h.HandleVNC) // Alternative path for VNC WebSocket (for Envoy compatibility)
+	r.Get("/ws/serial/{uuid}", h.HandleSerialConsole)
+	r.Get("/ws/spice/{uuid}", h.HandleSPICE)
 	r.Get("/ws/vm-status", func(w http.ResponseWriter, r *http.Request) {
 		h.HandleVMStatusWebSocket(w, r, cfg)
 	})
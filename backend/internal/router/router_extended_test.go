@@ -1,6 +1,7 @@
 package router
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -8,6 +9,7 @@ import (
 	"github.com/DARC0625/LIMEN/backend/internal/config"
 	"github.com/DARC0625/LIMEN/backend/internal/handlers"
 	"github.com/DARC0625/LIMEN/backend/internal/logger"
+	"github.com/DARC0625/LIMEN/backend/internal/middleware"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
@@ -113,10 +115,19 @@ func TestLogsStatsEndpoint(t *testing.T) {
 	h, cfg := setupTestRouterExtended(t)
 	r := SetupRoutes(h, cfg)
 
+	// Logs need the logs.read permission (admins and auditors)
 	req := httptest.NewRequest("GET", "/api/logs/stats", nil)
 	w := httptest.NewRecorder()
 
-	r.ServeHTTP(w, req)
+	r.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), middleware.RoleKey, "user")))
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for a user, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+
+	r.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), middleware.RoleKey, "auditor")))
 
 	// Should return 200 or 500
 	if w.Code != http.StatusOK && w.Code != http.StatusInternalServerError {
@@ -129,6 +140,7 @@ func TestLogsSearchEndpoint(t *testing.T) {
 	r := SetupRoutes(h, cfg)
 
 	req := httptest.NewRequest("GET", "/api/logs/search?query=test", nil)
+	req = req.WithContext(context.WithValue(req.Context(), middleware.RoleKey, "auditor"))
 	w := httptest.NewRecorder()
 
 	r.ServeHTTP(w, req)
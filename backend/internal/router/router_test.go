@@ -106,6 +106,21 @@ func TestWebSocketVNCEndpoint(t *testing.T) {
 	}
 }
 
+func TestSerialConsoleEndpoint(t *testing.T) {
+	r, _, _ := setupTestRouter(t)
+
+	// Test /ws/serial/{uuid} endpoint exists
+	req := httptest.NewRequest("GET", "/ws/serial/7b20e9e6-b652-43ee-b9cc-681216bef7a4", nil)
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	// Should return 401 (endpoint exists, console ticket missing)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 from /ws/serial/{uuid} without ticket, got %d", w.Code)
+	}
+}
+
 func TestStaticFileEndpoint(t *testing.T) {
 	r, _, _ := setupTestRouter(t)
 
@@ -70,7 +70,7 @@ type NetworkSecurity struct {
 type UserSecurity struct {
 	Status             ChainStatus `json:"status"`
 	StrongPasswords    bool        `json:"strong_passwords"`
-	MFA                bool        `json:"mfa"` // Multi-Factor Authentication (future)
+	MFA                bool        `json:"mfa"` // Multi-Factor Authentication required for admins
 	SessionManagement  bool        `json:"session_management"`
 	AccessControl      bool        `json:"access_control"`
 	AuditLogging       bool        `json:"audit_logging"`
@@ -283,17 +283,17 @@ func validateUserSecurity(ctx context.Context) UserSecurity {
 	}
 
 	// Check user security features
-	us.StrongPasswords = true     // Argon2id + password policy implemented
-	us.MFA = false                // Future: Multi-Factor Authentication
-	us.SessionManagement = true   // JWT tokens implemented
-	us.AccessControl = true       // RBAC implemented
-	us.AuditLogging = true        // Logging implemented
-	us.UserEducation = false      // Policy-based, needs documentation
-	us.BehaviorMonitoring = false // Future: anomaly detection
+	us.StrongPasswords = true       // Argon2id + password policy implemented
+	us.MFA = mfaRequiredForAdmins() // TOTP, required per role by admins
+	us.SessionManagement = true     // JWT tokens implemented
+	us.AccessControl = true         // RBAC implemented
+	us.AuditLogging = true          // Logging implemented
+	us.UserEducation = false        // Policy-based, needs documentation
+	us.BehaviorMonitoring = false   // Future: anomaly detection
 
 	// Determine status
 	if !us.MFA {
-		us.Issues = append(us.Issues, "Multi-Factor Authentication not implemented")
+		us.Issues = append(us.Issues, "Multi-Factor Authentication not required for admins")
 	}
 	if !us.UserEducation {
 		us.Issues = append(us.Issues, "User security education materials needed")
@@ -0,0 +1,273 @@
+package security
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DARC0625/LIMEN/backend/internal/logger"
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Alerter raises operational alerts. *alerting.Manager implements it.
+type Alerter interface {
+	SendAlert(ctx context.Context, title, message, severity, service, component string, metadata map[string]interface{}, tags []string) error
+}
+
+// LoginBlock is why a login attempt is refused before its password is checked.
+type LoginBlock string
+
+const (
+	LoginAllowed       LoginBlock = ""
+	LoginThrottled     LoginBlock = "throttled"      // Too soon after the account's last failure
+	LoginAccountLocked LoginBlock = "account_locked" // Too many failures for the account
+	LoginIPLocked      LoginBlock = "ip_locked"      // Too many failures from the client's IP
+)
+
+// LoginDecision is the outcome of LoginGuard.Check.
+type LoginDecision struct {
+	Block LoginBlock
+	Until time.Time // When the block ends
+}
+
+// Allowed reports whether the password may be checked.
+func (d LoginDecision) Allowed() bool {
+	return d.Block == LoginAllowed
+}
+
+// RetryAfter returns how long to wait before the next attempt.
+func (d LoginDecision) RetryAfter() time.Duration {
+	if d.Allowed() {
+		return 0
+	}
+	return time.Until(d.Until)
+}
+
+// LoginGuard protects logins against brute force, from the failed attempts recorded in
+// the database (models.LoginFailure):
+//   - after the second failure of an account, the next attempt must wait a delay
+//     doubling with each failure, up to policy.MaxLoginDelay;
+//   - policy.MaxFailedAttempts failures within policy.FailureWindow lock the account
+//     for policy.LockoutDuration, and policy.MaxFailedAttemptsPerIP lock the IP;
+//   - one IP failing on many accounts, or many failures server-wide, raise an alert.
+//
+// Accounts are identified by user ID, or by username when it doesn't exist, so unknown
+// usernames are locked like real ones. Refused attempts are not recorded: locks expire
+// even while an attacker keeps trying.
+type LoginGuard struct {
+	db      *gorm.DB
+	policy  UserSecurityPolicy
+	alerter Alerter // nil = no alerts
+	now     func() time.Time
+
+	mu       sync.Mutex
+	inflight map[string]bool // Accounts with an attempt between Begin and its done
+}
+
+// NewLoginGuard creates a login guard enforcing policy, sending alerts to alerter (which
+// may be nil).
+func NewLoginGuard(db *gorm.DB, policy UserSecurityPolicy, alerter Alerter) *LoginGuard {
+	return &LoginGuard{db: db, policy: policy, alerter: alerter, now: time.Now, inflight: make(map[string]bool)}
+}
+
+// account scopes a query to the failures of an account.
+func account(db *gorm.DB, userID uint, username string) *gorm.DB {
+	if userID != 0 {
+		return db.Where("user_id = ?", userID)
+	}
+	return db.Where("user_id = 0 AND username = ?", strings.ToLower(username))
+}
+
+// lock counts the failures of scope within the failure window before the last one, and
+// returns until when they lock it out if there are at least max, or else until when the
+// progressive delay lasts.
+func (g *LoginGuard) lock(scope *gorm.DB, max int) (time.Time, int, error) {
+	var last models.LoginFailure
+	err := scope.Session(&gorm.Session{}).Order("created_at DESC").Limit(1).Find(&last).Error
+	if err != nil || last.ID == 0 {
+		return time.Time{}, 0, err
+	}
+	var count int64
+	if err := scope.Session(&gorm.Session{}).Where("created_at > ?", last.CreatedAt.Add(-g.policy.FailureWindow)).Count(&count).Error; err != nil {
+		return time.Time{}, 0, err
+	}
+	if int(count) >= max {
+		return last.CreatedAt.Add(g.policy.LockoutDuration), int(count), nil
+	}
+	// Not locked: the progressive delay follows the last failure
+	return last.CreatedAt.Add(g.delay(int(count))), int(count), nil
+}
+
+// delay returns the wait after failures consecutive failures.
+func (g *LoginGuard) delay(failures int) time.Duration {
+	if failures < 2 || g.policy.LoginDelay <= 0 {
+		return 0
+	}
+	d := g.policy.LoginDelay
+	for i := 2; i < failures && d < g.policy.MaxLoginDelay; i++ {
+		d *= 2
+	}
+	if g.policy.MaxLoginDelay > 0 && d > g.policy.MaxLoginDelay {
+		d = g.policy.MaxLoginDelay
+	}
+	return d
+}
+
+// inflightRetry is how long an attempt refused because another one on the account is
+// being checked should wait.
+const inflightRetry = time.Second
+
+// Begin is Check for an attempt that goes on to verify a secret. Until done is called,
+// other attempts on the account are throttled: otherwise parallel guesses would all pass
+// Check before any of their failures is recorded, and skip the delay. Call done once
+// the attempt's failure, if any, is recorded; it does nothing if the attempt is refused.
+func (g *LoginGuard) Begin(userID uint, username, ip string) (LoginDecision, func()) {
+	if userID == 0 && username == "" {
+		return g.Check(userID, username, ip), func() {}
+	}
+	key := fmt.Sprintf("id:%d", userID)
+	if userID == 0 {
+		key = "name:" + strings.ToLower(username)
+	}
+
+	g.mu.Lock()
+	if g.inflight[key] {
+		g.mu.Unlock()
+		return LoginDecision{Block: LoginThrottled, Until: g.now().Add(inflightRetry)}, func() {}
+	}
+	g.inflight[key] = true
+	g.mu.Unlock()
+
+	var once sync.Once
+	done := func() {
+		once.Do(func() {
+			g.mu.Lock()
+			delete(g.inflight, key)
+			g.mu.Unlock()
+		})
+	}
+	decision := g.Check(userID, username, ip)
+	if !decision.Allowed() {
+		done()
+		return decision, func() {}
+	}
+	return decision, done
+}
+
+// Check decides whether a login attempt for an account (userID 0 = unknown username)
+// from ip may check its password. Database errors are logged and let the attempt
+// through: logins depend on the database anyway.
+func (g *LoginGuard) Check(userID uint, username, ip string) LoginDecision {
+	now := g.now()
+	failures := g.db.Model(&models.LoginFailure{}).Session(&gorm.Session{})
+
+	if ip != "" && g.policy.MaxFailedAttemptsPerIP > 0 {
+		until, count, err := g.lock(failures.Where("client_ip = ?", ip), g.policy.MaxFailedAttemptsPerIP)
+		if err != nil {
+			logger.Log.Error("Failed to check IP lockout", zap.String("ip", ip), zap.Error(err))
+		} else if count >= g.policy.MaxFailedAttemptsPerIP && now.Before(until) {
+			return LoginDecision{Block: LoginIPLocked, Until: until}
+		}
+	}
+
+	if userID == 0 && username == "" {
+		return LoginDecision{}
+	}
+	until, count, err := g.lock(account(failures, userID, username), g.policy.MaxFailedAttempts)
+	switch {
+	case err != nil:
+		logger.Log.Error("Failed to check account lockout", zap.Uint("user_id", userID), zap.Error(err))
+	case count >= g.policy.MaxFailedAttempts && now.Before(until):
+		return LoginDecision{Block: LoginAccountLocked, Until: until}
+	case now.Before(until):
+		return LoginDecision{Block: LoginThrottled, Until: until}
+	}
+	return LoginDecision{}
+}
+
+// RecordFailure records a failed login for an account (userID 0 = unknown username)
+// from ip, raising alerts on credential-stuffing patterns.
+func (g *LoginGuard) RecordFailure(ctx context.Context, userID uint, username, ip string) {
+	now := g.now()
+	failure := models.LoginFailure{UserID: userID, Username: strings.ToLower(username), ClientIP: ip, CreatedAt: now}
+	if err := g.db.Create(&failure).Error; err != nil {
+		logger.Log.Error("Failed to record login failure", zap.Uint("user_id", userID), zap.Error(err))
+		return
+	}
+
+	// Failures past both the window and the lockout don't matter any more
+	retention := g.policy.FailureWindow + g.policy.LockoutDuration
+	g.db.Where("created_at < ?", now.Add(-retention)).Delete(&models.LoginFailure{})
+
+	since := now.Add(-g.policy.FailureWindow)
+	if username != "" || userID != 0 {
+		var count int64
+		account(g.db.Model(&models.LoginFailure{}), userID, username).Where("created_at > ?", since).Count(&count)
+		if int(count) == g.policy.MaxFailedAttempts {
+			logger.Log.Warn("Account locked after failed logins",
+				zap.Uint("user_id", userID),
+				zap.String("ip", ip),
+				zap.Int("failures", int(count)),
+				zap.Duration("lockout", g.policy.LockoutDuration))
+		}
+	}
+
+	if ip != "" && g.policy.StuffingAccounts > 0 {
+		var accounts int64
+		targeted := g.db.Model(&models.LoginFailure{}).
+			Where("client_ip = ? AND created_at > ?", ip, since).
+			Distinct("user_id", "username")
+		g.db.Table("(?) AS accounts", targeted).Count(&accounts)
+		if int(accounts) == g.policy.StuffingAccounts {
+			g.alert(ctx, "Credential Stuffing Suspected: "+ip,
+				fmt.Sprintf("Logins to %d different accounts failed from %s within %s.", accounts, ip, g.policy.FailureWindow),
+				map[string]interface{}{"ip": ip, "accounts": accounts})
+		}
+	}
+	if g.policy.StuffingFailures > 0 {
+		var total int64
+		g.db.Model(&models.LoginFailure{}).Where("created_at > ?", since).Count(&total)
+		if int(total) == g.policy.StuffingFailures {
+			g.alert(ctx, "Login Failure Spike",
+				fmt.Sprintf("%d logins failed within %s, possibly a distributed credential-stuffing attack.", total, g.policy.FailureWindow),
+				map[string]interface{}{"failures": total})
+		}
+	}
+}
+
+// RecordSuccess clears the failures of an account after a successful login. The IP's
+// failures are kept: an attacker must not reset them by logging into their own account.
+func (g *LoginGuard) RecordSuccess(userID uint) {
+	if err := g.db.Where("user_id = ?", userID).Delete(&models.LoginFailure{}).Error; err != nil {
+		logger.Log.Error("Failed to clear login failures", zap.Uint("user_id", userID), zap.Error(err))
+	}
+}
+
+// Unlock clears the failures of an account (admin unlock) and returns how many there were.
+func (g *LoginGuard) Unlock(userID uint) (int64, error) {
+	result := g.db.Where("user_id = ?", userID).Delete(&models.LoginFailure{})
+	return result.RowsAffected, result.Error
+}
+
+// AccountLock returns until when an account is locked out, or nil.
+func (g *LoginGuard) AccountLock(userID uint) (*time.Time, error) {
+	until, count, err := g.lock(account(g.db.Model(&models.LoginFailure{}), userID, ""), g.policy.MaxFailedAttempts)
+	if err != nil || count < g.policy.MaxFailedAttempts || !g.now().Before(until) {
+		return nil, err
+	}
+	return &until, nil
+}
+
+func (g *LoginGuard) alert(ctx context.Context, title, message string, metadata map[string]interface{}) {
+	logger.Log.Warn(title, zap.Any("details", metadata))
+	if g.alerter == nil {
+		return
+	}
+	if err := g.alerter.SendAlert(ctx, title, message, "warning", "limen", "auth", metadata, []string{"security", "brute-force"}); err != nil {
+		logger.Log.Warn("send alert failed", zap.Error(err))
+	}
+}
@@ -0,0 +1,154 @@
+package security
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type recordingAlerter struct {
+	mu     sync.Mutex
+	titles []string
+}
+
+func (a *recordingAlerter) SendAlert(ctx context.Context, title, message, severity, service, component string, metadata map[string]interface{}, tags []string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.titles = append(a.titles, title)
+	return nil
+}
+
+// newTestLoginGuard returns a guard on a test database whose clock is advanced with the
+// returned function.
+func newTestLoginGuard(t *testing.T, alerter Alerter) (*LoginGuard, func(time.Duration)) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.LoginFailure{}); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+	guard := NewLoginGuard(db, DefaultUserSecurityPolicy(), alerter)
+	now := time.Now()
+	guard.now = func() time.Time { return now }
+	return guard, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestLoginGuard_ProgressiveDelayAndLockout(t *testing.T) {
+	guard, advance := newTestLoginGuard(t, nil)
+	ctx := context.Background()
+
+	// Wait after each failure
+	wantDelays := []time.Duration{0, time.Second, 2 * time.Second, 4 * time.Second}
+	for i, want := range wantDelays {
+		if d := guard.Check(7, "alice", "10.0.0.1"); !d.Allowed() {
+			t.Fatalf("attempt %d refused: %+v", i+1, d)
+		}
+		guard.RecordFailure(ctx, 7, "alice", "10.0.0.1")
+		d := guard.Check(7, "alice", "10.0.0.1")
+		if want == 0 && !d.Allowed() || want > 0 && (d.Block != LoginThrottled || d.Until.Sub(guard.now()) != want) {
+			t.Fatalf("after failure %d: %+v, want a %s wait", i+1, d, want)
+		}
+		advance(want)
+	}
+
+	guard.RecordFailure(ctx, 7, "alice", "10.0.0.1")
+	d := guard.Check(7, "alice", "10.0.0.2")
+	if d.Block != LoginAccountLocked || d.Until.Sub(guard.now()) != 15*time.Minute {
+		t.Fatalf("after 5 failures: %+v, want locked for 15m from any IP", d)
+	}
+	if until, _ := guard.AccountLock(7); until == nil {
+		t.Error("AccountLock() = nil, want locked")
+	}
+	if d := guard.Check(8, "bob", "10.0.0.1"); !d.Allowed() {
+		t.Errorf("other account refused: %+v", d)
+	}
+
+	advance(15 * time.Minute)
+	if d := guard.Check(7, "alice", "10.0.0.1"); !d.Allowed() {
+		t.Errorf("after the lockout: %+v, want allowed", d)
+	}
+
+	// A successful login clears the account's failures
+	guard.RecordFailure(ctx, 7, "alice", "10.0.0.1")
+	guard.RecordSuccess(7)
+	guard.RecordFailure(ctx, 7, "alice", "10.0.0.1")
+	if d := guard.Check(7, "alice", "10.0.0.1"); !d.Allowed() {
+		t.Errorf("one failure after a success: %+v, want allowed", d)
+	}
+}
+
+func TestLoginGuard_BeginSerializesAttempts(t *testing.T) {
+	guard, _ := newTestLoginGuard(t, nil)
+	ctx := context.Background()
+	guard.RecordFailure(ctx, 7, "alice", "10.0.0.1")
+
+	d, done := guard.Begin(7, "alice", "10.0.0.1")
+	if !d.Allowed() {
+		t.Fatalf("first attempt refused: %+v", d)
+	}
+	// A parallel guess can't pass before the first one's failure is recorded
+	if d, _ := guard.Begin(7, "alice", "10.0.0.2"); d.Block != LoginThrottled {
+		t.Errorf("parallel attempt: %+v, want throttled", d)
+	}
+	if d, other := guard.Begin(8, "bob", "10.0.0.1"); !d.Allowed() {
+		t.Errorf("other account refused: %+v", d)
+	} else {
+		other()
+	}
+
+	guard.RecordFailure(ctx, 7, "alice", "10.0.0.1")
+	done()
+	done()
+	if d, _ := guard.Begin(7, "alice", "10.0.0.1"); d.Block != LoginThrottled || d.Until.Sub(guard.now()) != time.Second {
+		t.Errorf("after the failure: %+v, want the failure's wait", d)
+	}
+}
+
+func TestLoginGuard_UnknownUsersAndUnlock(t *testing.T) {
+	guard, advance := newTestLoginGuard(t, nil)
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		guard.RecordFailure(ctx, 0, "Ghost", "10.0.0.1")
+		advance(time.Minute)
+	}
+	if d := guard.Check(0, "ghost", "10.0.0.9"); d.Block != LoginAccountLocked {
+		t.Errorf("unknown username after 5 failures: %+v, want locked", d)
+	}
+
+	for i := 0; i < 5; i++ {
+		guard.RecordFailure(ctx, 7, "alice", "10.0.0.2")
+	}
+	if n, err := guard.Unlock(7); err != nil || n != 5 {
+		t.Fatalf("Unlock() = %d, %v; want 5", n, err)
+	}
+	if d := guard.Check(7, "alice", "10.0.0.2"); !d.Allowed() {
+		t.Errorf("after unlock: %+v, want allowed", d)
+	}
+}
+
+func TestLoginGuard_IPLockoutAndStuffingAlert(t *testing.T) {
+	alerter := &recordingAlerter{}
+	guard, _ := newTestLoginGuard(t, alerter)
+	ctx := context.Background()
+
+	for i := 0; i < 20; i++ {
+		guard.RecordFailure(ctx, 0, fmt.Sprintf("user%d", i), "203.0.113.7")
+	}
+	if d := guard.Check(99, "fresh", "203.0.113.7"); d.Block != LoginIPLocked {
+		t.Errorf("after 20 failures from one IP: %+v, want IP locked", d)
+	}
+	if d := guard.Check(99, "fresh", "203.0.113.8"); !d.Allowed() {
+		t.Errorf("other IP refused: %+v", d)
+	}
+	if len(alerter.titles) != 1 || alerter.titles[0] != "Credential Stuffing Suspected: 203.0.113.7" {
+		t.Errorf("alerts = %v, want one credential stuffing alert", alerter.titles)
+	}
+}
@@ -16,6 +16,9 @@ type ConsoleTokenPolicy struct {
 
 	// RequireUUIDBinding requires token to be bound to specific VM UUID
 	RequireUUIDBinding bool
+
+	// RequireIPBinding requires the token to be redeemed from the client IP it was issued to
+	RequireIPBinding bool
 }
 
 // DefaultConsoleTokenPolicy returns the default console token policy.
@@ -25,6 +28,7 @@ func DefaultConsoleTokenPolicy() ConsoleTokenPolicy {
 		Issuer:             "limen",
 		Audience:           "limen-console",
 		RequireUUIDBinding: true,
+		RequireIPBinding:   true,
 	}
 }
 
@@ -37,6 +41,8 @@ const (
 	TokenErrorExpired      TokenErrorCode = "TOKEN_EXPIRED"
 	TokenErrorUUIDMismatch TokenErrorCode = "UUID_MISMATCH"
 	TokenErrorNotApproved  TokenErrorCode = "NOT_APPROVED"
+	TokenErrorIPMismatch   TokenErrorCode = "IP_MISMATCH"
+	TokenErrorReplayed     TokenErrorCode = "TOKEN_REPLAYED"
 )
 
 // TokenError represents a token validation error with a standardized code.
@@ -7,7 +7,9 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/DARC0625/LIMEN/backend/internal/database"
 	"github.com/DARC0625/LIMEN/backend/internal/logger"
+	"github.com/DARC0625/LIMEN/backend/internal/models"
 	"go.uber.org/zap"
 )
 
@@ -24,6 +26,14 @@ type UserSecurityPolicy struct {
 	RequireMFA          bool          `json:"require_mfa"` // Future
 	SessionTimeout      time.Duration `json:"session_timeout"`
 	AuditAllActions     bool          `json:"audit_all_actions"`
+
+	// Brute-force protection (see LoginGuard)
+	FailureWindow          time.Duration `json:"failure_window"`             // Failures older than this are forgotten
+	MaxFailedAttemptsPerIP int           `json:"max_failed_attempts_per_ip"` // Failures from one IP before it is locked out
+	LoginDelay             time.Duration `json:"login_delay"`                // Wait after the 2nd failure, doubling with each one
+	MaxLoginDelay          time.Duration `json:"max_login_delay"`
+	StuffingAccounts       int           `json:"stuffing_accounts"` // Accounts failing from one IP that raise an alert
+	StuffingFailures       int           `json:"stuffing_failures"` // Failures server-wide that raise an alert
 }
 
 // DefaultUserSecurityPolicy returns a secure default user security policy.
@@ -40,6 +50,13 @@ func DefaultUserSecurityPolicy() UserSecurityPolicy {
 		RequireMFA:          false,            // Future: enable when implemented
 		SessionTimeout:      24 * time.Hour,   // 24 hour session
 		AuditAllActions:     true,             // Audit all user actions
+
+		FailureWindow:          15 * time.Minute,
+		MaxFailedAttemptsPerIP: 20, // Offices behind one NAT share an IP
+		LoginDelay:             time.Second,
+		MaxLoginDelay:          30 * time.Second,
+		StuffingAccounts:       10,
+		StuffingFailures:       100,
 	}
 }
 
@@ -128,11 +145,37 @@ func AuditUserAction(ctx context.Context, userID uint, action string, resource s
 	// Future: Alert on suspicious patterns
 }
 
+// defaultLoginGuard returns a login guard with the default policy on the global
+// database, or nil before it is connected.
+func defaultLoginGuard() *LoginGuard {
+	if database.DB == nil {
+		return nil
+	}
+	return NewLoginGuard(database.DB, DefaultUserSecurityPolicy(), nil)
+}
+
+// mfaRequiredForAdmins reports whether admins must log in with MFA, the policy the
+// security chain checks: admin accounts are the ones worth phishing.
+func mfaRequiredForAdmins() bool {
+	if database.DB == nil {
+		return false
+	}
+	var policy models.MFARolePolicy
+	err := database.DB.Where("role = ?", string(models.RoleAdmin)).Limit(1).Find(&policy).Error
+	return err == nil && policy.Required
+}
+
 // CheckAccountLockout checks if an account is locked due to failed attempts.
 func CheckAccountLockout(userID uint) (bool, *time.Time) {
-	// This would query the database for lockout status
-	// For now, return false (not implemented)
-	return false, nil
+	guard := defaultLoginGuard()
+	if guard == nil {
+		return false, nil
+	}
+	until, err := guard.AccountLock(userID)
+	if err != nil {
+		logger.Log.Error("Failed to check account lockout", zap.Uint("user_id", userID), zap.Error(err))
+	}
+	return until != nil, until
 }
 
 // RecordFailedLogin records a failed login attempt.
@@ -142,7 +185,7 @@ func RecordFailedLogin(ctx context.Context, userID uint, ip string) {
 		zap.String("ip", ip),
 	)
 
-	// Future: Increment failed attempt counter
-	// Future: Lock account after max attempts
-	// Future: Alert on brute force attempts
+	if guard := defaultLoginGuard(); guard != nil {
+		guard.RecordFailure(ctx, userID, "", ip)
+	}
 }
@@ -0,0 +1,97 @@
+package session
+
+import (
+	"errors"
+	"time"
+
+	"github.com/DARC0625/LIMEN/backend/internal/database"
+	"github.com/DARC0625/LIMEN/backend/internal/logger"
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Limits bounds a user's console sessions.
+type Limits struct {
+	MaxIdle         time.Duration // Idle time before a session is ended
+	MaxDuration     time.Duration // Lifetime of a session
+	MaxConcurrent   int           // Live sessions per user
+	ReconnectWindow time.Duration // At most 3 new sessions per window
+}
+
+// defaultLimits are the server-wide limits used until SetDefaultLimits is called.
+var defaultLimits = Limits{
+	MaxIdle:         15 * time.Minute, // 15 minutes idle timeout
+	MaxDuration:     4 * time.Hour,    // 4 hours max duration
+	MaxConcurrent:   2,                // 2 concurrent sessions per user
+	ReconnectWindow: 30 * time.Second, // 30 seconds reconnect window
+}
+
+// merge overrides l with the non-zero fields of o.
+func (l Limits) merge(o models.ConsoleSessionLimit) Limits {
+	if o.MaxIdleMinutes > 0 {
+		l.MaxIdle = time.Duration(o.MaxIdleMinutes) * time.Minute
+	}
+	if o.MaxDurationMinutes > 0 {
+		l.MaxDuration = time.Duration(o.MaxDurationMinutes) * time.Minute
+	}
+	if o.MaxConcurrent > 0 {
+		l.MaxConcurrent = o.MaxConcurrent
+	}
+	if o.ReconnectWindowSeconds > 0 {
+		l.ReconnectWindow = time.Duration(o.ReconnectWindowSeconds) * time.Second
+	}
+	return l
+}
+
+// SetDefaultLimits sets the server-wide limits. Zero fields keep the current value.
+func (sm *SessionManager) SetDefaultLimits(l Limits) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if l.MaxIdle > 0 {
+		sm.defaults.MaxIdle = l.MaxIdle
+	}
+	if l.MaxDuration > 0 {
+		sm.defaults.MaxDuration = l.MaxDuration
+	}
+	if l.MaxConcurrent > 0 {
+		sm.defaults.MaxConcurrent = l.MaxConcurrent
+	}
+	if l.ReconnectWindow > 0 {
+		sm.defaults.ReconnectWindow = l.ReconnectWindow
+	}
+}
+
+// DefaultLimits returns the server-wide limits.
+func (sm *SessionManager) DefaultLimits() Limits {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return sm.defaults
+}
+
+// LimitsFor resolves the limits that apply to a user: the server default, overridden by
+// the ConsoleSessionLimit for the user's role, overridden by the one for the user.
+// Limits apply to sessions created after a change; live sessions keep theirs.
+func (sm *SessionManager) LimitsFor(userID uint) Limits {
+	limits := sm.DefaultLimits()
+	if database.DB == nil {
+		return limits
+	}
+
+	var user models.User
+	if err := database.DB.Select("id", "role").First(&user, userID).Error; err == nil {
+		var roleLimit models.ConsoleSessionLimit
+		if err := database.DB.Where("role = ? AND user_id = 0", string(user.Role)).First(&roleLimit).Error; err == nil {
+			limits = limits.merge(roleLimit)
+		}
+	}
+
+	var userLimit models.ConsoleSessionLimit
+	if err := database.DB.Where("user_id = ?", userID).First(&userLimit).Error; err == nil {
+		limits = limits.merge(userLimit)
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		logger.Log.Warn("Failed to load console session limits", zap.Uint("user_id", userID), zap.Error(err))
+	}
+	return limits
+}
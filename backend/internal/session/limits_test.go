@@ -0,0 +1,89 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DARC0625/LIMEN/backend/internal/database"
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+)
+
+func TestLimitsFor_Overrides(t *testing.T) {
+	sm, _ := setupTestManager(t)
+	sm.SetDefaultLimits(Limits{MaxIdle: 10 * time.Minute, MaxConcurrent: 1})
+
+	database.DB.Create(&models.User{Username: "alice", Password: "x", Role: models.RoleUser})
+	database.DB.Create(&models.User{Username: "root", Password: "x", Role: models.RoleAdmin})
+	database.DB.Create(&models.ConsoleSessionLimit{Role: "admin", MaxIdleMinutes: 60, MaxConcurrent: 5})
+	database.DB.Create(&models.ConsoleSessionLimit{UserID: 1, MaxConcurrent: 3})
+
+	tests := []struct {
+		name   string
+		userID uint
+		want   Limits
+	}{
+		{"user override", 1, Limits{MaxIdle: 10 * time.Minute, MaxDuration: 4 * time.Hour, MaxConcurrent: 3, ReconnectWindow: 30 * time.Second}},
+		{"role override", 2, Limits{MaxIdle: time.Hour, MaxDuration: 4 * time.Hour, MaxConcurrent: 5, ReconnectWindow: 30 * time.Second}},
+		{"defaults", 99, Limits{MaxIdle: 10 * time.Minute, MaxDuration: 4 * time.Hour, MaxConcurrent: 1, ReconnectWindow: 30 * time.Second}},
+	}
+	for _, tt := range tests {
+		if got := sm.LimitsFor(tt.userID); got != tt.want {
+			t.Errorf("%s: LimitsFor(%d) = %+v, want %+v", tt.name, tt.userID, got, tt.want)
+		}
+	}
+}
+
+func TestCreateSession_PerUserConcurrency(t *testing.T) {
+	sm, _ := setupTestManager(t) // user 1 already holds one session
+	database.DB.Create(&models.ConsoleSessionLimit{UserID: 1, MaxConcurrent: 1})
+
+	if _, err := sm.CreateSession(1, 10, "vm-uuid", "vnc", "10.0.0.1", "test"); err == nil {
+		t.Error("CreateSession() ignored the user's concurrency limit")
+	}
+	if _, err := sm.CreateSession(2, 10, "vm-uuid", "vnc", "10.0.0.2", "test"); err != nil {
+		t.Errorf("CreateSession() for another user error = %v", err)
+	}
+}
+
+func TestCleanup_UsesSessionLimits(t *testing.T) {
+	sm, sessionID := setupTestManager(t)
+	sess, _ := sm.GetSession(sessionID)
+	sess.Limits.MaxIdle = time.Minute
+	sess.LastActivityAt = time.Now().Add(-2 * time.Minute)
+
+	sm.cleanupExpiredSessions()
+	if _, ok := sm.GetSession(sessionID); ok {
+		t.Fatal("idle session survived cleanup")
+	}
+	var rec models.ConsoleSession
+	database.DB.Where("session_id = ?", sessionID).First(&rec)
+	if rec.EndReason != "idle_timeout" || rec.EndedAt == nil {
+		t.Errorf("end_reason = %q, ended_at = %v", rec.EndReason, rec.EndedAt)
+	}
+}
+
+func TestTerminateSession(t *testing.T) {
+	sm, sessionID := setupTestManager(t)
+	sess, _ := sm.GetSession(sessionID)
+	share, _ := sm.CreateShare(sessionID, 0, ShareModeView, time.Hour)
+	p, _ := sm.Join(share.ID, 2, "bob", "10.0.0.2")
+
+	if err := sm.TerminateSession(sessionID); err != nil {
+		t.Fatalf("TerminateSession() error = %v", err)
+	}
+	for name, ctx := range map[string]context.Context{"owner": sess.Context(), "participant": p.Context()} {
+		if !errors.Is(context.Cause(ctx), ErrSessionTerminated) {
+			t.Errorf("%s context cause = %v, want ErrSessionTerminated", name, context.Cause(ctx))
+		}
+	}
+	var rec models.ConsoleSession
+	database.DB.Where("session_id = ?", sessionID).First(&rec)
+	if rec.EndReason != "admin_terminated" {
+		t.Errorf("end_reason = %q, want admin_terminated", rec.EndReason)
+	}
+	if err := sm.TerminateSession(sessionID); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("second TerminateSession() error = %v, want ErrSessionNotFound", err)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -21,10 +22,9 @@ type SessionManager struct {
 	mu              sync.RWMutex
 	activeSessions  map[string]*ActiveSession // sessionID -> ActiveSession
 	userSessions    map[uint][]string         // userID -> []sessionID
-	maxIdleDuration time.Duration             // Default: 15 minutes
-	maxDuration     time.Duration             // Default: 4 hours
-	maxConcurrent   int                       // Default: 2 per user
-	reconnectWindow time.Duration             // Default: 30 seconds
+	defaults        Limits                    // Server-wide limits; roles and users may override them
+	shares          map[string]*Share         // shareID -> Share
+	maxParticipants int                       // Default: 8 per session
 }
 
 // ActiveSession represents an active console session.
@@ -33,12 +33,15 @@ type ActiveSession struct {
 	UserID         uint
 	VMID           uint
 	VMUUID         string
+	Protocol       string // vnc, serial
 	StartedAt      time.Time
 	LastActivityAt time.Time
 	ClientIP       string
 	UserAgent      string
+	Limits         Limits // Limits resolved for the user when the session started
 	ctx            context.Context
-	cancel         context.CancelFunc
+	cancel         context.CancelCauseFunc
+	participants   map[string]*Participant // Users who joined through a share
 }
 
 // Context returns the session's context.
@@ -46,6 +49,9 @@ func (s *ActiveSession) Context() context.Context {
 	return s.ctx
 }
 
+// ErrSessionTerminated is the context cause for sessions ended by an administrator.
+var ErrSessionTerminated = errors.New("console session terminated by an administrator")
+
 var (
 	managerInstance *SessionManager
 	managerOnce     sync.Once
@@ -54,21 +60,27 @@ var (
 // GetSessionManager returns the singleton session manager instance.
 func GetSessionManager() *SessionManager {
 	managerOnce.Do(func() {
-		managerInstance = &SessionManager{
-			activeSessions:  make(map[string]*ActiveSession),
-			userSessions:    make(map[uint][]string),
-			maxIdleDuration: 15 * time.Minute, // 15 minutes idle timeout
-			maxDuration:     4 * time.Hour,    // 4 hours max duration
-			maxConcurrent:   2,                // 2 concurrent sessions per user
-			reconnectWindow: 30 * time.Second, // 30 seconds reconnect window
-		}
+		managerInstance = newSessionManager()
 		go managerInstance.cleanupLoop()
 	})
 	return managerInstance
 }
 
+func newSessionManager() *SessionManager {
+	return &SessionManager{
+		activeSessions:  make(map[string]*ActiveSession),
+		userSessions:    make(map[uint][]string),
+		defaults:        defaultLimits,
+		shares:          make(map[string]*Share),
+		maxParticipants: 8, // 8 participants per shared session
+	}
+}
+
 // CreateSession creates a new console session with limits enforcement.
-func (sm *SessionManager) CreateSession(userID, vmID uint, vmUUID, clientIP, userAgent string) (string, error) {
+// protocol is the console protocol (vnc or serial).
+func (sm *SessionManager) CreateSession(userID, vmID uint, vmUUID, protocol, clientIP, userAgent string) (string, error) {
+	limits := sm.LimitsFor(userID)
+
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
@@ -78,15 +90,15 @@ func (sm *SessionManager) CreateSession(userID, vmID uint, vmUUID, clientIP, use
 	for _, sid := range userSessions {
 		if sess, ok := sm.activeSessions[sid]; ok {
 			// Check if session is still active (not expired)
-			if time.Since(sess.LastActivityAt) < sm.maxIdleDuration &&
-				time.Since(sess.StartedAt) < sm.maxDuration {
+			if time.Since(sess.LastActivityAt) < sess.Limits.MaxIdle &&
+				time.Since(sess.StartedAt) < sess.Limits.MaxDuration {
 				activeCount++
 			}
 		}
 	}
 
-	if activeCount >= sm.maxConcurrent {
-		return "", fmt.Errorf("maximum concurrent sessions (%d) reached", sm.maxConcurrent)
+	if activeCount >= limits.MaxConcurrent {
+		return "", fmt.Errorf("maximum concurrent sessions (%d) reached", limits.MaxConcurrent)
 	}
 
 	// Generate session ID
@@ -96,7 +108,7 @@ func (sm *SessionManager) CreateSession(userID, vmID uint, vmUUID, clientIP, use
 	}
 
 	// Create context with cancellation
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancelCause(context.Background())
 
 	// Create active session
 	sess := &ActiveSession{
@@ -104,12 +116,15 @@ func (sm *SessionManager) CreateSession(userID, vmID uint, vmUUID, clientIP, use
 		UserID:         userID,
 		VMID:           vmID,
 		VMUUID:         vmUUID,
+		Protocol:       protocol,
 		StartedAt:      time.Now(),
 		LastActivityAt: time.Now(),
 		ClientIP:       clientIP,
 		UserAgent:      userAgent,
+		Limits:         limits,
 		ctx:            ctx,
 		cancel:         cancel,
+		participants:   make(map[string]*Participant),
 	}
 
 	sm.activeSessions[sessionID] = sess
@@ -124,6 +139,7 @@ func (sm *SessionManager) CreateSession(userID, vmID uint, vmUUID, clientIP, use
 		UserID:         userID,
 		VMID:           vmID,
 		VMUUID:         vmUUID,
+		Protocol:       protocol,
 		StartedAt:      sess.StartedAt,
 		LastActivityAt: sess.LastActivityAt,
 		ClientIP:       clientIP,
@@ -172,11 +188,34 @@ func (sm *SessionManager) EndSession(sessionID, reason string) error {
 
 	sess, ok := sm.activeSessions[sessionID]
 	if !ok {
-		return fmt.Errorf("session not found")
+		return ErrSessionNotFound
+	}
+	sm.endSessionLocked(sess, reason, nil)
+	return nil
+}
+
+// TerminateSession force-ends a live session on behalf of an administrator. The session's
+// context is cancelled with ErrSessionTerminated so connections can tell the user why.
+func (sm *SessionManager) TerminateSession(sessionID string) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	sess, ok := sm.activeSessions[sessionID]
+	if !ok {
+		return ErrSessionNotFound
 	}
+	sm.endSessionLocked(sess, "admin_terminated", ErrSessionTerminated)
+	return nil
+}
 
-	// Cancel context
-	sess.cancel()
+// endSessionLocked cancels a session, removes it and records its end. cause (may be nil)
+// becomes the cause of the session's context. The caller must hold sm.mu.
+func (sm *SessionManager) endSessionLocked(sess *ActiveSession, reason string, cause error) {
+	sessionID := sess.SessionID
+
+	// Cancel context (this also disconnects participants)
+	sess.cancel(cause)
+	sm.dropSharesLocked(sessionID)
 
 	// Remove from active sessions
 	delete(sm.activeSessions, sessionID)
@@ -208,8 +247,6 @@ func (sm *SessionManager) EndSession(sessionID, reason string) error {
 		zap.String("session_id", sessionID),
 		zap.Uint("user_id", sess.UserID),
 		zap.String("reason", reason))
-
-	return nil
 }
 
 // GetSession returns an active session by ID.
@@ -221,6 +258,18 @@ func (sm *SessionManager) GetSession(sessionID string) (*ActiveSession, bool) {
 	return sess, ok
 }
 
+// ListSessions returns all active sessions.
+func (sm *SessionManager) ListSessions() []*ActiveSession {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	sessions := make([]*ActiveSession, 0, len(sm.activeSessions))
+	for _, sess := range sm.activeSessions {
+		sessions = append(sessions, sess)
+	}
+	return sessions
+}
+
 // GetUserSessions returns all active sessions for a user.
 func (sm *SessionManager) GetUserSessions(userID uint) []*ActiveSession {
 	sm.mu.RLock()
@@ -251,12 +300,12 @@ func (sm *SessionManager) cleanupExpiredSessions() {
 	defer sm.mu.Unlock()
 
 	now := time.Now()
-	var expired []string
+	expired := make(map[string]string) // sessionID -> end reason
 
 	for sid, sess := range sm.activeSessions {
 		// Check idle timeout
-		if now.Sub(sess.LastActivityAt) > sm.maxIdleDuration {
-			expired = append(expired, sid)
+		if now.Sub(sess.LastActivityAt) > sess.Limits.MaxIdle {
+			expired[sid] = "idle_timeout"
 			logger.Log.Info("Session expired due to idle timeout",
 				zap.String("session_id", sid),
 				zap.Duration("idle_duration", now.Sub(sess.LastActivityAt)))
@@ -264,57 +313,34 @@ func (sm *SessionManager) cleanupExpiredSessions() {
 		}
 
 		// Check max duration
-		if now.Sub(sess.StartedAt) > sm.maxDuration {
-			expired = append(expired, sid)
+		if now.Sub(sess.StartedAt) > sess.Limits.MaxDuration {
+			expired[sid] = "max_duration"
 			logger.Log.Info("Session expired due to max duration",
 				zap.String("session_id", sid),
 				zap.Duration("duration", now.Sub(sess.StartedAt)))
 		}
 	}
 
-	// End expired sessions
-	for _, sid := range expired {
-		sess := sm.activeSessions[sid]
-		sess.cancel()
-		delete(sm.activeSessions, sid)
-
-		// Update active sessions metric
-		metrics.ConsoleActiveSessions.Set(float64(len(sm.activeSessions)))
-
-		// Remove from user sessions
-		userSessions := sm.userSessions[sess.UserID]
-		for i, s := range userSessions {
-			if s == sid {
-				sm.userSessions[sess.UserID] = append(userSessions[:i], userSessions[i+1:]...)
-				break
-			}
+	// Drop expired shares; participants who already joined stay until the session ends
+	for id, share := range sm.shares {
+		if !now.Before(share.ExpiresAt) {
+			delete(sm.shares, id)
 		}
+	}
 
-		// Update database
-		reason := "idle_timeout"
-		if time.Since(sess.StartedAt) > sm.maxDuration {
-			reason = "max_duration"
-		}
-		now := time.Now()
-		if err := database.DB.Model(&models.ConsoleSession{}).
-			Where("session_id = ?", sid).
-			Updates(map[string]interface{}{
-				"ended_at":   now,
-				"end_reason": reason,
-			}).Error; err != nil {
-			logger.Log.Warn("Failed to update expired session in database", zap.Error(err))
-		}
+	// End expired sessions
+	for sid, reason := range expired {
+		sm.endSessionLocked(sm.activeSessions[sid], reason, nil)
 	}
 }
 
 // CheckReconnectLimit checks if user is reconnecting too frequently.
 func (sm *SessionManager) CheckReconnectLimit(userID uint) error {
-	sm.mu.RLock()
-	defer sm.mu.RUnlock()
+	reconnectWindow := sm.LimitsFor(userID).ReconnectWindow
 
 	// Get recent sessions for this user (within reconnect window)
 	recentCount := 0
-	windowStart := time.Now().Add(-sm.reconnectWindow)
+	windowStart := time.Now().Add(-reconnectWindow)
 
 	var recentSessions []models.ConsoleSession
 	if err := database.DB.Where("user_id = ? AND started_at > ?", userID, windowStart).
@@ -325,7 +351,7 @@ func (sm *SessionManager) CheckReconnectLimit(userID uint) error {
 
 	// Allow up to 3 reconnects within the window
 	if recentCount >= 3 {
-		return fmt.Errorf("too many reconnection attempts. Please wait %v", sm.reconnectWindow)
+		return fmt.Errorf("too many reconnection attempts. Please wait %v", reconnectWindow)
 	}
 
 	return nil
@@ -0,0 +1,310 @@
+package session
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/DARC0625/LIMEN/backend/internal/logger"
+	"go.uber.org/zap"
+)
+
+// ShareMode controls what a participant may do in a shared console session.
+type ShareMode string
+
+const (
+	ShareModeView        ShareMode = "view"        // Sees the console; input is dropped by the proxy
+	ShareModeInteractive ShareMode = "interactive" // Same access as the owner
+)
+
+// MaxShareTTL is the longest a share may stay valid.
+const MaxShareTTL = 24 * time.Hour
+
+var (
+	ErrSessionNotFound     = errors.New("session not found")
+	ErrShareNotFound       = errors.New("share not found or expired")
+	ErrShareNotForUser     = errors.New("share was issued to a different user")
+	ErrParticipantNotFound = errors.New("participant not found")
+	ErrTooManyParticipants = errors.New("session has reached its participant limit")
+
+	// ErrAccessRevoked is the context cause for participants whose share was revoked or who were removed.
+	ErrAccessRevoked = errors.New("console access revoked by the session owner")
+)
+
+// Share invites another user (InviteeID) or anyone holding the link (InviteeID 0)
+// into a console session until ExpiresAt. Shares end with their session.
+type Share struct {
+	ID        string    `json:"id"`
+	SessionID string    `json:"session_id"`
+	VMUUID    string    `json:"vm_uuid"`
+	InviteeID uint      `json:"user_id,omitempty"` // 0 = share link, usable by any signed-in user
+	Mode      ShareMode `json:"mode"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	token     string
+}
+
+// Token returns the secret that joins the session through this share.
+func (s *Share) Token() string {
+	return s.token
+}
+
+// Participant is a user connected to someone else's console session through a share.
+type Participant struct {
+	ID        string    `json:"id"`
+	SessionID string    `json:"session_id"`
+	ShareID   string    `json:"share_id"`
+	UserID    uint      `json:"user_id"`
+	Username  string    `json:"username"`
+	Mode      ShareMode `json:"mode"`
+	ClientIP  string    `json:"client_ip"`
+	JoinedAt  time.Time `json:"joined_at"`
+	ctx       context.Context
+	cancel    context.CancelCauseFunc
+}
+
+// Context returns the participant's context. It is cancelled when the participant leaves,
+// is removed or has their share revoked (cause ErrAccessRevoked), or when the session ends.
+func (p *Participant) Context() context.Context {
+	return p.ctx
+}
+
+// CreateShare invites inviteeID (0 for a share link) into a session for ttl.
+func (sm *SessionManager) CreateShare(sessionID string, inviteeID uint, mode ShareMode, ttl time.Duration) (*Share, error) {
+	if mode != ShareModeView && mode != ShareModeInteractive {
+		return nil, fmt.Errorf("invalid share mode %q", mode)
+	}
+	if ttl <= 0 || ttl > MaxShareTTL {
+		return nil, fmt.Errorf("share lifetime must be between 1 minute and %v", MaxShareTTL)
+	}
+
+	id, err := generateSessionID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate share ID: %w", err)
+	}
+	token, err := generateSessionID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate share token: %w", err)
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	sess, ok := sm.activeSessions[sessionID]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+
+	now := time.Now()
+	share := &Share{
+		ID:        id[:22],
+		SessionID: sessionID,
+		VMUUID:    sess.VMUUID,
+		InviteeID: inviteeID,
+		Mode:      mode,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+		token:     token,
+	}
+	sm.shares[share.ID] = share
+
+	logger.Log.Info("Console session shared",
+		zap.String("session_id", sessionID),
+		zap.String("share_id", share.ID),
+		zap.Uint("invitee_id", inviteeID),
+		zap.String("mode", string(mode)),
+		zap.Time("expires_at", share.ExpiresAt))
+	return share, nil
+}
+
+// ListShares returns the unexpired shares of a session, oldest first.
+func (sm *SessionManager) ListShares(sessionID string) []*Share {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	now := time.Now()
+	var shares []*Share
+	for _, share := range sm.shares {
+		if share.SessionID == sessionID && now.Before(share.ExpiresAt) {
+			shares = append(shares, share)
+		}
+	}
+	sort.Slice(shares, func(i, j int) bool { return shares[i].CreatedAt.Before(shares[j].CreatedAt) })
+	return shares
+}
+
+// RevokeShare deletes a share and immediately disconnects everyone who joined through it.
+func (sm *SessionManager) RevokeShare(sessionID, shareID string) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	share, ok := sm.shares[shareID]
+	if !ok || share.SessionID != sessionID {
+		return ErrShareNotFound
+	}
+	delete(sm.shares, shareID)
+
+	if sess, ok := sm.activeSessions[sessionID]; ok {
+		for pid, p := range sess.participants {
+			if p.ShareID == shareID {
+				p.cancel(ErrAccessRevoked)
+				delete(sess.participants, pid)
+			}
+		}
+	}
+
+	logger.Log.Info("Console session share revoked",
+		zap.String("session_id", sessionID),
+		zap.String("share_id", shareID))
+	return nil
+}
+
+// ResolveShare finds the share for token and checks userID may use it.
+// It returns the share and the session it belongs to.
+func (sm *SessionManager) ResolveShare(token string, userID uint) (*Share, *ActiveSession, error) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	share, sess, err := sm.resolveShareLocked(token)
+	if err != nil {
+		return nil, nil, err
+	}
+	if share.InviteeID != 0 && share.InviteeID != userID {
+		return nil, nil, ErrShareNotForUser
+	}
+	return share, sess, nil
+}
+
+func (sm *SessionManager) resolveShareLocked(token string) (*Share, *ActiveSession, error) {
+	now := time.Now()
+	for _, share := range sm.shares {
+		if subtle.ConstantTimeCompare([]byte(share.token), []byte(token)) != 1 {
+			continue
+		}
+		if !now.Before(share.ExpiresAt) {
+			return nil, nil, ErrShareNotFound
+		}
+		sess, ok := sm.activeSessions[share.SessionID]
+		if !ok {
+			return nil, nil, ErrSessionNotFound
+		}
+		return share, sess, nil
+	}
+	return nil, nil, ErrShareNotFound
+}
+
+// Join adds userID to the session of a share as a participant. The share is checked
+// again, so a share revoked or expired after the console ticket was issued can't be used.
+// The caller must call Leave when the participant disconnects.
+func (sm *SessionManager) Join(shareID string, userID uint, username, clientIP string) (*Participant, error) {
+	id, err := generateSessionID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate participant ID: %w", err)
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	share, ok := sm.shares[shareID]
+	if !ok || !time.Now().Before(share.ExpiresAt) {
+		return nil, ErrShareNotFound
+	}
+	if share.InviteeID != 0 && share.InviteeID != userID {
+		return nil, ErrShareNotForUser
+	}
+	sess, ok := sm.activeSessions[share.SessionID]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	if len(sess.participants) >= sm.maxParticipants {
+		return nil, ErrTooManyParticipants
+	}
+
+	ctx, cancel := context.WithCancelCause(sess.ctx)
+	p := &Participant{
+		ID:        id[:22],
+		SessionID: sess.SessionID,
+		ShareID:   share.ID,
+		UserID:    userID,
+		Username:  username,
+		Mode:      share.Mode,
+		ClientIP:  clientIP,
+		JoinedAt:  time.Now(),
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+	sess.participants[p.ID] = p
+
+	logger.Log.Info("Participant joined console session",
+		zap.String("session_id", sess.SessionID),
+		zap.String("participant_id", p.ID),
+		zap.Uint("user_id", userID),
+		zap.String("mode", string(p.Mode)))
+	return p, nil
+}
+
+// Leave removes a participant that disconnected.
+func (sm *SessionManager) Leave(sessionID, participantID string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if sess, ok := sm.activeSessions[sessionID]; ok {
+		if p, ok := sess.participants[participantID]; ok {
+			p.cancel(context.Canceled)
+			delete(sess.participants, participantID)
+		}
+	}
+}
+
+// RemoveParticipant disconnects a participant immediately.
+func (sm *SessionManager) RemoveParticipant(sessionID, participantID string) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	sess, ok := sm.activeSessions[sessionID]
+	if !ok {
+		return ErrSessionNotFound
+	}
+	p, ok := sess.participants[participantID]
+	if !ok {
+		return ErrParticipantNotFound
+	}
+	p.cancel(ErrAccessRevoked)
+	delete(sess.participants, participantID)
+
+	logger.Log.Info("Participant removed from console session",
+		zap.String("session_id", sessionID),
+		zap.String("participant_id", participantID),
+		zap.Uint("user_id", p.UserID))
+	return nil
+}
+
+// Participants returns the participants connected to a session, in join order.
+func (sm *SessionManager) Participants(sessionID string) ([]*Participant, error) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	sess, ok := sm.activeSessions[sessionID]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	participants := make([]*Participant, 0, len(sess.participants))
+	for _, p := range sess.participants {
+		participants = append(participants, p)
+	}
+	sort.Slice(participants, func(i, j int) bool { return participants[i].JoinedAt.Before(participants[j].JoinedAt) })
+	return participants, nil
+}
+
+// dropSharesLocked deletes the shares of an ending session. Participants are
+// disconnected by the session context. Callers hold sm.mu.
+func (sm *SessionManager) dropSharesLocked(sessionID string) {
+	for id, share := range sm.shares {
+		if share.SessionID == sessionID {
+			delete(sm.shares, id)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DARC0625/LIMEN/backend/internal/database"
+	"github.com/DARC0625/LIMEN/backend/internal/logger"
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestManager(t *testing.T) (*SessionManager, string) {
+	t.Helper()
+	logger.Init("debug")
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.ConsoleSession{}, &models.ConsoleSessionLimit{}); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+	database.DB = db
+
+	sm := newSessionManager()
+	sessionID, err := sm.CreateSession(1, 10, "vm-uuid", "vnc", "10.0.0.1", "test")
+	if err != nil {
+		t.Fatalf("CreateSession() error = %v", err)
+	}
+	return sm, sessionID
+}
+
+func TestShare_JoinAndRevoke(t *testing.T) {
+	sm, sessionID := setupTestManager(t)
+
+	share, err := sm.CreateShare(sessionID, 2, ShareModeView, time.Hour)
+	if err != nil {
+		t.Fatalf("CreateShare() error = %v", err)
+	}
+	if share.VMUUID != "vm-uuid" || share.Token() == "" {
+		t.Errorf("unexpected share %+v", share)
+	}
+
+	if _, _, err := sm.ResolveShare(share.Token(), 3); !errors.Is(err, ErrShareNotForUser) {
+		t.Errorf("ResolveShare() by another user error = %v, want ErrShareNotForUser", err)
+	}
+	if _, _, err := sm.ResolveShare("bogus", 2); !errors.Is(err, ErrShareNotFound) {
+		t.Errorf("ResolveShare() with bad token error = %v, want ErrShareNotFound", err)
+	}
+	resolved, sess, err := sm.ResolveShare(share.Token(), 2)
+	if err != nil || resolved.ID != share.ID || sess.SessionID != sessionID {
+		t.Fatalf("ResolveShare() = %v, %v, %v", resolved, sess, err)
+	}
+
+	p, err := sm.Join(share.ID, 2, "bob", "10.0.0.2")
+	if err != nil {
+		t.Fatalf("Join() error = %v", err)
+	}
+	if p.Mode != ShareModeView {
+		t.Errorf("participant mode = %s, want view", p.Mode)
+	}
+	participants, _ := sm.Participants(sessionID)
+	if len(participants) != 1 || participants[0].Username != "bob" {
+		t.Errorf("Participants() = %+v", participants)
+	}
+
+	if err := sm.RevokeShare(sessionID, share.ID); err != nil {
+		t.Fatalf("RevokeShare() error = %v", err)
+	}
+	if p.Context().Err() == nil || !errors.Is(context.Cause(p.Context()), ErrAccessRevoked) {
+		t.Errorf("participant context cause = %v, want ErrAccessRevoked", context.Cause(p.Context()))
+	}
+	if participants, _ := sm.Participants(sessionID); len(participants) != 0 {
+		t.Errorf("revoked participant still listed: %+v", participants)
+	}
+	if _, err := sm.Join(share.ID, 2, "bob", "10.0.0.2"); !errors.Is(err, ErrShareNotFound) {
+		t.Errorf("Join() after revoke error = %v, want ErrShareNotFound", err)
+	}
+}
+
+func TestShare_EndSessionDisconnectsParticipants(t *testing.T) {
+	sm, sessionID := setupTestManager(t)
+	link, _ := sm.CreateShare(sessionID, 0, ShareModeInteractive, time.Hour)
+
+	// A share link can be used by anyone
+	p, err := sm.Join(link.ID, 7, "carol", "10.0.0.3")
+	if err != nil {
+		t.Fatalf("Join() error = %v", err)
+	}
+
+	sm.EndSession(sessionID, "user_disconnect")
+	if p.Context().Err() == nil {
+		t.Error("participant still connected after the session ended")
+	}
+	if errors.Is(context.Cause(p.Context()), ErrAccessRevoked) {
+		t.Error("session end reported as revocation")
+	}
+	if shares := sm.ListShares(sessionID); len(shares) != 0 {
+		t.Errorf("shares outlived the session: %+v", shares)
+	}
+}
+
+func TestShare_Validation(t *testing.T) {
+	sm, sessionID := setupTestManager(t)
+
+	if _, err := sm.CreateShare(sessionID, 0, "admin", time.Hour); err == nil {
+		t.Error("CreateShare() accepted an invalid mode")
+	}
+	if _, err := sm.CreateShare(sessionID, 0, ShareModeView, 48*time.Hour); err == nil {
+		t.Error("CreateShare() accepted a lifetime over MaxShareTTL")
+	}
+	if _, err := sm.CreateShare("missing", 0, ShareModeView, time.Hour); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("CreateShare() on unknown session error = %v", err)
+	}
+
+	expired, _ := sm.CreateShare(sessionID, 0, ShareModeView, time.Hour)
+	expired.ExpiresAt = time.Now().Add(-time.Second)
+	if _, err := sm.Join(expired.ID, 2, "bob", "10.0.0.2"); !errors.Is(err, ErrShareNotFound) {
+		t.Errorf("Join() with expired share error = %v, want ErrShareNotFound", err)
+	}
+
+	sm.maxParticipants = 1
+	share, _ := sm.CreateShare(sessionID, 0, ShareModeView, time.Hour)
+	sm.Join(share.ID, 2, "bob", "10.0.0.2")
+	if _, err := sm.Join(share.ID, 3, "carol", "10.0.0.3"); !errors.Is(err, ErrTooManyParticipants) {
+		t.Errorf("Join() over the limit error = %v, want ErrTooManyParticipants", err)
+	}
+}
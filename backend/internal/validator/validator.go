@@ -8,6 +8,7 @@ import (
 	"regexp"
 	"strings"
 
+	"github.com/DARC0625/LIMEN/backend/internal/osprofile"
 	"github.com/DARC0625/LIMEN/backend/internal/security"
 )
 
@@ -80,20 +81,14 @@ func ValidateMemory(memory int) error {
 	return nil
 }
 
-// ValidateOSType validates OS type.
+// ValidateOSType validates OS type against the built-in OS profiles.
+// Handlers check against the loaded registry, which may add profiles.
 func ValidateOSType(osType string) error {
-	validTypes := []string{
-		"ubuntu-desktop",
-		"ubuntu-server",
-		"kali",
-		"windows",
-	}
-	for _, valid := range validTypes {
-		if osType == valid {
-			return nil
-		}
+	profiles := osprofile.Default()
+	if _, ok := profiles.Get(osType); !ok {
+		return fmt.Errorf("Invalid OS type. Valid types: %v", profiles.IDs())
 	}
-	return fmt.Errorf("Invalid OS type. Valid types: %v", validTypes)
+	return nil
 }
 
 // ValidateVMAction validates VM action.
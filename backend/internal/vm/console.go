@@ -0,0 +1,74 @@
+package vm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/DARC0625/LIMEN/backend/internal/logger"
+	"go.uber.org/zap"
+)
+
+// Every VM is defined with one <serial type='pty'> port; libvirt aliases it
+// serial0 and its QEMU character device charserial0.
+const (
+	serialConsoleDevice  = "serial0"
+	serialConsoleChardev = "charserial0"
+)
+
+// OpenSerialConsole attaches to the serial console of a running VM.
+// With force, a console held by another client is taken over; otherwise opening fails.
+// The caller must Close the returned stream.
+func (s *VMService) OpenSerialConsole(name string, force bool) (io.ReadWriteCloser, error) {
+	var stream io.ReadWriteCloser
+	err := s.withLibvirtGuard("OpenSerialConsole", func() error {
+		dom, err := s.lookupDomain(name)
+		if err != nil {
+			return fmt.Errorf("VM not found: %w", err)
+		}
+		defer safeFreeDomain(dom)
+
+		active, err := dom.IsActive()
+		if err != nil {
+			return fmt.Errorf("failed to check VM status: %w", err)
+		}
+		if !active {
+			return fmt.Errorf("VM is not running")
+		}
+
+		driver, err := s.driverFor(name)
+		if err != nil {
+			return err
+		}
+		stream, err = driver.OpenConsole(name, serialConsoleDevice, force)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Log.Info("Serial console opened", zap.String("vm_name", name), zap.Bool("force", force))
+	return stream, nil
+}
+
+// SendSerialBreak sends a break condition on the VM's serial line, e.g. to trigger
+// Magic SysRq in a Linux guest. libvirt streams can't carry a break, so this goes
+// through the QEMU monitor.
+func (s *VMService) SendSerialBreak(name string) error {
+	return s.withLibvirtGuard("SendSerialBreak", func() error {
+		dom, err := s.lookupDomain(name)
+		if err != nil {
+			return fmt.Errorf("VM not found: %w", err)
+		}
+		defer safeFreeDomain(dom)
+
+		cmd, _ := json.Marshal(map[string]interface{}{
+			"execute":   "chardev-send-break",
+			"arguments": map[string]string{"id": serialConsoleChardev},
+		})
+		if _, err := dom.QemuMonitorCommand(string(cmd)); err != nil {
+			return fmt.Errorf("failed to send serial break: %w", err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,133 @@
+package vm
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+// Graphical consoles are reachable only through the console proxy: graphics devices
+// listen on loopback, and VNC additionally requires a password that is regenerated
+// every time the VM starts. The proxy reads it from the secure domain XML and performs
+// the RFB authentication itself; browsers never see it.
+
+// consoleListenAddress is the address graphics devices listen on, unless their host
+// sets a console address.
+const consoleListenAddress = "127.0.0.1"
+
+// vncPasswordLength is the VNC password length; VNC authentication uses at most 8 bytes.
+const vncPasswordLength = 8
+
+const vncPasswordAlphabet = "abcdefghijkmnopqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+var (
+	graphicsElementRe = regexp.MustCompile(`(?s)<graphics\b[^>]*?(?:/>|>.*?</graphics>)`)
+	graphicsStartRe   = regexp.MustCompile(`^<graphics\b[^>]*?/?>`)
+	graphicsListenRe  = regexp.MustCompile(`(?s)\s*<listen\b[^>]*?(?:/>|>.*?</listen>)`)
+)
+
+// generateVNCPassword returns a random VNC password.
+func generateVNCPassword() (string, error) {
+	max := big.NewInt(int64(len(vncPasswordAlphabet)))
+	var b strings.Builder
+	for i := 0; i < vncPasswordLength; i++ {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate VNC password: %w", err)
+		}
+		b.WriteByte(vncPasswordAlphabet[n.Int64()])
+	}
+	return b.String(), nil
+}
+
+// setTagAttr sets attribute name of the XML start tag tag to value, adding it if missing.
+func setTagAttr(tag, name, value string) string {
+	attrRe := regexp.MustCompile(`\s` + regexp.QuoteMeta(name) + `=('[^']*'|"[^"]*")`)
+	attr := fmt.Sprintf(" %s='%s'", name, value)
+	if attrRe.MatchString(tag) {
+		return attrRe.ReplaceAllLiteralString(tag, attr)
+	}
+	end := len(tag) - 1
+	if strings.HasSuffix(tag, "/>") {
+		end--
+	}
+	return tag[:end] + attr + tag[end:]
+}
+
+// secureGraphicsXML rewrites the graphics devices of a domain XML description to listen
+// on listen only and sets vncPassword on VNC graphics ("" keeps their passwords).
+// <listen> children are dropped, so the listen attribute is the only listen address.
+func secureGraphicsXML(xmlDesc, listen, vncPassword string) string {
+	return graphicsElementRe.ReplaceAllStringFunc(xmlDesc, func(element string) string {
+		element = graphicsListenRe.ReplaceAllString(element, "")
+		start := graphicsStartRe.FindString(element)
+		if start == "" {
+			return element
+		}
+		secured := setTagAttr(start, "listen", listen)
+		if vncPassword != "" && (strings.Contains(start, "type='vnc'") || strings.Contains(start, `type="vnc"`)) {
+			secured = setTagAttr(secured, "passwd", vncPassword)
+		}
+		return secured + element[len(start):]
+	})
+}
+
+// rotateConsolePassword redefines a stopped VM with its graphics bound to its host's
+// console address and a new VNC password. It must run before every start: QEMU reads the password at start.
+func (s *VMService) rotateConsolePassword(name string) error {
+	dom, err := s.lookupDomain(name)
+	if err != nil {
+		return fmt.Errorf("VM not found: %w", err)
+	}
+	defer safeFreeDomain(dom)
+
+	xmlDesc, err := dom.GetXMLDescInactive()
+	if err != nil {
+		return fmt.Errorf("failed to get VM XML: %w", err)
+	}
+	graphics, err := parseGraphics(xmlDesc)
+	if err != nil {
+		return err
+	}
+	if len(graphics) == 0 {
+		return nil
+	}
+
+	password, err := generateVNCPassword()
+	if err != nil {
+		return err
+	}
+	updated, err := s.defineDomain(name, secureGraphicsXML(xmlDesc, s.ConsoleAddress(name), password))
+	if err != nil {
+		return fmt.Errorf("failed to update console credentials: %w", err)
+	}
+	safeFreeDomain(updated)
+	return nil
+}
+
+// GetVNCPassword returns the VNC password of a running VM, or "" if its VNC server
+// has none (e.g. a VM started before passwords were introduced).
+func (s *VMService) GetVNCPassword(name string) (string, error) {
+	dom, err := s.lookupDomain(name)
+	if err != nil {
+		return "", fmt.Errorf("VM not found: %w", err)
+	}
+	defer safeFreeDomain(dom)
+
+	xmlDesc, err := dom.GetXMLDescSecure()
+	if err != nil {
+		return "", fmt.Errorf("failed to get VM XML: %w", err)
+	}
+	graphics, err := parseGraphics(xmlDesc)
+	if err != nil {
+		return "", err
+	}
+	for _, g := range graphics {
+		if g.Type == "vnc" {
+			return g.Passwd, nil
+		}
+	}
+	return "", fmt.Errorf("VNC graphics not found in VM configuration")
+}
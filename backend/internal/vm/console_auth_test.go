@@ -0,0 +1,54 @@
+package vm
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSecureGraphicsXML(t *testing.T) {
+	xmlDesc := `<domain><devices>
+    <graphics type='vnc' port='-1' autoport='yes' listen='0.0.0.0' passwd='old'>
+      <listen type='address' address='0.0.0.0'/>
+    </graphics>
+    <graphics type="spice" autoport="yes">
+      <listen type="network" network="default"/>
+    </graphics>
+    <graphics type='vnc' port='5901'/>
+  </devices></domain>`
+
+	secured := secureGraphicsXML(xmlDesc, consoleListenAddress, "s3cret12")
+	if strings.Contains(secured, "0.0.0.0") || strings.Contains(secured, "<listen") {
+		t.Errorf("secureGraphicsXML() left a public listen address:\n%s", secured)
+	}
+
+	graphics, err := parseGraphics(secured)
+	if err != nil {
+		t.Fatalf("parseGraphics() error = %v\n%s", err, secured)
+	}
+	if len(graphics) != 3 {
+		t.Fatalf("got %d graphics devices, want 3", len(graphics))
+	}
+	for _, g := range graphics {
+		if g.Listen != "127.0.0.1" {
+			t.Errorf("%s listen = %q, want 127.0.0.1", g.Type, g.Listen)
+		}
+		wantPasswd := ""
+		if g.Type == "vnc" {
+			wantPasswd = "s3cret12"
+		}
+		if g.Passwd != wantPasswd {
+			t.Errorf("%s passwd = %q, want %q", g.Type, g.Passwd, wantPasswd)
+		}
+	}
+}
+
+func TestGenerateVNCPassword(t *testing.T) {
+	a, err := generateVNCPassword()
+	if err != nil {
+		t.Fatalf("generateVNCPassword() error = %v", err)
+	}
+	b, _ := generateVNCPassword()
+	if len(a) != vncPasswordLength || a == b {
+		t.Errorf("generateVNCPassword() = %q, %q", a, b)
+	}
+}
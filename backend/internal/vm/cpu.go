@@ -0,0 +1,228 @@
+package vm
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/DARC0625/LIMEN/backend/internal/hardware"
+)
+
+// CPU models with special meaning; anything else is passed to libvirt as a named model.
+const (
+	CPUModelHostModel       = "host-model"
+	CPUModelHostPassthrough = "host-passthrough"
+)
+
+var cpuModelNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)
+
+// VCPUPin pins one guest vCPU to a set of host CPUs.
+type VCPUPin struct {
+	VCPU   int    `json:"vcpu"`
+	CPUSet string `json:"cpuset"` // Host CPU list, e.g. "2" or "2-3,6"
+}
+
+// CPUConfig describes guest CPU layout and placement. Zero values keep libvirt defaults
+// (host-model CPU, one socket per vCPU, no pinning).
+type CPUConfig struct {
+	Model    string    `json:"cpu_model,omitempty"`
+	Sockets  int       `json:"sockets,omitempty"`
+	Cores    int       `json:"cores,omitempty"`
+	Threads  int       `json:"threads,omitempty"`
+	Pinning  []VCPUPin `json:"cpu_pinning,omitempty"`
+	NUMANode *int      `json:"numa_node,omitempty"`
+}
+
+// HasTopology reports whether an explicit sockets/cores/threads layout was requested.
+func (c CPUConfig) HasTopology() bool {
+	return c.Sockets > 0 || c.Cores > 0 || c.Threads > 0
+}
+
+// HasPlacement reports whether host placement (pinning or NUMA) was requested.
+func (c CPUConfig) HasPlacement() bool {
+	return len(c.Pinning) > 0 || c.NUMANode != nil
+}
+
+// Normalize fills unset topology fields so that sockets*cores*threads can match vcpus.
+// Missing sockets and threads default to 1; missing cores take the remainder.
+func (c CPUConfig) Normalize(vcpus int) CPUConfig {
+	if c.Model == "" {
+		c.Model = CPUModelHostModel
+	}
+	if !c.HasTopology() {
+		return c
+	}
+	if c.Sockets == 0 {
+		c.Sockets = 1
+	}
+	if c.Threads == 0 {
+		c.Threads = 1
+	}
+	if c.Cores == 0 && vcpus%(c.Sockets*c.Threads) == 0 {
+		c.Cores = vcpus / (c.Sockets * c.Threads)
+	}
+	return c
+}
+
+// Validate checks the configuration for a VM with vcpus vCPUs.
+// host may be nil if the hardware spec is unavailable, in which case placement is rejected.
+// Call Normalize first.
+func (c CPUConfig) Validate(vcpus int, host *hardware.CPUInfo) error {
+	if c.Model != CPUModelHostModel && c.Model != CPUModelHostPassthrough && !cpuModelNamePattern.MatchString(c.Model) {
+		return fmt.Errorf("invalid cpu_model %q", c.Model)
+	}
+
+	if c.HasTopology() {
+		if c.Sockets < 1 || c.Cores < 1 || c.Threads < 1 {
+			return fmt.Errorf("sockets, cores and threads must be at least 1")
+		}
+		if c.Sockets*c.Cores*c.Threads != vcpus {
+			return fmt.Errorf("topology %d sockets x %d cores x %d threads does not match %d vCPUs",
+				c.Sockets, c.Cores, c.Threads, vcpus)
+		}
+	}
+
+	if !c.HasPlacement() {
+		return nil
+	}
+	if host == nil {
+		return fmt.Errorf("host CPU information is unavailable; cannot validate cpu placement")
+	}
+	hostCPUs := host.Threads
+
+	seen := make(map[int]bool)
+	for _, pin := range c.Pinning {
+		if pin.VCPU < 0 || pin.VCPU >= vcpus {
+			return fmt.Errorf("cpu_pinning: vcpu %d out of range (0-%d)", pin.VCPU, vcpus-1)
+		}
+		if seen[pin.VCPU] {
+			return fmt.Errorf("cpu_pinning: vcpu %d pinned more than once", pin.VCPU)
+		}
+		seen[pin.VCPU] = true
+
+		cpus, err := hardware.ParseCPUList(pin.CPUSet)
+		if err != nil {
+			return fmt.Errorf("cpu_pinning: vcpu %d: %w", pin.VCPU, err)
+		}
+		for _, cpu := range cpus {
+			if cpu >= hostCPUs {
+				return fmt.Errorf("cpu_pinning: host cpu %d does not exist (host has %d)", cpu, hostCPUs)
+			}
+		}
+	}
+
+	if c.NUMANode != nil {
+		node, ok := host.NUMANode(*c.NUMANode)
+		if !ok {
+			return fmt.Errorf("numa_node %d does not exist on this host", *c.NUMANode)
+		}
+		// Pinned vCPUs must stay on the chosen node
+		onNode := make(map[int]bool, len(node.CPUs))
+		for _, cpu := range node.CPUs {
+			onNode[cpu] = true
+		}
+		for _, pin := range c.Pinning {
+			cpus, _ := hardware.ParseCPUList(pin.CPUSet)
+			for _, cpu := range cpus {
+				if !onNode[cpu] {
+					return fmt.Errorf("cpu_pinning: host cpu %d is not on numa_node %d", cpu, *c.NUMANode)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// cpuXML returns the <cpu> element.
+func cpuXML(c CPUConfig) string {
+	var open, inner string
+	switch c.Model {
+	case "", CPUModelHostModel:
+		open = "<cpu mode='host-model' check='partial'"
+	case CPUModelHostPassthrough:
+		open = "<cpu mode='host-passthrough' check='none' migratable='on'"
+	default:
+		open = "<cpu mode='custom' match='exact' check='partial'"
+		inner += fmt.Sprintf("\n    <model fallback='allow'>%s</model>", c.Model)
+	}
+	if c.HasTopology() {
+		inner += fmt.Sprintf("\n    <topology sockets='%d' dies='1' cores='%d' threads='%d'/>", c.Sockets, c.Cores, c.Threads)
+	}
+	if inner == "" {
+		return open + "/>"
+	}
+	return open + ">" + inner + "\n  </cpu>"
+}
+
+// vcpuXML returns the <vcpu> element. Unpinned vCPUs of a NUMA-placed VM are confined to the node's CPUs.
+func vcpuXML(vcpus int, c CPUConfig, host *hardware.CPUInfo) string {
+	if c.NUMANode != nil && host != nil {
+		if node, ok := host.NUMANode(*c.NUMANode); ok && len(node.CPUs) > 0 {
+			return fmt.Sprintf("<vcpu placement='static' cpuset='%s'>%d</vcpu>", formatCPUList(node.CPUs), vcpus)
+		}
+	}
+	return fmt.Sprintf("<vcpu placement='static'>%d</vcpu>", vcpus)
+}
+
+// cputuneXML returns <cputune> and <numatune> elements for placement, or "".
+func cputuneXML(c CPUConfig) string {
+	var b strings.Builder
+	if len(c.Pinning) > 0 {
+		b.WriteString("  <cputune>\n")
+		for _, pin := range c.Pinning {
+			fmt.Fprintf(&b, "    <vcpupin vcpu='%d' cpuset='%s'/>\n", pin.VCPU, pin.CPUSet)
+		}
+		b.WriteString("  </cputune>\n")
+	}
+	if c.NUMANode != nil {
+		fmt.Fprintf(&b, "  <numatune>\n    <memory mode='strict' nodeset='%d'/>\n  </numatune>\n", *c.NUMANode)
+	}
+	return b.String()
+}
+
+// formatCPUList formats sorted CPU IDs as a compact list ("0-3,8").
+func formatCPUList(cpus []int) string {
+	var parts []string
+	for i := 0; i < len(cpus); {
+		j := i
+		for j+1 < len(cpus) && cpus[j+1] == cpus[j]+1 {
+			j++
+		}
+		if i == j {
+			parts = append(parts, fmt.Sprintf("%d", cpus[i]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", cpus[i], cpus[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ",")
+}
+
+var (
+	cpuElementPattern      = regexp.MustCompile(`(?s)<cpu\b[^>]*/>|<cpu\b[^>]*>.*?</cpu>`)
+	vcpuElementPattern     = regexp.MustCompile(`<vcpu\b[^>]*>\s*\d+\s*</vcpu>`)
+	cputuneElementPattern  = regexp.MustCompile(`(?s)\s*<cputune>.*?</cputune>`)
+	numatuneElementPattern = regexp.MustCompile(`(?s)\s*<numatune>.*?</numatune>`)
+)
+
+// applyCPUConfig rewrites the CPU-related elements of a domain XML.
+func applyCPUConfig(domainXML string, vcpus int, c CPUConfig, host *hardware.CPUInfo) (string, error) {
+	if !vcpuElementPattern.MatchString(domainXML) {
+		return "", fmt.Errorf("domain XML has no <vcpu> element")
+	}
+	out := cputuneElementPattern.ReplaceAllString(domainXML, "")
+	out = numatuneElementPattern.ReplaceAllString(out, "")
+
+	vcpu := vcpuXML(vcpus, c, host)
+	if tune := cputuneXML(c); tune != "" {
+		vcpu += "\n" + strings.TrimSuffix(tune, "\n")
+	}
+	out = vcpuElementPattern.ReplaceAllLiteralString(out, vcpu)
+
+	if cpuElementPattern.MatchString(out) {
+		out = cpuElementPattern.ReplaceAllLiteralString(out, cpuXML(c))
+	} else {
+		out = strings.Replace(out, "</features>", "</features>\n  "+cpuXML(c), 1)
+	}
+	return out, nil
+}
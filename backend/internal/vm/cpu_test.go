@@ -0,0 +1,121 @@
+package vm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/DARC0625/LIMEN/backend/internal/hardware"
+)
+
+func testHostCPU() *hardware.CPUInfo {
+	return &hardware.CPUInfo{
+		Cores:   8,
+		Threads: 8,
+		NUMANodes: []hardware.NUMANode{
+			{ID: 0, CPUs: []int{0, 1, 2, 3}},
+			{ID: 1, CPUs: []int{4, 5, 6, 7}},
+		},
+	}
+}
+
+func intPtr(v int) *int { return &v }
+
+func TestCPUConfig_Validate(t *testing.T) {
+	host := testHostCPU()
+
+	tests := []struct {
+		name    string
+		cfg     CPUConfig
+		vcpus   int
+		host    *hardware.CPUInfo
+		wantErr bool
+	}{
+		{"defaults", CPUConfig{}, 4, nil, false},
+		{"sockets only", CPUConfig{Sockets: 2}, 4, nil, false},
+		{"full topology", CPUConfig{Sockets: 1, Cores: 2, Threads: 2}, 4, nil, false},
+		{"topology mismatch", CPUConfig{Sockets: 1, Cores: 2, Threads: 1}, 4, nil, true},
+		{"indivisible", CPUConfig{Sockets: 3}, 4, nil, true},
+		{"named model", CPUConfig{Model: "Skylake-Client-IBRS"}, 2, nil, false},
+		{"bad model", CPUConfig{Model: "<evil/>"}, 2, nil, true},
+		{"pinning", CPUConfig{Pinning: []VCPUPin{{0, "2"}, {1, "3"}}}, 2, host, false},
+		{"pinning without host info", CPUConfig{Pinning: []VCPUPin{{0, "2"}}}, 2, nil, true},
+		{"pin vcpu out of range", CPUConfig{Pinning: []VCPUPin{{2, "2"}}}, 2, host, true},
+		{"pin vcpu twice", CPUConfig{Pinning: []VCPUPin{{0, "2"}, {0, "3"}}}, 2, host, true},
+		{"pin missing host cpu", CPUConfig{Pinning: []VCPUPin{{0, "8"}}}, 2, host, true},
+		{"bad cpuset", CPUConfig{Pinning: []VCPUPin{{0, "x"}}}, 2, host, true},
+		{"numa node", CPUConfig{NUMANode: intPtr(1)}, 2, host, false},
+		{"missing numa node", CPUConfig{NUMANode: intPtr(2)}, 2, host, true},
+		{"pin outside numa node", CPUConfig{NUMANode: intPtr(0), Pinning: []VCPUPin{{0, "4"}}}, 2, host, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Normalize(tt.vcpus).Validate(tt.vcpus, tt.host)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCPUXML(t *testing.T) {
+	if got := cpuXML(CPUConfig{}.Normalize(2)); got != "<cpu mode='host-model' check='partial'/>" {
+		t.Errorf("Unexpected default cpu XML: %s", got)
+	}
+
+	got := cpuXML(CPUConfig{Model: "Skylake-Client", Sockets: 1}.Normalize(4))
+	for _, want := range []string{"mode='custom'", "<model fallback='allow'>Skylake-Client</model>", "<topology sockets='1' dies='1' cores='4' threads='1'/>"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("cpu XML missing %q:\n%s", want, got)
+		}
+	}
+
+	cfg := CPUConfig{Pinning: []VCPUPin{{0, "4"}}, NUMANode: intPtr(1)}
+	if got := vcpuXML(2, cfg, testHostCPU()); got != "<vcpu placement='static' cpuset='4-7'>2</vcpu>" {
+		t.Errorf("Unexpected vcpu XML: %s", got)
+	}
+	tune := cputuneXML(cfg)
+	if !strings.Contains(tune, "<vcpupin vcpu='0' cpuset='4'/>") || !strings.Contains(tune, "nodeset='1'") {
+		t.Errorf("Unexpected cputune XML:\n%s", tune)
+	}
+}
+
+func TestApplyCPUConfig(t *testing.T) {
+	domain := `<domain type='kvm'>
+  <name>vm1</name>
+  <vcpu placement='static'>2</vcpu>
+  <cputune>
+    <vcpupin vcpu='0' cpuset='1'/>
+  </cputune>
+  <os>
+    <type arch='x86_64'>hvm</type>
+  </os>
+  <features>
+    <acpi/>
+  </features>
+  <cpu mode='host-model' check='partial'/>
+</domain>`
+
+	cfg := CPUConfig{Model: CPUModelHostPassthrough, Sockets: 1, Pinning: []VCPUPin{{3, "6"}}}.Normalize(4)
+	out, err := applyCPUConfig(domain, 4, cfg, testHostCPU())
+	if err != nil {
+		t.Fatalf("applyCPUConfig failed: %v", err)
+	}
+	for _, want := range []string{"<vcpu placement='static'>4</vcpu>", "<vcpupin vcpu='3' cpuset='6'/>", "mode='host-passthrough'", "cores='4'"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Output missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "cpuset='1'") || strings.Count(out, "<cpu ") != 1 {
+		t.Errorf("Old CPU settings should be replaced:\n%s", out)
+	}
+
+	// Clearing placement removes cputune
+	out, _ = applyCPUConfig(out, 4, CPUConfig{}.Normalize(4), nil)
+	if strings.Contains(out, "<cputune>") {
+		t.Errorf("Expected cputune to be removed:\n%s", out)
+	}
+
+	if _, err := applyCPUConfig("<domain/>", 2, CPUConfig{}, nil); err == nil {
+		t.Error("Expected error for domain without vcpu")
+	}
+}
@@ -2,6 +2,8 @@
 // This file defines the interface for libvirt operations.
 package vm
 
+import "io"
+
 // LibvirtDriver defines the interface for libvirt operations.
 // This allows service.go to work without directly importing libvirt types.
 type LibvirtDriver interface {
@@ -14,10 +16,23 @@ type LibvirtDriver interface {
 	LookupDomainByName(name string) (Domain, error)
 	DomainDefineXML(xml string) (Domain, error)
 
+	// Console streams: attach to a character device (e.g. "serial0") of a running domain.
+	// force takes the console over from another client.
+	OpenConsole(name, devName string, force bool) (io.ReadWriteCloser, error)
+
+	// Host capacity
+	NodeResources() (NodeResources, error)
+
 	// Domain interface
 	Domain() Domain
 }
 
+// NodeResources is the capacity of a libvirt host.
+type NodeResources struct {
+	CPUs     int
+	MemoryMB int
+}
+
 // Domain represents a libvirt domain (VM).
 type Domain interface {
 	Free() error
@@ -39,6 +54,27 @@ type Domain interface {
 	// Snapshot operations (libvirt-specific, but needed for snapshot.go)
 	CreateSnapshotXML(xml string, flags uint32) (Snapshot, error)
 	SnapshotLookupByName(name string) (Snapshot, error)
+
+	// QEMU monitor passthrough (QMP), for operations libvirt has no API for
+	QemuMonitorCommand(command string) (string, error)
+
+	// Migration to another host. Migrate blocks until the migration ends; GetJobProgress
+	// may be called meanwhile from another goroutine.
+	Migrate(dest LibvirtDriver, params MigrateParams, flags uint32) error
+	GetJobProgress() (JobProgress, error)
+}
+
+// MigrateParams are the optional parameters of a migration.
+type MigrateParams struct {
+	DestXML    string // Live definition on the destination ("" = unchanged)
+	PersistXML string // Persistent definition on the destination ("" = unchanged)
+}
+
+// JobProgress is the progress of a domain's background job (e.g. a migration), in bytes.
+type JobProgress struct {
+	DataTotal     uint64
+	DataProcessed uint64
+	DataRemaining uint64
 }
 
 // Snapshot represents a libvirt domain snapshot.
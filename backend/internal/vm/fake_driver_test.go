@@ -0,0 +1,267 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sync"
+	"testing"
+
+	"github.com/DARC0625/LIMEN/backend/internal/logger"
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"github.com/DARC0625/LIMEN/backend/internal/osprofile"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// fakeCluster simulates libvirt hosts, keyed by connection URI. Drivers created by
+// newDriver connect to them like real drivers connect to libvirt daemons.
+type fakeCluster struct {
+	mu    sync.Mutex
+	hosts map[string]*fakeHost
+}
+
+// fakeHost is a simulated libvirt daemon. A host that is down refuses connections, and
+// taking it down kills the open ones for good.
+type fakeHost struct {
+	resources  NodeResources
+	down       bool
+	generation int   // Incremented when the host goes down
+	refuse     error // Returned to migrations to the host
+	domains    map[string]*fakeDomain
+}
+
+func newFakeCluster() *fakeCluster {
+	return &fakeCluster{hosts: make(map[string]*fakeHost)}
+}
+
+// addHost adds a host reachable at uri.
+func (c *fakeCluster) addHost(uri string, cpus, memoryMB int) *fakeHost {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	host := &fakeHost{resources: NodeResources{CPUs: cpus, MemoryMB: memoryMB}, domains: make(map[string]*fakeDomain)}
+	c.hosts[uri] = host
+	return host
+}
+
+// setDown takes a host down or brings it back.
+func (c *fakeCluster) setDown(uri string, down bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hosts[uri].down = down
+	if down {
+		c.hosts[uri].generation++
+	}
+}
+
+// domain returns the domain name defined on the host at uri, or nil.
+func (c *fakeCluster) domain(uri, name string) *fakeDomain {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hosts[uri].domains[name]
+}
+
+func (c *fakeCluster) newDriver() LibvirtDriver {
+	return &fakeDriver{cluster: c}
+}
+
+type fakeDriver struct {
+	cluster    *fakeCluster
+	host       *fakeHost
+	generation int
+	closed     bool
+}
+
+var domainNameRe = regexp.MustCompile(`<name>([^<]+)</name>`)
+
+func (d *fakeDriver) Connect(uri string) error {
+	d.cluster.mu.Lock()
+	defer d.cluster.mu.Unlock()
+	host, ok := d.cluster.hosts[uri]
+	if !ok || host.down {
+		return fmt.Errorf("failed to connect to libvirt: %s unreachable", uri)
+	}
+	d.host = host
+	d.generation = host.generation
+	return nil
+}
+
+func (d *fakeDriver) Close() error {
+	d.closed = true
+	return nil
+}
+
+func (d *fakeDriver) IsAlive() bool {
+	d.cluster.mu.Lock()
+	defer d.cluster.mu.Unlock()
+	return d.host != nil && !d.closed && d.generation == d.host.generation
+}
+
+func (d *fakeDriver) LookupDomainByName(name string) (Domain, error) {
+	d.cluster.mu.Lock()
+	defer d.cluster.mu.Unlock()
+	if dom, ok := d.host.domains[name]; ok {
+		return dom, nil
+	}
+	return nil, fmt.Errorf("Domain not found: no domain with matching name '%s'", name)
+}
+
+func (d *fakeDriver) DomainDefineXML(xmlDesc string) (Domain, error) {
+	match := domainNameRe.FindStringSubmatch(xmlDesc)
+	if match == nil {
+		return nil, errors.New("domain XML has no name")
+	}
+	d.cluster.mu.Lock()
+	defer d.cluster.mu.Unlock()
+	dom, ok := d.host.domains[match[1]]
+	if !ok {
+		dom = &fakeDomain{host: d.host, cluster: d.cluster, name: match[1]}
+		d.host.domains[dom.name] = dom
+	}
+	dom.xml = xmlDesc
+	return dom, nil
+}
+
+func (d *fakeDriver) OpenConsole(name, devName string, force bool) (io.ReadWriteCloser, error) {
+	return nil, errors.New("consoles are not simulated")
+}
+
+func (d *fakeDriver) NodeResources() (NodeResources, error) {
+	return d.host.resources, nil
+}
+
+func (d *fakeDriver) Domain() Domain {
+	return nil
+}
+
+type fakeDomain struct {
+	cluster *fakeCluster
+	host    *fakeHost
+	name    string
+	xml     string
+	active  bool
+}
+
+func (d *fakeDomain) Free() error { return nil }
+
+func (d *fakeDomain) IsActive() (bool, error) {
+	d.cluster.mu.Lock()
+	defer d.cluster.mu.Unlock()
+	return d.active, nil
+}
+
+func (d *fakeDomain) GetState() (DomainState, int, error) {
+	if active, _ := d.IsActive(); active {
+		return DomainStateRunning, 0, nil
+	}
+	return DomainStateShutoff, 0, nil
+}
+
+func (d *fakeDomain) GetXMLDesc(flags uint32) (string, error) {
+	d.cluster.mu.Lock()
+	defer d.cluster.mu.Unlock()
+	return d.xml, nil
+}
+
+func (d *fakeDomain) GetXMLDescInactive() (string, error) { return d.GetXMLDesc(0) }
+func (d *fakeDomain) GetXMLDescSecure() (string, error)   { return d.GetXMLDesc(0) }
+
+func (d *fakeDomain) setActive(active bool) error {
+	d.cluster.mu.Lock()
+	defer d.cluster.mu.Unlock()
+	d.active = active
+	return nil
+}
+
+func (d *fakeDomain) Create() error   { return d.setActive(true) }
+func (d *fakeDomain) Destroy() error  { return d.setActive(false) }
+func (d *fakeDomain) Shutdown() error { return d.setActive(false) }
+
+func (d *fakeDomain) UndefineFlags(flags uint32) error { return d.Undefine() }
+
+func (d *fakeDomain) Undefine() error {
+	d.cluster.mu.Lock()
+	defer d.cluster.mu.Unlock()
+	delete(d.host.domains, d.name)
+	return nil
+}
+
+func (d *fakeDomain) SetVcpusFlags(vcpu uint, flags uint32) error      { return nil }
+func (d *fakeDomain) SetMemoryFlags(memory uint64, flags uint32) error { return nil }
+func (d *fakeDomain) GetVcpusFlags(flags uint32) (int, error)          { return 1, nil }
+func (d *fakeDomain) GetMemoryStats(flags uint32) (map[string]uint64, error) {
+	return map[string]uint64{}, nil
+}
+
+func (d *fakeDomain) CreateSnapshotXML(xml string, flags uint32) (Snapshot, error) {
+	return nil, errors.New("snapshots are not simulated")
+}
+
+func (d *fakeDomain) SnapshotLookupByName(name string) (Snapshot, error) {
+	return nil, errors.New("snapshots are not simulated")
+}
+
+func (d *fakeDomain) QemuMonitorCommand(command string) (string, error) {
+	return "{}", nil
+}
+
+// Migrate moves a running domain to the destination's host; it keeps running there.
+func (d *fakeDomain) Migrate(dest LibvirtDriver, params MigrateParams, flags uint32) error {
+	target := dest.(*fakeDriver).host
+	d.cluster.mu.Lock()
+	defer d.cluster.mu.Unlock()
+	if target.refuse != nil {
+		return target.refuse
+	}
+	if !d.active {
+		return errors.New("domain is not running")
+	}
+	moved := &fakeDomain{cluster: d.cluster, host: target, name: d.name, xml: d.xml, active: true}
+	if params.PersistXML != "" {
+		moved.xml = params.PersistXML
+	}
+	target.domains[d.name] = moved
+	delete(d.host.domains, d.name)
+	d.active = false
+	return nil
+}
+
+func (d *fakeDomain) GetJobProgress() (JobProgress, error) {
+	return JobProgress{}, errors.New("no job running")
+}
+
+// fakeLocalURI is the default host's URI in fake clusters.
+const fakeLocalURI = "qemu:///system"
+
+// newFakeVMService returns a VMService whose hosts are simulated by cluster. The
+// cluster must have a host at fakeLocalURI.
+func newFakeVMService(t *testing.T, cluster *fakeCluster) *VMService {
+	t.Helper()
+	logger.Init("debug")
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.VM{}, &models.Host{}); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+
+	local := cluster.newDriver()
+	if err := local.Connect(fakeLocalURI); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	hosts := newHostPool(db, cluster.newDriver)
+	hosts.setDefault(fakeLocalURI, local)
+
+	return &VMService{
+		hosts:              hosts,
+		db:                 db,
+		isoDir:             t.TempDir(),
+		vmDir:              t.TempDir(),
+		operationSemaphore: make(chan struct{}, MaxConcurrentLibvirtOps),
+		operationTimeout:   DefaultLibvirtTimeout,
+		profiles:           osprofile.Default(),
+		firmware:           DefaultFirmwarePaths(),
+	}
+}
@@ -0,0 +1,155 @@
+package vm
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/DARC0625/LIMEN/backend/internal/logger"
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"github.com/DARC0625/LIMEN/backend/internal/osprofile"
+	"go.uber.org/zap"
+)
+
+// FirmwarePaths locates the OVMF images used for UEFI VMs.
+type FirmwarePaths struct {
+	Code           string // OVMF code (read-only pflash)
+	Vars           string // NVRAM template
+	SecureBootCode string // Secure Boot capable OVMF code
+	SecureBootVars string // NVRAM template with Secure Boot keys enrolled
+}
+
+// DefaultFirmwarePaths returns the OVMF paths of the Debian/Ubuntu ovmf package.
+func DefaultFirmwarePaths() FirmwarePaths {
+	return FirmwarePaths{
+		Code:           "/usr/share/OVMF/OVMF_CODE_4M.fd",
+		Vars:           "/usr/share/OVMF/OVMF_VARS_4M.fd",
+		SecureBootCode: "/usr/share/OVMF/OVMF_CODE_4M.secboot.fd",
+		SecureBootVars: "/usr/share/OVMF/OVMF_VARS_4M.ms.fd",
+	}
+}
+
+// loader returns the code image and NVRAM template for fw.
+func (p FirmwarePaths) loader(fw osprofile.Firmware) (code, vars string) {
+	if fw == osprofile.FirmwareUEFISecureBoot {
+		return p.SecureBootCode, p.SecureBootVars
+	}
+	return p.Code, p.Vars
+}
+
+// SetFirmwarePaths replaces the OVMF paths used for UEFI VMs.
+func (s *VMService) SetFirmwarePaths(paths FirmwarePaths) {
+	s.firmware = paths
+}
+
+// nvramPath returns the per-VM NVRAM file. It lives next to the disk so it
+// shares the VM's lifecycle (and the UUID prefix used by delete cleanup).
+func (s *VMService) nvramPath(vmUUID string) string {
+	return filepath.Join(s.vmDir, vmUUID+"_VARS.fd")
+}
+
+// firmwareOSXML returns the <loader>/<nvram> elements for the <os> section, or "" for BIOS.
+func firmwareOSXML(fw osprofile.Firmware, code, nvram, template string) string {
+	switch fw {
+	case osprofile.FirmwareUEFI:
+		return fmt.Sprintf(`    <loader readonly='yes' type='pflash'>%s</loader>
+    <nvram template='%s'>%s</nvram>
+`, code, template, nvram)
+	case osprofile.FirmwareUEFISecureBoot:
+		return fmt.Sprintf(`    <loader readonly='yes' secure='yes' type='pflash'>%s</loader>
+    <nvram template='%s'>%s</nvram>
+`, code, template, nvram)
+	default:
+		return ""
+	}
+}
+
+// firmwareFeaturesXML returns extra <features> required by the firmware.
+// Secure Boot needs SMM so the guest can't write the variable store directly.
+func firmwareFeaturesXML(fw osprofile.Firmware) string {
+	if fw == osprofile.FirmwareUEFISecureBoot {
+		return "    <smm state='on'/>\n"
+	}
+	return ""
+}
+
+// tpmXML returns an emulated (swtpm) TPM 2.0 device, or "" if disabled.
+func tpmXML(enabled bool) string {
+	if !enabled {
+		return ""
+	}
+	return `    <tpm model='tpm-crb'>
+      <backend type='emulator' version='2.0'/>
+    </tpm>
+`
+}
+
+// copyNVRAMTemplate writes a fresh copy of template to dst, replacing any existing file.
+func copyNVRAMTemplate(template, dst string) error {
+	src, err := os.Open(template)
+	if err != nil {
+		return fmt.Errorf("failed to open nvram template: %w", err)
+	}
+	defer src.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("failed to create nvram directory: %w", err)
+	}
+	tmp := dst + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create nvram file: %w", err)
+	}
+	if _, err := io.Copy(out, src); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("failed to copy nvram template: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
+
+// ResetNVRAM restores a UEFI VM's NVRAM from the firmware template.
+// Use this when the firmware variable store is corrupted (e.g. the VM no longer boots
+// past the OVMF screen). Boot entries and Secure Boot key changes are lost. The VM must be stopped.
+func (s *VMService) ResetNVRAM(name string) error {
+	return s.withLibvirtGuard("ResetNVRAM", func() error {
+		var vmRec models.VM
+		if err := s.db.Where("name = ?", name).First(&vmRec).Error; err != nil {
+			return fmt.Errorf("VM not found: %w", err)
+		}
+		fw := osprofile.Firmware(vmRec.Firmware)
+		if fw != osprofile.FirmwareUEFI && fw != osprofile.FirmwareUEFISecureBoot {
+			return fmt.Errorf("VM does not use UEFI firmware")
+		}
+
+		dom, err := s.lookupDomain(name)
+		if err != nil {
+			return fmt.Errorf("VM not found: %w", err)
+		}
+		defer safeFreeDomain(dom)
+
+		active, err := dom.IsActive()
+		if err != nil {
+			return fmt.Errorf("failed to check VM status: %w", err)
+		}
+		if active {
+			return fmt.Errorf("VM must be stopped before resetting NVRAM")
+		}
+
+		_, template := s.firmware.loader(fw)
+		if err := copyNVRAMTemplate(template, s.nvramPath(vmRec.UUID)); err != nil {
+			return err
+		}
+
+		logger.Log.Info("VM NVRAM reset from template",
+			zap.String("vm_name", name),
+			zap.String("firmware", vmRec.Firmware),
+			zap.String("template", template))
+		return nil
+	})
+}
@@ -0,0 +1,65 @@
+package vm
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/DARC0625/LIMEN/backend/internal/osprofile"
+)
+
+func TestFirmwareXML(t *testing.T) {
+	if firmwareOSXML(osprofile.FirmwareBIOS, "code", "nvram", "tmpl") != "" {
+		t.Error("Expected no loader for BIOS")
+	}
+
+	uefi := firmwareOSXML(osprofile.FirmwareUEFI, "/ovmf/code.fd", "/vms/a_VARS.fd", "/ovmf/vars.fd")
+	if !strings.Contains(uefi, "<loader readonly='yes' type='pflash'>/ovmf/code.fd</loader>") ||
+		!strings.Contains(uefi, "<nvram template='/ovmf/vars.fd'>/vms/a_VARS.fd</nvram>") {
+		t.Errorf("Unexpected UEFI XML:\n%s", uefi)
+	}
+
+	sb := firmwareOSXML(osprofile.FirmwareUEFISecureBoot, "/ovmf/secboot.fd", "/vms/a_VARS.fd", "/ovmf/ms.fd")
+	if !strings.Contains(sb, "secure='yes'") {
+		t.Errorf("Expected secure loader:\n%s", sb)
+	}
+	if firmwareFeaturesXML(osprofile.FirmwareUEFISecureBoot) == "" || firmwareFeaturesXML(osprofile.FirmwareUEFI) != "" {
+		t.Error("SMM should only be enabled for Secure Boot")
+	}
+
+	if tpmXML(false) != "" || !strings.Contains(tpmXML(true), "<backend type='emulator' version='2.0'/>") {
+		t.Error("Unexpected TPM XML")
+	}
+
+	code, vars := DefaultFirmwarePaths().loader(osprofile.FirmwareUEFISecureBoot)
+	if !strings.Contains(code, "secboot") || !strings.Contains(vars, ".ms.") {
+		t.Errorf("Expected Secure Boot images, got %s %s", code, vars)
+	}
+}
+
+func TestCopyNVRAMTemplate(t *testing.T) {
+	dir := t.TempDir()
+	template := filepath.Join(dir, "OVMF_VARS.fd")
+	if err := os.WriteFile(template, []byte("pristine"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(dir, "vms", "uuid_VARS.fd")
+	if err := copyNVRAMTemplate(template, dst); err != nil {
+		t.Fatalf("copyNVRAMTemplate failed: %v", err)
+	}
+
+	// Overwrites corrupted state
+	os.WriteFile(dst, []byte("corrupted variable store"), 0644)
+	if err := copyNVRAMTemplate(template, dst); err != nil {
+		t.Fatalf("copyNVRAMTemplate failed: %v", err)
+	}
+	if data, _ := os.ReadFile(dst); string(data) != "pristine" {
+		t.Errorf("Expected template contents, got %q", data)
+	}
+
+	if err := copyNVRAMTemplate(filepath.Join(dir, "missing.fd"), dst); err == nil {
+		t.Error("Expected error for missing template")
+	}
+}
@@ -0,0 +1,139 @@
+package vm
+
+import (
+	"encoding/xml"
+	"fmt"
+	"time"
+)
+
+// domainGraphics is a <graphics> device of a domain. Port is the TCP port; with
+// autoport it is -1 in the inactive XML and filled in by libvirt once the VM runs.
+// Passwd is only present in the secure XML.
+type domainGraphics struct {
+	Type     string `xml:"type,attr"`
+	Port     string `xml:"port,attr"`
+	TLSPort  string `xml:"tlsPort,attr"`
+	AutoPort string `xml:"autoport,attr"`
+	Listen   string `xml:"listen,attr"`
+	Passwd   string `xml:"passwd,attr"`
+}
+
+// parseGraphics returns the <graphics> devices of a domain XML description.
+func parseGraphics(xmlDesc string) ([]domainGraphics, error) {
+	var domainXML struct {
+		Devices struct {
+			Graphics []domainGraphics `xml:"graphics"`
+		} `xml:"devices"`
+	}
+	if err := xml.Unmarshal([]byte(xmlDesc), &domainXML); err != nil {
+		return nil, fmt.Errorf("failed to parse VM XML: %w", err)
+	}
+	return domainXML.Devices.Graphics, nil
+}
+
+// consoleProtocol picks the graphical console protocol for a set of graphics devices:
+// vnc when present (existing clients expect it), else spice, else "" (headless).
+func consoleProtocol(graphics []domainGraphics) string {
+	protocol := ""
+	for _, g := range graphics {
+		switch g.Type {
+		case "vnc":
+			return "vnc"
+		case "spice":
+			protocol = "spice"
+		}
+	}
+	return protocol
+}
+
+// graphicsPort returns the assigned port of the first graphics device of type
+// graphicsType, or "" if it has none (yet).
+func graphicsPort(graphics []domainGraphics, graphicsType string) string {
+	for _, g := range graphics {
+		if g.Type == graphicsType && g.Port != "" && g.Port != "-1" {
+			return g.Port
+		}
+	}
+	return ""
+}
+
+// GetConsoleProtocol returns the graphical console protocol of a VM: vnc, spice,
+// or "" for a VM without graphics (use the serial console).
+func (s *VMService) GetConsoleProtocol(name string) (string, error) {
+	dom, err := s.lookupDomain(name)
+	if err != nil {
+		return "", fmt.Errorf("VM not found: %w", err)
+	}
+	defer safeFreeDomain(dom)
+
+	xmlDesc, err := dom.GetXMLDesc(0)
+	if err != nil {
+		return "", fmt.Errorf("failed to get VM XML: %w", err)
+	}
+	graphics, err := parseGraphics(xmlDesc)
+	if err != nil {
+		return "", err
+	}
+	return consoleProtocol(graphics), nil
+}
+
+// GetSPICEPort returns the SPICE port of a running VM. Right after start libvirt may
+// not have assigned the autoport (or QEMU may not be listening) yet, so this retries
+// with exponential backoff.
+func (s *VMService) GetSPICEPort(name string) (string, error) {
+	retryDelay := 200 * time.Millisecond
+	const maxRetries = 10
+	consoleAddr := s.ConsoleAddress(name)
+
+	for attempt := 0; attempt < maxRetries; attempt++ {
+		dom, err := s.lookupDomain(name)
+		if err != nil {
+			return "", fmt.Errorf("VM not found: %w", err)
+		}
+		active, err := dom.IsActive()
+		if err != nil {
+			safeFreeDomain(dom)
+			return "", fmt.Errorf("failed to check VM status: %w", err)
+		}
+		if !active {
+			safeFreeDomain(dom)
+			return "", fmt.Errorf("VM is not running")
+		}
+		xmlDesc, err := dom.GetXMLDesc(0)
+		safeFreeDomain(dom)
+		if err != nil {
+			return "", fmt.Errorf("failed to get VM XML: %w", err)
+		}
+
+		graphics, err := parseGraphics(xmlDesc)
+		if err != nil {
+			return "", err
+		}
+		if !hasGraphics(graphics, "spice") {
+			// Not configured - no need to retry
+			return "", fmt.Errorf("SPICE graphics not found in VM configuration")
+		}
+
+		if port := graphicsPort(graphics, "spice"); port != "" {
+			var portNum int
+			if _, err := fmt.Sscanf(port, "%d", &portNum); err == nil && s.verifyConsolePort(consoleAddr, portNum) {
+				return port, nil
+			}
+		}
+		if attempt < maxRetries-1 {
+			time.Sleep(retryDelay)
+			retryDelay = time.Duration(float64(retryDelay) * 1.5)
+		}
+	}
+	return "", fmt.Errorf("SPICE port not found after %d attempts", maxRetries)
+}
+
+// hasGraphics reports whether graphics includes a device of graphicsType.
+func hasGraphics(graphics []domainGraphics, graphicsType string) bool {
+	for _, g := range graphics {
+		if g.Type == graphicsType {
+			return true
+		}
+	}
+	return false
+}
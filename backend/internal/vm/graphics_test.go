@@ -0,0 +1,34 @@
+package vm
+
+import "testing"
+
+func TestParseGraphics(t *testing.T) {
+	tests := []struct {
+		name      string
+		xml       string
+		protocol  string
+		spicePort string
+	}{
+		{"vnc", `<domain><devices><graphics type='vnc' port='5900' autoport='yes'/></devices></domain>`, "vnc", ""},
+		{"spice running", `<domain><devices><graphics type='spice' port='5901' tlsPort='-1' autoport='yes'/></devices></domain>`, "spice", "5901"},
+		{"spice autoport", `<domain><devices><graphics type='spice' port='-1' autoport='yes'/></devices></domain>`, "spice", ""},
+		{"vnc preferred", `<domain><devices><graphics type='spice' port='5901'/><graphics type='vnc' port='5900'/></devices></domain>`, "vnc", "5901"},
+		{"headless", `<domain><devices><serial type='pty'/></devices></domain>`, "", ""},
+	}
+	for _, tt := range tests {
+		graphics, err := parseGraphics(tt.xml)
+		if err != nil {
+			t.Fatalf("%s: parseGraphics() error = %v", tt.name, err)
+		}
+		if got := consoleProtocol(graphics); got != tt.protocol {
+			t.Errorf("%s: consoleProtocol() = %q, want %q", tt.name, got, tt.protocol)
+		}
+		if got := graphicsPort(graphics, "spice"); got != tt.spicePort {
+			t.Errorf("%s: graphicsPort(spice) = %q, want %q", tt.name, got, tt.spicePort)
+		}
+	}
+
+	if _, err := parseGraphics("<domain"); err == nil {
+		t.Error("parseGraphics() accepted invalid XML")
+	}
+}
@@ -0,0 +1,358 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	apperrors "github.com/DARC0625/LIMEN/backend/internal/errors"
+	"github.com/DARC0625/LIMEN/backend/internal/hardware"
+	"github.com/DARC0625/LIMEN/backend/internal/logger"
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// DefaultHostName is the name of the host record for the server's own LIBVIRT_URI.
+const DefaultHostName = "local"
+
+// ErrHostUnavailable is returned when a host's libvirt daemon can't be reached.
+var ErrHostUnavailable = errors.New("host unavailable")
+
+// ErrConsoleUnreachable is returned for consoles of VMs on another host whose console
+// servers only listen on loopback: dialing that address would reach this server.
+var ErrConsoleUnreachable = errors.New("the host's console servers aren't reachable from this server")
+
+// ErrStorageNotShared is returned when a VM would be created on a host that doesn't see
+// the disk, NVRAM and ISO this server writes for it.
+var ErrStorageNotShared = errors.New("host doesn't share this server's VM storage")
+
+var errNotConnected = errors.New("not connected")
+
+// HostPool holds one libvirt connection per compute host. Connections are opened on
+// first use and reopened when they die; the default host's connection is opened at
+// startup by NewVMService. While the supervisor has a host in an outage, its
+// connection is left to the supervisor and operations on the host fail fast.
+type HostPool struct {
+	db        *gorm.DB
+	newDriver func() LibvirtDriver
+
+	mu        sync.Mutex
+	drivers   map[uint]LibvirtDriver
+	defaultID uint
+	outages   map[uint]*hostOutage
+}
+
+// hostOutage is a host whose connection the supervisor found dead.
+type hostOutage struct {
+	name     string
+	since    time.Time
+	lastErr  error
+	attempts int // Failed reconnection attempts
+}
+
+// err is returned by operations on the host during the outage.
+func (o *hostOutage) err() error {
+	return apperrors.NewAppError(apperrors.ErrCodeLibvirtConnection, "Libvirt connection is down, retry later", http.StatusServiceUnavailable).
+		WithCause(fmt.Errorf("%w: %s: %v", ErrHostUnavailable, o.name, o.lastErr))
+}
+
+// IsConnectionError reports whether err comes from a host's libvirt connection being
+// down, as opposed to the operation failing.
+func IsConnectionError(err error) bool {
+	var appErr *apperrors.AppError
+	return errors.As(err, &appErr) && appErr.Code == apperrors.ErrCodeLibvirtConnection
+}
+
+func newHostPool(db *gorm.DB, newDriver func() LibvirtDriver) *HostPool {
+	return &HostPool{
+		db:        db,
+		newDriver: newDriver,
+		drivers:   make(map[uint]LibvirtDriver),
+		outages:   make(map[uint]*hostOutage),
+	}
+}
+
+// setDefault registers the connected driver of the default host, creating or updating
+// its host record.
+func (p *HostPool) setDefault(uri string, driver LibvirtDriver) {
+	host := models.Host{Name: DefaultHostName}
+	if err := p.db.Where(models.Host{Name: DefaultHostName}).Assign(models.Host{URI: uri}).FirstOrCreate(&host).Error; err != nil {
+		logger.Log.Warn("Failed to register default host", zap.Error(err))
+	}
+
+	p.mu.Lock()
+	p.defaultID = host.ID
+	p.drivers[host.ID] = driver
+	p.mu.Unlock()
+
+	p.refresh(&host, driver)
+}
+
+// DefaultHostID returns the ID of the default host.
+func (p *HostPool) DefaultHostID() uint {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.defaultID
+}
+
+// resolve maps host ID 0 (VMs created before hosts existed) to the default host.
+func (p *HostPool) resolve(hostID uint) uint {
+	if hostID == 0 {
+		return p.DefaultHostID()
+	}
+	return hostID
+}
+
+// Driver returns the connection to a host, connecting if needed. During an outage it
+// fails right away with an ErrCodeLibvirtConnection error that wraps ErrHostUnavailable.
+func (p *HostPool) Driver(hostID uint) (LibvirtDriver, error) {
+	hostID = p.resolve(hostID)
+
+	p.mu.Lock()
+	outage := p.outages[hostID]
+	var err error
+	if outage != nil {
+		err = outage.err()
+	}
+	p.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return p.connect(hostID)
+}
+
+// connect returns the connection to a host, connecting if it has none or it died.
+func (p *HostPool) connect(hostID uint) (LibvirtDriver, error) {
+	p.mu.Lock()
+	current, ok := p.drivers[hostID]
+	p.mu.Unlock()
+	if ok && current.IsAlive() {
+		return current, nil
+	}
+
+	var host models.Host
+	if err := p.db.First(&host, hostID).Error; err != nil {
+		if ok {
+			// No record (e.g. the default host couldn't be registered): keep what we have
+			return current, nil
+		}
+		return nil, fmt.Errorf("host %d not found: %w", hostID, err)
+	}
+
+	// Connect outside the lock: remote connections can take seconds
+	driver := p.newDriver()
+	if err := driver.Connect(host.URI); err != nil {
+		p.db.Model(&host).Update("status", models.HostStatusOffline)
+		return nil, fmt.Errorf("%w: %s: %v", ErrHostUnavailable, host.Name, err)
+	}
+
+	p.mu.Lock()
+	if existing, ok := p.drivers[hostID]; ok && existing != current && existing.IsAlive() {
+		// Another caller reconnected first
+		p.mu.Unlock()
+		driver.Close()
+		return existing, nil
+	}
+	p.drivers[hostID] = driver
+	p.mu.Unlock()
+	if current != nil {
+		current.Close()
+	}
+
+	logger.Log.Info("Connected to host", zap.String("host", host.Name), zap.String("uri", host.URI))
+	p.refresh(&host, driver)
+	return driver, nil
+}
+
+// refresh records a host as online with the capacity its libvirt reports.
+func (p *HostPool) refresh(host *models.Host, driver LibvirtDriver) {
+	if host.ID == 0 {
+		return
+	}
+	now := time.Now()
+	updates := map[string]interface{}{"status": models.HostStatusOnline, "last_seen_at": now}
+	if resources, err := driver.NodeResources(); err == nil {
+		updates["cpus"] = resources.CPUs
+		updates["memory_mb"] = resources.MemoryMB
+	} else {
+		logger.Log.Warn("Failed to read host resources", zap.String("host", host.Name), zap.Error(err))
+	}
+	if err := p.db.Model(host).Updates(updates).Error; err != nil {
+		logger.Log.Warn("Failed to update host", zap.String("host", host.Name), zap.Error(err))
+	}
+}
+
+// Disconnect closes and forgets a host's connection, e.g. after its URI changed.
+func (p *HostPool) Disconnect(hostID uint) {
+	p.mu.Lock()
+	driver, ok := p.drivers[hostID]
+	if ok && hostID != p.defaultID {
+		delete(p.drivers, hostID)
+	}
+	p.mu.Unlock()
+	if ok && hostID != p.defaultID {
+		driver.Close()
+	}
+}
+
+// IsAlive reports whether the default host's connection is alive.
+func (p *HostPool) IsAlive() bool {
+	p.mu.Lock()
+	driver, ok := p.drivers[p.defaultID]
+	_, down := p.outages[p.defaultID]
+	p.mu.Unlock()
+	return ok && !down && driver.IsAlive()
+}
+
+// probe checks a host's connection with a round trip to its libvirt daemon: a dead
+// connection may only be noticed on its next call.
+func (p *HostPool) probe(hostID uint) error {
+	p.mu.Lock()
+	driver, ok := p.drivers[hostID]
+	p.mu.Unlock()
+	if !ok {
+		return errNotConnected
+	}
+	if !driver.IsAlive() {
+		return errors.New("connection closed")
+	}
+	_, err := driver.NodeResources()
+	return err
+}
+
+// HostConnection is the state of a host's libvirt connection.
+type HostConnection struct {
+	Connected         bool       `json:"connected"`
+	DownSince         *time.Time `json:"down_since,omitempty"` // Start of the outage, while reconnecting
+	LastError         string     `json:"last_error,omitempty"`
+	ReconnectAttempts int        `json:"reconnect_attempts,omitempty"`
+}
+
+// Connection returns the state of a host's libvirt connection.
+func (p *HostPool) Connection(hostID uint) HostConnection {
+	hostID = p.resolve(hostID)
+	p.mu.Lock()
+	driver, ok := p.drivers[hostID]
+	outage := p.outages[hostID]
+	p.mu.Unlock()
+	if outage != nil {
+		since := outage.since
+		conn := HostConnection{DownSince: &since, ReconnectAttempts: outage.attempts}
+		if outage.lastErr != nil {
+			conn.LastError = outage.lastErr.Error()
+		}
+		return conn
+	}
+	return HostConnection{Connected: ok && driver.IsAlive()}
+}
+
+// Close closes all connections.
+func (p *HostPool) Close() {
+	p.mu.Lock()
+	drivers := p.drivers
+	p.drivers = make(map[uint]LibvirtDriver)
+	p.mu.Unlock()
+	for _, driver := range drivers {
+		driver.Close()
+	}
+}
+
+// Hosts returns the VM service's host pool.
+func (s *VMService) Hosts() *HostPool {
+	return s.hosts
+}
+
+// hostIDOf returns the host a VM is placed on (0 if the VM has no record).
+func (s *VMService) hostIDOf(name string) uint {
+	var vmRec models.VM
+	if err := s.db.Select("host_id").Where("name = ?", name).First(&vmRec).Error; err != nil {
+		return 0
+	}
+	return vmRec.HostID
+}
+
+// driverFor returns the connection to the host VM name is placed on.
+func (s *VMService) driverFor(name string) (LibvirtDriver, error) {
+	return s.hosts.Driver(s.hostIDOf(name))
+}
+
+// lookupDomain looks up a domain on the host its VM is placed on.
+func (s *VMService) lookupDomain(name string) (Domain, error) {
+	driver, err := s.driverFor(name)
+	if err != nil {
+		return nil, err
+	}
+	return driver.LookupDomainByName(name)
+}
+
+// defineDomain (re)defines a VM's domain on the host it is placed on.
+func (s *VMService) defineDomain(name, xmlDesc string) (Domain, error) {
+	driver, err := s.driverFor(name)
+	if err != nil {
+		return nil, err
+	}
+	return driver.DomainDefineXML(xmlDesc)
+}
+
+// HostCPUInfo returns the CPU topology of a host, or nil if it is unknown. Only the default
+// host - the one this server runs on - is detected, so placement on other hosts can't be
+// validated and CPUConfig.Validate rejects it.
+func (s *VMService) HostCPUInfo(hostID uint) *hardware.CPUInfo {
+	if s.hosts.resolve(hostID) != s.hosts.DefaultHostID() {
+		return nil
+	}
+	spec := hardware.GetCurrentSpec()
+	if spec == nil {
+		return nil
+	}
+	return &spec.CPU
+}
+
+// checkSharedStorage returns ErrStorageNotShared unless hostID sees the VM files this
+// server writes: it is the default host, or declares shared storage.
+func (s *VMService) checkSharedStorage(hostID uint) error {
+	hostID = s.hosts.resolve(hostID)
+	if hostID == s.hosts.DefaultHostID() {
+		return nil
+	}
+	var host models.Host
+	if err := s.db.First(&host, hostID).Error; err != nil {
+		return fmt.Errorf("host not found: %w", err)
+	}
+	if !host.SharedStorage {
+		return fmt.Errorf("%w: %s", ErrStorageNotShared, host.Name)
+	}
+	return nil
+}
+
+// ConsoleAddress returns the address the console servers of VM name listen on.
+func (s *VMService) ConsoleAddress(name string) string {
+	return s.hostConsoleAddress(s.hostIDOf(name))
+}
+
+// ConsoleDialAddress returns the address the console proxy dials for the console servers
+// of VM name, and whether they are on another host, reached over the network.
+func (s *VMService) ConsoleDialAddress(name string) (addr string, remote bool, err error) {
+	hostID := s.hosts.resolve(s.hostIDOf(name))
+	addr = s.hostConsoleAddress(hostID)
+	if hostID == s.hosts.DefaultHostID() {
+		return addr, false, nil
+	}
+	if ip := net.ParseIP(addr); ip == nil || ip.IsLoopback() {
+		return "", false, ErrConsoleUnreachable
+	}
+	return addr, true, nil
+}
+
+// hostConsoleAddress returns the address VM console servers on a host listen on.
+func (s *VMService) hostConsoleAddress(hostID uint) string {
+	var host models.Host
+	if err := s.db.First(&host, s.hosts.resolve(hostID)).Error; err != nil || host.ConsoleAddress == "" {
+		return consoleListenAddress
+	}
+	return host.ConsoleAddress
+}
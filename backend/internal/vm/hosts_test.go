@@ -0,0 +1,106 @@
+package vm
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+)
+
+const testDomainXML = `<domain type='kvm'><name>web</name><devices>
+    <graphics type='vnc' port='-1' autoport='yes' listen='127.0.0.1'/>
+  </devices></domain>`
+
+func TestHostPool_RoutesToVMHost(t *testing.T) {
+	cluster := newFakeCluster()
+	cluster.addHost(fakeLocalURI, 8, 16384)
+	cluster.addHost("qemu+tls://node-2/system", 16, 32768)
+	s := newFakeVMService(t, cluster)
+
+	node2 := models.Host{Name: "node-2", URI: "qemu+tls://node-2/system", ConsoleAddress: "10.0.0.2"}
+	s.db.Create(&node2)
+	s.db.Create(&models.VM{Name: "web", CPU: 1, Memory: 1024, HostID: node2.ID})
+
+	if _, err := s.defineDomain("web", testDomainXML); err != nil {
+		t.Fatalf("defineDomain() error = %v", err)
+	}
+	if cluster.domain("qemu+tls://node-2/system", "web") == nil || cluster.domain(fakeLocalURI, "web") != nil {
+		t.Fatal("domain was not defined on the VM's host only")
+	}
+
+	if protocol, err := s.GetConsoleProtocol("web"); err != nil || protocol != "vnc" {
+		t.Errorf("GetConsoleProtocol() = %q, %v", protocol, err)
+	}
+	if addr := s.ConsoleAddress("web"); addr != "10.0.0.2" {
+		t.Errorf("ConsoleAddress() = %q, want the host's console address", addr)
+	}
+	if addr, remote, err := s.ConsoleDialAddress("web"); err != nil || addr != "10.0.0.2" || !remote {
+		t.Errorf("ConsoleDialAddress() = %q, %v, %v; want the host's console address, remote", addr, remote, err)
+	}
+	s.db.Model(&node2).Update("console_address", "127.0.0.1")
+	if _, _, err := s.ConsoleDialAddress("web"); !errors.Is(err, ErrConsoleUnreachable) {
+		t.Errorf("ConsoleDialAddress() with a loopback address on another host error = %v, want ErrConsoleUnreachable", err)
+	}
+	s.db.Model(&node2).Update("console_address", "10.0.0.2")
+	if err := s.rotateConsolePassword("web"); err != nil {
+		t.Fatalf("rotateConsolePassword() error = %v", err)
+	}
+	if xml := cluster.domain("qemu+tls://node-2/system", "web").xml; !strings.Contains(xml, "listen='10.0.0.2'") {
+		t.Errorf("console not bound to the host's console address:\n%s", xml)
+	}
+
+	if err := s.checkSharedStorage(node2.ID); !errors.Is(err, ErrStorageNotShared) {
+		t.Errorf("checkSharedStorage() of a host without shared storage error = %v, want ErrStorageNotShared", err)
+	}
+	s.db.Model(&node2).Update("shared_storage", true)
+	if err := s.checkSharedStorage(node2.ID); err != nil {
+		t.Errorf("checkSharedStorage() of a host with shared storage error = %v", err)
+	}
+
+	if s.HostCPUInfo(node2.ID) != nil {
+		t.Error("HostCPUInfo() of a remote host should be unknown, not this server's CPUs")
+	}
+
+	var stored models.Host
+	s.db.First(&stored, node2.ID)
+	if stored.Status != models.HostStatusOnline || stored.CPUs != 16 || stored.MemoryMB != 32768 || stored.LastSeenAt == nil {
+		t.Errorf("host after connect = %+v", stored)
+	}
+}
+
+func TestHostPool_Reconnects(t *testing.T) {
+	const uri = "qemu+ssh://node-2/system"
+	cluster := newFakeCluster()
+	cluster.addHost(fakeLocalURI, 8, 16384)
+	cluster.addHost(uri, 8, 16384)
+	s := newFakeVMService(t, cluster)
+
+	node2 := models.Host{Name: "node-2", URI: uri}
+	s.db.Create(&node2)
+	first, err := s.hosts.Driver(node2.ID)
+	if err != nil {
+		t.Fatalf("Driver() error = %v", err)
+	}
+
+	cluster.setDown(uri, true)
+	if _, err := s.hosts.Driver(node2.ID); !errors.Is(err, ErrHostUnavailable) {
+		t.Fatalf("Driver() on a down host error = %v, want ErrHostUnavailable", err)
+	}
+	var stored models.Host
+	s.db.First(&stored, node2.ID)
+	if stored.Status != models.HostStatusOffline {
+		t.Errorf("status = %q, want offline", stored.Status)
+	}
+
+	cluster.setDown(uri, false)
+	second, err := s.hosts.Driver(node2.ID)
+	if err != nil || second == first {
+		t.Errorf("Driver() after recovery = %v, %v; want a new connection", second, err)
+	}
+
+	// VMs without a host use the default connection
+	if driver, err := s.hosts.Driver(0); err != nil || driver.(*fakeDriver).host != cluster.hosts[fakeLocalURI] {
+		t.Errorf("Driver(0) = %v, %v; want the default host", driver, err)
+	}
+}
@@ -0,0 +1,80 @@
+//go:build libvirt
+// +build libvirt
+
+package vm
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	libvirt "github.com/libvirt/libvirt-go"
+)
+
+// libvirtConsoleStream adapts a stream opened by virDomainOpenConsole to io.ReadWriteCloser.
+type libvirtConsoleStream struct {
+	stream    *libvirt.Stream
+	closeOnce sync.Once
+}
+
+func (d *libvirtDriver) OpenConsole(name, devName string, force bool) (io.ReadWriteCloser, error) {
+	if d.conn == nil {
+		return nil, fmt.Errorf("not connected to libvirt")
+	}
+	dom, err := d.conn.LookupDomainByName(name)
+	if err != nil {
+		return nil, err
+	}
+	defer dom.Free()
+
+	stream, err := d.conn.NewStream(0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stream: %w", err)
+	}
+	flags := libvirt.DOMAIN_CONSOLE_SAFE
+	if force {
+		flags |= libvirt.DOMAIN_CONSOLE_FORCE
+	}
+	if err := dom.OpenConsole(devName, stream, flags); err != nil {
+		stream.Free()
+		return nil, fmt.Errorf("failed to open console %s: %w", devName, err)
+	}
+	return &libvirtConsoleStream{stream: stream}, nil
+}
+
+func (s *libvirtConsoleStream) Read(p []byte) (int, error) {
+	n, err := s.stream.Recv(p)
+	if err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+func (s *libvirtConsoleStream) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		n, err := s.stream.Send(p[written:])
+		if err != nil {
+			return written, err
+		}
+		written += n
+	}
+	return written, nil
+}
+
+// Close aborts the stream, which also unblocks a pending Read.
+func (s *libvirtConsoleStream) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		err = s.stream.Abort()
+		s.stream.Free()
+	})
+	return err
+}
+
+func (d *libvirtDomain) QemuMonitorCommand(command string) (string, error) {
+	return d.dom.QemuMonitorCommand(command, libvirt.DOMAIN_QEMU_MONITOR_COMMAND_DEFAULT)
+}
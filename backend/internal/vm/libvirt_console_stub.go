@@ -0,0 +1,14 @@
+//go:build !libvirt
+// +build !libvirt
+
+package vm
+
+import "io"
+
+func (d *stubDriver) OpenConsole(name, devName string, force bool) (io.ReadWriteCloser, error) {
+	return nil, ErrLibvirtDisabled
+}
+
+func (d *stubDomain) QemuMonitorCommand(command string) (string, error) {
+	return "", ErrLibvirtDisabled
+}
@@ -72,6 +72,17 @@ func (d *libvirtDriver) DomainDefineXML(xml string) (Domain, error) {
 	return &libvirtDomain{dom: dom}, nil
 }
 
+func (d *libvirtDriver) NodeResources() (NodeResources, error) {
+	if d.conn == nil {
+		return NodeResources{}, fmt.Errorf("not connected to libvirt")
+	}
+	info, err := d.conn.GetNodeInfo()
+	if err != nil {
+		return NodeResources{}, err
+	}
+	return NodeResources{CPUs: int(info.Cpus), MemoryMB: int(info.Memory / 1024)}, nil
+}
+
 func (d *libvirtDriver) Domain() Domain {
 	if d.dom == nil {
 		return nil
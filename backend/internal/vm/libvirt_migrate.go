@@ -0,0 +1,39 @@
+//go:build libvirt
+// +build libvirt
+
+package vm
+
+import (
+	"fmt"
+
+	libvirt "github.com/libvirt/libvirt-go"
+)
+
+func (d *libvirtDomain) Migrate(dest LibvirtDriver, params MigrateParams, flags uint32) error {
+	destDriver, ok := dest.(*libvirtDriver)
+	if !ok || destDriver.conn == nil {
+		return fmt.Errorf("destination not connected to libvirt")
+	}
+	migrateParams := &libvirt.DomainMigrateParameters{}
+	if params.DestXML != "" {
+		migrateParams.DestXMLSet = true
+		migrateParams.DestXML = params.DestXML
+	}
+	if params.PersistXML != "" {
+		migrateParams.PersistXMLSet = true
+		migrateParams.PersistXML = params.PersistXML
+	}
+	migrated, err := d.dom.Migrate3(destDriver.conn, migrateParams, libvirt.DomainMigrateFlags(flags))
+	if err != nil {
+		return err
+	}
+	return migrated.Free()
+}
+
+func (d *libvirtDomain) GetJobProgress() (JobProgress, error) {
+	info, err := d.dom.GetJobInfo()
+	if err != nil {
+		return JobProgress{}, err
+	}
+	return JobProgress{DataTotal: info.DataTotal, DataProcessed: info.DataProcessed, DataRemaining: info.DataRemaining}, nil
+}
@@ -0,0 +1,12 @@
+//go:build !libvirt
+// +build !libvirt
+
+package vm
+
+func (d *stubDomain) Migrate(dest LibvirtDriver, params MigrateParams, flags uint32) error {
+	return ErrLibvirtDisabled
+}
+
+func (d *stubDomain) GetJobProgress() (JobProgress, error) {
+	return JobProgress{}, ErrLibvirtDisabled
+}
@@ -40,6 +40,10 @@ func (d *stubDriver) DomainDefineXML(xml string) (Domain, error) {
 	return nil, ErrLibvirtDisabled
 }
 
+func (d *stubDriver) NodeResources() (NodeResources, error) {
+	return NodeResources{}, ErrLibvirtDisabled
+}
+
 func (d *stubDriver) Domain() Domain {
 	return &stubDomain{}
 }
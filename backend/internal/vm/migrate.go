@@ -0,0 +1,350 @@
+package vm
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/DARC0625/LIMEN/backend/internal/logger"
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"go.uber.org/zap"
+)
+
+// A running VM is migrated live: libvirt copies its memory (and its disks when the
+// hosts don't share storage) while it keeps running, then switches it over. A stopped
+// VM only has its definition moved, which requires shared storage. Either way the VM's
+// host_id changes only once the VM is on the destination; a failed migration leaves it
+// on the source.
+
+var (
+	// ErrMigrationInProgress is returned when a VM is already being migrated.
+	ErrMigrationInProgress = errors.New("VM is already being migrated")
+	// ErrCopyStorageOffline is returned when storage copy is requested for a stopped VM.
+	ErrCopyStorageOffline = errors.New("copying storage requires a running VM")
+	// ErrCopyStorageUnsupported is returned when storage copy is requested for a VM with
+	// files libvirt doesn't copy.
+	ErrCopyStorageUnsupported = errors.New("storage can't be copied for this VM")
+)
+
+// migrationProgressInterval is how often the progress of a live migration is reported.
+const migrationProgressInterval = time.Second
+
+// MigrationStatus is the state of a migration.
+type MigrationStatus string
+
+const (
+	MigrationRunning   MigrationStatus = "running"
+	MigrationCompleted MigrationStatus = "completed"
+	MigrationFailed    MigrationStatus = "failed"
+)
+
+// MigrationProgress reports the state of a migration.
+type MigrationProgress struct {
+	Status        MigrationStatus `json:"status"`
+	SourceHostID  uint            `json:"source_host_id"`
+	DestHostID    uint            `json:"dest_host_id"`
+	DataTotal     uint64          `json:"data_total"` // Bytes to transfer: memory, plus disks when copying storage
+	DataProcessed uint64          `json:"data_processed"`
+	DataRemaining uint64          `json:"data_remaining"`
+	Error         string          `json:"error,omitempty"`
+}
+
+// MigrateOptions are the options of a migration.
+type MigrateOptions struct {
+	// Copy the VM's disks: the hosts don't share storage. libvirt only creates the disk
+	// files on the destination if its VM directory is a storage pool there, and never
+	// copies UEFI NVRAM, TPM state or an inserted ISO, so VMs with those are refused.
+	CopyStorage bool
+}
+
+// copyStorageBlocker returns why the storage of the domain described by xmlDesc can't
+// be copied by libvirt, or "" if it can.
+func copyStorageBlocker(xmlDesc string) (string, error) {
+	var domainXML struct {
+		OS struct {
+			NVRAM string `xml:"nvram"`
+		} `xml:"os"`
+		Devices struct {
+			TPM   []struct{} `xml:"tpm"`
+			Disks []struct {
+				Device string `xml:"device,attr"`
+				Source struct {
+					File string `xml:"file,attr"`
+				} `xml:"source"`
+			} `xml:"disk"`
+		} `xml:"devices"`
+	}
+	if err := xml.Unmarshal([]byte(xmlDesc), &domainXML); err != nil {
+		return "", fmt.Errorf("failed to parse VM XML: %w", err)
+	}
+	switch {
+	case domainXML.OS.NVRAM != "":
+		return "its UEFI NVRAM isn't copied", nil
+	case len(domainXML.Devices.TPM) > 0:
+		return "its TPM state isn't copied", nil
+	}
+	for _, disk := range domainXML.Devices.Disks {
+		if disk.Device == "cdrom" && disk.Source.File != "" {
+			return "the inserted ISO isn't copied; eject it first", nil
+		}
+	}
+	return "", nil
+}
+
+// Migration is a planned move of a VM to another host. BeginMigration plans it and Run
+// performs it.
+type Migration struct {
+	VMName      string      `json:"vm_name"`
+	Source      models.Host `json:"source"`
+	Dest        models.Host `json:"dest"`
+	Live        bool        `json:"live"` // The VM is running; otherwise only its definition moves
+	CopyStorage bool        `json:"copy_storage"`
+
+	s *VMService
+}
+
+// BeginMigration plans the migration of VM name to host hostID (0 = the host the
+// scheduler picks). The destination must be able to take the VM like a new one. Until
+// Run returns, other migrations of the VM fail with ErrMigrationInProgress.
+func (s *VMService) BeginMigration(name string, hostID uint, opts MigrateOptions) (*Migration, error) {
+	if _, busy := s.migrating.Load(name); busy {
+		return nil, ErrMigrationInProgress
+	}
+
+	var vmRec models.VM
+	if err := s.db.Where("name = ?", name).First(&vmRec).Error; err != nil {
+		return nil, fmt.Errorf("VM not found: %w", err)
+	}
+	var source models.Host
+	if err := s.db.First(&source, s.hosts.resolve(vmRec.HostID)).Error; err != nil {
+		return nil, fmt.Errorf("source host not found: %w", err)
+	}
+	if hostID != 0 && s.hosts.resolve(hostID) == source.ID {
+		return nil, fmt.Errorf("%w: the VM is already on %s", ErrNoHostAvailable, source.Name)
+	}
+	dest, err := s.PlaceVM(PlacementRequest{
+		VCPU:              vmRec.CPU,
+		MemoryMB:          vmRec.Memory,
+		Tags:              models.SplitTags(vmRec.HostTags),
+		AntiAffinityGroup: vmRec.AntiAffinityGroup,
+		HostID:            hostID,
+		ExcludeHostID:     source.ID,
+		SharedStorage:     !opts.CopyStorage,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	dom, err := s.lookupDomain(name)
+	if err != nil {
+		return nil, fmt.Errorf("VM not found: %w", err)
+	}
+	defer safeFreeDomain(dom)
+	active, err := dom.IsActive()
+	if err != nil {
+		return nil, fmt.Errorf("failed to check VM status: %w", err)
+	}
+	if !active && opts.CopyStorage {
+		return nil, ErrCopyStorageOffline
+	}
+	if opts.CopyStorage {
+		xmlDesc, err := dom.GetXMLDesc(0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get VM XML: %w", err)
+		}
+		if reason, err := copyStorageBlocker(xmlDesc); err != nil {
+			return nil, err
+		} else if reason != "" {
+			return nil, fmt.Errorf("%w: %s", ErrCopyStorageUnsupported, reason)
+		}
+	}
+
+	if _, busy := s.migrating.LoadOrStore(name, struct{}{}); busy {
+		return nil, ErrMigrationInProgress
+	}
+	return &Migration{VMName: name, Source: source, Dest: *dest, Live: active, CopyStorage: opts.CopyStorage, s: s}, nil
+}
+
+// Run performs the migration, reporting its progress to progress (which may be nil)
+// until a final "completed" or "failed" report.
+func (m *Migration) Run(progress func(MigrationProgress)) error {
+	defer m.s.migrating.Delete(m.VMName)
+
+	report := func(p MigrationProgress) {
+		p.SourceHostID = m.Source.ID
+		p.DestHostID = m.Dest.ID
+		if progress != nil {
+			progress(p)
+		}
+	}
+	report(MigrationProgress{Status: MigrationRunning})
+
+	if err := m.run(report); err != nil {
+		logger.Log.Error("VM migration failed", zap.String("vm_name", m.VMName),
+			zap.String("source", m.Source.Name), zap.String("dest", m.Dest.Name), zap.Error(err))
+		report(MigrationProgress{Status: MigrationFailed, Error: err.Error()})
+		return err
+	}
+	logger.Log.Info("VM migrated", zap.String("vm_name", m.VMName),
+		zap.String("source", m.Source.Name), zap.String("dest", m.Dest.Name), zap.Bool("live", m.Live))
+	report(MigrationProgress{Status: MigrationCompleted})
+	return nil
+}
+
+func (m *Migration) run(report func(MigrationProgress)) error {
+	source, err := m.s.hosts.Driver(m.Source.ID)
+	if err != nil {
+		return err
+	}
+	dest, err := m.s.hosts.Driver(m.Dest.ID)
+	if err != nil {
+		return err
+	}
+	dom, err := source.LookupDomainByName(m.VMName)
+	if err != nil {
+		return fmt.Errorf("VM not found on %s: %w", m.Source.Name, err)
+	}
+	defer safeFreeDomain(dom)
+
+	// The VM may have been started or stopped since the migration was planned
+	active, err := dom.IsActive()
+	if err != nil {
+		return fmt.Errorf("failed to check VM status: %w", err)
+	}
+	if !active && m.CopyStorage {
+		return ErrCopyStorageOffline
+	}
+	m.Live = active
+
+	persistXML, err := dom.GetXMLDesc(DomainXMLInactive | DomainXMLSecure | DomainXMLMigratable)
+	if err != nil {
+		return fmt.Errorf("failed to get VM XML: %w", err)
+	}
+	// Consoles listen on the destination's console address
+	listen := m.s.hostConsoleAddress(m.Dest.ID)
+	if !m.Live {
+		return m.moveDefinition(dom, dest, secureGraphicsXML(persistXML, listen, ""))
+	}
+
+	liveXML, err := dom.GetXMLDesc(DomainXMLSecure | DomainXMLMigratable)
+	if err != nil {
+		return fmt.Errorf("failed to get VM XML: %w", err)
+	}
+	flags := MigrateLive | MigratePersistDest | MigrateUndefineSource | MigrateAutoConverge | MigrateAbortOnError
+	if m.CopyStorage {
+		flags |= MigrateNonSharedDisk
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		m.watch(dom, done, report)
+	}()
+	err = dom.Migrate(dest, MigrateParams{
+		DestXML:    secureGraphicsXML(liveXML, listen, ""),
+		PersistXML: secureGraphicsXML(persistXML, listen, ""),
+	}, flags)
+	close(done)
+	wg.Wait()
+	if err != nil {
+		return m.settle(source, dest, persistXML, fmt.Errorf("live migration failed: %w", err))
+	}
+
+	if err := m.recordHost(); err != nil {
+		// The database would send every operation to the source: move the VM back
+		back, lookupErr := dest.LookupDomainByName(m.VMName)
+		if lookupErr != nil {
+			return fmt.Errorf("%w; VM left on %s: %v", err, m.Dest.Name, lookupErr)
+		}
+		defer safeFreeDomain(back)
+		if backErr := back.Migrate(source, MigrateParams{DestXML: liveXML, PersistXML: persistXML}, flags); backErr != nil {
+			return fmt.Errorf("%w; VM left on %s: %v", err, m.Dest.Name, backErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// watch reports the progress of the live migration of dom until done is closed.
+func (m *Migration) watch(dom Domain, done <-chan struct{}, report func(MigrationProgress)) {
+	ticker := time.NewTicker(migrationProgressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			job, err := dom.GetJobProgress()
+			if err != nil {
+				// The job may not have started yet or already ended
+				continue
+			}
+			report(MigrationProgress{
+				Status:        MigrationRunning,
+				DataTotal:     job.DataTotal,
+				DataProcessed: job.DataProcessed,
+				DataRemaining: job.DataRemaining,
+			})
+		}
+	}
+}
+
+// settle checks where a failed live migration left the VM. libvirt normally keeps it
+// running on the source; if it was switched over anyway, the migration succeeded. A VM
+// found on neither host is redefined on the source from persistXML.
+func (m *Migration) settle(source, dest LibvirtDriver, persistXML string, migrateErr error) error {
+	if dom, err := source.LookupDomainByName(m.VMName); err == nil {
+		safeFreeDomain(dom)
+		return migrateErr
+	}
+	if dom, err := dest.LookupDomainByName(m.VMName); err == nil {
+		defer safeFreeDomain(dom)
+		if active, _ := dom.IsActive(); active {
+			logger.Log.Warn("Migration reported an error but the VM runs on the destination",
+				zap.String("vm_name", m.VMName), zap.String("dest", m.Dest.Name), zap.Error(migrateErr))
+			return m.recordHost()
+		}
+		if err := dom.UndefineFlags(UndefineKeepNVRAM); err != nil {
+			logger.Log.Warn("Failed to remove VM left on the destination", zap.String("vm_name", m.VMName), zap.Error(err))
+		}
+	}
+	restored, err := source.DomainDefineXML(persistXML)
+	if err != nil {
+		return fmt.Errorf("%w; failed to restore VM on %s: %v", migrateErr, m.Source.Name, err)
+	}
+	safeFreeDomain(restored)
+	return migrateErr
+}
+
+// moveDefinition moves the definition of stopped VM dom to dest as persistXML.
+func (m *Migration) moveDefinition(dom Domain, dest LibvirtDriver, persistXML string) error {
+	moved, err := dest.DomainDefineXML(persistXML)
+	if err != nil {
+		return fmt.Errorf("failed to define VM on %s: %w", m.Dest.Name, err)
+	}
+	defer safeFreeDomain(moved)
+	if err := m.recordHost(); err != nil {
+		if undefErr := moved.UndefineFlags(UndefineKeepNVRAM); undefErr != nil {
+			logger.Log.Warn("Failed to remove VM from the destination", zap.String("vm_name", m.VMName), zap.Error(undefErr))
+		}
+		return err
+	}
+	// NVRAM and disks are on shared storage: keep them for the destination
+	if err := dom.UndefineFlags(UndefineKeepNVRAM); err != nil {
+		logger.Log.Warn("Failed to remove migrated VM from the source", zap.String("vm_name", m.VMName),
+			zap.String("source", m.Source.Name), zap.Error(err))
+	}
+	return nil
+}
+
+// recordHost places the VM on the destination in the database.
+func (m *Migration) recordHost() error {
+	if err := m.s.db.Model(&models.VM{}).Where("name = ?", m.VMName).Update("host_id", m.Dest.ID).Error; err != nil {
+		return fmt.Errorf("failed to record VM host: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,20 @@
+//go:build libvirt
+// +build libvirt
+
+package vm
+
+import libvirt "github.com/libvirt/libvirt-go"
+
+// Migration constants from libvirt
+var (
+	MigrateLive           uint32 = uint32(libvirt.MIGRATE_LIVE)
+	MigratePersistDest    uint32 = uint32(libvirt.MIGRATE_PERSIST_DEST)
+	MigrateUndefineSource uint32 = uint32(libvirt.MIGRATE_UNDEFINE_SOURCE)
+	MigrateNonSharedDisk  uint32 = uint32(libvirt.MIGRATE_NON_SHARED_DISK)
+	MigrateAutoConverge   uint32 = uint32(libvirt.MIGRATE_AUTO_CONVERGE)
+	MigrateAbortOnError   uint32 = uint32(libvirt.MIGRATE_ABORT_ON_ERROR)
+
+	DomainXMLSecure     uint32 = uint32(libvirt.DOMAIN_XML_SECURE)
+	DomainXMLInactive   uint32 = uint32(libvirt.DOMAIN_XML_INACTIVE)
+	DomainXMLMigratable uint32 = uint32(libvirt.DOMAIN_XML_MIGRATABLE)
+)
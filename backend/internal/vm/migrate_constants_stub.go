@@ -0,0 +1,18 @@
+//go:build !libvirt
+// +build !libvirt
+
+package vm
+
+// Migration constants stub (for !libvirt builds)
+var (
+	MigrateLive           uint32 = 0
+	MigratePersistDest    uint32 = 0
+	MigrateUndefineSource uint32 = 0
+	MigrateNonSharedDisk  uint32 = 0
+	MigrateAutoConverge   uint32 = 0
+	MigrateAbortOnError   uint32 = 0
+
+	DomainXMLSecure     uint32 = 0
+	DomainXMLInactive   uint32 = 0
+	DomainXMLMigratable uint32 = 0
+)
@@ -0,0 +1,168 @@
+package vm
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+)
+
+const node2URI = "qemu+tls://node-2/system"
+
+// newMigrationCluster returns a service with a second host, node-2, and VM "web" defined
+// on the default host.
+func newMigrationCluster(t *testing.T) (*fakeCluster, *VMService, models.Host) {
+	t.Helper()
+	cluster := newFakeCluster()
+	cluster.addHost(fakeLocalURI, 8, 16384)
+	cluster.addHost(node2URI, 8, 16384)
+	s := newFakeVMService(t, cluster)
+
+	node2 := models.Host{Name: "node-2", URI: node2URI, ConsoleAddress: "10.0.0.2", CPUOvercommit: 1, SharedStorage: true}
+	s.db.Create(&node2)
+	if _, err := s.hosts.Driver(node2.ID); err != nil {
+		t.Fatalf("Driver() error = %v", err)
+	}
+	s.db.Create(&models.VM{Name: "web", CPU: 2, Memory: 2048})
+	if _, err := s.defineDomain("web", testDomainXML); err != nil {
+		t.Fatalf("defineDomain() error = %v", err)
+	}
+	return cluster, s, node2
+}
+
+func runMigration(t *testing.T, m *Migration) ([]MigrationStatus, error) {
+	t.Helper()
+	var statuses []MigrationStatus
+	err := m.Run(func(p MigrationProgress) {
+		if p.SourceHostID != m.Source.ID || p.DestHostID != m.Dest.ID {
+			t.Errorf("progress hosts = %d -> %d, want %d -> %d", p.SourceHostID, p.DestHostID, m.Source.ID, m.Dest.ID)
+		}
+		statuses = append(statuses, p.Status)
+	})
+	return statuses, err
+}
+
+func TestMigrateVM_Live(t *testing.T) {
+	cluster, s, node2 := newMigrationCluster(t)
+	cluster.domain(fakeLocalURI, "web").Create()
+
+	m, err := s.BeginMigration("web", 0, MigrateOptions{})
+	if err != nil {
+		t.Fatalf("BeginMigration() error = %v", err)
+	}
+	if m.Dest.ID != node2.ID || !m.Live {
+		t.Fatalf("migration = %+v, want a live migration to node-2", m)
+	}
+	if _, err := s.BeginMigration("web", node2.ID, MigrateOptions{}); !errors.Is(err, ErrMigrationInProgress) {
+		t.Errorf("second BeginMigration() error = %v, want ErrMigrationInProgress", err)
+	}
+
+	statuses, err := runMigration(t, m)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if len(statuses) < 2 || statuses[len(statuses)-1] != MigrationCompleted {
+		t.Errorf("statuses = %v, want running ... completed", statuses)
+	}
+	moved := cluster.domain(node2URI, "web")
+	if moved == nil || !moved.active || cluster.domain(fakeLocalURI, "web") != nil {
+		t.Fatal("VM was not moved to node-2")
+	}
+	if !strings.Contains(moved.xml, "listen='10.0.0.2'") {
+		t.Errorf("console not bound to node-2's console address:\n%s", moved.xml)
+	}
+	if hostID := s.hostIDOf("web"); hostID != node2.ID {
+		t.Errorf("host_id = %d, want %d", hostID, node2.ID)
+	}
+
+	// The VM's own host is not a destination
+	if _, err := s.BeginMigration("web", node2.ID, MigrateOptions{}); !errors.Is(err, ErrNoHostAvailable) {
+		t.Errorf("BeginMigration() to the VM's host error = %v, want ErrNoHostAvailable", err)
+	}
+}
+
+func TestMigrateVM_FailureKeepsSource(t *testing.T) {
+	cluster, s, node2 := newMigrationCluster(t)
+	cluster.domain(fakeLocalURI, "web").Create()
+	cluster.hosts[node2URI].refuse = errors.New("unable to connect to the destination's migration port")
+
+	m, err := s.BeginMigration("web", node2.ID, MigrateOptions{CopyStorage: true})
+	if err != nil {
+		t.Fatalf("BeginMigration() error = %v", err)
+	}
+	statuses, err := runMigration(t, m)
+	if err == nil {
+		t.Fatal("Run() succeeded, want an error")
+	}
+	if statuses[len(statuses)-1] != MigrationFailed {
+		t.Errorf("statuses = %v, want running ... failed", statuses)
+	}
+	if dom := cluster.domain(fakeLocalURI, "web"); dom == nil || !dom.active || cluster.domain(node2URI, "web") != nil {
+		t.Error("failed migration did not leave the VM running on the source")
+	}
+	if hostID := s.hostIDOf("web"); hostID != 0 {
+		t.Errorf("host_id = %d after a failed migration, want it unchanged", hostID)
+	}
+
+	// The migration released the VM
+	if _, err := s.BeginMigration("web", node2.ID, MigrateOptions{}); err != nil {
+		t.Errorf("BeginMigration() after failure error = %v", err)
+	}
+}
+
+func TestMigrateVM_Stopped(t *testing.T) {
+	cluster, s, node2 := newMigrationCluster(t)
+
+	if _, err := s.BeginMigration("web", node2.ID, MigrateOptions{CopyStorage: true}); !errors.Is(err, ErrCopyStorageOffline) {
+		t.Errorf("BeginMigration() with storage copy error = %v, want ErrCopyStorageOffline", err)
+	}
+	s.db.Model(&node2).Update("shared_storage", false)
+	if _, err := s.BeginMigration("web", node2.ID, MigrateOptions{}); !errors.Is(err, ErrNoHostAvailable) {
+		t.Errorf("BeginMigration() to a host without shared storage error = %v, want ErrNoHostAvailable", err)
+	}
+	s.db.Model(&node2).Update("shared_storage", true)
+	m, err := s.BeginMigration("web", node2.ID, MigrateOptions{})
+	if err != nil || m.Live {
+		t.Fatalf("BeginMigration() = %+v, %v; want an offline migration", m, err)
+	}
+	if _, err := runMigration(t, m); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	moved := cluster.domain(node2URI, "web")
+	if moved == nil || moved.active || cluster.domain(fakeLocalURI, "web") != nil {
+		t.Fatal("stopped VM was not moved to node-2")
+	}
+	if !strings.Contains(moved.xml, "listen='10.0.0.2'") {
+		t.Errorf("console not bound to node-2's console address:\n%s", moved.xml)
+	}
+	if hostID := s.hostIDOf("web"); hostID != node2.ID {
+		t.Errorf("host_id = %d, want %d", hostID, node2.ID)
+	}
+}
+
+func TestMigrateVM_CopyStorageUnsupported(t *testing.T) {
+	tests := map[string]string{
+		"nvram": `<domain><os><nvram>/var/lib/limen/vms/web_VARS.fd</nvram></os><devices/></domain>`,
+		"tpm":   `<domain><devices><tpm model='tpm-crb'><backend type='emulator' version='2.0'/></tpm></devices></domain>`,
+		"iso": `<domain><devices><disk type='file' device='cdrom'><source file='/isos/ubuntu.iso'/></disk>` +
+			`</devices></domain>`,
+	}
+	for name, xmlDesc := range tests {
+		cluster, s, node2 := newMigrationCluster(t)
+		dom := cluster.domain(fakeLocalURI, "web")
+		dom.xml = xmlDesc
+		dom.Create()
+		if _, err := s.BeginMigration("web", node2.ID, MigrateOptions{CopyStorage: true}); !errors.Is(err, ErrCopyStorageUnsupported) {
+			t.Errorf("%s: BeginMigration() with storage copy error = %v, want ErrCopyStorageUnsupported", name, err)
+		}
+		if _, err := s.BeginMigration("web", node2.ID, MigrateOptions{}); err != nil {
+			t.Errorf("%s: BeginMigration() on shared storage error = %v", name, err)
+		}
+	}
+
+	// An empty CD-ROM drive is fine
+	if reason, err := copyStorageBlocker(`<domain><devices><disk type='file' device='cdrom'/></devices></domain>`); err != nil || reason != "" {
+		t.Errorf("copyStorageBlocker(empty cdrom) = %q, %v", reason, err)
+	}
+}
@@ -0,0 +1,145 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+)
+
+// ErrNoHostAvailable is returned when no host can take a VM.
+var ErrNoHostAvailable = errors.New("no host can take the VM")
+
+// PlacementRequest describes a VM to place on a host.
+type PlacementRequest struct {
+	VCPU              int
+	MemoryMB          int
+	Tags              []string // The host must carry all of them
+	AntiAffinityGroup string   // The host must not hold another VM of the group
+	HostID            uint     // Only consider this host (0 = any)
+	ExcludeHostID     uint     // Never consider this host (0 = none)
+	SharedStorage     bool     // The host must see the VM files this server writes
+}
+
+// hostLoad is a host with the resources allocated to the VMs placed on it.
+type hostLoad struct {
+	host     models.Host
+	vcpus    int
+	memoryMB int
+	groups   map[string]bool
+	local    bool // The default host: this server
+}
+
+func (l hostLoad) freeVCPUs() int {
+	overcommit := l.host.CPUOvercommit
+	if overcommit <= 0 {
+		overcommit = 1
+	}
+	return int(float64(l.host.CPUs)*overcommit) - l.vcpus
+}
+
+func (l hostLoad) freeMemoryMB() int {
+	return l.host.MemoryMB - l.memoryMB
+}
+
+// rejection returns why a host can't take req, or "" if it can.
+func (l hostLoad) rejection(req PlacementRequest) string {
+	switch {
+	case req.HostID != 0 && l.host.ID != req.HostID, req.ExcludeHostID != 0 && l.host.ID == req.ExcludeHostID:
+		return "excluded"
+	case l.host.Status != models.HostStatusOnline:
+		return "offline"
+	case l.host.Maintenance:
+		return "in maintenance"
+	case req.SharedStorage && !l.local && !l.host.SharedStorage:
+		return "doesn't share VM storage"
+	case req.AntiAffinityGroup != "" && l.groups[req.AntiAffinityGroup]:
+		return "holds a VM of anti-affinity group " + req.AntiAffinityGroup
+	case l.freeMemoryMB() < req.MemoryMB:
+		return fmt.Sprintf("%d MB memory free", l.freeMemoryMB())
+	case l.freeVCPUs() < req.VCPU:
+		return fmt.Sprintf("%d vCPUs free", l.freeVCPUs())
+	}
+	tags := make(map[string]bool)
+	for _, tag := range models.SplitTags(l.host.Tags) {
+		tags[tag] = true
+	}
+	for _, tag := range req.Tags {
+		if !tags[tag] {
+			return "lacks tag " + tag
+		}
+	}
+	return ""
+}
+
+// pickHost places req on one of the hosts: of those that can take it, the one left with
+// the most free memory, so VMs spread across hosts. Ties go to the lowest host ID.
+func pickHost(loads []hostLoad, req PlacementRequest) (*models.Host, error) {
+	sort.Slice(loads, func(i, j int) bool { return loads[i].host.ID < loads[j].host.ID })
+
+	var best *hostLoad
+	var reasons []string
+	for i := range loads {
+		if reason := loads[i].rejection(req); reason != "" {
+			if reason != "excluded" {
+				reasons = append(reasons, loads[i].host.Name+": "+reason)
+			}
+			continue
+		}
+		if best == nil || loads[i].freeMemoryMB() > best.freeMemoryMB() {
+			best = &loads[i]
+		}
+	}
+	if best == nil {
+		if len(reasons) == 0 {
+			return nil, ErrNoHostAvailable
+		}
+		return nil, fmt.Errorf("%w (%s)", ErrNoHostAvailable, strings.Join(reasons, "; "))
+	}
+	host := best.host
+	return &host, nil
+}
+
+// hostLoads returns every host with the resources allocated to its VMs. Stopped VMs
+// count too: their resources stay reserved so they can start again.
+func (s *VMService) hostLoads() ([]hostLoad, error) {
+	var hosts []models.Host
+	if err := s.db.Find(&hosts).Error; err != nil {
+		return nil, fmt.Errorf("failed to list hosts: %w", err)
+	}
+	var vms []models.VM
+	if err := s.db.Select("host_id", "cpu", "memory", "anti_affinity_group").Find(&vms).Error; err != nil {
+		return nil, fmt.Errorf("failed to list VMs: %w", err)
+	}
+
+	loads := make([]hostLoad, len(hosts))
+	byID := make(map[uint]*hostLoad, len(hosts))
+	defaultID := s.hosts.DefaultHostID()
+	for i, host := range hosts {
+		loads[i] = hostLoad{host: host, groups: make(map[string]bool), local: host.ID == defaultID}
+		byID[host.ID] = &loads[i]
+	}
+	for _, v := range vms {
+		load, ok := byID[s.hosts.resolve(v.HostID)]
+		if !ok {
+			continue
+		}
+		load.vcpus += v.CPU
+		load.memoryMB += v.Memory
+		if v.AntiAffinityGroup != "" {
+			load.groups[v.AntiAffinityGroup] = true
+		}
+	}
+	return loads, nil
+}
+
+// PlaceVM chooses the host for a new VM. The caller records the host on the VM.
+func (s *VMService) PlaceVM(req PlacementRequest) (*models.Host, error) {
+	loads, err := s.hostLoads()
+	if err != nil {
+		return nil, err
+	}
+	return pickHost(loads, req)
+}
@@ -0,0 +1,95 @@
+package vm
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+)
+
+func TestPickHost(t *testing.T) {
+	host := func(id uint, name string, cpus, memoryMB int, tags string) models.Host {
+		return models.Host{ID: id, Name: name, CPUs: cpus, MemoryMB: memoryMB, Tags: tags,
+			CPUOvercommit: 1, Status: models.HostStatusOnline}
+	}
+	loads := func() []hostLoad {
+		return []hostLoad{
+			{host: host(1, "local", 8, 16384, ""), vcpus: 2, memoryMB: 4096, groups: map[string]bool{}, local: true},
+			{host: host(2, "node-2", 16, 32768, "ssd,gpu"), vcpus: 8, memoryMB: 8192, groups: map[string]bool{"web": true}},
+			{host: host(3, "node-3", 4, 65536, "ssd"), vcpus: 4, memoryMB: 0, groups: map[string]bool{}},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		req    PlacementRequest
+		modify func([]hostLoad)
+		want   string // "" = no host
+	}{
+		{"most free memory", PlacementRequest{VCPU: 2, MemoryMB: 2048}, nil, "node-2"},
+		{"free vCPUs", PlacementRequest{VCPU: 10, MemoryMB: 2048}, nil, ""},
+		{"tags", PlacementRequest{VCPU: 1, MemoryMB: 1024, Tags: []string{"gpu"}}, nil, "node-2"},
+		{"anti-affinity", PlacementRequest{VCPU: 1, MemoryMB: 1024, AntiAffinityGroup: "web"}, nil, "local"},
+		{"memory", PlacementRequest{VCPU: 1, MemoryMB: 20000}, nil, "node-2"},
+		{"pinned host", PlacementRequest{VCPU: 1, MemoryMB: 1024, HostID: 1}, nil, "local"},
+		{"excluded host", PlacementRequest{VCPU: 1, MemoryMB: 1024, ExcludeHostID: 2}, nil, "local"},
+		{"maintenance", PlacementRequest{VCPU: 1, MemoryMB: 1024}, func(l []hostLoad) { l[1].host.Maintenance = true }, "local"},
+		{"shared storage", PlacementRequest{VCPU: 1, MemoryMB: 1024, SharedStorage: true}, nil, "local"},
+		{"declared shared storage", PlacementRequest{VCPU: 1, MemoryMB: 1024, SharedStorage: true}, func(l []hostLoad) { l[1].host.SharedStorage = true }, "node-2"},
+		{"offline", PlacementRequest{VCPU: 1, MemoryMB: 1024}, func(l []hostLoad) {
+			l[0].host.Status = models.HostStatusOffline
+			l[1].host.Status = models.HostStatusOffline
+		}, ""},
+		{"no overcommit", PlacementRequest{VCPU: 1, MemoryMB: 1024, Tags: []string{"ssd"}}, func(l []hostLoad) { l[1].host.Maintenance = true }, ""},
+		{"overcommit", PlacementRequest{VCPU: 1, MemoryMB: 1024, Tags: []string{"ssd"}}, func(l []hostLoad) {
+			l[1].host.Maintenance = true
+			l[2].host.CPUOvercommit = 4
+		}, "node-3"},
+	}
+	for _, tt := range tests {
+		l := loads()
+		if tt.modify != nil {
+			tt.modify(l)
+		}
+		got, err := pickHost(l, tt.req)
+		if tt.want == "" {
+			if !errors.Is(err, ErrNoHostAvailable) {
+				t.Errorf("%s: pickHost() = %v, %v; want ErrNoHostAvailable", tt.name, got, err)
+			}
+			continue
+		}
+		if err != nil || got.Name != tt.want {
+			t.Errorf("%s: pickHost() = %v, %v; want %s", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestPlaceVM_CountsPlacedVMs(t *testing.T) {
+	cluster := newFakeCluster()
+	cluster.addHost(fakeLocalURI, 8, 16384)
+	cluster.addHost("qemu+ssh://node-2/system", 8, 16384)
+	s := newFakeVMService(t, cluster)
+
+	node2 := models.Host{Name: "node-2", URI: "qemu+ssh://node-2/system", CPUOvercommit: 1}
+	s.db.Create(&node2)
+	if _, err := s.hosts.Driver(node2.ID); err != nil {
+		t.Fatalf("Driver() error = %v", err)
+	}
+
+	// VMs without a host run on the default host
+	s.db.Create(&models.VM{Name: "legacy", CPU: 2, Memory: 8192, AntiAffinityGroup: "db"})
+
+	host, err := s.PlaceVM(PlacementRequest{VCPU: 2, MemoryMB: 4096})
+	if err != nil || host.ID != node2.ID {
+		t.Fatalf("PlaceVM() = %v, %v; want node-2", host, err)
+	}
+	s.db.Create(&models.VM{Name: "big", CPU: 2, Memory: 12288, HostID: node2.ID})
+
+	host, err = s.PlaceVM(PlacementRequest{VCPU: 2, MemoryMB: 4096})
+	if err != nil || host.Name != DefaultHostName {
+		t.Errorf("PlaceVM() = %v, %v; want local", host, err)
+	}
+	if _, err := s.PlaceVM(PlacementRequest{VCPU: 1, MemoryMB: 1024, AntiAffinityGroup: "db", Tags: []string{"ssd"}}); !errors.Is(err, ErrNoHostAvailable) {
+		t.Errorf("PlaceVM() error = %v, want ErrNoHostAvailable", err)
+	}
+}
@@ -11,16 +11,18 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/DARC0625/LIMEN/backend/internal/logger"
 	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"github.com/DARC0625/LIMEN/backend/internal/osprofile"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
 )
 
 type VMService struct {
-	driver LibvirtDriver // libvirt driver interface (no direct libvirt import)
+	hosts  *HostPool // libvirt connections of the compute hosts (no direct libvirt import)
 	db     *gorm.DB
 	isoDir string
 	vmDir  string
@@ -30,6 +32,18 @@ type VMService struct {
 
 	// Timeout for libvirt operations
 	operationTimeout time.Duration
+
+	// OS profiles used to resolve per-OS defaults at create time
+	profiles *osprofile.Registry
+
+	// OVMF images for UEFI VMs
+	firmware FirmwarePaths
+
+	// Names of the VMs being migrated
+	migrating sync.Map
+
+	// Watches host connections once started with StartSupervisor
+	supervisor *Supervisor
 }
 
 const (
@@ -83,42 +97,69 @@ func NewVMService(db *gorm.DB, libvirtURI, isoDir, vmDir string) (*VMService, er
 		return nil, fmt.Errorf("failed to connect to libvirt: %w", err)
 	}
 
+	hosts := newHostPool(db, NewLibvirtDriver)
+	hosts.setDefault(libvirtURI, driver)
+
 	return &VMService{
-		driver:             driver,
+		hosts:              hosts,
 		db:                 db,
 		isoDir:             isoDir,
 		vmDir:              vmDir,
 		operationSemaphore: make(chan struct{}, MaxConcurrentLibvirtOps),
 		operationTimeout:   DefaultLibvirtTimeout,
+		profiles:           osprofile.Default(),
+		firmware:           DefaultFirmwarePaths(),
 	}, nil
 }
 
+// SetOSProfiles replaces the OS profile registry used for VM creation.
+func (s *VMService) SetOSProfiles(profiles *osprofile.Registry) {
+	if profiles != nil {
+		s.profiles = profiles
+	}
+}
+
 func (s *VMService) Close() {
-	if s.driver != nil {
-		s.driver.Close()
+	if s.supervisor != nil {
+		s.supervisor.stop()
+	}
+	if s.hosts != nil {
+		s.hosts.Close()
 	}
 }
 
 func (s *VMService) IsAlive() bool {
-	if s.driver == nil {
+	if s.hosts == nil {
 		return false
 	}
-	return s.driver.IsAlive()
+	return s.hosts.IsAlive()
 }
 
-func (s *VMService) EnsureISO(osType string) (string, error) {
+// LookupImage returns the installation image registered for osType that ownerID may
+// install from: a system image or one they uploaded. If the OS profile has an image hint,
+// images whose path contains it are preferred.
+func (s *VMService) LookupImage(osType string, ownerID uint) (*models.VMImage, error) {
+	visible := func() *gorm.DB {
+		return s.db.Where("os_type = ?", osType).Where("owner_id IS NULL OR owner_id = ?", ownerID)
+	}
 	var image models.VMImage
-	// For Windows, always use Windows 10 ISO
-	if strings.Contains(strings.ToLower(osType), "windows") {
-		// Find Windows 10 ISO by path containing "Windows10.iso" (case-insensitive)
-		if err := s.db.Where("os_type = ? AND LOWER(path) LIKE '%windows10%' AND LOWER(path) NOT LIKE '%windows11%'", osType).First(&image).Error; err != nil {
-			return "", fmt.Errorf("Windows 10 ISO not found for os type: %s", osType)
-		}
-	} else {
-		if err := s.db.Where("os_type = ?", osType).First(&image).Error; err != nil {
-			return "", fmt.Errorf("image not found for os type: %s", osType)
+	if profile, ok := s.profiles.Get(osType); ok && profile.ImageHint != "" {
+		hint := "%" + strings.ToLower(profile.ImageHint) + "%"
+		if err := visible().Where("LOWER(path) LIKE ?", hint).First(&image).Error; err == nil {
+			return &image, nil
 		}
 	}
+	if err := visible().First(&image).Error; err != nil {
+		return nil, fmt.Errorf("image not found for os type: %s", osType)
+	}
+	return &image, nil
+}
+
+func (s *VMService) EnsureISO(osType string, ownerID uint) (string, error) {
+	image, err := s.LookupImage(osType, ownerID)
+	if err != nil {
+		return "", err
+	}
 
 	imagePath := image.Path
 
@@ -127,7 +168,7 @@ func (s *VMService) EnsureISO(osType string) (string, error) {
 	if strings.Contains(imagePath, "/home/darc0/projects/LIMEN") {
 		imagePath = strings.Replace(imagePath, "/home/darc0/projects/LIMEN", "/home/darc0/LIMEN", 1)
 		image.Path = imagePath
-		if err := s.db.Save(&image).Error; err != nil {
+		if err := s.db.Save(image).Error; err != nil {
 			logger.Log.Warn("Failed to update image path in DB", zap.String("os_type", osType), zap.Error(err))
 		} else {
 			logger.Log.Info("Migrated image path to new location", zap.String("os_type", osType), zap.String("new_path", imagePath))
@@ -143,7 +184,7 @@ func (s *VMService) EnsureISO(osType string) (string, error) {
 			// Path is within ISO directory, use relative path
 			imagePath = relPath
 			image.Path = imagePath
-			if err := s.db.Save(&image).Error; err != nil {
+			if err := s.db.Save(image).Error; err != nil {
 				logger.Log.Warn("Failed to update image path in DB", zap.String("os_type", osType), zap.Error(err))
 			} else {
 				logger.Log.Debug("Converted absolute path to relative", zap.String("os_type", osType), zap.String("new_path", imagePath))
@@ -163,90 +204,94 @@ func (s *VMService) EnsureISO(osType string) (string, error) {
 	return "", fmt.Errorf("ISO file not found. Please check VM configuration. Original error: %v", fmt.Errorf("iso file not found at %s. please upload it manually", imagePath))
 }
 
-func (s *VMService) CreateVM(name string, memoryMB int, vcpu int, osType string, vmUUID string, graphicsType string, vncEnabled bool) error {
+// CreateVM defines and starts a VM. Unset fields of spec are resolved from the OS profile.
+func (s *VMService) CreateVM(spec CreateVMSpec) error {
 	return s.withLibvirtGuard("CreateVM", func() error {
-		return s.createVMInternal(name, memoryMB, vcpu, osType, vmUUID, graphicsType, vncEnabled)
+		return s.createVMInternal(spec)
 	})
 }
 
-func (s *VMService) createVMInternal(name string, memoryMB int, vcpu int, osType string, vmUUID string, graphicsType string, vncEnabled bool) error {
+func (s *VMService) createVMInternal(spec CreateVMSpec) error {
+	profile, ok := s.profiles.Get(spec.OSType)
+	if !ok {
+		return fmt.Errorf("unknown os type: %s", spec.OSType)
+	}
+	spec = ResolveCreateSpec(profile, spec)
+	name := spec.Name
+
+	// The VM record isn't committed yet, so route by the placement in spec. The disk and
+	// NVRAM are written below, under s.vmDir: the host must see them there.
+	if err := s.checkSharedStorage(spec.HostID); err != nil {
+		return err
+	}
+	driver, err := s.hosts.Driver(spec.HostID)
+	if err != nil {
+		return err
+	}
+
 	// 0. Cleanup existing resources (Libvirt domain and Disk)
 	// Check if domain exists in libvirt and cleanup
-	if dom, err := s.driver.LookupDomainByName(name); err == nil {
+	if dom, err := driver.LookupDomainByName(name); err == nil {
 		if active, err := dom.IsActive(); err == nil && active {
 			safeDestroyDomain(dom, name)
 		}
-		if err := dom.UndefineFlags(0); err != nil {
+		if err := dom.UndefineFlags(UndefineNVRAM); err != nil {
 			logger.Log.Warn("domain.UndefineFlags failed", zap.String("vm_name", name), zap.Error(err))
 		}
 		safeFreeDomain(dom)
 	}
 
 	// 1. Create empty disk for VM in vmDir using UUID instead of name
-	vmDiskPath := filepath.Join(s.vmDir, vmUUID+".qcow2")
+	vmDiskPath := filepath.Join(s.vmDir, spec.UUID+".qcow2")
 	// Remove existing disk if any
 	os.Remove(vmDiskPath)
 
-	diskSize := "20G" // Default size
+	diskSize := fmt.Sprintf("%dG", spec.DiskGB)
 
 	cmd := exec.Command("qemu-img", "create", "-f", "qcow2", vmDiskPath, diskSize)
 	if out, err := cmd.CombinedOutput(); err != nil {
 		return fmt.Errorf("failed to create vm disk: %w, output: %s", err, string(out))
 	}
-
-	// 2. Ensure ISO exists (Using DB lookup)
-	isoPath, err := s.EnsureISO(osType)
-	if err != nil {
-		return fmt.Errorf("failed to ensure iso: %w", err)
+	// removeFiles deletes the disk and NVRAM again if the domain can't be defined
+	removeFiles := func() {
+		os.Remove(vmDiskPath)
+		os.Remove(s.nvramPath(spec.UUID))
 	}
 
-	// 3. Determine VNC graphics settings
-	// GUI OS types that should have VNC enabled by default
-	guiOSTypes := []string{"ubuntu-desktop", "kali", "windows", "windows10", "windows11"}
-	isGUIOs := false
-	for _, guiType := range guiOSTypes {
-		if strings.Contains(strings.ToLower(osType), strings.ToLower(guiType)) {
-			isGUIOs = true
-			break
+	// 1b. Per-VM NVRAM for UEFI firmware, copied fresh from the template
+	firmwareOS := ""
+	if spec.Firmware != osprofile.FirmwareBIOS {
+		code, template := s.firmware.loader(spec.Firmware)
+		nvram := s.nvramPath(spec.UUID)
+		if err := copyNVRAMTemplate(template, nvram); err != nil {
+			removeFiles()
+			return err
 		}
+		firmwareOS = firmwareOSXML(spec.Firmware, code, nvram, template)
 	}
 
-	// Determine if VNC should be enabled
-	enableVNC := vncEnabled
-	if !vncEnabled && isGUIOs {
-		// Auto-enable VNC for GUI OS if not explicitly disabled
-		enableVNC = true
-		logger.Log.Info("Auto-enabling VNC for GUI OS", zap.String("os_type", osType), zap.String("vm_name", name))
-	}
-
-	// Determine graphics type
-	graphicsTypeToUse := graphicsType
-	if graphicsTypeToUse == "" {
-		if enableVNC {
-			graphicsTypeToUse = "vnc"
-		} else {
-			graphicsTypeToUse = "none"
-		}
+	// 2. Ensure ISO exists (Using DB lookup)
+	isoPath, err := s.EnsureISO(spec.OSType, spec.OwnerID)
+	if err != nil {
+		removeFiles()
+		return fmt.Errorf("failed to ensure iso: %w", err)
 	}
 
-	// 4. Define VM with CDROM boot enabled
-	// Build graphics XML based on settings
-	graphicsXML := ""
-	if enableVNC && graphicsTypeToUse == "vnc" {
-		graphicsXML = `    <graphics type='vnc' port='-1' autoport='yes' listen='0.0.0.0'>
-      <listen type='address' address='0.0.0.0'/>
-    </graphics>
-    `
-		logger.Log.Info("VNC graphics enabled for VM", zap.String("vm_name", name), zap.String("os_type", osType))
-	} else if graphicsTypeToUse == "spice" {
-		graphicsXML = `    <graphics type='spice' port='-1' autoport='yes' listen='0.0.0.0'>
-      <listen type='address' address='0.0.0.0'/>
-    </graphics>
-    `
-		logger.Log.Info("SPICE graphics enabled for VM", zap.String("vm_name", name))
-	} else {
-		logger.Log.Info("No graphics configured for VM", zap.String("vm_name", name), zap.String("graphics_type", graphicsTypeToUse))
-	}
+	// 3. Console graphics (resolved from the profile if not requested explicitly)
+	graphics := graphicsXML(spec.Graphics)
+	logger.Log.Info("Creating VM from OS profile",
+		zap.String("vm_name", name),
+		zap.String("os_type", spec.OSType),
+		zap.String("graphics", spec.Graphics),
+		zap.String("disk_bus", spec.DiskBus),
+		zap.String("nic_model", spec.NICModel),
+		zap.String("firmware", string(spec.Firmware)),
+		zap.String("cpu_model", spec.CPU.Model),
+		zap.Bool("tpm", *spec.TPM),
+		zap.Int("disk_gb", spec.DiskGB))
+
+	// Host CPU info for NUMA placement
+	hostCPU := s.HostCPUInfo(spec.HostID)
 
 	// Build boot order XML (default: cdrom_hd for new VMs)
 	bootOrder := models.BootOrderCDROMHD
@@ -260,17 +305,17 @@ func (s *VMService) createVMInternal(name string, memoryMB int, vcpu int, osType
 <domain type='kvm'>
   <name>%s</name>
   <memory unit='KiB'>%d</memory>
-  <vcpu placement='static'>%d</vcpu>
-  <os>
+  %s
+%s  <os>
     <type arch='x86_64' machine='pc-q35-7.2'>hvm</type>
-%s
+%s%s
   </os>
   <features>
     <acpi/>
     <apic/>
     <vmport state='off'/>
-  </features>
-  <cpu mode='host-model' check='partial'/>
+%s  </features>
+  %s
   <clock offset='utc'>
     <timer name='rtc' tickpolicy='catchup'/>
     <timer name='pit' tickpolicy='delay'/>
@@ -286,13 +331,7 @@ func (s *VMService) createVMInternal(name string, memoryMB int, vcpu int, osType
   <devices>
     <emulator>/usr/bin/qemu-system-x86_64</emulator>
     
-    <disk type='file' device='disk'>
-      <driver name='qemu' type='qcow2'/>
-      <source file='%s'/>
-      <target dev='vda' bus='virtio'/>
-      <address type='pci' domain='0x0000' bus='0x04' slot='0x00' function='0x0'/>
-    </disk>
-    
+%s    
     <disk type='file' device='cdrom'>
       <driver name='qemu' type='raw'/>
       <source file='%s'/>
@@ -332,7 +371,7 @@ func (s *VMService) createVMInternal(name string, memoryMB int, vcpu int, osType
     <interface type='network'>
       <mac address='52:54:00:e2:26:c5'/>
       <source network='default'/>
-      <model type='virtio'/>
+      <model type='%s'/>
       <address type='pci' domain='0x0000' bus='0x01' slot='0x00' function='0x0'/>
     </interface>
     
@@ -355,12 +394,22 @@ func (s *VMService) createVMInternal(name string, memoryMB int, vcpu int, osType
     <memballoon model='virtio'>
       <address type='pci' domain='0x0000' bus='0x00' slot='0x05' function='0x0'/>
     </memballoon>
-%s</devices>
+%s%s</devices>
 </domain>
-`, name, memoryMB*1024, vcpu, bootXML, vmDiskPath, isoPath, graphicsXML)
+`, name, spec.MemoryMB*1024, vcpuXML(spec.VCPU, spec.CPU, hostCPU), cputuneXML(spec.CPU),
+		firmwareOS, bootXML, firmwareFeaturesXML(spec.Firmware), cpuXML(spec.CPU),
+		diskXML(vmDiskPath, spec.DiskBus), isoPath, spec.NICModel, tpmXML(*spec.TPM), graphics)
+
+	vncPassword, err := generateVNCPassword()
+	if err != nil {
+		removeFiles()
+		return err
+	}
+	vmXML = secureGraphicsXML(vmXML, s.hostConsoleAddress(spec.HostID), vncPassword)
 
-	dom, err := s.driver.DomainDefineXML(vmXML)
+	dom, err := driver.DomainDefineXML(vmXML)
 	if err != nil {
+		removeFiles()
 		return fmt.Errorf("failed to define domain: %w", err)
 	}
 	defer safeFreeDomain(dom)
@@ -398,7 +447,7 @@ func (s *VMService) deleteVMInternal(name string) error {
 	}
 
 	// 1. Try to cleanup Libvirt Domain
-	dom, err := s.driver.LookupDomainByName(name)
+	dom, err := s.lookupDomain(name)
 	if err == nil {
 		defer safeFreeDomain(dom)
 
@@ -409,7 +458,7 @@ func (s *VMService) deleteVMInternal(name string) error {
 			}
 		}
 
-		if err := dom.UndefineFlags(0); err != nil {
+		if err := dom.UndefineFlags(UndefineNVRAM); err != nil {
 			logger.Log.Warn("Failed to undefine domain", zap.String("vm_name", name), zap.Error(err))
 		}
 	} else {
@@ -427,6 +476,16 @@ func (s *VMService) deleteVMInternal(name string) error {
 		}
 	}
 
+	// Remove UEFI NVRAM (libvirt removes it on undefine, but not if the domain was already gone)
+	if vmRec.UUID != "" {
+		nvramPath := s.nvramPath(vmRec.UUID)
+		if err := os.Remove(nvramPath); err != nil && !os.IsNotExist(err) {
+			logger.Log.Warn("Failed to remove NVRAM file", zap.String("path", nvramPath), zap.Error(err))
+		} else if err == nil {
+			logger.Log.Info("VM NVRAM file removed", zap.String("path", nvramPath))
+		}
+	}
+
 	// Also try name-based filename (legacy format)
 	vmDiskPath := filepath.Join(s.vmDir, name+".qcow2")
 	if err := os.Remove(vmDiskPath); err != nil && !os.IsNotExist(err) {
@@ -525,17 +584,17 @@ func (s *VMService) deleteVMInternal(name string) error {
 
 func (s *VMService) StopVM(name string) error {
 	return s.withLibvirtGuard("StopVM", func() error {
-		dom, err := s.driver.LookupDomainByName(name)
+		dom, err := s.lookupDomain(name)
 		if err != nil {
-		return err
-	}
-	defer safeFreeDomain(dom)
+			return err
+		}
+		defer safeFreeDomain(dom)
 
-	if err := dom.Destroy(); err != nil {
-		logger.Log.Warn("domain.Destroy failed", zap.String("vm_name", name), zap.Error(err))
-		return fmt.Errorf("failed to destroy domain: %w", err)
-	}
-	return nil
+		if err := dom.Destroy(); err != nil {
+			logger.Log.Warn("domain.Destroy failed", zap.String("vm_name", name), zap.Error(err))
+			return fmt.Errorf("failed to destroy domain: %w", err)
+		}
+		return nil
 	})
 }
 
@@ -546,7 +605,7 @@ func (s *VMService) StartVM(name string) error {
 }
 
 func (s *VMService) startVMInternal(name string) error {
-	dom, err := s.driver.LookupDomainByName(name)
+	dom, err := s.lookupDomain(name)
 	if err != nil {
 		return fmt.Errorf("VM not found: %w", err)
 	}
@@ -609,6 +668,12 @@ func (s *VMService) startVMInternal(name string) error {
 		// Continue anyway - VNC might already be configured or VM might start without it
 	}
 
+	// Bind the console to loopback with a fresh password. Don't start a VM whose console
+	// would stay reachable without going through the console proxy.
+	if err := s.rotateConsolePassword(name); err != nil {
+		return fmt.Errorf("failed to secure VM console: %w", err)
+	}
+
 	// Start VM
 	if err := dom.Create(); err != nil {
 		// Check if error is related to ISO file
@@ -713,7 +778,7 @@ func (s *VMService) startVMInternal(name string) error {
 // SetBootOrder sets the boot order for a VM
 // AddTPMAndSecureBoot adds TPM 2.0 and Secure Boot to an existing Windows VM
 func (s *VMService) AddTPMAndSecureBoot(name string) error {
-	dom, err := s.driver.LookupDomainByName(name)
+	dom, err := s.lookupDomain(name)
 	if err != nil {
 		return fmt.Errorf("VM not found: %w", err)
 	}
@@ -772,15 +837,15 @@ func (s *VMService) AddTPMAndSecureBoot(name string) error {
 	}
 
 	// Add loader and nvram to OS section if not present
+	var vmRec models.VM
 	nvramPath := fmt.Sprintf("/var/lib/libvirt/qemu/nvram/%s_VARS.fd", name)
-	nvramTemplate := "/usr/share/OVMF/OVMF_VARS_4M.fd"
+	if err := s.db.Where("name = ?", name).First(&vmRec).Error; err == nil && vmRec.UUID != "" {
+		nvramPath = s.nvramPath(vmRec.UUID)
+	}
+	code, nvramTemplate := s.firmware.loader(osprofile.FirmwareUEFISecureBoot)
 	if _, err := os.Stat(nvramPath); os.IsNotExist(err) {
-		if templateData, err := os.ReadFile(nvramTemplate); err == nil {
-			if err := os.MkdirAll(filepath.Dir(nvramPath), 0755); err == nil {
-				if err := os.WriteFile(nvramPath, templateData, 0644); err != nil {
-					logger.Log.Warn("Failed to write NVRAM template", zap.String("path", nvramPath), zap.Error(err))
-				}
-			}
+		if err := copyNVRAMTemplate(nvramTemplate, nvramPath); err != nil {
+			logger.Log.Warn("Failed to write NVRAM template", zap.String("path", nvramPath), zap.Error(err))
 		}
 	}
 
@@ -792,9 +857,7 @@ func (s *VMService) AddTPMAndSecureBoot(name string) error {
 		osSection += fmt.Sprintf("    <boot dev='%s'/>\n", boot.Dev)
 	}
 	if !strings.Contains(xmlDesc, "<loader") {
-		osSection += fmt.Sprintf(`    <loader readonly='yes' type='pflash'>/usr/share/OVMF/OVMF_CODE_4M.secboot.fd</loader>
-    <nvram>%s</nvram>
-`, nvramPath)
+		osSection += firmwareOSXML(osprofile.FirmwareUEFISecureBoot, code, nvramPath, nvramTemplate)
 	}
 
 	// Add TPM to devices section if not present
@@ -816,16 +879,28 @@ func (s *VMService) AddTPMAndSecureBoot(name string) error {
 	// Reconstruct XML
 	updatedXML := strings.Replace(xmlDesc, "<os>", "<os>\n"+osSection, 1)
 	updatedXML = strings.Replace(updatedXML, domainXML.Devices.Content, devicesContent, 1)
+	if !strings.Contains(updatedXML, "<smm") {
+		updatedXML = strings.Replace(updatedXML, "</features>", firmwareFeaturesXML(osprofile.FirmwareUEFISecureBoot)+"  </features>", 1)
+	}
 
 	// Undefine and redefine domain
-	if err := dom.Undefine(); err != nil {
+	if err := dom.UndefineFlags(UndefineKeepNVRAM); err != nil {
 		return fmt.Errorf("failed to undefine domain: %w", err)
 	}
 
-	if _, err := s.driver.DomainDefineXML(updatedXML); err != nil {
+	if _, err := s.defineDomain(name, updatedXML); err != nil {
 		return fmt.Errorf("failed to redefine domain with TPM and Secure Boot: %w", err)
 	}
 
+	if vmRec.ID > 0 {
+		if err := s.db.Model(&vmRec).Updates(map[string]interface{}{
+			"firmware": string(osprofile.FirmwareUEFISecureBoot),
+			"tpm":      true,
+		}).Error; err != nil {
+			logger.Log.Warn("Failed to record firmware change", zap.String("vm_name", name), zap.Error(err))
+		}
+	}
+
 	logger.Log.Info("TPM and Secure Boot added to VM", zap.String("vm_name", name))
 	return nil
 }
@@ -835,7 +910,7 @@ func (s *VMService) SetBootOrder(name string, bootOrder models.BootOrder) error
 		return fmt.Errorf("invalid boot order: %s", bootOrder)
 	}
 
-	dom, err := s.driver.LookupDomainByName(name)
+	dom, err := s.lookupDomain(name)
 	if err != nil {
 		// Check if error is "Domain not found"
 		if strings.Contains(err.Error(), "Domain not found") || strings.Contains(err.Error(), "no domain with matching name") {
@@ -873,14 +948,14 @@ func (s *VMService) SetBootOrder(name string, bootOrder models.BootOrder) error
 	if active {
 		// VM is running - need to undefine and redefine
 		// Save current state
-		if err := dom.UndefineFlags(1); err != nil {
+		if err := dom.UndefineFlags(UndefineManagedSave | UndefineKeepNVRAM); err != nil {
 			logger.Log.Warn("domain.UndefineFlags failed during update", zap.String("vm_name", name), zap.Error(err))
 			return fmt.Errorf("failed to undefine domain for update: %w", err)
 		}
 	}
 
 	// Define updated domain
-	newDom, err := s.driver.DomainDefineXML(updatedXML)
+	newDom, err := s.defineDomain(name, updatedXML)
 	if err != nil {
 		return fmt.Errorf("failed to redefine domain with new boot order: %w", err)
 	}
@@ -899,7 +974,7 @@ func (s *VMService) SetBootOrder(name string, bootOrder models.BootOrder) error
 // This is the standard way to transition from installation mode to normal operation
 // (equivalent to "Eject ISO" in VMware/VirtualBox, but boot order is user-configurable)
 func (s *VMService) FinalizeInstall(name string) error {
-	dom, err := s.driver.LookupDomainByName(name)
+	dom, err := s.lookupDomain(name)
 	if err != nil {
 		return fmt.Errorf("VM not found: %w", err)
 	}
@@ -1010,7 +1085,7 @@ func (s *VMService) FinalizeInstall(name string) error {
 	updatedXML = cdromDiskRegex.ReplaceAllString(updatedXML, "")
 
 	// 5. Update domain definition
-	_, err = s.driver.DomainDefineXML(updatedXML)
+	_, err = s.defineDomain(name, updatedXML)
 	if err != nil {
 		return fmt.Errorf("failed to update domain XML: %w", err)
 	}
@@ -1264,7 +1339,7 @@ func (s *VMService) updateCDROMSource(xmlDesc string, newSource string) (string,
 
 // DetachMedia removes ISO/CDROM media from a VM
 func (s *VMService) DetachMedia(name string) error {
-	dom, err := s.driver.LookupDomainByName(name)
+	dom, err := s.lookupDomain(name)
 	if err != nil {
 		return fmt.Errorf("VM not found: %w", err)
 	}
@@ -1304,7 +1379,7 @@ func (s *VMService) DetachMedia(name string) error {
 	}
 
 	// Update domain definition
-	_, err = s.driver.DomainDefineXML(updatedXML)
+	_, err = s.defineDomain(name, updatedXML)
 	if err != nil {
 		return fmt.Errorf("failed to detach media: %w", err)
 	}
@@ -1323,7 +1398,7 @@ func (s *VMService) AttachMedia(name string, isoPath string) error {
 		return fmt.Errorf("Media file not found: %s", isoPath)
 	}
 
-	dom, err := s.driver.LookupDomainByName(name)
+	dom, err := s.lookupDomain(name)
 	if err != nil {
 		// Check if error is "Domain not found"
 		if strings.Contains(err.Error(), "Domain not found") || strings.Contains(err.Error(), "no domain with matching name") {
@@ -1365,7 +1440,7 @@ func (s *VMService) AttachMedia(name string, isoPath string) error {
 	}
 
 	// Update domain definition
-	_, err = s.driver.DomainDefineXML(updatedXML)
+	_, err = s.defineDomain(name, updatedXML)
 	if err != nil {
 		return fmt.Errorf("failed to attach media: %w", err)
 	}
@@ -1379,7 +1454,7 @@ func (s *VMService) AttachMedia(name string, isoPath string) error {
 
 // GetCurrentMedia returns the currently attached media (ISO) path for a VM
 func (s *VMService) GetCurrentMedia(name string) (string, error) {
-	dom, err := s.driver.LookupDomainByName(name)
+	dom, err := s.lookupDomain(name)
 	if err != nil {
 		return "", fmt.Errorf("VM not found: %w", err)
 	}
@@ -1458,9 +1533,10 @@ func (s *VMService) GetVNCPort(name string) (string, error) {
 	// Retry getting VNC port with exponential backoff (max 5 seconds)
 	maxRetries := 10
 	retryDelay := 200 * time.Millisecond
+	consoleAddr := s.ConsoleAddress(name)
 
 	for attempt := 0; attempt < maxRetries; attempt++ {
-		dom, err := s.driver.LookupDomainByName(name)
+		dom, err := s.lookupDomain(name)
 		if err != nil {
 			return "", fmt.Errorf("VM not found: %w", err)
 		}
@@ -1501,6 +1577,10 @@ func (s *VMService) GetVNCPort(name string) (string, error) {
 			if g.Type == "vnc" {
 				// If autoport is enabled, get the actual port from libvirt
 				if g.AutoPort == "yes" || g.Port == "-1" {
+					// libvirt fills in the assigned port in the live XML (works for remote hosts too)
+					if port, err := strconv.Atoi(g.Port); err == nil && port > 0 && s.verifyConsolePort(consoleAddr, port) {
+						return g.Port, nil
+					}
 					// Use virsh vncdisplay command to get the actual port
 					cmd := exec.Command("virsh", "vncdisplay", name)
 					output, err := cmd.CombinedOutput()
@@ -1512,7 +1592,7 @@ func (s *VMService) GetVNCPort(name string) (string, error) {
 							if _, err := fmt.Sscanf(outputStr, ":%d", &displayNum); err == nil {
 								port := 5900 + displayNum
 								// Verify the port is actually listening
-								if s.verifyVNCPort(port) {
+								if s.verifyConsolePort(consoleAddr, port) {
 									return fmt.Sprintf("%d", port), nil
 								}
 								// Port not ready yet, continue retry
@@ -1523,7 +1603,7 @@ func (s *VMService) GetVNCPort(name string) (string, error) {
 					// Only scan on last attempt to avoid unnecessary overhead
 					if attempt == maxRetries-1 {
 						for port := 5900; port < 6000; port++ {
-							if s.verifyVNCPort(port) {
+							if s.verifyConsolePort(consoleAddr, port) {
 								return fmt.Sprintf("%d", port), nil
 							}
 						}
@@ -1551,7 +1631,12 @@ func (s *VMService) GetVNCPort(name string) (string, error) {
 
 // verifyVNCPort checks if a VNC port is actually listening
 func (s *VMService) verifyVNCPort(port int) bool {
-	conn, err := net.DialTimeout("tcp", fmt.Sprintf("localhost:%d", port), 200*time.Millisecond)
+	return s.verifyConsolePort("localhost", port)
+}
+
+// verifyConsolePort checks if a console server is listening on host:port
+func (s *VMService) verifyConsolePort(host string, port int) bool {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, strconv.Itoa(port)), 200*time.Millisecond)
 	if err == nil {
 		conn.Close()
 		return true
@@ -1560,10 +1645,10 @@ func (s *VMService) verifyVNCPort(port int) bool {
 }
 
 // ensureVNCGraphics ensures VNC graphics is configured in VM XML
-// If VNC graphics is missing, it will be added automatically
+// If VNC graphics is missing, it will be added automatically (VMs defined with SPICE are left alone)
 // Note: This function should be called before starting the VM, as DomainDefineXML cannot modify running VMs
 func (s *VMService) ensureVNCGraphics(name string) error {
-	dom, err := s.driver.LookupDomainByName(name)
+	dom, err := s.lookupDomain(name)
 	if err != nil {
 		return fmt.Errorf("VM not found: %w", err)
 	}
@@ -1581,8 +1666,8 @@ func (s *VMService) ensureVNCGraphics(name string) error {
 		if err != nil {
 			return fmt.Errorf("failed to get VM XML: %w", err)
 		}
-		if strings.Contains(xmlDesc, "type='vnc'") {
-			// VNC already configured
+		if strings.Contains(xmlDesc, "type='vnc'") || strings.Contains(xmlDesc, "type='spice'") {
+			// Graphical console already configured
 			return nil
 		}
 		// VNC not configured but VM is running - cannot modify
@@ -1611,17 +1696,17 @@ func (s *VMService) ensureVNCGraphics(name string) error {
 		return fmt.Errorf("failed to parse VM XML: %w", err)
 	}
 
-	// Check if VNC graphics already exists
+	// Check if VNC (or SPICE, which has its own console proxy) graphics already exists
 	hasVNC := false
 	for _, g := range domainXML.Devices.Graphics {
-		if g.Type == "vnc" {
+		if g.Type == "vnc" || g.Type == "spice" {
 			hasVNC = true
 			break
 		}
 	}
 
 	if hasVNC {
-		// VNC already configured, nothing to do
+		// Graphical console already configured, nothing to do
 		return nil
 	}
 
@@ -1637,8 +1722,8 @@ func (s *VMService) ensureVNCGraphics(name string) error {
 	}
 
 	// Insert VNC graphics configuration before </devices>
-	vncConfig := `    <graphics type='vnc' port='-1' autoport='yes' listen='0.0.0.0'>
-      <listen type='address' address='0.0.0.0'/>
+	vncConfig := `    <graphics type='vnc' port='-1' autoport='yes' listen='127.0.0.1'>
+      <listen type='address' address='127.0.0.1'/>
     </graphics>
 `
 
@@ -1652,7 +1737,7 @@ func (s *VMService) ensureVNCGraphics(name string) error {
 	updatedXML := xmlDesc[:insertPos] + vncConfig + xmlDesc[insertPos:]
 
 	// Update domain definition
-	_, err = s.driver.DomainDefineXML(updatedXML)
+	_, err = s.defineDomain(name, updatedXML)
 	if err != nil {
 		return fmt.Errorf("failed to add VNC graphics to VM: %w", err)
 	}
@@ -1662,7 +1747,7 @@ func (s *VMService) ensureVNCGraphics(name string) error {
 }
 
 func (s *VMService) UpdateVM(name string, memoryMB int, vcpu int) error {
-	dom, err := s.driver.LookupDomainByName(name)
+	dom, err := s.lookupDomain(name)
 	if err != nil {
 		// Check if error is "Domain not found"
 		if strings.Contains(err.Error(), "Domain not found") || strings.Contains(err.Error(), "no domain with matching name") {
@@ -1735,3 +1820,45 @@ func (s *VMService) UpdateVM(name string, memoryMB int, vcpu int) error {
 
 	return nil
 }
+
+// UpdateVMCPU rewrites the CPU model, topology and host placement of a stopped VM.
+// cpu must already be normalized and validated for vcpu.
+func (s *VMService) UpdateVMCPU(name string, vcpu int, cpu CPUConfig) error {
+	return s.withLibvirtGuard("UpdateVMCPU", func() error {
+		dom, err := s.lookupDomain(name)
+		if err != nil {
+			return fmt.Errorf("VM not found in libvirt: %w", err)
+		}
+		defer safeFreeDomain(dom)
+
+		if active, err := dom.IsActive(); err == nil && active {
+			return fmt.Errorf("vm must be stopped to update resources")
+		}
+
+		xmlDesc, err := dom.GetXMLDescInactive()
+		if err != nil {
+			return fmt.Errorf("failed to get VM XML: %w", err)
+		}
+
+		updatedXML, err := applyCPUConfig(xmlDesc, vcpu, cpu, s.HostCPUInfo(s.hostIDOf(name)))
+		if err != nil {
+			return err
+		}
+
+		newDom, err := s.defineDomain(name, updatedXML)
+		if err != nil {
+			return fmt.Errorf("failed to redefine domain with new cpu configuration: %w", err)
+		}
+		safeFreeDomain(newDom)
+
+		logger.Log.Info("VM CPU configuration updated",
+			zap.String("vm_name", name),
+			zap.Int("vcpu", vcpu),
+			zap.String("cpu_model", cpu.Model),
+			zap.Int("sockets", cpu.Sockets),
+			zap.Int("cores", cpu.Cores),
+			zap.Int("threads", cpu.Threads),
+			zap.Int("pinned_vcpus", len(cpu.Pinning)))
+		return nil
+	})
+}
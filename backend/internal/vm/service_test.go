@@ -102,7 +102,7 @@ func TestVMService_EnsureISO_ImageNotFound(t *testing.T) {
 	service, err := NewVMService(db, "invalid://uri", tempDir, tempDir)
 	if err == nil && service != nil {
 		// Test EnsureISO with non-existent image
-		_, err := service.EnsureISO("nonexistent")
+		_, err := service.EnsureISO("nonexistent", 1)
 		if err == nil {
 			t.Error("Expected error for non-existent image")
 		}
@@ -134,7 +134,7 @@ func TestVMService_EnsureISO_ImageExists(t *testing.T) {
 	service, err := NewVMService(db, "invalid://uri", isoDir, tempDir)
 	if err == nil && service != nil {
 		// Test EnsureISO with existing image
-		path, err := service.EnsureISO("test-os")
+		path, err := service.EnsureISO("test-os", 1)
 		if err != nil {
 			t.Logf("EnsureISO failed (expected due to libvirt): %v", err)
 		} else if path != isoPath {
@@ -169,7 +169,7 @@ func TestVMService_EnsureISO_PathResolution(t *testing.T) {
 	if err == nil && service != nil {
 		// Test path resolution logic
 		// The EnsureISO function should resolve relative paths to absolute paths
-		path, err := service.EnsureISO("test-os")
+		path, err := service.EnsureISO("test-os", 1)
 		if err != nil {
 			t.Logf("EnsureISO failed (expected due to libvirt): %v", err)
 		} else {
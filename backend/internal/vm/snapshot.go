@@ -19,7 +19,7 @@ func (s *VMService) CreateSnapshot(vmID uint, snapshotName, description string)
 	}
 
 	// Get libvirt domain
-	dom, err := s.driver.LookupDomainByName(vm.Name)
+	dom, err := s.lookupDomain(vm.Name)
 	if err != nil {
 		return nil, fmt.Errorf("failed to lookup domain: %w", err)
 	}
@@ -116,7 +116,7 @@ func (s *VMService) RestoreSnapshot(snapshotID uint) error {
 	}
 
 	// Get libvirt domain
-	dom, err := s.driver.LookupDomainByName(vm.Name)
+	dom, err := s.lookupDomain(vm.Name)
 	if err != nil {
 		return fmt.Errorf("failed to lookup domain: %w", err)
 	}
@@ -210,7 +210,7 @@ func (s *VMService) DeleteSnapshot(snapshotID uint) error {
 	}
 
 	// Get libvirt domain
-	dom, err := s.driver.LookupDomainByName(vm.Name)
+	dom, err := s.lookupDomain(vm.Name)
 	if err != nil {
 		return fmt.Errorf("failed to lookup domain: %w", err)
 	}
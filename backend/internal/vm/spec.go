@@ -0,0 +1,115 @@
+package vm
+
+import (
+	"fmt"
+
+	"github.com/DARC0625/LIMEN/backend/internal/osprofile"
+)
+
+// CreateVMSpec describes a VM to define in libvirt.
+// Zero values are filled from the VM's OS profile by ResolveCreateSpec.
+type CreateVMSpec struct {
+	Name     string
+	UUID     string
+	OSType   string
+	VCPU     int
+	MemoryMB int
+	DiskGB   int
+	Graphics string // vnc, spice, none
+	HostID   uint   // Compute host chosen by PlaceVM (0 = the default host)
+	OwnerID  uint   // User the VM is created for: installs from system images or theirs
+
+	// CPU model, topology and host placement (validated by the caller)
+	CPU CPUConfig
+
+	// Firmware and TPM - normally taken from the profile
+	Firmware osprofile.Firmware
+	TPM      *bool
+
+	// Device models - normally taken from the profile
+	DiskBus  string
+	NICModel string
+}
+
+// ResolveCreateSpec fills unset fields of spec from profile and raises memory to the profile minimum.
+func ResolveCreateSpec(profile osprofile.Profile, spec CreateVMSpec) CreateVMSpec {
+	if spec.VCPU <= 0 {
+		spec.VCPU = profile.DefaultCPU
+	}
+	if spec.MemoryMB <= 0 {
+		spec.MemoryMB = profile.DefaultMemoryMB
+	}
+	if spec.MemoryMB < profile.MinMemoryMB {
+		spec.MemoryMB = profile.MinMemoryMB
+	}
+	spec.CPU = spec.CPU.Normalize(spec.VCPU)
+	if spec.DiskGB <= 0 {
+		spec.DiskGB = profile.DefaultDiskGB
+	}
+	if spec.Graphics == "" {
+		spec.Graphics = profile.Graphics
+	}
+	if spec.Firmware == "" {
+		spec.Firmware = profile.Firmware
+	}
+	if spec.TPM == nil {
+		tpm := profile.TPM
+		spec.TPM = &tpm
+	}
+	if spec.DiskBus == "" {
+		spec.DiskBus = profile.DiskBus
+	}
+	if spec.NICModel == "" {
+		spec.NICModel = profile.NICModel
+	}
+	return spec
+}
+
+// diskXML returns the <disk> element for the VM's system disk on the given bus.
+func diskXML(path, bus string) string {
+	switch bus {
+	case "sata":
+		// sda is the CD-ROM on the same controller
+		return fmt.Sprintf(`    <disk type='file' device='disk'>
+      <driver name='qemu' type='qcow2'/>
+      <source file='%s'/>
+      <target dev='sdb' bus='sata'/>
+      <address type='drive' controller='0' bus='0' target='0' unit='1'/>
+    </disk>
+`, path)
+	case "scsi":
+		return fmt.Sprintf(`    <controller type='scsi' index='0' model='virtio-scsi'/>
+    <disk type='file' device='disk'>
+      <driver name='qemu' type='qcow2' discard='unmap'/>
+      <source file='%s'/>
+      <target dev='sdb' bus='scsi'/>
+    </disk>
+`, path)
+	default:
+		return fmt.Sprintf(`    <disk type='file' device='disk'>
+      <driver name='qemu' type='qcow2'/>
+      <source file='%s'/>
+      <target dev='vda' bus='virtio'/>
+      <address type='pci' domain='0x0000' bus='0x04' slot='0x00' function='0x0'/>
+    </disk>
+`, path)
+	}
+}
+
+// graphicsXML returns the <graphics> element for the console type, or "" for none.
+func graphicsXML(graphics string) string {
+	switch graphics {
+	case "vnc":
+		return `    <graphics type='vnc' port='-1' autoport='yes' listen='127.0.0.1'>
+      <listen type='address' address='127.0.0.1'/>
+    </graphics>
+    `
+	case "spice":
+		return `    <graphics type='spice' port='-1' autoport='yes' listen='127.0.0.1'>
+      <listen type='address' address='127.0.0.1'/>
+    </graphics>
+    `
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,79 @@
+package vm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"github.com/DARC0625/LIMEN/backend/internal/osprofile"
+)
+
+func TestResolveCreateSpec(t *testing.T) {
+	profile, _ := osprofile.Default().Get("windows")
+
+	spec := ResolveCreateSpec(profile, CreateVMSpec{Name: "win", OSType: "windows", MemoryMB: 2048})
+	if spec.VCPU != profile.DefaultCPU || spec.DiskGB != profile.DefaultDiskGB {
+		t.Errorf("Expected profile defaults, got %+v", spec)
+	}
+	if spec.MemoryMB != profile.MinMemoryMB {
+		t.Errorf("Expected memory raised to %d, got %d", profile.MinMemoryMB, spec.MemoryMB)
+	}
+	if spec.Graphics != "vnc" || spec.DiskBus != "virtio" || spec.NICModel != "virtio" {
+		t.Errorf("Expected profile devices, got %+v", spec)
+	}
+	if spec.Firmware != profile.Firmware || spec.TPM == nil || *spec.TPM != profile.TPM {
+		t.Errorf("Expected profile firmware, got %+v", spec)
+	}
+
+	tpm := true
+	spec = ResolveCreateSpec(profile, CreateVMSpec{Firmware: osprofile.FirmwareUEFISecureBoot, TPM: &tpm})
+	if spec.Firmware != osprofile.FirmwareUEFISecureBoot || !*spec.TPM {
+		t.Errorf("Explicit firmware should be kept, got %+v", spec)
+	}
+
+	spec = ResolveCreateSpec(profile, CreateVMSpec{VCPU: 8, MemoryMB: 16384, DiskGB: 60, Graphics: "none"})
+	if spec.VCPU != 8 || spec.MemoryMB != 16384 || spec.DiskGB != 60 || spec.Graphics != "none" {
+		t.Errorf("Explicit values should be kept, got %+v", spec)
+	}
+}
+
+func TestDiskXML(t *testing.T) {
+	tests := []struct {
+		bus  string
+		want string
+	}{
+		{"virtio", "<target dev='vda' bus='virtio'/>"},
+		{"sata", "<target dev='sdb' bus='sata'/>"},
+		{"scsi", "model='virtio-scsi'"},
+	}
+	for _, tt := range tests {
+		if got := diskXML("/vms/a.qcow2", tt.bus); !strings.Contains(got, tt.want) {
+			t.Errorf("diskXML(%q) missing %q:\n%s", tt.bus, tt.want, got)
+		}
+	}
+	if graphicsXML("none") != "" {
+		t.Error("Expected no graphics element for none")
+	}
+}
+
+func TestVMService_LookupImage_OwnImagesOnly(t *testing.T) {
+	cluster := newFakeCluster()
+	cluster.addHost(fakeLocalURI, 8, 16384)
+	s := newFakeVMService(t, cluster)
+	if err := s.db.AutoMigrate(&models.VMImage{}); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+	mallory, alice := uint(2), uint(3)
+	s.db.Create(&models.VMImage{Name: "trojan", OSType: "test-os", Path: "trojan.iso", OwnerID: &mallory})
+
+	if _, err := s.LookupImage("test-os", alice); err == nil {
+		t.Error("LookupImage() returned another user's upload")
+	}
+	s.db.Create(&models.VMImage{Name: "system", OSType: "test-os", Path: "system.iso"})
+	if image, err := s.LookupImage("test-os", alice); err != nil || image.Name != "system" {
+		t.Errorf("LookupImage() = %+v, %v; want the system image", image, err)
+	}
+	if image, err := s.LookupImage("test-os", mallory); err != nil || image.Name != "trojan" {
+		t.Errorf("LookupImage() of the uploader = %+v, %v; want their upload", image, err)
+	}
+}
@@ -20,7 +20,7 @@ type VMStats struct {
 
 // GetVMStats retrieves current resource usage statistics for a VM
 func (s *VMService) GetVMStats(vmName string) (*VMStats, error) {
-	dom, err := s.driver.LookupDomainByName(vmName)
+	dom, err := s.lookupDomain(vmName)
 	if err != nil {
 		return nil, fmt.Errorf("failed to lookup domain: %v", err)
 	}
@@ -0,0 +1,219 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/DARC0625/LIMEN/backend/internal/logger"
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"github.com/DARC0625/LIMEN/backend/internal/utils"
+	"go.uber.org/zap"
+)
+
+// SupervisorInterval is how often the supervisor checks the hosts' connections.
+const SupervisorInterval = 10 * time.Second
+
+// Alerter raises operational alerts. *alerting.Manager implements it.
+type Alerter interface {
+	SendAlert(ctx context.Context, title, message, severity, service, component string, metadata map[string]interface{}, tags []string) error
+}
+
+// defaultReconnectRetry is the backoff between reconnection attempts. When a round of
+// attempts fails, the next check starts another.
+func defaultReconnectRetry() utils.RetryConfig {
+	return utils.RetryConfig{
+		MaxAttempts:       10,
+		InitialDelay:      time.Second,
+		MaxDelay:          time.Minute,
+		BackoffMultiplier: 2.0,
+		Logger:            logger.Log,
+	}
+}
+
+// Supervisor watches the libvirt connections of all hosts. When one dies (e.g.
+// libvirtd restarted), its host enters an outage: operations on it fail fast while the
+// supervisor reconnects with backoff. Alerts are raised when a connection is lost and
+// when it is restored.
+type Supervisor struct {
+	pool     *HostPool
+	interval time.Duration
+	retry    utils.RetryConfig
+	alerter  Alerter // nil = no alerts
+
+	mu           sync.Mutex
+	reconnecting map[uint]bool
+	cancel       context.CancelFunc
+	wg           sync.WaitGroup
+}
+
+func newSupervisor(pool *HostPool, interval time.Duration, retry utils.RetryConfig, alerter Alerter) *Supervisor {
+	return &Supervisor{
+		pool:         pool,
+		interval:     interval,
+		retry:        retry,
+		alerter:      alerter,
+		reconnecting: make(map[uint]bool),
+	}
+}
+
+// StartSupervisor starts supervising the hosts' connections, sending alerts to alerter
+// (which may be nil). Close stops it.
+func (s *VMService) StartSupervisor(alerter Alerter) {
+	if s.supervisor != nil {
+		return
+	}
+	s.supervisor = newSupervisor(s.hosts, SupervisorInterval, defaultReconnectRetry(), alerter)
+	s.supervisor.start()
+}
+
+func (sv *Supervisor) start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	sv.cancel = cancel
+	sv.wg.Add(1)
+	go func() {
+		defer sv.wg.Done()
+		ticker := time.NewTicker(sv.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				sv.check(ctx)
+			}
+		}
+	}()
+}
+
+// stop stops the supervisor and waits for reconnection attempts to give up.
+func (sv *Supervisor) stop() {
+	if sv.cancel != nil {
+		sv.cancel()
+	}
+	sv.wg.Wait()
+}
+
+// check probes every host's connection and starts reconnecting the dead ones.
+func (sv *Supervisor) check(ctx context.Context) {
+	var hosts []models.Host
+	if err := sv.pool.db.Find(&hosts).Error; err != nil {
+		logger.Log.Warn("Failed to list hosts for connection check", zap.Error(err))
+		return
+	}
+	for _, host := range hosts {
+		sv.mu.Lock()
+		busy := sv.reconnecting[host.ID]
+		sv.mu.Unlock()
+		if busy {
+			continue
+		}
+		err := sv.pool.probe(host.ID)
+		if errors.Is(err, errNotConnected) {
+			// Not used since startup or since it was added: connect now
+			if _, err = sv.pool.connect(host.ID); err == nil {
+				continue
+			}
+		}
+		if err == nil {
+			continue
+		}
+		if sv.pool.markDown(host, err) {
+			logger.Log.Error("Libvirt connection lost", zap.String("host", host.Name), zap.String("uri", host.URI), zap.Error(err))
+			sv.alert(ctx, "Libvirt Connection Lost: "+host.Name,
+				fmt.Sprintf("The libvirt connection to host %s (%s) is down: %v. Operations on its VMs fail until it is restored.", host.Name, host.URI, err),
+				"critical", host)
+		}
+		sv.reconnect(ctx, host)
+	}
+}
+
+// reconnect reconnects to a host in the background, with backoff.
+func (sv *Supervisor) reconnect(ctx context.Context, host models.Host) {
+	sv.mu.Lock()
+	sv.reconnecting[host.ID] = true
+	sv.mu.Unlock()
+
+	sv.wg.Add(1)
+	go func() {
+		defer sv.wg.Done()
+		defer func() {
+			sv.mu.Lock()
+			delete(sv.reconnecting, host.ID)
+			sv.mu.Unlock()
+		}()
+
+		err := utils.Retry(ctx, func() error {
+			_, err := sv.pool.connect(host.ID)
+			if err != nil {
+				sv.pool.recordAttempt(host.ID, err)
+			}
+			return err
+		}, sv.retry)
+		if err != nil {
+			logger.Log.Warn("Libvirt reconnection failed, retrying at the next check", zap.String("host", host.Name), zap.Error(err))
+			return
+		}
+
+		downtime := sv.pool.markUp(host.ID)
+		logger.Log.Info("Libvirt connection restored", zap.String("host", host.Name), zap.Duration("downtime", downtime))
+		sv.alert(ctx, "Libvirt Connection Restored: "+host.Name,
+			fmt.Sprintf("The libvirt connection to host %s (%s) is back after %s.", host.Name, host.URI, downtime.Round(time.Second)),
+			"info", host)
+	}()
+}
+
+func (sv *Supervisor) alert(ctx context.Context, title, message, severity string, host models.Host) {
+	if sv.alerter == nil {
+		return
+	}
+	metadata := map[string]interface{}{
+		"host_id": host.ID,
+		"host":    host.Name,
+		"uri":     host.URI,
+	}
+	if err := sv.alerter.SendAlert(ctx, title, message, severity, "limen", "libvirt", metadata, []string{"libvirt", "availability"}); err != nil {
+		logger.Log.Warn("send alert failed", zap.Error(err))
+	}
+}
+
+// markDown puts a host in an outage, reporting whether it just started.
+func (p *HostPool) markDown(host models.Host, cause error) bool {
+	p.mu.Lock()
+	outage, ok := p.outages[host.ID]
+	if !ok {
+		outage = &hostOutage{name: host.Name, since: time.Now()}
+		p.outages[host.ID] = outage
+	}
+	outage.lastErr = cause
+	p.mu.Unlock()
+
+	if !ok {
+		p.db.Model(&host).Update("status", models.HostStatusOffline)
+	}
+	return !ok
+}
+
+// recordAttempt records a failed reconnection attempt.
+func (p *HostPool) recordAttempt(hostID uint, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if outage, ok := p.outages[hostID]; ok {
+		outage.attempts++
+		outage.lastErr = err
+	}
+}
+
+// markUp ends a host's outage and returns how long it lasted.
+func (p *HostPool) markUp(hostID uint) time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	outage, ok := p.outages[hostID]
+	if !ok {
+		return 0
+	}
+	delete(p.outages, hostID)
+	return time.Since(outage.since)
+}
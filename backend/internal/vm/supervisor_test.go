@@ -0,0 +1,92 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	apperrors "github.com/DARC0625/LIMEN/backend/internal/errors"
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"github.com/DARC0625/LIMEN/backend/internal/utils"
+)
+
+type recordingAlerter struct {
+	mu     sync.Mutex
+	titles []string
+}
+
+func (a *recordingAlerter) SendAlert(ctx context.Context, title, message, severity, service, component string, metadata map[string]interface{}, tags []string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.titles = append(a.titles, severity+": "+title)
+	return nil
+}
+
+func (a *recordingAlerter) sent() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]string(nil), a.titles...)
+}
+
+func TestSupervisor_ReconnectsDeadHost(t *testing.T) {
+	const uri = "qemu+ssh://node-2/system"
+	cluster := newFakeCluster()
+	cluster.addHost(fakeLocalURI, 8, 16384)
+	cluster.addHost(uri, 8, 16384)
+	s := newFakeVMService(t, cluster)
+	node2 := models.Host{Name: "node-2", URI: uri}
+	s.db.Create(&node2)
+
+	alerts := &recordingAlerter{}
+	retry := utils.RetryConfig{MaxAttempts: 1000, InitialDelay: time.Millisecond, MaxDelay: time.Millisecond, BackoffMultiplier: 1}
+	sv := newSupervisor(s.hosts, time.Hour, retry, alerts)
+	defer sv.stop()
+	ctx := context.Background()
+
+	// Hosts not used yet are connected quietly
+	sv.check(ctx)
+	if conn := s.hosts.Connection(node2.ID); !conn.Connected {
+		t.Fatalf("node-2 connection = %+v, want connected", conn)
+	}
+
+	cluster.setDown(uri, true)
+	sv.check(ctx)
+	_, err := s.hosts.Driver(node2.ID)
+	var appErr *apperrors.AppError
+	if !errors.As(err, &appErr) || appErr.Code != apperrors.ErrCodeLibvirtConnection || !errors.Is(err, ErrHostUnavailable) {
+		t.Fatalf("Driver() during outage error = %v, want ErrCodeLibvirtConnection", err)
+	}
+	if conn := s.hosts.Connection(node2.ID); conn.Connected || conn.DownSince == nil {
+		t.Errorf("node-2 connection = %+v, want an outage", conn)
+	}
+	if driver, err := s.hosts.Driver(0); err != nil || driver == nil {
+		t.Errorf("Driver(0) = %v, %v; other hosts must keep working", driver, err)
+	}
+	var stored models.Host
+	s.db.First(&stored, node2.ID)
+	if stored.Status != models.HostStatusOffline {
+		t.Errorf("status = %q, want offline", stored.Status)
+	}
+
+	// Checks during the reconnection don't raise more alerts
+	sv.check(ctx)
+	cluster.setDown(uri, false)
+	deadline := time.Now().Add(5 * time.Second)
+	for !s.hosts.Connection(node2.ID).Connected {
+		if time.Now().After(deadline) {
+			t.Fatal("supervisor did not reconnect node-2")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if _, err := s.hosts.Driver(node2.ID); err != nil {
+		t.Errorf("Driver() after reconnection error = %v", err)
+	}
+
+	sv.stop()
+	want := []string{"critical: Libvirt Connection Lost: node-2", "info: Libvirt Connection Restored: node-2"}
+	if got := alerts.sent(); len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("alerts = %v, want %v", got, want)
+	}
+}
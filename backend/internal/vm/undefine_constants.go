@@ -0,0 +1,13 @@
+//go:build libvirt
+// +build libvirt
+
+package vm
+
+import libvirt "github.com/libvirt/libvirt-go"
+
+// Undefine constants from libvirt
+var (
+	UndefineManagedSave uint32 = uint32(libvirt.DOMAIN_UNDEFINE_MANAGED_SAVE)
+	UndefineNVRAM       uint32 = uint32(libvirt.DOMAIN_UNDEFINE_NVRAM)
+	UndefineKeepNVRAM   uint32 = uint32(libvirt.DOMAIN_UNDEFINE_KEEP_NVRAM)
+)
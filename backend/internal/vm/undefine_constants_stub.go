@@ -0,0 +1,11 @@
+//go:build !libvirt
+// +build !libvirt
+
+package vm
+
+// Undefine constants stub (for !libvirt builds)
+var (
+	UndefineManagedSave uint32 = 0
+	UndefineNVRAM       uint32 = 0
+	UndefineKeepNVRAM   uint32 = 0
+)
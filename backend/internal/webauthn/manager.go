@@ -0,0 +1,436 @@
+// Package webauthn implements WebAuthn (passkey and security key) registration and
+// authentication ceremonies for a single relying party, with the credentials stored in
+// the database (models.WebAuthnCredential).
+package webauthn
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/DARC0625/LIMEN/backend/internal/auth"
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrNotConfigured      = errors.New("WebAuthn is not configured")
+	ErrInvalidSession     = errors.New("invalid or expired WebAuthn session")
+	ErrCredentialNotFound = errors.New("WebAuthn credential not found")
+	ErrCredentialExists   = errors.New("WebAuthn credential already registered")
+)
+
+// Config identifies the relying party.
+type Config struct {
+	RPID    string        // Domain the credentials are scoped to, e.g. "limen.kr" (empty = disabled)
+	RPName  string        // Name shown by authenticators
+	Origins []string      // Origins of the web app allowed to run ceremonies
+	Timeout time.Duration // How long the user has to complete a ceremony
+}
+
+// User identifies the user of a registration ceremony.
+type User struct {
+	ID     uint
+	Handle []byte // Opaque user handle stored by the authenticator
+	Name   string
+}
+
+// CredentialDescriptor identifies a credential in ceremony options.
+type CredentialDescriptor struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+// CredentialParameter is a credential type and algorithm offered at registration.
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+// CreationOptions are the JSON form of PublicKeyCredentialCreationOptions, for
+// PublicKeyCredential.parseCreationOptionsFromJSON.
+type CreationOptions struct {
+	Challenge string `json:"challenge"`
+	RP        struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"rp"`
+	User struct {
+		ID          string `json:"id"`
+		Name        string `json:"name"`
+		DisplayName string `json:"displayName"`
+	} `json:"user"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"` // Milliseconds
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection struct {
+		ResidentKey      string `json:"residentKey"`
+		UserVerification string `json:"userVerification"`
+	} `json:"authenticatorSelection"`
+	Attestation string `json:"attestation"`
+}
+
+// RequestOptions are the JSON form of PublicKeyCredentialRequestOptions, for
+// PublicKeyCredential.parseRequestOptionsFromJSON.
+type RequestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	Timeout          int64                  `json:"timeout"` // Milliseconds
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"` // Empty: any discoverable credential
+	UserVerification string                 `json:"userVerification"`
+}
+
+// AttestationResponse is the JSON form of the PublicKeyCredential of a registration.
+type AttestationResponse struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string   `json:"clientDataJSON"`
+		AttestationObject string   `json:"attestationObject"`
+		Transports        []string `json:"transports,omitempty"`
+	} `json:"response"`
+}
+
+// AssertionResponse is the JSON form of the PublicKeyCredential of an authentication.
+type AssertionResponse struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON"`
+		AuthenticatorData string `json:"authenticatorData"`
+		Signature         string `json:"signature"`
+		UserHandle        string `json:"userHandle,omitempty"`
+	} `json:"response"`
+}
+
+// sessionClaims carry the state of a ceremony between its begin and finish requests.
+type sessionClaims struct {
+	Challenge string `json:"chl"`
+	Ceremony  string `json:"cer"`           // "create" or "get"
+	UserID    uint   `json:"uid,omitempty"` // 0: any user (passwordless login)
+	RequireUV bool   `json:"uv,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Manager runs ceremonies for one relying party. Ceremony state travels in signed
+// session tokens, each accepted once, so any instance can finish a ceremony started
+// by another one as long as replays are checked on a single instance.
+type Manager struct {
+	db   *gorm.DB
+	cfg  Config
+	key  []byte
+	used *auth.ReplayCache
+	now  func() time.Time
+}
+
+// NewManager creates a manager for cfg, signing sessions with a key derived from secret.
+func NewManager(db *gorm.DB, cfg Config, secret string) *Manager {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 5 * time.Minute
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("limen-webauthn-session"))
+	return &Manager{db: db, cfg: cfg, key: mac.Sum(nil), used: auth.NewReplayCache(), now: time.Now}
+}
+
+// Enabled reports whether a relying party is configured.
+func (m *Manager) Enabled() bool {
+	return m.cfg.RPID != ""
+}
+
+// Timeout is how long the user has to complete a ceremony.
+func (m *Manager) Timeout() time.Duration {
+	return m.cfg.Timeout
+}
+
+// BeginRegistration starts registering a credential for user. User verification is
+// required, so the credential can log in without a password.
+func (m *Manager) BeginRegistration(user User) (*CreationOptions, string, error) {
+	if !m.Enabled() {
+		return nil, "", ErrNotConfigured
+	}
+	challenge, session, err := m.newSession("create", user.ID, true)
+	if err != nil {
+		return nil, "", err
+	}
+	existing, err := m.descriptors(user.ID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	opts := &CreationOptions{
+		Challenge:          encodeBase64URL(challenge),
+		Timeout:            m.cfg.Timeout.Milliseconds(),
+		ExcludeCredentials: existing,
+		Attestation:        "none",
+	}
+	opts.RP.ID = m.cfg.RPID
+	opts.RP.Name = m.cfg.RPName
+	opts.User.ID = encodeBase64URL(user.Handle)
+	opts.User.Name = user.Name
+	opts.User.DisplayName = user.Name
+	for _, alg := range SupportedAlgorithms {
+		opts.PubKeyCredParams = append(opts.PubKeyCredParams, CredentialParameter{Type: "public-key", Alg: alg})
+	}
+	opts.AuthenticatorSelection.ResidentKey = "preferred"
+	opts.AuthenticatorSelection.UserVerification = "required"
+	return opts, session, nil
+}
+
+// FinishRegistration verifies the response to BeginRegistration and stores the
+// credential under name.
+func (m *Manager) FinishRegistration(userID uint, session string, resp *AttestationResponse, name string) (*models.WebAuthnCredential, error) {
+	claims, err := m.useSession(session, "create")
+	if err != nil {
+		return nil, err
+	}
+	if claims.UserID != userID {
+		return nil, ErrInvalidSession
+	}
+	clientDataJSON, err1 := decodeBase64URL(resp.Response.ClientDataJSON)
+	attestationObject, err2 := decodeBase64URL(resp.Response.AttestationObject)
+	if err1 != nil || err2 != nil {
+		return nil, verificationError("invalid base64url encoding")
+	}
+	challenge, _ := decodeBase64URL(claims.Challenge)
+	reg, err := verifyRegistration(m.cfg.RPID, m.cfg.Origins, challenge, claims.RequireUV, clientDataJSON, attestationObject)
+	if err != nil {
+		return nil, err
+	}
+
+	credentialID := encodeBase64URL(reg.credentialID)
+	var count int64
+	if err := m.db.Model(&models.WebAuthnCredential{}).Where("credential_id = ?", credentialID).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrCredentialExists
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = "Passkey"
+	}
+	if len(name) > 100 {
+		name = name[:100]
+	}
+	cred := &models.WebAuthnCredential{
+		UserID:         userID,
+		Name:           name,
+		CredentialID:   credentialID,
+		PublicKey:      reg.publicKey,
+		Algorithm:      reg.alg,
+		SignCount:      reg.signCount,
+		AAGUID:         reg.aaguid,
+		Transports:     strings.Join(resp.Response.Transports, ","),
+		BackupEligible: reg.backupEligible,
+		CreatedAt:      m.now(),
+	}
+	if err := m.db.Create(cred).Error; err != nil {
+		return nil, err
+	}
+	return cred, nil
+}
+
+// BeginLogin starts authenticating userID with one of their credentials, as a second
+// factor, or any user with a discoverable credential when userID is 0 (passwordless
+// login, which requires user verification).
+func (m *Manager) BeginLogin(userID uint) (*RequestOptions, string, error) {
+	if !m.Enabled() {
+		return nil, "", ErrNotConfigured
+	}
+	requireUV := userID == 0
+	challenge, session, err := m.newSession("get", userID, requireUV)
+	if err != nil {
+		return nil, "", err
+	}
+	opts := &RequestOptions{
+		Challenge:        encodeBase64URL(challenge),
+		Timeout:          m.cfg.Timeout.Milliseconds(),
+		RPID:             m.cfg.RPID,
+		AllowCredentials: []CredentialDescriptor{},
+		UserVerification: "preferred",
+	}
+	if requireUV {
+		opts.UserVerification = "required"
+	} else {
+		if opts.AllowCredentials, err = m.descriptors(userID); err != nil {
+			return nil, "", err
+		}
+		if len(opts.AllowCredentials) == 0 {
+			return nil, "", ErrCredentialNotFound
+		}
+	}
+	return opts, session, nil
+}
+
+// FindCredential returns the stored credential a response names, so callers can check
+// its user before FinishLogin.
+func (m *Manager) FindCredential(resp *AssertionResponse) (*models.WebAuthnCredential, error) {
+	id := resp.RawID
+	if id == "" {
+		id = resp.ID
+	}
+	raw, err := decodeBase64URL(id)
+	if err != nil || len(raw) == 0 {
+		return nil, ErrCredentialNotFound
+	}
+	var cred models.WebAuthnCredential
+	if err := m.db.Where("credential_id = ?", encodeBase64URL(raw)).Limit(1).Find(&cred).Error; err != nil {
+		return nil, err
+	}
+	if cred.ID == 0 {
+		return nil, ErrCredentialNotFound
+	}
+	return &cred, nil
+}
+
+// FinishLogin verifies the response to BeginLogin and returns the credential used,
+// whose UserID is the authenticated user. userHandle is the handle of that user,
+// checked against the one the authenticator returned, if any.
+func (m *Manager) FinishLogin(session string, resp *AssertionResponse, userHandle []byte) (*models.WebAuthnCredential, error) {
+	claims, err := m.useSession(session, "get")
+	if err != nil {
+		return nil, err
+	}
+	cred, err := m.FindCredential(resp)
+	if err != nil {
+		return nil, err
+	}
+	if claims.UserID != 0 && cred.UserID != claims.UserID {
+		return nil, ErrCredentialNotFound
+	}
+	if resp.Response.UserHandle != "" {
+		handle, err := decodeBase64URL(resp.Response.UserHandle)
+		if err != nil || !hmac.Equal(handle, userHandle) {
+			return nil, verificationError("user handle mismatch")
+		}
+	}
+
+	clientDataJSON, err1 := decodeBase64URL(resp.Response.ClientDataJSON)
+	authData, err2 := decodeBase64URL(resp.Response.AuthenticatorData)
+	signature, err3 := decodeBase64URL(resp.Response.Signature)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return nil, verificationError("invalid base64url encoding")
+	}
+	challenge, _ := decodeBase64URL(claims.Challenge)
+	signCount, err := verifyAssertion(m.cfg.RPID, m.cfg.Origins, challenge, claims.RequireUV,
+		cred.PublicKey, cred.SignCount, clientDataJSON, authData, signature)
+	if err != nil {
+		return nil, err
+	}
+
+	now := m.now()
+	// Conditional on the counter, so concurrent logins can't both use the same value
+	result := m.db.Model(&models.WebAuthnCredential{}).
+		Where("id = ? AND sign_count = ?", cred.ID, cred.SignCount).
+		Updates(map[string]interface{}{"sign_count": signCount, "last_used_at": now})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, verificationError("credential used concurrently")
+	}
+	cred.SignCount = signCount
+	cred.LastUsedAt = &now
+	return cred, nil
+}
+
+// Credentials returns a user's credentials, oldest first.
+func (m *Manager) Credentials(userID uint) ([]models.WebAuthnCredential, error) {
+	var creds []models.WebAuthnCredential
+	err := m.db.Where("user_id = ?", userID).Order("created_at").Find(&creds).Error
+	return creds, err
+}
+
+// DeleteCredential removes credential id of a user.
+func (m *Manager) DeleteCredential(userID, id uint) error {
+	result := m.db.Where("id = ? AND user_id = ?", id, userID).Delete(&models.WebAuthnCredential{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrCredentialNotFound
+	}
+	return nil
+}
+
+// DeleteUserCredentials removes all credentials of a user and returns how many there were.
+func (m *Manager) DeleteUserCredentials(userID uint) (int64, error) {
+	result := m.db.Where("user_id = ?", userID).Delete(&models.WebAuthnCredential{})
+	return result.RowsAffected, result.Error
+}
+
+// descriptors lists a user's credentials for ceremony options.
+func (m *Manager) descriptors(userID uint) ([]CredentialDescriptor, error) {
+	creds, err := m.Credentials(userID)
+	if err != nil {
+		return nil, err
+	}
+	descriptors := make([]CredentialDescriptor, 0, len(creds))
+	for _, c := range creds {
+		d := CredentialDescriptor{Type: "public-key", ID: c.CredentialID}
+		if c.Transports != "" {
+			d.Transports = strings.Split(c.Transports, ",")
+		}
+		descriptors = append(descriptors, d)
+	}
+	return descriptors, nil
+}
+
+// newSession returns a random challenge and the signed session carrying it.
+func (m *Manager) newSession(ceremony string, userID uint, requireUV bool) ([]byte, string, error) {
+	challenge := make([]byte, 32)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, "", err
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, "", err
+	}
+	now := m.now()
+	claims := &sessionClaims{
+		Challenge: encodeBase64URL(challenge),
+		Ceremony:  ceremony,
+		UserID:    userID,
+		RequireUV: requireUV,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        encodeBase64URL(id),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(m.cfg.Timeout)),
+			Audience:  []string{"limen-webauthn"},
+		},
+	}
+	session, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(m.key)
+	if err != nil {
+		return nil, "", err
+	}
+	return challenge, session, nil
+}
+
+// useSession validates a session of ceremony and marks it used.
+func (m *Manager) useSession(session, ceremony string) (*sessionClaims, error) {
+	claims := &sessionClaims{}
+	_, err := jwt.ParseWithClaims(session, claims, func(token *jwt.Token) (interface{}, error) {
+		return m.key, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithAudience("limen-webauthn"),
+		jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(m.now),
+	)
+	if err != nil || claims.Ceremony != ceremony || claims.ID == "" {
+		return nil, ErrInvalidSession
+	}
+	if !m.used.Use(claims.ID, claims.ExpiresAt.Time) {
+		return nil, fmt.Errorf("%w: already used", ErrInvalidSession)
+	}
+	return claims, nil
+}
@@ -0,0 +1,235 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Authenticator data flags (WebAuthn §6.1).
+const (
+	flagUserPresent      = 0x01
+	flagUserVerified     = 0x04
+	flagBackupEligible   = 0x08
+	flagBackupState      = 0x10
+	flagAttestedCredData = 0x40
+	flagExtensionData    = 0x80
+)
+
+// ErrVerification is wrapped by every error caused by the client's response rather
+// than by the server.
+var ErrVerification = errors.New("webauthn verification failed")
+
+func verificationError(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrVerification, fmt.Sprintf(format, args...))
+}
+
+// decodeBase64URL decodes the base64url fields of browser responses, with or without
+// padding.
+func decodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+func encodeBase64URL(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// clientData is the CollectedClientData the browser signs over (WebAuthn §5.8.1).
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// verifyClientData checks the client data of a ceremony of type typ ("webauthn.create"
+// or "webauthn.get") against the expected challenge and origins.
+func verifyClientData(raw []byte, typ string, challenge []byte, origins []string) error {
+	var cd clientData
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return verificationError("invalid client data: %v", err)
+	}
+	if cd.Type != typ {
+		return verificationError("client data type %q, want %q", cd.Type, typ)
+	}
+	got, err := decodeBase64URL(cd.Challenge)
+	if err != nil || subtle.ConstantTimeCompare(got, challenge) != 1 {
+		return verificationError("challenge mismatch")
+	}
+	if cd.CrossOrigin {
+		return verificationError("cross-origin ceremonies are not allowed")
+	}
+	for _, origin := range origins {
+		if cd.Origin == origin {
+			return nil
+		}
+	}
+	return verificationError("origin %q is not allowed", cd.Origin)
+}
+
+// authenticatorData is the parsed authenticator data (WebAuthn §6.1).
+type authenticatorData struct {
+	rpIDHash  []byte
+	flags     byte
+	signCount uint32
+	// Attested credential data, present at registration
+	aaguid       []byte
+	credentialID []byte
+	publicKey    []byte // COSE_Key
+}
+
+func parseAuthenticatorData(raw []byte) (*authenticatorData, error) {
+	if len(raw) < 37 {
+		return nil, verificationError("authenticator data too short")
+	}
+	ad := &authenticatorData{
+		rpIDHash:  raw[:32],
+		flags:     raw[32],
+		signCount: binary.BigEndian.Uint32(raw[33:37]),
+	}
+	rest := raw[37:]
+	if ad.flags&flagAttestedCredData != 0 {
+		if len(rest) < 18 {
+			return nil, verificationError("attested credential data too short")
+		}
+		ad.aaguid = rest[:16]
+		idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if idLen > 1023 || len(rest) < idLen {
+			return nil, verificationError("invalid credential ID length")
+		}
+		ad.credentialID = rest[:idLen]
+		rest = rest[idLen:]
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, verificationError("invalid credential public key: %v", err)
+		}
+		ad.publicKey = rest[:len(rest)-len(after)]
+		rest = after
+	}
+	if ad.flags&flagExtensionData != 0 {
+		var err error
+		if _, rest, err = decodeCBOR(rest); err != nil {
+			return nil, verificationError("invalid extension data: %v", err)
+		}
+	}
+	if len(rest) != 0 {
+		return nil, verificationError("trailing data after authenticator data")
+	}
+	return ad, nil
+}
+
+// verifyRP checks the RP ID hash and user flags of authenticator data.
+func (ad *authenticatorData) verifyRP(rpID string, requireUV bool) error {
+	want := sha256.Sum256([]byte(rpID))
+	if !bytes.Equal(ad.rpIDHash, want[:]) {
+		return verificationError("RP ID mismatch")
+	}
+	if ad.flags&flagUserPresent == 0 {
+		return verificationError("user not present")
+	}
+	if requireUV && ad.flags&flagUserVerified == 0 {
+		return verificationError("user not verified")
+	}
+	return nil
+}
+
+// formatAAGUID formats an AAGUID like a UUID.
+func formatAAGUID(b []byte) string {
+	if len(b) != 16 {
+		return ""
+	}
+	h := hex.EncodeToString(b)
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
+
+// registration is a credential verified by verifyRegistration.
+type registration struct {
+	credentialID   []byte
+	publicKey      []byte
+	alg            int
+	signCount      uint32
+	aaguid         string
+	backupEligible bool
+}
+
+// verifyRegistration verifies the response to a registration ceremony (WebAuthn §7.1).
+// The attestation statement isn't verified: LIMEN requests "none" attestation and
+// trusts the authenticator of the signed-in user registering it.
+func verifyRegistration(rpID string, origins []string, challenge []byte, requireUV bool, clientDataJSON, attestationObject []byte) (*registration, error) {
+	if err := verifyClientData(clientDataJSON, "webauthn.create", challenge, origins); err != nil {
+		return nil, err
+	}
+	item, rest, err := decodeCBOR(attestationObject)
+	if err != nil || len(rest) != 0 {
+		return nil, verificationError("invalid attestation object")
+	}
+	att, ok := item.(map[interface{}]interface{})
+	if !ok {
+		return nil, verificationError("invalid attestation object")
+	}
+	rawAuthData, ok := att["authData"].([]byte)
+	if !ok {
+		return nil, verificationError("attestation object has no authenticator data")
+	}
+	ad, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := ad.verifyRP(rpID, requireUV); err != nil {
+		return nil, err
+	}
+	if ad.credentialID == nil {
+		return nil, verificationError("no attested credential data")
+	}
+	key, err := parsePublicKey(ad.publicKey)
+	if err != nil {
+		return nil, verificationError("%v", err)
+	}
+	return &registration{
+		credentialID:   ad.credentialID,
+		publicKey:      ad.publicKey,
+		alg:            key.alg,
+		signCount:      ad.signCount,
+		aaguid:         formatAAGUID(ad.aaguid),
+		backupEligible: ad.flags&flagBackupEligible != 0,
+	}, nil
+}
+
+// verifyAssertion verifies the response to an authentication ceremony (WebAuthn §7.2)
+// with the stored COSE key of the credential, returning the authenticator's new
+// signature counter.
+func verifyAssertion(rpID string, origins []string, challenge []byte, requireUV bool, storedKey []byte, storedCount uint32, clientDataJSON, rawAuthData, signature []byte) (uint32, error) {
+	if err := verifyClientData(clientDataJSON, "webauthn.get", challenge, origins); err != nil {
+		return 0, err
+	}
+	ad, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return 0, err
+	}
+	if err := ad.verifyRP(rpID, requireUV); err != nil {
+		return 0, err
+	}
+	key, err := parsePublicKey(storedKey)
+	if err != nil {
+		return 0, err
+	}
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte(nil), rawAuthData...), clientDataHash[:]...)
+	if !key.verify(signed, signature) {
+		return 0, verificationError("invalid signature")
+	}
+	// Authenticators without a counter always report 0; otherwise it must increase, or
+	// the credential was cloned
+	if (ad.signCount != 0 || storedCount != 0) && ad.signCount <= storedCount {
+		return 0, verificationError("signature counter did not increase (%d <= %d): possible cloned authenticator", ad.signCount, storedCount)
+	}
+	return ad.signCount, nil
+}
@@ -0,0 +1,335 @@
+package webauthn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DARC0625/LIMEN/backend/internal/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+const (
+	testRPID   = "limen.example"
+	testOrigin = "https://limen.example"
+)
+
+// encodeCBOR encodes the subset of CBOR decodeCBOR returns.
+func encodeCBOR(v interface{}) []byte {
+	head := func(major byte, n uint64) []byte {
+		switch {
+		case n < 24:
+			return []byte{major<<5 | byte(n)}
+		case n <= 0xff:
+			return []byte{major<<5 | 24, byte(n)}
+		case n <= 0xffff:
+			return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+		default:
+			return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n))
+		}
+	}
+	switch v := v.(type) {
+	case int:
+		if v < 0 {
+			return head(1, uint64(-1-v))
+		}
+		return head(0, uint64(v))
+	case []byte:
+		return append(head(2, uint64(len(v))), v...)
+	case string:
+		return append(head(3, uint64(len(v))), v...)
+	case []interface{}:
+		out := head(4, uint64(len(v)))
+		for _, item := range v {
+			out = append(out, encodeCBOR(item)...)
+		}
+		return out
+	case map[interface{}]interface{}:
+		out := head(5, uint64(len(v)))
+		for k, item := range v {
+			out = append(out, encodeCBOR(k)...)
+			out = append(out, encodeCBOR(item)...)
+		}
+		return out
+	case bool:
+		if v {
+			return []byte{0xf5}
+		}
+		return []byte{0xf4}
+	}
+	panic("encodeCBOR: unsupported type")
+}
+
+// testAuthenticator is a software ES256 authenticator.
+type testAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	count        uint32
+	flags        byte
+	origin       string
+}
+
+func newTestAuthenticator(t *testing.T, userHandle string) *testAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	return &testAuthenticator{key: key, credentialID: id, userHandle: []byte(userHandle),
+		flags: flagUserPresent | flagUserVerified, origin: testOrigin}
+}
+
+func (a *testAuthenticator) coseKey() []byte {
+	x := a.key.PublicKey.X.FillBytes(make([]byte, 32))
+	y := a.key.PublicKey.Y.FillBytes(make([]byte, 32))
+	return encodeCBOR(map[interface{}]interface{}{
+		coseKty: coseKtyEC2, coseAlg: AlgES256, coseCrv: coseCrvP256, coseX: x, coseY: y,
+	})
+}
+
+func (a *testAuthenticator) authData(attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(testRPID))
+	flags := a.flags
+	if attested {
+		flags |= flagAttestedCredData
+	}
+	data := append(rpIDHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, a.count)
+	if attested {
+		data = append(data, make([]byte, 16)...) // AAGUID
+		data = binary.BigEndian.AppendUint16(data, uint16(len(a.credentialID)))
+		data = append(data, a.credentialID...)
+		data = append(data, a.coseKey()...)
+	}
+	return data
+}
+
+func (a *testAuthenticator) clientData(typ, challenge string) []byte {
+	raw, _ := json.Marshal(map[string]interface{}{"type": typ, "challenge": challenge, "origin": a.origin})
+	return raw
+}
+
+func (a *testAuthenticator) create(opts *CreationOptions) *AttestationResponse {
+	resp := &AttestationResponse{ID: encodeBase64URL(a.credentialID), RawID: encodeBase64URL(a.credentialID), Type: "public-key"}
+	resp.Response.ClientDataJSON = encodeBase64URL(a.clientData("webauthn.create", opts.Challenge))
+	resp.Response.AttestationObject = encodeBase64URL(encodeCBOR(map[interface{}]interface{}{
+		"fmt": "none", "attStmt": map[interface{}]interface{}{}, "authData": a.authData(true),
+	}))
+	resp.Response.Transports = []string{"usb"}
+	return resp
+}
+
+func (a *testAuthenticator) get(t *testing.T, opts *RequestOptions) *AssertionResponse {
+	a.count++
+	clientData := a.clientData("webauthn.get", opts.Challenge)
+	authData := a.authData(false)
+	hash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), hash[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatalf("SignASN1() error = %v", err)
+	}
+	resp := &AssertionResponse{ID: encodeBase64URL(a.credentialID), RawID: encodeBase64URL(a.credentialID), Type: "public-key"}
+	resp.Response.ClientDataJSON = encodeBase64URL(clientData)
+	resp.Response.AuthenticatorData = encodeBase64URL(authData)
+	resp.Response.Signature = encodeBase64URL(sig)
+	resp.Response.UserHandle = encodeBase64URL(a.userHandle)
+	return resp
+}
+
+func newTestManager(t *testing.T) *Manager {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.WebAuthnCredential{}); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+	return NewManager(db, Config{RPID: testRPID, RPName: "LIMEN", Origins: []string{testOrigin}}, "test-secret")
+}
+
+// register registers a credential of a for user 7.
+func register(t *testing.T, m *Manager, a *testAuthenticator) *models.WebAuthnCredential {
+	opts, session, err := m.BeginRegistration(User{ID: 7, Handle: a.userHandle, Name: "alice"})
+	if err != nil {
+		t.Fatalf("BeginRegistration() error = %v", err)
+	}
+	cred, err := m.FinishRegistration(7, session, a.create(opts), "YubiKey")
+	if err != nil {
+		t.Fatalf("FinishRegistration() error = %v", err)
+	}
+	return cred
+}
+
+func TestManager_RegisterAndLogin(t *testing.T) {
+	m := newTestManager(t)
+	a := newTestAuthenticator(t, "user-7")
+	cred := register(t, m, a)
+	if cred.UserID != 7 || cred.Name != "YubiKey" || cred.Algorithm != AlgES256 || cred.Transports != "usb" {
+		t.Errorf("registered credential = %+v", cred)
+	}
+
+	// Registering the same authenticator again is refused, and it is excluded
+	opts, session, _ := m.BeginRegistration(User{ID: 7, Handle: a.userHandle, Name: "alice"})
+	if len(opts.ExcludeCredentials) != 1 || opts.ExcludeCredentials[0].ID != cred.CredentialID {
+		t.Errorf("ExcludeCredentials = %+v", opts.ExcludeCredentials)
+	}
+	if _, err := m.FinishRegistration(7, session, a.create(opts), ""); !errors.Is(err, ErrCredentialExists) {
+		t.Errorf("FinishRegistration() of a registered credential error = %v, want ErrCredentialExists", err)
+	}
+
+	// Passwordless: any discoverable credential, user verification required
+	req, session, err := m.BeginLogin(0)
+	if err != nil || len(req.AllowCredentials) != 0 || req.UserVerification != "required" {
+		t.Fatalf("BeginLogin(0) = %+v, %v", req, err)
+	}
+	assertion := a.get(t, req)
+	got, err := m.FinishLogin(session, assertion, a.userHandle)
+	if err != nil || got.ID != cred.ID || got.SignCount != 1 || got.LastUsedAt == nil {
+		t.Fatalf("FinishLogin() = %+v, %v", got, err)
+	}
+	if _, err := m.FinishLogin(session, assertion, a.userHandle); !errors.Is(err, ErrInvalidSession) {
+		t.Errorf("replayed FinishLogin() error = %v, want ErrInvalidSession", err)
+	}
+
+	// Second factor: the user's credentials only
+	req, session, err = m.BeginLogin(7)
+	if err != nil || len(req.AllowCredentials) != 1 {
+		t.Fatalf("BeginLogin(7) = %+v, %v", req, err)
+	}
+	if _, err := m.FinishLogin(session, a.get(t, req), a.userHandle); err != nil {
+		t.Errorf("second factor FinishLogin() error = %v", err)
+	}
+	if _, _, err := m.BeginLogin(8); !errors.Is(err, ErrCredentialNotFound) {
+		t.Errorf("BeginLogin() of a user without credentials error = %v, want ErrCredentialNotFound", err)
+	}
+	_, session, _ = m.BeginLogin(0)
+	if _, err := m.FinishLogin(session, a.get(t, req), []byte("user-8")); !errors.Is(err, ErrVerification) {
+		t.Errorf("FinishLogin() with another user's handle error = %v, want ErrVerification", err)
+	}
+}
+
+func TestManager_RejectsInvalidAssertions(t *testing.T) {
+	m := newTestManager(t)
+	a := newTestAuthenticator(t, "user-7")
+	register(t, m, a)
+
+	tests := []struct {
+		name   string
+		before func(a *testAuthenticator)
+		after  func(resp *AssertionResponse)
+	}{
+		{name: "wrong origin", before: func(a *testAuthenticator) { a.origin = "https://evil.example" }},
+		{name: "not verified", before: func(a *testAuthenticator) { a.flags = flagUserPresent }},
+		{name: "bad signature", after: func(resp *AssertionResponse) {
+			resp.Response.Signature = encodeBase64URL([]byte{0x30, 0x06, 0x02, 0x01, 0x01, 0x02, 0x01, 0x01})
+		}},
+		{name: "truncated authenticator data", after: func(resp *AssertionResponse) {
+			resp.Response.AuthenticatorData = encodeBase64URL(make([]byte, 36))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := *a
+			if tt.before != nil {
+				tt.before(&a)
+			}
+			req, session, _ := m.BeginLogin(0)
+			resp := a.get(t, req)
+			if tt.after != nil {
+				tt.after(resp)
+			}
+			if _, err := m.FinishLogin(session, resp, a.userHandle); !errors.Is(err, ErrVerification) {
+				t.Errorf("FinishLogin() error = %v, want ErrVerification", err)
+			}
+		})
+	}
+}
+
+func TestManager_DetectsClonedAuthenticator(t *testing.T) {
+	m := newTestManager(t)
+	a := newTestAuthenticator(t, "user-7")
+	register(t, m, a)
+	clone := *a
+
+	for i := 0; i < 2; i++ {
+		req, session, _ := m.BeginLogin(0)
+		if _, err := m.FinishLogin(session, a.get(t, req), a.userHandle); err != nil {
+			t.Fatalf("FinishLogin() error = %v", err)
+		}
+	}
+	// The clone's counter is behind the original's
+	req, session, _ := m.BeginLogin(0)
+	if _, err := m.FinishLogin(session, clone.get(t, req), a.userHandle); !errors.Is(err, ErrVerification) {
+		t.Errorf("FinishLogin() of a clone error = %v, want ErrVerification", err)
+	}
+}
+
+func TestManager_RegistrationChecks(t *testing.T) {
+	m := newTestManager(t)
+	a := newTestAuthenticator(t, "user-7")
+
+	opts, session, _ := m.BeginRegistration(User{ID: 7, Handle: a.userHandle, Name: "alice"})
+	if _, err := m.FinishRegistration(8, session, a.create(opts), ""); !errors.Is(err, ErrInvalidSession) {
+		t.Errorf("FinishRegistration() by another user error = %v, want ErrInvalidSession", err)
+	}
+
+	opts, session, _ = m.BeginRegistration(User{ID: 7, Handle: a.userHandle, Name: "alice"})
+	other := *opts
+	other.Challenge = encodeBase64URL([]byte("another challenge"))
+	if _, err := m.FinishRegistration(7, session, a.create(&other), ""); !errors.Is(err, ErrVerification) {
+		t.Errorf("FinishRegistration() with another challenge error = %v, want ErrVerification", err)
+	}
+
+	m.now = func() time.Time { return time.Now().Add(-time.Hour) }
+	opts, session, _ = m.BeginRegistration(User{ID: 7, Handle: a.userHandle, Name: "alice"})
+	m.now = time.Now
+	if _, err := m.FinishRegistration(7, session, a.create(opts), ""); !errors.Is(err, ErrInvalidSession) {
+		t.Errorf("FinishRegistration() of an expired session error = %v, want ErrInvalidSession", err)
+	}
+
+	disabled := NewManager(m.db, Config{}, "test-secret")
+	if _, _, err := disabled.BeginLogin(0); !errors.Is(err, ErrNotConfigured) {
+		t.Errorf("BeginLogin() without an RP ID error = %v, want ErrNotConfigured", err)
+	}
+}
+
+func TestDecodeCBOR(t *testing.T) {
+	item, rest, err := decodeCBOR(append(encodeCBOR(map[interface{}]interface{}{
+		1: -7, "k": []interface{}{[]byte{1, 2}, "s", true}, -300: 70000,
+	}), 0xff))
+	if err != nil || len(rest) != 1 {
+		t.Fatalf("decodeCBOR() = %v, %v, %v", item, rest, err)
+	}
+	m := item.(map[interface{}]interface{})
+	if m[int64(1)] != int64(-7) || m[int64(-300)] != int64(70000) || m["k"].([]interface{})[1] != "s" {
+		t.Errorf("decodeCBOR() = %v", m)
+	}
+
+	deep := make([]byte, 0, 32)
+	for i := 0; i < 32; i++ {
+		deep = append(deep, 0x81) // Array of one item
+	}
+	for _, bad := range [][]byte{
+		{},
+		{0x58, 0x05, 1, 2}, // Byte string shorter than its length
+		{0xa2, 0x01, 0x02}, // Map missing an entry
+		{0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, // Huge array
+		{0x5f},                         // Indefinite length
+		{0xa2, 0x01, 0x02, 0x01, 0x03}, // Duplicate key
+		append(deep, 0x00),
+	} {
+		if _, _, err := decodeCBOR(bad); err == nil {
+			t.Errorf("decodeCBOR(%x) succeeded", bad)
+		}
+	}
+}